@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/repository"
+	"wurenji-backend/internal/service"
+)
+
+// credit_backfill 从已完成/已取消订单、评价、已确认违规与围栏闯入记录补登信用事件，
+// 再按全部信用事件重算各用户信用分(资质类维度保持不变)，可重复执行，例如:
+//
+//	go run ./cmd/credit_backfill -config config.yaml
+//	go run ./cmd/credit_backfill -config config.yaml -skip-recompute
+func main() {
+	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	skipRecompute := flag.Bool("skip-recompute", false, "只补登信用事件，不重算信用分")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	db, err := gorm.Open(mysql.Open(cfg.Database.DSN()), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+
+	creditService := service.NewCreditService(repository.NewCreditRepository(db))
+	creditService.SetCreditConfig(cfg.Credit)
+
+	created, err := creditService.BackfillCreditEvents()
+	if err != nil {
+		log.Fatalf("补登信用事件失败: %v", err)
+	}
+	fmt.Printf("补登信用事件 %d 条\n", created)
+	if *skipRecompute {
+		return
+	}
+
+	users, err := creditService.RecomputeCreditScores(time.Now())
+	if err != nil {
+		log.Fatalf("重算信用分失败: %v", err)
+	}
+	fmt.Printf("重算信用分 %d 个用户\n", users)
+}
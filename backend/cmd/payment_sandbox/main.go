@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	paymentpkg "wurenji-backend/internal/pkg/payment"
+)
+
+// payment_sandbox 本地支付沙箱，模拟微信支付与支付宝的下单/查询/退款/转账接口和异步通知
+// 后端配置 payment.<渠道>.provider=api 并将 gateway_url 指向沙箱即可联调完整支付链路，例如:
+//
+//	go run ./cmd/payment_sandbox -addr :9100 -wechat-appid wx_sandbox -wechat-mchid 1900000001 -wechat-key sandbox_key
+//	curl -d 'channel=wechat&payment_no=PAY...' http://127.0.0.1:9100/sandbox/pay
+//	curl --data-urlencode 'order_string=...' -d 'channel=alipay' http://127.0.0.1:9100/sandbox/pay
+//
+// 提现出款(payment.payout.<渠道>=api)同样走沙箱: 收款账号以 fail 开头直接失败，以 pending 开头保持处理中，
+// 之后用 curl -d 'channel=wechat&payout_no=WD...&result=succeeded' http://127.0.0.1:9100/sandbox/payout 给出结果
+//
+// 未指定 -alipay-key 时启动时生成一对密钥，并打印需要配置到 payment.alipay.public_key 的公钥
+func main() {
+	addr := flag.String("addr", ":9100", "监听地址")
+	wechatAppID := flag.String("wechat-appid", "wx_sandbox", "微信 appid，需与后端配置一致")
+	wechatMchID := flag.String("wechat-mchid", "1900000001", "微信商户号，需与后端配置一致")
+	wechatKey := flag.String("wechat-key", "sandbox_api_key", "微信 APIv2 密钥，需与后端配置一致")
+	alipayAppID := flag.String("alipay-appid", "2021000000000000", "支付宝 app_id，需与后端配置一致")
+	alipayKey := flag.String("alipay-key", "", "沙箱签名私钥(文件或内容)，为空时自动生成")
+	alipayAppPublicKey := flag.String("alipay-app-public-key", "", "应用公钥(文件或内容)，用于校验后端请求签名，为空时不校验")
+	notifyDelay := flag.Duration("notify-delay", time.Second, "支付完成后发送异步通知的延迟")
+	notifyRetries := flag.Int("notify-retries", 3, "异步通知失败重试次数")
+	dropNotify := flag.Bool("drop-notify", false, "不发送异步通知，用于验证主动查询")
+	flag.Parse()
+
+	logger, _ := zap.NewDevelopment()
+	defer logger.Sync()
+
+	config := paymentpkg.SandboxConfig{
+		WeChatAppID:   *wechatAppID,
+		WeChatMchID:   *wechatMchID,
+		WeChatAPIKey:  *wechatKey,
+		AlipayAppID:   *alipayAppID,
+		NotifyDelay:   *notifyDelay,
+		NotifyRetries: *notifyRetries,
+		DropNotify:    *dropNotify,
+	}
+
+	var err error
+	if *alipayKey != "" {
+		config.AlipayPrivateKey, err = paymentpkg.ParseRSAPrivateKey(*alipayKey)
+	} else {
+		config.AlipayPrivateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		log.Fatalf("加载沙箱私钥失败: %v", err)
+	}
+	if *alipayAppPublicKey != "" {
+		if config.AlipayAppPublicKey, err = paymentpkg.ParseRSAPublicKey(*alipayAppPublicKey); err != nil {
+			log.Fatalf("加载应用公钥失败: %v", err)
+		}
+	}
+	if *alipayKey == "" {
+		publicKey, err := paymentpkg.EncodeRSAPublicKey(&config.AlipayPrivateKey.PublicKey)
+		if err != nil {
+			log.Fatalf("导出沙箱公钥失败: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "支付宝沙箱公钥(配置到 payment.alipay.public_key):\n%s\n", publicKey)
+	}
+
+	sandbox := paymentpkg.NewSandbox(config, logger)
+	logger.Info("支付沙箱已启动", zap.String("addr", *addr))
+	if err := http.ListenAndServe(*addr, sandbox.Handler()); err != nil {
+		log.Fatalf("支付沙箱退出: %v", err)
+	}
+}
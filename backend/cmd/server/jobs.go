@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/repository"
+	"wurenji-backend/internal/scheduler"
+	"wurenji-backend/internal/service"
+)
+
+// jobServices 定时任务依赖的业务服务
+type jobServices struct {
+	dispatch    *service.DispatchService
+	settlement  *service.SettlementService
+	ledger      *service.LedgerService
+	credit      *service.CreditService
+	dispute     *service.DisputeService
+	coupon      *service.CouponService
+	surge       *service.SurgeService
+	expiry      *service.CredentialExpiryService
+	maintenance *service.MaintenancePlannerService
+	battery     *service.BatteryService
+	payment     *service.PaymentService
+	analytics   *service.AnalyticsService
+	client      *service.ClientService
+	owner       *service.OwnerService
+	airspace    *service.AirspaceService
+	flight      *service.FlightService
+	jobRuns     *repository.JobRunRepo
+}
+
+type jobDefinition struct {
+	name        string
+	description string
+	defaultSpec string
+	run         scheduler.JobFunc
+}
+
+func buildJobDefinitions(cfg *config.Config, svc jobServices, sched *scheduler.Scheduler) []jobDefinition {
+	return []jobDefinition{
+		{
+			name:        "dispatch_process_pending",
+			description: "处理待派单任务并为待派单订单自动派单",
+			defaultSpec: "@every 30s",
+			run: func(ctx context.Context) (int, error) {
+				return 0, svc.dispatch.ProcessPendingTasks()
+			},
+		},
+		{
+			name:        "dispatch_handle_expired",
+			description: "处理派单超时任务并重新派单",
+			defaultSpec: "@every 1m",
+			run: func(ctx context.Context) (int, error) {
+				return 0, svc.dispatch.HandleExpiredTasks()
+			},
+		},
+		{
+			name:        "payment_sync_pending",
+			description: "主动查询未收到渠道回调的待支付单状态",
+			defaultSpec: "@every 1m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.payment.SyncPendingPayments(
+					time.Duration(cfg.Payment.PendingQueryAfter)*time.Second,
+					time.Duration(cfg.Payment.PendingQueryWindow)*time.Hour,
+					100,
+				)
+			},
+		},
+		{
+			name:        "settlement_process_pending",
+			description: "推进自动结算：计算已完成订单、争议期满自动确认并入账",
+			defaultSpec: "@every 1m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.settlement.RunSettlementPipeline(100)
+			},
+		},
+		{
+			name:        "withdrawal_sync_payouts",
+			description: "提交审批通过的提现出款并同步渠道出款结果，失败时解冻退回余额",
+			defaultSpec: "@every 2m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.settlement.SyncPayouts(100)
+			},
+		},
+		{
+			name:        "ledger_reconcile",
+			description: "账本对账：补记存量钱包期初余额，检查借贷平衡与钱包余额漂移",
+			defaultSpec: "30 2 * * *",
+			run: func(ctx context.Context) (int, error) {
+				return svc.ledger.RunReconcileJob()
+			},
+		},
+		{
+			name:        "credit_apply_events",
+			description: "计入待处理的信用事件，重试此前计入失败的事件",
+			defaultSpec: "@every 1m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.credit.ApplyCreditEvents(200)
+			},
+		},
+		{
+			name:        "credit_decay",
+			description: "信用事件影响按半衰期衰减，回收已计入的影响分",
+			defaultSpec: "20 3 * * *",
+			run: func(ctx context.Context) (int, error) {
+				return svc.credit.DecayCreditEvents(time.Now())
+			},
+		},
+		{
+			name:        "dispute_sla",
+			description: "答辩逾期的纠纷进入仲裁，超过处理时限的纠纷标记超时并提醒处理",
+			defaultSpec: "@every 10m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.dispute.ProcessDisputeSLA(time.Now(), 200)
+			},
+		},
+		{
+			name:        "coupon_expire",
+			description: "释放支付超时未付款订单锁定的优惠券，过期未使用的优惠券置为已过期",
+			defaultSpec: "5 * * * *",
+			run: func(ctx context.Context) (int, error) {
+				return svc.coupon.ExpireCoupons(time.Now(), 1000)
+			},
+		},
+		{
+			name:        "surge_refresh",
+			description: "按城市与网格的实时供需刷新动态溢价倍率",
+			defaultSpec: "@every 5m",
+			run: func(ctx context.Context) (int, error) {
+				result, err := svc.surge.RefreshMultipliers(time.Now())
+				if err != nil {
+					return 0, err
+				}
+				return result.Scopes, nil
+			},
+		},
+		{
+			name:        "credential_expiry_check",
+			description: "飞手与无人机证照到期分档提醒，到期后置为过期并暂停接单与供给",
+			defaultSpec: "0 9 * * *",
+			run: func(ctx context.Context) (int, error) {
+				result, err := svc.expiry.CheckExpiries(time.Now())
+				if err != nil {
+					return 0, err
+				}
+				return result.Reminded + result.Expired, nil
+			},
+		},
+		{
+			name:        "maintenance_planner",
+			description: "累加飞行使用量并对照机型维护计划生成维护工单，超过强制上限时停飞",
+			defaultSpec: "@every 30m",
+			run: func(ctx context.Context) (int, error) {
+				result, err := svc.maintenance.RunPlanner(time.Now())
+				if err != nil {
+					return 0, err
+				}
+				return result.FlightsCounted + result.WorkOrders + result.Escalated, nil
+			},
+		},
+		{
+			name:        "battery_usage",
+			description: "回填已结束飞行的电池放电数据，累计循环、估算健康度并自动退役",
+			defaultSpec: "@every 10m",
+			run: func(ctx context.Context) (int, error) {
+				result, err := svc.battery.RecordFlightUsage(time.Now())
+				if err != nil {
+					return 0, err
+				}
+				return result.Packs, nil
+			},
+		},
+		{
+			name:        "analytics_daily_statistics",
+			description: "生成昨日统计数据",
+			defaultSpec: "10 0 * * *",
+			run: func(ctx context.Context) (int, error) {
+				return 1, svc.analytics.RunDailyStatisticsJob()
+			},
+		},
+		{
+			name:        "analytics_hourly_metrics",
+			description: "记录小时指标",
+			defaultSpec: "5 * * * *",
+			run: func(ctx context.Context) (int, error) {
+				return 1, svc.analytics.RunHourlyMetricsJob()
+			},
+		},
+		{
+			name:        "analytics_auto_report",
+			description: "自动生成日报/周报/月报",
+			defaultSpec: "15 1-3 * * *",
+			run: func(ctx context.Context) (int, error) {
+				return 0, svc.analytics.RunAutoReportJob()
+			},
+		},
+		{
+			name:        "demand_close_expired",
+			description: "关闭已过期的需求",
+			defaultSpec: "@every 5m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.client.CloseExpiredDemands(100)
+			},
+		},
+		{
+			name:        "pilot_binding_expire_pending",
+			description: "过期未确认的机主飞手绑定邀请",
+			defaultSpec: "@every 10m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.owner.ExpirePendingBindings(100)
+			},
+		},
+		{
+			name:        "airspace_uom_sync",
+			description: "同步长时间未收到UOM回调的空域申请状态",
+			defaultSpec: "@every 5m",
+			run: func(ctx context.Context) (int, error) {
+				return svc.airspace.SyncPendingUOMApplications(10*time.Minute, 50)
+			},
+		},
+		{
+			name:        "flight_alert_escalation",
+			description: "未确认的飞行告警按升级策略逐级通知",
+			defaultSpec: "@every 15s",
+			run: func(ctx context.Context) (int, error) {
+				return svc.flight.EscalateAlerts(100)
+			},
+		},
+		{
+			name:        "flight_position_retention",
+			description: "飞行位置分级存储：超过全精度保留期的轨迹降采样，删除超过保留期的位置点",
+			defaultSpec: "40 3 * * *",
+			run: func(ctx context.Context) (int, error) {
+				result, err := svc.flight.RunPositionRetention(200)
+				return result.Downsampled, err
+			},
+		},
+		{
+			name:        "scheduler_trim_history",
+			description: "清理定时任务历史执行记录",
+			defaultSpec: "30 4 * * *",
+			run: func(ctx context.Context) (int, error) {
+				keep := cfg.Scheduler.HistoryKeep
+				if keep <= 0 {
+					return 0, nil
+				}
+				total := 0
+				for _, name := range sched.JobNames() {
+					removed, err := svc.jobRuns.TrimRuns(name, keep)
+					if err != nil {
+						return total, err
+					}
+					total += int(removed)
+				}
+				return total, nil
+			},
+		},
+	}
+}
+
+// registerScheduledJobs 注册所有后台定时任务
+func registerScheduledJobs(sched *scheduler.Scheduler, cfg *config.Config, svc jobServices, logger *zap.Logger) error {
+	for _, def := range buildJobDefinitions(cfg, svc, sched) {
+		spec := cfg.Scheduler.JobSpec(def.name, def.defaultSpec)
+		schedule, err := scheduler.ParseSchedule(spec)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", def.name, err)
+		}
+		if err := sched.Register(scheduler.Job{
+			Name:        def.name,
+			Description: def.description,
+			Schedule:    schedule,
+			Run:         def.run,
+		}); err != nil {
+			return err
+		}
+		logger.Info("scheduled job registered", zap.String("job", def.name), zap.String("schedule", schedule.String()))
+	}
+	return nil
+}
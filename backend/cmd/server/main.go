@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
@@ -23,6 +25,7 @@ import (
 	airspacehandler "wurenji-backend/internal/api/v1/airspace"
 	analyticshandler "wurenji-backend/internal/api/v1/analytics"
 	"wurenji-backend/internal/api/v1/auth"
+	batteryhandler "wurenji-backend/internal/api/v1/battery"
 	clienthandler "wurenji-backend/internal/api/v1/client"
 	credithandler "wurenji-backend/internal/api/v1/credit"
 	"wurenji-backend/internal/api/v1/demand"
@@ -47,9 +50,12 @@ import (
 	paymentpkg "wurenji-backend/internal/pkg/payment"
 	"wurenji-backend/internal/pkg/push"
 	"wurenji-backend/internal/pkg/sms"
+	"wurenji-backend/internal/pkg/uom"
 	"wurenji-backend/internal/pkg/upload"
 	"wurenji-backend/internal/repository"
+	"wurenji-backend/internal/scheduler"
 	"wurenji-backend/internal/service"
+	"wurenji-backend/internal/telemetry"
 	ws "wurenji-backend/internal/websocket"
 )
 
@@ -109,7 +115,16 @@ func main() {
 
 	// Init WebSocket Hub
 	hub := ws.NewHub(zapLogger)
+	if cfg.WebSocket.Cluster {
+		nodeID := cfg.WebSocket.NodeID
+		if nodeID == "" {
+			nodeID = ws.DefaultNodeID()
+		}
+		hub.EnableCluster(ws.NewRedisBroker(rds), nodeID)
+		zapLogger.Info("WebSocket cluster fan-out enabled", zap.String("node_id", nodeID))
+	}
 	go hub.Run()
+	defer hub.Close()
 
 	// 设置token黑名单Redis
 	middleware.SetTokenBlacklistRedis(rds)
@@ -135,11 +150,13 @@ func main() {
 	migrationRepo := repository.NewMigrationRepo(db)
 	airspaceRepo := repository.NewAirspaceRepo(db)
 	settlementRepo := repository.NewSettlementRepo(db)
+	ledgerRepo := repository.NewLedgerRepo(db)
 	creditRepo := repository.NewCreditRepository(db)
 	insuranceRepo := repository.NewInsuranceRepository(db)
 	analyticsRepo := repository.NewAnalyticsRepository(db)
 
 	contractRepo := repository.NewContractRepo(db)
+	jobRunRepo := repository.NewJobRunRepo(db)
 
 	// Init pkg services
 	smsService := sms.NewSMSService(cfg.SMS.Provider, zapLogger)
@@ -207,8 +224,9 @@ func main() {
 	flightService := service.NewFlightService(flightRepo, orderRepo, pilotRepo, zapLogger)
 	homeService := service.NewHomeService(userService, clientService, ownerService, pilotService, orderService, demandDomainRepo)
 	operationsService := service.NewOperationsService(migrationRepo, orderRepo)
-	airspaceService := service.NewAirspaceService(airspaceRepo, pilotRepo, droneRepo, orderRepo, zapLogger)
+	airspaceService := service.NewAirspaceService(airspaceRepo, pilotRepo, droneRepo, orderRepo, flightRepo, zapLogger)
 	settlementService := service.NewSettlementService(settlementRepo, orderRepo, zapLogger)
+	ledgerService := service.NewLedgerService(ledgerRepo, zapLogger)
 	creditService := service.NewCreditService(creditRepo)
 	insuranceService := service.NewInsuranceService(insuranceRepo, zapLogger)
 	analyticsService := service.NewAnalyticsService(analyticsRepo)
@@ -226,10 +244,91 @@ func main() {
 	paymentService.SetDispatchService(dispatchService)
 	paymentService.SetEventService(eventService)
 	paymentService.SetContractRepo(contractRepo)
+	paymentService.SetLedgerRepo(ledgerRepo)
+	creditService.SetLedgerRepo(ledgerRepo)
+	creditService.SetCreditConfig(cfg.Credit)
+	for method, provider := range buildPaymentProviders(cfg.Payment, zapLogger) {
+		paymentService.SetProvider(method, provider)
+	}
+	for method, provider := range buildPayoutProviders(cfg.Payment, zapLogger) {
+		settlementService.SetPayoutProvider(method, provider)
+	}
 	orderService.SetEventService(eventService)
+	orderService.SetSettlementService(settlementService)
+	orderService.SetCreditService(creditService)
+	refundPolicyService := service.NewRefundPolicyService(repository.NewRefundPolicyRepo(db), zapLogger)
+	orderService.SetRefundPolicyService(refundPolicyService)
+	disputeService := service.NewDisputeService(repository.NewDisputeRepo(db), orderService, settlementRepo, cfg.Dispute, zapLogger)
+	disputeService.SetFlightRepo(flightRepo)
+	disputeService.SetCreditService(creditService)
+	disputeService.SetEventService(eventService)
+	orderService.SetDisputeService(disputeService)
+	couponService := service.NewCouponService(repository.NewCouponRepo(db), orderRepo, paymentRepo, userRepo, zapLogger)
+	orderService.SetCouponService(couponService)
+	paymentService.SetCouponService(couponService)
+	authService.SetCouponService(couponService)
+	surgeService := service.NewSurgeService(repository.NewSurgeRepo(db), cfg.Surge, zapLogger)
+	pricingEngine := service.NewPricingEngine(settlementRepo, ownerDomainRepo)
+	pricingEngine.SetSurgeService(surgeService)
+	orderService.SetPricingEngine(pricingEngine)
+	dispatchService.SetPricingEngine(pricingEngine)
+	reviewService.SetCreditService(creditService)
+	flightService.SetCreditService(creditService)
+	batteryService := service.NewBatteryService(repository.NewBatteryRepo(db), droneRepo, orderRepo, cfg.Battery, zapLogger)
+	orderGate := service.NewOrderGateService(cfg.OrderGate, creditService, insuranceService, airspaceService, pilotRepo, zapLogger)
+	orderGate.SetBatteryService(batteryService)
+	orderService.SetOrderGate(orderGate)
+	settlementService.SetFlightRepo(flightRepo)
 	dispatchService.SetEventService(eventService)
 	droneService.SetEventService(eventService)
 	contractService.SetEventService(eventService)
+	flightService.SetEventService(eventService)
+	credentialExpiryService := service.NewCredentialExpiryService(repository.NewCredentialExpiryRepo(db), zapLogger)
+	credentialExpiryService.SetEventService(eventService)
+	maintenancePlanner := service.NewMaintenancePlannerService(repository.NewMaintenanceRepo(db), droneRepo, zapLogger)
+	maintenancePlanner.SetEventService(eventService)
+	batteryService.SetEventService(eventService)
+	droneService.SetMaintenancePlanner(maintenancePlanner)
+
+	// Realtime topics
+	realtimeAuthorizer := service.NewRealtimeAuthorizer(orderService, flightRepo)
+	hub.SetAuthorizer(realtimeAuthorizer)
+	hub.SetAckHandler(service.NewRealtimeAckHandler(realtimeAuthorizer, flightService, flightRepo).HandleAck)
+	eventService.SetRealtimePublisher(hub)
+	flightService.SetRealtimePublisher(hub)
+
+	// Init UOM gateway
+	switch {
+	case cfg.UOM.IsHTTPEnabled():
+		airspaceService.SetUOMGateway(uom.NewHTTPGateway(uom.HTTPConfig{
+			BaseURL:     cfg.UOM.BaseURL,
+			AppID:       cfg.UOM.AppID,
+			AppSecret:   cfg.UOM.AppSecret,
+			CallbackURL: cfg.UOM.CallbackURL,
+			Timeout:     time.Duration(cfg.UOM.Timeout) * time.Second,
+		}, zapLogger))
+		zapLogger.Info("UOM HTTP gateway initialized", zap.String("base_url", cfg.UOM.BaseURL))
+	case cfg.UOM.IsSimulatorEnabled():
+		secret := cfg.UOM.AppSecret
+		if secret == "" {
+			// 未配置密钥时每次启动随机生成，外部无法伪造模拟器回调
+			secret, err = randomSecret()
+			if err != nil {
+				zapLogger.Fatal("Failed to generate UOM simulator secret", zap.Error(err))
+			}
+		}
+		simulator := uom.NewSimulator(uom.SimulatorConfig{
+			DecisionDelay: time.Duration(cfg.UOM.Simulator.DecisionDelay) * time.Second,
+			Decision:      cfg.UOM.Simulator.Decision,
+			MaxAltitude:   cfg.UOM.Simulator.MaxAltitude,
+			Secret:        secret,
+		}, zapLogger)
+		simulator.SetCallbackSink(airspaceService.HandleUOMCallback)
+		airspaceService.SetUOMGateway(simulator)
+		zapLogger.Warn("Using UOM simulator, airspace applications are auto-decided", zap.String("decision", cfg.UOM.Simulator.Decision))
+	default:
+		zapLogger.Warn("UOM gateway not configured, airspace applications cannot be submitted to UOM")
+	}
 
 	// Init AMap service
 	amapService := amap.NewAmapService(cfg.Amap.APIKey, zapLogger)
@@ -254,16 +353,86 @@ func main() {
 		Dispatch:   dispatchhandler.NewHandler(dispatchService, clientService, pilotService, orderRepo, orderArtifactRepo, demandDomainRepo, ownerDomainRepo),
 		Flight:     flighthandler.NewHandler(flightService, pilotService),
 		Airspace:   airspacehandler.NewHandler(airspaceService),
-		Settlement: settlementhandler.NewHandler(settlementService),
+		Settlement: settlementhandler.NewHandler(settlementService, ledgerService),
 		Credit:     credithandler.NewHandler(creditService),
 		Insurance:  insurancehandler.NewHandler(insuranceService),
 		Analytics:  analyticshandler.NewHandler(analyticsService),
+		Battery:    batteryhandler.NewHandler(batteryService),
 	}
 	v2Handlers := v2.NewHandlers(authService, userService, homeService, clientService, ownerService, droneService, pilotService, orderService, dispatchService, flightService, paymentService, settlementService, messageService, reviewService, pushService, cfg.Server.Mode, handlers.Admin, handlers.Analytics, handlers.Client)
 	v2Handlers.Order.SetContractService(contractService)
+	v2Handlers.Order.SetDisputeService(disputeService, uploadService)
+	v2Handlers.Payment.SetCouponService(couponService)
 	clientService.SetContractService(contractService)
 	orderService.SetContractService(contractService)
 
+	// Init scheduler
+	jobScheduler := scheduler.New(scheduler.NewRedisLocker(rds), jobRunRepo, zapLogger)
+	if err := registerScheduledJobs(jobScheduler, cfg, jobServices{
+		dispatch:    dispatchService,
+		settlement:  settlementService,
+		ledger:      ledgerService,
+		credit:      creditService,
+		dispute:     disputeService,
+		coupon:      couponService,
+		surge:       surgeService,
+		expiry:      credentialExpiryService,
+		maintenance: maintenancePlanner,
+		battery:     batteryService,
+		payment:     paymentService,
+		analytics:   analyticsService,
+		client:      clientService,
+		owner:       ownerService,
+		airspace:    airspaceService,
+		flight:      flightService,
+		jobRuns:     jobRunRepo,
+	}, zapLogger); err != nil {
+		zapLogger.Fatal("Failed to register scheduled jobs", zap.Error(err))
+	}
+	handlers.Admin.SetScheduler(jobScheduler, jobRunRepo)
+	handlers.Admin.SetRefundPolicyService(refundPolicyService)
+	handlers.Admin.SetDisputeService(disputeService)
+	handlers.Admin.SetCouponService(couponService)
+	handlers.Admin.SetSurgeService(surgeService)
+	handlers.Admin.SetCredentialExpiryService(credentialExpiryService)
+	handlers.Admin.SetMaintenancePlanner(maintenancePlanner)
+	handlers.Drone.SetMaintenancePlanner(maintenancePlanner)
+	handlers.Settlement.SetPricingEngine(pricingEngine)
+	if cfg.Scheduler.Enabled {
+		jobScheduler.Start(context.Background())
+		defer jobScheduler.Stop()
+	}
+
+	// Init MAVLink telemetry listener
+	if cfg.Telemetry.Enabled {
+		var sources []telemetry.SourceBinding
+		for _, src := range cfg.Telemetry.Sources {
+			binding, err := telemetry.ParseSourceBinding(src.SystemID, src.Source)
+			if err != nil {
+				zapLogger.Fatal("Invalid MAVLink telemetry source", zap.Error(err))
+			}
+			sources = append(sources, binding)
+		}
+		telemetryListener := telemetry.NewListener(telemetry.Config{
+			ListenAddr:        cfg.Telemetry.ListenAddr,
+			BatchSize:         cfg.Telemetry.BatchSize,
+			FlushInterval:     time.Duration(cfg.Telemetry.FlushInterval) * time.Millisecond,
+			MinSampleInterval: time.Duration(cfg.Telemetry.MinSampleInterval) * time.Millisecond,
+			IdleTimeout:       time.Duration(cfg.Telemetry.IdleTimeout) * time.Second,
+			Sources:           sources,
+		}, flightService, zapLogger)
+		if err := telemetryListener.Listen(); err != nil {
+			zapLogger.Fatal("Failed to listen for MAVLink telemetry", zap.Error(err))
+		}
+		telemetryCtx, stopTelemetry := context.WithCancel(context.Background())
+		defer stopTelemetry()
+		go func() {
+			if err := telemetryListener.Serve(telemetryCtx); err != nil {
+				zapLogger.Error("MAVLink telemetry listener stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	// Setup Gin
 	gin.SetMode(cfg.Server.Mode)
 	r := gin.New()
@@ -319,6 +488,15 @@ func initDatabase(cfg *config.Config) (*gorm.DB, error) {
 	return db, nil
 }
 
+// randomSecret 生成进程内使用的随机签名密钥
+func randomSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
 func autoMigrate(db *gorm.DB) {
 	db.AutoMigrate(
 		&model.User{},
@@ -393,10 +571,28 @@ func autoMigrate(db *gorm.DB) {
 		&model.UserWallet{},
 		&model.WalletTransaction{},
 		&model.WithdrawalRecord{},
+		&model.PayoutBatch{},
 		&model.PricingConfig{},
+		&model.LedgerAccount{},
+		&model.LedgerEntry{},
+		&model.LedgerPosting{},
 		// 信用评价与风控相关表
 		&model.CreditScore{},
 		&model.CreditScoreLog{},
+		&model.CreditEvent{},
+		&model.RefundPolicy{},
+		&model.DisputeEvidence{},
+		&model.CouponTemplate{},
+		&model.UserCoupon{},
+		&model.SurgeMultiplier{},
+		&model.SurgeMultiplierLog{},
+		&model.CredentialExpiryNotice{},
+		&model.DroneUsageCounter{},
+		&model.MaintenanceSchedule{},
+		&model.DroneComponentBaseline{},
+		&model.MaintenanceWorkOrder{},
+		&model.BatteryPack{},
+		&model.BatteryFlightLog{},
 		&model.RiskControl{},
 		&model.Violation{},
 		&model.Blacklist{},
@@ -414,6 +610,8 @@ func autoMigrate(db *gorm.DB) {
 		&model.HeatmapData{},
 		&model.RealtimeDashboard{},
 		&model.OrderContract{},
+		// 定时任务执行记录
+		&model.JobRun{},
 	)
 }
 
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	paymentpkg "wurenji-backend/internal/pkg/payment"
+)
+
+// buildPaymentProviders 按配置为每种支付方式选择渠道实现，未返回的支付方式不开放
+func buildPaymentProviders(cfg config.PaymentConfig, logger *zap.Logger) map[string]paymentpkg.PaymentProvider {
+	providers := make(map[string]paymentpkg.PaymentProvider)
+	mock := paymentpkg.NewMockPayment(logger)
+	if cfg.MockEnabled {
+		providers["mock"] = mock
+	}
+
+	switch cfg.WeChat.Provider {
+	case config.PaymentProviderAPI:
+		providers["wechat"] = newWeChatProvider(cfg, logger)
+	case config.PaymentProviderMock:
+		providers["wechat"] = mock
+	}
+
+	switch cfg.Alipay.Provider {
+	case config.PaymentProviderAPI:
+		providers["alipay"] = newAlipayProvider(cfg, logger)
+	case config.PaymentProviderMock:
+		providers["alipay"] = mock
+	}
+
+	for method := range providers {
+		logger.Info("Payment method enabled", zap.String("method", method))
+	}
+	return providers
+}
+
+// buildPayoutProviders 按配置为每种提现方式选择出款渠道，未返回的提现方式不开放
+func buildPayoutProviders(cfg config.PaymentConfig, logger *zap.Logger) map[string]paymentpkg.PayoutProvider {
+	providers := make(map[string]paymentpkg.PayoutProvider)
+	mock := paymentpkg.NewMockPayout(logger)
+
+	switch cfg.Payout.WeChat {
+	case config.PaymentProviderAPI:
+		providers["wechat"] = newWeChatProvider(cfg, logger)
+	case config.PaymentProviderMock:
+		providers["wechat"] = mock
+	}
+
+	switch cfg.Payout.Alipay {
+	case config.PaymentProviderAPI:
+		providers["alipay"] = newAlipayProvider(cfg, logger)
+	case config.PaymentProviderMock:
+		providers["alipay"] = mock
+	}
+
+	switch cfg.Payout.Bank {
+	case config.PayoutProviderBatch:
+		providers["bank_card"] = paymentpkg.NewBankBatchPayout(paymentpkg.BankBatchConfig{
+			PayerAccountNo:   cfg.Payout.PayerAccountNo,
+			PayerAccountName: cfg.Payout.PayerAccountName,
+			PayerBankName:    cfg.Payout.PayerBankName,
+		}, logger)
+	case config.PaymentProviderMock:
+		providers["bank_card"] = mock
+	}
+
+	for method := range providers {
+		logger.Info("Payout method enabled", zap.String("method", method))
+	}
+	return providers
+}
+
+func newWeChatProvider(cfg config.PaymentConfig, logger *zap.Logger) *paymentpkg.WeChatPayment {
+	return paymentpkg.NewWeChatPayment(paymentpkg.WeChatPayConfig{
+		AppID:      cfg.WeChat.AppID,
+		MchID:      cfg.WeChat.MchID,
+		APIKey:     cfg.WeChat.APIKey,
+		NotifyURL:  cfg.WeChat.NotifyURL,
+		GatewayURL: cfg.WeChat.GatewayURL,
+		CertPath:   cfg.WeChat.CertPath,
+		KeyPath:    cfg.WeChat.KeyPath,
+	}, logger)
+}
+
+func newAlipayProvider(cfg config.PaymentConfig, logger *zap.Logger) *paymentpkg.AlipayPayment {
+	return paymentpkg.NewAlipayPayment(paymentpkg.AlipayConfig{
+		AppID:      cfg.Alipay.AppID,
+		PrivateKey: cfg.Alipay.PrivateKey,
+		PublicKey:  cfg.Alipay.PublicKey,
+		Sandbox:    cfg.Alipay.Sandbox,
+		NotifyURL:  cfg.Alipay.NotifyURL,
+		GatewayURL: cfg.Alipay.GatewayURL,
+	}, logger)
+}
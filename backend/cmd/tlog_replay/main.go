@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"wurenji-backend/internal/pkg/mavlink"
+)
+
+// tlog_replay 按原始时间间隔将 .tlog 中的 MAVLink 帧通过 UDP 回放到遥测监听端口
+// 用于在无真机的情况下联调飞行监控，例如:
+//
+//	go run ./cmd/tlog_replay -file flight.tlog -addr 127.0.0.1:14550 -speed 2 -sysid 7
+func main() {
+	file := flag.String("file", "", ".tlog 文件路径")
+	addr := flag.String("addr", "127.0.0.1:14550", "遥测监听地址")
+	speed := flag.Float64("speed", 1, "回放倍速，0 表示不等待")
+	loop := flag.Bool("loop", false, "循环回放")
+	sysID := flag.Int("sysid", 0, "改写帧的系统ID(1~255)，用于映射到测试无人机，0 表示保持原值")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *sysID < 0 || *sysID > 255 {
+		log.Fatalf("无效的系统ID: %d", *sysID)
+	}
+
+	conn, err := net.Dial("udp", *addr)
+	if err != nil {
+		log.Fatalf("连接 %s 失败: %v", *addr, err)
+	}
+	defer conn.Close()
+
+	for round := 1; ; round++ {
+		sent, err := replay(conn, *file, *speed, uint8(*sysID))
+		if err != nil {
+			log.Fatalf("回放失败: %v", err)
+		}
+		fmt.Printf("第 %d 轮回放完成，共发送 %d 帧\n", round, sent)
+		if !*loop {
+			return
+		}
+	}
+}
+
+func replay(conn net.Conn, path string, speed float64, sysID uint8) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := mavlink.NewTlogReader(f)
+	var firstLog time.Time
+	started := time.Now()
+	sent := 0
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return sent, nil
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		if firstLog.IsZero() {
+			firstLog = record.Timestamp
+		}
+		if speed > 0 {
+			due := started.Add(time.Duration(float64(record.Timestamp.Sub(firstLog)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		raw := record.Raw
+		if sysID != 0 && record.Frame.SystemID != sysID {
+			record.Frame.SystemID = sysID
+			if raw, err = record.Frame.Marshal(); err != nil {
+				return sent, err
+			}
+		}
+		if _, err := conn.Write(raw); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+}
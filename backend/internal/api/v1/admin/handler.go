@@ -1,12 +1,16 @@
 package admin
 
 import (
+	"errors"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"wurenji-backend/internal/model"
 	"wurenji-backend/internal/pkg/response"
+	"wurenji-backend/internal/repository"
+	"wurenji-backend/internal/scheduler"
 	"wurenji-backend/internal/service"
 )
 
@@ -21,6 +25,14 @@ type Handler struct {
 	ownerService    *service.OwnerService
 	dispatchService *service.DispatchService
 	flightService   *service.FlightService
+	scheduler       *scheduler.Scheduler
+	jobRunRepo      *repository.JobRunRepo
+	refundPolicy    *service.RefundPolicyService
+	disputeService  *service.DisputeService
+	couponService   *service.CouponService
+	surgeService    *service.SurgeService
+	expiryService   *service.CredentialExpiryService
+	maintenance     *service.MaintenancePlannerService
 }
 
 func NewHandler(
@@ -49,6 +61,35 @@ func NewHandler(
 	}
 }
 
+func (h *Handler) SetScheduler(s *scheduler.Scheduler, jobRunRepo *repository.JobRunRepo) {
+	h.scheduler = s
+	h.jobRunRepo = jobRunRepo
+}
+
+func (h *Handler) SetRefundPolicyService(refundPolicy *service.RefundPolicyService) {
+	h.refundPolicy = refundPolicy
+}
+
+func (h *Handler) SetDisputeService(disputeService *service.DisputeService) {
+	h.disputeService = disputeService
+}
+
+func (h *Handler) SetCouponService(couponService *service.CouponService) {
+	h.couponService = couponService
+}
+
+func (h *Handler) SetSurgeService(surgeService *service.SurgeService) {
+	h.surgeService = surgeService
+}
+
+func (h *Handler) SetCredentialExpiryService(expiryService *service.CredentialExpiryService) {
+	h.expiryService = expiryService
+}
+
+func (h *Handler) SetMaintenancePlanner(planner *service.MaintenancePlannerService) {
+	h.maintenance = planner
+}
+
 func (h *Handler) Dashboard(c *gin.Context) {
 	stats, _ := h.orderService.GetStatistics()
 	_, userTotal, _ := h.userService.ListUsers(1, 1, nil)
@@ -401,6 +442,372 @@ func (h *Handler) HandleExpiredPilotBindings(c *gin.Context) {
 	response.Success(c, gin.H{"processed": processed})
 }
 
+// ==================== 定时任务 ====================
+
+func (h *Handler) JobList(c *gin.Context) {
+	if h.scheduler == nil {
+		response.Success(c, []scheduler.JobInfo{})
+		return
+	}
+	response.Success(c, h.scheduler.Jobs())
+}
+
+func (h *Handler) JobRunList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if h.jobRunRepo == nil {
+		response.SuccessWithPage(c, []model.JobRun{}, 0, page, pageSize)
+		return
+	}
+	filters := map[string]interface{}{}
+	if jobName := c.Query("job_name"); jobName != "" {
+		filters["job_name"] = jobName
+	}
+	if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
+	if triggerType := c.Query("trigger_type"); triggerType != "" {
+		filters["trigger_type"] = triggerType
+	}
+	runs, total, err := h.jobRunRepo.ListRuns(page, pageSize, filters)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, runs, total, page, pageSize)
+}
+
+func (h *Handler) TriggerJob(c *gin.Context) {
+	if h.scheduler == nil {
+		response.Error(c, response.CodeServerError, "定时任务未启用")
+		return
+	}
+	run, err := h.scheduler.RunNow(c.Request.Context(), c.Param("name"), c.GetInt64("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrJobNotFound):
+			response.Error(c, response.CodeNotFound, err.Error())
+		case errors.Is(err, scheduler.ErrJobRunning):
+			response.Error(c, response.CodeAlreadyExists, err.Error())
+		default:
+			response.Error(c, response.CodeServerError, err.Error())
+		}
+		return
+	}
+	response.Success(c, run)
+}
+
+// ==================== 退款政策 ====================
+
+func (h *Handler) RefundPolicyList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if h.refundPolicy == nil {
+		response.SuccessWithPage(c, []model.RefundPolicy{}, 0, page, pageSize)
+		return
+	}
+	policies, total, err := h.refundPolicy.ListPolicies(c.Query("policy_code"), c.Query("status"), page, pageSize)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, policies, total, page, pageSize)
+}
+
+func (h *Handler) CreateRefundPolicy(c *gin.Context) {
+	if h.refundPolicy == nil {
+		response.Error(c, response.CodeServerError, "退款政策服务未启用")
+		return
+	}
+	var req service.RefundPolicyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	policy, err := h.refundPolicy.CreatePolicyVersion(&req, c.GetInt64("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, policy)
+}
+
+func (h *Handler) ActivateRefundPolicy(c *gin.Context) {
+	if h.refundPolicy == nil {
+		response.Error(c, response.CodeServerError, "退款政策服务未启用")
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	policy, err := h.refundPolicy.ActivatePolicy(id)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, policy)
+}
+
+// ==================== 优惠券 ====================
+
+func (h *Handler) CouponTemplateList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if h.couponService == nil {
+		response.SuccessWithPage(c, []model.CouponTemplate{}, 0, page, pageSize)
+		return
+	}
+	templates, total, err := h.couponService.ListTemplates(c.Query("status"), c.Query("issue_trigger"), page, pageSize)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, templates, total, page, pageSize)
+}
+
+func (h *Handler) CreateCouponTemplate(c *gin.Context) {
+	if h.couponService == nil {
+		response.Error(c, response.CodeServerError, "优惠券服务未启用")
+		return
+	}
+	var req service.CouponTemplateInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	template, err := h.couponService.CreateTemplate(&req, c.GetInt64("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, template)
+}
+
+func (h *Handler) UpdateCouponTemplateStatus(c *gin.Context) {
+	if h.couponService == nil {
+		response.Error(c, response.CodeServerError, "优惠券服务未启用")
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	template, err := h.couponService.UpdateTemplateStatus(id, req.Status)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, template)
+}
+
+func (h *Handler) IssueCoupons(c *gin.Context) {
+	if h.couponService == nil {
+		response.Error(c, response.CodeServerError, "优惠券服务未启用")
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req struct {
+		UserIDs []int64 `json:"user_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	result, err := h.couponService.IssueBatch(id, req.UserIDs, c.GetInt64("user_id"))
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, result)
+}
+
+// ==================== 动态溢价 ====================
+
+func (h *Handler) SurgeMultiplierList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if h.surgeService == nil {
+		response.SuccessWithPage(c, []model.SurgeMultiplier{}, 0, page, pageSize)
+		return
+	}
+	multipliers, total, err := h.surgeService.ListMultipliers(c.Query("scope_type"), c.Query("city"), page, pageSize)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, multipliers, total, page, pageSize)
+}
+
+func (h *Handler) SurgeMultiplierLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if h.surgeService == nil {
+		response.SuccessWithPage(c, []model.SurgeMultiplierLog{}, 0, page, pageSize)
+		return
+	}
+	logs, total, err := h.surgeService.ListLogs(c.Query("scope_type"), c.Query("scope_key"), page, pageSize)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, logs, total, page, pageSize)
+}
+
+// SetSurgeOverride 人工设定区域倍率，multiplier 为 0 时恢复自动计算
+func (h *Handler) SetSurgeOverride(c *gin.Context) {
+	if h.surgeService == nil {
+		response.Error(c, response.CodeServerError, "动态溢价未启用")
+		return
+	}
+	var req struct {
+		ScopeType  string     `json:"scope_type" binding:"required"`
+		ScopeKey   string     `json:"scope_key" binding:"required"`
+		Multiplier float64    `json:"multiplier"`
+		Until      *time.Time `json:"until"`
+		Reason     string     `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	record, err := h.surgeService.SetManualMultiplier(req.ScopeType, req.ScopeKey, req.Multiplier, req.Until, c.GetInt64("user_id"), req.Reason)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, record)
+}
+
+// ==================== 证照到期 ====================
+
+// CredentialExpiryReport 飞手与无人机证照到期报表，days 为向后查看的天数(默认30)
+func (h *Handler) CredentialExpiryReport(c *gin.Context) {
+	if h.expiryService == nil {
+		response.Error(c, response.CodeServerError, "证照到期监控未启用")
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	report, err := h.expiryService.Report(time.Now(), days, c.Query("subject_type"))
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.Success(c, report)
+}
+
+// ==================== 维护工单 ====================
+
+// MaintenanceWorkOrderList 维护工单列表，支持 drone_id、owner_id、status 筛选
+func (h *Handler) MaintenanceWorkOrderList(c *gin.Context) {
+	if h.maintenance == nil {
+		response.Error(c, response.CodeServerError, "维护计划未启用")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	filters := map[string]interface{}{}
+	for _, key := range []string{"drone_id", "owner_id"} {
+		if id, err := strconv.ParseInt(c.Query(key), 10, 64); err == nil && id > 0 {
+			filters[key] = id
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
+	orders, total, err := h.maintenance.ListWorkOrders(page, pageSize, filters)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, orders, total, page, pageSize)
+}
+
+// ==================== 订单纠纷 ====================
+
+func (h *Handler) DisputeList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if h.disputeService == nil {
+		response.SuccessWithPage(c, []model.DisputeRecord{}, 0, page, pageSize)
+		return
+	}
+	filters := map[string]interface{}{}
+	if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
+	if orderID, _ := strconv.ParseInt(c.Query("order_id"), 10, 64); orderID > 0 {
+		filters["order_id"] = orderID
+	}
+	if arbitratorID, _ := strconv.ParseInt(c.Query("arbitrator_id"), 10, 64); arbitratorID > 0 {
+		filters["arbitrator_id"] = arbitratorID
+	}
+	if c.Query("sla_breached") == "true" {
+		filters["sla_breached"] = true
+	}
+	disputes, total, err := h.disputeService.AdminListDisputes(page, pageSize, filters)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, disputes, total, page, pageSize)
+}
+
+func (h *Handler) GetDisputeDetail(c *gin.Context) {
+	if h.disputeService == nil {
+		response.Error(c, response.CodeServerError, "纠纷服务未启用")
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	detail, err := h.disputeService.AdminGetDispute(id)
+	if err != nil {
+		response.Error(c, response.CodeNotFound, err.Error())
+		return
+	}
+	response.Success(c, detail)
+}
+
+func (h *Handler) AssignDispute(c *gin.Context) {
+	if h.disputeService == nil {
+		response.Error(c, response.CodeServerError, "纠纷服务未启用")
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req struct {
+		ArbitratorID int64 `json:"arbitrator_id"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.ArbitratorID <= 0 {
+		req.ArbitratorID = c.GetInt64("user_id")
+	}
+	dispute, err := h.disputeService.AssignArbitrator(id, req.ArbitratorID)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, dispute)
+}
+
+func (h *Handler) ResolveDispute(c *gin.Context) {
+	if h.disputeService == nil {
+		response.Error(c, response.CodeServerError, "纠纷服务未启用")
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req service.DisputeResolutionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+	dispute, err := h.disputeService.ResolveDispute(id, c.GetInt64("user_id"), &req)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	response.Success(c, dispute)
+}
+
 // ==================== 飞手管理 ====================
 
 func (h *Handler) PilotList(c *gin.Context) {
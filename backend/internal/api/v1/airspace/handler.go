@@ -1,11 +1,13 @@
 package airspace
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/uom"
 	"wurenji-backend/internal/service"
 )
 
@@ -170,6 +172,44 @@ func (h *Handler) SubmitToUOM(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "已提交UOM平台"})
 }
 
+// UOMCallback UOM平台审批结果回调（无需登录，依赖签名校验）
+func (h *Handler) UOMCallback(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "读取请求失败"})
+		return
+	}
+
+	err = h.airspaceService.HandleUOMCallback(body, c.GetHeader(uom.HeaderTimestamp), c.GetHeader(uom.HeaderSignature))
+	if err != nil {
+		if service.IsUOMSignatureError(err) {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
+
+// SyncUOMStatus 主动同步UOM申请状态
+func (h *Handler) SyncUOMStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return
+	}
+
+	app, err := h.airspaceService.SyncUOMStatus(id, getUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": app})
+}
+
 // ReviewApplication 管理员审核空域申请
 func (h *Handler) ReviewApplication(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -291,6 +331,29 @@ func (h *Handler) CheckAirspaceAvailability(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": result})
 }
 
+// CheckRouteConflicts 航线空域冲突检查
+// 支持折线坐标、订单ID或保存路线ID，返回穿越的禁飞区/围栏及绕飞建议
+func (h *Handler) CheckRouteConflicts(c *gin.Context) {
+	var req service.RouteCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+	if len(req.Points) == 0 && req.OrderID == 0 && req.RouteID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供航线坐标、订单ID或路线ID"})
+		return
+	}
+
+	req.UserID = getUserID(c)
+	result, err := h.airspaceService.CheckRouteConflicts(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
 // CreateNoFlyZone 创建禁飞区（管理员）
 func (h *Handler) CreateNoFlyZone(c *gin.Context) {
 	var zone model.NoFlyZone
@@ -298,6 +361,10 @@ func (h *Handler) CreateNoFlyZone(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
 		return
 	}
+	if err := service.ValidateNoFlyZoneGeometry(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := h.airspaceService.CreateNoFlyZone(&zone); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
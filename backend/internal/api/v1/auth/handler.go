@@ -36,10 +36,11 @@ func (h *Handler) SendCode(c *gin.Context) {
 }
 
 type RegisterReq struct {
-	Phone    string `json:"phone" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
-	Nickname string `json:"nickname"`
-	Code     string `json:"code" binding:"required"`
+	Phone      string `json:"phone" binding:"required"`
+	Password   string `json:"password" binding:"required,min=6"`
+	Nickname   string `json:"nickname"`
+	Code       string `json:"code" binding:"required"`
+	ReferrerID int64  `json:"referrer_id"`
 }
 
 func (h *Handler) Register(c *gin.Context) {
@@ -55,7 +56,7 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	user, tokens, err := h.authService.Register(req.Phone, req.Password, req.Nickname)
+	user, tokens, err := h.authService.Register(req.Phone, req.Password, req.Nickname, req.ReferrerID)
 	if err != nil {
 		response.Error(c, response.CodeAlreadyExists, err.Error())
 		return
@@ -0,0 +1,120 @@
+package battery
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wurenji-backend/internal/api/middleware"
+	"wurenji-backend/internal/pkg/response"
+	"wurenji-backend/internal/service"
+)
+
+type Handler struct {
+	batteryService *service.BatteryService
+}
+
+func NewHandler(batteryService *service.BatteryService) *Handler {
+	return &Handler{batteryService: batteryService}
+}
+
+// Register 登记电池包
+func (h *Handler) Register(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	var req service.RegisterBatteryReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	pack, err := h.batteryService.RegisterPack(userID, &req)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.Success(c, pack)
+}
+
+// List 我的电池包，支持 drone_id、status 筛选
+func (h *Handler) List(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	droneID, _ := strconv.ParseInt(c.Query("drone_id"), 10, 64)
+
+	packs, total, err := h.batteryService.ListOwnerPacks(userID, droneID, c.Query("status"), page, pageSize)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, packs, total, page, pageSize)
+}
+
+// GetDetail 电池包详情与最近使用记录
+func (h *Handler) GetDetail(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	detail, err := h.batteryService.GetPackDetail(userID, id)
+	if err != nil {
+		response.Error(c, response.CodeNotFound, err.Error())
+		return
+	}
+	response.Success(c, detail)
+}
+
+// AssignDrone 绑定或解绑无人机，drone_id 为 0 时解绑
+func (h *Handler) AssignDrone(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req struct {
+		DroneID int64 `json:"drone_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.batteryService.AssignDrone(userID, id, req.DroneID); err != nil {
+		response.Error(c, response.CodeForbidden, err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Retire 手动退役电池包
+func (h *Handler) Retire(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	if err := h.batteryService.RetirePack(userID, id, req.Reason); err != nil {
+		response.Error(c, response.CodeForbidden, err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// PreflightCheck 电池飞前检查，登记本次飞行使用的电池包，未通过时返回逐块原因
+func (h *Handler) PreflightCheck(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	var req service.BatteryPreflightReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.batteryService.PreflightCheck(userID, &req)
+	if err != nil {
+		response.Error(c, response.CodeForbidden, err.Error())
+		return
+	}
+	if !result.Passed {
+		response.ErrorWithData(c, response.CodeForbidden, "电池飞前检查未通过", result)
+		return
+	}
+	response.Success(c, result)
+}
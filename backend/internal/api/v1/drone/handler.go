@@ -2,6 +2,7 @@ package drone
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -15,12 +16,17 @@ import (
 type Handler struct {
 	droneService  *service.DroneService
 	uploadService *upload.UploadService
+	maintenance   *service.MaintenancePlannerService
 }
 
 func NewHandler(droneService *service.DroneService, uploadService *upload.UploadService) *Handler {
 	return &Handler{droneService: droneService, uploadService: uploadService}
 }
 
+func (h *Handler) SetMaintenancePlanner(planner *service.MaintenancePlannerService) {
+	h.maintenance = planner
+}
+
 func (h *Handler) Create(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	var drone model.Drone
@@ -265,6 +271,41 @@ func (h *Handler) GetMaintenanceLogs(c *gin.Context) {
 	response.SuccessWithPage(c, logs, total, page, pageSize)
 }
 
+// MaintenanceForecast 无人机各部件的维护预测
+func (h *Handler) MaintenanceForecast(c *gin.Context) {
+	if h.maintenance == nil {
+		response.Error(c, response.CodeServerError, "维护计划未启用")
+		return
+	}
+	userID := middleware.GetUserID(c)
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	forecast, err := h.maintenance.Forecast(userID, id, time.Now())
+	if err != nil {
+		response.Error(c, response.CodeForbidden, err.Error())
+		return
+	}
+	response.Success(c, forecast)
+}
+
+// MaintenanceWorkOrders 机主的维护工单
+func (h *Handler) MaintenanceWorkOrders(c *gin.Context) {
+	if h.maintenance == nil {
+		response.Error(c, response.CodeServerError, "维护计划未启用")
+		return
+	}
+	userID := middleware.GetUserID(c)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	orders, total, err := h.maintenance.ListOwnerWorkOrders(userID, c.Query("status"), page, pageSize)
+	if err != nil {
+		response.Error(c, response.CodeDBError, err.Error())
+		return
+	}
+	response.SuccessWithPage(c, orders, total, page, pageSize)
+}
+
 // ==================== 认证状态 ====================
 
 // GetCertificationStatus 获取无人机综合认证状态
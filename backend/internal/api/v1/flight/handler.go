@@ -1,6 +1,7 @@
 package flight
 
 import (
+	"errors"
 	"math"
 	"math/rand"
 	"strconv"
@@ -276,20 +277,20 @@ func (h *Handler) GetGeofence(c *gin.Context) {
 
 // CreateGeofenceRequest 创建围栏请求
 type CreateGeofenceRequest struct {
-	Name            string                   `json:"name" binding:"required"`
-	FenceType       string                   `json:"fence_type" binding:"required"`
-	GeometryType    string                   `json:"geometry_type" binding:"required"`
-	CenterLatitude  *float64                 `json:"center_latitude"`
-	CenterLongitude *float64                 `json:"center_longitude"`
-	Radius          *int                     `json:"radius"`
-	Coordinates     []map[string]interface{} `json:"coordinates"`
-	MinAltitude     int                      `json:"min_altitude"`
-	MaxAltitude     int                      `json:"max_altitude"`
-	EffectiveFrom   *time.Time               `json:"effective_from"`
-	EffectiveTo     *time.Time               `json:"effective_to"`
-	ViolationAction string                   `json:"violation_action"`
-	AlertDistance   int                      `json:"alert_distance"`
-	Description     string                   `json:"description"`
+	Name            string     `json:"name" binding:"required"`
+	FenceType       string     `json:"fence_type" binding:"required"`
+	GeometryType    string     `json:"geometry_type" binding:"required"`
+	CenterLatitude  *float64   `json:"center_latitude"`
+	CenterLongitude *float64   `json:"center_longitude"`
+	Radius          *int       `json:"radius"`
+	Coordinates     model.JSON `json:"coordinates"` // 多边形顶点，支持 [{lat,lng}]、[[lng,lat]] 及带空洞的多环格式
+	MinAltitude     int        `json:"min_altitude"`
+	MaxAltitude     int        `json:"max_altitude"`
+	EffectiveFrom   *time.Time `json:"effective_from"`
+	EffectiveTo     *time.Time `json:"effective_to"`
+	ViolationAction string     `json:"violation_action"`
+	AlertDistance   int        `json:"alert_distance"`
+	Description     string     `json:"description"`
 }
 
 // CreateGeofence 创建围栏
@@ -314,6 +315,7 @@ func (h *Handler) CreateGeofence(c *gin.Context) {
 		CenterLatitude:  req.CenterLatitude,
 		CenterLongitude: req.CenterLongitude,
 		Radius:          req.Radius,
+		Coordinates:     req.Coordinates,
 		MinAltitude:     req.MinAltitude,
 		MaxAltitude:     req.MaxAltitude,
 		EffectiveFrom:   req.EffectiveFrom,
@@ -323,6 +325,10 @@ func (h *Handler) CreateGeofence(c *gin.Context) {
 		Description:     req.Description,
 		Status:          "active",
 	}
+	if err := service.ValidateGeofenceGeometry(fence); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
 
 	if err := h.flightService.CreateGeofence(fence); err != nil {
 		response.ServerError(c, err.Error())
@@ -712,13 +718,47 @@ func (h *Handler) CreateMultiPointTask(c *gin.Context) {
 
 	task, err := h.flightService.CreateMultiPointTask(&req)
 	if err != nil {
-		response.ServerError(c, err.Error())
+		respondRoutePlanError(c, err)
 		return
 	}
 
 	response.Success(c, task)
 }
 
+// PlanMultiPointTask 多点任务航线规划预览
+// @Summary 多点任务航线规划预览
+// @Tags 飞行监控-多点任务
+// @Accept json
+// @Produce json
+// @Param body body service.CreateMultiPointTaskRequest true "任务信息"
+// @Success 200 {object} service.RoutePlan
+// @Router /api/v1/flight/multipoint-task/plan [post]
+func (h *Handler) PlanMultiPointTask(c *gin.Context) {
+	var req service.CreateMultiPointTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	plan, err := h.flightService.PlanMultiPointTask(&req)
+	if err != nil {
+		respondRoutePlanError(c, err)
+		return
+	}
+
+	response.Success(c, plan)
+}
+
+// respondRoutePlanError 航线不可行时返回逐项原因
+func respondRoutePlanError(c *gin.Context, err error) {
+	var planErr *service.RoutePlanError
+	if errors.As(err, &planErr) {
+		response.ErrorWithData(c, response.CodeParamError, err.Error(), planErr)
+		return
+	}
+	response.ServerError(c, err.Error())
+}
+
 // GetMultiPointTask 获取多点任务详情
 // @Summary 获取多点任务详情
 // @Tags 飞行监控-多点任务
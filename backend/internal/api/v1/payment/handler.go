@@ -1,11 +1,14 @@
 package payment
 
 import (
+	"io"
+	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"wurenji-backend/internal/api/middleware"
+	paymentpkg "wurenji-backend/internal/pkg/payment"
 	"wurenji-backend/internal/pkg/response"
 	"wurenji-backend/internal/service"
 )
@@ -56,32 +59,30 @@ func (h *Handler) MockCallback(c *gin.Context) {
 	response.Success(c, nil)
 }
 
+// WechatNotify 微信支付结果通知（无需登录，依赖签名校验）
 func (h *Handler) WechatNotify(c *gin.Context) {
-	// In production, parse WeChat callback XML/JSON and verify signature
-	var req struct {
-		PaymentNo    string `json:"payment_no"`
-		ThirdPartyNo string `json:"third_party_no"`
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err == nil {
+		err = h.paymentService.HandleProviderNotify("wechat", body)
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.String(200, "FAIL")
-		return
+	reply := map[string]string{"return_code": "SUCCESS", "return_msg": "OK"}
+	if err != nil {
+		reply = map[string]string{"return_code": "FAIL", "return_msg": err.Error()}
 	}
-	h.paymentService.HandlePaymentCallback(req.PaymentNo, req.ThirdPartyNo)
-	c.String(200, "SUCCESS")
+	c.Data(http.StatusOK, "application/xml", paymentpkg.EncodeWeChatXML(reply))
 }
 
+// AlipayNotify 支付宝异步通知（无需登录，依赖签名校验），返回 success 之外的内容支付宝会重试
 func (h *Handler) AlipayNotify(c *gin.Context) {
-	// In production, parse Alipay callback and verify signature
-	var req struct {
-		PaymentNo    string `json:"payment_no"`
-		ThirdPartyNo string `json:"third_party_no"`
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err == nil {
+		err = h.paymentService.HandleProviderNotify("alipay", body)
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.String(200, "fail")
+	if err != nil {
+		c.String(http.StatusOK, "failure")
 		return
 	}
-	h.paymentService.HandlePaymentCallback(req.PaymentNo, req.ThirdPartyNo)
-	c.String(200, "success")
+	c.String(http.StatusOK, "success")
 }
 
 func (h *Handler) GetStatus(c *gin.Context) {
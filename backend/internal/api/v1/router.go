@@ -9,6 +9,7 @@ import (
 	"wurenji-backend/internal/api/v1/airspace"
 	"wurenji-backend/internal/api/v1/analytics"
 	"wurenji-backend/internal/api/v1/auth"
+	"wurenji-backend/internal/api/v1/battery"
 	"wurenji-backend/internal/api/v1/client"
 	"wurenji-backend/internal/api/v1/credit"
 	"wurenji-backend/internal/api/v1/demand"
@@ -53,6 +54,7 @@ type Handlers struct {
 	Credit     *credit.Handler
 	Insurance  *insurance.Handler
 	Analytics  *analytics.Handler
+	Battery    *battery.Handler
 }
 
 func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config, logger *zap.Logger) {
@@ -98,7 +100,12 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 	// Payment callbacks (no auth required)
 	api.POST("/payment/wechat/notify", h.Payment.WechatNotify)
 	api.POST("/payment/alipay/notify", h.Payment.AlipayNotify)
-	api.POST("/payment/mock/callback", h.Payment.MockCallback)
+	if cfg.Payment.MockEnabled {
+		api.POST("/payment/mock/callback", h.Payment.MockCallback)
+	}
+
+	// UOM airspace callback (signature verified, no auth required)
+	api.POST("/airspace/uom/callback", h.Airspace.UOMCallback)
 
 	// Authenticated routes
 	authenticated := api.Group("")
@@ -125,7 +132,8 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 			droneGroup.POST("", h.Drone.Create)
 			droneGroup.GET("/my", h.Drone.MyDrones)
 			droneGroup.GET("/nearby", h.Drone.Nearby)
-			droneGroup.POST("/upload", h.Drone.UploadImages) // 通用图片上传，无需 drone ID
+			droneGroup.GET("/maintenance-work-orders", h.Drone.MaintenanceWorkOrders) // 我的维护工单
+			droneGroup.POST("/upload", h.Drone.UploadImages)                          // 通用图片上传，无需 drone ID
 			droneGroup.GET("/:id", h.Drone.GetByID)
 			droneGroup.PUT("/:id", h.Drone.Update)
 			droneGroup.DELETE("/:id", h.Drone.Delete)
@@ -133,12 +141,13 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 			droneGroup.POST("/:id/certification", h.Drone.SubmitCertification)
 			droneGroup.PUT("/:id/availability", h.Drone.UpdateAvailability)
 			// 机主认证增强接口
-			droneGroup.POST("/:id/uom", h.Drone.SubmitUOMRegistration)         // UOM平台登记
-			droneGroup.POST("/:id/insurance", h.Drone.SubmitInsurance)         // 保险信息
-			droneGroup.POST("/:id/airworthiness", h.Drone.SubmitAirworthiness) // 适航证书
-			droneGroup.POST("/:id/maintenance", h.Drone.AddMaintenanceLog)     // 添加维护记录
-			droneGroup.GET("/:id/maintenance", h.Drone.GetMaintenanceLogs)     // 获取维护记录
-			droneGroup.GET("/:id/cert-status", h.Drone.GetCertificationStatus) // 获取认证状态
+			droneGroup.POST("/:id/uom", h.Drone.SubmitUOMRegistration)               // UOM平台登记
+			droneGroup.POST("/:id/insurance", h.Drone.SubmitInsurance)               // 保险信息
+			droneGroup.POST("/:id/airworthiness", h.Drone.SubmitAirworthiness)       // 适航证书
+			droneGroup.POST("/:id/maintenance", h.Drone.AddMaintenanceLog)           // 添加维护记录
+			droneGroup.GET("/:id/maintenance", h.Drone.GetMaintenanceLogs)           // 获取维护记录
+			droneGroup.GET("/:id/maintenance-forecast", h.Drone.MaintenanceForecast) // 部件维护预测
+			droneGroup.GET("/:id/cert-status", h.Drone.GetCertificationStatus)       // 获取认证状态
 		}
 
 		// Rental Offers
@@ -431,6 +440,7 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 
 			// 多点任务
 			flightGroup.POST("/multipoint-task", h.Flight.CreateMultiPointTask)                    // 创建多点任务
+			flightGroup.POST("/multipoint-task/plan", h.Flight.PlanMultiPointTask)                 // 航线规划预览
 			flightGroup.GET("/multipoint-task/:id", h.Flight.GetMultiPointTask)                    // 获取多点任务详情
 			flightGroup.GET("/multipoint-task/order/:order_id", h.Flight.GetMultiPointTaskByOrder) // 根据订单获取
 			flightGroup.POST("/multipoint-task/:id/start", h.Flight.StartMultiPointTask)           // 开始多点任务
@@ -454,12 +464,14 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 			airspaceGroup.POST("/application/:id/submit", h.Airspace.SubmitForReview)           // 提交审核
 			airspaceGroup.POST("/application/:id/cancel", h.Airspace.CancelApplication)         // 取消申请
 			airspaceGroup.POST("/application/:id/uom", h.Airspace.SubmitToUOM)                  // 提交UOM平台
+			airspaceGroup.POST("/application/:id/uom/sync", h.Airspace.SyncUOMStatus)           // 同步UOM审批状态
 
 			// 禁飞区
 			airspaceGroup.GET("/no-fly-zones", h.Airspace.ListNoFlyZones)                  // 禁飞区列表
 			airspaceGroup.GET("/no-fly-zone/:id", h.Airspace.GetNoFlyZone)                 // 禁飞区详情
 			airspaceGroup.GET("/no-fly-zones/nearby", h.Airspace.FindNearbyNoFlyZones)     // 附近禁飞区
 			airspaceGroup.GET("/check-availability", h.Airspace.CheckAirspaceAvailability) // 空域可用性检查
+			airspaceGroup.POST("/route-check", h.Airspace.CheckRouteConflicts)             // 航线空域冲突检查
 
 			// 合规检查
 			airspaceGroup.POST("/compliance/check", h.Airspace.RunComplianceCheck)       // 执行合规检查
@@ -490,20 +502,18 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 			// 钱包
 			settlementGroup.GET("/wallet", h.Settlement.GetWallet)                          // 获取我的钱包
 			settlementGroup.GET("/wallet/transactions", h.Settlement.GetWalletTransactions) // 获取钱包流水
+			settlementGroup.GET("/wallet/ledger", h.Settlement.GetWalletLedger)             // 获取账本账户余额
 
 			// 提现
 			settlementGroup.POST("/withdrawal", h.Settlement.RequestWithdrawal) // 申请提现
 			settlementGroup.GET("/withdrawals", h.Settlement.ListMyWithdrawals) // 获取我的提现记录
 
 			// 管理员接口
-			settlementGroup.POST("/admin/execute/:id", h.Settlement.ExecuteSettlement)                  // 执行结算
-			settlementGroup.GET("/admin/list", h.Settlement.ListSettlements)                            // 获取所有结算列表
-			settlementGroup.POST("/admin/process-pending", h.Settlement.AdminProcessSettlements)        // 批量处理结算
-			settlementGroup.GET("/admin/withdrawals/pending", h.Settlement.AdminListPendingWithdrawals) // 待审核提现
-			settlementGroup.POST("/admin/withdrawal/:id/approve", h.Settlement.AdminApproveWithdrawal)  // 审批通过提现
-			settlementGroup.POST("/admin/withdrawal/:id/reject", h.Settlement.AdminRejectWithdrawal)    // 拒绝提现
-			settlementGroup.GET("/admin/pricing-configs", h.Settlement.GetPricingConfigs)               // 获取定价配置
-			settlementGroup.PUT("/admin/pricing-config", h.Settlement.UpdatePricingConfig)              // 更新定价配置
+			settlementGroup.POST("/admin/execute/:id", h.Settlement.ExecuteSettlement)           // 执行结算
+			settlementGroup.GET("/admin/list", h.Settlement.ListSettlements)                     // 获取所有结算列表
+			settlementGroup.POST("/admin/process-pending", h.Settlement.AdminProcessSettlements) // 批量处理结算
+			settlementGroup.GET("/admin/pricing-configs", h.Settlement.GetPricingConfigs)        // 获取定价配置
+			settlementGroup.PUT("/admin/pricing-config", h.Settlement.UpdatePricingConfig)       // 更新定价配置
 		}
 
 		// Credit & Risk Control (信用评价与风控)
@@ -575,6 +585,17 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 			insuranceGroup.GET("/admin/statistics", h.Insurance.GetInsuranceStatistics)               // 保险统计
 		}
 
+		// Battery 电池包登记与飞前检查
+		batteryGroup := authenticated.Group("/battery")
+		{
+			batteryGroup.POST("", h.Battery.Register)                       // 登记电池包
+			batteryGroup.GET("", h.Battery.List)                            // 我的电池包
+			batteryGroup.POST("/preflight-check", h.Battery.PreflightCheck) // 电池飞前检查
+			batteryGroup.GET("/:id", h.Battery.GetDetail)                   // 电池包详情与使用记录
+			batteryGroup.PUT("/:id/drone", h.Battery.AssignDrone)           // 绑定或解绑无人机
+			batteryGroup.POST("/:id/retire", h.Battery.Retire)              // 手动退役
+		}
+
 		// Analytics (数据分析与决策支持)
 		analyticsGroup := authenticated.Group("/analytics")
 		{
@@ -647,7 +668,40 @@ func RegisterRoutes(r *gin.Engine, h *Handlers, hub *ws.Hub, cfg *config.Config,
 		adminGroup.GET("/migration-audits", h.Admin.MigrationAuditList)
 		adminGroup.GET("/migration-audits/summary", h.Admin.MigrationAuditSummary)
 		adminGroup.GET("/payments", h.Admin.PaymentList)
+		// 提现审核与代付
+		adminGroup.GET("/withdrawals/pending", h.Settlement.AdminListPendingWithdrawals)
+		adminGroup.POST("/withdrawals/:id/approve", h.Settlement.AdminApproveWithdrawal)
+		adminGroup.POST("/withdrawals/:id/reject", h.Settlement.AdminRejectWithdrawal)
+		adminGroup.GET("/payout-batches", h.Settlement.AdminListPayoutBatches)
+		adminGroup.POST("/payout-batches", h.Settlement.AdminExportPayoutBatch)
+		adminGroup.GET("/payout-batches/:batch_no/file", h.Settlement.AdminDownloadPayoutBatch)
+		adminGroup.POST("/payout-batches/:batch_no/result", h.Settlement.AdminImportPayoutBatchResult)
+		adminGroup.GET("/ledger/reconciliation", h.Settlement.AdminLedgerReconciliation)
+		// 取消退款政策
+		adminGroup.GET("/refund-policies", h.Admin.RefundPolicyList)
+		adminGroup.POST("/refund-policies", h.Admin.CreateRefundPolicy)
+		adminGroup.POST("/refund-policies/:id/activate", h.Admin.ActivateRefundPolicy)
+		// 优惠券
+		adminGroup.GET("/coupon-templates", h.Admin.CouponTemplateList)
+		adminGroup.POST("/coupon-templates", h.Admin.CreateCouponTemplate)
+		adminGroup.PUT("/coupon-templates/:id/status", h.Admin.UpdateCouponTemplateStatus)
+		adminGroup.POST("/coupon-templates/:id/issue", h.Admin.IssueCoupons)
+		// 动态溢价
+		adminGroup.GET("/surge-multipliers", h.Admin.SurgeMultiplierList)
+		adminGroup.GET("/surge-multipliers/logs", h.Admin.SurgeMultiplierLogs)
+		adminGroup.POST("/surge-multipliers/override", h.Admin.SetSurgeOverride)
+		adminGroup.GET("/credential-expiries", h.Admin.CredentialExpiryReport)
+		adminGroup.GET("/maintenance-work-orders", h.Admin.MaintenanceWorkOrderList)
+		// 订单纠纷
+		adminGroup.GET("/disputes", h.Admin.DisputeList)
+		adminGroup.GET("/disputes/:id", h.Admin.GetDisputeDetail)
+		adminGroup.POST("/disputes/:id/assign", h.Admin.AssignDispute)
+		adminGroup.POST("/disputes/:id/resolve", h.Admin.ResolveDispute)
 		adminGroup.POST("/demands/handle-expired", h.Admin.HandleExpiredDemands)
 		adminGroup.POST("/pilot-bindings/handle-expired", h.Admin.HandleExpiredPilotBindings)
+		// 定时任务
+		adminGroup.GET("/jobs", h.Admin.JobList)
+		adminGroup.GET("/jobs/runs", h.Admin.JobRunList)
+		adminGroup.POST("/jobs/:name/run", h.Admin.TriggerJob)
 	}
 }
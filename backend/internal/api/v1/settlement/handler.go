@@ -1,8 +1,11 @@
 package settlement
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"wurenji-backend/internal/service"
@@ -10,10 +13,16 @@ import (
 
 type Handler struct {
 	settlementService *service.SettlementService
+	ledgerService     *service.LedgerService
+	pricingEngine     *service.PricingEngine
 }
 
-func NewHandler(settlementService *service.SettlementService) *Handler {
-	return &Handler{settlementService: settlementService}
+func NewHandler(settlementService *service.SettlementService, ledgerService *service.LedgerService) *Handler {
+	return &Handler{settlementService: settlementService, ledgerService: ledgerService}
+}
+
+func (h *Handler) SetPricingEngine(pricingEngine *service.PricingEngine) {
+	h.pricingEngine = pricingEngine
 }
 
 func getUserID(c *gin.Context) int64 {
@@ -31,37 +40,58 @@ func getUserID(c *gin.Context) int64 {
 
 // ========== 定价相关 ==========
 
-// CalculatePrice 计算订单价格(预估)
+// CalculatePrice 计算订单价格(预估)，传入 supply_id 时按该供给的挂牌价与计价规则报价
 func (h *Handler) CalculatePrice(c *gin.Context) {
 	var req struct {
-		FlightDistance float64 `json:"flight_distance"` // km
-		FlightDuration float64 `json:"flight_duration"` // 分钟
-		CargoWeight    float64 `json:"cargo_weight"`    // kg
-		CargoValue     int64   `json:"cargo_value"`     // 分
-		CargoType      string  `json:"cargo_type"`      // normal, fragile, hazardous
-		TaskType       string  `json:"task_type"`
-		IsNightFlight  bool    `json:"is_night_flight"`
-		IsPeakHour     bool    `json:"is_peak_hour"`
-		IsHoliday      bool    `json:"is_holiday"`
+		FlightDistance float64    `json:"flight_distance"` // km
+		FlightDuration float64    `json:"flight_duration"` // 分钟
+		CargoWeight    float64    `json:"cargo_weight"`    // kg
+		CargoValue     int64      `json:"cargo_value"`     // 分
+		CargoType      string     `json:"cargo_type"`      // normal, fragile, hazardous
+		TaskType       string     `json:"task_type"`
+		CargoScene     string     `json:"cargo_scene"`
+		ScheduledAt    *time.Time `json:"scheduled_at"`
+		ServiceHours   float64    `json:"service_hours"`
+		TripCount      int        `json:"trip_count"`
+		SupplyID       int64      `json:"supply_id"`
+		IsNightFlight  bool       `json:"is_night_flight"`
+		IsPeakHour     bool       `json:"is_peak_hour"`
+		IsHoliday      bool       `json:"is_holiday"`
+		IsHazardous    bool       `json:"is_hazardous"`
+		Latitude       float64    `json:"latitude"` // 作业地点，用于叠加供需动态溢价
+		Longitude      float64    `json:"longitude"`
+		City           string     `json:"city"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "参数错误"})
 		return
 	}
+	if h.pricingEngine == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": "定价引擎未初始化"})
+		return
+	}
 
-	result, err := h.settlementService.CalculatePrice(service.PricingInput{
+	result, err := h.pricingEngine.QuoteForSupply(service.PricingInput{
 		FlightDistance: req.FlightDistance,
 		FlightDuration: req.FlightDuration,
 		CargoWeight:    req.CargoWeight,
 		CargoValue:     req.CargoValue,
 		CargoType:      req.CargoType,
 		TaskType:       req.TaskType,
+		CargoScene:     req.CargoScene,
+		ScheduledAt:    req.ScheduledAt,
+		ServiceHours:   req.ServiceHours,
+		TripCount:      req.TripCount,
 		IsNightFlight:  req.IsNightFlight,
 		IsPeakHour:     req.IsPeakHour,
 		IsHoliday:      req.IsHoliday,
-	})
+		IsHazardous:    req.IsHazardous,
+		Latitude:       req.Latitude,
+		Longitude:      req.Longitude,
+		City:           req.City,
+	}, req.SupplyID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
 
@@ -324,9 +354,88 @@ func (h *Handler) AdminRejectWithdrawal(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "提现已拒绝"})
 }
 
+// AdminExportPayoutBatch 将待出款的银行卡提现生成代付批次并下载批量文件(format=csv|xml)
+func (h *Handler) AdminExportPayoutBatch(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	batch, file, err := h.settlementService.ExportPayoutBatch(getUserID(c), format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	writePayoutBatchFile(c, batch.BatchNo, format, file)
+}
+
+// AdminDownloadPayoutBatch 重新下载代付批次文件
+func (h *Handler) AdminDownloadPayoutBatch(c *gin.Context) {
+	batchNo := c.Param("batch_no")
+	format := c.DefaultQuery("format", "csv")
+	file, err := h.settlementService.GetPayoutBatchFile(batchNo, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	writePayoutBatchFile(c, batchNo, format, file)
+}
+
+// AdminImportPayoutBatchResult 上传银行回单(CSV)，完成或退回批次内的提现
+func (h *Handler) AdminImportPayoutBatchResult(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "请上传回单文件"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, 10<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	batch, err := h.settlementService.ImportPayoutBatchResult(c.Param("batch_no"), data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": batch, "message": "回单已导入"})
+}
+
+// AdminListPayoutBatches 代付批次列表
+func (h *Handler) AdminListPayoutBatches(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	list, total, err := h.settlementService.ListPayoutBatches(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": list, "total": total, "page": page, "page_size": pageSize})
+}
+
+func writePayoutBatchFile(c *gin.Context, batchNo, format string, file []byte) {
+	contentType := "text/csv; charset=utf-8"
+	if format == "xml" {
+		contentType = "application/xml; charset=utf-8"
+	} else {
+		format = "csv"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", batchNo, format))
+	c.Header("X-Payout-Batch-No", batchNo)
+	c.Data(http.StatusOK, contentType, file)
+}
+
 // AdminProcessSettlements 批量处理结算
 func (h *Handler) AdminProcessSettlements(c *gin.Context) {
-	count, err := h.settlementService.ProcessPendingSettlements()
+	count, err := h.settlementService.RunSettlementPipeline(100)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
 		return
@@ -335,6 +444,30 @@ func (h *Handler) AdminProcessSettlements(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "处理完成", "data": gin.H{"processed_count": count}})
 }
 
+// GetWalletLedger 获取我的账本账户余额(可用/冻结/保证金)
+func (h *Handler) GetWalletLedger(c *gin.Context) {
+	userID := getUserID(c)
+
+	balances, err := h.ledgerService.GetUserBalances(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": balances})
+}
+
+// AdminLedgerReconciliation 账本对账报告
+func (h *Handler) AdminLedgerReconciliation(c *gin.Context) {
+	report, err := h.ledgerService.Reconcile()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": report})
+}
+
 // ========== 定价配置 ==========
 
 // GetPricingConfigs 获取定价配置
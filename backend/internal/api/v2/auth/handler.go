@@ -21,9 +21,10 @@ func NewHandler(authService *service.AuthService, userService *service.UserServi
 }
 
 type RegisterRequest struct {
-	Phone    string `json:"phone" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
-	Nickname string `json:"nickname"`
+	Phone      string `json:"phone" binding:"required"`
+	Password   string `json:"password" binding:"required,min=6"`
+	Nickname   string `json:"nickname"`
+	ReferrerID int64  `json:"referrer_id"`
 }
 
 type LoginRequest struct {
@@ -50,7 +51,7 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	user, tokens, err := h.authService.Register(req.Phone, req.Password, req.Nickname)
+	user, tokens, err := h.authService.Register(req.Phone, req.Password, req.Nickname, req.ReferrerID)
 	if err != nil {
 		response.V2Conflict(c, err.Error())
 		return
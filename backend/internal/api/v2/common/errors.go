@@ -2,6 +2,7 @@ package common
 
 import (
 	"errors"
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,11 @@ func HandleServiceError(c *gin.Context, err error) {
 		response.V2NotFound(c, err.Error())
 		return
 	}
+	var gateErr response.GateError
+	if errors.As(err, &gateErr) {
+		response.V2ErrorWithData(c, http.StatusUnprocessableEntity, response.V2CodeOrderGate, gateErr.Error(), gateErr)
+		return
+	}
 
 	message := err.Error()
 	switch {
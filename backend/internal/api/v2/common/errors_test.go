@@ -0,0 +1,67 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"wurenji-backend/internal/pkg/response"
+)
+
+type testGateReason struct {
+	Check string `json:"check"`
+	Code  string `json:"code"`
+}
+
+type testGateError struct {
+	Transition string           `json:"transition"`
+	Reasons    []testGateReason `json:"reasons"`
+}
+
+func (e *testGateError) Error() string { return "订单未通过前置检查" }
+
+func (e *testGateError) GateReasons() []string {
+	codes := make([]string, 0, len(e.Reasons))
+	for _, reason := range e.Reasons {
+		codes = append(codes, reason.Code)
+	}
+	return codes
+}
+
+func TestHandleServiceErrorReturnsOrderGateReasons(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/orders/:order_id/start-flight", func(c *gin.Context) {
+		gateErr := &testGateError{
+			Transition: "start_flight",
+			Reasons:    []testGateReason{{Check: "airspace", Code: "airspace_not_approved"}},
+		}
+		HandleServiceError(c, fmt.Errorf("start flight: %w", gateErr))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/7/start-flight", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", recorder.Code)
+	}
+	var payload struct {
+		Code string        `json:"code"`
+		Data testGateError `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Code != response.V2CodeOrderGate {
+		t.Fatalf("expected code %s, got %s", response.V2CodeOrderGate, payload.Code)
+	}
+	if payload.Data.Transition != "start_flight" || len(payload.Data.Reasons) != 1 || payload.Data.Reasons[0].Code != "airspace_not_approved" {
+		t.Fatalf("unexpected gate payload: %+v", payload.Data)
+	}
+}
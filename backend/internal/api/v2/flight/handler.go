@@ -131,6 +131,81 @@ func (h *Handler) ReportPosition(c *gin.Context) {
 	})
 }
 
+// ReportPositions 批量上报位置，适用于高频采集后按批回传的场景
+func (h *Handler) ReportPositions(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+
+	record, order, ok := h.loadAuthorizedFlightRecord(c, userID, "pilot")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Positions []struct {
+			Latitude       *float64   `json:"latitude" binding:"required"`
+			Longitude      *float64   `json:"longitude" binding:"required"`
+			Altitude       int        `json:"altitude"`
+			Speed          int        `json:"speed"`
+			Heading        int        `json:"heading"`
+			VerticalSpeed  int        `json:"vertical_speed"`
+			BatteryLevel   int        `json:"battery_level"`
+			SignalStrength int        `json:"signal_strength"`
+			GPSSatellites  int        `json:"gps_satellites"`
+			Temperature    *int       `json:"temperature"`
+			WindSpeed      *int       `json:"wind_speed"`
+			WindDirection  *int       `json:"wind_direction"`
+			RecordedAt     *time.Time `json:"recorded_at"`
+		} `json:"positions" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		response.V2ValidationError(c, "invalid flight position batch payload")
+		return
+	}
+	if len(req.Positions) > service.MaxPositionBatchSize {
+		response.V2ValidationError(c, "too many positions in one batch")
+		return
+	}
+
+	reqs := make([]service.ReportPositionRequest, 0, len(req.Positions))
+	for _, item := range req.Positions {
+		reqs = append(reqs, service.ReportPositionRequest{
+			OrderID:        record.OrderID,
+			DroneID:        record.DroneID,
+			PilotID:        order.PilotID,
+			Latitude:       *item.Latitude,
+			Longitude:      *item.Longitude,
+			Altitude:       item.Altitude,
+			Speed:          item.Speed,
+			Heading:        item.Heading,
+			VerticalSpeed:  item.VerticalSpeed,
+			BatteryLevel:   item.BatteryLevel,
+			SignalStrength: item.SignalStrength,
+			GPSSatellites:  item.GPSSatellites,
+			Temperature:    item.Temperature,
+			WindSpeed:      item.WindSpeed,
+			WindDirection:  item.WindDirection,
+			RecordedAt:     item.RecordedAt,
+		})
+	}
+
+	positions, alerts, err := h.flightService.ReportPositions(reqs)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+
+	response.V2Success(c, gin.H{
+		"flight_record_id": record.ID,
+		"accepted":         len(positions),
+		"latest_position":  buildPositionSummary(positions[len(positions)-1]),
+		"alerts":           buildAlertList(alerts),
+	})
+}
+
 func (h *Handler) ReportAlert(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
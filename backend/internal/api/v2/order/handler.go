@@ -17,6 +17,7 @@ import (
 	v2common "wurenji-backend/internal/api/v2/common"
 	"wurenji-backend/internal/model"
 	"wurenji-backend/internal/pkg/response"
+	"wurenji-backend/internal/pkg/upload"
 	"wurenji-backend/internal/service"
 )
 
@@ -25,6 +26,8 @@ type Handler struct {
 	dispatchService *service.DispatchService
 	flightService   *service.FlightService
 	contractService *service.ContractService
+	disputeService  *service.DisputeService
+	uploadService   *upload.UploadService
 }
 
 type aggregatedOrderTimelineEvent struct {
@@ -53,6 +56,11 @@ func (h *Handler) SetContractService(cs *service.ContractService) {
 	h.contractService = cs
 }
 
+func (h *Handler) SetDisputeService(ds *service.DisputeService, uploadService *upload.UploadService) {
+	h.disputeService = ds
+	h.uploadService = uploadService
+}
+
 func (h *Handler) List(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
@@ -206,6 +214,39 @@ func (h *Handler) Cancel(c *gin.Context) {
 	response.V2Success(c, buildOrderSummary(updated))
 }
 
+// CancelPreview 取消前预览按订单退款政策计算的退款、补偿与违约金
+func (h *Handler) CancelPreview(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+
+	order, err := h.orderService.GetAuthorizedOrder(orderID, userID, "")
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+
+	role := h.resolveOrderActorRole(c, order, userID)
+	if role == "" {
+		response.V2Forbidden(c, "无权操作此订单")
+		return
+	}
+
+	quote, err := h.orderService.PreviewCancellation(orderID, role)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	response.V2Success(c, quote)
+}
+
 func (h *Handler) Dispatch(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
@@ -403,16 +444,7 @@ func (h *Handler) CreateDispute(c *gin.Context) {
 		v2common.HandleServiceError(c, err)
 		return
 	}
-	response.V2Success(c, gin.H{
-		"id":                record.ID,
-		"order_id":          record.OrderID,
-		"initiator_user_id": record.InitiatorUserID,
-		"dispute_type":      record.DisputeType,
-		"status":            record.Status,
-		"summary":           record.Summary,
-		"created_at":        record.CreatedAt,
-		"updated_at":        record.UpdatedAt,
-	})
+	response.V2Success(c, buildDisputeSummary(record))
 }
 
 func (h *Handler) ListDisputes(c *gin.Context) {
@@ -440,6 +472,95 @@ func (h *Handler) ListDisputes(c *gin.Context) {
 	response.V2Success(c, gin.H{"items": buildDisputeList(disputes)})
 }
 
+// parseDisputeRequest 解析纠纷路由参数并校验登录用户
+func (h *Handler) parseDisputeRequest(c *gin.Context) (int64, int64, int64, bool) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return 0, 0, 0, false
+	}
+	if h.disputeService == nil {
+		response.V2NotImplemented(c, "纠纷服务未启用")
+		return 0, 0, 0, false
+	}
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	disputeID, err := strconv.ParseInt(c.Param("dispute_id"), 10, 64)
+	if err != nil || disputeID <= 0 {
+		response.V2ValidationError(c, "invalid dispute_id")
+		return 0, 0, 0, false
+	}
+	return userID, orderID, disputeID, true
+}
+
+func (h *Handler) GetDispute(c *gin.Context) {
+	userID, orderID, disputeID, ok := h.parseDisputeRequest(c)
+	if !ok {
+		return
+	}
+	detail, err := h.disputeService.GetDispute(orderID, disputeID, userID)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	response.V2Success(c, gin.H{
+		"dispute":   buildDisputeSummary(detail.Dispute),
+		"evidences": detail.Evidences,
+	})
+}
+
+// AddDisputeEvidence 提交纠纷证据，multipart 表单: file(可选) + content
+func (h *Handler) AddDisputeEvidence(c *gin.Context) {
+	userID, orderID, disputeID, ok := h.parseDisputeRequest(c)
+	if !ok {
+		return
+	}
+
+	fileURL := ""
+	if file, err := c.FormFile("file"); err == nil {
+		if h.uploadService == nil {
+			response.V2NotImplemented(c, "文件上传未启用")
+			return
+		}
+		fileURL, err = h.uploadService.SaveFile(file, "disputes")
+		if err != nil {
+			response.V2ValidationError(c, err.Error())
+			return
+		}
+	}
+
+	evidence, err := h.disputeService.AddEvidence(orderID, disputeID, userID, c.PostForm("content"), fileURL)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	response.V2Success(c, evidence)
+}
+
+// RespondDispute 被申诉方提交答辩
+func (h *Handler) RespondDispute(c *gin.Context) {
+	userID, orderID, disputeID, ok := h.parseDisputeRequest(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.V2ValidationError(c, "invalid dispute response payload")
+		return
+	}
+
+	evidence, err := h.disputeService.SubmitResponse(orderID, disputeID, userID, req.Content)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	response.V2Success(c, evidence)
+}
+
 func (h *Handler) buildOrderDetail(order *model.Order) (gin.H, error) {
 	payments, err := h.orderService.ListPaymentsByOrder(order.ID)
 	if err != nil {
@@ -870,20 +991,35 @@ func buildRefunds(refunds []model.Refund) []gin.H {
 func buildDisputeList(disputes []model.DisputeRecord) []gin.H {
 	items := make([]gin.H, 0, len(disputes))
 	for i := range disputes {
-		items = append(items, gin.H{
-			"id":                disputes[i].ID,
-			"order_id":          disputes[i].OrderID,
-			"initiator_user_id": disputes[i].InitiatorUserID,
-			"dispute_type":      disputes[i].DisputeType,
-			"status":            disputes[i].Status,
-			"summary":           disputes[i].Summary,
-			"created_at":        disputes[i].CreatedAt,
-			"updated_at":        disputes[i].UpdatedAt,
-		})
+		items = append(items, buildDisputeSummary(&disputes[i]))
 	}
 	return items
 }
 
+func buildDisputeSummary(dispute *model.DisputeRecord) gin.H {
+	return gin.H{
+		"id":                 dispute.ID,
+		"order_id":           dispute.OrderID,
+		"initiator_user_id":  dispute.InitiatorUserID,
+		"initiator_role":     dispute.InitiatorRole,
+		"respondent_user_id": dispute.RespondentUserID,
+		"dispute_type":       dispute.DisputeType,
+		"status":             dispute.Status,
+		"summary":            dispute.Summary,
+		"response_due_at":    dispute.ResponseDueAt,
+		"resolution_due_at":  dispute.ResolutionDueAt,
+		"responded_at":       dispute.RespondedAt,
+		"resolution":         dispute.Resolution,
+		"refund_amount":      dispute.RefundAmount,
+		"penalty_amount":     dispute.PenaltyAmount,
+		"liable_role":        dispute.LiableRole,
+		"resolution_note":    dispute.ResolutionNote,
+		"resolved_at":        dispute.ResolvedAt,
+		"created_at":         dispute.CreatedAt,
+		"updated_at":         dispute.UpdatedAt,
+	}
+}
+
 func buildFinancialSummary(order *model.Order, payments []model.Payment, refunds []model.Refund) gin.H {
 	paidAmount := int64(0)
 	paidCount := 0
@@ -903,6 +1039,8 @@ func buildFinancialSummary(order *model.Order, payments []model.Payment, refunds
 	}
 	return gin.H{
 		"total_amount":           order.TotalAmount,
+		"coupon_discount":        order.CouponDiscount,
+		"payable_amount":         order.PayableAmount(),
 		"deposit_amount":         order.DepositAmount,
 		"platform_commission":    order.PlatformCommission,
 		"owner_amount":           order.OwnerAmount,
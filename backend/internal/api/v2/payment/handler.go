@@ -18,6 +18,7 @@ import (
 type Handler struct {
 	orderService   *service.OrderService
 	paymentService *service.PaymentService
+	couponService  *service.CouponService
 }
 
 func NewHandler(orderService *service.OrderService, paymentService *service.PaymentService) *Handler {
@@ -27,6 +28,10 @@ func NewHandler(orderService *service.OrderService, paymentService *service.Paym
 	}
 }
 
+func (h *Handler) SetCouponService(couponService *service.CouponService) {
+	h.couponService = couponService
+}
+
 func (h *Handler) CreateOrderPayment(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == 0 {
@@ -60,7 +65,7 @@ func (h *Handler) CreateOrderPayment(c *gin.Context) {
 	data := gin.H{
 		"payment":      buildPaymentSummary(paymentRecord),
 		"pay_params":   parsePaymentParams(payParams),
-		"payment_flow": buildPaymentFlow(req.Method, paymentRecord),
+		"payment_flow": buildPaymentFlow(req.Method, paymentRecord, h.paymentService.IsGatewayMethod(paymentRecord.PaymentMethod)),
 	}
 	if strings.EqualFold(req.Method, "mock") {
 		if err := h.paymentService.MockPaymentComplete(paymentRecord.PaymentNo); err != nil {
@@ -69,7 +74,7 @@ func (h *Handler) CreateOrderPayment(c *gin.Context) {
 		}
 		if latestPayment, err := h.paymentService.GetPaymentStatus(paymentRecord.PaymentNo); err == nil && latestPayment != nil {
 			data["payment"] = buildPaymentSummary(latestPayment)
-			data["payment_flow"] = buildPaymentFlow(req.Method, latestPayment)
+			data["payment_flow"] = buildPaymentFlow(req.Method, latestPayment, h.paymentService.IsGatewayMethod(latestPayment.PaymentMethod))
 		}
 		if order, err := h.orderService.GetAuthorizedOrder(orderID, userID, "client"); err == nil && order != nil {
 			data["order"] = gin.H{
@@ -176,6 +181,116 @@ func (h *Handler) RefundOrder(c *gin.Context) {
 	response.V2Success(c, gin.H{"items": items})
 }
 
+func (h *Handler) ListMyCoupons(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+	if h.couponService == nil {
+		response.V2NotImplemented(c, "coupons are not enabled")
+		return
+	}
+	page, pageSize := middleware.GetPagination(c)
+
+	coupons, total, err := h.couponService.ListMyCoupons(userID, c.Query("status"), page, pageSize)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	items := make([]gin.H, 0, len(coupons))
+	for i := range coupons {
+		items = append(items, buildCouponSummary(&coupons[i]))
+	}
+	response.V2SuccessList(c, items, total)
+}
+
+func (h *Handler) ListOrderCoupons(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+	if h.couponService == nil {
+		response.V2NotImplemented(c, "coupons are not enabled")
+		return
+	}
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+
+	options, err := h.couponService.ListOrderCoupons(orderID, userID)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	items := make([]gin.H, 0, len(options))
+	for i := range options {
+		items = append(items, gin.H{
+			"coupon":   buildCouponSummary(options[i].Coupon),
+			"discount": options[i].Discount,
+			"usable":   options[i].Usable,
+			"reason":   options[i].Reason,
+			"applied":  options[i].Applied,
+		})
+	}
+	response.V2Success(c, gin.H{"items": items})
+}
+
+func (h *Handler) ApplyOrderCoupon(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+	if h.couponService == nil {
+		response.V2NotImplemented(c, "coupons are not enabled")
+		return
+	}
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		UserCouponID int64 `json:"user_coupon_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.V2ValidationError(c, "invalid coupon payload")
+		return
+	}
+
+	order, err := h.couponService.ApplyOrderCoupon(orderID, userID, req.UserCouponID)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	response.V2Success(c, buildOrderAmountSummary(order))
+}
+
+func (h *Handler) RemoveOrderCoupon(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+	if h.couponService == nil {
+		response.V2NotImplemented(c, "coupons are not enabled")
+		return
+	}
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+
+	order, err := h.couponService.RemoveOrderCoupon(orderID, userID)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+	response.V2Success(c, buildOrderAmountSummary(order))
+}
+
 func parseOrderID(c *gin.Context) (int64, bool) {
 	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
 	if err != nil || orderID <= 0 {
@@ -217,7 +332,7 @@ func parsePaymentParams(result *paymentpkg.PaymentResult) interface{} {
 	return gin.H{"raw": result.PayParams}
 }
 
-func buildPaymentFlow(method string, paymentRecord *model.Payment) gin.H {
+func buildPaymentFlow(method string, paymentRecord *model.Payment, gateway bool) gin.H {
 	normalizedMethod := strings.ToLower(strings.TrimSpace(method))
 	status := "pending"
 	autoCompleted := false
@@ -228,6 +343,20 @@ func buildPaymentFlow(method string, paymentRecord *model.Payment) gin.H {
 		status = "completed"
 	}
 
+	if gateway {
+		if status != "completed" {
+			status = "pending_callback"
+		}
+		return gin.H{
+			"method":             normalizedMethod,
+			"capability":         "gateway",
+			"status":             status,
+			"auto_completed":     false,
+			"recommended_method": normalizedMethod,
+			"notice":             "已向支付渠道下单，请在客户端完成支付，支付结果以渠道回调或主动查询为准。",
+		}
+	}
+
 	switch normalizedMethod {
 	case "mock":
 		capability = "active"
@@ -270,3 +399,50 @@ func buildRefundSummary(refund *model.Refund) gin.H {
 		"updated_at": refund.UpdatedAt,
 	}
 }
+
+func buildCouponSummary(coupon *model.UserCoupon) gin.H {
+	if coupon == nil {
+		return nil
+	}
+	summary := gin.H{
+		"id":              coupon.ID,
+		"template_id":     coupon.TemplateID,
+		"status":          coupon.Status,
+		"issue_source":    coupon.IssueSource,
+		"valid_from":      coupon.ValidFrom,
+		"expires_at":      coupon.ExpiresAt,
+		"order_id":        coupon.OrderID,
+		"discount_amount": coupon.DiscountAmount,
+		"used_at":         coupon.UsedAt,
+		"created_at":      coupon.CreatedAt,
+	}
+	if template := coupon.Template; template != nil {
+		summary["name"] = template.Name
+		summary["description"] = template.Description
+		summary["discount_type"] = template.DiscountType
+		summary["template_discount_amount"] = template.DiscountAmount
+		summary["discount_rate"] = template.DiscountRate
+		summary["max_discount"] = template.MaxDiscount
+		summary["min_order_amount"] = template.MinOrderAmount
+		summary["first_order_only"] = template.FirstOrderOnly
+		summary["service_types"] = template.ServiceTypes
+		summary["cities"] = template.Cities
+	}
+	return summary
+}
+
+func buildOrderAmountSummary(order *model.Order) gin.H {
+	if order == nil {
+		return nil
+	}
+	return gin.H{
+		"order_id":            order.ID,
+		"total_amount":        order.TotalAmount,
+		"user_coupon_id":      order.UserCouponID,
+		"coupon_discount":     order.CouponDiscount,
+		"payable_amount":      order.PayableAmount(),
+		"deposit_amount":      order.DepositAmount,
+		"platform_commission": order.PlatformCommission,
+		"owner_amount":        order.OwnerAmount,
+	}
+}
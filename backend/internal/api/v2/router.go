@@ -101,6 +101,7 @@ func RegisterRoutes(r *gin.Engine, h *Handlers) {
 		authenticated.GET("/me", h.Me.Get)
 		authenticated.GET("/me/reviews", h.Review.ListMine)
 		authenticated.GET("/home/dashboard", h.Home.GetDashboard)
+		authenticated.GET("/coupons", h.Payment.ListMyCoupons)
 
 		clientGroup := authenticated.Group("/client")
 		{
@@ -113,6 +114,7 @@ func RegisterRoutes(r *gin.Engine, h *Handlers) {
 		{
 			supplyGroup.GET("", h.Supply.List)
 			supplyGroup.GET("/:supply_id", h.Supply.Get)
+			supplyGroup.POST("/:supply_id/quote", h.Supply.Quote)
 			supplyGroup.POST("/:supply_id/orders", h.Supply.CreateDirectOrder)
 		}
 
@@ -175,7 +177,11 @@ func RegisterRoutes(r *gin.Engine, h *Handlers) {
 			orderGroup.GET("/:order_id", h.Order.Get)
 			orderGroup.POST("/:order_id/provider-confirm", h.Order.ProviderConfirm)
 			orderGroup.POST("/:order_id/provider-reject", h.Order.ProviderReject)
+			orderGroup.GET("/:order_id/coupons", h.Payment.ListOrderCoupons)
+			orderGroup.PUT("/:order_id/coupon", h.Payment.ApplyOrderCoupon)
+			orderGroup.DELETE("/:order_id/coupon", h.Payment.RemoveOrderCoupon)
 			orderGroup.POST("/:order_id/pay", h.Payment.CreateOrderPayment)
+			orderGroup.GET("/:order_id/cancel-preview", h.Order.CancelPreview)
 			orderGroup.POST("/:order_id/cancel", h.Order.Cancel)
 			orderGroup.POST("/:order_id/start-preparing", h.Order.StartPreparing)
 			orderGroup.POST("/:order_id/start-flight", h.Order.StartFlight)
@@ -194,6 +200,9 @@ func RegisterRoutes(r *gin.Engine, h *Handlers) {
 			orderGroup.GET("/:order_id/settlement", h.Settlement.GetOrderSettlement)
 			orderGroup.GET("/:order_id/disputes", h.Order.ListDisputes)
 			orderGroup.POST("/:order_id/disputes", h.Order.CreateDispute)
+			orderGroup.GET("/:order_id/disputes/:dispute_id", h.Order.GetDispute)
+			orderGroup.POST("/:order_id/disputes/:dispute_id/evidence", h.Order.AddDisputeEvidence)
+			orderGroup.POST("/:order_id/disputes/:dispute_id/response", h.Order.RespondDispute)
 			orderGroup.POST("/:order_id/reviews", h.Review.CreateOrderReview)
 			orderGroup.GET("/:order_id/reviews", h.Review.ListOrderReviews)
 			orderGroup.GET("/:order_id/contract", h.Order.GetContract)
@@ -214,6 +223,7 @@ func RegisterRoutes(r *gin.Engine, h *Handlers) {
 		{
 			flightGroup.GET("/:flight_id", h.Flight.Get)
 			flightGroup.POST("/:flight_id/positions", h.Flight.ReportPosition)
+			flightGroup.POST("/:flight_id/positions/batch", h.Flight.ReportPositions)
 			flightGroup.POST("/:flight_id/alerts", h.Flight.ReportAlert)
 			flightGroup.POST("/:flight_id/complete", h.Flight.Complete)
 		}
@@ -302,6 +312,9 @@ func RegisterRoutes(r *gin.Engine, h *Handlers) {
 				adminGroup.GET("/migration-audits", h.AdminLegacy.MigrationAuditList)
 				adminGroup.GET("/migration-audits/summary", h.AdminLegacy.MigrationAuditSummary)
 				adminGroup.GET("/payments", h.AdminLegacy.PaymentList)
+				adminGroup.GET("/jobs", h.AdminLegacy.JobList)
+				adminGroup.GET("/jobs/runs", h.AdminLegacy.JobRunList)
+				adminGroup.POST("/jobs/:name/run", h.AdminLegacy.TriggerJob)
 			}
 		}
 	}
@@ -39,21 +39,20 @@ func (h *Handler) GetOrderSettlement(c *gin.Context) {
 		return
 	}
 
-	order, err := h.orderService.GetAuthorizedOrder(orderID, userID, "")
-	if err != nil {
+	if _, err := h.orderService.GetAuthorizedOrder(orderID, userID, ""); err != nil {
 		v2common.HandleServiceError(c, err)
 		return
 	}
 
+	// 结算由订单完成事件触发、后台任务推进，尚未生成时返回空
 	settlement, err := h.settlementService.GetSettlementByOrder(orderID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) && order.Status == "completed" {
-			settlement, err = h.settlementService.CreateSettlement(orderID)
-		}
-		if err != nil {
-			v2common.HandleServiceError(c, err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.V2Success(c, nil)
 			return
 		}
+		v2common.HandleServiceError(c, err)
+		return
 	}
 
 	response.V2Success(c, buildSettlementSummary(settlement))
@@ -72,6 +71,7 @@ func buildSettlementSummary(settlement *model.OrderSettlement) gin.H {
 		"final_amount":        settlement.FinalAmount,
 		"platform_fee_rate":   settlement.PlatformFeeRate,
 		"platform_fee":        settlement.PlatformFee,
+		"platform_subsidy":    settlement.PlatformSubsidy,
 		"pilot_fee_rate":      settlement.PilotFeeRate,
 		"pilot_fee":           settlement.PilotFee,
 		"owner_fee_rate":      settlement.OwnerFeeRate,
@@ -92,6 +92,7 @@ func buildSettlementSummary(settlement *model.OrderSettlement) gin.H {
 		"settled_at":          settlement.SettledAt,
 		"settled_by":          settlement.SettledBy,
 		"notes":               settlement.Notes,
+		"auto_confirm_at":     settlement.AutoConfirmAt,
 		"created_at":          settlement.CreatedAt,
 		"updated_at":          settlement.UpdatedAt,
 	}
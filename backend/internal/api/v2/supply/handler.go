@@ -104,6 +104,35 @@ func (h *Handler) CreateDirectOrder(c *gin.Context) {
 	response.V2Success(c, result)
 }
 
+// Quote 下单前报价预览，包含时段与供需动态溢价
+func (h *Handler) Quote(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == 0 {
+		response.V2Unauthorized(c, "missing user context")
+		return
+	}
+
+	supplyID, err := strconv.ParseInt(c.Param("supply_id"), 10, 64)
+	if err != nil || supplyID <= 0 {
+		response.V2ValidationError(c, "invalid supply_id")
+		return
+	}
+
+	var req service.DirectOrderInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.V2ValidationError(c, "invalid quote payload")
+		return
+	}
+
+	result, err := h.clientService.QuoteDirectSupplyOrder(userID, supplyID, &req)
+	if err != nil {
+		v2common.HandleServiceError(c, err)
+		return
+	}
+
+	response.V2Success(c, result)
+}
+
 func buildSupplySummary(supply *model.OwnerSupply) gin.H {
 	if supply == nil {
 		return gin.H{}
@@ -3,8 +3,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -28,6 +30,14 @@ type Config struct {
 	CORS      CORSConfig      `mapstructure:"cors"`
 	Push      PushConfig      `mapstructure:"push"`
 	OAuth     OAuthConfig     `mapstructure:"oauth"`
+	Scheduler SchedulerConfig `mapstructure:"scheduler"`
+	UOM       UOMConfig       `mapstructure:"uom"`
+	Telemetry TelemetryConfig `mapstructure:"telemetry"`
+	OrderGate OrderGateConfig `mapstructure:"order_gate"`
+	Credit    CreditConfig    `mapstructure:"credit"`
+	Dispute   DisputeConfig   `mapstructure:"dispute"`
+	Surge     SurgeConfig     `mapstructure:"surge"`
+	Battery   BatteryConfig   `mapstructure:"battery"`
 }
 
 // ============================================================
@@ -250,8 +260,35 @@ type PaymentConfig struct {
 	CommissionRate int          `mapstructure:"commission_rate"` // 平台佣金比例（百分比）
 	WeChat         WeChatConfig `mapstructure:"wechat"`          // 微信支付配置
 	Alipay         AlipayConfig `mapstructure:"alipay"`          // 支付宝配置
+
+	MockEnabled        bool `mapstructure:"mock_enabled"`         // 是否开放 mock 支付方式（生产环境必须关闭）
+	PendingQueryAfter  int  `mapstructure:"pending_query_after"`  // 渠道支付单创建多久后仍未回调开始主动查询（秒）
+	PendingQueryWindow int  `mapstructure:"pending_query_window"` // 主动查询的时间窗口，更早创建的支付单不再查询（小时）
+
+	Payout PayoutConfig `mapstructure:"payout"` // 提现出款配置
 }
 
+// PayoutProviderBatch 银行卡出款：导出批量代付文件，上传企业网银后导入回单
+const PayoutProviderBatch = "batch"
+
+// PayoutConfig 提现出款配置
+type PayoutConfig struct {
+	WeChat string `mapstructure:"wechat"` // 微信零钱出款: api(企业付款，复用 payment.wechat 商户配置), mock, disabled
+	Alipay string `mapstructure:"alipay"` // 支付宝出款: api(单笔转账，复用 payment.alipay 应用配置), mock, disabled
+	Bank   string `mapstructure:"bank"`   // 银行卡出款: batch, mock, disabled
+
+	PayerAccountNo   string `mapstructure:"payer_account_no"`   // 付款企业账号，写入批量代付文件
+	PayerAccountName string `mapstructure:"payer_account_name"` // 付款企业户名
+	PayerBankName    string `mapstructure:"payer_bank_name"`    // 付款开户行
+}
+
+// 支付渠道实现
+const (
+	PaymentProviderAPI      = "api"      // 对接渠道接口（可通过 gateway_url 指向本地支付沙箱）
+	PaymentProviderMock     = "mock"     // 只创建待回调支付单，不发起扣款
+	PaymentProviderDisabled = "disabled" // 不开放该支付方式
+)
+
 // WeChatConfig 微信支付配置
 type WeChatConfig struct {
 	AppID     string `mapstructure:"app_id"`     // 应用ID
@@ -260,6 +297,9 @@ type WeChatConfig struct {
 	CertPath  string `mapstructure:"cert_path"`  // 证书路径
 	KeyPath   string `mapstructure:"key_path"`   // 私钥路径
 	NotifyURL string `mapstructure:"notify_url"` // 回调地址
+
+	Provider   string `mapstructure:"provider"`    // 渠道实现: api, mock, disabled
+	GatewayURL string `mapstructure:"gateway_url"` // 接口地址，为空使用官方地址
 }
 
 // AlipayConfig 支付宝配置
@@ -269,6 +309,9 @@ type AlipayConfig struct {
 	PublicKey  string `mapstructure:"public_key"`  // 支付宝公钥
 	Sandbox    bool   `mapstructure:"sandbox"`     // 是否沙箱环境
 	NotifyURL  string `mapstructure:"notify_url"`  // 回调地址
+
+	Provider   string `mapstructure:"provider"`    // 渠道实现: api, mock, disabled
+	GatewayURL string `mapstructure:"gateway_url"` // 网关地址，为空时按 sandbox 使用官方正式或沙箱网关
 }
 
 // Validate 验证支付配置
@@ -276,9 +319,60 @@ func (p *PaymentConfig) Validate() error {
 	if p.CommissionRate < 0 || p.CommissionRate > 100 {
 		return errors.New("payment.commission_rate must be between 0 and 100")
 	}
+	if err := validatePaymentProvider("wechat", p.WeChat.Provider, p.IsWeChatEnabled()); err != nil {
+		return err
+	}
+	if err := validatePaymentProvider("alipay", p.Alipay.Provider, p.IsAlipayEnabled()); err != nil {
+		return err
+	}
+	// mock 渠道依赖 mock 回调接口完成支付，必须随 mock_enabled 一起开启
+	if !p.MockEnabled && (p.WeChat.Provider == PaymentProviderMock || p.Alipay.Provider == PaymentProviderMock) {
+		return errors.New("payment.wechat/alipay provider is mock but payment.mock_enabled is false")
+	}
+	if err := validatePayoutProvider("wechat", p.Payout.WeChat, p.IsWeChatEnabled()); err != nil {
+		return err
+	}
+	if err := validatePayoutProvider("alipay", p.Payout.Alipay, p.IsAlipayEnabled()); err != nil {
+		return err
+	}
+	switch p.Payout.Bank {
+	case "", PaymentProviderMock, PaymentProviderDisabled:
+	case PayoutProviderBatch:
+		if p.Payout.PayerAccountNo == "" || p.Payout.PayerAccountName == "" {
+			return errors.New("payment.payout.bank is batch but payer_account_no/payer_account_name are empty")
+		}
+	default:
+		return errors.New("payment.payout.bank must be one of: batch, mock, disabled")
+	}
 	return nil
 }
 
+func validatePaymentProvider(method, provider string, configured bool) error {
+	switch provider {
+	case "", PaymentProviderMock, PaymentProviderDisabled:
+		return nil
+	case PaymentProviderAPI:
+		if !configured {
+			return fmt.Errorf("payment.%s.provider is api but merchant credentials are incomplete", method)
+		}
+		return nil
+	}
+	return fmt.Errorf("payment.%s.provider must be one of: api, mock, disabled", method)
+}
+
+func validatePayoutProvider(method, provider string, configured bool) error {
+	switch provider {
+	case "", PaymentProviderMock, PaymentProviderDisabled:
+		return nil
+	case PaymentProviderAPI:
+		if !configured {
+			return fmt.Errorf("payment.payout.%s is api but payment.%s merchant credentials are incomplete", method, method)
+		}
+		return nil
+	}
+	return fmt.Errorf("payment.payout.%s must be one of: api, mock, disabled", method)
+}
+
 // IsWeChatEnabled 检查微信支付是否已配置
 func (p *PaymentConfig) IsWeChatEnabled() bool {
 	return p.WeChat.AppID != "" && p.WeChat.MchID != "" && p.WeChat.APIKey != ""
@@ -314,6 +408,9 @@ type WebSocketConfig struct {
 	WriteWait      int `mapstructure:"write_wait"`       // 写入超时（秒）
 	PongWait       int `mapstructure:"pong_wait"`        // Pong响应超时（秒）
 	PingPeriod     int `mapstructure:"ping_period"`      // Ping发送间隔（秒）
+
+	Cluster bool   `mapstructure:"cluster"` // 是否通过 Redis 在多实例间分发消息与同步在线状态
+	NodeID  string `mapstructure:"node_id"` // 实例标识，为空时使用 主机名-进程号
 }
 
 // Validate 验证WebSocket配置
@@ -405,6 +502,311 @@ func (o *OAuthConfig) IsQQEnabled() bool {
 	return o.QQ.AppID != "" && o.QQ.AppKey != ""
 }
 
+// ============================================================
+// 定时任务配置
+// ============================================================
+
+// SchedulerConfig 定时任务配置
+type SchedulerConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`      // 是否启动定时任务
+	HistoryKeep int               `mapstructure:"history_keep"` // 每个任务保留的执行记录条数
+	Jobs        map[string]string `mapstructure:"jobs"`         // 任务调度表达式覆盖，key为任务名
+}
+
+// JobSpec 获取任务调度表达式，未配置时返回默认值
+func (s *SchedulerConfig) JobSpec(name, defaultSpec string) string {
+	if spec, ok := s.Jobs[name]; ok && strings.TrimSpace(spec) != "" {
+		return strings.TrimSpace(spec)
+	}
+	return defaultSpec
+}
+
+// ============================================================
+// UOM 空域平台配置
+// ============================================================
+
+// UOMConfig 民航UOM平台对接配置
+type UOMConfig struct {
+	Provider    string             `mapstructure:"provider"`     // 网关类型: simulator, http
+	BaseURL     string             `mapstructure:"base_url"`     // UOM接口地址
+	AppID       string             `mapstructure:"app_id"`       // 接入应用ID
+	AppSecret   string             `mapstructure:"app_secret"`   // 请求签名与回调验签密钥
+	CallbackURL string             `mapstructure:"callback_url"` // 审批结果回调地址
+	Timeout     int                `mapstructure:"timeout"`      // 请求超时（秒）
+	Simulator   UOMSimulatorConfig `mapstructure:"simulator"`    // 本地模拟器配置
+}
+
+// UOMSimulatorConfig 本地UOM模拟器配置
+type UOMSimulatorConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`        // 显式允许使用模拟器（仅开发/测试环境）
+	DecisionDelay int    `mapstructure:"decision_delay"` // 提交后多久给出审批结果（秒）
+	Decision      string `mapstructure:"decision"`       // 审批策略: approve, reject, auto
+	MaxAltitude   int    `mapstructure:"max_altitude"`   // auto 策略允许的最大高度（米）
+}
+
+// IsHTTPEnabled 检查是否对接真实UOM平台
+func (u *UOMConfig) IsHTTPEnabled() bool {
+	return u.Provider == "http" && u.BaseURL != "" && u.AppID != "" && u.AppSecret != ""
+}
+
+// IsSimulatorEnabled 检查是否使用本地UOM模拟器
+func (u *UOMConfig) IsSimulatorEnabled() bool {
+	return u.Provider == "simulator" && u.Simulator.Enabled
+}
+
+// Validate 验证UOM配置，provider 留空表示不对接UOM平台
+func (u *UOMConfig) Validate() error {
+	switch u.Provider {
+	case "":
+		return nil
+	case "http":
+		if u.BaseURL == "" || u.AppID == "" || u.AppSecret == "" {
+			return errors.New("uom.base_url, uom.app_id and uom.app_secret are required when provider is http")
+		}
+	case "simulator":
+		if !u.Simulator.Enabled {
+			return errors.New("uom.simulator.enabled must be true to use the simulator provider")
+		}
+	default:
+		return fmt.Errorf("uom.provider must be one of: [simulator http]")
+	}
+	return nil
+}
+
+// ============================================================
+// 飞控遥测接入配置
+// ============================================================
+
+// TelemetryConfig MAVLink UDP 遥测接入配置
+type TelemetryConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`             // 是否启动 UDP 监听
+	ListenAddr        string `mapstructure:"listen_addr"`         // 监听地址
+	BatchSize         int    `mapstructure:"batch_size"`          // 批量写入条数
+	FlushInterval     int    `mapstructure:"flush_interval"`      // 最长写入间隔（毫秒）
+	MinSampleInterval int    `mapstructure:"min_sample_interval"` // 同一飞控最小采样间隔（毫秒）
+	IdleTimeout       int    `mapstructure:"idle_timeout"`        // 来源无数据多久后回收解析状态（秒）
+
+	Sources []TelemetrySourceConfig `mapstructure:"sources"` // 允许接入的飞控系统ID及来源地址
+}
+
+// TelemetrySourceConfig 飞控系统ID与来源地址绑定
+type TelemetrySourceConfig struct {
+	SystemID int    `mapstructure:"system_id"` // MAVLink 系统ID(1~255)
+	Source   string `mapstructure:"source"`    // 来源 IP 或 CIDR，如地面站/转发网关地址
+}
+
+// Validate 验证遥测配置，启用监听时必须绑定来源，未绑定的来源一律丢弃
+func (t *TelemetryConfig) Validate() error {
+	if !t.Enabled {
+		return nil
+	}
+	if len(t.Sources) == 0 {
+		return errors.New("telemetry.sources must bind at least one system_id to a source when telemetry is enabled")
+	}
+	for _, src := range t.Sources {
+		if src.SystemID < 1 || src.SystemID > 255 {
+			return fmt.Errorf("telemetry.sources system_id %d must be between 1 and 255", src.SystemID)
+		}
+		if _, _, err := net.ParseCIDR(src.Source); err != nil && net.ParseIP(src.Source) == nil {
+			return fmt.Errorf("telemetry.sources source %q must be an IP or CIDR", src.Source)
+		}
+	}
+	return nil
+}
+
+// ============================================================
+// 订单状态流转前置检查配置
+// ============================================================
+
+// 订单流转节点
+const (
+	OrderTransitionCreate          = "create"           // 下单
+	OrderTransitionProviderConfirm = "provider_confirm" // 机主确认
+	OrderTransitionStartFlight     = "start_flight"     // 开始飞行
+)
+
+// 订单前置检查项
+const (
+	OrderGateCheckCredit     = "credit"     // 黑名单与信用风控
+	OrderGateCheckInsurance  = "insurance"  // 飞手与无人机第三者责任险
+	OrderGateCheckAirspace   = "airspace"   // 空域申请已批准
+	OrderGateCheckCompliance = "compliance" // 飞前合规检查通过
+	OrderGateCheckBattery    = "battery"    // 电池飞前检查通过
+)
+
+// OrderGateConfig 订单状态流转前置检查配置
+type OrderGateConfig struct {
+	Enabled     bool                `mapstructure:"enabled"`     // 是否启用前置检查
+	Transitions map[string][]string `mapstructure:"transitions"` // 各流转节点需要通过的检查项，key为流转节点
+}
+
+// Checks 获取流转节点需要通过的检查项
+func (o *OrderGateConfig) Checks(transition string) []string {
+	if !o.Enabled {
+		return nil
+	}
+	return o.Transitions[transition]
+}
+
+// Validate 验证订单前置检查配置
+func (o *OrderGateConfig) Validate() error {
+	validTransitions := map[string]bool{
+		OrderTransitionCreate:          true,
+		OrderTransitionProviderConfirm: true,
+		OrderTransitionStartFlight:     true,
+	}
+	validChecks := map[string]bool{
+		OrderGateCheckCredit:     true,
+		OrderGateCheckInsurance:  true,
+		OrderGateCheckAirspace:   true,
+		OrderGateCheckCompliance: true,
+		OrderGateCheckBattery:    true,
+	}
+	for transition, checks := range o.Transitions {
+		if !validTransitions[transition] {
+			return fmt.Errorf("order_gate.transitions: unknown transition %q", transition)
+		}
+		for _, check := range checks {
+			if !validChecks[check] {
+				return fmt.Errorf("order_gate.transitions.%s: unknown check %q", transition, check)
+			}
+		}
+	}
+	return nil
+}
+
+// ============================================================
+// 信用分规则配置
+// ============================================================
+
+// 信用事件规则，值为事件对信用分的初始影响(正为加分，负为扣分)
+const (
+	CreditRuleOrderCompleted      = "order_completed"      // 订单完成，计入各参与方
+	CreditRuleOrderCancelled      = "order_cancelled"      // 订单被取消，计入取消方
+	CreditRuleReviewPositive      = "review_positive"      // 收到好评(5星)
+	CreditRuleReviewNegative      = "review_negative"      // 收到差评(1-2星)
+	CreditRuleDisputeLost         = "dispute_lost"         // 纠纷判定为责任方
+	CreditRuleGeofenceNoFly       = "geofence_no_fly"      // 飞入禁飞区
+	CreditRuleGeofenceRestricted  = "geofence_restricted"  // 飞入限飞区
+	CreditRuleViolationMultiplier = "violation_multiplier" // 违规扣分倍数(百分比)，按违规记录的扣分计算
+)
+
+// DefaultCreditRules 内置信用事件规则
+func DefaultCreditRules() map[string]int {
+	return map[string]int{
+		CreditRuleOrderCompleted:      3,
+		CreditRuleOrderCancelled:      -15,
+		CreditRuleReviewPositive:      5,
+		CreditRuleReviewNegative:      -10,
+		CreditRuleDisputeLost:         -30,
+		CreditRuleGeofenceNoFly:       -50,
+		CreditRuleGeofenceRestricted:  -20,
+		CreditRuleViolationMultiplier: 100,
+	}
+}
+
+// CreditConfig 信用分配置
+type CreditConfig struct {
+	HalfLifeDays int            `mapstructure:"half_life_days"` // 事件影响衰减半衰期（天），0 表示不衰减
+	Rules        map[string]int `mapstructure:"rules"`          // 信用事件规则覆盖，未配置的规则使用内置值
+}
+
+// Rule 获取信用事件规则，未配置时返回内置值
+func (c *CreditConfig) Rule(name string) int {
+	if value, ok := c.Rules[name]; ok {
+		return value
+	}
+	return DefaultCreditRules()[name]
+}
+
+// DisputeConfig 订单纠纷处理时限
+type DisputeConfig struct {
+	ResponseHours   int `mapstructure:"response_hours"`   // 被申诉方答辩期（小时），逾期未答辩直接进入仲裁
+	ResolutionHours int `mapstructure:"resolution_hours"` // 自发起起的处理时限（小时），逾期标记超时并提醒管理员
+}
+
+// ResponseWindow 答辩期，未配置时为 48 小时
+func (c *DisputeConfig) ResponseWindow() time.Duration {
+	if c.ResponseHours <= 0 {
+		return 48 * time.Hour
+	}
+	return time.Duration(c.ResponseHours) * time.Hour
+}
+
+// ResolutionWindow 处理时限，未配置时为 7 天
+func (c *DisputeConfig) ResolutionWindow() time.Duration {
+	if c.ResolutionHours <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.ResolutionHours) * time.Hour
+}
+
+// SurgeConfig 动态溢价配置，按城市与六边形网格的实时供需计算溢价倍率
+type SurgeConfig struct {
+	Enabled         bool    `mapstructure:"enabled"`          // 是否启用动态溢价
+	CellEdgeMeters  float64 `mapstructure:"cell_edge_meters"` // 网格边长（米）
+	BaseRatio       float64 `mapstructure:"base_ratio"`       // 需求/供给比超过该值开始溢价
+	Sensitivity     float64 `mapstructure:"sensitivity"`      // 比值每超出 1 增加的倍率
+	MinDemand       int     `mapstructure:"min_demand"`       // 需求数低于该值不溢价
+	MinMultiplier   float64 `mapstructure:"min_multiplier"`   // 倍率下限
+	MaxMultiplier   float64 `mapstructure:"max_multiplier"`   // 倍率上限
+	SmoothingFactor float64 `mapstructure:"smoothing_factor"` // 指数平滑系数 (0,1]，越小变化越平缓
+	MaxStep         float64 `mapstructure:"max_step"`         // 单次刷新倍率最大变动
+	TTLMinutes      int     `mapstructure:"ttl_minutes"`      // 倍率有效期，过期未刷新按 1.0 计价
+}
+
+// TTL 倍率有效期，未配置时为 15 分钟
+func (c *SurgeConfig) TTL() time.Duration {
+	if c.TTLMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.TTLMinutes) * time.Minute
+}
+
+// Validate 验证动态溢价配置
+func (c *SurgeConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.CellEdgeMeters <= 0 {
+		return errors.New("surge.cell_edge_meters must be positive")
+	}
+	if c.MinMultiplier <= 0 || c.MaxMultiplier < c.MinMultiplier {
+		return errors.New("surge.max_multiplier must not be less than surge.min_multiplier")
+	}
+	if c.SmoothingFactor <= 0 || c.SmoothingFactor > 1 {
+		return errors.New("surge.smoothing_factor must be in (0, 1]")
+	}
+	return nil
+}
+
+// BatteryConfig 电池包健康度与退役配置
+type BatteryConfig struct {
+	MinHealthPercent      float64 `mapstructure:"min_health_percent"`      // 飞前检查要求的最低健康度
+	RetireHealthPercent   float64 `mapstructure:"retire_health_percent"`   // 健康度低于该值自动退役
+	HealthSmoothing       float64 `mapstructure:"health_smoothing"`        // 健康度指数平滑系数 (0,1]，越小单次飞行影响越小
+	SwapRisePercent       int     `mapstructure:"swap_rise_percent"`       // 飞行中电量回升超过该值视为换电
+	MinSampleMinutes      float64 `mapstructure:"min_sample_minutes"`      // 单组电池供电时长低于该值不估算健康度
+	PayloadEnduranceRatio float64 `mapstructure:"payload_endurance_ratio"` // 满载续航占额定续航的比例，用于按载重修正期望放电速率
+}
+
+// Validate 验证电池配置
+func (c *BatteryConfig) Validate() error {
+	if c.MinHealthPercent < 0 || c.MinHealthPercent > 100 {
+		return errors.New("battery.min_health_percent must be in [0, 100]")
+	}
+	if c.RetireHealthPercent < 0 || c.RetireHealthPercent > c.MinHealthPercent {
+		return errors.New("battery.retire_health_percent must not exceed battery.min_health_percent")
+	}
+	if c.HealthSmoothing <= 0 || c.HealthSmoothing > 1 {
+		return errors.New("battery.health_smoothing must be in (0, 1]")
+	}
+	if c.PayloadEnduranceRatio <= 0 || c.PayloadEnduranceRatio > 1 {
+		return errors.New("battery.payload_endurance_ratio must be in (0, 1]")
+	}
+	return nil
+}
+
 // ============================================================
 // 配置加载和验证
 // ============================================================
@@ -421,6 +823,48 @@ func LoadConfig(path string) (*Config, error) {
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
+	viper.SetDefault("websocket.cluster", true)
+	viper.SetDefault("scheduler.enabled", true)
+	viper.SetDefault("scheduler.history_keep", 500)
+	viper.SetDefault("uom.simulator.enabled", false)
+	viper.SetDefault("uom.simulator.decision_delay", 30)
+	viper.SetDefault("uom.simulator.decision", "auto")
+	viper.SetDefault("uom.simulator.max_altitude", 120)
+	viper.SetDefault("payment.mock_enabled", false)
+	viper.SetDefault("payment.pending_query_after", 60)
+	viper.SetDefault("payment.pending_query_window", 24)
+	viper.SetDefault("payment.wechat.provider", "disabled")
+	viper.SetDefault("payment.alipay.provider", "disabled")
+	viper.SetDefault("payment.payout.wechat", "mock")
+	viper.SetDefault("payment.payout.alipay", "mock")
+	viper.SetDefault("payment.payout.bank", "mock")
+	viper.SetDefault("telemetry.listen_addr", ":14550")
+	viper.SetDefault("telemetry.batch_size", 100)
+	viper.SetDefault("telemetry.flush_interval", 1000)
+	viper.SetDefault("telemetry.min_sample_interval", 1000)
+	viper.SetDefault("telemetry.idle_timeout", 300)
+	viper.SetDefault("credit.half_life_days", 180)
+	viper.SetDefault("order_gate.enabled", true)
+	viper.SetDefault("surge.enabled", true)
+	viper.SetDefault("surge.cell_edge_meters", 3000)
+	viper.SetDefault("surge.base_ratio", 1.0)
+	viper.SetDefault("surge.sensitivity", 0.25)
+	viper.SetDefault("surge.min_demand", 3)
+	viper.SetDefault("surge.min_multiplier", 1.0)
+	viper.SetDefault("surge.max_multiplier", 2.0)
+	viper.SetDefault("surge.smoothing_factor", 0.5)
+	viper.SetDefault("surge.max_step", 0.3)
+	viper.SetDefault("surge.ttl_minutes", 15)
+	viper.SetDefault("battery.min_health_percent", 80)
+	viper.SetDefault("battery.retire_health_percent", 70)
+	viper.SetDefault("battery.health_smoothing", 0.3)
+	viper.SetDefault("battery.swap_rise_percent", 15)
+	viper.SetDefault("battery.min_sample_minutes", 3)
+	viper.SetDefault("battery.payload_endurance_ratio", 0.6)
+	viper.SetDefault("order_gate.transitions.create", []string{OrderGateCheckCredit})
+	viper.SetDefault("order_gate.transitions.provider_confirm", []string{OrderGateCheckCredit, OrderGateCheckInsurance})
+	viper.SetDefault("order_gate.transitions.start_flight", []string{OrderGateCheckInsurance, OrderGateCheckAirspace, OrderGateCheckCompliance, OrderGateCheckBattery})
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
@@ -460,6 +904,25 @@ func (c *Config) Validate() error {
 	if err := c.WebSocket.Validate(); err != nil {
 		return fmt.Errorf("websocket config error: %w", err)
 	}
+	if err := c.OrderGate.Validate(); err != nil {
+		return fmt.Errorf("order gate config error: %w", err)
+	}
+	if err := c.Surge.Validate(); err != nil {
+		return fmt.Errorf("surge config error: %w", err)
+	}
+	if err := c.Battery.Validate(); err != nil {
+		return fmt.Errorf("battery config error: %w", err)
+	}
+	if err := c.Telemetry.Validate(); err != nil {
+		return fmt.Errorf("telemetry config error: %w", err)
+	}
+	if err := c.UOM.Validate(); err != nil {
+		return fmt.Errorf("uom config error: %w", err)
+	}
+	// 模拟器自动审批空域申请，不允许在 release 模式下启用
+	if c.UOM.IsSimulatorEnabled() && c.Server.Mode == "release" {
+		return errors.New("uom config error: simulator must not be used in release mode")
+	}
 	return nil
 }
 
@@ -485,6 +948,17 @@ func (c *Config) ValidateForProduction() error {
 		return errors.New("production must have at least one payment method configured")
 	}
 
+	// 生产环境不能开放模拟支付
+	if c.Payment.MockEnabled || c.Payment.WeChat.Provider == PaymentProviderMock || c.Payment.Alipay.Provider == PaymentProviderMock {
+		return errors.New("production must not use mock payment")
+	}
+
+	// 生产环境不能模拟出款
+	payout := c.Payment.Payout
+	if payout.WeChat == PaymentProviderMock || payout.Alipay == PaymentProviderMock || payout.Bank == PaymentProviderMock {
+		return errors.New("production must not use mock payout")
+	}
+
 	return nil
 }
 
@@ -498,12 +972,14 @@ func (c *Config) PrintConfigStatus() {
 	fmt.Printf("数据库: %s@%s:%d/%s\n", c.Database.User, c.Database.Host, c.Database.Port, c.Database.DBName)
 	fmt.Printf("Redis: %s:%d DB%d\n", c.Redis.Host, c.Redis.Port, c.Redis.DB)
 	fmt.Printf("短信服务: %s\n", c.SMS.Provider)
-	fmt.Printf("微信支付: %s\n", boolToStatus(c.Payment.IsWeChatEnabled()))
-	fmt.Printf("支付宝: %s\n", boolToStatus(c.Payment.IsAlipayEnabled()))
+	fmt.Printf("微信支付: %s (%s)\n", boolToStatus(c.Payment.IsWeChatEnabled()), c.Payment.WeChat.Provider)
+	fmt.Printf("支付宝: %s (%s)\n", boolToStatus(c.Payment.IsAlipayEnabled()), c.Payment.Alipay.Provider)
 	fmt.Printf("高德地图: %s\n", boolToStatus(c.Amap.IsEnabled()))
 	fmt.Printf("推送服务: %s (%s)\n", boolToStatus(c.Push.IsJPushEnabled()), c.Push.Provider)
 	fmt.Printf("微信登录: %s\n", boolToStatus(c.OAuth.IsWeChatEnabled()))
 	fmt.Printf("QQ登录: %s\n", boolToStatus(c.OAuth.IsQQEnabled()))
+	fmt.Printf("定时任务: %s\n", map[bool]string{true: "已启用", false: "已禁用"}[c.Scheduler.Enabled])
+	fmt.Printf("UOM空域平台: %s (%s)\n", boolToStatus(c.UOM.IsHTTPEnabled()), c.UOM.Provider)
 	fmt.Println("========================================")
 }
 
@@ -32,6 +32,7 @@ type Drone struct {
 	Rating              float64 `gorm:"type:decimal(3,2);default:0" json:"rating"`
 	OrderCount          int     `gorm:"default:0" json:"order_count"`
 	Description         string  `gorm:"type:text" json:"description"`
+	MavlinkSystemID     int     `gorm:"column:mavlink_system_id;default:0;index" json:"mavlink_system_id"` // 飞控 MAVLink 系统ID(1~255)，0 表示未接入遥测
 
 	// ==================== UOM平台登记信息 ====================
 	UOMRegistrationNo  string     `gorm:"type:varchar(100);index" json:"uom_registration_no"`   // UOM平台登记号
@@ -45,13 +46,13 @@ type Drone struct {
 	InsuranceCoverage   int64      `json:"insurance_coverage"`                                         // 保额(分)，要求≥500万
 	InsuranceExpireDate *time.Time `json:"insurance_expire_date"`                                      // 保险到期日
 	InsuranceDoc        string     `gorm:"type:varchar(500)" json:"insurance_doc"`                     // 保险单文件
-	InsuranceVerified   string     `gorm:"type:varchar(20);default:pending" json:"insurance_verified"` // pending, verified, rejected
+	InsuranceVerified   string     `gorm:"type:varchar(20);default:pending" json:"insurance_verified"` // pending, verified, rejected, expired
 
 	// ==================== 适航证书 ====================
 	AirworthinessCertNo     string     `gorm:"type:varchar(100)" json:"airworthiness_cert_no"`                 // 适航证书编号
 	AirworthinessCertExpire *time.Time `json:"airworthiness_cert_expire"`                                      // 适航证书有效期
 	AirworthinessCertDoc    string     `gorm:"type:varchar(500)" json:"airworthiness_cert_doc"`                // 适航证书文件
-	AirworthinessVerified   string     `gorm:"type:varchar(20);default:pending" json:"airworthiness_verified"` // pending, verified, rejected
+	AirworthinessVerified   string     `gorm:"type:varchar(20);default:pending" json:"airworthiness_verified"` // pending, verified, rejected, expired
 
 	// ==================== 维护记录 ====================
 	LastMaintenanceDate *time.Time `json:"last_maintenance_date"`                // 最近维护日期
@@ -27,6 +27,7 @@ type OrderSettlement struct {
 	// ==================== 分账明细 ====================
 	PlatformFeeRate    float64 `gorm:"type:decimal(5,4)" json:"platform_fee_rate"` // 平台费率
 	PlatformFee        int64   `json:"platform_fee"`                               // 平台服务费(分)
+	PlatformSubsidy    int64   `json:"platform_subsidy"`                           // 平台补贴(分)，平台承担的优惠券超出服务费的部分
 	PilotFeeRate       float64 `gorm:"type:decimal(5,4)" json:"pilot_fee_rate"`    // 飞手分成比例
 	PilotFee           int64   `json:"pilot_fee"`                                  // 飞手劳务费(分)
 	OwnerFeeRate       float64 `gorm:"type:decimal(5,4)" json:"owner_fee_rate"`    // 机主分成比例
@@ -45,15 +46,22 @@ type OrderSettlement struct {
 	DifficultyFactor float64 `gorm:"type:decimal(3,1);default:1.0" json:"difficulty_factor"` // 难度系数(1.0-2.0)
 	CargoValue       int64   `json:"cargo_value"`                                            // 货物申报价值(分)
 	InsuranceRate    float64 `gorm:"type:decimal(5,4)" json:"insurance_rate"`                // 保险费率
+	SurgeMultiplier  float64 `gorm:"type:decimal(5,2);default:1" json:"surge_multiplier"`    // 下单时的动态溢价倍率
 
 	// ==================== 状态管理 ====================
-	Status       string     `gorm:"type:varchar(20);default:pending" json:"status"` // pending, calculated, confirmed, settled, disputed
+	Status       string     `gorm:"type:varchar(20);default:pending" json:"status"` // pending, calculated, confirmed, settled, disputed, cancelled
 	CalculatedAt *time.Time `json:"calculated_at"`
 	ConfirmedAt  *time.Time `json:"confirmed_at"`
 	SettledAt    *time.Time `json:"settled_at"`
 	SettledBy    string     `gorm:"type:varchar(20)" json:"settled_by"` // system, admin
 	Notes        string     `gorm:"type:text" json:"notes"`
 
+	// ==================== 自动结算 ====================
+	AutoConfirmAt *time.Time `gorm:"index" json:"auto_confirm_at"`        // 争议期结束、自动确认时间
+	Attempts      int        `gorm:"default:0" json:"attempts"`           // 当前阶段连续失败次数
+	LastError     string     `gorm:"type:varchar(500)" json:"last_error"` // 最近一次失败原因
+	NextRetryAt   *time.Time `gorm:"index" json:"next_retry_at"`          // 失败后下次重试时间
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -134,6 +142,12 @@ type WithdrawalRecord struct {
 	ThirdPartyNo string     `gorm:"type:varchar(100)" json:"third_party_no"` // 第三方转账流水号
 	FailReason   string     `gorm:"type:varchar(255)" json:"fail_reason"`
 
+	// 出款
+	PayoutBatchNo     string     `gorm:"type:varchar(50);index" json:"payout_batch_no"` // 银行卡批量代付批次号
+	PayoutSubmittedAt *time.Time `json:"payout_submitted_at"`                           // 渠道受理时间
+	PayoutAttempts    int        `gorm:"default:0" json:"payout_attempts"`              // 提交/查询未得到最终结果的次数
+	NextPayoutQueryAt *time.Time `gorm:"index" json:"next_payout_query_at"`             // 下次提交或查询出款结果的时间
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -144,6 +158,91 @@ func (WithdrawalRecord) TableName() string {
 	return "withdrawal_records"
 }
 
+// PayoutBatch 银行卡批量代付批次，导出文件上传企业网银，导入银行回单后完成
+type PayoutBatch struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	BatchNo          string     `gorm:"type:varchar(50);uniqueIndex;not null" json:"batch_no"`
+	Status           string     `gorm:"type:varchar(20);default:exported;index" json:"status"` // exported, completed
+	TotalCount       int        `json:"total_count"`
+	TotalAmount      int64      `json:"total_amount"` // 分
+	SucceededCount   int        `json:"succeeded_count"`
+	FailedCount      int        `json:"failed_count"`
+	ExportedBy       int64      `json:"exported_by"`
+	ResultImportedAt *time.Time `json:"result_imported_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (PayoutBatch) TableName() string {
+	return "payout_batches"
+}
+
+// 复式记账账户类型，平台侧账户 UserID 为 0
+const (
+	LedgerAccountPlatform   = "platform"   // 平台收入
+	LedgerAccountEscrow     = "escrow"     // 客户已付、尚未结算的托管资金
+	LedgerAccountInsurance  = "insurance"  // 保险代扣
+	LedgerAccountExternal   = "external"   // 外部资金通道(微信/支付宝/银行)，资金流入为负、流出为正
+	LedgerAccountReceivable = "receivable" // 应收用户欠款(余额不足未扣缴的违约金等)，按用户记账，欠款为负
+	LedgerAccountSubsidy    = "subsidy"    // 平台补贴支出(超出服务费的平台优惠券等)，支出为负
+	LedgerAccountPilot      = "pilot"
+	LedgerAccountOwner      = "owner"
+	LedgerAccountClient     = "client"
+)
+
+// 用户账户分桶，钱包可用余额与冻结余额分别由 available、frozen 桶汇总得出
+const (
+	LedgerBucketAvailable = "available"
+	LedgerBucketFrozen    = "frozen"
+	LedgerBucketDeposit   = "deposit" // 保证金，不计入钱包
+)
+
+// LedgerAccount 复式记账账户，Balance 为该账户全部分录之和
+type LedgerAccount struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountType string    `gorm:"type:varchar(20);not null;uniqueIndex:uk_ledger_accounts_owner" json:"account_type"`
+	UserID      int64     `gorm:"not null;default:0;uniqueIndex:uk_ledger_accounts_owner;index" json:"user_id"`
+	Bucket      string    `gorm:"type:varchar(20);not null;default:available;uniqueIndex:uk_ledger_accounts_owner" json:"bucket"`
+	Balance     int64     `gorm:"not null;default:0" json:"balance"` // 余额(分)
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (LedgerAccount) TableName() string {
+	return "ledger_accounts"
+}
+
+// LedgerEntry 记账凭证，一次资金变动对应一张凭证，其分录金额之和为零
+type LedgerEntry struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	EntryNo        string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"entry_no"`
+	EntryType      string    `gorm:"type:varchar(30);not null;index" json:"entry_type"` // payment_capture, settlement, withdrawal_freeze, withdrawal_release, withdrawal_payout, refund, deposit_pay, deposit_refund, opening_balance
+	ReferenceType  string    `gorm:"type:varchar(30);index:idx_ledger_entries_reference" json:"reference_type"`
+	ReferenceID    int64     `gorm:"index:idx_ledger_entries_reference" json:"reference_id"`
+	IdempotencyKey string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"idempotency_key"` // 同一业务动作只记一次账
+	Description    string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	Postings []LedgerPosting `gorm:"foreignKey:EntryID" json:"postings,omitempty"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// LedgerPosting 分录，Amount 为正表示账户余额增加、为负表示减少
+type LedgerPosting struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	EntryID   int64     `gorm:"index;not null" json:"entry_id"`
+	AccountID int64     `gorm:"index;not null" json:"account_id"`
+	Amount    int64     `gorm:"not null" json:"amount"` // 金额(分)
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (LedgerPosting) TableName() string {
+	return "ledger_postings"
+}
+
 // PricingConfig 定价配置
 type PricingConfig struct {
 	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -161,6 +260,120 @@ func (PricingConfig) TableName() string {
 	return "pricing_configs"
 }
 
+// SurgeMultiplier 动态溢价倍率，按城市或六边形网格保存当前值
+type SurgeMultiplier struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ScopeType        string     `gorm:"type:varchar(10);uniqueIndex:idx_surge_scope;not null" json:"scope_type"` // city, cell
+	ScopeKey         string     `gorm:"type:varchar(60);uniqueIndex:idx_surge_scope;not null" json:"scope_key"`  // 城市名或网格编号
+	City             string     `gorm:"type:varchar(50);index" json:"city"`
+	Multiplier       float64    `gorm:"type:decimal(5,2);default:1" json:"multiplier"`        // 平滑后的生效倍率
+	RawMultiplier    float64    `gorm:"type:decimal(5,2);default:1" json:"raw_multiplier"`    // 按当前供需直接算出的倍率
+	DemandCount      int        `json:"demand_count"`                                         // 进行中的需求
+	TaskCount        int        `json:"task_count"`                                           // 待派单任务
+	PilotCount       int        `json:"pilot_count"`                                          // 在线飞手
+	DroneCount       int        `json:"drone_count"`                                          // 可用无人机
+	ManualMultiplier float64    `gorm:"type:decimal(5,2);default:0" json:"manual_multiplier"` // 人工设定倍率，大于0且未过期时覆盖自动倍率
+	ManualUntil      *time.Time `json:"manual_until"`
+	ComputedAt       time.Time  `json:"computed_at"`
+	ExpiresAt        time.Time  `gorm:"index" json:"expires_at"` // 超过有效期未刷新时按 1.0 计价
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (SurgeMultiplier) TableName() string {
+	return "surge_multipliers"
+}
+
+// SurgeMultiplierLog 溢价倍率变更记录
+type SurgeMultiplierLog struct {
+	ID                 int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ScopeType          string    `gorm:"type:varchar(10);index:idx_surge_log_scope" json:"scope_type"`
+	ScopeKey           string    `gorm:"type:varchar(60);index:idx_surge_log_scope" json:"scope_key"`
+	City               string    `gorm:"type:varchar(50)" json:"city"`
+	PreviousMultiplier float64   `gorm:"type:decimal(5,2)" json:"previous_multiplier"`
+	RawMultiplier      float64   `gorm:"type:decimal(5,2)" json:"raw_multiplier"`
+	Multiplier         float64   `gorm:"type:decimal(5,2)" json:"multiplier"`
+	DemandCount        int       `json:"demand_count"`
+	TaskCount          int       `json:"task_count"`
+	PilotCount         int       `json:"pilot_count"`
+	DroneCount         int       `json:"drone_count"`
+	Source             string    `gorm:"type:varchar(20)" json:"source"` // auto, manual
+	OperatorID         int64     `json:"operator_id"`
+	Reason             string    `gorm:"type:varchar(255)" json:"reason"`
+	CreatedAt          time.Time `gorm:"index" json:"created_at"`
+}
+
+func (SurgeMultiplierLog) TableName() string {
+	return "surge_multiplier_logs"
+}
+
+// CouponTemplate 优惠券模板
+type CouponTemplate struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code        string `gorm:"type:varchar(50);uniqueIndex;not null" json:"code"`
+	Name        string `gorm:"type:varchar(100);not null" json:"name"`
+	Description string `gorm:"type:varchar(255)" json:"description"`
+
+	// 优惠规则
+	DiscountType   string  `gorm:"type:varchar(20);not null" json:"discount_type"`     // fixed, percentage
+	DiscountAmount int64   `json:"discount_amount"`                                    // 满减金额(分)
+	DiscountRate   float64 `gorm:"type:decimal(5,4)" json:"discount_rate"`             // 折扣比例, 0.15 表示减免15%
+	MaxDiscount    int64   `json:"max_discount"`                                       // 折扣封顶(分), 0 表示不封顶
+	MinOrderAmount int64   `json:"min_order_amount"`                                   // 使用门槛(分)
+	FirstOrderOnly bool    `gorm:"default:false" json:"first_order_only"`              // 仅限首单
+	ServiceTypes   JSON    `gorm:"type:json" json:"service_types"`                     // 限定服务类型, 为空不限
+	Cities         JSON    `gorm:"type:json" json:"cities"`                            // 限定城市, 为空不限
+	FundedBy       string  `gorm:"type:varchar(20);default:platform" json:"funded_by"` // platform: 平台补贴, provider: 服务方让利
+
+	// 发放规则
+	IssueTrigger  string     `gorm:"type:varchar(20);default:manual;index" json:"issue_trigger"` // manual, new_user, referral
+	TotalQuantity int        `gorm:"default:0" json:"total_quantity"`                            // 发放总量, 0 表示不限
+	IssuedCount   int        `gorm:"default:0" json:"issued_count"`
+	PerUserLimit  int        `gorm:"default:1" json:"per_user_limit"` // 每人限领张数
+	ValidDays     int        `gorm:"default:0" json:"valid_days"`     // 领取后有效天数, 0 表示按固定有效期
+	ValidFrom     *time.Time `json:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until"`
+
+	Status    string    `gorm:"type:varchar(20);default:active;index" json:"status"` // active, disabled
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (CouponTemplate) TableName() string {
+	return "coupon_templates"
+}
+
+// UserCoupon 用户券包中的优惠券
+type UserCoupon struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID  int64  `gorm:"index;not null" json:"template_id"`
+	UserID      int64  `gorm:"index;not null" json:"user_id"`
+	IssueKey    string `gorm:"type:varchar(120);uniqueIndex;not null" json:"-"`        // 发放幂等键
+	IssueSource string `gorm:"type:varchar(20);index" json:"issue_source"`             // admin_batch, new_user, referral
+	SourceID    int64  `json:"source_id"`                                              // 发放操作人或被邀请人
+	Status      string `gorm:"type:varchar(20);default:available;index" json:"status"` // available, locked, used, expired
+
+	ValidFrom *time.Time `json:"valid_from"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"`
+
+	// 核销
+	OrderID        int64      `gorm:"index" json:"order_id"` // 锁定或已核销的订单
+	DiscountAmount int64      `json:"discount_amount"`       // 实际抵扣金额(分)
+	LockedAt       *time.Time `json:"locked_at"`
+	UsedAt         *time.Time `json:"used_at"`
+	ReleasedAt     *time.Time `json:"released_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Template *CouponTemplate `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+}
+
+func (UserCoupon) TableName() string {
+	return "user_coupons"
+}
+
 // ============================================================
 // ==================== 阶段六：信用评价与风控 ====================
 // ============================================================
@@ -228,7 +441,7 @@ func (CreditScore) TableName() string {
 type CreditScoreLog struct {
 	ID              int64     `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID          int64     `gorm:"index;not null" json:"user_id"`
-	ChangeType      string    `gorm:"type:varchar(30);not null" json:"change_type"` // order_complete, review_received, violation, bonus, penalty, recalculate
+	ChangeType      string    `gorm:"type:varchar(30);not null" json:"change_type"` // order_complete, review_received, violation, bonus, penalty, decay, recalculate
 	ChangeReason    string    `gorm:"type:varchar(255)" json:"change_reason"`
 	Dimension       string    `gorm:"type:varchar(30)" json:"dimension"` // qualification, service, safety, activity, compliance, fulfillment, attitude, identity, payment, order_quality
 	ScoreBefore     int       `json:"score_before"`
@@ -236,6 +449,7 @@ type CreditScoreLog struct {
 	ScoreChange     int       `json:"score_change"` // 正为增加，负为减少
 	RelatedOrderID  int64     `gorm:"index" json:"related_order_id"`
 	RelatedReviewID int64     `gorm:"index" json:"related_review_id"`
+	RelatedEventID  int64     `gorm:"index" json:"related_event_id"`         // 关联信用事件
 	OperatorID      int64     `json:"operator_id"`                           // 0表示系统自动
 	OperatorType    string    `gorm:"type:varchar(20)" json:"operator_type"` // system, admin, auto
 	Notes           string    `gorm:"type:text" json:"notes"`
@@ -246,6 +460,35 @@ func (CreditScoreLog) TableName() string {
 	return "credit_score_logs"
 }
 
+// CreditEvent 信用事件: 订单、评价、纠纷、违规等业务事件按规则折算为信用分影响，影响随时间衰减
+type CreditEvent struct {
+	ID            int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	EventKey      string     `gorm:"type:varchar(100);uniqueIndex;not null" json:"event_key"` // 幂等键，同一业务事件只计一次
+	EventType     string     `gorm:"type:varchar(30);not null;index" json:"event_type"`       // order_completed, order_cancelled, review_received, dispute_lost, violation_confirmed, geofence_violation
+	UserID        int64      `gorm:"index;not null" json:"user_id"`
+	UserType      string     `gorm:"type:varchar(20);not null" json:"user_type"` // pilot, owner, client
+	OrderID       int64      `gorm:"index" json:"order_id"`
+	ReviewID      int64      `json:"review_id"`
+	RelatedID     int64      `json:"related_id"`                                           // 违规/纠纷/围栏ID
+	Rating        int        `json:"rating"`                                               // 评价星级
+	Severity      string     `gorm:"type:varchar(30)" json:"severity"`                     // 违规等级 / 围栏类型
+	Detail        string     `gorm:"type:varchar(255)" json:"detail"`                      // 事件说明
+	Dimension     string     `gorm:"type:varchar(30)" json:"dimension"`                    // 影响的信用维度
+	Points        int        `json:"points"`                                               // 初始影响分
+	AppliedPoints int        `json:"applied_points"`                                       // 当前计入信用分的影响分(衰减后)
+	Status        string     `gorm:"type:varchar(20);default:pending;index" json:"status"` // pending, applied, revoked
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	LastError     string     `gorm:"type:varchar(255)" json:"last_error"`
+	OccurredAt    time.Time  `gorm:"index" json:"occurred_at"`
+	AppliedAt     *time.Time `json:"applied_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (CreditEvent) TableName() string {
+	return "credit_events"
+}
+
 // RiskControl 风控记录
 type RiskControl struct {
 	ID       int64  `gorm:"primaryKey;autoIncrement" json:"id"`
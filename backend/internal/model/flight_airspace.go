@@ -23,6 +23,9 @@ type FlightRecord struct {
 	UpdatedAt            time.Time      `json:"updated_at"`
 	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
 
+	PositionsDownsampledAt *time.Time `json:"positions_downsampled_at"` // 位置点降采样时间，之后统计指标不再从位置点重算
+	MaintenanceCountedAt   *time.Time `json:"maintenance_counted_at"`   // 计入无人机维护使用量的时间
+
 	Order        *Order              `gorm:"foreignKey:OrderID" json:"order,omitempty"`
 	DispatchTask *FormalDispatchTask `gorm:"foreignKey:DispatchTaskID" json:"dispatch_task,omitempty"`
 	Pilot        *User               `gorm:"foreignKey:PilotUserID" json:"pilot,omitempty"`
@@ -105,6 +108,12 @@ type FlightAlert struct {
 	ResolvedAt     *time.Time `json:"resolved_at"`
 	ResolutionNote string     `gorm:"type:text" json:"resolution_note"`
 
+	// 去重与升级：同一飞行的同一告警码只保留一条未关闭告警
+	OccurrenceCount  int        `gorm:"default:1" json:"occurrence_count"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	EscalationLevel  int        `gorm:"default:0" json:"escalation_level"` // 已通知到的升级步骤数
+	NextEscalationAt *time.Time `gorm:"index" json:"next_escalation_at"`
+
 	TriggeredAt time.Time `gorm:"not null" json:"triggered_at"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -375,7 +384,7 @@ type MultiPointTaskStop struct {
 	SequenceNo int   `gorm:"not null" json:"sequence_no"`
 
 	// 站点类型
-	StopType string `gorm:"type:varchar(20);not null" json:"stop_type"` // pickup, delivery, transfer
+	StopType string `gorm:"type:varchar(20);not null" json:"stop_type"` // pickup, delivery, transfer, battery_swap(返航换电), return_to_base
 
 	// 位置信息
 	Latitude     float64 `gorm:"type:decimal(10,7);not null" json:"latitude"`
@@ -20,6 +20,7 @@ type User struct {
 	WechatOpenID  string         `gorm:"type:varchar(100);index" json:"-"`
 	WechatUnionID string         `gorm:"type:varchar(100);index" json:"-"`
 	QQOpenID      string         `gorm:"type:varchar(100);index" json:"-"`
+	ReferrerID    int64          `gorm:"index" json:"referrer_id"` // 邀请注册的用户
 	CreatedAt     time.Time      `json:"created_at"`
 	UpdatedAt     time.Time      `json:"updated_at"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
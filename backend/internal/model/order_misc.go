@@ -37,9 +37,13 @@ type Order struct {
 	DestLongitude          *float64       `gorm:"type:decimal(10,7)" json:"dest_longitude"`
 	DestAddress            string         `gorm:"type:varchar(255)" json:"dest_address"`
 	TotalAmount            int64          `json:"total_amount"`
+	PricingSnapshot        JSON           `gorm:"type:json" json:"pricing_snapshot"` // 下单时的分项报价
 	PlatformCommissionRate float64        `gorm:"type:decimal(5,2)" json:"platform_commission_rate"`
 	PlatformCommission     int64          `json:"platform_commission"`
 	OwnerAmount            int64          `json:"owner_amount"`
+	UserCouponID           int64          `gorm:"index" json:"user_coupon_id"`              // 使用的优惠券
+	CouponDiscount         int64          `json:"coupon_discount"`                          // 优惠券抵扣金额(分)
+	CouponFundedBy         string         `gorm:"type:varchar(20)" json:"coupon_funded_by"` // platform, provider
 	DepositAmount          int64          `json:"deposit_amount"`
 	Status                 string         `gorm:"type:varchar(40);default:created" json:"status"`
 	FlightStartTime        *time.Time     `json:"flight_start_time"`
@@ -61,6 +65,8 @@ type Order struct {
 	CompletedAt            *time.Time     `json:"completed_at"`
 	CancelReason           string         `gorm:"type:text" json:"cancel_reason"`
 	CancelBy               string         `gorm:"type:varchar(20)" json:"cancel_by"`
+	RefundPolicyID         int64          `gorm:"index" json:"refund_policy_id"` // 下单时生效的退款政策，0 表示内置默认政策
+	RefundPolicyVersion    int            `json:"refund_policy_version"`         // 下单时生效的退款政策版本
 	CreatedAt              time.Time      `json:"created_at"`
 	UpdatedAt              time.Time      `json:"updated_at"`
 	DeletedAt              gorm.DeletedAt `gorm:"index" json:"-"`
@@ -79,6 +85,11 @@ func (Order) TableName() string {
 	return "orders"
 }
 
+// PayableAmount 扣除优惠券后的订单应付金额(分)，不含押金
+func (o *Order) PayableAmount() int64 {
+	return o.TotalAmount - o.CouponDiscount
+}
+
 type OrderTimeline struct {
 	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
 	OrderID      int64     `gorm:"index;not null" json:"order_id"`
@@ -146,16 +157,71 @@ func (Refund) TableName() string {
 	return "refunds"
 }
 
+// RefundPolicy 取消退款政策，按服务类型与订单来源生效；同一政策编码可有多个版本，启用后不可修改，
+// 订单在创建时记录当时生效的版本，取消时按该版本计算退款
+type RefundPolicy struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	PolicyCode  string     `gorm:"type:varchar(50);not null;uniqueIndex:uk_refund_policy_version" json:"policy_code"`
+	Version     int        `gorm:"not null;uniqueIndex:uk_refund_policy_version" json:"version"`
+	Name        string     `gorm:"type:varchar(100)" json:"name"`
+	ServiceType string     `gorm:"type:varchar(30);index" json:"service_type"`         // 空表示适用全部服务类型
+	OrderSource string     `gorm:"type:varchar(30);index" json:"order_source"`         // 空表示适用全部订单来源
+	Status      string     `gorm:"type:varchar(20);default:draft;index" json:"status"` // draft, active, retired
+	Rules       JSON       `gorm:"type:json" json:"rules"`                             // []RefundPolicyRule，按顺序取第一条命中的规则
+	Description string     `gorm:"type:varchar(255)" json:"description"`
+	CreatedBy   int64      `json:"created_by"`
+	ActivatedAt *time.Time `json:"activated_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (RefundPolicy) TableName() string {
+	return "refund_policies"
+}
+
+// RefundPolicyRule 退款规则，条件全部满足时命中；比例均按订单金额(不含押金)计算
+type RefundPolicyRule struct {
+	Name                string   `json:"name"`
+	CancelBy            []string `json:"cancel_by,omitempty"`              // 取消方: client, owner, pilot, admin；空表示任意
+	Dispatched          *bool    `json:"dispatched,omitempty"`             // 是否已有飞手接受派单；空表示不限
+	MinHoursBeforeStart *float64 `json:"min_hours_before_start,omitempty"` // 距开始时间(小时)下限，含
+	MaxHoursBeforeStart *float64 `json:"max_hours_before_start,omitempty"` // 距开始时间(小时)上限，不含；0 表示开始前
+	Deny                bool     `json:"deny,omitempty"`                   // 命中时不允许取消
+	RefundRate          float64  `json:"refund_rate"`                      // 退还订单金额比例
+	RefundDeposit       bool     `json:"refund_deposit"`                   // 是否退还押金
+	CompensationRate    float64  `json:"compensation_rate,omitempty"`      // 从订单金额中补偿服务方的比例
+	CompensateTo        string   `json:"compensate_to,omitempty"`          // provider(机主), executor(执行飞手，未派单时为机主)
+	PenaltyRate         float64  `json:"penalty_rate,omitempty"`           // 服务方取消时承担的违约金比例
+	Description         string   `json:"description"`
+}
+
+// DisputeRecord 订单纠纷: open(待对方答辩) → responded(已答辩) → arbitrating(答辩超时或已分配仲裁员) → resolved
 type DisputeRecord struct {
-	ID              int64          `gorm:"primaryKey;autoIncrement" json:"id"`
-	OrderID         int64          `gorm:"index;not null" json:"order_id"`
-	InitiatorUserID int64          `gorm:"index;not null" json:"initiator_user_id"`
-	DisputeType     string         `gorm:"type:varchar(30);not null" json:"dispute_type"`
-	Status          string         `gorm:"type:varchar(20);default:open;index" json:"status"`
-	Summary         string         `gorm:"type:text" json:"summary"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID          int64          `gorm:"index;not null" json:"order_id"`
+	InitiatorUserID  int64          `gorm:"index;not null" json:"initiator_user_id"`
+	InitiatorRole    string         `gorm:"type:varchar(20)" json:"initiator_role"` // client, owner, pilot
+	RespondentUserID int64          `gorm:"index" json:"respondent_user_id"`        // 被申诉方
+	DisputeType      string         `gorm:"type:varchar(30);not null" json:"dispute_type"`
+	Status           string         `gorm:"type:varchar(20);default:open;index" json:"status"` // open, responded, arbitrating, resolved
+	Summary          string         `gorm:"type:text" json:"summary"`
+	ArbitratorID     int64          `gorm:"index" json:"arbitrator_id"` // 负责仲裁的管理员
+	AssignedAt       *time.Time     `json:"assigned_at"`
+	RespondedAt      *time.Time     `json:"responded_at"`
+	ResponseDueAt    *time.Time     `gorm:"index" json:"response_due_at"`   // 答辩截止时间
+	ResolutionDueAt  *time.Time     `gorm:"index" json:"resolution_due_at"` // 处理时限
+	SLABreached      bool           `gorm:"default:false" json:"sla_breached"`
+	Resolution       string         `gorm:"type:varchar(20)" json:"resolution"` // full_refund, partial_refund, penalty, dismiss
+	RefundAmount     int64          `gorm:"default:0" json:"refund_amount"`     // 判定退还客户金额(分)
+	PenaltyAmount    int64          `gorm:"default:0" json:"penalty_amount"`    // 判定责任方罚金(分)，从其结算分成中扣除
+	LiableUserID     int64          `gorm:"index" json:"liable_user_id"`
+	LiableRole       string         `gorm:"type:varchar(20)" json:"liable_role"`
+	ResolutionNote   string         `gorm:"type:text" json:"resolution_note"`
+	ResolvedBy       int64          `json:"resolved_by"`
+	ResolvedAt       *time.Time     `json:"resolved_at"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Order     *Order `gorm:"foreignKey:OrderID" json:"order,omitempty"`
 	Initiator *User  `gorm:"foreignKey:InitiatorUserID" json:"initiator,omitempty"`
@@ -165,6 +231,24 @@ func (DisputeRecord) TableName() string {
 	return "dispute_records"
 }
 
+// DisputeEvidence 纠纷证据与陈述，飞行轨迹与告警在发起纠纷时由系统自动附加
+type DisputeEvidence struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	DisputeID       int64     `gorm:"index;not null" json:"dispute_id"`
+	OrderID         int64     `gorm:"index;not null" json:"order_id"`
+	SubmitterUserID int64     `gorm:"index" json:"submitter_user_id"`                 // 0 表示系统
+	SubmitterRole   string    `gorm:"type:varchar(20)" json:"submitter_role"`         // client, owner, pilot, admin, system
+	EvidenceType    string    `gorm:"type:varchar(20);not null" json:"evidence_type"` // file, statement, counter_statement, flight_track, flight_alert
+	Content         string    `gorm:"type:text" json:"content"`
+	FileURL         string    `gorm:"type:varchar(500)" json:"file_url"`
+	Data            JSON      `gorm:"type:json" json:"data,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (DisputeEvidence) TableName() string {
+	return "dispute_evidences"
+}
+
 type Message struct {
 	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
 	ConversationID string     `gorm:"type:varchar(50);index;not null" json:"conversation_id"`
@@ -13,10 +13,10 @@ type Pilot struct {
 	CAACLicenseType       string         `gorm:"type:varchar(30)" json:"caac_license_type"` // VLOS(视距内), BVLOS(超视距), instructor(教员)
 	CAACLicenseExpireDate *time.Time     `json:"caac_license_expire_date"`
 	CAACLicenseImage      string         `gorm:"type:varchar(500)" json:"caac_license_image"`
-	CriminalCheckStatus   string         `gorm:"type:varchar(20);default:pending" json:"criminal_check_status"` // pending, approved, rejected
+	CriminalCheckStatus   string         `gorm:"type:varchar(20);default:pending" json:"criminal_check_status"` // pending, approved, rejected, expired
 	CriminalCheckDoc      string         `gorm:"type:varchar(500)" json:"criminal_check_doc"`
 	CriminalCheckExpire   *time.Time     `json:"criminal_check_expire"`                                       // 无犯罪记录有效期
-	HealthCheckStatus     string         `gorm:"type:varchar(20);default:pending" json:"health_check_status"` // pending, approved, rejected
+	HealthCheckStatus     string         `gorm:"type:varchar(20);default:pending" json:"health_check_status"` // pending, approved, rejected, expired
 	HealthCheckDoc        string         `gorm:"type:varchar(500)" json:"health_check_doc"`
 	HealthCheckExpire     *time.Time     `json:"health_check_expire"` // 健康证明有效期
 	TotalFlightHours      float64        `gorm:"type:decimal(10,2);default:0" json:"total_flight_hours"`
@@ -174,6 +174,148 @@ func (DroneMaintenanceLog) TableName() string {
 	return "drone_maintenance_logs"
 }
 
+// DroneUsageCounter 无人机累计使用量，由已结束的飞行记录累加
+type DroneUsageCounter struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	DroneID        int64      `gorm:"uniqueIndex;not null" json:"drone_id"`
+	FlightHours    float64    `gorm:"type:decimal(12,2);default:0" json:"flight_hours"`  // 累计飞行小时
+	Cycles         int        `gorm:"default:0" json:"cycles"`                           // 累计起降次数
+	PayloadHours   float64    `gorm:"type:decimal(14,2);default:0" json:"payload_hours"` // 累计载重小时(公斤·小时)
+	CriticalAlerts int        `gorm:"default:0" json:"critical_alerts"`                  // 累计紧急告警数
+	LastFlightAt   *time.Time `json:"last_flight_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (DroneUsageCounter) TableName() string {
+	return "drone_usage_counters"
+}
+
+// MaintenanceSchedule 按机型的部件维护计划，品牌和型号为空时作为通用计划
+type MaintenanceSchedule struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Brand         string    `gorm:"type:varchar(100);index:idx_maintenance_schedule_model" json:"brand"`
+	Model         string    `gorm:"type:varchar(100);index:idx_maintenance_schedule_model" json:"model"`
+	Component     string    `gorm:"type:varchar(50);not null" json:"component"` // propeller, motor, airframe, payload_mechanism, flight_controller, general
+	ComponentName string    `gorm:"type:varchar(100)" json:"component_name"`
+	Metric        string    `gorm:"type:varchar(30);not null" json:"metric"`        // flight_hours, cycles, payload_hours, critical_alerts, days
+	IntervalValue float64   `gorm:"type:decimal(12,2)" json:"interval_value"`       // 维护间隔
+	WarnBefore    float64   `gorm:"type:decimal(12,2)" json:"warn_before"`          // 距到期剩余该值时生成工单
+	HardLimit     float64   `gorm:"type:decimal(12,2);default:0" json:"hard_limit"` // 超过即停飞，0 表示不强制
+	Enabled       bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (MaintenanceSchedule) TableName() string {
+	return "maintenance_schedules"
+}
+
+// DroneComponentBaseline 部件上次维护时的累计使用量快照，维护后使用量从此处重新计算
+type DroneComponentBaseline struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	DroneID          int64      `gorm:"uniqueIndex:idx_drone_component;not null" json:"drone_id"`
+	Component        string     `gorm:"type:varchar(50);uniqueIndex:idx_drone_component;not null" json:"component"`
+	ServicedAt       *time.Time `json:"serviced_at"`
+	FlightHours      float64    `gorm:"type:decimal(12,2);default:0" json:"flight_hours"`
+	Cycles           int        `gorm:"default:0" json:"cycles"`
+	PayloadHours     float64    `gorm:"type:decimal(14,2);default:0" json:"payload_hours"`
+	CriticalAlerts   int        `gorm:"default:0" json:"critical_alerts"`
+	MaintenanceLogID int64      `gorm:"default:0" json:"maintenance_log_id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (DroneComponentBaseline) TableName() string {
+	return "drone_component_baselines"
+}
+
+// MaintenanceWorkOrder 维护工单，使用量接近或超过维护间隔时生成
+type MaintenanceWorkOrder struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	WorkOrderNo      string     `gorm:"type:varchar(30);uniqueIndex;not null" json:"work_order_no"`
+	DroneID          int64      `gorm:"index;not null" json:"drone_id"`
+	OwnerID          int64      `gorm:"index;not null" json:"owner_id"`
+	ScheduleID       int64      `json:"schedule_id"`
+	Component        string     `gorm:"type:varchar(50)" json:"component"`
+	ComponentName    string     `gorm:"type:varchar(100)" json:"component_name"`
+	Metric           string     `gorm:"type:varchar(30)" json:"metric"`
+	UsageValue       float64    `gorm:"type:decimal(12,2)" json:"usage_value"`    // 生成或最近升级时的使用量
+	IntervalValue    float64    `gorm:"type:decimal(12,2)" json:"interval_value"` // 维护间隔
+	HardLimit        float64    `gorm:"type:decimal(12,2)" json:"hard_limit"`
+	Level            string     `gorm:"type:varchar(20)" json:"level"`                     // due_soon, due, hard_limit
+	Status           string     `gorm:"type:varchar(20);default:open;index" json:"status"` // open, completed
+	Grounded         bool       `gorm:"default:false" json:"grounded"`                     // 是否已因超过强制上限停飞
+	MaintenanceLogID int64      `gorm:"default:0" json:"maintenance_log_id"`
+	CompletedAt      *time.Time `json:"completed_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Drone *Drone `gorm:"foreignKey:DroneID" json:"drone,omitempty"`
+}
+
+func (MaintenanceWorkOrder) TableName() string {
+	return "maintenance_work_orders"
+}
+
+// BatteryPack 电池包，按序列号登记并绑定到无人机，随飞行累计充放电循环与健康度
+type BatteryPack struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	OwnerID          int64      `gorm:"index;not null" json:"owner_id"`
+	DroneID          int64      `gorm:"index;default:0" json:"drone_id"` // 绑定的无人机，0 表示未绑定
+	SerialNumber     string     `gorm:"type:varchar(100);uniqueIndex;not null" json:"serial_number"`
+	Brand            string     `gorm:"type:varchar(100)" json:"brand"`
+	Model            string     `gorm:"type:varchar(100)" json:"model"`
+	Chemistry        string     `gorm:"type:varchar(20)" json:"chemistry"` // lipo, lihv, li_ion, solid_state
+	RatedCapacityMAH int        `json:"rated_capacity_mah"`                // 额定容量(mAh)
+	RatedVoltage     float64    `gorm:"type:decimal(6,2)" json:"rated_voltage"`
+	CellCount        int        `json:"cell_count"`
+	RatedCycles      int        `gorm:"default:0" json:"rated_cycles"`                       // 设计循环寿命，0 表示不按循环退役
+	CycleCount       float64    `gorm:"type:decimal(10,2);default:0" json:"cycle_count"`     // 等效满充放循环次数
+	FlightCount      int        `gorm:"default:0" json:"flight_count"`                       // 参与飞行次数
+	HealthPercent    float64    `gorm:"type:decimal(5,2);default:100" json:"health_percent"` // 按放电曲线估算的健康度
+	Status           string     `gorm:"type:varchar(20);default:active;index" json:"status"` // active, retired
+	RetireReason     string     `gorm:"type:varchar(255)" json:"retire_reason"`
+	RetiredAt        *time.Time `json:"retired_at"`
+	LastFlightAt     *time.Time `json:"last_flight_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Drone *Drone `gorm:"foreignKey:DroneID" json:"drone,omitempty"`
+}
+
+func (BatteryPack) TableName() string {
+	return "battery_packs"
+}
+
+// BatteryFlightLog 电池包在某个订单飞行中的使用记录，飞前检查时创建，飞行结束后回填放电数据
+type BatteryFlightLog struct {
+	ID              int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	BatteryPackID   int64      `gorm:"uniqueIndex:idx_battery_order;not null" json:"battery_pack_id"`
+	OrderID         int64      `gorm:"uniqueIndex:idx_battery_order;index;not null" json:"order_id"`
+	DroneID         int64      `gorm:"index" json:"drone_id"`
+	FlightRecordID  int64      `gorm:"default:0" json:"flight_record_id"`
+	Sequence        int        `gorm:"default:1" json:"sequence"` // 第几组电池，中途换电后递增
+	CheckedBy       int64      `json:"checked_by"`                // 执行飞前检查的用户
+	CheckedAt       time.Time  `json:"checked_at"`
+	HealthAtCheck   float64    `gorm:"type:decimal(5,2)" json:"health_at_check"`
+	StartLevel      int        `json:"start_level"`                                          // 起始电量(%)
+	EndLevel        int        `json:"end_level"`                                            // 结束电量(%)
+	DischargeRate   float64    `gorm:"type:decimal(8,3)" json:"discharge_rate"`              // 放电速率(%/分钟)
+	DurationSeconds int        `json:"duration_seconds"`                                     // 该组电池供电时长
+	CycleIncrement  float64    `gorm:"type:decimal(6,3)" json:"cycle_increment"`             // 本次计入的等效循环
+	HealthSample    float64    `gorm:"type:decimal(5,2)" json:"health_sample"`               // 本次放电曲线估算的健康度，0 表示数据不足
+	HealthAfter     float64    `gorm:"type:decimal(5,2)" json:"health_after"`                // 平滑后的健康度
+	Status          string     `gorm:"type:varchar(20);default:checked;index" json:"status"` // checked(已飞前检查), recorded(已回填)
+	RecordedAt      *time.Time `json:"recorded_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (BatteryFlightLog) TableName() string {
+	return "battery_flight_logs"
+}
+
 // DroneInsuranceRecord 无人机保险记录
 type DroneInsuranceRecord struct {
 	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -199,6 +341,23 @@ func (DroneInsuranceRecord) TableName() string {
 	return "drone_insurance_records"
 }
 
+// CredentialExpiryNotice 证照到期提醒记录，同一证照同一到期日的每个提醒档位只发送一次
+type CredentialExpiryNotice struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	SubjectType    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_credential_notice" json:"subject_type"` // pilot, drone
+	SubjectID      int64     `gorm:"not null;uniqueIndex:idx_credential_notice" json:"subject_id"`
+	CredentialType string    `gorm:"type:varchar(30);not null;uniqueIndex:idx_credential_notice" json:"credential_type"` // caac_license, criminal_check, health_check, certification, insurance, airworthiness, maintenance
+	CredentialID   int64     `gorm:"default:0;uniqueIndex:idx_credential_notice" json:"credential_id"`                   // 资质证书ID，其余证照为0
+	ExpireDate     time.Time `gorm:"uniqueIndex:idx_credential_notice" json:"expire_date"`
+	Stage          int       `gorm:"uniqueIndex:idx_credential_notice" json:"stage"` // 提前提醒天数(30/7/1)，0 表示已过期处理
+	UserID         int64     `gorm:"index" json:"user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (CredentialExpiryNotice) TableName() string {
+	return "credential_expiry_notices"
+}
+
 // ==================== 业主/客户相关模型 ====================
 
 // Client 业主档案 - 整合renter和cargo_owner角色
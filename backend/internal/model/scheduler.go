@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// JobRun 定时任务执行记录
+type JobRun struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	JobName        string     `gorm:"type:varchar(64);index;not null" json:"job_name"`
+	TriggerType    string     `gorm:"type:varchar(20);default:schedule" json:"trigger_type"` // schedule, manual
+	TriggeredBy    int64      `json:"triggered_by"`                                          // 手动触发的管理员ID
+	Instance       string     `gorm:"type:varchar(100)" json:"instance"`                     // 执行实例(hostname:pid)
+	Status         string     `gorm:"type:varchar(20);index;default:running" json:"status"`  // running, succeeded, failed
+	StartedAt      time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	DurationMs     int64      `json:"duration_ms"`
+	ItemsProcessed int        `json:"items_processed"`
+	ErrorMessage   string     `gorm:"type:text" json:"error_message"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (JobRun) TableName() string {
+	return "job_runs"
+}
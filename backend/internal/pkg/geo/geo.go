@@ -0,0 +1,354 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// EarthRadiusMeters 地球平均半径(米)
+const EarthRadiusMeters = 6371000.0
+
+// Point 经纬度坐标(WGS84/GCJ02 由调用方保证一致)
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// HaversineMeters 计算两点间大圆距离(米)
+func HaversineMeters(a, b Point) float64 {
+	dLat := toRad(b.Lat - a.Lat)
+	dLng := toRad(b.Lng - a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(a.Lat))*math.Cos(toRad(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusMeters * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// Shape 平面区域
+type Shape interface {
+	// Contains 判断点是否在区域内(含边界)
+	Contains(p Point) bool
+	// BoundaryDistance 点到区域边界的最短距离(米)，与点在内外无关
+	BoundaryDistance(p Point) float64
+	// IntersectsSegment 判断线段 a-b 是否穿过或进入区域
+	IntersectsSegment(a, b Point) bool
+	// Outline 返回包住区域且与其保持至少 margin 米间距的凸多边形顶点，用于绕飞规划
+	Outline(margin float64) []Point
+}
+
+// Circle 圆形区域
+type Circle struct {
+	Center Point
+	Radius float64 // 半径(米)
+}
+
+func (c Circle) Contains(p Point) bool {
+	return HaversineMeters(c.Center, p) <= c.Radius
+}
+
+func (c Circle) BoundaryDistance(p Point) float64 {
+	return math.Abs(HaversineMeters(c.Center, p) - c.Radius)
+}
+
+// Polygon 多边形区域，支持内部空洞
+// 顶点顺序不限，首尾无需重复
+type Polygon struct {
+	Outer []Point
+	Holes [][]Point
+}
+
+// Contains 射线法判断点是否在多边形内，落在空洞内的点视为不在区域内
+func (pg Polygon) Contains(p Point) bool {
+	if !ringContains(pg.Outer, p) {
+		return false
+	}
+	for _, hole := range pg.Holes {
+		// 空洞边界上的点仍属于区域
+		if ringContains(hole, p) && ringDistance(hole, p) > boundaryEpsilonMeters {
+			return false
+		}
+	}
+	return true
+}
+
+func (pg Polygon) BoundaryDistance(p Point) float64 {
+	d := ringDistance(pg.Outer, p)
+	for _, hole := range pg.Holes {
+		if hd := ringDistance(hole, p); hd < d {
+			d = hd
+		}
+	}
+	return d
+}
+
+// AltitudeBand 高度区间(米)，Max<=0 表示无上限
+type AltitudeBand struct {
+	Min int
+	Max int
+}
+
+func (b AltitudeBand) Contains(alt int) bool {
+	if alt < b.Min {
+		return false
+	}
+	return b.Max <= 0 || alt <= b.Max
+}
+
+// Zone 带高度区间的空域
+type Zone struct {
+	Shape Shape
+	Band  AltitudeBand
+}
+
+// Contains 判断三维位置是否在空域内
+func (z Zone) Contains(p Point, alt int) bool {
+	return z.Band.Contains(alt) && z.Shape.Contains(p)
+}
+
+// Distance 点到空域的水平距离(米)，位于区域内时为0
+func (z Zone) Distance(p Point) float64 {
+	if z.Shape.Contains(p) {
+		return 0
+	}
+	return z.Shape.BoundaryDistance(p)
+}
+
+// boundaryEpsilonMeters 判定点落在边界上的容差
+const boundaryEpsilonMeters = 0.01
+
+func ringContains(ring []Point, p Point) bool {
+	n := len(ring)
+	if n < 3 {
+		return false
+	}
+	inside := false
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) {
+			x := (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat) + a.Lng
+			if p.Lng < x {
+				inside = !inside
+			}
+		}
+	}
+	if inside {
+		return true
+	}
+	// 射线法对边界上的点结果不确定，边界视为在内
+	return ringDistance(ring, p) <= boundaryEpsilonMeters
+}
+
+// ringDistance 以 p 为原点做等距投影，求 p 到环上各边的最短距离
+// 围栏尺度(几十公里内)下误差可忽略
+func ringDistance(ring []Point, p Point) float64 {
+	n := len(ring)
+	if n == 0 {
+		return math.Inf(1)
+	}
+	cosLat := math.Cos(toRad(p.Lat))
+	project := func(q Point) (float64, float64) {
+		return toRad(q.Lng-p.Lng) * cosLat * EarthRadiusMeters, toRad(q.Lat-p.Lat) * EarthRadiusMeters
+	}
+	best := math.Inf(1)
+	for i := 0; i < n; i++ {
+		ax, ay := project(ring[i])
+		bx, by := project(ring[(i+1)%n])
+		if d := originSegmentDistance(ax, ay, bx, by); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func originSegmentDistance(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lenSq := dx*dx + dy*dy
+	t := 0.0
+	if lenSq > 0 {
+		t = -(ax*dx + ay*dy) / lenSq
+		t = math.Max(0, math.Min(1, t))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+func toRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// ==================== 坐标解析 ====================
+
+// ErrInvalidPolygon 多边形坐标无法解析或顶点不足
+var ErrInvalidPolygon = errors.New("invalid polygon coordinates")
+
+// ParsePolygon 解析围栏/禁飞区的 Coordinates 字段，兼容以下格式:
+//
+//	[{"lat":..,"lng":..}, ...]                   // 也接受 latitude/longitude
+//	[[lng,lat], ...]                             // GeoJSON / 高德顺序
+//	[[[lng,lat], ...], [[lng,lat], ...]]         // 首环为外环，其余为空洞
+//	{"outer":[...], "holes":[[...], ...]}
+//	{"type":"Polygon", "coordinates":[[[lng,lat], ...]]}
+func ParsePolygon(raw []byte) (Polygon, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return Polygon{}, fmt.Errorf("%w: %v", ErrInvalidPolygon, err)
+	}
+
+	var rings [][]Point
+	var err error
+	switch t := v.(type) {
+	case []interface{}:
+		rings, err = parseRings(t)
+	case map[string]interface{}:
+		switch {
+		case t["coordinates"] != nil:
+			list, ok := t["coordinates"].([]interface{})
+			if !ok {
+				return Polygon{}, fmt.Errorf("%w: coordinates must be an array", ErrInvalidPolygon)
+			}
+			rings, err = parseRings(list)
+		case t["outer"] != nil:
+			outer, ok := t["outer"].([]interface{})
+			if !ok {
+				return Polygon{}, fmt.Errorf("%w: outer must be an array", ErrInvalidPolygon)
+			}
+			ring, perr := parseRing(outer)
+			if perr != nil {
+				return Polygon{}, perr
+			}
+			rings = append(rings, ring)
+			if holes, ok := t["holes"].([]interface{}); ok {
+				for _, h := range holes {
+					list, ok := h.([]interface{})
+					if !ok {
+						return Polygon{}, fmt.Errorf("%w: hole must be an array", ErrInvalidPolygon)
+					}
+					ring, perr := parseRing(list)
+					if perr != nil {
+						return Polygon{}, perr
+					}
+					rings = append(rings, ring)
+				}
+			}
+		default:
+			return Polygon{}, fmt.Errorf("%w: unsupported object", ErrInvalidPolygon)
+		}
+	default:
+		return Polygon{}, fmt.Errorf("%w: unsupported value", ErrInvalidPolygon)
+	}
+	if err != nil {
+		return Polygon{}, err
+	}
+	if len(rings) == 0 {
+		return Polygon{}, fmt.Errorf("%w: empty", ErrInvalidPolygon)
+	}
+	return Polygon{Outer: rings[0], Holes: rings[1:]}, nil
+}
+
+// ParsePath 解析航线航点，支持 [{"lat","lng"}] 与 [[lng,lat]] 两种格式
+func ParsePath(raw []byte) ([]Point, error) {
+	var list []interface{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("invalid path: %v", err)
+	}
+	path := make([]Point, 0, len(list))
+	for i, item := range list {
+		p, err := parsePoint(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path vertex %d: %v", i, err)
+		}
+		path = append(path, p)
+	}
+	if len(path) == 0 {
+		return nil, errors.New("invalid path: empty")
+	}
+	return path, nil
+}
+
+// parseRings 区分单环与多环数组
+func parseRings(list []interface{}) ([][]Point, error) {
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidPolygon)
+	}
+	if first, ok := list[0].([]interface{}); ok && len(first) > 0 {
+		if _, nested := first[0].([]interface{}); nested {
+			rings := make([][]Point, 0, len(list))
+			for _, item := range list {
+				sub, ok := item.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%w: ring must be an array", ErrInvalidPolygon)
+				}
+				ring, err := parseRing(sub)
+				if err != nil {
+					return nil, err
+				}
+				rings = append(rings, ring)
+			}
+			return rings, nil
+		}
+	}
+	ring, err := parseRing(list)
+	if err != nil {
+		return nil, err
+	}
+	return [][]Point{ring}, nil
+}
+
+func parseRing(list []interface{}) ([]Point, error) {
+	ring := make([]Point, 0, len(list))
+	for i, item := range list {
+		p, err := parsePoint(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: vertex %d: %v", ErrInvalidPolygon, i, err)
+		}
+		ring = append(ring, p)
+	}
+	// 闭合环去掉重复的末尾顶点
+	if n := len(ring); n > 1 && ring[0] == ring[n-1] {
+		ring = ring[:n-1]
+	}
+	if len(ring) < 3 {
+		return nil, fmt.Errorf("%w: ring needs at least 3 vertices", ErrInvalidPolygon)
+	}
+	return ring, nil
+}
+
+func parsePoint(item interface{}) (Point, error) {
+	switch v := item.(type) {
+	case []interface{}:
+		if len(v) < 2 {
+			return Point{}, errors.New("coordinate pair needs [lng, lat]")
+		}
+		lng, ok1 := v[0].(float64)
+		lat, ok2 := v[1].(float64)
+		if !ok1 || !ok2 {
+			return Point{}, errors.New("coordinate must be numeric")
+		}
+		return validPoint(lat, lng)
+	case map[string]interface{}:
+		lat, okLat := firstNumber(v, "lat", "latitude")
+		lng, okLng := firstNumber(v, "lng", "lon", "longitude")
+		if !okLat || !okLng {
+			return Point{}, errors.New("vertex needs lat/lng")
+		}
+		return validPoint(lat, lng)
+	default:
+		return Point{}, errors.New("unsupported vertex")
+	}
+}
+
+func firstNumber(m map[string]interface{}, keys ...string) (float64, bool) {
+	for _, k := range keys {
+		if f, ok := m[k].(float64); ok {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+func validPoint(lat, lng float64) (Point, error) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return Point{}, fmt.Errorf("coordinate out of range (lat=%v, lng=%v)", lat, lng)
+	}
+	return Point{Lat: lat, Lng: lng}, nil
+}
@@ -0,0 +1,206 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// 约 1km x 1km 的方形区域，中间挖去约 200m x 200m 的空洞
+var squareWithHole = Polygon{
+	Outer: []Point{{Lat: 23.000, Lng: 113.000}, {Lat: 23.000, Lng: 113.010}, {Lat: 23.009, Lng: 113.010}, {Lat: 23.009, Lng: 113.000}},
+	Holes: [][]Point{{{Lat: 23.004, Lng: 113.004}, {Lat: 23.004, Lng: 113.006}, {Lat: 23.006, Lng: 113.006}, {Lat: 23.006, Lng: 113.004}}},
+}
+
+func TestPolygonContainsRespectsHoles(t *testing.T) {
+	cases := []struct {
+		name string
+		p    Point
+		want bool
+	}{
+		{"inside", Point{Lat: 23.002, Lng: 113.002}, true},
+		{"in hole", Point{Lat: 23.005, Lng: 113.005}, false},
+		{"on outer edge", Point{Lat: 23.000, Lng: 113.005}, true},
+		{"on hole edge", Point{Lat: 23.004, Lng: 113.005}, true},
+		{"outside", Point{Lat: 23.012, Lng: 113.005}, false},
+	}
+	for _, tc := range cases {
+		if got := squareWithHole.Contains(tc.p); got != tc.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tc.name, tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestPolygonContainsConcave(t *testing.T) {
+	// U 形多边形，缺口处不属于区域
+	u := Polygon{Outer: []Point{
+		{Lat: 0, Lng: 0}, {Lat: 0, Lng: 3}, {Lat: 3, Lng: 3}, {Lat: 3, Lng: 2},
+		{Lat: 1, Lng: 2}, {Lat: 1, Lng: 1}, {Lat: 3, Lng: 1}, {Lat: 3, Lng: 0},
+	}}
+	if u.Contains(Point{Lat: 2, Lng: 1.5}) {
+		t.Fatal("point in the notch should be outside")
+	}
+	if !u.Contains(Point{Lat: 2, Lng: 0.5}) {
+		t.Fatal("point in the left arm should be inside")
+	}
+}
+
+func TestBoundaryDistance(t *testing.T) {
+	// 北边界纬度 23.009，向北 0.001 度约 111 米
+	d := squareWithHole.BoundaryDistance(Point{Lat: 23.010, Lng: 113.005})
+	if math.Abs(d-111.2) > 1 {
+		t.Fatalf("expected ~111m to the northern edge, got %.2f", d)
+	}
+
+	// 位于区域内时到最近边界(空洞)的距离
+	d = squareWithHole.BoundaryDistance(Point{Lat: 23.003, Lng: 113.005})
+	if math.Abs(d-111.2) > 1 {
+		t.Fatalf("expected ~111m to the hole edge, got %.2f", d)
+	}
+
+	c := Circle{Center: Point{Lat: 23, Lng: 113}, Radius: 500}
+	d = c.BoundaryDistance(Point{Lat: 23.009, Lng: 113})
+	if math.Abs(d-500.8) > 1 {
+		t.Fatalf("expected ~500m outside circle, got %.2f", d)
+	}
+}
+
+func TestZoneAltitudeBand(t *testing.T) {
+	zone := Zone{Shape: squareWithHole, Band: AltitudeBand{Min: 50, Max: 120}}
+	p := Point{Lat: 23.002, Lng: 113.002}
+	if zone.Contains(p, 30) || zone.Contains(p, 150) {
+		t.Fatal("altitude outside band should not be contained")
+	}
+	if !zone.Contains(p, 100) {
+		t.Fatal("altitude within band should be contained")
+	}
+
+	unlimited := Zone{Shape: squareWithHole, Band: AltitudeBand{}}
+	if !unlimited.Contains(p, 5000) {
+		t.Fatal("Max=0 should mean no ceiling")
+	}
+	if unlimited.Distance(p) != 0 {
+		t.Fatal("distance inside zone should be 0")
+	}
+}
+
+func TestParsePolygonFormats(t *testing.T) {
+	inputs := map[string]string{
+		"lat/lng objects":   `[{"lat":23.0,"lng":113.0},{"lat":23.0,"lng":113.01},{"lat":23.009,"lng":113.01},{"lat":23.009,"lng":113.0}]`,
+		"latitude keys":     `[{"latitude":23.0,"longitude":113.0},{"latitude":23.0,"longitude":113.01},{"latitude":23.009,"longitude":113.01},{"latitude":23.009,"longitude":113.0}]`,
+		"lng,lat pairs":     `[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009],[113.0,23.0]]`,
+		"geojson":           `{"type":"Polygon","coordinates":[[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009],[113.0,23.0]],[[113.004,23.004],[113.006,23.004],[113.006,23.006],[113.004,23.006]]]}`,
+		"outer/holes":       `{"outer":[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009]],"holes":[[{"lat":23.004,"lng":113.004},{"lat":23.004,"lng":113.006},{"lat":23.006,"lng":113.006},{"lat":23.006,"lng":113.004}]]}`,
+		"multi-ring arrays": `[[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009]],[[113.004,23.004],[113.006,23.004],[113.006,23.006],[113.004,23.006]]]`,
+	}
+	for name, raw := range inputs {
+		pg, err := ParsePolygon([]byte(raw))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(pg.Outer) != 4 {
+			t.Fatalf("%s: expected 4 outer vertices (closing vertex dropped), got %d", name, len(pg.Outer))
+		}
+		if !pg.Contains(Point{Lat: 23.002, Lng: 113.002}) {
+			t.Fatalf("%s: expected point inside", name)
+		}
+	}
+}
+
+func TestParsePolygonRejectsInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`null`,
+		`[]`,
+		`[{"lat":23,"lng":113},{"lat":23.1,"lng":113}]`,
+		`[[113,95],[113.1,23],[113,23.1]]`,
+		`{"foo":1}`,
+		`not json`,
+	} {
+		if _, err := ParsePolygon([]byte(raw)); !errors.Is(err, ErrInvalidPolygon) {
+			t.Fatalf("%s: expected ErrInvalidPolygon, got %v", raw, err)
+		}
+	}
+}
+
+func TestSegmentIntersection(t *testing.T) {
+	// 自西向东穿过方形区域
+	if !squareWithHole.IntersectsSegment(Point{Lat: 23.002, Lng: 112.99}, Point{Lat: 23.002, Lng: 113.02}) {
+		t.Fatal("segment crossing the polygon should intersect")
+	}
+	// 从南侧经过
+	if squareWithHole.IntersectsSegment(Point{Lat: 22.99, Lng: 112.99}, Point{Lat: 22.99, Lng: 113.02}) {
+		t.Fatal("segment passing south of the polygon should not intersect")
+	}
+	// 完全位于空洞内
+	if squareWithHole.IntersectsSegment(Point{Lat: 23.0045, Lng: 113.0045}, Point{Lat: 23.0055, Lng: 113.0055}) {
+		t.Fatal("segment inside the hole should not intersect")
+	}
+
+	c := Circle{Center: Point{Lat: 23, Lng: 113}, Radius: 500}
+	if !c.IntersectsSegment(Point{Lat: 23, Lng: 112.99}, Point{Lat: 23, Lng: 113.01}) {
+		t.Fatal("segment through circle center should intersect")
+	}
+	if c.IntersectsSegment(Point{Lat: 23.01, Lng: 112.99}, Point{Lat: 23.01, Lng: 113.01}) {
+		t.Fatal("segment ~1.1km north of the circle should not intersect")
+	}
+}
+
+func TestDetourAvoidsObstacles(t *testing.T) {
+	start := Point{Lat: 23.0045, Lng: 112.98}
+	end := Point{Lat: 23.0045, Lng: 113.03}
+	circle := Circle{Center: Point{Lat: 23.0045, Lng: 113.020}, Radius: 300}
+	obstacles := []Shape{squareWithHole, circle}
+
+	detour, ok := Detour([]Point{start, end}, obstacles, 50)
+	if !ok {
+		t.Fatal("expected a detour to be found")
+	}
+	if detour[0] != start || detour[len(detour)-1] != end {
+		t.Fatalf("detour must keep start and end, got %v", detour)
+	}
+	for _, o := range obstacles {
+		if PathIntersects(o, detour) {
+			t.Fatalf("detour still intersects obstacle: %v", detour)
+		}
+	}
+	direct := HaversineMeters(start, end)
+	if l := PathLength(detour); l <= direct || l > direct*2 {
+		t.Fatalf("unexpected detour length %.0f (direct %.0f)", l, direct)
+	}
+
+	// 结果稳定可复现
+	again, _ := Detour([]Point{start, end}, obstacles, 50)
+	if len(again) != len(detour) {
+		t.Fatal("detour should be deterministic")
+	}
+}
+
+func TestDetourFailsWhenWaypointInsideObstacle(t *testing.T) {
+	if _, ok := Detour([]Point{{Lat: 23.002, Lng: 113.002}, {Lat: 23.02, Lng: 113.02}}, []Shape{squareWithHole}, 50); ok {
+		t.Fatal("detour should fail when a waypoint is inside an obstacle")
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	path, err := ParsePath([]byte(`[{"seq":1,"lat":23.1,"lng":113.2,"alt":80},{"seq":2,"lat":23.2,"lng":113.3,"alt":90}]`))
+	if err != nil || len(path) != 2 || path[1] != (Point{Lat: 23.2, Lng: 113.3}) {
+		t.Fatalf("unexpected path %v, err %v", path, err)
+	}
+	if _, err := ParsePath([]byte(`[]`)); err == nil {
+		t.Fatal("empty path should be rejected")
+	}
+}
+
+func TestHexCellGroupsNearbyPoints(t *testing.T) {
+	center := Point{Lat: 23.1291, Lng: 113.2644}
+	cell := HexCell(center, 3000)
+	if HexCell(Point{Lat: 23.1295, Lng: 113.2650}, 3000) != cell {
+		t.Fatal("expected points 70m apart to share a cell")
+	}
+	if HexCell(Point{Lat: 23.2291, Lng: 113.2644}, 3000) == cell {
+		t.Fatal("expected points 11km apart to fall in different cells")
+	}
+	if HexCell(center, 1000) == cell {
+		t.Fatal("expected cell ids to include the grid size")
+	}
+}
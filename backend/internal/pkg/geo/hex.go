@@ -0,0 +1,38 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// HexCell 返回点所在六边形网格的编号，供按区域聚合实时信号(作用等同 H3 单元)。
+// 网格在 Web 墨卡托投影上按尖顶六边形划分，edgeMeters 为赤道处边长，
+// 中纬度地区实际边长约为 edgeMeters*cos(纬度)，同一 edgeMeters 下编号全局一致
+func HexCell(p Point, edgeMeters float64) string {
+	if edgeMeters <= 0 {
+		edgeMeters = 1000
+	}
+	x, y := mercator(p)
+	q := (math.Sqrt(3)/3*x - y/3) / edgeMeters
+	r := (2.0 / 3 * y) / edgeMeters
+	cq, cr := hexRound(q, r)
+	return fmt.Sprintf("hx%d:%d:%d", int64(edgeMeters), cq, cr)
+}
+
+func mercator(p Point) (float64, float64) {
+	lat := math.Max(math.Min(p.Lat, 85), -85)
+	return toRad(p.Lng) * EarthRadiusMeters, math.Log(math.Tan(math.Pi/4+toRad(lat)/2)) * EarthRadiusMeters
+}
+
+// hexRound 轴向坐标取整到最近的六边形中心
+func hexRound(q, r float64) (int64, int64) {
+	s := -q - r
+	rq, rr, rs := math.Round(q), math.Round(r), math.Round(s)
+	dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs-s)
+	if dq > dr && dq > ds {
+		rq = -rr - rs
+	} else if dr > ds {
+		rr = -rq - rs
+	}
+	return int64(rq), int64(rr)
+}
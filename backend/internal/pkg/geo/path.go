@@ -0,0 +1,299 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// plane 以 origin 为原点的局部等距投影(米)
+type plane struct {
+	origin Point
+	cosLat float64
+}
+
+func newPlane(origin Point) plane {
+	return plane{origin: origin, cosLat: math.Cos(toRad(origin.Lat))}
+}
+
+func (pl plane) project(p Point) (float64, float64) {
+	return toRad(p.Lng-pl.origin.Lng) * pl.cosLat * EarthRadiusMeters, toRad(p.Lat-pl.origin.Lat) * EarthRadiusMeters
+}
+
+func (pl plane) unproject(x, y float64) Point {
+	return Point{
+		Lat: pl.origin.Lat + y/EarthRadiusMeters*180/math.Pi,
+		Lng: pl.origin.Lng + x/(EarthRadiusMeters*pl.cosLat)*180/math.Pi,
+	}
+}
+
+// PathLength 折线总长度(米)
+func PathLength(path []Point) float64 {
+	total := 0.0
+	for i := 1; i < len(path); i++ {
+		total += HaversineMeters(path[i-1], path[i])
+	}
+	return total
+}
+
+// PathIntersects 判断折线是否穿过或进入区域
+func PathIntersects(shape Shape, path []Point) bool {
+	if len(path) == 1 {
+		return shape.Contains(path[0])
+	}
+	for i := 1; i < len(path); i++ {
+		if shape.IntersectsSegment(path[i-1], path[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Circle) IntersectsSegment(a, b Point) bool {
+	return segmentPointDistance(a, b, c.Center) <= c.Radius
+}
+
+// Outline 圆的外切正多边形，外扩 margin 米
+func (c Circle) Outline(margin float64) []Point {
+	const sides = 16
+	r := (c.Radius + margin) / math.Cos(math.Pi/sides)
+	pl := newPlane(c.Center)
+	out := make([]Point, sides)
+	for i := 0; i < sides; i++ {
+		theta := 2 * math.Pi * float64(i) / sides
+		out[i] = pl.unproject(r*math.Cos(theta), r*math.Sin(theta))
+	}
+	return out
+}
+
+func (pg Polygon) IntersectsSegment(a, b Point) bool {
+	if pg.Contains(a) || pg.Contains(b) {
+		return true
+	}
+	pl := newPlane(a)
+	ax, ay := pl.project(a)
+	bx, by := pl.project(b)
+	rings := append([][]Point{pg.Outer}, pg.Holes...)
+	for _, ring := range rings {
+		n := len(ring)
+		for i := 0; i < n; i++ {
+			cx, cy := pl.project(ring[i])
+			dx, dy := pl.project(ring[(i+1)%n])
+			if segmentsIntersect(ax, ay, bx, by, cx, cy, dx, dy) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Outline 外环凸包，各顶点沿质心方向外扩 margin 米
+func (pg Polygon) Outline(margin float64) []Point {
+	if len(pg.Outer) == 0 {
+		return nil
+	}
+	pl := newPlane(pg.Outer[0])
+	pts := make([][2]float64, len(pg.Outer))
+	for i, p := range pg.Outer {
+		x, y := pl.project(p)
+		pts[i] = [2]float64{x, y}
+	}
+	hull := convexHull(pts)
+
+	var cx, cy float64
+	for _, p := range hull {
+		cx += p[0]
+		cy += p[1]
+	}
+	cx /= float64(len(hull))
+	cy /= float64(len(hull))
+
+	out := make([]Point, len(hull))
+	for i, p := range hull {
+		dx, dy := p[0]-cx, p[1]-cy
+		l := math.Hypot(dx, dy)
+		x, y := p[0], p[1]
+		if l > 0 {
+			x += dx / l * margin
+			y += dy / l * margin
+		}
+		out[i] = pl.unproject(x, y)
+	}
+	return out
+}
+
+// Detour 为折线规划绕开 obstacles 的路径，margin 为绕飞时与区域保持的间距(米)
+// 仅替换与障碍相交的航段，起终点及中间航点保持不变；
+// 航点位于障碍内或无法找到可行路径时返回 false
+func Detour(path []Point, obstacles []Shape, margin float64) ([]Point, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+	for _, p := range path {
+		for _, o := range obstacles {
+			if o.Contains(p) {
+				return nil, false
+			}
+		}
+	}
+
+	var nodes []Point
+	for _, o := range obstacles {
+		for _, v := range o.Outline(margin) {
+			if !insideAny(obstacles, v) {
+				nodes = append(nodes, v)
+			}
+		}
+	}
+
+	result := []Point{path[0]}
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		if segmentClear(obstacles, a, b) {
+			result = append(result, b)
+			continue
+		}
+		leg, ok := shortestVisiblePath(a, b, nodes, obstacles)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, leg[1:]...)
+	}
+	return result, true
+}
+
+// shortestVisiblePath 在可视图上用 Dijkstra 求 a 到 b 的最短路径
+func shortestVisiblePath(a, b Point, nodes []Point, obstacles []Shape) ([]Point, bool) {
+	all := make([]Point, 0, len(nodes)+2)
+	all = append(all, a)
+	all = append(all, nodes...)
+	all = append(all, b)
+	n := len(all)
+	target := n - 1
+
+	dist := make([]float64, n)
+	prev := make([]int, n)
+	done := make([]bool, n)
+	for i := range dist {
+		dist[i] = math.Inf(1)
+		prev[i] = -1
+	}
+	dist[0] = 0
+
+	for {
+		u := -1
+		for i := 0; i < n; i++ {
+			if !done[i] && !math.IsInf(dist[i], 1) && (u == -1 || dist[i] < dist[u]) {
+				u = i
+			}
+		}
+		if u == -1 {
+			return nil, false
+		}
+		if u == target {
+			break
+		}
+		done[u] = true
+		for v := 0; v < n; v++ {
+			if done[v] || v == u {
+				continue
+			}
+			w := HaversineMeters(all[u], all[v])
+			if dist[u]+w >= dist[v] {
+				continue
+			}
+			if !segmentClear(obstacles, all[u], all[v]) {
+				continue
+			}
+			dist[v] = dist[u] + w
+			prev[v] = u
+		}
+	}
+
+	var rev []Point
+	for at := target; at != -1; at = prev[at] {
+		rev = append(rev, all[at])
+	}
+	out := make([]Point, len(rev))
+	for i := range rev {
+		out[i] = rev[len(rev)-1-i]
+	}
+	return out, true
+}
+
+func segmentClear(obstacles []Shape, a, b Point) bool {
+	for _, o := range obstacles {
+		if o.IntersectsSegment(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+func insideAny(obstacles []Shape, p Point) bool {
+	for _, o := range obstacles {
+		if o.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentPointDistance 点 p 到线段 a-b 的距离(米)
+func segmentPointDistance(a, b, p Point) float64 {
+	pl := newPlane(p)
+	ax, ay := pl.project(a)
+	bx, by := pl.project(b)
+	return originSegmentDistance(ax, ay, bx, by)
+}
+
+func segmentsIntersect(ax, ay, bx, by, cx, cy, dx, dy float64) bool {
+	d1 := cross(cx, cy, dx, dy, ax, ay)
+	d2 := cross(cx, cy, dx, dy, bx, by)
+	d3 := cross(ax, ay, bx, by, cx, cy)
+	d4 := cross(ax, ay, bx, by, dx, dy)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(cx, cy, dx, dy, ax, ay)) ||
+		(d2 == 0 && onSegment(cx, cy, dx, dy, bx, by)) ||
+		(d3 == 0 && onSegment(ax, ay, bx, by, cx, cy)) ||
+		(d4 == 0 && onSegment(ax, ay, bx, by, dx, dy))
+}
+
+// cross 向量 (b-a) x (p-a)
+func cross(ax, ay, bx, by, px, py float64) float64 {
+	return (bx-ax)*(py-ay) - (by-ay)*(px-ax)
+}
+
+func onSegment(ax, ay, bx, by, px, py float64) bool {
+	return math.Min(ax, bx) <= px && px <= math.Max(ax, bx) && math.Min(ay, by) <= py && py <= math.Max(ay, by)
+}
+
+// convexHull Andrew 单调链算法，返回逆时针凸包
+func convexHull(pts [][2]float64) [][2]float64 {
+	sorted := append([][2]float64(nil), pts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+	if len(sorted) < 3 {
+		return sorted
+	}
+	var hull [][2]float64
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, p := range sorted {
+			for len(hull) >= start+2 && cross(hull[len(hull)-2][0], hull[len(hull)-2][1], hull[len(hull)-1][0], hull[len(hull)-1][1], p[0], p[1]) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, p)
+		}
+		hull = hull[:len(hull)-1]
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+	return hull
+}
@@ -0,0 +1,178 @@
+// Package mavlink 实现遥测接入所需的 MAVLink v1/v2 帧解析与常用消息解码
+package mavlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	MagicV1 = 0xFE
+	MagicV2 = 0xFD
+
+	headerLenV1    = 6 // STX LEN SEQ SYS COMP MSGID
+	headerLenV2    = 10
+	checksumLen    = 2
+	signatureLen   = 13
+	flagSigned     = 0x01
+	maxPayloadSize = 255
+)
+
+var (
+	ErrUnknownMessage = errors.New("mavlink: unknown message")
+	ErrBadChecksum    = errors.New("mavlink: bad checksum")
+	ErrTruncated      = errors.New("mavlink: truncated frame")
+)
+
+// Frame 一帧 MAVLink 消息
+type Frame struct {
+	Version     int // 1 或 2
+	Sequence    uint8
+	SystemID    uint8
+	ComponentID uint8
+	MessageID   uint32
+	Payload     []byte
+}
+
+// FrameLen 根据帧头计算完整帧长度，数据不足以判断时返回 0
+func FrameLen(buf []byte) int {
+	if len(buf) < 3 {
+		return 0
+	}
+	switch buf[0] {
+	case MagicV1:
+		return headerLenV1 + int(buf[1]) + checksumLen
+	case MagicV2:
+		n := headerLenV2 + int(buf[1]) + checksumLen
+		if buf[2]&flagSigned != 0 {
+			n += signatureLen
+		}
+		return n
+	}
+	return 0
+}
+
+// ParseFrame 解析一帧并校验 CRC，返回帧及消耗的字节数
+// 未知消息ID无法校验 CRC，返回 ErrUnknownMessage 以便调用方跳过整帧
+func ParseFrame(buf []byte) (*Frame, int, error) {
+	if len(buf) == 0 || (buf[0] != MagicV1 && buf[0] != MagicV2) {
+		return nil, 0, fmt.Errorf("mavlink: invalid magic")
+	}
+	size := FrameLen(buf)
+	if size == 0 || len(buf) < size {
+		return nil, 0, ErrTruncated
+	}
+
+	frame := &Frame{}
+	var headerLen int
+	if buf[0] == MagicV1 {
+		headerLen = headerLenV1
+		frame.Version = 1
+		frame.Sequence = buf[2]
+		frame.SystemID = buf[3]
+		frame.ComponentID = buf[4]
+		frame.MessageID = uint32(buf[5])
+	} else {
+		headerLen = headerLenV2
+		frame.Version = 2
+		frame.Sequence = buf[4]
+		frame.SystemID = buf[5]
+		frame.ComponentID = buf[6]
+		frame.MessageID = uint32(buf[7]) | uint32(buf[8])<<8 | uint32(buf[9])<<16
+	}
+	payloadLen := int(buf[1])
+	payload := buf[headerLen : headerLen+payloadLen]
+
+	spec, ok := messageSpecs[frame.MessageID]
+	if !ok {
+		return frame, size, ErrUnknownMessage
+	}
+	crc := checksum(buf[1:headerLen+payloadLen], spec.crcExtra)
+	if binary.LittleEndian.Uint16(buf[headerLen+payloadLen:]) != crc {
+		return frame, size, ErrBadChecksum
+	}
+
+	// v2 会截断payload末尾的零字节，补齐到消息定义长度
+	frame.Payload = make([]byte, max(spec.length, payloadLen))
+	copy(frame.Payload, payload)
+	return frame, size, nil
+}
+
+// Parser 从字节流中逐帧解析，自动跳过噪声、未知消息和校验失败的帧
+type Parser struct {
+	buf []byte
+}
+
+// Feed 追加数据并返回其中完整的已知消息帧
+func (p *Parser) Feed(data []byte) []*Frame {
+	p.buf = append(p.buf, data...)
+	var frames []*Frame
+	for len(p.buf) > 0 {
+		if p.buf[0] != MagicV1 && p.buf[0] != MagicV2 {
+			p.buf = p.buf[1:]
+			continue
+		}
+		frame, n, err := ParseFrame(p.buf)
+		if errors.Is(err, ErrTruncated) {
+			break
+		}
+		if errors.Is(err, ErrBadChecksum) {
+			// 可能是误判的起始字节，只丢弃一个字节重新同步
+			p.buf = p.buf[1:]
+			continue
+		}
+		p.buf = p.buf[n:]
+		if err == nil {
+			frames = append(frames, frame)
+		}
+	}
+	if len(p.buf) == 0 {
+		p.buf = nil
+	}
+	return frames
+}
+
+// Marshal 按帧版本编码，v2 帧截断 payload 末尾零字节
+func (f *Frame) Marshal() ([]byte, error) {
+	spec, ok := messageSpecs[f.MessageID]
+	if !ok {
+		return nil, ErrUnknownMessage
+	}
+	payload := f.Payload
+	if len(payload) > maxPayloadSize {
+		return nil, fmt.Errorf("mavlink: payload too large")
+	}
+
+	var out []byte
+	if f.Version == 1 {
+		if f.MessageID > 0xFF {
+			return nil, fmt.Errorf("mavlink: message %d requires v2", f.MessageID)
+		}
+		out = append(out, MagicV1, byte(len(payload)), f.Sequence, f.SystemID, f.ComponentID, byte(f.MessageID))
+	} else {
+		for len(payload) > 1 && payload[len(payload)-1] == 0 {
+			payload = payload[:len(payload)-1]
+		}
+		out = append(out, MagicV2, byte(len(payload)), 0, 0, f.Sequence, f.SystemID, f.ComponentID,
+			byte(f.MessageID), byte(f.MessageID>>8), byte(f.MessageID>>16))
+	}
+	out = append(out, payload...)
+	crc := checksum(out[1:], spec.crcExtra)
+	return binary.LittleEndian.AppendUint16(out, crc), nil
+}
+
+// checksum CRC-16/MCRF4XX，末尾追加消息的 CRC_EXTRA
+func checksum(data []byte, extra byte) uint16 {
+	crc := uint16(0xFFFF)
+	accumulate := func(b byte) {
+		tmp := b ^ byte(crc&0xFF)
+		tmp ^= tmp << 4
+		crc = (crc >> 8) ^ (uint16(tmp) << 8) ^ (uint16(tmp) << 3) ^ (uint16(tmp) >> 4)
+	}
+	for _, b := range data {
+		accumulate(b)
+	}
+	accumulate(extra)
+	return crc
+}
@@ -0,0 +1,109 @@
+package mavlink
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestChecksumMatchesMCRF4XX(t *testing.T) {
+	// CRC-16/MCRF4XX 标准校验值，CRC_EXTRA 即最后一个字节
+	if got := checksum([]byte("12345678"), '9'); got != 0x6F91 {
+		t.Fatalf("checksum = %#04x, want 0x6f91", got)
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	want := &GlobalPositionInt{
+		TimeBootMs: 123456, Lat: 230272917, Lon: 1131243033, Alt: 88000, RelativeAlt: 52000,
+		Vx: 300, Vy: -400, Vz: 0, Hdg: 0, // 末尾为零，v2 会截断
+	}
+	for _, version := range []int{1, 2} {
+		raw, err := Encode(want, version, 9, 7, 1)
+		if err != nil {
+			t.Fatalf("v%d encode: %v", version, err)
+		}
+		if version == 2 && len(raw) >= headerLenV2+28+checksumLen {
+			t.Fatalf("v2 payload not truncated: %d bytes", len(raw))
+		}
+		frame, n, err := ParseFrame(raw)
+		if err != nil || n != len(raw) {
+			t.Fatalf("v%d parse: n=%d err=%v", version, n, err)
+		}
+		if frame.Version != version || frame.SystemID != 7 || frame.ComponentID != 1 || frame.Sequence != 9 {
+			t.Fatalf("v%d unexpected header %#v", version, frame)
+		}
+		msg, err := Decode(frame)
+		if err != nil {
+			t.Fatalf("v%d decode: %v", version, err)
+		}
+		got := msg.(*GlobalPositionInt)
+		if *got != *want {
+			t.Fatalf("v%d round trip = %#v, want %#v", version, got, want)
+		}
+		if got.GroundSpeed() != 500 {
+			t.Fatalf("ground speed = %d, want 500", got.GroundSpeed())
+		}
+	}
+}
+
+func TestParserResyncsAcrossNoiseAndSplitDatagrams(t *testing.T) {
+	heartbeat, _ := Encode(&Heartbeat{Type: 2, Autopilot: 3, BaseMode: ModeFlagSafetyArmed, MavlinkVersion: 3}, 2, 0, 7, 1)
+	status, _ := Encode(&SysStatus{DropRateComm: 1500, BatteryRemaining: 64}, 1, 1, 7, 1)
+	corrupted := append([]byte(nil), status...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	unknown := []byte{MagicV2, 2, 0, 0, 0, 7, 1, 0xE7, 0x03, 0x00, 0xAA, 0xBB, 0x00, 0x00} // 消息ID 999
+
+	var stream []byte
+	stream = append(stream, 0x00, 0x42)
+	stream = append(stream, heartbeat...)
+	stream = append(stream, corrupted...)
+	stream = append(stream, unknown...)
+	stream = append(stream, status...)
+
+	parser := &Parser{}
+	var frames []*Frame
+	split := len(stream) - 5
+	frames = append(frames, parser.Feed(stream[:split])...)
+	frames = append(frames, parser.Feed(stream[split:])...)
+
+	if len(frames) != 2 || frames[0].MessageID != MsgIDHeartbeat || frames[1].MessageID != MsgIDSysStatus {
+		t.Fatalf("expected heartbeat and sys_status, got %d frames", len(frames))
+	}
+	msg, _ := Decode(frames[0])
+	if !msg.(*Heartbeat).Armed() {
+		t.Fatalf("expected armed heartbeat")
+	}
+	msg, _ = Decode(frames[1])
+	if s := msg.(*SysStatus); s.DropRateComm != 1500 || s.BatteryRemaining != 64 {
+		t.Fatalf("unexpected sys_status %#v", s)
+	}
+}
+
+func TestTlogReadWrite(t *testing.T) {
+	start := time.UnixMicro(1_700_000_000_000_000)
+	var buf bytes.Buffer
+	battery, _ := Encode(&BatteryStatus{Temperature: 3150, CurrentBattery: -1, BatteryRemaining: 55}, 2, 0, 3, 1)
+	position, _ := Encode(&GlobalPositionInt{Lat: 1, Lon: 2, Hdg: HeadingUnknown}, 1, 1, 3, 1)
+	WriteTlogRecord(&buf, start, battery)
+	WriteTlogRecord(&buf, start.Add(250*time.Millisecond), position)
+	buf.Write([]byte{0x01, 0x02}) // 文件末尾残缺
+
+	reader := NewTlogReader(&buf)
+	first, err := reader.Next()
+	if err != nil || first.Frame.MessageID != MsgIDBatteryStatus || !first.Timestamp.Equal(start) || !bytes.Equal(first.Raw, battery) {
+		t.Fatalf("unexpected first record %#v, err=%v", first, err)
+	}
+	msg, _ := Decode(first.Frame)
+	if b := msg.(*BatteryStatus); b.Temperature != 3150 || b.BatteryRemaining != 55 {
+		t.Fatalf("unexpected battery status %#v", b)
+	}
+	second, err := reader.Next()
+	if err != nil || second.Frame.MessageID != MsgIDGlobalPositionInt || second.Timestamp.Sub(start) != 250*time.Millisecond {
+		t.Fatalf("unexpected second record %#v, err=%v", second, err)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
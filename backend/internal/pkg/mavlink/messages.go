@@ -0,0 +1,204 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// 支持的消息ID
+const (
+	MsgIDHeartbeat         uint32 = 0
+	MsgIDSysStatus         uint32 = 1
+	MsgIDGlobalPositionInt uint32 = 33
+	MsgIDBatteryStatus     uint32 = 147
+)
+
+type messageSpec struct {
+	length   int  // 基础 payload 长度(不含扩展字段)
+	crcExtra byte // 消息定义的 CRC_EXTRA
+}
+
+var messageSpecs = map[uint32]messageSpec{
+	MsgIDHeartbeat:         {length: 9, crcExtra: 50},
+	MsgIDSysStatus:         {length: 31, crcExtra: 124},
+	MsgIDGlobalPositionInt: {length: 28, crcExtra: 104},
+	MsgIDBatteryStatus:     {length: 36, crcExtra: 154},
+}
+
+// Message 可编码的消息
+type Message interface {
+	MessageID() uint32
+	payload() []byte
+}
+
+// Heartbeat HEARTBEAT(#0)
+type Heartbeat struct {
+	CustomMode     uint32
+	Type           uint8
+	Autopilot      uint8
+	BaseMode       uint8
+	SystemStatus   uint8
+	MavlinkVersion uint8
+}
+
+// BaseMode 标志位: 已解锁
+const ModeFlagSafetyArmed uint8 = 0x80
+
+func (m *Heartbeat) MessageID() uint32 { return MsgIDHeartbeat }
+
+// Armed 是否已解锁
+func (m *Heartbeat) Armed() bool { return m.BaseMode&ModeFlagSafetyArmed != 0 }
+
+func (m *Heartbeat) payload() []byte {
+	b := make([]byte, 9)
+	binary.LittleEndian.PutUint32(b[0:], m.CustomMode)
+	b[4], b[5], b[6], b[7], b[8] = m.Type, m.Autopilot, m.BaseMode, m.SystemStatus, m.MavlinkVersion
+	return b
+}
+
+// SysStatus SYS_STATUS(#1)，只保留遥测接入关心的字段
+type SysStatus struct {
+	VoltageBattery   uint16 // mV，UINT16_MAX 表示未知
+	CurrentBattery   int16  // 10mA，-1 表示未知
+	DropRateComm     uint16 // 通信丢包率 c%(0~10000)
+	BatteryRemaining int8   // %，-1 表示未知
+}
+
+func (m *SysStatus) MessageID() uint32 { return MsgIDSysStatus }
+
+func (m *SysStatus) payload() []byte {
+	b := make([]byte, 31)
+	binary.LittleEndian.PutUint16(b[14:], m.VoltageBattery)
+	binary.LittleEndian.PutUint16(b[16:], uint16(m.CurrentBattery))
+	binary.LittleEndian.PutUint16(b[18:], m.DropRateComm)
+	b[30] = byte(m.BatteryRemaining)
+	return b
+}
+
+// GlobalPositionInt GLOBAL_POSITION_INT(#33)
+type GlobalPositionInt struct {
+	TimeBootMs  uint32
+	Lat         int32  // degE7
+	Lon         int32  // degE7
+	Alt         int32  // mm，海拔
+	RelativeAlt int32  // mm，相对起飞点
+	Vx          int16  // cm/s，北向
+	Vy          int16  // cm/s，东向
+	Vz          int16  // cm/s，向下为正
+	Hdg         uint16 // cdeg，UINT16_MAX 表示未知
+}
+
+// HeadingUnknown Hdg 未知值
+const HeadingUnknown uint16 = math.MaxUint16
+
+func (m *GlobalPositionInt) MessageID() uint32 { return MsgIDGlobalPositionInt }
+
+// Latitude 纬度(度)
+func (m *GlobalPositionInt) Latitude() float64 { return float64(m.Lat) / 1e7 }
+
+// Longitude 经度(度)
+func (m *GlobalPositionInt) Longitude() float64 { return float64(m.Lon) / 1e7 }
+
+// GroundSpeed 地速 cm/s
+func (m *GlobalPositionInt) GroundSpeed() int {
+	return int(math.Round(math.Hypot(float64(m.Vx), float64(m.Vy))))
+}
+
+func (m *GlobalPositionInt) payload() []byte {
+	b := make([]byte, 28)
+	binary.LittleEndian.PutUint32(b[0:], m.TimeBootMs)
+	binary.LittleEndian.PutUint32(b[4:], uint32(m.Lat))
+	binary.LittleEndian.PutUint32(b[8:], uint32(m.Lon))
+	binary.LittleEndian.PutUint32(b[12:], uint32(m.Alt))
+	binary.LittleEndian.PutUint32(b[16:], uint32(m.RelativeAlt))
+	binary.LittleEndian.PutUint16(b[20:], uint16(m.Vx))
+	binary.LittleEndian.PutUint16(b[22:], uint16(m.Vy))
+	binary.LittleEndian.PutUint16(b[24:], uint16(m.Vz))
+	binary.LittleEndian.PutUint16(b[26:], m.Hdg)
+	return b
+}
+
+// BatteryStatus BATTERY_STATUS(#147)，只保留遥测接入关心的字段
+type BatteryStatus struct {
+	Temperature      int16 // cdegC，INT16_MAX 表示未知
+	CurrentBattery   int16 // 10mA，-1 表示未知
+	ID               uint8
+	BatteryRemaining int8 // %，-1 表示未知
+}
+
+// TemperatureUnknown Temperature 未知值
+const TemperatureUnknown int16 = math.MaxInt16
+
+func (m *BatteryStatus) MessageID() uint32 { return MsgIDBatteryStatus }
+
+func (m *BatteryStatus) payload() []byte {
+	b := make([]byte, 36)
+	binary.LittleEndian.PutUint16(b[8:], uint16(m.Temperature))
+	for i := 0; i < 10; i++ {
+		binary.LittleEndian.PutUint16(b[10+2*i:], math.MaxUint16)
+	}
+	binary.LittleEndian.PutUint16(b[30:], uint16(m.CurrentBattery))
+	b[32] = m.ID
+	b[35] = byte(m.BatteryRemaining)
+	return b
+}
+
+// Decode 将帧解码为具体消息，未支持的消息返回 ErrUnknownMessage
+func Decode(f *Frame) (Message, error) {
+	spec, ok := messageSpecs[f.MessageID]
+	if !ok {
+		return nil, ErrUnknownMessage
+	}
+	b := f.Payload
+	if len(b) < spec.length {
+		return nil, ErrTruncated
+	}
+	le := binary.LittleEndian
+	switch f.MessageID {
+	case MsgIDHeartbeat:
+		return &Heartbeat{
+			CustomMode: le.Uint32(b[0:]), Type: b[4], Autopilot: b[5],
+			BaseMode: b[6], SystemStatus: b[7], MavlinkVersion: b[8],
+		}, nil
+	case MsgIDSysStatus:
+		return &SysStatus{
+			VoltageBattery:   le.Uint16(b[14:]),
+			CurrentBattery:   int16(le.Uint16(b[16:])),
+			DropRateComm:     le.Uint16(b[18:]),
+			BatteryRemaining: int8(b[30]),
+		}, nil
+	case MsgIDGlobalPositionInt:
+		return &GlobalPositionInt{
+			TimeBootMs:  le.Uint32(b[0:]),
+			Lat:         int32(le.Uint32(b[4:])),
+			Lon:         int32(le.Uint32(b[8:])),
+			Alt:         int32(le.Uint32(b[12:])),
+			RelativeAlt: int32(le.Uint32(b[16:])),
+			Vx:          int16(le.Uint16(b[20:])),
+			Vy:          int16(le.Uint16(b[22:])),
+			Vz:          int16(le.Uint16(b[24:])),
+			Hdg:         le.Uint16(b[26:]),
+		}, nil
+	case MsgIDBatteryStatus:
+		return &BatteryStatus{
+			Temperature:      int16(le.Uint16(b[8:])),
+			CurrentBattery:   int16(le.Uint16(b[30:])),
+			ID:               b[32],
+			BatteryRemaining: int8(b[35]),
+		}, nil
+	}
+	return nil, ErrUnknownMessage
+}
+
+// Encode 将消息编码为帧字节，version 为 1 或 2
+func Encode(msg Message, version int, seq, systemID, componentID uint8) ([]byte, error) {
+	f := &Frame{
+		Version:     version,
+		Sequence:    seq,
+		SystemID:    systemID,
+		ComponentID: componentID,
+		MessageID:   msg.MessageID(),
+		Payload:     msg.payload(),
+	}
+	return f.Marshal()
+}
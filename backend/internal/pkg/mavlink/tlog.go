@@ -0,0 +1,78 @@
+package mavlink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// TlogRecord .tlog 文件中的一条记录
+type TlogRecord struct {
+	Timestamp time.Time
+	Raw       []byte // 原始帧字节，可直接转发
+	Frame     *Frame
+}
+
+// TlogReader 读取地面站(Mission Planner/QGC)保存的 .tlog 文件
+// 每条记录为 8 字节大端 UNIX 微秒时间戳 + 一帧 MAVLink 消息
+type TlogReader struct {
+	r *bufio.Reader
+}
+
+func NewTlogReader(r io.Reader) *TlogReader {
+	return &TlogReader{r: bufio.NewReader(r)}
+}
+
+// Next 返回下一条已知消息记录，文件结束返回 io.EOF
+// 未知消息仍按帧长度跳过，校验失败的数据逐字节重新同步
+func (t *TlogReader) Next() (*TlogRecord, error) {
+	for {
+		head, err := t.r.Peek(8 + 3)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		size := FrameLen(head[8:])
+		if size == 0 {
+			t.r.Discard(1)
+			continue
+		}
+		buf, err := t.r.Peek(8 + size)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		frame, _, err := ParseFrame(buf[8:])
+		if errors.Is(err, ErrBadChecksum) {
+			t.r.Discard(1)
+			continue
+		}
+		micros := binary.BigEndian.Uint64(buf[:8])
+		raw := append([]byte(nil), buf[8:]...)
+		t.r.Discard(8 + size)
+		if errors.Is(err, ErrUnknownMessage) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &TlogRecord{Timestamp: time.UnixMicro(int64(micros)), Raw: raw, Frame: frame}, nil
+	}
+}
+
+// WriteTlogRecord 追加一条 .tlog 记录
+func WriteTlogRecord(w io.Writer, ts time.Time, raw []byte) error {
+	var head [8]byte
+	binary.BigEndian.PutUint64(head[:], uint64(ts.UnixMicro()))
+	if _, err := w.Write(head[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(raw)
+	return err
+}
@@ -0,0 +1,106 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+)
+
+// loadKeyMaterial 密钥配置支持 PEM 内容、去掉头尾的 base64 内容或密钥文件路径
+func loadKeyMaterial(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("payment: empty key")
+	}
+	if !strings.Contains(value, "-----BEGIN") {
+		if data, err := os.ReadFile(value); err == nil {
+			value = strings.TrimSpace(string(data))
+		}
+	}
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		return block.Bytes, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, errors.New("payment: key is neither PEM, base64 nor a readable file")
+	}
+	return der, nil
+}
+
+// ParseRSAPrivateKey 解析 PKCS#8 或 PKCS#1 格式的 RSA 私钥
+func ParseRSAPrivateKey(value string) (*rsa.PrivateKey, error) {
+	der, err := loadKeyMaterial(value)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.New("payment: private key is not RSA")
+	}
+	return x509.ParsePKCS1PrivateKey(der)
+}
+
+// ParseRSAPublicKey 解析 PKIX 或 PKCS#1 格式的 RSA 公钥
+func ParseRSAPublicKey(value string) (*rsa.PublicKey, error) {
+	der, err := loadKeyMaterial(value)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.New("payment: public key is not RSA")
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
+
+// EncodeRSAPrivateKey 以 PKCS#8 PEM 格式导出私钥
+func EncodeRSAPrivateKey(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// EncodeRSAPublicKey 以 PKIX PEM 格式导出公钥
+func EncodeRSAPublicKey(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// rsa2Sign SHA256WithRSA 签名，返回 base64
+func rsa2Sign(key *rsa.PrivateKey, content string) (string, error) {
+	digest := sha256.Sum256([]byte(content))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// rsa2Verify 校验 SHA256WithRSA 签名
+func rsa2Verify(key *rsa.PublicKey, content, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	digest := sha256.Sum256([]byte(content))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
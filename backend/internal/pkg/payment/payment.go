@@ -19,10 +19,32 @@ type PaymentResult struct {
 	PayParams string `json:"pay_params"` // JSON string for client SDK
 }
 
+// 渠道侧交易状态
+const (
+	StatusPending  = "pending"  // 未支付或支付中
+	StatusPaid     = "paid"     // 已支付
+	StatusClosed   = "closed"   // 已关闭/支付失败
+	StatusRefunded = "refunded" // 已支付后退款
+)
+
 type PaymentStatus struct {
 	PaymentNo    string `json:"payment_no"`
 	Status       string `json:"status"`
 	ThirdPartyNo string `json:"third_party_no"`
+	Amount       int64  `json:"amount"` // 渠道记录的订单金额(分)，未知时为 0
+}
+
+// Notification 已验签的渠道异步通知
+type Notification struct {
+	PaymentNo    string // 商户支付单号(out_trade_no)
+	ThirdPartyNo string // 渠道交易号
+	Amount       int64  // 分
+	Status       string // paid, closed
+}
+
+// NotifyParser 支持异步通知的渠道实现，校验签名并解析通知内容
+type NotifyParser interface {
+	ParseNotify(body []byte) (*Notification, error)
 }
 
 type RefundResult struct {
@@ -0,0 +1,299 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrPayoutNotFound 渠道侧没有该出款单，可使用同一出款单号重新提交
+var ErrPayoutNotFound = errors.New("payment: payout not found")
+
+// 出款状态
+const (
+	PayoutProcessing = "processing" // 已受理、等待渠道处理结果
+	PayoutSucceeded  = "succeeded"  // 已到账
+	PayoutFailed     = "failed"     // 出款失败，资金未转出
+)
+
+// PayoutProvider 提现出款渠道，以商户出款单号幂等，同一单号重复提交不会重复打款
+type PayoutProvider interface {
+	Transfer(req *PayoutRequest) (*PayoutResult, error)
+	QueryPayout(payoutNo string) (*PayoutResult, error)
+}
+
+// PayoutRequest 出款请求
+type PayoutRequest struct {
+	PayoutNo    string // 商户出款单号(提现单号)
+	Amount      int64  // 实际到账金额(分)
+	Account     string // 收款账号: 银行卡号 / 支付宝登录号 / 微信 openid
+	AccountName string // 收款人姓名，非空时渠道校验实名
+	BankName    string
+	BankBranch  string
+	Remark      string
+}
+
+// PayoutResult 出款结果
+type PayoutResult struct {
+	PayoutNo     string `json:"payout_no"`
+	Status       string `json:"status"` // processing, succeeded, failed
+	ThirdPartyNo string `json:"third_party_no"`
+	FailReason   string `json:"fail_reason"`
+}
+
+// ============================================================
+// Mock 出款
+// ============================================================
+
+// MockPayout 开发环境出款，提交即到账
+type MockPayout struct {
+	logger *zap.Logger
+}
+
+func NewMockPayout(logger *zap.Logger) *MockPayout {
+	return &MockPayout{logger: logger}
+}
+
+func (m *MockPayout) Transfer(req *PayoutRequest) (*PayoutResult, error) {
+	m.logger.Info("mock payout transferred",
+		zap.String("payout_no", req.PayoutNo),
+		zap.Int64("amount", req.Amount),
+	)
+	return m.QueryPayout(req.PayoutNo)
+}
+
+func (m *MockPayout) QueryPayout(payoutNo string) (*PayoutResult, error) {
+	return &PayoutResult{
+		PayoutNo:     payoutNo,
+		Status:       PayoutSucceeded,
+		ThirdPartyNo: "MOCK_" + payoutNo,
+	}, nil
+}
+
+// ============================================================
+// 微信 企业付款到零钱
+// ============================================================
+
+// wechatPayoutRetryable 微信付款中可重试的错误码，结果不确定，不能判定为失败
+var wechatPayoutRetryable = map[string]bool{
+	"SYSTEMERROR": true, "NOTENOUGH": true, "FREQ_LIMIT": true, "SEND_FAILED": true,
+}
+
+// Transfer 企业付款到零钱，partner_trade_no 为提现单号；需要商户API证书
+func (w *WeChatPayment) Transfer(req *PayoutRequest) (*PayoutResult, error) {
+	params := map[string]string{
+		"mch_appid":        w.config.AppID,
+		"mchid":            w.config.MchID,
+		"nonce_str":        nonceStr(),
+		"partner_trade_no": req.PayoutNo,
+		"openid":           req.Account,
+		"check_name":       "NO_CHECK",
+		"amount":           strconv.FormatInt(req.Amount, 10),
+		"desc":             req.Remark,
+	}
+	if req.AccountName != "" {
+		params["check_name"] = "FORCE_CHECK"
+		params["re_user_name"] = req.AccountName
+	}
+
+	resp, err := w.callPayout("/mmpaymkttransfers/promotion/transfers", params)
+	var bizErr *WeChatError
+	if errors.As(err, &bizErr) && !wechatPayoutRetryable[bizErr.Code] {
+		return &PayoutResult{PayoutNo: req.PayoutNo, Status: PayoutFailed, FailReason: bizErr.Message}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w.logger.Info("wechat payout transferred",
+		zap.String("payout_no", req.PayoutNo),
+		zap.Int64("amount", req.Amount),
+		zap.String("payment_no", resp["payment_no"]),
+	)
+	return &PayoutResult{PayoutNo: req.PayoutNo, Status: PayoutSucceeded, ThirdPartyNo: resp["payment_no"]}, nil
+}
+
+// QueryPayout 查询企业付款结果
+func (w *WeChatPayment) QueryPayout(payoutNo string) (*PayoutResult, error) {
+	resp, err := w.callPayout("/mmpaymkttransfers/gettransferinfo", map[string]string{
+		"appid":            w.config.AppID,
+		"mch_id":           w.config.MchID,
+		"nonce_str":        nonceStr(),
+		"partner_trade_no": payoutNo,
+	})
+	var bizErr *WeChatError
+	if errors.As(err, &bizErr) && bizErr.Code == "NOT_FOUND" {
+		return nil, ErrPayoutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PayoutResult{PayoutNo: payoutNo, Status: PayoutProcessing, ThirdPartyNo: resp["detail_id"]}
+	switch resp["status"] {
+	case "SUCCESS":
+		result.Status = PayoutSucceeded
+	case "FAILED":
+		result.Status = PayoutFailed
+		result.FailReason = resp["reason"]
+	}
+	return result, nil
+}
+
+// callPayout 企业付款接口响应不带签名，只校验通信与业务结果
+func (w *WeChatPayment) callPayout(path string, params map[string]string) (map[string]string, error) {
+	params["sign"] = w.sign(params)
+	resp, err := w.post(path, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp["result_code"] != "SUCCESS" {
+		return resp, &WeChatError{Code: resp["err_code"], Message: resp["err_code_des"]}
+	}
+	return resp, nil
+}
+
+// ============================================================
+// 支付宝 单笔转账到支付宝账户
+// ============================================================
+
+// alipayPayoutRetryable 支付宝转账中可重试的错误码
+var alipayPayoutRetryable = map[string]bool{
+	"SYSTEM_ERROR": true, "PAYER_BALANCE_NOT_ENOUGH": true, "ACQ.SYSTEM_ERROR": true,
+}
+
+type alipayTransferResponse struct {
+	OutBizNo   string `json:"out_biz_no"`
+	OrderID    string `json:"order_id"`
+	Status     string `json:"status"` // SUCCESS, FAIL, DEALING
+	FailReason string `json:"fail_reason"`
+}
+
+// Transfer 单笔转账 alipay.fund.trans.uni.transfer，out_biz_no 为提现单号
+func (a *AlipayPayment) Transfer(req *PayoutRequest) (*PayoutResult, error) {
+	payee := map[string]interface{}{
+		"identity":      req.Account,
+		"identity_type": "ALIPAY_LOGON_ID",
+	}
+	if req.AccountName != "" {
+		payee["name"] = req.AccountName
+	}
+	var resp alipayTransferResponse
+	err := a.execute("alipay.fund.trans.uni.transfer", map[string]interface{}{
+		"out_biz_no":   req.PayoutNo,
+		"trans_amount": formatYuan(req.Amount),
+		"product_code": "TRANS_ACCOUNT_NO_PWD",
+		"biz_scene":    "DIRECT_TRANSFER",
+		"order_title":  "提现",
+		"payee_info":   payee,
+		"remark":       req.Remark,
+	}, &resp)
+	var bizErr *AlipayError
+	if errors.As(err, &bizErr) && !alipayPayoutRetryable[bizErr.SubCode] {
+		return &PayoutResult{PayoutNo: req.PayoutNo, Status: PayoutFailed, FailReason: bizErr.SubMsg}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.logger.Info("alipay payout transferred",
+		zap.String("payout_no", req.PayoutNo),
+		zap.Int64("amount", req.Amount),
+		zap.String("order_id", resp.OrderID),
+	)
+	return alipayPayoutResult(req.PayoutNo, resp), nil
+}
+
+// QueryPayout 转账业务单据查询 alipay.fund.trans.common.query
+func (a *AlipayPayment) QueryPayout(payoutNo string) (*PayoutResult, error) {
+	var resp alipayTransferResponse
+	err := a.execute("alipay.fund.trans.common.query", map[string]interface{}{
+		"out_biz_no":   payoutNo,
+		"product_code": "TRANS_ACCOUNT_NO_PWD",
+		"biz_scene":    "DIRECT_TRANSFER",
+	}, &resp)
+	var bizErr *AlipayError
+	if errors.As(err, &bizErr) && bizErr.SubCode == "ORDER_NOT_EXIST" {
+		return nil, ErrPayoutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return alipayPayoutResult(payoutNo, resp), nil
+}
+
+func alipayPayoutResult(payoutNo string, resp alipayTransferResponse) *PayoutResult {
+	result := &PayoutResult{PayoutNo: payoutNo, Status: PayoutProcessing, ThirdPartyNo: resp.OrderID}
+	switch resp.Status {
+	case "SUCCESS":
+		result.Status = PayoutSucceeded
+	case "FAIL", "REFUND":
+		result.Status = PayoutFailed
+		result.FailReason = resp.FailReason
+	}
+	return result
+}
+
+// ============================================================
+// 银行卡 批量代付文件
+// ============================================================
+
+// PayoutBatchExporter 以批量文件出款的渠道：导出文件由财务上传企业网银，再导入银行回单确认结果
+type PayoutBatchExporter interface {
+	ExportBatch(batchNo, format string, reqs []PayoutRequest) ([]byte, error)
+	ParseBatchResult(data []byte) ([]PayoutResult, error)
+}
+
+// BankBatchConfig 付款企业账户，写入批量文件抬头
+type BankBatchConfig struct {
+	PayerAccountNo   string
+	PayerAccountName string
+	PayerBankName    string
+}
+
+// BankBatchPayout 银行卡出款：提交时只登记待导出，结果以导入的银行回单为准
+type BankBatchPayout struct {
+	config BankBatchConfig
+	logger *zap.Logger
+}
+
+func NewBankBatchPayout(config BankBatchConfig, logger *zap.Logger) *BankBatchPayout {
+	return &BankBatchPayout{config: config, logger: logger}
+}
+
+func (b *BankBatchPayout) Transfer(req *PayoutRequest) (*PayoutResult, error) {
+	return &PayoutResult{PayoutNo: req.PayoutNo, Status: PayoutProcessing}, nil
+}
+
+func (b *BankBatchPayout) QueryPayout(payoutNo string) (*PayoutResult, error) {
+	return &PayoutResult{PayoutNo: payoutNo, Status: PayoutProcessing}, nil
+}
+
+// ExportBatch 生成批量代付文件，format 为 csv 或 xml
+func (b *BankBatchPayout) ExportBatch(batchNo, format string, reqs []PayoutRequest) ([]byte, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("payout batch is empty")
+	}
+	header := bankBatchHeader{
+		BatchNo:          batchNo,
+		PayerAccountNo:   b.config.PayerAccountNo,
+		PayerAccountName: b.config.PayerAccountName,
+		PayerBankName:    b.config.PayerBankName,
+		CreatedAt:        time.Now(),
+	}
+	switch format {
+	case "csv", "":
+		return encodeBankBatchCSV(header, reqs)
+	case "xml":
+		return encodeBankBatchXML(header, reqs)
+	}
+	return nil, fmt.Errorf("unsupported payout batch format %q", format)
+}
+
+// ParseBatchResult 解析银行回单 CSV
+func (b *BankBatchPayout) ParseBatchResult(data []byte) ([]PayoutResult, error) {
+	return parseBankBatchResultCSV(data)
+}
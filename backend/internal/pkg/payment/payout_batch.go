@@ -0,0 +1,168 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// utf8BOM 企业网银与 Excel 依赖 BOM 识别 UTF-8 编码的 CSV
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+type bankBatchHeader struct {
+	BatchNo          string
+	PayerAccountNo   string
+	PayerAccountName string
+	PayerBankName    string
+	CreatedAt        time.Time
+}
+
+func bankBatchTotal(reqs []PayoutRequest) int64 {
+	var total int64
+	for _, req := range reqs {
+		total += req.Amount
+	}
+	return total
+}
+
+// encodeBankBatchCSV 首行为批次汇总，其后为明细表头与明细
+func encodeBankBatchCSV(header bankBatchHeader, reqs []PayoutRequest) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(utf8BOM)
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"批次号", "付款账号", "付款户名", "付款银行", "总笔数", "总金额(元)", "生成时间"},
+		{header.BatchNo, header.PayerAccountNo, header.PayerAccountName, header.PayerBankName,
+			strconv.Itoa(len(reqs)), formatYuan(bankBatchTotal(reqs)), header.CreatedAt.Format("2006-01-02 15:04:05")},
+		{"序号", "付款单号", "收款账号", "收款户名", "收款银行", "开户支行", "金额(元)", "用途"},
+	}
+	for i, req := range reqs {
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1), req.PayoutNo, req.Account, req.AccountName, req.BankName, req.BankBranch, formatYuan(req.Amount), req.Remark,
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type bankBatchXML struct {
+	XMLName          xml.Name             `xml:"PayoutBatch"`
+	BatchNo          string               `xml:"BatchNo"`
+	PayerAccountNo   string               `xml:"PayerAccountNo"`
+	PayerAccountName string               `xml:"PayerAccountName"`
+	PayerBankName    string               `xml:"PayerBankName"`
+	TotalCount       int                  `xml:"TotalCount"`
+	TotalAmount      string               `xml:"TotalAmount"`
+	CreatedAt        string               `xml:"CreatedAt"`
+	Details          []bankBatchXMLDetail `xml:"Details>Detail"`
+}
+
+type bankBatchXMLDetail struct {
+	SeqNo       int    `xml:"SeqNo"`
+	PayoutNo    string `xml:"PayoutNo"`
+	AccountNo   string `xml:"PayeeAccountNo"`
+	AccountName string `xml:"PayeeAccountName"`
+	BankName    string `xml:"PayeeBankName"`
+	BankBranch  string `xml:"PayeeBankBranch"`
+	Amount      string `xml:"Amount"`
+	Remark      string `xml:"Remark"`
+}
+
+func encodeBankBatchXML(header bankBatchHeader, reqs []PayoutRequest) ([]byte, error) {
+	doc := bankBatchXML{
+		BatchNo:          header.BatchNo,
+		PayerAccountNo:   header.PayerAccountNo,
+		PayerAccountName: header.PayerAccountName,
+		PayerBankName:    header.PayerBankName,
+		TotalCount:       len(reqs),
+		TotalAmount:      formatYuan(bankBatchTotal(reqs)),
+		CreatedAt:        header.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	for i, req := range reqs {
+		doc.Details = append(doc.Details, bankBatchXMLDetail{
+			SeqNo:       i + 1,
+			PayoutNo:    req.PayoutNo,
+			AccountNo:   req.Account,
+			AccountName: req.AccountName,
+			BankName:    req.BankName,
+			BankBranch:  req.BankBranch,
+			Amount:      formatYuan(req.Amount),
+			Remark:      req.Remark,
+		})
+	}
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// parseBankBatchResultCSV 解析银行回单，按表头定位 付款单号/处理结果/银行流水号/失败原因 列
+func parseBankBatchResultCSV(data []byte) ([]PayoutResult, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	var results []PayoutResult
+	for _, row := range rows {
+		if len(columns) == 0 {
+			for i, cell := range row {
+				switch strings.TrimSpace(cell) {
+				case "付款单号", "payout_no":
+					columns["payout_no"] = i
+				case "处理结果", "status":
+					columns["status"] = i
+				case "银行流水号", "bank_serial_no":
+					columns["serial_no"] = i
+				case "失败原因", "fail_reason":
+					columns["fail_reason"] = i
+				}
+			}
+			if _, ok := columns["status"]; !ok {
+				columns = map[string]int{}
+			}
+			continue
+		}
+		cell := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if cell("payout_no") == "" {
+			continue
+		}
+		results = append(results, PayoutResult{
+			PayoutNo:     cell("payout_no"),
+			Status:       bankResultStatus(cell("status")),
+			ThirdPartyNo: cell("serial_no"),
+			FailReason:   cell("fail_reason"),
+		})
+	}
+	if _, ok := columns["payout_no"]; !ok {
+		return nil, errors.New("payout result file has no 付款单号/处理结果 header")
+	}
+	return results, nil
+}
+
+func bankResultStatus(value string) string {
+	switch strings.ToUpper(value) {
+	case "成功", "SUCCESS", "SUCCEEDED":
+		return PayoutSucceeded
+	case "失败", "FAIL", "FAILED", "退票":
+		return PayoutFailed
+	}
+	return PayoutProcessing
+}
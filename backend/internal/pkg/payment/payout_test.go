@@ -0,0 +1,123 @@
+package payment
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/xml"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestWeChatPayoutAgainstSandbox(t *testing.T) {
+	sandbox := NewSandbox(SandboxConfig{WeChatAppID: "wx_test", WeChatMchID: "1900000001", WeChatAPIKey: "k"}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+	provider := NewWeChatPayment(WeChatPayConfig{AppID: "wx_test", MchID: "1900000001", APIKey: "k", GatewayURL: gateway.URL}, zap.NewNop())
+
+	result, err := provider.Transfer(&PayoutRequest{PayoutNo: "WD_WX_1", Amount: 9900, Account: "openid_ok", Remark: "提现"})
+	if err != nil || result.Status != PayoutSucceeded || result.ThirdPartyNo == "" {
+		t.Fatalf("expected immediate success, got %#v %v", result, err)
+	}
+
+	result, err = provider.Transfer(&PayoutRequest{PayoutNo: "WD_WX_2", Amount: 9900, Account: "fail_openid"})
+	if err != nil || result.Status != PayoutFailed || result.FailReason == "" {
+		t.Fatalf("expected failed payout, got %#v %v", result, err)
+	}
+
+	if _, err := provider.Transfer(&PayoutRequest{PayoutNo: "WD_WX_3", Amount: 9900, Account: "pending_openid"}); err == nil {
+		t.Fatal("expected retryable error while the channel is still processing")
+	}
+	if result, err := provider.QueryPayout("WD_WX_3"); err != nil || result.Status != PayoutProcessing {
+		t.Fatalf("expected processing, got %#v %v", result, err)
+	}
+	if _, err := sandbox.CompletePayout("wechat", "WD_WX_3", PayoutFailed); err != nil {
+		t.Fatalf("complete payout: %v", err)
+	}
+	if result, err := provider.QueryPayout("WD_WX_3"); err != nil || result.Status != PayoutFailed {
+		t.Fatalf("expected failed after completion, got %#v %v", result, err)
+	}
+	if _, err := provider.QueryPayout("WD_WX_404"); err != ErrPayoutNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestAlipayPayoutAgainstSandbox(t *testing.T) {
+	appKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	alipayKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	appPrivatePEM, _ := EncodeRSAPrivateKey(appKey)
+	alipayPublicPEM, _ := EncodeRSAPublicKey(&alipayKey.PublicKey)
+
+	sandbox := NewSandbox(SandboxConfig{AlipayAppID: "app", AlipayPrivateKey: alipayKey, AlipayAppPublicKey: &appKey.PublicKey}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+	provider := NewAlipayPayment(AlipayConfig{
+		AppID: "app", PrivateKey: appPrivatePEM, PublicKey: alipayPublicPEM, GatewayURL: gateway.URL + "/gateway.do",
+	}, zap.NewNop())
+
+	result, err := provider.Transfer(&PayoutRequest{PayoutNo: "WD_ALI_1", Amount: 12345, Account: "pending@example.com", AccountName: "张三"})
+	if err != nil || result.Status != PayoutProcessing {
+		t.Fatalf("expected dealing transfer, got %#v %v", result, err)
+	}
+	if _, err := sandbox.CompletePayout("alipay", "WD_ALI_1", PayoutSucceeded); err != nil {
+		t.Fatalf("complete payout: %v", err)
+	}
+	if result, err := provider.QueryPayout("WD_ALI_1"); err != nil || result.Status != PayoutSucceeded || result.ThirdPartyNo == "" {
+		t.Fatalf("expected success, got %#v %v", result, err)
+	}
+	if payouts := sandbox.Payouts(); len(payouts) != 1 || payouts[0].Amount != 12345 {
+		t.Fatalf("unexpected sandbox payouts: %#v", payouts)
+	}
+
+	result, err = provider.Transfer(&PayoutRequest{PayoutNo: "WD_ALI_2", Amount: 100, Account: "fail@example.com"})
+	if err != nil || result.Status != PayoutFailed {
+		t.Fatalf("expected failed transfer, got %#v %v", result, err)
+	}
+	if _, err := provider.QueryPayout("WD_ALI_404"); err != ErrPayoutNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestBankBatchExportAndResultParsing(t *testing.T) {
+	provider := NewBankBatchPayout(BankBatchConfig{PayerAccountNo: "6222000000000001", PayerAccountName: "无人机科技有限公司"}, zap.NewNop())
+	reqs := []PayoutRequest{
+		{PayoutNo: "WD_1", Amount: 10050, Account: "6217000000000001", AccountName: "张三", BankName: "建设银行"},
+		{PayoutNo: "WD_2", Amount: 20000, Account: "6217000000000002", AccountName: "李四", BankName: "工商银行", Remark: "含,逗号"},
+	}
+
+	csvFile, err := provider.ExportBatch("PB_1", "csv", reqs)
+	if err != nil {
+		t.Fatalf("export csv: %v", err)
+	}
+	content := string(csvFile)
+	if !strings.Contains(content, "PB_1,6222000000000001,无人机科技有限公司,,2,300.50") ||
+		!strings.Contains(content, "2,WD_2,6217000000000002,李四,工商银行,,200.00,\"含,逗号\"") {
+		t.Fatalf("unexpected csv:\n%s", content)
+	}
+
+	xmlFile, err := provider.ExportBatch("PB_1", "xml", reqs)
+	if err != nil {
+		t.Fatalf("export xml: %v", err)
+	}
+	var doc bankBatchXML
+	if err := xml.Unmarshal(xmlFile, &doc); err != nil || doc.TotalCount != 2 || doc.TotalAmount != "300.50" || doc.Details[0].PayoutNo != "WD_1" {
+		t.Fatalf("unexpected xml: %#v %v", doc, err)
+	}
+	if _, err := provider.ExportBatch("PB_1", "pdf", reqs); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+
+	results, err := provider.ParseBatchResult([]byte("\xEF\xBB\xBF批次号,PB_1\n付款单号,金额(元),处理结果,银行流水号,失败原因\nWD_1,100.50,成功,B0001,\nWD_2,200.00,失败,,户名不符\n"))
+	if err != nil {
+		t.Fatalf("parse result: %v", err)
+	}
+	if len(results) != 2 || results[0].Status != PayoutSucceeded || results[0].ThirdPartyNo != "B0001" ||
+		results[1].Status != PayoutFailed || results[1].FailReason != "户名不符" {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	if _, err := provider.ParseBatchResult([]byte("a,b\n1,2\n")); err == nil {
+		t.Fatal("expected missing header error")
+	}
+}
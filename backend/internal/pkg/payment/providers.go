@@ -1,14 +1,21 @@
 package payment
 
 import (
+	"bytes"
 	"crypto/md5"
+	"crypto/rsa"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,16 +23,27 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	ErrInvalidSignature = errors.New("payment: invalid signature")
+	ErrMerchantMismatch = errors.New("payment: notification is not for this merchant")
+)
+
 // ============================================================
 // 微信支付 Provider
 // ============================================================
 
+// WeChatGatewayURL 微信支付(V2)官方接口地址
+const WeChatGatewayURL = "https://api.mch.weixin.qq.com"
+
 // WeChatPayConfig 微信支付配置
 type WeChatPayConfig struct {
-	AppID     string
-	MchID     string
-	APIKey    string
-	NotifyURL string
+	AppID      string
+	MchID      string
+	APIKey     string
+	NotifyURL  string
+	GatewayURL string // 接口地址，为空使用官方地址；本地联调可指向支付沙箱
+	CertPath   string // 商户API证书，退款接口需要
+	KeyPath    string
 }
 
 // WeChatPayment 微信支付实现
@@ -35,93 +53,212 @@ type WeChatPayment struct {
 	logger *zap.Logger
 }
 
+// WeChatError 微信接口业务错误(result_code=FAIL)
+type WeChatError struct {
+	Code    string
+	Message string
+}
+
+func (e *WeChatError) Error() string {
+	return fmt.Sprintf("wechat pay: %s %s", e.Code, e.Message)
+}
+
 // NewWeChatPayment 创建微信支付实例
 func NewWeChatPayment(config WeChatPayConfig, logger *zap.Logger) *WeChatPayment {
+	if config.GatewayURL == "" {
+		config.GatewayURL = WeChatGatewayURL
+	}
+	config.GatewayURL = strings.TrimRight(config.GatewayURL, "/")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if config.CertPath != "" && config.KeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertPath, config.KeyPath)
+		if err != nil {
+			logger.Warn("load wechat merchant certificate failed, refunds will be rejected", zap.Error(err))
+		} else {
+			client.Transport = &http.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}}}
+		}
+	}
 	return &WeChatPayment{
 		config: config,
-		client: &http.Client{Timeout: 30 * time.Second},
+		client: client,
 		logger: logger,
 	}
 }
 
+// CreatePayment 统一下单(APP支付)，orderNo 作为商户订单号 out_trade_no
 func (w *WeChatPayment) CreatePayment(orderNo string, amount int64, description string) (*PaymentResult, error) {
-	// 生成预支付订单参数
-	nonceStr := uuid.New().String()[:32]
-	paymentNo := fmt.Sprintf("WX_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8])
-
-	// 构建统一下单参数（APP支付）
-	params := map[string]string{
+	resp, err := w.call("/pay/unifiedorder", map[string]string{
 		"appid":            w.config.AppID,
 		"mch_id":           w.config.MchID,
-		"nonce_str":        nonceStr,
+		"nonce_str":        nonceStr(),
 		"body":             description,
 		"out_trade_no":     orderNo,
-		"total_fee":        fmt.Sprintf("%d", amount),
+		"total_fee":        strconv.FormatInt(amount, 10),
 		"spbill_create_ip": "127.0.0.1",
 		"notify_url":       w.config.NotifyURL,
 		"trade_type":       "APP",
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// 签名
-	params["sign"] = w.sign(params)
-
 	w.logger.Info("wechat payment created",
-		zap.String("order_no", orderNo),
+		zap.String("payment_no", orderNo),
 		zap.Int64("amount", amount),
-		zap.String("payment_no", paymentNo),
+		zap.String("prepay_id", resp["prepay_id"]),
 	)
 
 	// 构建客户端调起支付所需的参数
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
 	appParams := map[string]string{
 		"appid":     w.config.AppID,
 		"partnerid": w.config.MchID,
-		"prepayid":  paymentNo, // 生产环境应从微信API返回
+		"prepayid":  resp["prepay_id"],
 		"package":   "Sign=WXPay",
-		"noncestr":  nonceStr,
-		"timestamp": timestamp,
+		"noncestr":  nonceStr(),
+		"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
 	}
 	appParams["sign"] = w.sign(appParams)
 
 	payParamsJSON, _ := json.Marshal(appParams)
 
 	return &PaymentResult{
-		PaymentNo: paymentNo,
+		PaymentNo: orderNo,
 		PayParams: string(payParamsJSON),
 	}, nil
 }
 
+// QueryPayment 查询订单
 func (w *WeChatPayment) QueryPayment(paymentNo string) (*PaymentStatus, error) {
-	w.logger.Info("wechat query payment", zap.String("payment_no", paymentNo))
-
-	// 生产环境应调用微信查询订单接口
-	// https://api.mch.weixin.qq.com/pay/orderquery
-	return &PaymentStatus{
-		PaymentNo:    paymentNo,
-		Status:       "pending",
-		ThirdPartyNo: "",
-	}, nil
+	resp, err := w.call("/pay/orderquery", map[string]string{
+		"appid":        w.config.AppID,
+		"mch_id":       w.config.MchID,
+		"out_trade_no": paymentNo,
+		"nonce_str":    nonceStr(),
+	})
+	var wxErr *WeChatError
+	if errors.As(err, &wxErr) && wxErr.Code == "ORDERNOTEXIST" {
+		return &PaymentStatus{PaymentNo: paymentNo, Status: StatusPending}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PaymentStatus{PaymentNo: paymentNo, ThirdPartyNo: resp["transaction_id"]}
+	status.Amount, _ = strconv.ParseInt(resp["total_fee"], 10, 64)
+	switch resp["trade_state"] {
+	case "SUCCESS":
+		status.Status = StatusPaid
+	case "REFUND":
+		status.Status = StatusRefunded
+	case "CLOSED", "REVOKED", "PAYERROR":
+		status.Status = StatusClosed
+	default: // NOTPAY, USERPAYING
+		status.Status = StatusPending
+	}
+	return status, nil
 }
 
+// Refund 申请退款，退款结果由微信异步确认
 func (w *WeChatPayment) Refund(paymentNo string, amount int64) (*RefundResult, error) {
+	// 退款接口需要原订单总金额
+	status, err := w.QueryPayment(paymentNo)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status != StatusPaid && status.Status != StatusRefunded {
+		return nil, fmt.Errorf("wechat pay: order %s is %s, cannot refund", paymentNo, status.Status)
+	}
+
 	refundNo := fmt.Sprintf("WXR_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8])
+	if _, err := w.call("/secapi/pay/refund", map[string]string{
+		"appid":         w.config.AppID,
+		"mch_id":        w.config.MchID,
+		"nonce_str":     nonceStr(),
+		"out_trade_no":  paymentNo,
+		"out_refund_no": refundNo,
+		"total_fee":     strconv.FormatInt(status.Amount, 10),
+		"refund_fee":    strconv.FormatInt(amount, 10),
+	}); err != nil {
+		return nil, err
+	}
 
 	w.logger.Info("wechat refund",
 		zap.String("payment_no", paymentNo),
 		zap.Int64("amount", amount),
 		zap.String("refund_no", refundNo),
 	)
-
-	// 生产环境应调用微信退款接口
-	// https://api.mch.weixin.qq.com/secapi/pay/refund
 	return &RefundResult{
 		RefundNo: refundNo,
 		Status:   "processing",
 	}, nil
 }
 
+// ParseNotify 校验并解析支付结果通知
+func (w *WeChatPayment) ParseNotify(body []byte) (*Notification, error) {
+	params, err := VerifyWeChatCallback(body, w.config.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	if params["appid"] != w.config.AppID || params["mch_id"] != w.config.MchID {
+		return nil, ErrMerchantMismatch
+	}
+	n := &Notification{
+		PaymentNo:    params["out_trade_no"],
+		ThirdPartyNo: params["transaction_id"],
+		Status:       StatusClosed,
+	}
+	n.Amount, _ = strconv.ParseInt(params["total_fee"], 10, 64)
+	if params["result_code"] == "SUCCESS" {
+		n.Status = StatusPaid
+	}
+	return n, nil
+}
+
+// call 签名后以 XML 调用接口，校验返回签名，result_code=FAIL 时返回 *WeChatError
+func (w *WeChatPayment) call(path string, params map[string]string) (map[string]string, error) {
+	params["sign"] = w.sign(params)
+	resp, err := w.post(path, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp["sign"] != w.sign(resp) {
+		return nil, ErrInvalidSignature
+	}
+	if resp["result_code"] != "SUCCESS" {
+		return resp, &WeChatError{Code: resp["err_code"], Message: resp["err_code_des"]}
+	}
+	return resp, nil
+}
+
+// post 以 XML 发送已签名请求，return_code 非 SUCCESS(通信失败)时返回错误
+func (w *WeChatPayment) post(path string, params map[string]string) (map[string]string, error) {
+	httpResp, err := w.client.Post(w.config.GatewayURL+path, "application/xml", bytes.NewReader(EncodeWeChatXML(params)))
+	if err != nil {
+		return nil, fmt.Errorf("wechat pay %s: %w", path, err)
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("wechat pay %s: %w", path, err)
+	}
+	resp, err := DecodeWeChatXML(body)
+	if err != nil {
+		return nil, fmt.Errorf("wechat pay %s: %w", path, err)
+	}
+	if resp["return_code"] != "SUCCESS" {
+		return nil, fmt.Errorf("wechat pay %s: %s", path, resp["return_msg"])
+	}
+	return resp, nil
+}
+
 // sign 微信支付MD5签名
 func (w *WeChatPayment) sign(params map[string]string) string {
+	return WeChatSign(params, w.config.APIKey)
+}
+
+// WeChatSign 微信支付(V2) MD5 签名：非空参数按键名排序拼接后追加 key
+func WeChatSign(params map[string]string, apiKey string) string {
 	var keys []string
 	for k := range params {
 		if k != "sign" && params[k] != "" {
@@ -138,16 +275,84 @@ func (w *WeChatPayment) sign(params map[string]string) string {
 		buf.WriteString("&")
 	}
 	buf.WriteString("key=")
-	buf.WriteString(w.config.APIKey)
+	buf.WriteString(apiKey)
 
 	hash := md5.Sum([]byte(buf.String()))
 	return strings.ToUpper(hex.EncodeToString(hash[:]))
 }
 
+// EncodeWeChatXML 将参数编码为微信接口使用的扁平 XML
+func EncodeWeChatXML(params map[string]string) []byte {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("<xml>")
+	for _, k := range keys {
+		buf.WriteString("<" + k + "><![CDATA[")
+		buf.WriteString(strings.ReplaceAll(params[k], "]]>", "]]]]><![CDATA[>"))
+		buf.WriteString("]]></" + k + ">")
+	}
+	buf.WriteString("</xml>")
+	return buf.Bytes()
+}
+
+// DecodeWeChatXML 解析微信接口的扁平 XML
+func DecodeWeChatXML(body []byte) (map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	params := make(map[string]string)
+	depth := 0
+	var key string
+	var value strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				params[key] = value.String()
+			}
+			depth--
+		}
+	}
+	if len(params) == 0 {
+		return nil, errors.New("empty xml")
+	}
+	return params, nil
+}
+
+func nonceStr() string {
+	return strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
 // ============================================================
 // 支付宝 Provider
 // ============================================================
 
+// 支付宝开放平台网关
+const (
+	AlipayGatewayURL        = "https://openapi.alipay.com/gateway.do"
+	AlipaySandboxGatewayURL = "https://openapi-sandbox.dl.alipaydev.com/gateway.do"
+)
+
 // AlipayConfig 支付宝配置
 type AlipayConfig struct {
 	AppID      string
@@ -155,98 +360,284 @@ type AlipayConfig struct {
 	PublicKey  string
 	Sandbox    bool
 	NotifyURL  string
+	GatewayURL string // 网关地址，为空时按 Sandbox 使用官方正式或沙箱网关
 }
 
 // AlipayPayment 支付宝支付实现
 type AlipayPayment struct {
-	config AlipayConfig
-	client *http.Client
-	logger *zap.Logger
+	config     AlipayConfig
+	client     *http.Client
+	logger     *zap.Logger
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+	keyErr     error
+}
+
+// AlipayError 支付宝接口业务错误(code!=10000)
+type AlipayError struct {
+	Code    string `json:"code"`
+	Msg     string `json:"msg"`
+	SubCode string `json:"sub_code"`
+	SubMsg  string `json:"sub_msg"`
 }
 
-// NewAlipayPayment 创建支付宝支付实例
+func (e *AlipayError) Error() string {
+	return fmt.Sprintf("alipay: %s %s %s %s", e.Code, e.Msg, e.SubCode, e.SubMsg)
+}
+
+// NewAlipayPayment 创建支付宝支付实例，密钥无法解析时所有请求返回错误
 func NewAlipayPayment(config AlipayConfig, logger *zap.Logger) *AlipayPayment {
-	return &AlipayPayment{
+	if config.GatewayURL == "" {
+		config.GatewayURL = AlipayGatewayURL
+		if config.Sandbox {
+			config.GatewayURL = AlipaySandboxGatewayURL
+		}
+	}
+	a := &AlipayPayment{
 		config: config,
 		client: &http.Client{Timeout: 30 * time.Second},
 		logger: logger,
 	}
+	if a.privateKey, a.keyErr = ParseRSAPrivateKey(config.PrivateKey); a.keyErr == nil {
+		a.publicKey, a.keyErr = ParseRSAPublicKey(config.PublicKey)
+	}
+	if a.keyErr != nil {
+		logger.Warn("alipay key configuration invalid", zap.Error(a.keyErr))
+	}
+	return a
 }
 
+// CreatePayment 生成 APP 支付 order_string，orderNo 作为商户订单号 out_trade_no
 func (a *AlipayPayment) CreatePayment(orderNo string, amount int64, description string) (*PaymentResult, error) {
-	paymentNo := fmt.Sprintf("ALI_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8])
-
-	// 构建支付宝APP支付请求参数
-	bizContent := map[string]interface{}{
+	params, err := a.signedParams("alipay.trade.app.pay", map[string]interface{}{
 		"out_trade_no": orderNo,
-		"total_amount": fmt.Sprintf("%.2f", float64(amount)/100),
+		"total_amount": formatYuan(amount),
 		"subject":      description,
 		"product_code": "QUICK_MSECURITY_PAY",
+	}, true)
+	if err != nil {
+		return nil, err
 	}
 
-	bizContentJSON, _ := json.Marshal(bizContent)
-
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	params := url.Values{}
-	params.Set("app_id", a.config.AppID)
-	params.Set("method", "alipay.trade.app.pay")
-	params.Set("charset", "utf-8")
-	params.Set("sign_type", "RSA2")
-	params.Set("timestamp", timestamp)
-	params.Set("version", "1.0")
-	params.Set("notify_url", a.config.NotifyURL)
-	params.Set("biz_content", string(bizContentJSON))
-
-	// 生产环境应使用RSA2签名
-	// params.Set("sign", a.rsaSign(params))
-
 	a.logger.Info("alipay payment created",
-		zap.String("order_no", orderNo),
+		zap.String("payment_no", orderNo),
 		zap.Int64("amount", amount),
-		zap.String("payment_no", paymentNo),
 	)
 
 	payParams := map[string]string{
 		"order_string": params.Encode(),
-		"payment_no":   paymentNo,
+		"payment_no":   orderNo,
 	}
 	payParamsJSON, _ := json.Marshal(payParams)
 
 	return &PaymentResult{
-		PaymentNo: paymentNo,
+		PaymentNo: orderNo,
 		PayParams: string(payParamsJSON),
 	}, nil
 }
 
+// QueryPayment 统一收单交易查询 alipay.trade.query
 func (a *AlipayPayment) QueryPayment(paymentNo string) (*PaymentStatus, error) {
-	a.logger.Info("alipay query payment", zap.String("payment_no", paymentNo))
-
-	// 生产环境应调用支付宝查询接口
-	// alipay.trade.query
-	return &PaymentStatus{
-		PaymentNo:    paymentNo,
-		Status:       "pending",
-		ThirdPartyNo: "",
-	}, nil
+	var resp struct {
+		TradeNo     string `json:"trade_no"`
+		TradeStatus string `json:"trade_status"`
+		TotalAmount string `json:"total_amount"`
+	}
+	err := a.execute("alipay.trade.query", map[string]interface{}{"out_trade_no": paymentNo}, &resp)
+	var aliErr *AlipayError
+	if errors.As(err, &aliErr) && aliErr.SubCode == "ACQ.TRADE_NOT_EXIST" {
+		// 用户尚未扫码/调起支付时交易不存在
+		return &PaymentStatus{PaymentNo: paymentNo, Status: StatusPending}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PaymentStatus{PaymentNo: paymentNo, ThirdPartyNo: resp.TradeNo, Amount: parseYuan(resp.TotalAmount)}
+	switch resp.TradeStatus {
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		status.Status = StatusPaid
+	case "TRADE_CLOSED":
+		status.Status = StatusClosed
+	default: // WAIT_BUYER_PAY
+		status.Status = StatusPending
+	}
+	return status, nil
 }
 
+// Refund 统一收单交易退款 alipay.trade.refund
 func (a *AlipayPayment) Refund(paymentNo string, amount int64) (*RefundResult, error) {
 	refundNo := fmt.Sprintf("ALIR_%d_%s", time.Now().UnixMilli(), uuid.New().String()[:8])
+	var resp struct {
+		FundChange string `json:"fund_change"`
+	}
+	if err := a.execute("alipay.trade.refund", map[string]interface{}{
+		"out_trade_no":   paymentNo,
+		"refund_amount":  formatYuan(amount),
+		"out_request_no": refundNo,
+	}, &resp); err != nil {
+		return nil, err
+	}
 
 	a.logger.Info("alipay refund",
 		zap.String("payment_no", paymentNo),
 		zap.Int64("amount", amount),
 		zap.String("refund_no", refundNo),
 	)
-
-	// 生产环境应调用支付宝退款接口
-	// alipay.trade.refund
+	status := "processing"
+	if resp.FundChange == "Y" {
+		status = "refunded"
+	}
 	return &RefundResult{
 		RefundNo: refundNo,
-		Status:   "processing",
+		Status:   status,
 	}, nil
 }
 
+// ParseNotify 校验并解析异步通知(application/x-www-form-urlencoded)
+func (a *AlipayPayment) ParseNotify(body []byte) (*Notification, error) {
+	if a.keyErr != nil {
+		return nil, a.keyErr
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAlipayParams(form, a.publicKey); err != nil {
+		return nil, err
+	}
+	if form.Get("app_id") != a.config.AppID {
+		return nil, ErrMerchantMismatch
+	}
+	n := &Notification{
+		PaymentNo:    form.Get("out_trade_no"),
+		ThirdPartyNo: form.Get("trade_no"),
+		Amount:       parseYuan(form.Get("total_amount")),
+		Status:       StatusPending,
+	}
+	switch form.Get("trade_status") {
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		n.Status = StatusPaid
+	case "TRADE_CLOSED":
+		n.Status = StatusClosed
+	}
+	return n, nil
+}
+
+// signedParams 组装并签名公共请求参数
+func (a *AlipayPayment) signedParams(method string, bizContent map[string]interface{}, withNotify bool) (url.Values, error) {
+	if a.keyErr != nil {
+		return nil, a.keyErr
+	}
+	bizContentJSON, err := json.Marshal(bizContent)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("app_id", a.config.AppID)
+	params.Set("method", method)
+	params.Set("format", "JSON")
+	params.Set("charset", "utf-8")
+	params.Set("sign_type", "RSA2")
+	params.Set("timestamp", time.Now().Format("2006-01-02 15:04:05"))
+	params.Set("version", "1.0")
+	if withNotify && a.config.NotifyURL != "" {
+		params.Set("notify_url", a.config.NotifyURL)
+	}
+	params.Set("biz_content", string(bizContentJSON))
+
+	sign, err := rsa2Sign(a.privateKey, AlipaySignContent(params, false))
+	if err != nil {
+		return nil, err
+	}
+	params.Set("sign", sign)
+	return params, nil
+}
+
+// execute 调用网关接口，校验响应签名后将 <method>_response 解析到 out
+func (a *AlipayPayment) execute(method string, bizContent map[string]interface{}, out interface{}) error {
+	params, err := a.signedParams(method, bizContent, false)
+	if err != nil {
+		return err
+	}
+	httpResp, err := a.client.PostForm(a.config.GatewayURL, params)
+	if err != nil {
+		return fmt.Errorf("alipay %s: %w", method, err)
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("alipay %s: %w", method, err)
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("alipay %s: %w", method, err)
+	}
+	raw, ok := envelope[strings.ReplaceAll(method, ".", "_")+"_response"]
+	if !ok {
+		return fmt.Errorf("alipay %s: missing response node", method)
+	}
+	var sign string
+	if rawSign, ok := envelope["sign"]; ok {
+		_ = json.Unmarshal(rawSign, &sign)
+	}
+
+	var result AlipayError
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("alipay %s: %w", method, err)
+	}
+	// 签名覆盖响应节点原文；网关层错误(如验签失败)可能不带签名
+	if sign != "" || result.Code == "10000" {
+		if err := rsa2Verify(a.publicKey, string(raw), sign); err != nil {
+			return err
+		}
+	}
+	if result.Code != "10000" {
+		return &result
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// AlipaySignContent 待签名串：非空参数按键名排序后以 & 拼接，通知验签时同时排除 sign_type
+func AlipaySignContent(params url.Values, excludeSignType bool) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k == "sign" || (excludeSignType && k == "sign_type") || params.Get(k) == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+params.Get(k))
+	}
+	return strings.Join(parts, "&")
+}
+
+func verifyAlipayParams(params url.Values, publicKey *rsa.PublicKey) error {
+	if params.Get("sign_type") != "" && params.Get("sign_type") != "RSA2" {
+		return ErrInvalidSignature
+	}
+	return rsa2Verify(publicKey, AlipaySignContent(params, true), params.Get("sign"))
+}
+
+// formatYuan 分转元字符串
+func formatYuan(amount int64) string {
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+// parseYuan 元字符串转分，无法解析时返回 0
+func parseYuan(value string) int64 {
+	yuan, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(yuan * 100))
+}
+
 // ============================================================
 // 支付Provider工厂函数
 // ============================================================
@@ -267,23 +658,33 @@ func NewPaymentProvider(method string, wechatCfg *WeChatPayConfig, alipayCfg *Al
 	return NewMockPayment(logger)
 }
 
-// VerifyWeChatCallback 验证微信支付回调签名
+// VerifyWeChatCallback 验证微信支付回调签名，返回通知参数
 func VerifyWeChatCallback(body []byte, apiKey string) (map[string]string, error) {
-	// 生产环境应解析微信XML回调数据并验证签名
-	// 这里提供接口框架，具体实现需要根据微信文档完成
-	_ = body
-	_ = apiKey
-	return nil, fmt.Errorf("wechat callback verification not implemented - requires production API key")
+	params, err := DecodeWeChatXML(body)
+	if err != nil {
+		return nil, err
+	}
+	if params["return_code"] != "SUCCESS" {
+		return nil, fmt.Errorf("wechat callback: %s", params["return_msg"])
+	}
+	if params["sign"] == "" || params["sign"] != WeChatSign(params, apiKey) {
+		return nil, ErrInvalidSignature
+	}
+	return params, nil
 }
 
-// VerifyAlipayCallback 验证支付宝回调签名
+// VerifyAlipayCallback 验证支付宝回调 RSA2 签名，返回通知参数
 func VerifyAlipayCallback(params url.Values, publicKey string) (map[string]string, error) {
-	// 生产环境应验证支付宝RSA2签名
-	// 这里提供接口框架，具体实现需要根据支付宝文档完成
-	_ = params
-	_ = publicKey
-	return nil, fmt.Errorf("alipay callback verification not implemented - requires production keys")
+	key, err := ParseRSAPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAlipayParams(params, key); err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(params))
+	for k := range params {
+		result[k] = params.Get(k)
+	}
+	return result, nil
 }
-
-// unused import guard
-var _ = io.ReadAll
@@ -0,0 +1,547 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SandboxConfig 本地支付沙箱配置
+type SandboxConfig struct {
+	WeChatAppID  string
+	WeChatMchID  string
+	WeChatAPIKey string
+
+	AlipayAppID        string
+	AlipayPrivateKey   *rsa.PrivateKey // 沙箱以“支付宝”身份签名响应与通知，其公钥即后端的 payment.alipay.public_key
+	AlipayAppPublicKey *rsa.PublicKey  // 应用公钥，用于校验后端请求签名，为空时不校验
+
+	NotifyDelay   time.Duration // 支付完成后多久发送异步通知
+	NotifyRetries int           // 通知失败重试次数
+	DropNotify    bool          // 不发送异步通知，用于验证主动查询
+}
+
+// SandboxTrade 沙箱中的一笔交易
+type SandboxTrade struct {
+	Channel   string     `json:"channel"`
+	PaymentNo string     `json:"payment_no"` // 商户订单号 out_trade_no
+	TradeNo   string     `json:"trade_no"`
+	Amount    int64      `json:"amount"`
+	Refunded  int64      `json:"refunded"`
+	Status    string     `json:"status"` // pending, paid, closed, refunded
+	NotifyURL string     `json:"notify_url"`
+	Notified  bool       `json:"notified"`
+	CreatedAt time.Time  `json:"created_at"`
+	PaidAt    *time.Time `json:"paid_at,omitempty"`
+}
+
+// Sandbox 本地支付沙箱，模拟微信支付(V2)与支付宝开放平台的下单、查询、退款接口及异步通知
+// 后端将 gateway_url 指向沙箱后即可在本地走通 下单 → 支付 → 回调/主动查询 的完整链路
+type Sandbox struct {
+	config SandboxConfig
+	client *http.Client
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	seq     int64
+	trades  map[string]*SandboxTrade
+	payouts map[string]*SandboxPayout
+}
+
+// NewSandbox 创建支付沙箱
+func NewSandbox(config SandboxConfig, logger *zap.Logger) *Sandbox {
+	return &Sandbox{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		logger:  logger,
+		trades:  make(map[string]*SandboxTrade),
+		payouts: make(map[string]*SandboxPayout),
+	}
+}
+
+// Handler 沙箱 HTTP 路由
+//
+//	POST /pay/unifiedorder, /pay/orderquery, /secapi/pay/refund  微信支付接口
+//	POST /mmpaymkttransfers/promotion/transfers, /gettransferinfo 微信企业付款
+//	POST /gateway.do                                             支付宝网关(alipay.trade.query/refund, alipay.fund.trans.*)
+//	POST /sandbox/pay                                            模拟用户完成(或关闭)支付
+//	POST /sandbox/payout                                         模拟处理中的出款到账(或失败)
+//	GET  /sandbox/trades, /sandbox/payouts                       查看沙箱交易与出款
+func (s *Sandbox) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pay/unifiedorder", s.wechatUnifiedOrder)
+	mux.HandleFunc("/pay/orderquery", s.wechatOrderQuery)
+	mux.HandleFunc("/secapi/pay/refund", s.wechatRefund)
+	mux.HandleFunc("/mmpaymkttransfers/promotion/transfers", s.wechatTransfer)
+	mux.HandleFunc("/mmpaymkttransfers/gettransferinfo", s.wechatTransferQuery)
+	mux.HandleFunc("/gateway.do", s.alipayGateway)
+	mux.HandleFunc("/sandbox/pay", s.handlePay)
+	mux.HandleFunc("/sandbox/trades", s.handleTrades)
+	mux.HandleFunc("/sandbox/payout", s.handlePayout)
+	mux.HandleFunc("/sandbox/payouts", s.handlePayouts)
+	return mux
+}
+
+// Complete 模拟用户支付结果，result 为 paid 或 closed
+// 支付宝 APP 支付没有服务端下单，首次支付时需传入后端生成的 order_string
+func (s *Sandbox) Complete(channel, paymentNo, orderString, result string) (*SandboxTrade, error) {
+	if result == "" {
+		result = StatusPaid
+	}
+	if result != StatusPaid && result != StatusClosed {
+		return nil, fmt.Errorf("unsupported result %q", result)
+	}
+	if channel == "alipay" && orderString != "" {
+		registered, err := s.registerAlipayOrder(orderString)
+		if err != nil {
+			return nil, err
+		}
+		paymentNo = registered
+	}
+
+	s.mu.Lock()
+	trade := s.trades[tradeKey(channel, paymentNo)]
+	if trade == nil {
+		s.mu.Unlock()
+		return nil, errors.New("trade not found")
+	}
+	if trade.Status != StatusPending {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("trade is %s", trade.Status)
+	}
+	now := time.Now()
+	trade.Status = result
+	if result == StatusPaid {
+		s.seq++
+		trade.TradeNo = fmt.Sprintf("SBX%s%s%06d", strings.ToUpper(channel[:2]), now.Format("20060102150405"), s.seq)
+		trade.PaidAt = &now
+	}
+	snapshot := *trade
+	s.mu.Unlock()
+
+	s.logger.Info("sandbox trade completed", zap.String("channel", channel), zap.String("payment_no", paymentNo), zap.String("status", result))
+	if !s.config.DropNotify && snapshot.NotifyURL != "" {
+		go s.deliverNotify(snapshot)
+	}
+	return &snapshot, nil
+}
+
+// Trades 返回全部沙箱交易
+func (s *Sandbox) Trades() []SandboxTrade {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades := make([]SandboxTrade, 0, len(s.trades))
+	for _, trade := range s.trades {
+		trades = append(trades, *trade)
+	}
+	sort.Slice(trades, func(i, j int) bool { return trades[i].CreatedAt.Before(trades[j].CreatedAt) })
+	return trades
+}
+
+func tradeKey(channel, paymentNo string) string {
+	return channel + ":" + paymentNo
+}
+
+// ==================== 沙箱控制接口 ====================
+
+func (s *Sandbox) handlePay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trade, err := s.Complete(r.Form.Get("channel"), r.Form.Get("payment_no"), r.Form.Get("order_string"), r.Form.Get("result"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSandboxJSON(w, trade)
+}
+
+func (s *Sandbox) handleTrades(w http.ResponseWriter, r *http.Request) {
+	writeSandboxJSON(w, s.Trades())
+}
+
+func writeSandboxJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ==================== 微信支付 ====================
+
+func (s *Sandbox) readWeChatRequest(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		s.wechatFail(w, "read body failed")
+		return nil, false
+	}
+	params, err := DecodeWeChatXML(body)
+	if err != nil {
+		s.wechatFail(w, "invalid xml")
+		return nil, false
+	}
+	if params["sign"] != WeChatSign(params, s.config.WeChatAPIKey) {
+		s.wechatFail(w, "签名错误")
+		return nil, false
+	}
+	if params["appid"] != s.config.WeChatAppID || params["mch_id"] != s.config.WeChatMchID {
+		s.wechatFail(w, "appid和mch_id不匹配")
+		return nil, false
+	}
+	return params, true
+}
+
+func (s *Sandbox) wechatFail(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(EncodeWeChatXML(map[string]string{"return_code": "FAIL", "return_msg": msg}))
+}
+
+func (s *Sandbox) wechatReply(w http.ResponseWriter, params map[string]string) {
+	params["return_code"] = "SUCCESS"
+	params["return_msg"] = "OK"
+	params["appid"] = s.config.WeChatAppID
+	params["mch_id"] = s.config.WeChatMchID
+	params["nonce_str"] = nonceStr()
+	if params["result_code"] == "" {
+		params["result_code"] = "SUCCESS"
+	}
+	params["sign"] = WeChatSign(params, s.config.WeChatAPIKey)
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(EncodeWeChatXML(params))
+}
+
+func wechatBizFail(code, desc string) map[string]string {
+	return map[string]string{"result_code": "FAIL", "err_code": code, "err_code_des": desc}
+}
+
+func (s *Sandbox) wechatUnifiedOrder(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.readWeChatRequest(w, r)
+	if !ok {
+		return
+	}
+	amount, err := strconv.ParseInt(params["total_fee"], 10, 64)
+	if err != nil || amount <= 0 || params["out_trade_no"] == "" {
+		s.wechatReply(w, wechatBizFail("PARAM_ERROR", "参数错误"))
+		return
+	}
+
+	s.mu.Lock()
+	key := tradeKey("wechat", params["out_trade_no"])
+	if existing := s.trades[key]; existing != nil && existing.Status != StatusPending {
+		s.mu.Unlock()
+		s.wechatReply(w, wechatBizFail("ORDERPAID", "该订单已支付或已关闭"))
+		return
+	}
+	s.seq++
+	prepayID := fmt.Sprintf("wx%s%06d", time.Now().Format("20060102150405"), s.seq)
+	s.trades[key] = &SandboxTrade{
+		Channel:   "wechat",
+		PaymentNo: params["out_trade_no"],
+		Amount:    amount,
+		Status:    StatusPending,
+		NotifyURL: params["notify_url"],
+		CreatedAt: time.Now(),
+	}
+	s.mu.Unlock()
+
+	s.wechatReply(w, map[string]string{"prepay_id": prepayID, "trade_type": params["trade_type"]})
+}
+
+func (s *Sandbox) wechatOrderQuery(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.readWeChatRequest(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	trade := s.trades[tradeKey("wechat", params["out_trade_no"])]
+	var snapshot SandboxTrade
+	if trade != nil {
+		snapshot = *trade
+	}
+	s.mu.Unlock()
+	if trade == nil {
+		s.wechatReply(w, wechatBizFail("ORDERNOTEXIST", "此交易订单号不存在"))
+		return
+	}
+
+	states := map[string]string{StatusPending: "NOTPAY", StatusPaid: "SUCCESS", StatusClosed: "CLOSED", StatusRefunded: "REFUND"}
+	s.wechatReply(w, map[string]string{
+		"out_trade_no":   snapshot.PaymentNo,
+		"transaction_id": snapshot.TradeNo,
+		"trade_state":    states[snapshot.Status],
+		"total_fee":      strconv.FormatInt(snapshot.Amount, 10),
+	})
+}
+
+func (s *Sandbox) wechatRefund(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.readWeChatRequest(w, r)
+	if !ok {
+		return
+	}
+	refundFee, _ := strconv.ParseInt(params["refund_fee"], 10, 64)
+	refundID, err := s.refund("wechat", params["out_trade_no"], refundFee)
+	if err != nil {
+		s.wechatReply(w, wechatBizFail("ERROR", err.Error()))
+		return
+	}
+	s.wechatReply(w, map[string]string{
+		"out_trade_no":  params["out_trade_no"],
+		"out_refund_no": params["out_refund_no"],
+		"refund_id":     refundID,
+		"refund_fee":    params["refund_fee"],
+	})
+}
+
+func (s *Sandbox) refund(channel, paymentNo string, amount int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trade := s.trades[tradeKey(channel, paymentNo)]
+	if trade == nil {
+		return "", errors.New("交易不存在")
+	}
+	if trade.Status != StatusPaid {
+		return "", fmt.Errorf("交易状态 %s 不允许退款", trade.Status)
+	}
+	if amount <= 0 || amount > trade.Amount-trade.Refunded {
+		return "", errors.New("退款金额超过可退金额")
+	}
+	trade.Refunded += amount
+	if trade.Refunded == trade.Amount {
+		trade.Status = StatusRefunded
+	}
+	s.seq++
+	return fmt.Sprintf("SBXR%s%06d", time.Now().Format("20060102150405"), s.seq), nil
+}
+
+// ==================== 支付宝 ====================
+
+func (s *Sandbox) alipayGateway(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := r.Form.Get("method")
+	node := strings.ReplaceAll(method, ".", "_") + "_response"
+	if err := s.verifyAlipayRequest(r.Form); err != nil {
+		s.alipayReply(w, node, map[string]interface{}{"code": "40002", "msg": "Invalid Arguments", "sub_code": "isv.invalid-signature", "sub_msg": err.Error()})
+		return
+	}
+
+	var biz struct {
+		OutTradeNo   string `json:"out_trade_no"`
+		RefundAmount string `json:"refund_amount"`
+	}
+	if err := json.Unmarshal([]byte(r.Form.Get("biz_content")), &biz); err != nil {
+		s.alipayReply(w, node, map[string]interface{}{"code": "40002", "msg": "Invalid Arguments", "sub_code": "isv.invalid-biz-content"})
+		return
+	}
+
+	switch method {
+	case "alipay.fund.trans.uni.transfer", "alipay.fund.trans.common.query":
+		s.alipayPayout(w, node, method, r.Form.Get("biz_content"))
+	case "alipay.trade.query":
+		s.mu.Lock()
+		trade := s.trades[tradeKey("alipay", biz.OutTradeNo)]
+		var snapshot SandboxTrade
+		if trade != nil {
+			snapshot = *trade
+		}
+		s.mu.Unlock()
+		if trade == nil {
+			s.alipayReply(w, node, map[string]interface{}{"code": "40004", "msg": "Business Failed", "sub_code": "ACQ.TRADE_NOT_EXIST", "sub_msg": "交易不存在"})
+			return
+		}
+		s.alipayReply(w, node, map[string]interface{}{
+			"code":         "10000",
+			"msg":          "Success",
+			"out_trade_no": snapshot.PaymentNo,
+			"trade_no":     snapshot.TradeNo,
+			"trade_status": alipayTradeStatus(snapshot.Status),
+			"total_amount": formatYuan(snapshot.Amount),
+		})
+	case "alipay.trade.refund":
+		amount := parseYuan(biz.RefundAmount)
+		if _, err := s.refund("alipay", biz.OutTradeNo, amount); err != nil {
+			s.alipayReply(w, node, map[string]interface{}{"code": "40004", "msg": "Business Failed", "sub_code": "ACQ.TRADE_STATUS_ERROR", "sub_msg": err.Error()})
+			return
+		}
+		s.alipayReply(w, node, map[string]interface{}{
+			"code":         "10000",
+			"msg":          "Success",
+			"out_trade_no": biz.OutTradeNo,
+			"refund_fee":   biz.RefundAmount,
+			"fund_change":  "Y",
+		})
+	default:
+		s.alipayReply(w, node, map[string]interface{}{"code": "40004", "msg": "Business Failed", "sub_code": "isv.invalid-method"})
+	}
+}
+
+func (s *Sandbox) verifyAlipayRequest(form url.Values) error {
+	if form.Get("app_id") != s.config.AlipayAppID {
+		return ErrMerchantMismatch
+	}
+	if s.config.AlipayAppPublicKey == nil {
+		return nil
+	}
+	return rsa2Verify(s.config.AlipayAppPublicKey, AlipaySignContent(form, false), form.Get("sign"))
+}
+
+// alipayReply 响应节点原文参与签名，按 {"<node>":{...},"sign":"..."} 输出
+func (s *Sandbox) alipayReply(w http.ResponseWriter, node string, payload map[string]interface{}) {
+	raw, _ := json.Marshal(payload)
+	sign, err := rsa2Sign(s.config.AlipayPrivateKey, string(raw))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signJSON, _ := json.Marshal(sign)
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	fmt.Fprintf(w, `{"%s":%s,"sign":%s}`, node, raw, signJSON)
+}
+
+// registerAlipayOrder 解析后端生成的 APP 支付 order_string 并登记交易
+func (s *Sandbox) registerAlipayOrder(orderString string) (string, error) {
+	form, err := url.ParseQuery(orderString)
+	if err != nil {
+		return "", err
+	}
+	if err := s.verifyAlipayRequest(form); err != nil {
+		return "", err
+	}
+	var biz struct {
+		OutTradeNo  string `json:"out_trade_no"`
+		TotalAmount string `json:"total_amount"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("biz_content")), &biz); err != nil || biz.OutTradeNo == "" {
+		return "", errors.New("invalid biz_content")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tradeKey("alipay", biz.OutTradeNo)
+	if s.trades[key] == nil {
+		s.trades[key] = &SandboxTrade{
+			Channel:   "alipay",
+			PaymentNo: biz.OutTradeNo,
+			Amount:    parseYuan(biz.TotalAmount),
+			Status:    StatusPending,
+			NotifyURL: form.Get("notify_url"),
+			CreatedAt: time.Now(),
+		}
+	}
+	return biz.OutTradeNo, nil
+}
+
+func alipayTradeStatus(status string) string {
+	switch status {
+	case StatusPaid:
+		return "TRADE_SUCCESS"
+	case StatusClosed, StatusRefunded:
+		return "TRADE_CLOSED"
+	}
+	return "WAIT_BUYER_PAY"
+}
+
+// ==================== 异步通知 ====================
+
+// deliverNotify 按渠道格式发送异步通知，失败按 1s,2s,4s... 重试
+func (s *Sandbox) deliverNotify(trade SandboxTrade) {
+	if s.config.NotifyDelay > 0 {
+		time.Sleep(s.config.NotifyDelay)
+	}
+	body, contentType, ack, err := s.buildNotify(trade)
+	if err != nil {
+		s.logger.Warn("sandbox notify build failed", zap.String("payment_no", trade.PaymentNo), zap.Error(err))
+		return
+	}
+
+	for attempt := 0; attempt <= s.config.NotifyRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<(attempt-1)) * time.Second)
+		}
+		resp, err := s.client.Post(trade.NotifyURL, contentType, bytes.NewReader(body))
+		if err != nil {
+			s.logger.Warn("sandbox notify failed", zap.String("payment_no", trade.PaymentNo), zap.Int("attempt", attempt+1), zap.Error(err))
+			continue
+		}
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && ack(reply) {
+			s.mu.Lock()
+			if current := s.trades[tradeKey(trade.Channel, trade.PaymentNo)]; current != nil {
+				current.Notified = true
+			}
+			s.mu.Unlock()
+			s.logger.Info("sandbox notify delivered", zap.String("payment_no", trade.PaymentNo))
+			return
+		}
+		s.logger.Warn("sandbox notify rejected", zap.String("payment_no", trade.PaymentNo), zap.Int("attempt", attempt+1), zap.ByteString("reply", reply))
+	}
+}
+
+func (s *Sandbox) buildNotify(trade SandboxTrade) ([]byte, string, func([]byte) bool, error) {
+	paidAt := time.Now()
+	if trade.PaidAt != nil {
+		paidAt = *trade.PaidAt
+	}
+	switch trade.Channel {
+	case "wechat":
+		resultCode := "SUCCESS"
+		if trade.Status != StatusPaid {
+			resultCode = "FAIL"
+		}
+		params := map[string]string{
+			"return_code":    "SUCCESS",
+			"result_code":    resultCode,
+			"appid":          s.config.WeChatAppID,
+			"mch_id":         s.config.WeChatMchID,
+			"nonce_str":      nonceStr(),
+			"out_trade_no":   trade.PaymentNo,
+			"transaction_id": trade.TradeNo,
+			"total_fee":      strconv.FormatInt(trade.Amount, 10),
+			"trade_type":     "APP",
+			"time_end":       paidAt.Format("20060102150405"),
+		}
+		params["sign"] = WeChatSign(params, s.config.WeChatAPIKey)
+		ack := func(reply []byte) bool { return bytes.Contains(reply, []byte("SUCCESS")) }
+		return EncodeWeChatXML(params), "application/xml", ack, nil
+	case "alipay":
+		form := url.Values{}
+		form.Set("notify_time", time.Now().Format("2006-01-02 15:04:05"))
+		form.Set("notify_type", "trade_status_sync")
+		form.Set("notify_id", nonceStr())
+		form.Set("app_id", s.config.AlipayAppID)
+		form.Set("charset", "utf-8")
+		form.Set("version", "1.0")
+		form.Set("sign_type", "RSA2")
+		form.Set("out_trade_no", trade.PaymentNo)
+		form.Set("trade_no", trade.TradeNo)
+		form.Set("trade_status", alipayTradeStatus(trade.Status))
+		form.Set("total_amount", formatYuan(trade.Amount))
+		form.Set("gmt_payment", paidAt.Format("2006-01-02 15:04:05"))
+		sign, err := rsa2Sign(s.config.AlipayPrivateKey, AlipaySignContent(form, true))
+		if err != nil {
+			return nil, "", nil, err
+		}
+		form.Set("sign", sign)
+		ack := func(reply []byte) bool { return strings.TrimSpace(string(reply)) == "success" }
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", ack, nil
+	}
+	return nil, "", nil, fmt.Errorf("unknown channel %q", trade.Channel)
+}
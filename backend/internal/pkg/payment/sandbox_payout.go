@@ -0,0 +1,238 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SandboxPayout 沙箱中的一笔出款
+// 收款账号以 fail 开头时直接失败，以 pending 开头时保持处理中直到调用 CompletePayout，其余立即到账
+type SandboxPayout struct {
+	Channel    string    `json:"channel"`
+	PayoutNo   string    `json:"payout_no"`
+	TradeNo    string    `json:"trade_no"`
+	Account    string    `json:"account"`
+	Amount     int64     `json:"amount"`
+	Status     string    `json:"status"` // processing, succeeded, failed
+	FailReason string    `json:"fail_reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CompletePayout 模拟处理中的出款结果，result 为 succeeded 或 failed
+func (s *Sandbox) CompletePayout(channel, payoutNo, result string) (*SandboxPayout, error) {
+	if result == "" {
+		result = PayoutSucceeded
+	}
+	if result != PayoutSucceeded && result != PayoutFailed {
+		return nil, fmt.Errorf("unsupported result %q", result)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payout := s.payouts[tradeKey(channel, payoutNo)]
+	if payout == nil {
+		return nil, errors.New("payout not found")
+	}
+	if payout.Status != PayoutProcessing {
+		return nil, fmt.Errorf("payout is %s", payout.Status)
+	}
+	payout.Status = result
+	if result == PayoutFailed {
+		payout.FailReason = "收款账户状态异常"
+	}
+	snapshot := *payout
+	return &snapshot, nil
+}
+
+// Payouts 返回全部沙箱出款
+func (s *Sandbox) Payouts() []SandboxPayout {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payouts := make([]SandboxPayout, 0, len(s.payouts))
+	for _, payout := range s.payouts {
+		payouts = append(payouts, *payout)
+	}
+	sort.Slice(payouts, func(i, j int) bool { return payouts[i].CreatedAt.Before(payouts[j].CreatedAt) })
+	return payouts
+}
+
+// registerPayout 登记出款，同一出款单号重复提交返回已有记录
+func (s *Sandbox) registerPayout(channel, payoutNo, account string, amount int64) SandboxPayout {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tradeKey(channel, payoutNo)
+	if existing := s.payouts[key]; existing != nil {
+		return *existing
+	}
+	s.seq++
+	payout := &SandboxPayout{
+		Channel:   channel,
+		PayoutNo:  payoutNo,
+		TradeNo:   fmt.Sprintf("SBXP%s%06d", time.Now().Format("20060102150405"), s.seq),
+		Account:   account,
+		Amount:    amount,
+		Status:    PayoutSucceeded,
+		CreatedAt: time.Now(),
+	}
+	switch {
+	case strings.HasPrefix(account, "fail"):
+		payout.Status = PayoutFailed
+		payout.FailReason = "收款账户状态异常"
+	case strings.HasPrefix(account, "pending"):
+		payout.Status = PayoutProcessing
+	}
+	s.payouts[key] = payout
+	s.logger.Info("sandbox payout registered", zap.String("channel", channel), zap.String("payout_no", payoutNo), zap.String("status", payout.Status))
+	return *payout
+}
+
+func (s *Sandbox) lookupPayout(channel, payoutNo string) (SandboxPayout, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payout := s.payouts[tradeKey(channel, payoutNo)]
+	if payout == nil {
+		return SandboxPayout{}, false
+	}
+	return *payout, true
+}
+
+func (s *Sandbox) handlePayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payout, err := s.CompletePayout(r.Form.Get("channel"), r.Form.Get("payout_no"), r.Form.Get("result"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSandboxJSON(w, payout)
+}
+
+func (s *Sandbox) handlePayouts(w http.ResponseWriter, r *http.Request) {
+	writeSandboxJSON(w, s.Payouts())
+}
+
+// ==================== 微信企业付款 ====================
+
+// readWeChatPayoutRequest 企业付款接口使用 mch_appid/mchid，查询接口使用 appid/mch_id
+func (s *Sandbox) readWeChatPayoutRequest(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		s.wechatFail(w, "read body failed")
+		return nil, false
+	}
+	params, err := DecodeWeChatXML(body)
+	if err != nil {
+		s.wechatFail(w, "invalid xml")
+		return nil, false
+	}
+	if params["sign"] != WeChatSign(params, s.config.WeChatAPIKey) {
+		s.wechatFail(w, "签名错误")
+		return nil, false
+	}
+	appID, mchID := params["mch_appid"]+params["appid"], params["mchid"]+params["mch_id"]
+	if appID != s.config.WeChatAppID || mchID != s.config.WeChatMchID {
+		s.wechatFail(w, "appid和mch_id不匹配")
+		return nil, false
+	}
+	return params, true
+}
+
+func (s *Sandbox) wechatTransfer(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.readWeChatPayoutRequest(w, r)
+	if !ok {
+		return
+	}
+	amount, err := strconv.ParseInt(params["amount"], 10, 64)
+	if err != nil || amount <= 0 || params["partner_trade_no"] == "" || params["openid"] == "" {
+		s.wechatReply(w, wechatBizFail("PARAM_ERROR", "参数错误"))
+		return
+	}
+	payout := s.registerPayout("wechat", params["partner_trade_no"], params["openid"], amount)
+	switch payout.Status {
+	case PayoutFailed:
+		s.wechatReply(w, wechatBizFail("V2_ACCOUNT_SIMPLE_BAN", payout.FailReason))
+	case PayoutProcessing:
+		s.wechatReply(w, wechatBizFail("SYSTEMERROR", "系统繁忙，请稍后查询"))
+	default:
+		s.wechatReply(w, map[string]string{
+			"partner_trade_no": payout.PayoutNo,
+			"payment_no":       payout.TradeNo,
+			"payment_time":     payout.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+}
+
+func (s *Sandbox) wechatTransferQuery(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.readWeChatPayoutRequest(w, r)
+	if !ok {
+		return
+	}
+	payout, found := s.lookupPayout("wechat", params["partner_trade_no"])
+	if !found {
+		s.wechatReply(w, wechatBizFail("NOT_FOUND", "指定单号数据不存在"))
+		return
+	}
+	states := map[string]string{PayoutProcessing: "PROCESSING", PayoutSucceeded: "SUCCESS", PayoutFailed: "FAILED"}
+	s.wechatReply(w, map[string]string{
+		"partner_trade_no": payout.PayoutNo,
+		"detail_id":        payout.TradeNo,
+		"status":           states[payout.Status],
+		"reason":           payout.FailReason,
+		"payment_amount":   strconv.FormatInt(payout.Amount, 10),
+	})
+}
+
+// ==================== 支付宝转账 ====================
+
+func (s *Sandbox) alipayPayout(w http.ResponseWriter, node, method, bizContent string) {
+	var biz struct {
+		OutBizNo    string `json:"out_biz_no"`
+		TransAmount string `json:"trans_amount"`
+		PayeeInfo   struct {
+			Identity string `json:"identity"`
+		} `json:"payee_info"`
+	}
+	if err := json.Unmarshal([]byte(bizContent), &biz); err != nil || biz.OutBizNo == "" {
+		s.alipayReply(w, node, map[string]interface{}{"code": "40002", "msg": "Invalid Arguments", "sub_code": "isv.invalid-biz-content"})
+		return
+	}
+
+	var payout SandboxPayout
+	if method == "alipay.fund.trans.uni.transfer" {
+		payout = s.registerPayout("alipay", biz.OutBizNo, biz.PayeeInfo.Identity, parseYuan(biz.TransAmount))
+		if payout.Status == PayoutFailed {
+			s.alipayReply(w, node, map[string]interface{}{"code": "40004", "msg": "Business Failed", "sub_code": "PAYEE_ACCOUNT_STATUS_ERROR", "sub_msg": payout.FailReason})
+			return
+		}
+	} else {
+		var found bool
+		if payout, found = s.lookupPayout("alipay", biz.OutBizNo); !found {
+			s.alipayReply(w, node, map[string]interface{}{"code": "40004", "msg": "Business Failed", "sub_code": "ORDER_NOT_EXIST", "sub_msg": "转账订单不存在"})
+			return
+		}
+	}
+
+	states := map[string]string{PayoutProcessing: "DEALING", PayoutSucceeded: "SUCCESS", PayoutFailed: "FAIL"}
+	s.alipayReply(w, node, map[string]interface{}{
+		"code":        "10000",
+		"msg":         "Success",
+		"out_biz_no":  payout.PayoutNo,
+		"order_id":    payout.TradeNo,
+		"status":      states[payout.Status],
+		"fail_reason": payout.FailReason,
+	})
+}
@@ -0,0 +1,177 @@
+package payment
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// notifyCollector 接收沙箱异步通知并交给渠道实现验签
+func notifyCollector(t *testing.T, parser NotifyParser, ack string) (*httptest.Server, <-chan *Notification) {
+	t.Helper()
+	received := make(chan *Notification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n, err := parser.ParseNotify(body)
+		if err != nil {
+			t.Errorf("parse notify: %v", err)
+			w.Write([]byte("FAIL"))
+			return
+		}
+		received <- n
+		w.Write([]byte(ack))
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func waitNotify(t *testing.T, ch <-chan *Notification) *Notification {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for notify")
+		return nil
+	}
+}
+
+func TestSandboxWeChatPaymentFlow(t *testing.T) {
+	sandbox := NewSandbox(SandboxConfig{WeChatAppID: "wx_test", WeChatMchID: "1900000001", WeChatAPIKey: "k"}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+
+	provider := NewWeChatPayment(WeChatPayConfig{AppID: "wx_test", MchID: "1900000001", APIKey: "k", GatewayURL: gateway.URL}, zap.NewNop())
+	notifyServer, received := notifyCollector(t, provider, "<xml><return_code>SUCCESS</return_code></xml>")
+	provider.config.NotifyURL = notifyServer.URL
+
+	result, err := provider.CreatePayment("PAY_WX_1", 8800, "测试订单")
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	var appParams map[string]string
+	json.Unmarshal([]byte(result.PayParams), &appParams)
+	if result.PaymentNo != "PAY_WX_1" || !strings.HasPrefix(appParams["prepayid"], "wx") {
+		t.Fatalf("unexpected pay params: %#v", result)
+	}
+
+	status, err := provider.QueryPayment("PAY_WX_1")
+	if err != nil || status.Status != StatusPending {
+		t.Fatalf("expected pending before payment, got %#v %v", status, err)
+	}
+
+	if _, err := sandbox.Complete("wechat", "PAY_WX_1", "", StatusPaid); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	n := waitNotify(t, received)
+	if n.PaymentNo != "PAY_WX_1" || n.Status != StatusPaid || n.Amount != 8800 || n.ThirdPartyNo == "" {
+		t.Fatalf("unexpected notification: %#v", n)
+	}
+
+	status, err = provider.QueryPayment("PAY_WX_1")
+	if err != nil || status.Status != StatusPaid || status.Amount != 8800 {
+		t.Fatalf("expected paid after payment, got %#v %v", status, err)
+	}
+	if _, err := provider.Refund("PAY_WX_1", 8800); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if status, _ := provider.QueryPayment("PAY_WX_1"); status.Status != StatusRefunded {
+		t.Fatalf("expected refunded, got %#v", status)
+	}
+}
+
+func TestWeChatNotifyRejectsTamperedSignature(t *testing.T) {
+	provider := NewWeChatPayment(WeChatPayConfig{AppID: "wx_test", MchID: "1900000001", APIKey: "k"}, zap.NewNop())
+	params := map[string]string{
+		"return_code": "SUCCESS", "result_code": "SUCCESS", "appid": "wx_test", "mch_id": "1900000001",
+		"out_trade_no": "PAY_WX_2", "transaction_id": "T1", "total_fee": "100",
+	}
+	params["sign"] = WeChatSign(params, "k")
+	if _, err := provider.ParseNotify(EncodeWeChatXML(params)); err != nil {
+		t.Fatalf("expected valid notify, got %v", err)
+	}
+
+	params["total_fee"] = "1"
+	if _, err := provider.ParseNotify(EncodeWeChatXML(params)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
+
+func TestSandboxAlipayPaymentFlow(t *testing.T) {
+	appKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	alipayKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	appPrivatePEM, _ := EncodeRSAPrivateKey(appKey)
+	alipayPublicPEM, _ := EncodeRSAPublicKey(&alipayKey.PublicKey)
+
+	sandbox := NewSandbox(SandboxConfig{
+		AlipayAppID:        "2021000000000001",
+		AlipayPrivateKey:   alipayKey,
+		AlipayAppPublicKey: &appKey.PublicKey,
+	}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+
+	provider := NewAlipayPayment(AlipayConfig{
+		AppID:      "2021000000000001",
+		PrivateKey: appPrivatePEM,
+		PublicKey:  alipayPublicPEM,
+		GatewayURL: gateway.URL + "/gateway.do",
+	}, zap.NewNop())
+	notifyServer, received := notifyCollector(t, provider, "success")
+	provider.config.NotifyURL = notifyServer.URL
+
+	result, err := provider.CreatePayment("PAY_ALI_1", 12345, "测试订单")
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	if status, err := provider.QueryPayment("PAY_ALI_1"); err != nil || status.Status != StatusPending {
+		t.Fatalf("expected pending before the app pays, got %#v %v", status, err)
+	}
+
+	var payParams map[string]string
+	json.Unmarshal([]byte(result.PayParams), &payParams)
+	if _, err := sandbox.Complete("alipay", "", payParams["order_string"], StatusPaid); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	n := waitNotify(t, received)
+	if n.PaymentNo != "PAY_ALI_1" || n.Status != StatusPaid || n.Amount != 12345 {
+		t.Fatalf("unexpected notification: %#v", n)
+	}
+
+	status, err := provider.QueryPayment("PAY_ALI_1")
+	if err != nil || status.Status != StatusPaid || status.Amount != 12345 {
+		t.Fatalf("expected paid, got %#v %v", status, err)
+	}
+	refund, err := provider.Refund("PAY_ALI_1", 345)
+	if err != nil || refund.Status != "refunded" {
+		t.Fatalf("expected refund, got %#v %v", refund, err)
+	}
+}
+
+func TestAlipayRejectsResponseSignedByUnknownKey(t *testing.T) {
+	appKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	alipayKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	appPrivatePEM, _ := EncodeRSAPrivateKey(appKey)
+	otherPublicPEM, _ := EncodeRSAPublicKey(&otherKey.PublicKey)
+
+	sandbox := NewSandbox(SandboxConfig{AlipayAppID: "app", AlipayPrivateKey: alipayKey}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+
+	provider := NewAlipayPayment(AlipayConfig{
+		AppID: "app", PrivateKey: appPrivatePEM, PublicKey: otherPublicPEM, GatewayURL: gateway.URL + "/gateway.do",
+	}, zap.NewNop())
+	if _, err := provider.QueryPayment("PAY_ALI_2"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
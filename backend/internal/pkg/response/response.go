@@ -52,6 +52,16 @@ func Error(c *gin.Context, code int, message string) {
 	})
 }
 
+// ErrorWithData 业务错误并附带明细，如逐项的不可行原因
+func ErrorWithData(c *gin.Context, code int, message string, data interface{}) {
+	c.JSON(http.StatusOK, Response{
+		Code:      code,
+		Message:   message,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
 func Unauthorized(c *gin.Context, message string) {
 	c.JSON(http.StatusUnauthorized, Response{
 		Code:      401,
@@ -34,6 +34,7 @@ const (
 	V2CodeConflict       = "CONFLICT"
 	V2CodeNotImplemented = "NOT_IMPLEMENTED"
 	V2CodeInternalError  = "INTERNAL_ERROR"
+	V2CodeOrderGate      = "ORDER_GATE_REJECTED"
 )
 
 func V2Success(c *gin.Context, data interface{}) {
@@ -73,6 +74,28 @@ func V2Error(c *gin.Context, httpStatus int, code, message string) {
 	})
 }
 
+// GateError 业务前置检查未通过的错误，v2 接口以 422 返回，data 为错误本身携带的逐项原因
+type GateError interface {
+	error
+	GateReasons() []string
+}
+
+// V2ErrorWithData 错误响应并在 data 中附带结构化的错误明细
+func V2ErrorWithData(c *gin.Context, httpStatus int, code, message string, data interface{}) {
+	if code == "" {
+		code = V2CodeInternalError
+	}
+	if message == "" {
+		message = "error"
+	}
+	c.JSON(httpStatus, V2Envelope{
+		Code:    code,
+		Message: message,
+		Data:    data,
+		TraceID: getV2TraceID(c),
+	})
+}
+
 func V2BadRequest(c *gin.Context, message string) {
 	V2Error(c, http.StatusBadRequest, V2CodeBadRequest, message)
 }
@@ -0,0 +1,141 @@
+package uom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HTTPConfig UOM 平台接入配置
+type HTTPConfig struct {
+	BaseURL     string
+	AppID       string
+	AppSecret   string // 请求签名与回调验签共用的密钥
+	CallbackURL string
+	Timeout     time.Duration
+}
+
+// HTTPGateway 通过 HTTP 接口对接 UOM 平台
+type HTTPGateway struct {
+	config HTTPConfig
+	client *http.Client
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewHTTPGateway 创建 UOM HTTP 网关
+func NewHTTPGateway(config HTTPConfig, logger *zap.Logger) *HTTPGateway {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &HTTPGateway{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// apiResponse UOM 接口统一响应
+type apiResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (g *HTTPGateway) Submit(req *SubmitRequest) (*SubmitResult, error) {
+	if req.CallbackURL == "" {
+		req.CallbackURL = g.config.CallbackURL
+	}
+	var result SubmitResult
+	if err := g.do(http.MethodPost, "/api/v1/flight-applications", req, &result); err != nil {
+		return nil, err
+	}
+	if result.ApplicationNo == "" {
+		return nil, fmt.Errorf("uom: submit returned empty application no")
+	}
+	return &result, nil
+}
+
+func (g *HTTPGateway) Query(applicationNo string) (*ApplicationStatus, error) {
+	var status ApplicationStatus
+	if err := g.do(http.MethodGet, "/api/v1/flight-applications/"+url.PathEscape(applicationNo), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (g *HTTPGateway) Cancel(applicationNo, reason string) error {
+	body := map[string]string{"reason": reason}
+	return g.do(http.MethodPost, "/api/v1/flight-applications/"+url.PathEscape(applicationNo)+"/cancel", body, nil)
+}
+
+func (g *HTTPGateway) VerifyCallback(body []byte, timestamp, signature string) (*CallbackPayload, error) {
+	return verifyCallback(g.config.AppSecret, body, timestamp, signature, g.now())
+}
+
+func (g *HTTPGateway) do(method, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("uom: marshal request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, g.config.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("uom: build request: %w", err)
+	}
+	timestamp := strconv.FormatInt(g.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderAppID, g.config.AppID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(g.config.AppSecret, timestamp, body))
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uom: request %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("uom: read response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		g.logger.Warn("uom request failed",
+			zap.String("path", path),
+			zap.Int("status", resp.StatusCode),
+			zap.ByteString("body", raw),
+		)
+		return fmt.Errorf("uom: %s %s returned HTTP %d", method, path, resp.StatusCode)
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("uom: decode response: %w", err)
+	}
+	if envelope.Code != 0 {
+		return fmt.Errorf("uom: %s (code %d)", envelope.Message, envelope.Code)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, out); err != nil {
+			return fmt.Errorf("uom: decode data: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package uom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 模拟器审批策略
+const (
+	DecisionApprove = "approve" // 全部批准
+	DecisionReject  = "reject"  // 全部驳回
+	DecisionAuto    = "auto"    // 超过限高驳回，其余批准
+)
+
+// SimulatorConfig 本地模拟器配置
+type SimulatorConfig struct {
+	DecisionDelay time.Duration // 提交后多久给出审批结果
+	Decision      string        // approve, reject, auto
+	MaxAltitude   int           // auto 策略下允许的最大高度(米)
+	Secret        string        // 回调签名密钥
+	CallbackURL   string        // 回调地址，为空时通过 CallbackSink 进程内投递
+}
+
+// CallbackSink 进程内回调投递函数，参数与 HTTP 回调的 body/时间戳/签名一致
+type CallbackSink func(body []byte, timestamp, signature string) error
+
+type simulatedApplication struct {
+	status  ApplicationStatus
+	request SubmitRequest
+	timer   *time.Timer
+}
+
+// Simulator 本地 UOM 模拟器，用于开发和测试环境
+// 提交后在 DecisionDelay 之后按策略审批，并以与真实平台相同的签名格式发送回调
+type Simulator struct {
+	config SimulatorConfig
+	client *http.Client
+	logger *zap.Logger
+
+	mu   sync.Mutex
+	seq  int64
+	apps map[string]*simulatedApplication
+	sink CallbackSink
+}
+
+// NewSimulator 创建 UOM 模拟器
+func NewSimulator(config SimulatorConfig, logger *zap.Logger) *Simulator {
+	if config.Decision == "" {
+		config.Decision = DecisionAuto
+	}
+	if config.MaxAltitude <= 0 {
+		config.MaxAltitude = 120
+	}
+	return &Simulator{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+		apps:   make(map[string]*simulatedApplication),
+	}
+}
+
+func (s *Simulator) SetCallbackSink(sink CallbackSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sink = sink
+}
+
+func (s *Simulator) Submit(req *SubmitRequest) (*SubmitResult, error) {
+	now := time.Now()
+	s.mu.Lock()
+	s.seq++
+	applicationNo := fmt.Sprintf("SIM-UOM-%s-%04d", now.Format("20060102150405"), s.seq)
+	app := &simulatedApplication{
+		status:  ApplicationStatus{ApplicationNo: applicationNo, Status: StatusSubmitted},
+		request: *req,
+	}
+	s.apps[applicationNo] = app
+	app.timer = time.AfterFunc(s.config.DecisionDelay, func() { s.decide(applicationNo) })
+	s.mu.Unlock()
+
+	s.logger.Info("uom simulator accepted application",
+		zap.String("application_no", applicationNo),
+		zap.String("external_id", req.ExternalID),
+		zap.Duration("decision_delay", s.config.DecisionDelay),
+	)
+	return &SubmitResult{ApplicationNo: applicationNo, Status: StatusSubmitted, SubmittedAt: now}, nil
+}
+
+func (s *Simulator) Query(applicationNo string) (*ApplicationStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, ok := s.apps[applicationNo]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	status := app.status
+	return &status, nil
+}
+
+func (s *Simulator) Cancel(applicationNo, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	app, ok := s.apps[applicationNo]
+	if !ok {
+		return ErrNotFound
+	}
+	if IsFinal(app.status.Status) {
+		return fmt.Errorf("uom: application %s already %s", applicationNo, app.status.Status)
+	}
+	app.timer.Stop()
+	now := time.Now()
+	app.status.Status = StatusCancelled
+	app.status.Reason = reason
+	app.status.DecidedAt = &now
+	return nil
+}
+
+func (s *Simulator) VerifyCallback(body []byte, timestamp, signature string) (*CallbackPayload, error) {
+	return verifyCallback(s.config.Secret, body, timestamp, signature, time.Now())
+}
+
+// decide 按策略给出审批结果并发送回调
+func (s *Simulator) decide(applicationNo string) {
+	s.mu.Lock()
+	app, ok := s.apps[applicationNo]
+	if !ok || IsFinal(app.status.Status) {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	approved, reason := s.evaluate(&app.request)
+	if approved {
+		app.status.Status = StatusApproved
+		app.status.ApprovalCode = fmt.Sprintf("SIM-PERMIT-%s", now.Format("20060102150405"))
+	} else {
+		app.status.Status = StatusRejected
+		app.status.Reason = reason
+	}
+	app.status.DecidedAt = &now
+	payload := CallbackPayload{
+		ApplicationNo: applicationNo,
+		Status:        app.status.Status,
+		ApprovalCode:  app.status.ApprovalCode,
+		Reason:        app.status.Reason,
+		EventTime:     now,
+	}
+	sink := s.sink
+	callbackURL := app.request.CallbackURL
+	if s.config.CallbackURL != "" {
+		callbackURL = s.config.CallbackURL
+	}
+	s.mu.Unlock()
+
+	if err := s.deliver(payload, callbackURL, sink); err != nil {
+		s.logger.Warn("uom simulator callback failed", zap.String("application_no", applicationNo), zap.Error(err))
+	}
+}
+
+func (s *Simulator) evaluate(req *SubmitRequest) (bool, string) {
+	switch s.config.Decision {
+	case DecisionApprove:
+		return true, ""
+	case DecisionReject:
+		return false, "模拟器配置为全部驳回"
+	default:
+		if req.MaxAltitude > s.config.MaxAltitude {
+			return false, fmt.Sprintf("飞行高度%dm超过限高%dm", req.MaxAltitude, s.config.MaxAltitude)
+		}
+		return true, ""
+	}
+}
+
+func (s *Simulator) deliver(payload CallbackPayload, callbackURL string, sink CallbackSink) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := Sign(s.config.Secret, timestamp, body)
+
+	if callbackURL == "" {
+		if sink == nil {
+			return fmt.Errorf("no callback url or sink configured")
+		}
+		return sink(body, timestamp, signature)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, signature)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package uom
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// UOM 平台申请状态
+const (
+	StatusSubmitted = "submitted"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// 回调签名请求头
+const (
+	HeaderTimestamp = "X-UOM-Timestamp"
+	HeaderSignature = "X-UOM-Signature"
+	HeaderAppID     = "X-UOM-App-Id"
+)
+
+// CallbackMaxSkew 回调时间戳允许的最大偏差
+const CallbackMaxSkew = 5 * time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("uom: invalid callback signature")
+	ErrStaleCallback    = errors.New("uom: callback timestamp out of range")
+	ErrNotFound         = errors.New("uom: application not found")
+)
+
+// UOMGateway 民航无人驾驶航空器综合管理平台(UOM)空域申请网关
+type UOMGateway interface {
+	// Submit 提交飞行计划申请，返回 UOM 申请编号
+	Submit(req *SubmitRequest) (*SubmitResult, error)
+	// Query 查询申请当前状态
+	Query(applicationNo string) (*ApplicationStatus, error)
+	// Cancel 撤销申请
+	Cancel(applicationNo, reason string) error
+	// VerifyCallback 校验回调签名并解析回调内容
+	VerifyCallback(body []byte, timestamp, signature string) (*CallbackPayload, error)
+}
+
+// Waypoint 航点
+type Waypoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+	Alt int     `json:"alt,omitempty"`
+}
+
+// SubmitRequest 飞行计划申请
+type SubmitRequest struct {
+	ExternalID     string     `json:"external_id"` // 平台内部申请ID
+	FlightPlanName string     `json:"flight_plan_name"`
+	FlightPurpose  string     `json:"flight_purpose"`
+	FlightType     string     `json:"flight_type"`
+	DroneSerialNo  string     `json:"drone_serial_no"`
+	UOMDroneRegNo  string     `json:"uom_drone_reg_no"`
+	PilotName      string     `json:"pilot_name"`
+	PilotLicenseNo string     `json:"pilot_license_no"`
+	Departure      Waypoint   `json:"departure"`
+	Arrival        Waypoint   `json:"arrival"`
+	Waypoints      []Waypoint `json:"waypoints,omitempty"`
+	MaxAltitude    int        `json:"max_altitude"`
+	StartTime      time.Time  `json:"start_time"`
+	EndTime        time.Time  `json:"end_time"`
+	CallbackURL    string     `json:"callback_url,omitempty"`
+}
+
+// SubmitResult 提交结果
+type SubmitResult struct {
+	ApplicationNo string    `json:"application_no"`
+	Status        string    `json:"status"`
+	SubmittedAt   time.Time `json:"submitted_at"`
+}
+
+// ApplicationStatus 申请状态
+type ApplicationStatus struct {
+	ApplicationNo string     `json:"application_no"`
+	Status        string     `json:"status"`
+	ApprovalCode  string     `json:"approval_code"`
+	Reason        string     `json:"reason"`
+	DecidedAt     *time.Time `json:"decided_at"`
+}
+
+// CallbackPayload 审批结果回调内容
+type CallbackPayload struct {
+	ApplicationNo string    `json:"application_no"`
+	Status        string    `json:"status"`
+	ApprovalCode  string    `json:"approval_code"`
+	Reason        string    `json:"reason"`
+	EventTime     time.Time `json:"event_time"`
+}
+
+// IsFinal 判断状态是否为终态
+func IsFinal(status string) bool {
+	switch status {
+	case StatusApproved, StatusRejected, StatusCancelled, StatusExpired:
+		return true
+	}
+	return false
+}
+
+// Sign 计算签名: hex(HMAC-SHA256(secret, timestamp + "\n" + body))
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCallback 校验签名与时间戳后解析回调，供各网关实现复用
+func verifyCallback(secret string, body []byte, timestamp, signature string, now time.Time) (*CallbackPayload, error) {
+	if secret == "" {
+		return nil, errors.New("uom: callback secret not configured")
+	}
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrStaleCallback
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > CallbackMaxSkew || skew < -CallbackMaxSkew {
+		return nil, ErrStaleCallback
+	}
+
+	var payload CallbackPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("uom: invalid callback body: %w", err)
+	}
+	if payload.ApplicationNo == "" || !IsFinal(payload.Status) {
+		return nil, fmt.Errorf("uom: invalid callback status %q for %q", payload.Status, payload.ApplicationNo)
+	}
+	return &payload, nil
+}
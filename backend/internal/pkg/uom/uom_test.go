@@ -0,0 +1,151 @@
+package uom
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestVerifyCallback(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	body := []byte(`{"application_no":"UOM-1","status":"approved","approval_code":"P-1"}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	payload, err := verifyCallback("secret", body, ts, Sign("secret", ts, body), now)
+	if err != nil {
+		t.Fatalf("valid callback rejected: %v", err)
+	}
+	if payload.ApplicationNo != "UOM-1" || payload.ApprovalCode != "P-1" {
+		t.Fatalf("unexpected payload %#v", payload)
+	}
+
+	if _, err := verifyCallback("secret", body, ts, Sign("other", ts, body), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	tampered := []byte(`{"application_no":"UOM-1","status":"rejected"}`)
+	if _, err := verifyCallback("secret", tampered, ts, Sign("secret", ts, body), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for tampered body, got %v", err)
+	}
+	if _, err := verifyCallback("secret", body, ts, Sign("secret", ts, body), now.Add(10*time.Minute)); !errors.Is(err, ErrStaleCallback) {
+		t.Fatalf("expected ErrStaleCallback, got %v", err)
+	}
+
+	pending := []byte(`{"application_no":"UOM-1","status":"submitted"}`)
+	if _, err := verifyCallback("secret", pending, ts, Sign("secret", ts, pending), now); err == nil {
+		t.Fatal("non-final status should be rejected")
+	}
+}
+
+func TestSimulatorDeliversSignedDecision(t *testing.T) {
+	sim := NewSimulator(SimulatorConfig{DecisionDelay: 10 * time.Millisecond, Decision: DecisionAuto, MaxAltitude: 120, Secret: "secret"}, zap.NewNop())
+	received := make(chan *CallbackPayload, 2)
+	sim.SetCallbackSink(func(body []byte, timestamp, signature string) error {
+		payload, err := sim.VerifyCallback(body, timestamp, signature)
+		if err != nil {
+			t.Errorf("simulator callback failed verification: %v", err)
+			return err
+		}
+		received <- payload
+		return nil
+	})
+
+	ok, _ := sim.Submit(&SubmitRequest{ExternalID: "1", MaxAltitude: 100})
+	high, _ := sim.Submit(&SubmitRequest{ExternalID: "2", MaxAltitude: 200})
+
+	got := map[string]*CallbackPayload{}
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-received:
+			got[p.ApplicationNo] = p
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for simulator callback")
+		}
+	}
+	if p := got[ok.ApplicationNo]; p == nil || p.Status != StatusApproved || p.ApprovalCode == "" {
+		t.Fatalf("expected approval for %s, got %#v", ok.ApplicationNo, p)
+	}
+	if p := got[high.ApplicationNo]; p == nil || p.Status != StatusRejected || p.Reason == "" {
+		t.Fatalf("expected rejection for %s, got %#v", high.ApplicationNo, p)
+	}
+}
+
+func TestSimulatorCancelStopsDecision(t *testing.T) {
+	sim := NewSimulator(SimulatorConfig{DecisionDelay: 20 * time.Millisecond, Secret: "secret"}, zap.NewNop())
+	called := make(chan struct{}, 1)
+	sim.SetCallbackSink(func([]byte, string, string) error {
+		called <- struct{}{}
+		return nil
+	})
+
+	res, _ := sim.Submit(&SubmitRequest{ExternalID: "1"})
+	if err := sim.Cancel(res.ApplicationNo, "计划取消"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	select {
+	case <-called:
+		t.Fatal("cancelled application should not receive a decision")
+	case <-time.After(60 * time.Millisecond):
+	}
+	status, _ := sim.Query(res.ApplicationNo)
+	if status.Status != StatusCancelled {
+		t.Fatalf("expected cancelled, got %q", status.Status)
+	}
+	if err := sim.Cancel(res.ApplicationNo, ""); err == nil {
+		t.Fatal("cancelling a final application should fail")
+	}
+	if _, err := sim.Query("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestHTTPGatewaySignsRequests(t *testing.T) {
+	var lastPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderAppID) != "app" || r.Header.Get(HeaderSignature) != Sign("secret", r.Header.Get(HeaderTimestamp), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		lastPath = r.Method + " " + r.URL.Path
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/flight-applications":
+			var req SubmitRequest
+			json.Unmarshal(body, &req)
+			if req.CallbackURL != "https://example.com/cb" {
+				w.Write([]byte(`{"code":40001,"message":"missing callback"}`))
+				return
+			}
+			w.Write([]byte(`{"code":0,"data":{"application_no":"UOM-9","status":"submitted"}}`))
+		case r.URL.Path == "/api/v1/flight-applications/UOM-9":
+			w.Write([]byte(`{"code":0,"data":{"application_no":"UOM-9","status":"approved","approval_code":"P-9"}}`))
+		case r.URL.Path == "/api/v1/flight-applications/UOM-9/cancel":
+			w.Write([]byte(`{"code":0}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	gw := NewHTTPGateway(HTTPConfig{BaseURL: srv.URL + "/", AppID: "app", AppSecret: "secret", CallbackURL: "https://example.com/cb"}, zap.NewNop())
+	res, err := gw.Submit(&SubmitRequest{ExternalID: "1"})
+	if err != nil || res.ApplicationNo != "UOM-9" {
+		t.Fatalf("submit: %#v, %v", res, err)
+	}
+	status, err := gw.Query("UOM-9")
+	if err != nil || status.Status != StatusApproved || status.ApprovalCode != "P-9" {
+		t.Fatalf("query: %#v, %v", status, err)
+	}
+	if err := gw.Cancel("UOM-9", "计划取消"); err != nil || lastPath != "POST /api/v1/flight-applications/UOM-9/cancel" {
+		t.Fatalf("cancel: %v (%s)", err, lastPath)
+	}
+	if _, err := gw.Query("UOM-404"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
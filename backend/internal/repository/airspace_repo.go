@@ -75,17 +75,34 @@ func (r *AirspaceRepo) UpdateUOMInfo(id int64, uomNo string) error {
 	}).Error
 }
 
-func (r *AirspaceRepo) UpdateUOMResponse(id int64, approvalCode string, approved bool) error {
+// GetApplicationByUOMNo 根据UOM申请编号获取空域申请
+func (r *AirspaceRepo) GetApplicationByUOMNo(uomNo string) (*model.AirspaceApplication, error) {
+	var app model.AirspaceApplication
+	err := r.db.Where("uom_application_no = ?", uomNo).First(&app).Error
+	return &app, err
+}
+
+// ApplyUOMResult 写入UOM审批结果，仅当申请仍处于 submitted_to_uom 时生效
+// 返回是否实际更新，用于回调与轮询并发时的幂等判断
+func (r *AirspaceRepo) ApplyUOMResult(id int64, status, approvalCode, notes string) (bool, error) {
 	now := time.Now()
-	status := "approved"
-	if !approved {
-		status = "rejected"
-	}
-	return r.db.Model(&model.AirspaceApplication{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"uom_response_at":  &now,
-		"uom_approval_code": approvalCode,
-		"status":            status,
-	}).Error
+	result := r.db.Model(&model.AirspaceApplication{}).
+		Where("id = ? AND status = ?", id, "submitted_to_uom").
+		Updates(map[string]interface{}{
+			"uom_response_at":   &now,
+			"uom_approval_code": approvalCode,
+			"status":            status,
+			"review_notes":      notes,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListSubmittedToUOM 获取已提交UOM且提交时间早于 before 的申请，用于状态轮询兜底
+func (r *AirspaceRepo) ListSubmittedToUOM(before time.Time, limit int) ([]model.AirspaceApplication, error) {
+	var apps []model.AirspaceApplication
+	err := r.db.Where("status = ? AND uom_application_no <> '' AND uom_submitted_at <= ?", "submitted_to_uom", before).
+		Order("uom_submitted_at ASC").Limit(limit).Find(&apps).Error
+	return apps, err
 }
 
 func (r *AirspaceRepo) SetComplianceResult(id int64, checkID int64, passed bool, notes string) error {
@@ -142,24 +159,28 @@ func (r *AirspaceRepo) ListNoFlyZones(zoneType string, status string, page, page
 	return zones, total, err
 }
 
-func (r *AirspaceRepo) FindNearbyNoFlyZones(lat, lng float64, radiusMeters float64) ([]model.NoFlyZone, error) {
+// ListActiveNoFlyZones 获取所有启用中的禁飞区(不做时间与几何过滤)
+func (r *AirspaceRepo) ListActiveNoFlyZones() ([]model.NoFlyZone, error) {
 	var zones []model.NoFlyZone
-	err := r.db.Where("status = 'active' AND geometry_type = 'circle'").
-		Where("center_latitude IS NOT NULL AND center_longitude IS NOT NULL").
-		Where("(6371000 * ACOS(COS(RADIANS(?)) * COS(RADIANS(center_latitude)) * COS(RADIANS(center_longitude) - RADIANS(?)) + SIN(RADIANS(?)) * SIN(RADIANS(center_latitude)))) < (COALESCE(radius, 0) + ?)",
-			lat, lng, lat, radiusMeters).
+	err := r.db.Where("status = 'active'").Find(&zones).Error
+	return zones, err
+}
+
+// ListNoFlyZonesInWindow 获取在 [from, to] 时间窗口内任意时刻生效的禁飞区
+func (r *AirspaceRepo) ListNoFlyZonesInWindow(from, to time.Time) ([]model.NoFlyZone, error) {
+	var zones []model.NoFlyZone
+	err := r.db.Where("status = 'active'").
+		Where("(is_permanent = ? OR ((effective_from IS NULL OR effective_from <= ?) AND (effective_to IS NULL OR effective_to >= ?)))", true, to, from).
 		Find(&zones).Error
 	return zones, err
 }
 
-func (r *AirspaceRepo) CheckNoFlyZoneConflict(lat, lng float64, altitude int) ([]model.NoFlyZone, error) {
+// ListEffectiveNoFlyZones 获取指定时刻生效且高度区间覆盖 altitude 的禁飞区
+// 几何包含关系由调用方判断(支持圆形与多边形)
+func (r *AirspaceRepo) ListEffectiveNoFlyZones(at time.Time, altitude int) ([]model.NoFlyZone, error) {
 	var zones []model.NoFlyZone
-	now := time.Now()
-	err := r.db.Where("status = 'active' AND geometry_type = 'circle'").
-		Where("center_latitude IS NOT NULL AND center_longitude IS NOT NULL").
-		Where("(is_permanent = 1 OR (effective_from <= ? AND effective_to >= ?))", now, now).
-		Where("(6371000 * ACOS(COS(RADIANS(?)) * COS(RADIANS(center_latitude)) * COS(RADIANS(center_longitude) - RADIANS(?)) + SIN(RADIANS(?)) * SIN(RADIANS(center_latitude)))) < COALESCE(radius, 0)",
-			lat, lng, lat).
+	err := r.db.Where("status = 'active'").
+		Where("(is_permanent = ? OR ((effective_from IS NULL OR effective_from <= ?) AND (effective_to IS NULL OR effective_to >= ?)))", true, at, at).
 		Where("(max_altitude = 0 OR ? <= max_altitude)", altitude).
 		Where("(min_altitude = 0 OR ? >= min_altitude)", altitude).
 		Find(&zones).Error
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type BatteryRepo struct {
+	db *gorm.DB
+}
+
+func NewBatteryRepo(db *gorm.DB) *BatteryRepo {
+	return &BatteryRepo{db: db}
+}
+
+func (r *BatteryRepo) DB() *gorm.DB {
+	return r.db
+}
+
+// CreatePack 登记电池包
+func (r *BatteryRepo) CreatePack(pack *model.BatteryPack) error {
+	return r.db.Create(pack).Error
+}
+
+// GetPackByID 根据ID获取电池包
+func (r *BatteryRepo) GetPackByID(id int64) (*model.BatteryPack, error) {
+	var pack model.BatteryPack
+	err := r.db.First(&pack, id).Error
+	return &pack, err
+}
+
+// GetPacksByIDs 批量获取电池包
+func (r *BatteryRepo) GetPacksByIDs(ids []int64) ([]model.BatteryPack, error) {
+	var packs []model.BatteryPack
+	err := r.db.Where("id IN ?", ids).Order("id ASC").Find(&packs).Error
+	return packs, err
+}
+
+// UpdatePackFields 更新电池包字段
+func (r *BatteryRepo) UpdatePackFields(id int64, fields map[string]interface{}) error {
+	return r.db.Model(&model.BatteryPack{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// ListPacks 电池包列表，filters 支持 owner_id、drone_id、status
+func (r *BatteryRepo) ListPacks(page, pageSize int, filters map[string]interface{}) ([]model.BatteryPack, int64, error) {
+	var packs []model.BatteryPack
+	var total int64
+	query := r.db.Model(&model.BatteryPack{})
+	for _, key := range []string{"owner_id", "drone_id", "status"} {
+		if value, ok := filters[key]; ok {
+			query = query.Where(key+" = ?", value)
+		}
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	err := query.Preload("Drone").Order("id DESC").Offset(offset).Limit(pageSize).Find(&packs).Error
+	return packs, total, err
+}
+
+// CountActivePacksByDrone 无人机绑定的在役电池包数量
+func (r *BatteryRepo) CountActivePacksByDrone(droneID int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.BatteryPack{}).Where("drone_id = ? AND status = ?", droneID, "active").Count(&count).Error
+	return count, err
+}
+
+// ReplaceCheckedLogs 用本次飞前检查的电池替换订单尚未回填的使用记录
+func (r *BatteryRepo) ReplaceCheckedLogs(orderID int64, logs []model.BatteryFlightLog) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("order_id = ? AND status = ?", orderID, "checked").Delete(&model.BatteryFlightLog{}).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		return tx.Create(&logs).Error
+	})
+}
+
+// ListLogsByOrder 订单的电池使用记录
+func (r *BatteryRepo) ListLogsByOrder(orderID int64) ([]model.BatteryFlightLog, error) {
+	var logs []model.BatteryFlightLog
+	err := r.db.Where("order_id = ?", orderID).Order("sequence ASC, id ASC").Find(&logs).Error
+	return logs, err
+}
+
+// ListLogsByPack 电池包最近的使用记录
+func (r *BatteryRepo) ListLogsByPack(packID int64, limit int) ([]model.BatteryFlightLog, error) {
+	var logs []model.BatteryFlightLog
+	err := r.db.Where("battery_pack_id = ?", packID).Order("id DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// BatteryPendingFlight 已飞前检查且飞行已结束、待回填电池数据的订单飞行
+type BatteryPendingFlight struct {
+	OrderID        int64   `json:"order_id"`
+	FlightRecordID int64   `json:"flight_record_id"`
+	DroneID        int64   `json:"drone_id"`
+	CargoWeightKG  float64 `json:"cargo_weight_kg"`
+}
+
+// ListPendingFlights 飞行已结束但电池使用记录尚未回填的订单
+func (r *BatteryRepo) ListPendingFlights(limit int) ([]BatteryPendingFlight, error) {
+	var flights []BatteryPendingFlight
+	err := r.db.Table("flight_records AS fr").
+		Select("fr.order_id, fr.id AS flight_record_id, fr.drone_id, COALESCE(d.cargo_weight_kg, 0) AS cargo_weight_kg").
+		Joins("LEFT JOIN orders o ON o.id = fr.order_id").
+		Joins("LEFT JOIN demands d ON d.id = o.demand_id").
+		Where("fr.deleted_at IS NULL AND fr.status IN ?", []string{"completed", "aborted"}).
+		Where("EXISTS (SELECT 1 FROM battery_flight_logs bl WHERE bl.order_id = fr.order_id AND bl.status = ?)", "checked").
+		Order("fr.id ASC").
+		Limit(limit).
+		Scan(&flights).Error
+	return flights, err
+}
+
+// BatteryLevelSample 飞行中的电量采样点
+type BatteryLevelSample struct {
+	RecordedAt   time.Time `json:"recorded_at"`
+	BatteryLevel int       `json:"battery_level"`
+}
+
+// ListBatteryLevels 飞行记录按时间排序的电量采样
+func (r *BatteryRepo) ListBatteryLevels(flightRecordID int64) ([]BatteryLevelSample, error) {
+	var samples []BatteryLevelSample
+	err := r.db.Model(&model.FlightPosition{}).
+		Select("recorded_at, battery_level").
+		Where("flight_record_id = ?", flightRecordID).
+		Order("recorded_at ASC, id ASC").
+		Scan(&samples).Error
+	return samples, err
+}
+
+// RecordFlightUsage 回填电池使用记录并更新电池包累计循环与健康度
+func (r *BatteryRepo) RecordFlightUsage(logs []model.BatteryFlightLog, packFields map[int64]map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i := range logs {
+			if err := tx.Model(&model.BatteryFlightLog{}).Where("id = ?", logs[i].ID).Updates(map[string]interface{}{
+				"flight_record_id": logs[i].FlightRecordID,
+				"start_level":      logs[i].StartLevel,
+				"end_level":        logs[i].EndLevel,
+				"discharge_rate":   logs[i].DischargeRate,
+				"duration_seconds": logs[i].DurationSeconds,
+				"cycle_increment":  logs[i].CycleIncrement,
+				"health_sample":    logs[i].HealthSample,
+				"health_after":     logs[i].HealthAfter,
+				"status":           logs[i].Status,
+				"recorded_at":      logs[i].RecordedAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		for packID, fields := range packFields {
+			if err := tx.Model(&model.BatteryPack{}).Where("id = ?", packID).Updates(fields).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type CouponRepo struct {
+	db *gorm.DB
+}
+
+func NewCouponRepo(db *gorm.DB) *CouponRepo {
+	return &CouponRepo{db: db}
+}
+
+func (r *CouponRepo) DB() *gorm.DB {
+	return r.db
+}
+
+func (r *CouponRepo) CreateTemplate(template *model.CouponTemplate) error {
+	return r.db.Create(template).Error
+}
+
+func (r *CouponRepo) GetTemplate(id int64) (*model.CouponTemplate, error) {
+	var template model.CouponTemplate
+	if err := r.db.First(&template, id).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *CouponRepo) UpdateTemplateStatus(id int64, status string) error {
+	return r.db.Model(&model.CouponTemplate{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+func (r *CouponRepo) ListTemplates(status, trigger string, page, pageSize int) ([]model.CouponTemplate, int64, error) {
+	var templates []model.CouponTemplate
+	var total int64
+
+	query := r.db.Model(&model.CouponTemplate{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if trigger != "" {
+		query = query.Where("issue_trigger = ?", trigger)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&templates).Error; err != nil {
+		return nil, 0, err
+	}
+	return templates, total, nil
+}
+
+// ListActiveTemplatesByTrigger 按发放场景查询生效中的模板
+func (r *CouponRepo) ListActiveTemplatesByTrigger(trigger string) ([]model.CouponTemplate, error) {
+	var templates []model.CouponTemplate
+	err := r.db.Where("status = ? AND issue_trigger = ?", "active", trigger).Order("id ASC").Find(&templates).Error
+	return templates, err
+}
+
+// ReserveQuantity 占用模板发放库存，库存不足时返回 false
+func (r *CouponRepo) ReserveQuantity(templateID int64, count int) (bool, error) {
+	result := r.db.Model(&model.CouponTemplate{}).
+		Where("id = ? AND (total_quantity = 0 OR issued_count + ? <= total_quantity)", templateID, count).
+		Update("issued_count", gorm.Expr("issued_count + ?", count))
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountUserCoupons 用户已领取某模板的张数
+func (r *CouponRepo) CountUserCoupons(templateID, userID int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.UserCoupon{}).Where("template_id = ? AND user_id = ?", templateID, userID).Count(&count).Error
+	return count, err
+}
+
+func (r *CouponRepo) ExistsIssueKey(issueKey string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.UserCoupon{}).Where("issue_key = ?", issueKey).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *CouponRepo) CreateUserCoupon(coupon *model.UserCoupon) error {
+	return r.db.Create(coupon).Error
+}
+
+func (r *CouponRepo) GetUserCoupon(id int64) (*model.UserCoupon, error) {
+	var coupon model.UserCoupon
+	if err := r.db.Preload("Template").First(&coupon, id).Error; err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// ListByUser 用户券包，status 为空时返回全部
+func (r *CouponRepo) ListByUser(userID int64, status string, page, pageSize int) ([]model.UserCoupon, int64, error) {
+	var coupons []model.UserCoupon
+	var total int64
+
+	query := r.db.Model(&model.UserCoupon{}).Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Template").Order("id DESC").Offset(offset).Limit(pageSize).Find(&coupons).Error; err != nil {
+		return nil, 0, err
+	}
+	return coupons, total, nil
+}
+
+// ListUsable 用户可用于下单的券，含已锁定在该订单上的券
+func (r *CouponRepo) ListUsable(userID, orderID int64, now time.Time) ([]model.UserCoupon, error) {
+	var coupons []model.UserCoupon
+	err := r.db.Preload("Template").
+		Where("user_id = ? AND (status = ? OR (status = ? AND order_id = ?))", userID, "available", "locked", orderID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("expires_at ASC, id ASC").
+		Find(&coupons).Error
+	return coupons, err
+}
+
+// Lock 将可用券(或已锁定在同一订单上的券)锁定到订单，券已被占用时返回 false
+func (r *CouponRepo) Lock(id, orderID, discount int64, lockedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.UserCoupon{}).
+		Where("id = ? AND (status = ? OR (status = ? AND order_id = ?))", id, "available", "locked", orderID).
+		Updates(map[string]interface{}{
+			"status":          "locked",
+			"order_id":        orderID,
+			"discount_amount": discount,
+			"locked_at":       &lockedAt,
+			"updated_at":      lockedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Release 释放锁定或已核销在订单上的券，status 为释放后的状态(available 或 expired)
+func (r *CouponRepo) Release(id, orderID int64, status string, releasedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.UserCoupon{}).
+		Where("id = ? AND order_id = ? AND status IN ?", id, orderID, []string{"locked", "used"}).
+		Updates(map[string]interface{}{
+			"status":          status,
+			"order_id":        0,
+			"discount_amount": 0,
+			"locked_at":       nil,
+			"used_at":         nil,
+			"released_at":     &releasedAt,
+			"updated_at":      releasedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkUsed 订单支付成功后核销锁定在该订单上的券
+func (r *CouponRepo) MarkUsed(id, orderID int64, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.UserCoupon{}).
+		Where("id = ? AND order_id = ? AND status = ?", id, orderID, "locked").
+		Updates(map[string]interface{}{"status": "used", "used_at": &usedAt, "updated_at": usedAt})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListStaleLocks 锁定时间早于 lockedBefore 或已过期、仍处于锁定状态的券
+func (r *CouponRepo) ListStaleLocks(lockedBefore, now time.Time, limit int) ([]model.UserCoupon, error) {
+	var coupons []model.UserCoupon
+	err := r.db.Where("status = ? AND (locked_at <= ? OR (expires_at IS NOT NULL AND expires_at <= ?))", "locked", lockedBefore, now).
+		Order("id ASC").Limit(limit).Find(&coupons).Error
+	return coupons, err
+}
+
+// ExpireOverdue 将已过期且未使用的券置为 expired
+func (r *CouponRepo) ExpireOverdue(now time.Time, limit int) (int64, error) {
+	var ids []int64
+	if err := r.db.Model(&model.UserCoupon{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", "available", now).
+		Order("id ASC").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := r.db.Model(&model.UserCoupon{}).Where("id IN ? AND status = ?", ids, "available").
+		Updates(map[string]interface{}{"status": "expired", "updated_at": now})
+	return result.RowsAffected, result.Error
+}
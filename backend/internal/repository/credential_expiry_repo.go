@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type CredentialExpiryRepo struct {
+	db *gorm.DB
+}
+
+func NewCredentialExpiryRepo(db *gorm.DB) *CredentialExpiryRepo {
+	return &CredentialExpiryRepo{db: db}
+}
+
+func (r *CredentialExpiryRepo) DB() *gorm.DB {
+	return r.db
+}
+
+// ListPilotsExpiringBefore 已认证且执照、无犯罪记录或健康证明在 until 前到期的飞手
+func (r *CredentialExpiryRepo) ListPilotsExpiringBefore(until time.Time) ([]model.Pilot, error) {
+	var pilots []model.Pilot
+	err := r.db.Preload("User").
+		Where("verification_status = ?", "verified").
+		Where("caac_license_expire_date <= ? OR criminal_check_expire <= ? OR health_check_expire <= ?", until, until, until).
+		Order("id ASC").
+		Find(&pilots).Error
+	return pilots, err
+}
+
+// ListCertificationsExpiringBefore 已通过或已过期、且在 until 前到期的飞手资质证书
+func (r *CredentialExpiryRepo) ListCertificationsExpiringBefore(until time.Time) ([]model.PilotCertification, error) {
+	var certs []model.PilotCertification
+	err := r.db.Preload("Pilot").Preload("Pilot.User").
+		Where("status IN ? AND expire_date <= ?", []string{"approved", "expired"}, until).
+		Order("expire_date ASC").
+		Find(&certs).Error
+	return certs, err
+}
+
+// ListDronesExpiringBefore 保险、适航证书或下次维护日期在 until 前到期的无人机
+func (r *CredentialExpiryRepo) ListDronesExpiringBefore(until time.Time) ([]model.Drone, error) {
+	var drones []model.Drone
+	err := r.db.Where("insurance_expire_date <= ? OR airworthiness_cert_expire <= ? OR next_maintenance_date <= ?", until, until, until).
+		Order("id ASC").
+		Find(&drones).Error
+	return drones, err
+}
+
+// HasNotice 该证照本次到期日的某个提醒档位是否已发送
+func (r *CredentialExpiryRepo) HasNotice(key *model.CredentialExpiryNotice) (bool, error) {
+	var count int64
+	err := r.noticeScope(key).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateNoticeOnce 写入提醒记录，已存在时返回 false
+func (r *CredentialExpiryRepo) CreateNoticeOnce(notice *model.CredentialExpiryNotice) (bool, error) {
+	exists, err := r.HasNotice(notice)
+	if err != nil || exists {
+		return false, err
+	}
+	if err := r.db.Create(notice).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *CredentialExpiryRepo) noticeScope(key *model.CredentialExpiryNotice) *gorm.DB {
+	return r.db.Model(&model.CredentialExpiryNotice{}).
+		Where("subject_type = ? AND subject_id = ? AND credential_type = ? AND credential_id = ?", key.SubjectType, key.SubjectID, key.CredentialType, key.CredentialID).
+		Where("expire_date = ? AND stage = ?", key.ExpireDate, key.Stage)
+}
+
+// PausePilot 更新飞手证照状态并下线接单，同步飞手角色档案
+func (r *CredentialExpiryRepo) PausePilot(pilot *model.Pilot, fields map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"availability_status": "offline"}
+		for key, value := range fields {
+			updates[key] = value
+		}
+		if err := tx.Model(&model.Pilot{}).Where("id = ?", pilot.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.PilotProfile{}).Where("user_id = ?", pilot.UserID).
+			Updates(map[string]interface{}{"availability_status": "offline", "updated_at": time.Now()}).Error
+	})
+}
+
+// UpdateCertificationStatus 更新资质证书状态
+func (r *CredentialExpiryRepo) UpdateCertificationStatus(certID int64, status string) error {
+	return r.db.Model(&model.PilotCertification{}).Where("id = ?", certID).Update("status", status).Error
+}
+
+// ExpireDrone 更新无人机证照状态，不再满足上架条件时暂停其供给
+func (r *CredentialExpiryRepo) ExpireDrone(drone *model.Drone, fields map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := NewDroneRepo(tx).UpdateFields(drone.ID, fields); err != nil {
+			return err
+		}
+		return NewOwnerDomainRepo(tx).SyncSupplyCapabilityByDrone(drone)
+	})
+}
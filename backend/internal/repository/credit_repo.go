@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreditRepository struct {
@@ -16,6 +17,10 @@ func NewCreditRepository(db *gorm.DB) *CreditRepository {
 	return &CreditRepository{db: db}
 }
 
+func (r *CreditRepository) DB() *gorm.DB {
+	return r.db
+}
+
 // ============================================================
 // CreditScore 信用分相关
 // ============================================================
@@ -51,6 +56,11 @@ func (r *CreditRepository) UpdateCreditScore(score *model.CreditScore) error {
 	return r.db.Save(score).Error
 }
 
+// SyncPilotCreditScore 将信用总分回写到飞手档案，派单按 pilots.credit_score 排序
+func (r *CreditRepository) SyncPilotCreditScore(userID int64, totalScore int) error {
+	return r.db.Model(&model.Pilot{}).Where("user_id = ?", userID).UpdateColumn("credit_score", totalScore).Error
+}
+
 func (r *CreditRepository) ListCreditScores(userType string, scoreLevel string, page, pageSize int) ([]model.CreditScore, int64, error) {
 	var scores []model.CreditScore
 	var total int64
@@ -175,6 +185,117 @@ func (r *CreditRepository) ListCreditScoreLogs(userID int64, changeType string,
 	return logs, total, nil
 }
 
+// ============================================================
+// CreditEvent 信用事件
+// ============================================================
+
+// CreateCreditEvent 登记信用事件，幂等键已存在时不重复登记，返回是否新登记
+func (r *CreditRepository) CreateCreditEvent(event *model.CreditEvent) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *CreditRepository) GetCreditEventByKey(eventKey string) (*model.CreditEvent, error) {
+	var event model.CreditEvent
+	if err := r.db.Where("event_key = ?", eventKey).First(&event).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *CreditRepository) UpdateCreditEvent(event *model.CreditEvent) error {
+	return r.db.Save(event).Error
+}
+
+// ListPendingCreditEvents 待计入信用分且未超过重试次数的事件，按发生时间先后
+func (r *CreditRepository) ListPendingCreditEvents(maxAttempts, limit int) ([]model.CreditEvent, error) {
+	var events []model.CreditEvent
+	err := r.db.Where("status = ? AND attempts < ?", "pending", maxAttempts).
+		Order("occurred_at ASC, id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// ListDecayingCreditEvents 已计入且影响分尚未衰减为0的事件，以ID游标分页
+func (r *CreditRepository) ListDecayingCreditEvents(afterID int64, limit int) ([]model.CreditEvent, error) {
+	var events []model.CreditEvent
+	err := r.db.Where("status = ? AND applied_points <> 0 AND id > ?", "applied", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// ListUserCreditEvents 用户全部有效信用事件(待计入与已计入)，按发生时间先后
+func (r *CreditRepository) ListUserCreditEvents(userID int64) ([]model.CreditEvent, error) {
+	var events []model.CreditEvent
+	err := r.db.Where("user_id = ? AND status IN ?", userID, []string{"pending", "applied"}).
+		Order("occurred_at ASC, id ASC").
+		Find(&events).Error
+	return events, err
+}
+
+// ListCreditEventUserIDs 有信用事件的用户
+func (r *CreditRepository) ListCreditEventUserIDs() ([]int64, error) {
+	var userIDs []int64
+	err := r.db.Model(&model.CreditEvent{}).Distinct("user_id").Order("user_id ASC").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// ============================================================
+// 信用历史回算数据源
+// ============================================================
+
+// ListFinishedOrders 已完成或已取消的订单，以ID游标分页
+func (r *CreditRepository) ListFinishedOrders(afterID int64, limit int) ([]model.Order, error) {
+	var orders []model.Order
+	err := r.db.Where("id > ? AND status IN ?", afterID, []string{"completed", "cancelled"}).
+		Order("id ASC").
+		Limit(limit).
+		Find(&orders).Error
+	return orders, err
+}
+
+func (r *CreditRepository) ListReviews(afterID int64, limit int) ([]model.Review, error) {
+	var reviews []model.Review
+	err := r.db.Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&reviews).Error
+	return reviews, err
+}
+
+// ListConfirmedViolations 已确认(未撤销)的违规记录
+func (r *CreditRepository) ListConfirmedViolations(afterID int64, limit int) ([]model.Violation, error) {
+	var violations []model.Violation
+	err := r.db.Where("id > ? AND status = ?", afterID, "confirmed").Order("id ASC").Limit(limit).Find(&violations).Error
+	return violations, err
+}
+
+// ListGeofenceEntries 闯入围栏记录
+func (r *CreditRepository) ListGeofenceEntries(afterID int64, limit int) ([]model.GeofenceViolation, error) {
+	var violations []model.GeofenceViolation
+	err := r.db.Where("id > ? AND violation_type = ?", afterID, "entered").Order("id ASC").Limit(limit).Find(&violations).Error
+	return violations, err
+}
+
+func (r *CreditRepository) GetGeofence(id int64) (*model.Geofence, error) {
+	var fence model.Geofence
+	if err := r.db.First(&fence, id).Error; err != nil {
+		return nil, err
+	}
+	return &fence, nil
+}
+
+func (r *CreditRepository) GetOrder(id int64) (*model.Order, error) {
+	var order model.Order
+	if err := r.db.First(&order, id).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 // ============================================================
 // RiskControl 风控记录
 // ============================================================
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type DisputeRepo struct {
+	db *gorm.DB
+}
+
+func NewDisputeRepo(db *gorm.DB) *DisputeRepo {
+	return &DisputeRepo{db: db}
+}
+
+func (r *DisputeRepo) DB() *gorm.DB {
+	return r.db
+}
+
+func (r *DisputeRepo) GetByID(id int64) (*model.DisputeRecord, error) {
+	var record model.DisputeRecord
+	if err := r.db.First(&record, id).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Transition 以状态为条件更新纠纷，状态已变化时返回 false
+func (r *DisputeRepo) Transition(id int64, fromStatuses []string, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.DisputeRecord{}).
+		Where("id = ? AND status IN ?", id, fromStatuses).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *DisputeRepo) List(page, pageSize int, filters map[string]interface{}) ([]model.DisputeRecord, int64, error) {
+	var list []model.DisputeRecord
+	var total int64
+
+	query := r.db.Model(&model.DisputeRecord{})
+	for _, key := range []string{"status", "order_id", "arbitrator_id", "sla_breached"} {
+		if value, ok := filters[key]; ok {
+			query = query.Where(key+" = ?", value)
+		}
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+func (r *DisputeRepo) CreateEvidence(evidence *model.DisputeEvidence) error {
+	return r.db.Create(evidence).Error
+}
+
+func (r *DisputeRepo) ListEvidence(disputeID int64) ([]model.DisputeEvidence, error) {
+	var list []model.DisputeEvidence
+	err := r.db.Where("dispute_id = ?", disputeID).Order("id ASC").Find(&list).Error
+	return list, err
+}
+
+// ListResponseOverdue 答辩期已过仍未答辩的纠纷
+func (r *DisputeRepo) ListResponseOverdue(now time.Time, limit int) ([]model.DisputeRecord, error) {
+	var list []model.DisputeRecord
+	err := r.db.Where("status = ? AND response_due_at IS NOT NULL AND response_due_at <= ?", "open", now).
+		Order("response_due_at ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListResolutionOverdue 超过处理时限仍未结案、尚未标记超时的纠纷
+func (r *DisputeRepo) ListResolutionOverdue(now time.Time, limit int) ([]model.DisputeRecord, error) {
+	var list []model.DisputeRecord
+	err := r.db.Where("status IN ? AND sla_breached = ? AND resolution_due_at IS NOT NULL AND resolution_due_at <= ?", OpenDisputeStatuses, false, now).
+		Order("resolution_due_at ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
@@ -88,6 +88,20 @@ func (r *FlightRepo) GetActiveFlightRecordByOrder(orderID int64) (*model.FlightR
 	return &record, nil
 }
 
+// GetActiveFlightRecordByMavlinkSystemID 按飞控 MAVLink 系统ID查找执行中的飞行记录
+// 系统ID可能在机队内复用，以当前有进行中飞行的无人机为准
+func (r *FlightRepo) GetActiveFlightRecordByMavlinkSystemID(systemID int) (*model.FlightRecord, error) {
+	var record model.FlightRecord
+	err := r.db.Joins("JOIN drones ON drones.id = flight_records.drone_id AND drones.deleted_at IS NULL").
+		Where("drones.mavlink_system_id = ? AND flight_records.status IN ?", systemID, []string{"pending", "executing"}).
+		Order("flight_records.created_at DESC").
+		First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
 // RecordPosition 记录飞行位置
 func (r *FlightRepo) RecordPosition(pos *model.FlightPosition) error {
 	return r.db.Create(pos).Error
@@ -156,10 +170,37 @@ func (r *FlightRepo) GetPositionsForTrajectory(orderID int64) ([]model.FlightPos
 	return positions, err
 }
 
-// DeleteOldPositions 删除旧位置记录(保留最近N天)
-func (r *FlightRepo) DeleteOldPositions(days int) error {
+// DeleteOldPositions 删除旧位置记录(保留最近N天)，返回删除条数
+func (r *FlightRepo) DeleteOldPositions(days int) (int64, error) {
 	cutoff := time.Now().AddDate(0, 0, -days)
-	return r.db.Where("recorded_at < ?", cutoff).Delete(&model.FlightPosition{}).Error
+	result := r.db.Where("recorded_at < ?", cutoff).Delete(&model.FlightPosition{})
+	return result.RowsAffected, result.Error
+}
+
+// DeletePositionsByIDs 按ID批量删除位置点
+func (r *FlightRepo) DeletePositionsByIDs(ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := r.db.Where("id IN ?", ids).Delete(&model.FlightPosition{})
+	return result.RowsAffected, result.Error
+}
+
+// ListFlightRecordsForDownsampling 获取在 cutoff 之前结束且尚未降采样的飞行记录
+func (r *FlightRepo) ListFlightRecordsForDownsampling(cutoff time.Time, limit int) ([]model.FlightRecord, error) {
+	var records []model.FlightRecord
+	err := r.db.Where("status IN ? AND positions_downsampled_at IS NULL", []string{"completed", "aborted"}).
+		Where("COALESCE(landing_at, updated_at) < ?", cutoff).
+		Order("id ASC").
+		Limit(limit).
+		Find(&records).Error
+	return records, err
+}
+
+// MarkPositionsDownsampled 标记飞行记录的位置点已降采样
+func (r *FlightRepo) MarkPositionsDownsampled(flightRecordID int64, at time.Time) error {
+	return r.db.Model(&model.FlightRecord{}).Where("id = ?", flightRecordID).
+		UpdateColumn("positions_downsampled_at", at).Error
 }
 
 // ==================== 飞行告警相关 ====================
@@ -217,13 +258,14 @@ func (r *FlightRepo) GetAlertsByType(orderID int64, alertType string) ([]model.F
 	return alerts, err
 }
 
-// AcknowledgeAlert 确认告警
+// AcknowledgeAlert 确认告警，同时停止升级
 func (r *FlightRepo) AcknowledgeAlert(id, userID int64) error {
 	now := time.Now()
 	return r.db.Model(&model.FlightAlert{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"status":          "acknowledged",
-		"acknowledged_at": now,
-		"acknowledged_by": userID,
+		"status":             "acknowledged",
+		"acknowledged_at":    now,
+		"acknowledged_by":    userID,
+		"next_escalation_at": nil,
 	}).Error
 }
 
@@ -231,12 +273,75 @@ func (r *FlightRepo) AcknowledgeAlert(id, userID int64) error {
 func (r *FlightRepo) ResolveAlert(id int64, note string) error {
 	now := time.Now()
 	return r.db.Model(&model.FlightAlert{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"status":          "resolved",
-		"resolved_at":     now,
-		"resolution_note": note,
+		"status":             "resolved",
+		"resolved_at":        now,
+		"resolution_note":    note,
+		"next_escalation_at": nil,
 	}).Error
 }
 
+// GetOpenAlertsForFlight 获取飞行(无飞行记录时按订单)未关闭的告警，用于去重
+func (r *FlightRepo) GetOpenAlertsForFlight(flightRecordID *int64, orderID int64) ([]model.FlightAlert, error) {
+	var alerts []model.FlightAlert
+	query := r.db.Where("status IN ?", []string{"active", "acknowledged"})
+	if flightRecordID != nil {
+		query = query.Where("flight_record_id = ?", *flightRecordID)
+	} else {
+		query = query.Where("order_id = ? AND flight_record_id IS NULL", orderID)
+	}
+	err := query.Order("id ASC").Find(&alerts).Error
+	return alerts, err
+}
+
+// UpdateAlertFields 更新告警指定字段
+func (r *FlightRepo) UpdateAlertFields(id int64, fields map[string]interface{}) error {
+	return r.db.Model(&model.FlightAlert{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// AdvanceAlertEscalation 推进告警升级步骤，仅对仍为 active 且未被其他实例推进的告警生效
+func (r *FlightRepo) AdvanceAlertEscalation(id int64, fromLevel, toLevel int, next *time.Time) (bool, error) {
+	result := r.db.Model(&model.FlightAlert{}).
+		Where("id = ? AND status = ? AND escalation_level = ?", id, "active", fromLevel).
+		Updates(map[string]interface{}{
+			"escalation_level":   toLevel,
+			"next_escalation_at": next,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListAlertsDueForEscalation 获取到达升级时间且仍未确认的告警
+func (r *FlightRepo) ListAlertsDueForEscalation(now time.Time, limit int) ([]model.FlightAlert, error) {
+	var alerts []model.FlightAlert
+	err := r.db.Where("status = ? AND next_escalation_at IS NOT NULL AND next_escalation_at <= ?", "active", now).
+		Order("next_escalation_at ASC").
+		Limit(limit).
+		Find(&alerts).Error
+	return alerts, err
+}
+
+// ListActiveAdminUserIDs 获取启用状态的管理员用户ID，未配置值班管理员时作为升级兜底
+func (r *FlightRepo) ListActiveAdminUserIDs() ([]int64, error) {
+	var ids []int64
+	err := r.db.Model(&model.User{}).
+		Where("user_type = ? AND status = ?", "admin", "active").
+		Order("id ASC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ListActiveUserIDsByPhone 按手机号查找启用状态的用户，用于通知已注册的站点联系人
+func (r *FlightRepo) ListActiveUserIDsByPhone(phones []string) ([]int64, error) {
+	var ids []int64
+	if len(phones) == 0 {
+		return ids, nil
+	}
+	err := r.db.Model(&model.User{}).
+		Where("phone IN ? AND status = ?", phones, "active").
+		Order("id ASC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
 // GetUnresolvedAlertCount 获取未解决告警数
 func (r *FlightRepo) GetUnresolvedAlertCount(orderID int64) (int64, error) {
 	var count int64
@@ -410,6 +515,21 @@ func (r *FlightRepo) GetActiveGeofences() ([]model.Geofence, error) {
 	return fences, err
 }
 
+// GetEnabledGeofences 获取所有启用状态的围栏(不限生效时间窗口)，供内存缓存使用
+func (r *FlightRepo) GetEnabledGeofences() ([]model.Geofence, error) {
+	var fences []model.Geofence
+	err := r.db.Where("status = ?", "active").Find(&fences).Error
+	return fences, err
+}
+
+// GetGeofencesInWindow 获取在 [from, to] 时间窗口内任意时刻生效的围栏
+func (r *FlightRepo) GetGeofencesInWindow(from, to time.Time) ([]model.Geofence, error) {
+	var fences []model.Geofence
+	err := r.db.Where("status = ? AND (effective_from IS NULL OR effective_from <= ?) AND (effective_to IS NULL OR effective_to >= ?)",
+		"active", to, from).Find(&fences).Error
+	return fences, err
+}
+
 // GetGeofencesByType 按类型获取围栏
 func (r *FlightRepo) GetGeofencesByType(fenceType string) ([]model.Geofence, error) {
 	var fences []model.Geofence
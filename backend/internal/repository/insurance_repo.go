@@ -308,3 +308,17 @@ func (r *InsuranceRepository) CheckMandatoryInsurance(userID int64, policyType s
 	}
 	return count > 0, nil
 }
+
+// HasActiveInsuredPolicy 检查被保险标的(如无人机)是否有生效中的指定险种
+func (r *InsuranceRepository) HasActiveInsuredPolicy(insuredType string, insuredID int64, policyType string) (bool, error) {
+	var count int64
+	now := time.Now()
+	err := r.db.Model(&model.InsurancePolicy{}).
+		Where("insured_type = ? AND insured_id = ? AND policy_type = ? AND status = ? AND effective_from <= ? AND effective_to >= ?",
+			insuredType, insuredID, policyType, "active", now, now).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
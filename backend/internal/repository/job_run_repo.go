@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type JobRunRepo struct {
+	db *gorm.DB
+}
+
+func NewJobRunRepo(db *gorm.DB) *JobRunRepo {
+	return &JobRunRepo{db: db}
+}
+
+func (r *JobRunRepo) CreateRun(run *model.JobRun) error {
+	return r.db.Create(run).Error
+}
+
+func (r *JobRunRepo) UpdateRun(run *model.JobRun) error {
+	return r.db.Save(run).Error
+}
+
+func (r *JobRunRepo) GetLatestRun(jobName string) (*model.JobRun, error) {
+	var run model.JobRun
+	err := r.db.Where("job_name = ?", jobName).Order("started_at DESC, id DESC").First(&run).Error
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *JobRunRepo) ListRuns(page, pageSize int, filters map[string]interface{}) ([]model.JobRun, int64, error) {
+	var runs []model.JobRun
+	var total int64
+
+	query := r.db.Model(&model.JobRun{})
+	if jobName, ok := filters["job_name"].(string); ok && strings.TrimSpace(jobName) != "" {
+		query = query.Where("job_name = ?", strings.TrimSpace(jobName))
+	}
+	if status, ok := filters["status"].(string); ok && strings.TrimSpace(status) != "" {
+		query = query.Where("status = ?", strings.TrimSpace(status))
+	}
+	if triggerType, ok := filters["trigger_type"].(string); ok && strings.TrimSpace(triggerType) != "" {
+		query = query.Where("trigger_type = ?", strings.TrimSpace(triggerType))
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("started_at DESC, id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&runs).Error
+	return runs, total, err
+}
+
+// TrimRuns 每个任务仅保留最近 keep 条执行记录
+func (r *JobRunRepo) TrimRuns(jobName string, keep int) (int64, error) {
+	var cutoff model.JobRun
+	err := r.db.Where("job_name = ?", jobName).Order("started_at DESC, id DESC").Offset(keep).First(&cutoff).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	result := r.db.Where("job_name = ? AND id <= ?", jobName, cutoff.ID).Delete(&model.JobRun{})
+	return result.RowsAffected, result.Error
+}
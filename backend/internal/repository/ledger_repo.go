@@ -0,0 +1,499 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"wurenji-backend/internal/model"
+)
+
+// ErrLedgerInsufficientBalance 用户账户余额不足以完成过账
+var ErrLedgerInsufficientBalance = errors.New("账户余额不足")
+
+// LedgerRepo 复式记账仓储，所有资金变动都通过 Post 以借贷平衡的凭证记账
+type LedgerRepo struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepo(db *gorm.DB) *LedgerRepo {
+	return &LedgerRepo{db: db}
+}
+
+func (r *LedgerRepo) DB() *gorm.DB {
+	if r == nil {
+		return nil
+	}
+	return r.db
+}
+
+// LedgerLine 凭证中的一条分录
+type LedgerLine struct {
+	AccountType string
+	UserID      int64
+	Bucket      string
+	Amount      int64
+}
+
+// LedgerAccountBalance 账户余额快照
+type LedgerAccountBalance struct {
+	AccountType string `json:"account_type"`
+	UserID      int64  `json:"user_id"`
+	Bucket      string `json:"bucket"`
+	Balance     int64  `json:"balance"`
+}
+
+// IsUserLedgerAccount 是否为用户账户(计入钱包且不允许透支)
+func IsUserLedgerAccount(accountType string) bool {
+	switch accountType {
+	case model.LedgerAccountPilot, model.LedgerAccountOwner, model.LedgerAccountClient:
+		return true
+	}
+	return false
+}
+
+// Post 在一个事务内写入凭证与分录、更新账户余额，并重算涉及用户的钱包余额
+// 分录金额之和必须为零；相同幂等键的凭证已存在时不重复记账，返回 false
+func (r *LedgerRepo) Post(entry *model.LedgerEntry, lines []LedgerLine) (bool, error) {
+	postings, err := normalizeLedgerLines(entry, lines)
+	if err != nil {
+		return false, err
+	}
+	posted := false
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		var txErr error
+		posted, txErr = r.postTx(tx, entry, postings, true)
+		return txErr
+	})
+	return posted, err
+}
+
+func normalizeLedgerLines(entry *model.LedgerEntry, lines []LedgerLine) ([]LedgerLine, error) {
+	if entry.IdempotencyKey == "" {
+		return nil, errors.New("记账凭证缺少幂等键")
+	}
+	var sum int64
+	postings := make([]LedgerLine, 0, len(lines))
+	for _, line := range lines {
+		if line.Amount == 0 {
+			continue
+		}
+		if line.Bucket == "" {
+			line.Bucket = model.LedgerBucketAvailable
+		}
+		sum += line.Amount
+		postings = append(postings, line)
+	}
+	if len(postings) < 2 {
+		return nil, errors.New("记账凭证至少需要两条分录")
+	}
+	if sum != 0 {
+		return nil, fmt.Errorf("记账凭证借贷不平衡: %d", sum)
+	}
+	return postings, nil
+}
+
+func (r *LedgerRepo) postTx(tx *gorm.DB, entry *model.LedgerEntry, postings []LedgerLine, openLegacy bool) (bool, error) {
+	if entry.EntryNo == "" {
+		entry.EntryNo = generateLedgerEntryNo()
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	users := make(map[int64]struct{})
+	for _, line := range postings {
+		if IsUserLedgerAccount(line.AccountType) {
+			users[line.UserID] = struct{}{}
+		}
+	}
+	if openLegacy {
+		for userID := range users {
+			if err := r.openLegacyWalletTx(tx, userID); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	for _, line := range postings {
+		account, err := r.getOrCreateAccountTx(tx, line.AccountType, line.UserID, line.Bucket)
+		if err != nil {
+			return false, err
+		}
+		if err := tx.Model(&model.LedgerAccount{}).Where("id = ?", account.ID).
+			Update("balance", gorm.Expr("balance + ?", line.Amount)).Error; err != nil {
+			return false, err
+		}
+		if IsUserLedgerAccount(line.AccountType) {
+			if err := tx.First(account, account.ID).Error; err != nil {
+				return false, err
+			}
+			if account.Balance < 0 {
+				return false, ErrLedgerInsufficientBalance
+			}
+		}
+		if err := tx.Create(&model.LedgerPosting{EntryID: entry.ID, AccountID: account.ID, Amount: line.Amount}).Error; err != nil {
+			return false, err
+		}
+	}
+
+	for userID := range users {
+		if err := r.refreshWalletTx(tx, userID); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// PostUserBucketMovement 从用户 fromBucket 桶按 飞手→机主→客户 顺序扣减 amount
+// toBucket 非空时转入同一账户类型的 toBucket 桶，为空时转出到外部资金
+func (r *LedgerRepo) PostUserBucketMovement(entry *model.LedgerEntry, userID int64, fromBucket, toBucket string, amount int64) (bool, error) {
+	if amount <= 0 {
+		return false, errors.New("金额必须大于0")
+	}
+	posted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		takes, remaining, err := r.takeUserBucketTx(tx, userID, fromBucket, amount)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return ErrLedgerInsufficientBalance
+		}
+
+		var lines []LedgerLine
+		for _, take := range takes {
+			lines = append(lines, take)
+			if toBucket != "" {
+				lines = append(lines, LedgerLine{AccountType: take.AccountType, UserID: userID, Bucket: toBucket, Amount: -take.Amount})
+			} else {
+				lines = append(lines, LedgerLine{AccountType: model.LedgerAccountExternal, Bucket: model.LedgerBucketAvailable, Amount: -take.Amount})
+			}
+		}
+		postings, err := normalizeLedgerLines(entry, lines)
+		if err != nil {
+			return err
+		}
+		posted, err = r.postTx(tx, entry, postings, false)
+		return err
+	})
+	return posted, err
+}
+
+// PostUserDeduction 从用户可用余额按 飞手→机主→客户 顺序扣减 amount 转入系统科目 toAccount
+// 余额不足时只扣减实际可用部分，差额记入该用户的应收欠款；返回本次扣减金额，幂等键已记账时返回 0
+func (r *LedgerRepo) PostUserDeduction(entry *model.LedgerEntry, userID int64, toAccount string, amount int64) (int64, error) {
+	if amount <= 0 {
+		return 0, errors.New("金额必须大于0")
+	}
+	var deducted int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		lines, remaining, err := r.takeUserBucketTx(tx, userID, model.LedgerBucketAvailable, amount)
+		if err != nil {
+			return err
+		}
+		lines = append(lines,
+			LedgerLine{AccountType: toAccount, Amount: amount},
+			LedgerLine{AccountType: model.LedgerAccountReceivable, UserID: userID, Amount: -remaining},
+		)
+
+		postings, err := normalizeLedgerLines(entry, lines)
+		if err != nil {
+			return err
+		}
+		posted, err := r.postTx(tx, entry, postings, false)
+		if err != nil || !posted {
+			return err
+		}
+		deducted = amount - remaining
+		return nil
+	})
+	return deducted, err
+}
+
+// takeUserBucketTx 按 飞手→机主→客户 顺序从用户 bucket 桶取至多 amount
+// 返回各账户的扣减分录(金额为负)与余额不足未取到的差额
+func (r *LedgerRepo) takeUserBucketTx(tx *gorm.DB, userID int64, bucket string, amount int64) ([]LedgerLine, int64, error) {
+	if err := r.openLegacyWalletTx(tx, userID); err != nil {
+		return nil, 0, err
+	}
+	var accounts []model.LedgerAccount
+	if err := tx.Where("user_id = ? AND bucket = ? AND account_type IN ? AND balance > 0", userID, bucket, userLedgerAccountTypes()).
+		Find(&accounts).Error; err != nil {
+		return nil, 0, err
+	}
+	byType := make(map[string]int64, len(accounts))
+	for _, account := range accounts {
+		byType[account.AccountType] = account.Balance
+	}
+
+	remaining := amount
+	var lines []LedgerLine
+	for _, accountType := range userLedgerAccountTypes() {
+		if remaining == 0 {
+			break
+		}
+		take := byType[accountType]
+		if take > remaining {
+			take = remaining
+		}
+		if take <= 0 {
+			continue
+		}
+		remaining -= take
+		lines = append(lines, LedgerLine{AccountType: accountType, UserID: userID, Bucket: bucket, Amount: -take})
+	}
+	return lines, remaining, nil
+}
+
+// OpenLegacyWallets 为启用账本前已有余额、尚无账户的钱包补记期初余额，返回补记数
+func (r *LedgerRepo) OpenLegacyWallets(limit int) (int, error) {
+	var userIDs []int64
+	err := r.db.Model(&model.UserWallet{}).
+		Where("available_balance <> 0 OR frozen_balance <> 0").
+		Where("NOT EXISTS (SELECT 1 FROM ledger_accounts a WHERE a.user_id = user_wallets.user_id AND a.account_type IN ?)", userLedgerAccountTypes()).
+		Limit(limit).
+		Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, userID := range userIDs {
+		if err := r.db.Transaction(func(tx *gorm.DB) error {
+			return r.openLegacyWalletTx(tx, userID)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(userIDs), nil
+}
+
+// openLegacyWalletTx 用户首次记账前，将钱包中账本之外的历史余额以期初凭证转入账本，避免重算钱包时丢失
+// 历史余额按用户类型记入飞手/机主/客户账户，对方科目为外部资金
+func (r *LedgerRepo) openLegacyWalletTx(tx *gorm.DB, userID int64) error {
+	var accounts int64
+	if err := tx.Model(&model.LedgerAccount{}).
+		Where("user_id = ? AND account_type IN ?", userID, userLedgerAccountTypes()).
+		Count(&accounts).Error; err != nil {
+		return err
+	}
+	if accounts > 0 {
+		return nil
+	}
+	var wallet model.UserWallet
+	if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if wallet.AvailableBalance == 0 && wallet.FrozenBalance == 0 {
+		return nil
+	}
+
+	var userType string
+	if err := tx.Model(&model.User{}).Select("user_type").Where("id = ?", userID).Scan(&userType).Error; err != nil {
+		userType = ""
+	}
+	accountType := model.LedgerAccountClient
+	switch userType {
+	case "pilot":
+		accountType = model.LedgerAccountPilot
+	case "drone_owner", "owner":
+		accountType = model.LedgerAccountOwner
+	}
+
+	entry := &model.LedgerEntry{
+		EntryType:      "opening_balance",
+		ReferenceType:  "user_wallet",
+		ReferenceID:    wallet.ID,
+		IdempotencyKey: fmt.Sprintf("opening:wallet:%d", userID),
+		Description:    "启用账本前的钱包期初余额",
+	}
+	_, err := r.postTx(tx, entry, []LedgerLine{
+		{AccountType: accountType, UserID: userID, Bucket: model.LedgerBucketAvailable, Amount: wallet.AvailableBalance},
+		{AccountType: accountType, UserID: userID, Bucket: model.LedgerBucketFrozen, Amount: wallet.FrozenBalance},
+		{AccountType: model.LedgerAccountExternal, Bucket: model.LedgerBucketAvailable, Amount: -(wallet.AvailableBalance + wallet.FrozenBalance)},
+	}, false)
+	return err
+}
+
+// GetEntryByKey 按幂等键查询凭证及分录
+func (r *LedgerRepo) GetEntryByKey(key string) (*model.LedgerEntry, error) {
+	var entry model.LedgerEntry
+	err := r.db.Preload("Postings").Where("idempotency_key = ?", key).First(&entry).Error
+	return &entry, err
+}
+
+// ListUserBalances 查询用户各账户余额
+func (r *LedgerRepo) ListUserBalances(userID int64) ([]LedgerAccountBalance, error) {
+	var list []LedgerAccountBalance
+	err := r.db.Model(&model.LedgerAccount{}).
+		Select("account_type, user_id, bucket, balance").
+		Where("user_id = ? AND account_type IN ?", userID, userLedgerAccountTypes()).
+		Order("id ASC").
+		Scan(&list).Error
+	return list, err
+}
+
+// ListSystemBalances 查询平台侧账户余额
+func (r *LedgerRepo) ListSystemBalances() ([]LedgerAccountBalance, error) {
+	var list []LedgerAccountBalance
+	err := r.db.Model(&model.LedgerAccount{}).
+		Select("account_type, user_id, bucket, balance").
+		Where("account_type NOT IN ?", userLedgerAccountTypes()).
+		Order("id ASC").
+		Scan(&list).Error
+	return list, err
+}
+
+// GetAccountBalance 查询单个账户余额，账户不存在时为 0
+func (r *LedgerRepo) GetAccountBalance(accountType string, userID int64, bucket string) (int64, error) {
+	var account model.LedgerAccount
+	err := r.db.Where("account_type = ? AND user_id = ? AND bucket = ?", accountType, userID, bucket).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return account.Balance, err
+}
+
+// ========== 对账 ==========
+
+// LedgerEntryImbalance 借贷不平衡的凭证
+type LedgerEntryImbalance struct {
+	EntryID int64  `json:"entry_id"`
+	EntryNo string `json:"entry_no"`
+	Sum     int64  `json:"sum"`
+}
+
+// LedgerAccountDrift 账户缓存余额与分录合计不一致
+type LedgerAccountDrift struct {
+	AccountID     int64  `json:"account_id"`
+	AccountType   string `json:"account_type"`
+	UserID        int64  `json:"user_id"`
+	Bucket        string `json:"bucket"`
+	Balance       int64  `json:"balance"`
+	PostingsTotal int64  `json:"postings_total"`
+}
+
+// WalletLedgerDrift 钱包余额与账本汇总不一致
+type WalletLedgerDrift struct {
+	UserID          int64 `json:"user_id"`
+	WalletAvailable int64 `json:"wallet_available"`
+	LedgerAvailable int64 `json:"ledger_available"`
+	WalletFrozen    int64 `json:"wallet_frozen"`
+	LedgerFrozen    int64 `json:"ledger_frozen"`
+}
+
+// ListUnbalancedEntries 查询分录合计不为零的凭证
+func (r *LedgerRepo) ListUnbalancedEntries(limit int) ([]LedgerEntryImbalance, error) {
+	var list []LedgerEntryImbalance
+	err := r.db.Table("ledger_postings AS p").
+		Select("p.entry_id AS entry_id, e.entry_no AS entry_no, SUM(p.amount) AS sum").
+		Joins("JOIN ledger_entries e ON e.id = p.entry_id").
+		Group("p.entry_id, e.entry_no").
+		Having("SUM(p.amount) <> 0").
+		Limit(limit).
+		Scan(&list).Error
+	return list, err
+}
+
+// ListAccountDrifts 查询缓存余额与分录合计不一致的账户
+func (r *LedgerRepo) ListAccountDrifts(limit int) ([]LedgerAccountDrift, error) {
+	var list []LedgerAccountDrift
+	err := r.db.Table("ledger_accounts AS a").
+		Select("a.id AS account_id, a.account_type, a.user_id, a.bucket, a.balance, COALESCE(SUM(p.amount), 0) AS postings_total").
+		Joins("LEFT JOIN ledger_postings p ON p.account_id = a.id").
+		Group("a.id, a.account_type, a.user_id, a.bucket, a.balance").
+		Having("a.balance <> COALESCE(SUM(p.amount), 0)").
+		Limit(limit).
+		Scan(&list).Error
+	return list, err
+}
+
+// ListWalletDrifts 查询钱包余额与用户账户汇总不一致的用户(含有账户但没有钱包的情况)
+func (r *LedgerRepo) ListWalletDrifts(limit int) ([]WalletLedgerDrift, error) {
+	ledgerTotals := r.db.Model(&model.LedgerAccount{}).
+		Select("user_id, "+
+			"SUM(CASE WHEN bucket = ? THEN balance ELSE 0 END) AS ledger_available, "+
+			"SUM(CASE WHEN bucket = ? THEN balance ELSE 0 END) AS ledger_frozen",
+			model.LedgerBucketAvailable, model.LedgerBucketFrozen).
+		Where("account_type IN ?", userLedgerAccountTypes()).
+		Group("user_id")
+
+	var fromWallets []WalletLedgerDrift
+	err := r.db.Table("user_wallets AS w").
+		Select("w.user_id, w.available_balance AS wallet_available, COALESCE(l.ledger_available, 0) AS ledger_available, "+
+			"w.frozen_balance AS wallet_frozen, COALESCE(l.ledger_frozen, 0) AS ledger_frozen").
+		Joins("LEFT JOIN (?) AS l ON l.user_id = w.user_id", ledgerTotals).
+		Where("w.available_balance <> COALESCE(l.ledger_available, 0) OR w.frozen_balance <> COALESCE(l.ledger_frozen, 0)").
+		Limit(limit).
+		Scan(&fromWallets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var withoutWallet []WalletLedgerDrift
+	err = r.db.Table("(?) AS l", ledgerTotals).
+		Select("l.user_id, 0 AS wallet_available, l.ledger_available, 0 AS wallet_frozen, l.ledger_frozen").
+		Where("NOT EXISTS (SELECT 1 FROM user_wallets w WHERE w.user_id = l.user_id)").
+		Where("l.ledger_available <> 0 OR l.ledger_frozen <> 0").
+		Limit(limit).
+		Scan(&withoutWallet).Error
+	return append(fromWallets, withoutWallet...), err
+}
+
+// ========== Helpers ==========
+
+func userLedgerAccountTypes() []string {
+	return []string{model.LedgerAccountPilot, model.LedgerAccountOwner, model.LedgerAccountClient}
+}
+
+func (r *LedgerRepo) getOrCreateAccountTx(tx *gorm.DB, accountType string, userID int64, bucket string) (*model.LedgerAccount, error) {
+	account := &model.LedgerAccount{AccountType: accountType, UserID: userID, Bucket: bucket}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(account).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("account_type = ? AND user_id = ? AND bucket = ?", accountType, userID, bucket).First(account).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// refreshWalletTx 按用户账户余额重算钱包可用与冻结余额，钱包仅是账本的汇总视图
+func (r *LedgerRepo) refreshWalletTx(tx *gorm.DB, userID int64) error {
+	var totals struct {
+		Available int64
+		Frozen    int64
+	}
+	if err := tx.Model(&model.LedgerAccount{}).
+		Select("COALESCE(SUM(CASE WHEN bucket = ? THEN balance ELSE 0 END), 0) AS available, "+
+			"COALESCE(SUM(CASE WHEN bucket = ? THEN balance ELSE 0 END), 0) AS frozen",
+			model.LedgerBucketAvailable, model.LedgerBucketFrozen).
+		Where("user_id = ? AND account_type IN ?", userID, userLedgerAccountTypes()).
+		Scan(&totals).Error; err != nil {
+		return err
+	}
+
+	wallet := &model.UserWallet{UserID: userID, WalletType: "general", Status: "active"}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(wallet).Error; err != nil {
+		return err
+	}
+	return tx.Model(&model.UserWallet{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"available_balance": totals.Available,
+		"frozen_balance":    totals.Frozen,
+	}).Error
+}
+
+var ledgerEntrySeq uint64
+
+func generateLedgerEntryNo() string {
+	return fmt.Sprintf("LE%d%06d", time.Now().UnixNano()/1e6, atomic.AddUint64(&ledgerEntrySeq, 1)%1000000)
+}
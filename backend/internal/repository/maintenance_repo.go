@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type MaintenanceRepo struct {
+	db *gorm.DB
+}
+
+func NewMaintenanceRepo(db *gorm.DB) *MaintenanceRepo {
+	return &MaintenanceRepo{db: db}
+}
+
+func (r *MaintenanceRepo) DB() *gorm.DB {
+	return r.db
+}
+
+// FlightUsage 单次飞行计入维护的使用量
+type FlightUsage struct {
+	FlightRecordID       int64      `json:"flight_record_id"`
+	DroneID              int64      `json:"drone_id"`
+	TakeoffAt            *time.Time `json:"takeoff_at"`
+	LandingAt            *time.Time `json:"landing_at"`
+	TotalDurationSeconds int        `json:"total_duration_seconds"`
+	CargoWeightKG        float64    `json:"cargo_weight_kg"`
+	CriticalAlerts       int        `json:"critical_alerts"`
+}
+
+func (r *MaintenanceRepo) flightUsageQuery() *gorm.DB {
+	return r.db.Table("flight_records AS fr").
+		Select(`fr.id AS flight_record_id, fr.drone_id, fr.takeoff_at, fr.landing_at, fr.total_duration_seconds,
+			COALESCE(d.cargo_weight_kg, 0) AS cargo_weight_kg,
+			(SELECT COUNT(*) FROM flight_alerts fa WHERE fa.flight_record_id = fr.id AND fa.alert_level = 'critical') AS critical_alerts`).
+		Joins("LEFT JOIN orders o ON o.id = fr.order_id").
+		Joins("LEFT JOIN demands d ON d.id = o.demand_id").
+		Where("fr.deleted_at IS NULL AND fr.drone_id > 0 AND fr.status IN ?", []string{"completed", "aborted"})
+}
+
+// ListUncountedFlights 已结束但尚未计入维护使用量的飞行
+func (r *MaintenanceRepo) ListUncountedFlights(limit int) ([]FlightUsage, error) {
+	var usages []FlightUsage
+	err := r.flightUsageQuery().
+		Where("fr.maintenance_counted_at IS NULL").
+		Order("fr.id ASC").
+		Limit(limit).
+		Scan(&usages).Error
+	return usages, err
+}
+
+// ListCountedFlightsSince 无人机自 since 起已计入维护使用量的飞行，用于估算日均使用量
+func (r *MaintenanceRepo) ListCountedFlightsSince(droneID int64, since time.Time) ([]FlightUsage, error) {
+	var usages []FlightUsage
+	err := r.flightUsageQuery().
+		Where("fr.drone_id = ? AND fr.maintenance_counted_at IS NOT NULL", droneID).
+		Where("COALESCE(fr.landing_at, fr.updated_at) >= ?", since).
+		Order("fr.id ASC").
+		Scan(&usages).Error
+	return usages, err
+}
+
+// ApplyFlightUsage 标记飞行已计入并累加无人机使用量，已被其他任务计入时返回 false
+func (r *MaintenanceRepo) ApplyFlightUsage(usage *FlightUsage, hours, payloadHours float64, at time.Time) (bool, error) {
+	applied := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.FlightRecord{}).
+			Where("id = ? AND maintenance_counted_at IS NULL", usage.FlightRecordID).
+			UpdateColumn("maintenance_counted_at", at)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var counter model.DroneUsageCounter
+		err := tx.Where("drone_id = ?", usage.DroneID).First(&counter).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			counter = model.DroneUsageCounter{DroneID: usage.DroneID}
+			if err := tx.Create(&counter).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"flight_hours":    gorm.Expr("flight_hours + ?", hours),
+			"cycles":          gorm.Expr("cycles + ?", 1),
+			"payload_hours":   gorm.Expr("payload_hours + ?", payloadHours),
+			"critical_alerts": gorm.Expr("critical_alerts + ?", usage.CriticalAlerts),
+			"updated_at":      at,
+		}
+		lastFlightAt := usage.LandingAt
+		if lastFlightAt == nil {
+			lastFlightAt = usage.TakeoffAt
+		}
+		if lastFlightAt != nil && (counter.LastFlightAt == nil || lastFlightAt.After(*counter.LastFlightAt)) {
+			updates["last_flight_at"] = *lastFlightAt
+		}
+		if err := tx.Model(&model.DroneUsageCounter{}).Where("id = ?", counter.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		applied = true
+		return nil
+	})
+	return applied, err
+}
+
+// GetUsageCounter 无人机累计使用量，尚无飞行时返回零值
+func (r *MaintenanceRepo) GetUsageCounter(droneID int64) (*model.DroneUsageCounter, error) {
+	var counter model.DroneUsageCounter
+	err := r.db.Where("drone_id = ?", droneID).First(&counter).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.DroneUsageCounter{DroneID: droneID}, nil
+	}
+	return &counter, err
+}
+
+// ListUsageCounters 所有已有飞行使用量的无人机计数器
+func (r *MaintenanceRepo) ListUsageCounters() ([]model.DroneUsageCounter, error) {
+	var counters []model.DroneUsageCounter
+	err := r.db.Order("drone_id ASC").Find(&counters).Error
+	return counters, err
+}
+
+// ListSchedules 启用的维护计划，包含通用计划与该机型的专属计划
+func (r *MaintenanceRepo) ListSchedules(brand, droneModel string) ([]model.MaintenanceSchedule, error) {
+	var schedules []model.MaintenanceSchedule
+	err := r.db.Where("enabled = ?", true).
+		Where("(brand = '' AND model = '') OR (brand = ? AND model IN ?)", brand, []string{"", droneModel}).
+		Order("id ASC").
+		Find(&schedules).Error
+	return schedules, err
+}
+
+// ListBaselines 无人机各部件的上次维护基线
+func (r *MaintenanceRepo) ListBaselines(droneID int64) ([]model.DroneComponentBaseline, error) {
+	var baselines []model.DroneComponentBaseline
+	err := r.db.Where("drone_id = ?", droneID).Find(&baselines).Error
+	return baselines, err
+}
+
+// ListOpenWorkOrders 无人机未完成的维护工单
+func (r *MaintenanceRepo) ListOpenWorkOrders(droneID int64) ([]model.MaintenanceWorkOrder, error) {
+	var orders []model.MaintenanceWorkOrder
+	err := r.db.Where("drone_id = ? AND status = ?", droneID, "open").Order("id ASC").Find(&orders).Error
+	return orders, err
+}
+
+// CreateWorkOrder 创建维护工单
+func (r *MaintenanceRepo) CreateWorkOrder(order *model.MaintenanceWorkOrder) error {
+	return r.db.Create(order).Error
+}
+
+// UpdateWorkOrder 更新维护工单字段
+func (r *MaintenanceRepo) UpdateWorkOrder(id int64, fields map[string]interface{}) error {
+	return r.db.Model(&model.MaintenanceWorkOrder{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// ListWorkOrders 维护工单列表，filters 支持 drone_id、owner_id、status
+func (r *MaintenanceRepo) ListWorkOrders(page, pageSize int, filters map[string]interface{}) ([]model.MaintenanceWorkOrder, int64, error) {
+	var orders []model.MaintenanceWorkOrder
+	var total int64
+	query := r.db.Model(&model.MaintenanceWorkOrder{})
+	for _, key := range []string{"drone_id", "owner_id", "status"} {
+		if value, ok := filters[key]; ok {
+			query = query.Where(key+" = ?", value)
+		}
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	err := query.Preload("Drone").Order("id DESC").Offset(offset).Limit(pageSize).Find(&orders).Error
+	return orders, total, err
+}
+
+// GroundDrone 超过强制维护上限时将无人机转入维护状态并暂停供给，同时标记工单已停飞
+func (r *MaintenanceRepo) GroundDrone(drone *model.Drone, workOrderIDs []int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		drone.AvailabilityStatus = "maintenance"
+		if err := NewDroneRepo(tx).UpdateFields(drone.ID, map[string]interface{}{"availability_status": "maintenance"}); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.MaintenanceWorkOrder{}).Where("id IN ?", workOrderIDs).Update("grounded", true).Error; err != nil {
+			return err
+		}
+		return NewOwnerDomainRepo(tx).SyncSupplyCapabilityByDrone(drone)
+	})
+}
+
+// CompleteService 登记维护后重置部件基线并完成对应工单
+func (r *MaintenanceRepo) CompleteService(counter *model.DroneUsageCounter, components []string, log *model.DroneMaintenanceLog, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, component := range components {
+			baseline := model.DroneComponentBaseline{DroneID: counter.DroneID, Component: component}
+			if err := tx.Where("drone_id = ? AND component = ?", counter.DroneID, component).FirstOrInit(&baseline).Error; err != nil {
+				return err
+			}
+			servicedAt := log.MaintenanceDate
+			baseline.ServicedAt = &servicedAt
+			baseline.FlightHours = counter.FlightHours
+			baseline.Cycles = counter.Cycles
+			baseline.PayloadHours = counter.PayloadHours
+			baseline.CriticalAlerts = counter.CriticalAlerts
+			baseline.MaintenanceLogID = log.ID
+			if err := tx.Save(&baseline).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.MaintenanceWorkOrder{}).
+			Where("drone_id = ? AND status = ? AND component IN ?", counter.DroneID, "open", components).
+			Updates(map[string]interface{}{"status": "completed", "maintenance_log_id": log.ID, "completed_at": at}).Error
+	})
+}
+
+// ReleaseDrone 维护完成且无停飞工单时恢复无人机可用并同步供给
+func (r *MaintenanceRepo) ReleaseDrone(drone *model.Drone) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		drone.AvailabilityStatus = "available"
+		if err := NewDroneRepo(tx).UpdateFields(drone.ID, map[string]interface{}{"availability_status": "available"}); err != nil {
+			return err
+		}
+		return NewOwnerDomainRepo(tx).SyncSupplyCapabilityByDrone(drone)
+	})
+}
@@ -134,6 +134,8 @@ func BuildPricingSnapshot(order *model.Order) model.JSON {
 		"platform_commission":      order.PlatformCommission,
 		"owner_amount":             order.OwnerAmount,
 		"service_type":             order.ServiceType,
+		"refund_policy_id":         order.RefundPolicyID,
+		"refund_policy_version":    order.RefundPolicyVersion,
 	})
 }
 
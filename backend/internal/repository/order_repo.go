@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -351,6 +352,20 @@ func (r *OrderRepo) ListOrdersForFlightSyncByPilotUser(pilotUserID int64) ([]mod
 	return orders, err
 }
 
+// GetInTransitOrderByMavlinkSystemID 按飞控 MAVLink 系统ID查找飞行中的订单(尚未生成飞行记录时使用)
+func (r *OrderRepo) GetInTransitOrderByMavlinkSystemID(systemID int) (*model.Order, error) {
+	var order model.Order
+	err := r.db.Model(&model.Order{}).
+		Joins("JOIN drones ON drones.id = orders.drone_id AND drones.deleted_at IS NULL").
+		Where("drones.mavlink_system_id = ? AND orders.status = ? AND orders.deleted_at IS NULL", systemID, "in_transit").
+		Order("orders.updated_at DESC, orders.id DESC").
+		First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 func (r *OrderRepo) AddTimeline(timeline *model.OrderTimeline) error {
 	return r.db.Create(timeline).Error
 }
@@ -391,3 +406,57 @@ func (r *OrderRepo) GetStatistics() (map[string]int64, error) {
 	}
 	return stats, nil
 }
+
+// CountPaidOrdersByClient 客户已支付过的订单数，excludeOrderID 用于排除当前订单
+func (r *OrderRepo) CountPaidOrdersByClient(clientUserID, excludeOrderID int64) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Order{}).
+		Where("(client_user_id = ? OR renter_id = ?) AND paid_at IS NOT NULL AND id <> ?", clientUserID, clientUserID, excludeOrderID).
+		Count(&count).Error
+	return count, err
+}
+
+// ResolveCity 订单所在城市：优先取需求地址快照，其次取供给服务区域与无人机所在城市
+func (r *OrderRepo) ResolveCity(order *model.Order) string {
+	if order == nil {
+		return ""
+	}
+	if order.DemandID > 0 {
+		var demand model.Demand
+		if err := r.db.Select("service_address_snapshot", "departure_address_snapshot").First(&demand, order.DemandID).Error; err == nil {
+			for _, snapshot := range []model.JSON{demand.ServiceAddressSnapshot, demand.DepartureAddressSnapshot} {
+				if city := addressSnapshotCity(snapshot); city != "" {
+					return city
+				}
+			}
+		}
+	}
+	if order.SourceSupplyID > 0 {
+		var supply model.OwnerSupply
+		if err := r.db.Select("service_area_snapshot").First(&supply, order.SourceSupplyID).Error; err == nil {
+			if city := addressSnapshotCity(supply.ServiceAreaSnapshot); city != "" {
+				return city
+			}
+		}
+	}
+	if order.DroneID > 0 {
+		var drone model.Drone
+		if err := r.db.Select("city").First(&drone, order.DroneID).Error; err == nil {
+			return strings.TrimSpace(drone.City)
+		}
+	}
+	return ""
+}
+
+func addressSnapshotCity(raw model.JSON) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var payload struct {
+		City string `json:"city"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(payload.City)
+}
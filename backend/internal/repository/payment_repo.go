@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"wurenji-backend/internal/model"
 
 	"gorm.io/gorm"
@@ -56,3 +58,24 @@ func (r *PaymentRepo) List(page, pageSize int) ([]model.Payment, int64, error) {
 	err := r.db.Offset((page - 1) * pageSize).Limit(pageSize).Order("created_at DESC").Find(&payments).Error
 	return payments, total, err
 }
+
+// ListPendingForSync 获取指定渠道在时间窗口内创建、仍未收到回调的支付单，最久未检查的优先
+func (r *PaymentRepo) ListPendingForSync(methods []string, createdAfter, createdBefore time.Time, limit int) ([]model.Payment, error) {
+	var payments []model.Payment
+	err := r.db.Where("status = ? AND payment_method IN ? AND created_at >= ? AND created_at <= ?", "pending", methods, createdAfter, createdBefore).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&payments).Error
+	return payments, err
+}
+
+// UpdateStatusIfPending 仅在支付单仍为 pending 时更新状态，返回是否更新
+func (r *PaymentRepo) UpdateStatusIfPending(id int64, status string) (bool, error) {
+	result := r.db.Model(&model.Payment{}).Where("id = ? AND status = ?", id, "pending").Update("status", status)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Touch 刷新更新时间，用于轮询时轮转检查顺序
+func (r *PaymentRepo) Touch(id int64) error {
+	return r.db.Model(&model.Payment{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+type RefundPolicyRepo struct {
+	db *gorm.DB
+}
+
+func NewRefundPolicyRepo(db *gorm.DB) *RefundPolicyRepo {
+	return &RefundPolicyRepo{db: db}
+}
+
+func (r *RefundPolicyRepo) Create(policy *model.RefundPolicy) error {
+	return r.db.Create(policy).Error
+}
+
+func (r *RefundPolicyRepo) GetByID(id int64) (*model.RefundPolicy, error) {
+	var policy model.RefundPolicy
+	if err := r.db.First(&policy, id).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// NextVersion 政策编码的下一个版本号
+func (r *RefundPolicyRepo) NextVersion(policyCode string) (int, error) {
+	var latest int
+	err := r.db.Model(&model.RefundPolicy{}).
+		Where("policy_code = ?", policyCode).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error
+	return latest + 1, err
+}
+
+// ListActive 全部生效中的政策
+func (r *RefundPolicyRepo) ListActive() ([]model.RefundPolicy, error) {
+	var policies []model.RefundPolicy
+	err := r.db.Where("status = ?", "active").Order("id DESC").Find(&policies).Error
+	return policies, err
+}
+
+func (r *RefundPolicyRepo) List(policyCode, status string, page, pageSize int) ([]model.RefundPolicy, int64, error) {
+	var policies []model.RefundPolicy
+	var total int64
+
+	query := r.db.Model(&model.RefundPolicy{})
+	if policyCode != "" {
+		query = query.Where("policy_code = ?", policyCode)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := query.Order("policy_code ASC, version DESC").Offset(offset).Limit(pageSize).Find(&policies).Error; err != nil {
+		return nil, 0, err
+	}
+	return policies, total, nil
+}
+
+// Activate 启用草稿版本，并停用同一政策编码下此前生效的版本
+func (r *RefundPolicyRepo) Activate(policy *model.RefundPolicy) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&model.RefundPolicy{}).
+			Where("policy_code = ? AND status = ? AND id <> ?", policy.PolicyCode, "active", policy.ID).
+			Updates(map[string]interface{}{"status": "retired", "updated_at": now}).Error; err != nil {
+			return err
+		}
+		policy.Status = "active"
+		policy.ActivatedAt = &now
+		return tx.Model(&model.RefundPolicy{}).Where("id = ?", policy.ID).Updates(map[string]interface{}{
+			"status":       policy.Status,
+			"activated_at": policy.ActivatedAt,
+			"updated_at":   now,
+		}).Error
+	})
+}
@@ -1,12 +1,15 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"wurenji-backend/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SettlementRepo struct {
@@ -82,6 +85,254 @@ func (r *SettlementRepo) ListPendingSettlements() ([]model.OrderSettlement, erro
 	return list, err
 }
 
+// OpenDisputeStatuses 未决纠纷状态，存在此类纠纷的订单不自动确认结算
+var OpenDisputeStatuses = []string{"open", "responded", "arbitrating"}
+
+// DisputeAdjustment 已结案纠纷对结算的调整
+type DisputeAdjustment struct {
+	RefundAmount       int64 // 判定退还客户的金额，从结算总额中扣除
+	PilotPenaltyAmount int64 // 飞手罚金，从飞手分成中扣除
+	OwnerPenaltyAmount int64 // 机主罚金，从机主分成中扣除
+}
+
+// SumDisputeAdjustments 汇总订单已结案纠纷的退款与罚金
+func (r *SettlementRepo) SumDisputeAdjustments(orderID int64) (DisputeAdjustment, error) {
+	var adjustment DisputeAdjustment
+	var disputes []model.DisputeRecord
+	if err := r.db.Where("order_id = ? AND status = ?", orderID, "resolved").Find(&disputes).Error; err != nil {
+		return adjustment, err
+	}
+	for _, dispute := range disputes {
+		adjustment.RefundAmount += dispute.RefundAmount
+		switch dispute.LiableRole {
+		case "pilot":
+			adjustment.PilotPenaltyAmount += dispute.PenaltyAmount
+		case "owner":
+			adjustment.OwnerPenaltyAmount += dispute.PenaltyAmount
+		}
+	}
+	return adjustment, nil
+}
+
+// EnqueueSettlement 为订单登记待计算结算，订单已有结算时不做改动(order_id 唯一)
+func (r *SettlementRepo) EnqueueSettlement(s *model.OrderSettlement) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(s).Error
+}
+
+// ListSettlementsDue 查询指定状态、已到重试时间的结算
+func (r *SettlementRepo) ListSettlementsDue(status string, now time.Time, limit int) ([]model.OrderSettlement, error) {
+	var list []model.OrderSettlement
+	err := r.db.Where("status = ? AND (next_retry_at IS NULL OR next_retry_at <= ?)", status, now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListSettlementsDueForConfirm 查询争议期已结束且订单没有未决纠纷的待确认结算
+func (r *SettlementRepo) ListSettlementsDueForConfirm(now time.Time, limit int) ([]model.OrderSettlement, error) {
+	var list []model.OrderSettlement
+	err := r.db.Where("status = ? AND auto_confirm_at IS NOT NULL AND auto_confirm_at <= ?", "calculated", now).
+		Where("next_retry_at IS NULL OR next_retry_at <= ?", now).
+		Where("NOT EXISTS (?)", r.db.Model(&model.DisputeRecord{}).
+			Select("1").
+			Where("dispute_records.order_id = order_settlements.order_id AND dispute_records.status IN ?", OpenDisputeStatuses)).
+		Order("auto_confirm_at ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListCompletedOrderIDsWithoutSettlement 查询 completedAfter 之后完成、尚未登记结算的订单，用于补偿入队失败
+func (r *SettlementRepo) ListCompletedOrderIDsWithoutSettlement(completedAfter time.Time, limit int) ([]int64, error) {
+	var ids []int64
+	err := r.db.Model(&model.Order{}).
+		Where("status = ? AND completed_at >= ?", "completed", completedAfter).
+		Where("NOT EXISTS (?)", r.db.Unscoped().Model(&model.OrderSettlement{}).
+			Select("1").
+			Where("order_settlements.order_id = orders.id")).
+		Order("completed_at ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// TransitionSettlement 仅当结算仍处于 fromStatus 时更新字段，返回是否更新成功，用于多实例并发下的幂等推进
+func (r *SettlementRepo) TransitionSettlement(id int64, fromStatus string, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.OrderSettlement{}).
+		Where("id = ? AND status = ?", id, fromStatus).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordSettlementFailure 记录结算推进失败，保持当前状态等待下次重试
+func (r *SettlementRepo) RecordSettlementFailure(id int64, attempts int, lastError string, nextRetryAt time.Time) error {
+	return r.db.Model(&model.OrderSettlement{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":      attempts,
+		"last_error":    lastError,
+		"next_retry_at": nextRetryAt,
+	}).Error
+}
+
+// SettlementCredit 结算入账明细
+type SettlementCredit struct {
+	AccountType string // pilot, owner
+	UserID      int64
+	Amount      int64
+	Description string
+}
+
+// SettleWithCredits 在同一事务内将已确认结算置为 settled，并以一张平衡凭证把托管资金拆分到平台、保险与各方账户
+// 结算已不是 confirmed 时不做任何入账并返回 false，保证重复执行不会重复入账；无归属用户的分成留在平台
+func (r *SettlementRepo) SettleWithCredits(s *model.OrderSettlement, settledBy string, credits []SettlementCredit) (bool, error) {
+	settled := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&model.OrderSettlement{}).
+			Where("id = ? AND status = ?", s.ID, "confirmed").
+			Updates(map[string]interface{}{
+				"status":        "settled",
+				"settled_at":    &now,
+				"settled_by":    settledBy,
+				"attempts":      0,
+				"last_error":    "",
+				"next_retry_at": nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		platformShare := s.PlatformFee
+		lines := []LedgerLine{
+			{AccountType: model.LedgerAccountEscrow, Amount: -s.FinalAmount},
+			{AccountType: model.LedgerAccountInsurance, Amount: s.InsuranceDeduction},
+		}
+		balances := make(map[int64]int64)
+		for _, credit := range credits {
+			if credit.Amount <= 0 {
+				continue
+			}
+			if credit.UserID <= 0 {
+				platformShare += credit.Amount
+				continue
+			}
+			lines = append(lines, LedgerLine{AccountType: credit.AccountType, UserID: credit.UserID, Amount: credit.Amount})
+			if _, ok := balances[credit.UserID]; !ok {
+				wallet, err := r.getOrCreateWalletTx(tx, credit.UserID, "general")
+				if err != nil {
+					return err
+				}
+				balances[credit.UserID] = wallet.AvailableBalance
+			}
+		}
+		lines = append(lines, LedgerLine{AccountType: model.LedgerAccountPlatform, Amount: platformShare})
+		if s.PlatformSubsidy > 0 {
+			lines = append(lines, LedgerLine{AccountType: model.LedgerAccountSubsidy, Amount: -s.PlatformSubsidy})
+		}
+
+		if _, err := NewLedgerRepo(tx).Post(&model.LedgerEntry{
+			EntryType:      "settlement",
+			ReferenceType:  "order_settlement",
+			ReferenceID:    s.ID,
+			IdempotencyKey: fmt.Sprintf("settlement:%d", s.ID),
+			Description:    fmt.Sprintf("订单%s结算分账", s.OrderNo),
+		}, lines); err != nil {
+			return err
+		}
+
+		for _, credit := range credits {
+			if credit.UserID <= 0 || credit.Amount <= 0 {
+				continue
+			}
+			before := balances[credit.UserID]
+			balances[credit.UserID] = before + credit.Amount
+			if err := r.appendWalletStatementTx(tx, credit.UserID, "income", credit.Amount, before, balances[credit.UserID], s.OrderID, s.ID, credit.Description); err != nil {
+				return err
+			}
+			if err := tx.Model(&model.UserWallet{}).Where("user_id = ?", credit.UserID).
+				Update("total_income", gorm.Expr("total_income + ?", credit.Amount)).Error; err != nil {
+				return err
+			}
+		}
+		settled = true
+		return nil
+	})
+	return settled, err
+}
+
+// CreditCancellationCompensation 订单取消后把托管资金中未退款部分拆分给补偿对象与平台，按订单幂等
+func (r *SettlementRepo) CreditCancellationCompensation(order *model.Order, credit SettlementCredit, platformRetained int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var before int64
+		if credit.UserID > 0 && credit.Amount > 0 {
+			wallet, err := r.getOrCreateWalletTx(tx, credit.UserID, "general")
+			if err != nil {
+				return err
+			}
+			before = wallet.AvailableBalance
+		} else {
+			platformRetained += credit.Amount
+			credit.Amount = 0
+		}
+
+		lines := []LedgerLine{
+			{AccountType: model.LedgerAccountEscrow, Amount: -(credit.Amount + platformRetained)},
+			{AccountType: model.LedgerAccountPlatform, Amount: platformRetained},
+		}
+		if credit.Amount > 0 {
+			lines = append(lines, LedgerLine{AccountType: credit.AccountType, UserID: credit.UserID, Amount: credit.Amount})
+		}
+		posted, err := NewLedgerRepo(tx).Post(&model.LedgerEntry{
+			EntryType:      "cancel_compensation",
+			ReferenceType:  "order",
+			ReferenceID:    order.ID,
+			IdempotencyKey: fmt.Sprintf("cancel_compensation:%d", order.ID),
+			Description:    fmt.Sprintf("订单%s取消补偿", order.OrderNo),
+		}, lines)
+		if err != nil || !posted || credit.Amount <= 0 {
+			return err
+		}
+
+		if err := r.appendWalletStatementTx(tx, credit.UserID, "income", credit.Amount, before, before+credit.Amount, order.ID, 0, credit.Description); err != nil {
+			return err
+		}
+		return tx.Model(&model.UserWallet{}).Where("user_id = ?", credit.UserID).
+			Update("total_income", gorm.Expr("total_income + ?", credit.Amount)).Error
+	})
+}
+
+// ChargeCancellationPenalty 服务方违约取消时从责任方可用余额扣缴违约金转入平台，按订单幂等
+// 余额不足时只扣缴可用部分，差额记为责任方应收欠款，返回实际扣缴金额
+func (r *SettlementRepo) ChargeCancellationPenalty(order *model.Order, userID, amount int64, description string) (int64, error) {
+	var charged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		wallet, err := r.getOrCreateWalletTx(tx, userID, "general")
+		if err != nil {
+			return err
+		}
+		before := wallet.AvailableBalance
+
+		charged, err = NewLedgerRepo(tx).PostUserDeduction(&model.LedgerEntry{
+			EntryType:      "cancel_penalty",
+			ReferenceType:  "order",
+			ReferenceID:    order.ID,
+			IdempotencyKey: fmt.Sprintf("cancel_penalty:%d", order.ID),
+			Description:    description,
+		}, userID, model.LedgerAccountPlatform, amount)
+		if err != nil || charged == 0 {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).First(wallet).Error; err != nil {
+			return err
+		}
+		return r.appendWalletStatementTx(tx, userID, "deduct", -charged, before, wallet.AvailableBalance, order.ID, 0, description)
+	})
+	return charged, err
+}
+
 // ========== UserWallet ==========
 
 func (r *SettlementRepo) GetOrCreateWallet(userID int64, walletType string) (*model.UserWallet, error) {
@@ -111,134 +362,118 @@ func (r *SettlementRepo) UpdateWallet(w *model.UserWallet) error {
 	return r.db.Save(w).Error
 }
 
-// AddWalletIncome 增加钱包收入(事务安全)
-func (r *SettlementRepo) AddWalletIncome(userID int64, amount int64, orderID, settlementID int64, description string) error {
+// CreateWithdrawalWithFreeze 创建提现记录，并在同一事务内将提现金额从可用余额转入冻结
+func (r *SettlementRepo) CreateWithdrawalWithFreeze(w *model.WithdrawalRecord) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		wallet, err := r.getOrCreateWalletTx(tx, userID, "general")
-		if err != nil {
-			return err
-		}
-		if wallet.Status != "active" {
-			return fmt.Errorf("钱包状态异常: %s", wallet.Status)
-		}
-
-		balanceBefore := wallet.AvailableBalance
-		wallet.AvailableBalance += amount
-		wallet.TotalIncome += amount
-		if err := tx.Save(wallet).Error; err != nil {
+		if err := tx.Create(w).Error; err != nil {
 			return err
 		}
-
-		txRecord := &model.WalletTransaction{
-			TransactionNo:       generateTransactionNo(),
-			WalletID:            wallet.ID,
-			UserID:              userID,
-			Type:                "income",
-			Amount:              amount,
-			BalanceBefore:       balanceBefore,
-			BalanceAfter:        wallet.AvailableBalance,
-			RelatedOrderID:      orderID,
-			RelatedSettlementID: settlementID,
-			Description:         description,
-		}
-		return tx.Create(txRecord).Error
+		return r.moveWithdrawalFundsTx(tx, w, "freeze", model.LedgerBucketAvailable, model.LedgerBucketFrozen, "提现冻结")
 	})
 }
 
-// FreezeWalletBalance 冻结余额(用于提现)
-func (r *SettlementRepo) FreezeWalletBalance(userID int64, amount int64, description string) error {
+// ErrWithdrawalStatusChanged 提现记录已被其他流程推进，本次状态变更未生效
+var ErrWithdrawalStatusChanged = errors.New("提现状态已变更")
+
+// CompleteWithdrawal 提现记录仍为 fromStatus 时保存为已完成，并将冻结金额转出到外部资金
+func (r *SettlementRepo) CompleteWithdrawal(w *model.WithdrawalRecord, fromStatus string) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		wallet, err := r.getOrCreateWalletTx(tx, userID, "general")
-		if err != nil {
+		if err := saveWithdrawalFromTx(tx, w, fromStatus); err != nil {
 			return err
 		}
-		if wallet.AvailableBalance < amount {
-			return fmt.Errorf("余额不足: 可用%d, 需冻结%d", wallet.AvailableBalance, amount)
-		}
-
-		balanceBefore := wallet.AvailableBalance
-		wallet.AvailableBalance -= amount
-		wallet.FrozenBalance += amount
-		wallet.TotalFrozen += amount
-		if err := tx.Save(wallet).Error; err != nil {
+		if err := r.moveWithdrawalFundsTx(tx, w, "payout", model.LedgerBucketFrozen, "", fmt.Sprintf("提现%s完成", w.WithdrawalNo)); err != nil {
 			return err
 		}
-
-		txRecord := &model.WalletTransaction{
-			TransactionNo: generateTransactionNo(),
-			WalletID:      wallet.ID,
-			UserID:        userID,
-			Type:          "freeze",
-			Amount:        -amount,
-			BalanceBefore: balanceBefore,
-			BalanceAfter:  wallet.AvailableBalance,
-			Description:   description,
-		}
-		return tx.Create(txRecord).Error
+		return tx.Model(&model.UserWallet{}).Where("user_id = ?", w.UserID).
+			Update("total_withdrawn", gorm.Expr("total_withdrawn + ?", w.Amount)).Error
 	})
 }
 
-// UnfreezeWalletBalance 解冻余额(提现失败时)
-func (r *SettlementRepo) UnfreezeWalletBalance(userID int64, amount int64, description string) error {
+// ReleaseWithdrawal 提现记录仍为 fromStatus 时保存为被拒绝或失败，并解冻提现金额
+func (r *SettlementRepo) ReleaseWithdrawal(w *model.WithdrawalRecord, fromStatus, description string) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		wallet, err := r.getOrCreateWalletTx(tx, userID, "general")
-		if err != nil {
+		if err := saveWithdrawalFromTx(tx, w, fromStatus); err != nil {
 			return err
 		}
-		if wallet.FrozenBalance < amount {
-			return fmt.Errorf("冻结余额不足")
-		}
-
-		balanceBefore := wallet.AvailableBalance
-		wallet.AvailableBalance += amount
-		wallet.FrozenBalance -= amount
-		if err := tx.Save(wallet).Error; err != nil {
-			return err
-		}
-
-		txRecord := &model.WalletTransaction{
-			TransactionNo: generateTransactionNo(),
-			WalletID:      wallet.ID,
-			UserID:        userID,
-			Type:          "unfreeze",
-			Amount:        amount,
-			BalanceBefore: balanceBefore,
-			BalanceAfter:  wallet.AvailableBalance,
-			Description:   description,
-		}
-		return tx.Create(txRecord).Error
+		return r.moveWithdrawalFundsTx(tx, w, "release", model.LedgerBucketFrozen, model.LedgerBucketAvailable, description)
 	})
 }
 
-// DeductFrozenBalance 扣减冻结余额(提现成功时)
-func (r *SettlementRepo) DeductFrozenBalance(userID int64, amount int64, description string) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		wallet, err := r.getOrCreateWalletTx(tx, userID, "general")
-		if err != nil {
-			return err
-		}
-		if wallet.FrozenBalance < amount {
+// saveWithdrawalFromTx 以状态条件保存提现记录，防止完成与解冻并发重复执行
+func saveWithdrawalFromTx(tx *gorm.DB, w *model.WithdrawalRecord, fromStatus string) error {
+	result := tx.Model(&model.WithdrawalRecord{}).
+		Where("id = ? AND status = ?", w.ID, fromStatus).
+		Select("*").Omit("created_at").
+		Updates(w)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWithdrawalStatusChanged
+	}
+	return nil
+}
+
+// moveWithdrawalFundsTx 按提现动作记账并追加钱包流水，同一提现的同一动作只记一次
+func (r *SettlementRepo) moveWithdrawalFundsTx(tx *gorm.DB, w *model.WithdrawalRecord, action, fromBucket, toBucket, description string) error {
+	wallet, err := r.getOrCreateWalletTx(tx, w.UserID, "general")
+	if err != nil {
+		return err
+	}
+	before := wallet.AvailableBalance
+
+	posted, err := NewLedgerRepo(tx).PostUserBucketMovement(&model.LedgerEntry{
+		EntryType:      "withdrawal_" + action,
+		ReferenceType:  "withdrawal",
+		ReferenceID:    w.ID,
+		IdempotencyKey: fmt.Sprintf("withdrawal:%s:%s", w.WithdrawalNo, action),
+		Description:    description,
+	}, w.UserID, fromBucket, toBucket, w.Amount)
+	if errors.Is(err, ErrLedgerInsufficientBalance) {
+		if fromBucket == model.LedgerBucketFrozen {
 			return fmt.Errorf("冻结余额不足")
 		}
+		return fmt.Errorf("余额不足: 可用%d, 需冻结%d", before, w.Amount)
+	}
+	if err != nil || !posted {
+		return err
+	}
 
-		wallet.FrozenBalance -= amount
-		wallet.TotalWithdrawn += amount
-		if err := tx.Save(wallet).Error; err != nil {
+	if err := tx.Where("user_id = ?", w.UserID).First(wallet).Error; err != nil {
+		return err
+	}
+	statementTypes := map[string]string{"freeze": "freeze", "release": "unfreeze", "payout": "deduct"}
+	amount := wallet.AvailableBalance - before
+	if action == "payout" {
+		amount = -w.Amount
+	}
+	if action == "freeze" {
+		if err := tx.Model(&model.UserWallet{}).Where("user_id = ?", w.UserID).
+			Update("total_frozen", gorm.Expr("total_frozen + ?", w.Amount)).Error; err != nil {
 			return err
 		}
+	}
+	return r.appendWalletStatementTx(tx, w.UserID, statementTypes[action], amount, before, wallet.AvailableBalance, 0, 0, description)
+}
 
-		txRecord := &model.WalletTransaction{
-			TransactionNo: generateTransactionNo(),
-			WalletID:      wallet.ID,
-			UserID:        userID,
-			Type:          "deduct",
-			Amount:        -amount,
-			BalanceBefore: wallet.AvailableBalance,
-			BalanceAfter:  wallet.AvailableBalance,
-			Description:   description,
-		}
-		return tx.Create(txRecord).Error
-	})
+// appendWalletStatementTx 追加面向用户的钱包流水，余额以账本重算后的钱包为准
+func (r *SettlementRepo) appendWalletStatementTx(tx *gorm.DB, userID int64, txType string, amount, balanceBefore, balanceAfter, orderID, settlementID int64, description string) error {
+	wallet, err := r.getOrCreateWalletTx(tx, userID, "general")
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.WalletTransaction{
+		TransactionNo:       generateTransactionNo(),
+		WalletID:            wallet.ID,
+		UserID:              userID,
+		Type:                txType,
+		Amount:              amount,
+		BalanceBefore:       balanceBefore,
+		BalanceAfter:        balanceAfter,
+		RelatedOrderID:      orderID,
+		RelatedSettlementID: settlementID,
+		Description:         description,
+	}).Error
 }
 
 func (r *SettlementRepo) getOrCreateWalletTx(tx *gorm.DB, userID int64, walletType string) (*model.UserWallet, error) {
@@ -292,6 +527,43 @@ func (r *SettlementRepo) ListUserWithdrawals(userID int64, page, pageSize int) (
 	return list, total, err
 }
 
+// TransitionWithdrawal 提现记录仍为 fromStatus 时更新字段，返回是否更新成功
+func (r *SettlementRepo) TransitionWithdrawal(id int64, fromStatus string, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.WithdrawalRecord{}).
+		Where("id = ? AND status = ?", id, fromStatus).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListPayoutsDue 查询出款中且到了提交/查询时间的提现
+func (r *SettlementRepo) ListPayoutsDue(now time.Time, limit int) ([]model.WithdrawalRecord, error) {
+	var list []model.WithdrawalRecord
+	err := r.db.Where("status = ?", "processing").
+		Where("next_payout_query_at IS NULL OR next_payout_query_at <= ?", now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListUnbatchedPayouts 查询指定提现方式下尚未导出批量文件的出款中提现
+func (r *SettlementRepo) ListUnbatchedPayouts(method string, limit int) ([]model.WithdrawalRecord, error) {
+	var list []model.WithdrawalRecord
+	err := r.db.Where("status = ? AND withdraw_method = ?", "processing", method).
+		Where("payout_batch_no = '' OR payout_batch_no IS NULL").
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListWithdrawalsByBatch 查询批次内的提现
+func (r *SettlementRepo) ListWithdrawalsByBatch(batchNo string) ([]model.WithdrawalRecord, error) {
+	var list []model.WithdrawalRecord
+	err := r.db.Where("payout_batch_no = ?", batchNo).Order("id ASC").Find(&list).Error
+	return list, err
+}
+
 func (r *SettlementRepo) ListPendingWithdrawals(page, pageSize int) ([]model.WithdrawalRecord, int64, error) {
 	var list []model.WithdrawalRecord
 	var total int64
@@ -301,6 +573,53 @@ func (r *SettlementRepo) ListPendingWithdrawals(page, pageSize int) ([]model.Wit
 	return list, total, err
 }
 
+// ========== PayoutBatch ==========
+
+// CreatePayoutBatch 创建代付批次，并将仍未入批的提现归入该批次，返回实际入批的提现
+func (r *SettlementRepo) CreatePayoutBatch(batch *model.PayoutBatch, withdrawals []model.WithdrawalRecord) ([]model.WithdrawalRecord, error) {
+	var batched []model.WithdrawalRecord
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, w := range withdrawals {
+			result := tx.Model(&model.WithdrawalRecord{}).
+				Where("id = ? AND status = ? AND (payout_batch_no = '' OR payout_batch_no IS NULL)", w.ID, "processing").
+				Update("payout_batch_no", batch.BatchNo)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				w.PayoutBatchNo = batch.BatchNo
+				batched = append(batched, w)
+				batch.TotalCount++
+				batch.TotalAmount += w.ActualAmount
+			}
+		}
+		if len(batched) == 0 {
+			return errors.New("没有待导出的提现")
+		}
+		return tx.Create(batch).Error
+	})
+	return batched, err
+}
+
+func (r *SettlementRepo) GetPayoutBatch(batchNo string) (*model.PayoutBatch, error) {
+	var batch model.PayoutBatch
+	err := r.db.Where("batch_no = ?", batchNo).First(&batch).Error
+	return &batch, err
+}
+
+func (r *SettlementRepo) UpdatePayoutBatch(batch *model.PayoutBatch) error {
+	return r.db.Save(batch).Error
+}
+
+func (r *SettlementRepo) ListPayoutBatches(page, pageSize int) ([]model.PayoutBatch, int64, error) {
+	var list []model.PayoutBatch
+	var total int64
+	query := r.db.Model(&model.PayoutBatch{})
+	query.Count(&total)
+	err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("created_at DESC").Find(&list).Error
+	return list, total, err
+}
+
 // ========== PricingConfig ==========
 
 func (r *SettlementRepo) GetPricingConfig(key string) (float64, error) {
@@ -330,6 +649,8 @@ func (r *SettlementRepo) UpdatePricingConfig(key string, value float64) error {
 
 // ========== Helpers ==========
 
+var walletTransactionSeq uint64
+
 func generateTransactionNo() string {
-	return fmt.Sprintf("TX%d%04d", time.Now().UnixNano()/1e6, time.Now().Nanosecond()%10000)
+	return fmt.Sprintf("TX%d%04d", time.Now().UnixNano()/1e6, atomic.AddUint64(&walletTransactionSeq, 1)%10000)
 }
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+// SurgeSignal 一条供需信号的位置，坐标缺失时只计入城市
+type SurgeSignal struct {
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+type SurgeRepo struct {
+	db *gorm.DB
+}
+
+func NewSurgeRepo(db *gorm.DB) *SurgeRepo {
+	return &SurgeRepo{db: db}
+}
+
+func (r *SurgeRepo) DB() *gorm.DB {
+	return r.db
+}
+
+// ListOpenDemandSignals 已发布、报价中且未过期的需求，按服务地址(无则起运地址)定位
+func (r *SurgeRepo) ListOpenDemandSignals(now time.Time) ([]SurgeSignal, error) {
+	var demands []model.Demand
+	err := r.db.Select("id", "service_address_snapshot", "departure_address_snapshot").
+		Where("status IN ?", []string{"published", "quoting"}).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Find(&demands).Error
+	if err != nil {
+		return nil, err
+	}
+	signals := make([]SurgeSignal, 0, len(demands))
+	for i := range demands {
+		for _, raw := range []model.JSON{demands[i].ServiceAddressSnapshot, demands[i].DepartureAddressSnapshot} {
+			if signal, ok := addressSnapshotSignal(raw); ok {
+				signals = append(signals, signal)
+				break
+			}
+		}
+	}
+	return signals, nil
+}
+
+// ListPendingTaskSignals 派单池中待匹配的任务，按取货点定位
+func (r *SurgeRepo) ListPendingTaskSignals() ([]SurgeSignal, error) {
+	var tasks []model.DispatchTask
+	err := r.db.Select("id", "pickup_latitude", "pickup_longitude").
+		Where("status IN ?", []string{"pending", "matching", "dispatching"}).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	signals := make([]SurgeSignal, 0, len(tasks))
+	for _, task := range tasks {
+		if task.PickupLatitude == 0 && task.PickupLongitude == 0 {
+			continue
+		}
+		signals = append(signals, SurgeSignal{Latitude: task.PickupLatitude, Longitude: task.PickupLongitude})
+	}
+	return signals, nil
+}
+
+// ListOnlinePilotSignals 在线接单的飞手，按最近上报位置定位
+func (r *SurgeRepo) ListOnlinePilotSignals() ([]SurgeSignal, error) {
+	var pilots []model.Pilot
+	err := r.db.Select("id", "current_latitude", "current_longitude", "current_city").
+		Where("availability_status = ? AND verification_status = ?", "online", "verified").
+		Find(&pilots).Error
+	if err != nil {
+		return nil, err
+	}
+	signals := make([]SurgeSignal, 0, len(pilots))
+	for _, pilot := range pilots {
+		signals = append(signals, SurgeSignal{City: strings.TrimSpace(pilot.CurrentCity), Latitude: pilot.CurrentLatitude, Longitude: pilot.CurrentLongitude})
+	}
+	return signals, nil
+}
+
+// ListAvailableDroneSignals 空闲可用的无人机
+func (r *SurgeRepo) ListAvailableDroneSignals() ([]SurgeSignal, error) {
+	var drones []model.Drone
+	err := r.db.Select("id", "latitude", "longitude", "city").
+		Where("availability_status = ?", "available").
+		Find(&drones).Error
+	if err != nil {
+		return nil, err
+	}
+	signals := make([]SurgeSignal, 0, len(drones))
+	for _, drone := range drones {
+		signals = append(signals, SurgeSignal{City: strings.TrimSpace(drone.City), Latitude: drone.Latitude, Longitude: drone.Longitude})
+	}
+	return signals, nil
+}
+
+func addressSnapshotSignal(raw model.JSON) (SurgeSignal, bool) {
+	if len(raw) == 0 {
+		return SurgeSignal{}, false
+	}
+	var payload struct {
+		City      string   `json:"city"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return SurgeSignal{}, false
+	}
+	signal := SurgeSignal{City: strings.TrimSpace(payload.City)}
+	if payload.Latitude != nil && payload.Longitude != nil {
+		signal.Latitude, signal.Longitude = *payload.Latitude, *payload.Longitude
+	}
+	return signal, signal.City != "" || signal.Latitude != 0 || signal.Longitude != 0
+}
+
+// ========== 倍率 ==========
+
+func (r *SurgeRepo) GetMultiplier(scopeType, scopeKey string) (*model.SurgeMultiplier, error) {
+	var multiplier model.SurgeMultiplier
+	if err := r.db.Where("scope_type = ? AND scope_key = ?", scopeType, scopeKey).First(&multiplier).Error; err != nil {
+		return nil, err
+	}
+	return &multiplier, nil
+}
+
+// ListAllMultipliers 全部倍率记录，刷新时用于让无信号区域回落
+func (r *SurgeRepo) ListAllMultipliers() ([]model.SurgeMultiplier, error) {
+	var multipliers []model.SurgeMultiplier
+	err := r.db.Order("id ASC").Find(&multipliers).Error
+	return multipliers, err
+}
+
+func (r *SurgeRepo) ListMultipliers(scopeType, city string, page, pageSize int) ([]model.SurgeMultiplier, int64, error) {
+	var multipliers []model.SurgeMultiplier
+	var total int64
+
+	query := r.db.Model(&model.SurgeMultiplier{})
+	if scopeType != "" {
+		query = query.Where("scope_type = ?", scopeType)
+	}
+	if city != "" {
+		query = query.Where("city = ?", city)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := query.Order("multiplier DESC, id ASC").Offset(offset).Limit(pageSize).Find(&multipliers).Error; err != nil {
+		return nil, 0, err
+	}
+	return multipliers, total, nil
+}
+
+func (r *SurgeRepo) SaveMultiplier(multiplier *model.SurgeMultiplier) error {
+	return r.db.Save(multiplier).Error
+}
+
+func (r *SurgeRepo) CreateLog(log *model.SurgeMultiplierLog) error {
+	return r.db.Create(log).Error
+}
+
+func (r *SurgeRepo) ListLogs(scopeType, scopeKey string, page, pageSize int) ([]model.SurgeMultiplierLog, int64, error) {
+	var logs []model.SurgeMultiplierLog
+	var total int64
+
+	query := r.db.Model(&model.SurgeMultiplierLog{})
+	if scopeType != "" {
+		query = query.Where("scope_type = ?", scopeType)
+	}
+	if scopeKey != "" {
+		query = query.Where("scope_key = ?", scopeKey)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
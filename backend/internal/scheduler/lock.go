@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Locker 跨实例互斥锁，保证同一任务同一时刻只在一个副本上执行
+type Locker interface {
+	// TryLock 尝试获取锁，成功时返回释放函数
+	TryLock(ctx context.Context, key string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// ==================== Redis 实现 ====================
+
+// 仅当锁仍属于自己时才删除，避免误删其他副本在锁过期后获取的新锁
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker 基于 SET NX PX 的分布式锁
+type RedisLocker struct {
+	rds    *redis.Client
+	prefix string
+}
+
+func NewRedisLocker(rds *redis.Client) *RedisLocker {
+	return &RedisLocker{rds: rds, prefix: "scheduler:lock:"}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	fullKey := l.prefix + key
+	token := uuid.New().String()
+	ok, err := l.rds.SetNX(ctx, fullKey, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	release := func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		releaseScript.Run(releaseCtx, l.rds, []string{fullKey}, token)
+	}
+	return release, true, nil
+}
+
+// ==================== 进程内实现 ====================
+
+// LocalLocker 单实例部署或测试使用的进程内锁
+type LocalLocker struct {
+	mu    sync.Mutex
+	seq   uint64
+	locks map[string]localLock
+}
+
+type localLock struct {
+	token    uint64
+	expireAt time.Time
+}
+
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{locks: make(map[string]localLock)}
+}
+
+func (l *LocalLocker) TryLock(_ context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if held, ok := l.locks[key]; ok && now.Before(held.expireAt) {
+		return nil, false, nil
+	}
+	l.seq++
+	token := l.seq
+	l.locks[key] = localLock{token: token, expireAt: now.Add(ttl)}
+	return func() {
+		l.mu.Lock()
+		if held, ok := l.locks[key]; ok && held.token == token {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}, true, nil
+}
@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 计算任务的下一次触发时间
+type Schedule interface {
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// ParseSchedule 解析调度表达式
+// 支持 "@every 30s" 形式的固定间隔，以及 "分 时 日 月 周" 五段式 cron 表达式。
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", spec, err)
+		}
+		return Every(d)
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	return ParseCron(spec)
+}
+
+// ==================== 固定间隔 ====================
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Every 创建固定间隔调度
+func Every(d time.Duration) (Schedule, error) {
+	if d < time.Second {
+		return nil, fmt.Errorf("interval must be at least 1s, got %s", d)
+	}
+	return intervalSchedule{interval: d}, nil
+}
+
+// Next 按间隔对齐到整点刻度，使各副本计算出相同的触发时间
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Truncate(s.interval).Add(s.interval)
+}
+
+func (s intervalSchedule) String() string {
+	return "@every " + s.interval.String()
+}
+
+// ==================== Cron ====================
+
+type cronSchedule struct {
+	spec   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// 日和周同时受限时按标准 cron 语义取并集
+	domRestricted bool
+	dowRestricted bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day-of-month", 1, 31},
+	{"month", 1, 12},
+	{"day-of-week", 0, 6},
+}
+
+// ParseCron 解析五段式 cron 表达式，支持 *、列表、范围和步长
+func ParseCron(spec string) (Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", spec)
+	}
+
+	bits := make([]uint64, len(parts))
+	for i, part := range parts {
+		field := cronFields[i]
+		max := field.max
+		if i == 4 {
+			// 允许用 7 表示周日
+			max = 7
+		}
+		b, err := parseCronField(part, field.min, max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %s field %q: %w", field.name, part, err)
+		}
+		if i == 4 && b&(1<<7) != 0 {
+			b = (b | 1) &^ (1 << 7)
+		}
+		bits[i] = b
+	}
+
+	return &cronSchedule{
+		spec:          spec,
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: parts[2] != "*",
+		dowRestricted: parts[4] != "*",
+	}, nil
+}
+
+func parseCronField(expr string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(expr, ",") {
+		step := 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			s, err := strconv.Atoi(item[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q", item[idx+1:])
+			}
+			step = s
+			item = item[:idx]
+		}
+
+		lo, hi := min, max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			a, err1 := strconv.Atoi(bounds[0])
+			b, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", item)
+			}
+			lo, hi = a, b
+		default:
+			v, err := strconv.Atoi(item)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", item)
+			}
+			lo = v
+			hi = v
+			if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range [%d,%d]", min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// 最多向后搜索 5 年，防止不可满足的表达式（如 2 月 30 日）死循环
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func (s *cronSchedule) String() string {
+	return s.spec
+}
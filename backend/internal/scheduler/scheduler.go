@@ -0,0 +1,300 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+)
+
+const defaultJobTimeout = 5 * time.Minute
+
+var (
+	ErrJobNotFound = errors.New("定时任务不存在")
+	ErrJobRunning  = errors.New("定时任务正在其他实例执行")
+)
+
+// JobFunc 任务执行函数，返回本次处理的条目数
+type JobFunc func(ctx context.Context) (int, error)
+
+// Job 定时任务定义
+type Job struct {
+	Name        string
+	Description string
+	Schedule    Schedule
+	Timeout     time.Duration
+	Run         JobFunc
+}
+
+// RunStore 执行记录存储
+type RunStore interface {
+	CreateRun(run *model.JobRun) error
+	UpdateRun(run *model.JobRun) error
+	GetLatestRun(jobName string) (*model.JobRun, error)
+}
+
+// JobInfo 任务运行概况（管理后台展示）
+type JobInfo struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Schedule    string        `json:"schedule"`
+	TimeoutSec  int           `json:"timeout_seconds"`
+	NextRunAt   *time.Time    `json:"next_run_at"`
+	Running     bool          `json:"running"`
+	LastRun     *model.JobRun `json:"last_run"`
+}
+
+type jobEntry struct {
+	job     Job
+	nextRun time.Time
+	running bool
+}
+
+// Scheduler 进程内定时任务调度器
+// 每个任务独立一个 goroutine 等待触发；多副本部署时通过 Locker 保证同一触发点只执行一次。
+type Scheduler struct {
+	mu       sync.RWMutex
+	entries  map[string]*jobEntry
+	locker   Locker
+	store    RunStore
+	logger   *zap.Logger
+	instance string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(locker Locker, store RunStore, logger *zap.Logger) *Scheduler {
+	if locker == nil {
+		locker = NewLocalLocker()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		entries:  make(map[string]*jobEntry),
+		locker:   locker,
+		store:    store,
+		logger:   logger,
+		instance: hostname + ":" + strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Register 注册任务，需在 Start 之前调用
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil || job.Schedule == nil {
+		return fmt.Errorf("invalid job definition: %q", job.Name)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[job.Name]; exists {
+		return fmt.Errorf("job %q already registered", job.Name)
+	}
+	s.entries[job.Name] = &jobEntry{job: job}
+	return nil
+}
+
+// Start 启动所有任务的调度循环
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, entry := range s.entries {
+		s.wg.Add(1)
+		go s.loop(ctx, entry)
+	}
+	s.logger.Info("scheduler started", zap.Int("jobs", len(s.entries)), zap.String("instance", s.instance))
+}
+
+// Stop 停止调度并等待正在执行的任务结束
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// RunNow 立即执行指定任务（管理员手动触发）
+func (s *Scheduler) RunNow(ctx context.Context, name string, triggeredBy int64) (*model.JobRun, error) {
+	s.mu.RLock()
+	entry, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	run, executed := s.execute(ctx, entry, "manual", triggeredBy, "")
+	if !executed {
+		return nil, ErrJobRunning
+	}
+	return run, nil
+}
+
+// Jobs 返回已注册任务的概况
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.RLock()
+	infos := make([]JobInfo, 0, len(s.entries))
+	for _, entry := range s.entries {
+		info := JobInfo{
+			Name:        entry.job.Name,
+			Description: entry.job.Description,
+			Schedule:    entry.job.Schedule.String(),
+			TimeoutSec:  int(entry.job.Timeout / time.Second),
+			Running:     entry.running,
+		}
+		if !entry.nextRun.IsZero() {
+			next := entry.nextRun
+			info.NextRunAt = &next
+		}
+		infos = append(infos, info)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	if s.store != nil {
+		for i := range infos {
+			if run, err := s.store.GetLatestRun(infos[i].Name); err == nil {
+				infos[i].LastRun = run
+			}
+		}
+	}
+	return infos
+}
+
+// JobNames 返回已注册的任务名称
+func (s *Scheduler) JobNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Scheduler) loop(ctx context.Context, entry *jobEntry) {
+	defer s.wg.Done()
+	for {
+		next := entry.job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warn("job schedule has no next run", zap.String("job", entry.job.Name))
+			return
+		}
+		s.mu.Lock()
+		entry.nextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.execute(ctx, entry, "schedule", 0, strconv.FormatInt(next.Unix(), 10))
+	}
+}
+
+// execute 获取锁并执行一次任务；未获取到锁时返回 false
+// tick 非空时额外占用「任务+触发点」锁且不主动释放，防止各副本时钟偏差导致同一触发点重复执行
+func (s *Scheduler) execute(ctx context.Context, entry *jobEntry, triggerType string, triggeredBy int64, tick string) (*model.JobRun, bool) {
+	job := entry.job
+	if tick != "" {
+		tickTTL := job.Timeout
+		if tickTTL < time.Minute {
+			tickTTL = time.Minute
+		}
+		if _, ok, err := s.locker.TryLock(ctx, job.Name+"@"+tick, tickTTL); err != nil || !ok {
+			if err != nil {
+				s.logger.Warn("acquire job tick lock failed", zap.String("job", job.Name), zap.Error(err))
+			}
+			return nil, false
+		}
+	}
+
+	release, ok, err := s.locker.TryLock(ctx, job.Name, job.Timeout)
+	if err != nil {
+		s.logger.Warn("acquire job lock failed", zap.String("job", job.Name), zap.Error(err))
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	defer release()
+
+	s.mu.Lock()
+	entry.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		entry.running = false
+		s.mu.Unlock()
+	}()
+
+	run := &model.JobRun{
+		JobName:     job.Name,
+		TriggerType: triggerType,
+		TriggeredBy: triggeredBy,
+		Instance:    s.instance,
+		Status:      "running",
+		StartedAt:   time.Now(),
+	}
+	s.saveRun(run, true)
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	items, runErr := s.invoke(runCtx, job)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.DurationMs = finishedAt.Sub(run.StartedAt).Milliseconds()
+	run.ItemsProcessed = items
+	if runErr != nil {
+		run.Status = "failed"
+		run.ErrorMessage = runErr.Error()
+		s.logger.Warn("scheduled job failed", zap.String("job", job.Name), zap.Error(runErr))
+	} else {
+		run.Status = "succeeded"
+	}
+	s.saveRun(run, false)
+	return run, true
+}
+
+func (s *Scheduler) invoke(ctx context.Context, job Job) (items int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (s *Scheduler) saveRun(run *model.JobRun, create bool) {
+	if s.store == nil {
+		return
+	}
+	var err error
+	if create {
+		err = s.store.CreateRun(run)
+	} else {
+		err = s.store.UpdateRun(run)
+	}
+	if err != nil {
+		s.logger.Warn("save job run failed", zap.String("job", run.JobName), zap.Error(err))
+	}
+}
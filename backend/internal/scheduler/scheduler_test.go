@@ -0,0 +1,186 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"wurenji-backend/internal/model"
+)
+
+func TestParseCronNextRun(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	cases := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"10 0 * * *", time.Date(2026, 3, 1, 8, 0, 0, 0, loc), time.Date(2026, 3, 2, 0, 10, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 3, 1, 8, 7, 30, 0, loc), time.Date(2026, 3, 1, 8, 15, 0, 0, loc)},
+		{"15 1-3 * * *", time.Date(2026, 3, 1, 3, 15, 0, 0, loc), time.Date(2026, 3, 2, 1, 15, 0, 0, loc)},
+		{"0 9 * * 1", time.Date(2026, 3, 1, 0, 0, 0, 0, loc), time.Date(2026, 3, 2, 9, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2026, 1, 31, 12, 0, 0, 0, loc), time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+		{"0 12 * * 7", time.Date(2026, 3, 2, 0, 0, 0, 0, loc), time.Date(2026, 3, 8, 12, 0, 0, 0, loc)},
+	}
+
+	for _, tc := range cases {
+		schedule, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.spec, err)
+		}
+		if got := schedule.Next(tc.after); !got.Equal(tc.want) {
+			t.Fatalf("%q after %v: expected %v, got %v", tc.spec, tc.after, tc.want, got)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "* * *", "60 * * * *", "@every 10ms", "@every nope", "5-1 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestIntervalScheduleAlignsToTicks(t *testing.T) {
+	schedule, err := ParseSchedule("@every 30s")
+	if err != nil {
+		t.Fatalf("parse interval: %v", err)
+	}
+	after := time.Date(2026, 3, 1, 8, 0, 12, 0, time.UTC)
+	want := time.Date(2026, 3, 1, 8, 0, 30, 0, time.UTC)
+	if got := schedule.Next(after); !got.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+type memoryRunStore struct {
+	mu   sync.Mutex
+	runs []model.JobRun
+}
+
+func (m *memoryRunStore) CreateRun(run *model.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run.ID = int64(len(m.runs) + 1)
+	m.runs = append(m.runs, *run)
+	return nil
+}
+
+func (m *memoryRunStore) UpdateRun(run *model.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[run.ID-1] = *run
+	return nil
+}
+
+func (m *memoryRunStore) GetLatestRun(jobName string) (*model.JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.runs) - 1; i >= 0; i-- {
+		if m.runs[i].JobName == jobName {
+			run := m.runs[i]
+			return &run, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func TestRunNowRecordsHistory(t *testing.T) {
+	store := &memoryRunStore{}
+	s := New(NewLocalLocker(), store, nil)
+	schedule, _ := Every(time.Hour)
+
+	if err := s.Register(Job{Name: "ok", Schedule: schedule, Run: func(context.Context) (int, error) { return 7, nil }}); err != nil {
+		t.Fatalf("register ok job: %v", err)
+	}
+	if err := s.Register(Job{Name: "boom", Schedule: schedule, Run: func(context.Context) (int, error) { panic("exploded") }}); err != nil {
+		t.Fatalf("register panicking job: %v", err)
+	}
+
+	run, err := s.RunNow(context.Background(), "ok", 9)
+	if err != nil {
+		t.Fatalf("run ok job: %v", err)
+	}
+	if run.Status != "succeeded" || run.ItemsProcessed != 7 || run.TriggerType != "manual" || run.TriggeredBy != 9 || run.FinishedAt == nil {
+		t.Fatalf("unexpected run record: %#v", run)
+	}
+
+	run, err = s.RunNow(context.Background(), "boom", 0)
+	if err != nil {
+		t.Fatalf("run panicking job: %v", err)
+	}
+	if run.Status != "failed" || run.ErrorMessage == "" {
+		t.Fatalf("expected recovered panic recorded as failure, got %#v", run)
+	}
+
+	if _, err := s.RunNow(context.Background(), "missing", 0); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+
+	jobs := s.Jobs()
+	if len(jobs) != 2 || jobs[1].Name != "ok" || jobs[1].LastRun == nil || jobs[1].LastRun.ItemsProcessed != 7 {
+		t.Fatalf("unexpected job listing: %#v", jobs)
+	}
+}
+
+func TestRunNowSkipsWhenLockHeld(t *testing.T) {
+	locker := NewLocalLocker()
+	s := New(locker, nil, nil)
+	schedule, _ := Every(time.Hour)
+	called := false
+	s.Register(Job{Name: "locked", Schedule: schedule, Run: func(context.Context) (int, error) {
+		called = true
+		return 0, nil
+	}})
+
+	release, ok, _ := locker.TryLock(context.Background(), "locked", time.Minute)
+	if !ok {
+		t.Fatal("expected to acquire lock")
+	}
+	if _, err := s.RunNow(context.Background(), "locked", 0); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("expected ErrJobRunning, got %v", err)
+	}
+	if called {
+		t.Fatal("job must not run while another instance holds the lock")
+	}
+
+	release()
+	if _, err := s.RunNow(context.Background(), "locked", 0); err != nil {
+		t.Fatalf("expected run after release, got %v", err)
+	}
+	if !called {
+		t.Fatal("expected job to run after lock release")
+	}
+}
+
+func TestScheduledTickRunsOnceAcrossInstances(t *testing.T) {
+	locker := NewLocalLocker()
+	var mu sync.Mutex
+	count := 0
+	job := func(context.Context) (int, error) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		return 1, nil
+	}
+	schedule, _ := Every(time.Hour)
+
+	a := New(locker, nil, nil)
+	b := New(locker, nil, nil)
+	a.Register(Job{Name: "tick", Schedule: schedule, Run: job})
+	b.Register(Job{Name: "tick", Schedule: schedule, Run: job})
+
+	a.execute(context.Background(), a.entries["tick"], "schedule", 0, "1700000000")
+	b.execute(context.Background(), b.entries["tick"], "schedule", 0, "1700000000")
+	if count != 1 {
+		t.Fatalf("expected tick to run once, ran %d times", count)
+	}
+
+	b.execute(context.Background(), b.entries["tick"], "schedule", 0, "1700003600")
+	if count != 2 {
+		t.Fatalf("expected next tick to run, count=%d", count)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+)
+
+// geofenceZone 将围栏定义转换为几何空域
+func geofenceZone(fence *model.Geofence) (geo.Zone, error) {
+	shape, err := buildShape(fence.GeometryType, fence.CenterLatitude, fence.CenterLongitude, fence.Radius, fence.Coordinates)
+	if err != nil {
+		return geo.Zone{}, err
+	}
+	return geo.Zone{Shape: shape, Band: geo.AltitudeBand{Min: fence.MinAltitude, Max: fence.MaxAltitude}}, nil
+}
+
+// noFlyZoneGeometry 将禁飞区定义转换为几何空域(MaxAltitude=0 表示全高度)
+func noFlyZoneGeometry(zone *model.NoFlyZone) (geo.Zone, error) {
+	shape, err := buildShape(zone.GeometryType, zone.CenterLatitude, zone.CenterLongitude, zone.Radius, zone.Coordinates)
+	if err != nil {
+		return geo.Zone{}, err
+	}
+	return geo.Zone{Shape: shape, Band: geo.AltitudeBand{Min: zone.MinAltitude, Max: zone.MaxAltitude}}, nil
+}
+
+// ValidateGeofenceGeometry 校验围栏几何定义是否可用
+func ValidateGeofenceGeometry(fence *model.Geofence) error {
+	_, err := geofenceZone(fence)
+	return err
+}
+
+// ValidateNoFlyZoneGeometry 校验禁飞区几何定义是否可用
+func ValidateNoFlyZoneGeometry(zone *model.NoFlyZone) error {
+	_, err := noFlyZoneGeometry(zone)
+	return err
+}
+
+func buildShape(geometryType string, centerLat, centerLng *float64, radius *int, coordinates model.JSON) (geo.Shape, error) {
+	switch geometryType {
+	case "circle":
+		if centerLat == nil || centerLng == nil || radius == nil || *radius <= 0 {
+			return nil, fmt.Errorf("圆形区域缺少中心点或半径")
+		}
+		return geo.Circle{Center: geo.Point{Lat: *centerLat, Lng: *centerLng}, Radius: float64(*radius)}, nil
+	case "polygon":
+		if len(coordinates) == 0 || string(coordinates) == "null" {
+			return nil, fmt.Errorf("多边形区域缺少顶点坐标")
+		}
+		polygon, err := geo.ParsePolygon(coordinates)
+		if err != nil {
+			return nil, fmt.Errorf("多边形坐标无效: %w", err)
+		}
+		return polygon, nil
+	default:
+		return nil, fmt.Errorf("不支持的区域类型: %s", geometryType)
+	}
+}
+
+// geofenceTimeWindow 围栏生效时段，TimeRestrictions 格式:
+//
+//	[{"weekdays":[1,2,3,4,5],"start":"07:00","end":"19:00"}]
+//
+// weekdays 取 1-7 表示周一至周日，缺省为每天；end 早于 start 表示跨零点
+type geofenceTimeWindow struct {
+	Weekdays []int  `json:"weekdays"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// timeRestrictionsOverlap 判断 [from, to] 是否落入围栏生效时段
+// 未配置或无法解析的时段限制按全天生效处理，宁可多报不可漏报
+func timeRestrictionsOverlap(raw model.JSON, from, to time.Time) bool {
+	if len(raw) == 0 || string(raw) == "null" {
+		return true
+	}
+	var windows []geofenceTimeWindow
+	if err := json.Unmarshal(raw, &windows); err != nil || len(windows) == 0 {
+		return true
+	}
+	// 时段按周循环，超过一周的窗口必然覆盖
+	if to.Sub(from) >= 7*24*time.Hour {
+		return true
+	}
+
+	loc := from.Location()
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+	for !day.After(to) {
+		weekday := int(day.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		for _, w := range windows {
+			if len(w.Weekdays) > 0 && !containsInt(w.Weekdays, weekday) {
+				continue
+			}
+			start := day.Add(clockOffset(w.Start, 0))
+			end := day.Add(clockOffset(w.End, 24*time.Hour))
+			if !end.After(start) {
+				end = end.Add(24 * time.Hour)
+			}
+			if !start.After(to) && end.After(from) {
+				return true
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return false
+}
+
+// clockOffset 将 "HH:MM" 转换为距零点的时长
+func clockOffset(clock string, fallback time.Duration) time.Duration {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return fallback
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
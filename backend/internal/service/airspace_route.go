@@ -0,0 +1,295 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+)
+
+const (
+	defaultRouteCheckAltitude = 120
+	defaultRouteCheckWindow   = time.Hour
+	defaultDetourMargin       = 100
+)
+
+// RouteCheckRequest 航线空域冲突检查请求
+// 航线来源三选一: points(折线) / order_id(订单起终点及多点任务站点) / route_id(保存路线)
+type RouteCheckRequest struct {
+	Points       []geo.Point `json:"points"`
+	OrderID      int64       `json:"order_id"`
+	RouteID      int64       `json:"route_id"`
+	Altitude     int         `json:"altitude"` // 巡航高度(米)，缺省取路线推荐高度或120
+	StartTime    *time.Time  `json:"start_time"`
+	EndTime      *time.Time  `json:"end_time"`
+	DetourMargin int         `json:"detour_margin"` // 绕飞时与禁飞区保持的间距(米)
+	UserID       int64       `json:"-"`             // 发起检查的用户，只能引用自己参与的订单或可见的路线
+}
+
+// RouteConflict 航线穿越的禁飞区/围栏
+type RouteConflict struct {
+	SourceType        string     `json:"source_type"` // no_fly_zone, geofence
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"`
+	ZoneType          string     `json:"zone_type"`         // 禁飞区类型或围栏类型
+	RestrictionLevel  string     `json:"restriction_level"` // no_fly, restricted, caution, alert, custom
+	AllowedWithPermit bool       `json:"allowed_with_permit"`
+	Blocking          bool       `json:"blocking"`
+	SegmentIndexes    []int      `json:"segment_indexes"` // 穿越的航段序号(第 i 段为第 i 个航点到第 i+1 个航点)
+	MinAltitude       int        `json:"min_altitude"`
+	MaxAltitude       int        `json:"max_altitude"`
+	EffectiveFrom     *time.Time `json:"effective_from"`
+	EffectiveTo       *time.Time `json:"effective_to"`
+}
+
+// RouteDetour 绕飞建议
+type RouteDetour struct {
+	Route          []geo.Point `json:"route"`
+	DistanceM      float64     `json:"distance_m"`
+	ExtraDistanceM float64     `json:"extra_distance_m"`
+}
+
+// RouteCheckResult 航线空域冲突检查结果
+type RouteCheckResult struct {
+	Available    bool            `json:"available"`
+	Altitude     int             `json:"altitude"`
+	StartTime    time.Time       `json:"start_time"`
+	EndTime      time.Time       `json:"end_time"`
+	Route        []geo.Point     `json:"route"`
+	DistanceM    float64         `json:"distance_m"`
+	Conflicts    []RouteConflict `json:"conflicts"`
+	Detour       *RouteDetour    `json:"detour,omitempty"`
+	DetourReason string          `json:"detour_reason,omitempty"`
+}
+
+// CheckRouteConflicts 检查航线在巡航高度与时间窗口内穿越的禁飞区和围栏，并在被禁飞区阻断时给出绕飞建议
+func (s *AirspaceService) CheckRouteConflicts(req *RouteCheckRequest) (*RouteCheckResult, error) {
+	path, altitude, from, to, err := s.resolveRoute(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RouteCheckResult{
+		Available: true,
+		Altitude:  altitude,
+		StartTime: from,
+		EndTime:   to,
+		Route:     path,
+		DistanceM: geo.PathLength(path),
+		Conflicts: []RouteConflict{},
+	}
+	var obstacles []geo.Shape
+
+	zones, err := s.airspaceRepo.ListNoFlyZonesInWindow(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range zones {
+		z := &zones[i]
+		zone, err := noFlyZoneGeometry(z)
+		if err != nil {
+			s.logger.Warn("禁飞区几何定义无效，已跳过", zap.Int64("zone_id", z.ID), zap.Error(err))
+			continue
+		}
+		segments := intersectedSegments(zone, path, altitude)
+		if len(segments) == 0 {
+			continue
+		}
+		blocking := z.RestrictionLevel == "no_fly"
+		result.Conflicts = append(result.Conflicts, RouteConflict{
+			SourceType:        "no_fly_zone",
+			ID:                z.ID,
+			Name:              z.Name,
+			ZoneType:          z.ZoneType,
+			RestrictionLevel:  z.RestrictionLevel,
+			AllowedWithPermit: z.AllowedWithPermit,
+			Blocking:          blocking,
+			SegmentIndexes:    segments,
+			MinAltitude:       z.MinAltitude,
+			MaxAltitude:       z.MaxAltitude,
+			EffectiveFrom:     z.EffectiveFrom,
+			EffectiveTo:       z.EffectiveTo,
+		})
+		if blocking {
+			obstacles = append(obstacles, zone.Shape)
+		}
+	}
+
+	fences, err := s.flightRepo.GetGeofencesInWindow(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range fences {
+		f := &fences[i]
+		if !timeRestrictionsOverlap(f.TimeRestrictions, from, to) {
+			continue
+		}
+		zone, err := geofenceZone(f)
+		if err != nil {
+			s.logger.Warn("围栏几何定义无效，已跳过", zap.Int64("geofence_id", f.ID), zap.Error(err))
+			continue
+		}
+		segments := intersectedSegments(zone, path, altitude)
+		if len(segments) == 0 {
+			continue
+		}
+		blocking := f.FenceType == "no_fly"
+		result.Conflicts = append(result.Conflicts, RouteConflict{
+			SourceType:       "geofence",
+			ID:               f.ID,
+			Name:             f.Name,
+			ZoneType:         f.FenceType,
+			RestrictionLevel: f.FenceType,
+			Blocking:         blocking,
+			SegmentIndexes:   segments,
+			MinAltitude:      f.MinAltitude,
+			MaxAltitude:      f.MaxAltitude,
+			EffectiveFrom:    f.EffectiveFrom,
+			EffectiveTo:      f.EffectiveTo,
+		})
+		if blocking {
+			obstacles = append(obstacles, zone.Shape)
+		}
+	}
+
+	if len(obstacles) == 0 {
+		return result, nil
+	}
+	result.Available = false
+
+	margin := req.DetourMargin
+	if margin <= 0 {
+		margin = defaultDetourMargin
+	}
+	detour, ok := geo.Detour(path, obstacles, float64(margin))
+	if !ok {
+		result.DetourReason = "航点位于禁飞区内或无可行绕飞路径，请调整起降点或飞行时间"
+		return result, nil
+	}
+	distance := geo.PathLength(detour)
+	result.Detour = &RouteDetour{
+		Route:          detour,
+		DistanceM:      distance,
+		ExtraDistanceM: distance - result.DistanceM,
+	}
+	return result, nil
+}
+
+// intersectedSegments 返回与空域相交的航段序号；巡航高度不在空域高度区间内时视为不相交
+func intersectedSegments(zone geo.Zone, path []geo.Point, altitude int) []int {
+	if !zone.Band.Contains(altitude) {
+		return nil
+	}
+	if len(path) == 1 {
+		if zone.Shape.Contains(path[0]) {
+			return []int{0}
+		}
+		return nil
+	}
+	var segments []int
+	for i := 1; i < len(path); i++ {
+		if zone.Shape.IntersectsSegment(path[i-1], path[i]) {
+			segments = append(segments, i-1)
+		}
+	}
+	return segments
+}
+
+// resolveRoute 解析检查请求中的航线、巡航高度与时间窗口
+func (s *AirspaceService) resolveRoute(req *RouteCheckRequest) ([]geo.Point, int, time.Time, time.Time, error) {
+	var (
+		path     []geo.Point
+		altitude = req.Altitude
+		from     time.Time
+		to       time.Time
+	)
+
+	switch {
+	case len(req.Points) > 0:
+		path = req.Points
+	case req.RouteID > 0:
+		route, err := s.flightRepo.GetSavedRouteByID(req.RouteID)
+		if err != nil || !routeVisibleTo(route, req.UserID) {
+			return nil, 0, from, to, errors.New("路线不存在")
+		}
+		path, err = geo.ParsePath(route.Waypoints)
+		if err != nil || len(path) < 2 {
+			path = []geo.Point{
+				{Lat: route.StartLatitude, Lng: route.StartLongitude},
+				{Lat: route.EndLatitude, Lng: route.EndLongitude},
+			}
+		}
+		if altitude <= 0 {
+			altitude = route.RecommendedAltitude
+		}
+	case req.OrderID > 0:
+		order, err := s.orderRepo.GetByID(req.OrderID)
+		if err != nil || !isRouteCheckOrderParty(order, req.UserID) {
+			return nil, 0, from, to, errors.New("订单不存在")
+		}
+		path = s.orderRoute(order)
+		from, to = order.StartTime, order.EndTime
+	default:
+		return nil, 0, from, to, errors.New("请提供航线坐标、订单ID或路线ID")
+	}
+
+	for i, p := range path {
+		if p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+			return nil, 0, from, to, fmt.Errorf("第%d个航点坐标无效", i+1)
+		}
+	}
+
+	if altitude <= 0 {
+		altitude = defaultRouteCheckAltitude
+	}
+	if req.StartTime != nil {
+		from = *req.StartTime
+	}
+	if req.EndTime != nil {
+		to = *req.EndTime
+	}
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if to.IsZero() || to.Before(from) {
+		to = from.Add(defaultRouteCheckWindow)
+	}
+	return path, altitude, from, to, nil
+}
+
+// orderRoute 订单航线: 服务地点 -> 多点任务各站点 -> 目的地
+func (s *AirspaceService) orderRoute(order *model.Order) []geo.Point {
+	path := []geo.Point{{Lat: order.ServiceLatitude, Lng: order.ServiceLongitude}}
+	if task, err := s.flightRepo.GetMultiPointTaskByOrderID(order.ID); err == nil {
+		if stops, err := s.flightRepo.GetTaskStops(task.ID); err == nil {
+			for _, stop := range stops {
+				path = append(path, geo.Point{Lat: stop.Latitude, Lng: stop.Longitude})
+			}
+		}
+	}
+	if order.DestLatitude != nil && order.DestLongitude != nil {
+		path = append(path, geo.Point{Lat: *order.DestLatitude, Lng: *order.DestLongitude})
+	}
+	return path
+}
+
+// routeVisibleTo 保存路线仅创建者或共享/公开时可被引用
+func routeVisibleTo(route *model.SavedRoute, userID int64) bool {
+	return route.OwnerID == userID || route.Visibility == "shared" || route.Visibility == "public"
+}
+
+// isRouteCheckOrderParty 用户是否为订单的下单方、服务方或执行飞手
+func isRouteCheckOrderParty(order *model.Order, userID int64) bool {
+	if userID == 0 {
+		return false
+	}
+	switch userID {
+	case order.ClientUserID, order.RenterID, order.ProviderUserID, order.OwnerID, order.DroneOwnerUserID, order.ExecutorPilotUserID:
+		return true
+	}
+	return false
+}
@@ -6,6 +6,8 @@ import (
 
 	"go.uber.org/zap"
 	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+	"wurenji-backend/internal/pkg/uom"
 	"wurenji-backend/internal/repository"
 )
 
@@ -14,6 +16,8 @@ type AirspaceService struct {
 	pilotRepo    *repository.PilotRepo
 	droneRepo    *repository.DroneRepo
 	orderRepo    *repository.OrderRepo
+	flightRepo   *repository.FlightRepo
+	uomGateway   uom.UOMGateway
 	logger       *zap.Logger
 }
 
@@ -22,6 +26,7 @@ func NewAirspaceService(
 	pilotRepo *repository.PilotRepo,
 	droneRepo *repository.DroneRepo,
 	orderRepo *repository.OrderRepo,
+	flightRepo *repository.FlightRepo,
 	logger *zap.Logger,
 ) *AirspaceService {
 	return &AirspaceService{
@@ -29,6 +34,7 @@ func NewAirspaceService(
 		pilotRepo:    pilotRepo,
 		droneRepo:    droneRepo,
 		orderRepo:    orderRepo,
+		flightRepo:   flightRepo,
 		logger:       logger,
 	}
 }
@@ -104,34 +110,6 @@ func (s *AirspaceService) ReviewApplication(id int64, adminID int64, approved bo
 	return s.airspaceRepo.UpdateStatus(id, status, adminID, notes)
 }
 
-// SubmitToUOM 提交到UOM平台（预留接口）
-func (s *AirspaceService) SubmitToUOM(id int64) error {
-	app, err := s.airspaceRepo.GetApplicationByID(id)
-	if err != nil {
-		return fmt.Errorf("申请不存在")
-	}
-	if app.Status != "approved" && app.Status != "pending_review" {
-		return fmt.Errorf("当前状态不允许提交UOM")
-	}
-
-	// Generate mock UOM application number (will be replaced with real UOM API)
-	uomNo := fmt.Sprintf("UOM-%d-%d", time.Now().Unix(), id)
-	s.logger.Info("模拟提交UOM平台", zap.String("uom_no", uomNo), zap.Int64("app_id", id))
-
-	return s.airspaceRepo.UpdateUOMInfo(id, uomNo)
-}
-
-// HandleUOMCallback 处理UOM平台回调（预留接口）
-func (s *AirspaceService) HandleUOMCallback(uomNo string, approved bool, approvalCode string) error {
-	// This would be called by a webhook from UOM platform
-	// For now, we simulate by looking up the application
-	s.logger.Info("收到UOM回调", zap.String("uom_no", uomNo), zap.Bool("approved", approved))
-
-	// Find application by UOM number and update
-	// In real implementation, we'd query by uom_application_no
-	return nil
-}
-
 // CancelApplication 取消空域申请
 func (s *AirspaceService) CancelApplication(id int64, pilotID int64) error {
 	app, err := s.airspaceRepo.GetApplicationByID(id)
@@ -144,7 +122,18 @@ func (s *AirspaceService) CancelApplication(id int64, pilotID int64) error {
 	if app.Status == "completed" || app.Status == "cancelled" {
 		return fmt.Errorf("当前状态不允许取消")
 	}
-	return s.airspaceRepo.UpdateStatus(id, "cancelled", 0, "用户取消")
+	if app.Status == "submitted_to_uom" && app.UOMApplicationNo != "" && s.uomGateway != nil {
+		if err := s.uomGateway.Cancel(app.UOMApplicationNo, "用户取消"); err != nil {
+			return fmt.Errorf("撤销UOM申请失败: %w", err)
+		}
+	}
+	if err := s.airspaceRepo.UpdateStatus(id, "cancelled", 0, "用户取消"); err != nil {
+		return err
+	}
+	if app.Status == "submitted_to_uom" {
+		s.syncOrderAirspaceStatus(app.OrderID, "cancelled", "空域申请已撤销")
+	}
+	return nil
 }
 
 // ========== No-Fly Zones ==========
@@ -169,8 +158,46 @@ func (s *AirspaceService) ListNoFlyZones(zoneType, status string, page, pageSize
 	return s.airspaceRepo.ListNoFlyZones(zoneType, status, page, pageSize)
 }
 
+// FindNearbyNoFlyZones 查找与指定位置水平距离在 radiusMeters 内的禁飞区(含多边形)
 func (s *AirspaceService) FindNearbyNoFlyZones(lat, lng float64, radiusMeters float64) ([]model.NoFlyZone, error) {
-	return s.airspaceRepo.FindNearbyNoFlyZones(lat, lng, radiusMeters)
+	zones, err := s.airspaceRepo.ListActiveNoFlyZones()
+	if err != nil {
+		return nil, err
+	}
+	point := geo.Point{Lat: lat, Lng: lng}
+	result := make([]model.NoFlyZone, 0)
+	for i := range zones {
+		zone, err := noFlyZoneGeometry(&zones[i])
+		if err != nil {
+			s.logger.Warn("禁飞区几何定义无效，已跳过", zap.Int64("zone_id", zones[i].ID), zap.Error(err))
+			continue
+		}
+		if zone.Distance(point) <= radiusMeters {
+			result = append(result, zones[i])
+		}
+	}
+	return result, nil
+}
+
+// findNoFlyZoneConflicts 返回当前生效且包含指定三维位置的禁飞区
+func (s *AirspaceService) findNoFlyZoneConflicts(lat, lng float64, altitude int) ([]model.NoFlyZone, error) {
+	zones, err := s.airspaceRepo.ListEffectiveNoFlyZones(time.Now(), altitude)
+	if err != nil {
+		return nil, err
+	}
+	point := geo.Point{Lat: lat, Lng: lng}
+	conflicts := make([]model.NoFlyZone, 0)
+	for i := range zones {
+		zone, err := noFlyZoneGeometry(&zones[i])
+		if err != nil {
+			s.logger.Warn("禁飞区几何定义无效，已跳过", zap.Int64("zone_id", zones[i].ID), zap.Error(err))
+			continue
+		}
+		if zone.Contains(point, altitude) {
+			conflicts = append(conflicts, zones[i])
+		}
+	}
+	return conflicts, nil
 }
 
 // CheckAirspaceAvailability 检查指定位置空域可用性
@@ -180,7 +207,7 @@ func (s *AirspaceService) CheckAirspaceAvailability(lat, lng float64, altitude i
 		Restrictions: []NoFlyZoneInfo{},
 	}
 
-	zones, err := s.airspaceRepo.CheckNoFlyZoneConflict(lat, lng, altitude)
+	zones, err := s.findNoFlyZoneConflicts(lat, lng, altitude)
 	if err != nil {
 		return nil, err
 	}
@@ -554,7 +581,7 @@ func (s *AirspaceService) checkAirspaceCompliance(airspaceAppID int64) []model.C
 	}
 
 	// 1. Check departure point against no-fly zones
-	departureZones, err := s.airspaceRepo.CheckNoFlyZoneConflict(app.DepartureLatitude, app.DepartureLongitude, app.MaxAltitude)
+	departureZones, err := s.findNoFlyZoneConflicts(app.DepartureLatitude, app.DepartureLongitude, app.MaxAltitude)
 	result := "passed"
 	msg := "起飞点不在禁飞区内"
 	if err == nil && len(departureZones) > 0 {
@@ -577,7 +604,7 @@ func (s *AirspaceService) checkAirspaceCompliance(airspaceAppID int64) []model.C
 	})
 
 	// 2. Check arrival point against no-fly zones
-	arrivalZones, err := s.airspaceRepo.CheckNoFlyZoneConflict(app.ArrivalLatitude, app.ArrivalLongitude, app.MaxAltitude)
+	arrivalZones, err := s.findNoFlyZoneConflicts(app.ArrivalLatitude, app.ArrivalLongitude, app.MaxAltitude)
 	result = "passed"
 	msg = "降落点不在禁飞区内"
 	if err == nil && len(arrivalZones) > 0 {
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+	"wurenji-backend/internal/pkg/uom"
+	"wurenji-backend/internal/repository"
+)
+
+func TestCheckRouteConflictsReportsZonesAndSuggestsDetour(t *testing.T) {
+	db := newServiceTestDB(t, &model.NoFlyZone{}, &model.Geofence{}, &model.Order{}, &model.SavedRoute{}, &model.MultiPointTask{}, &model.MultiPointTaskStop{})
+
+	radius := 300
+	centerLat, centerLng := 23.0045, 113.020
+	airport := &model.NoFlyZone{
+		Name: "机场净空区", ZoneType: "airport", GeometryType: "circle",
+		CenterLatitude: &centerLat, CenterLongitude: &centerLng, Radius: &radius,
+		IsPermanent: true, RestrictionLevel: "no_fly", Status: "active",
+	}
+	expired := time.Now().Add(-24 * time.Hour)
+	temporary := &model.NoFlyZone{
+		Name: "已结束的临时管制", ZoneType: "temporary", GeometryType: "polygon",
+		Coordinates:   model.JSON(`[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009]]`),
+		EffectiveFrom: &expired, EffectiveTo: &expired, RestrictionLevel: "no_fly", Status: "active",
+	}
+	for _, z := range []*model.NoFlyZone{airport, temporary} {
+		if err := db.Create(z).Error; err != nil {
+			t.Fatalf("create no-fly zone: %v", err)
+		}
+	}
+
+	// 工作日早高峰限飞的多边形围栏
+	school := &model.Geofence{
+		Name: "学校上空", FenceType: "restricted", GeometryType: "polygon",
+		Coordinates:      model.JSON(`[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009]]`),
+		MaxAltitude:      300,
+		TimeRestrictions: model.JSON(`[{"weekdays":[1,2,3,4,5],"start":"07:00","end":"09:00"}]`),
+		Status:           "active",
+	}
+	if err := db.Create(school).Error; err != nil {
+		t.Fatalf("create geofence: %v", err)
+	}
+
+	svc := NewAirspaceService(repository.NewAirspaceRepo(db), nil, nil, repository.NewOrderRepo(db), repository.NewFlightRepo(db), zap.NewNop())
+	route := []geo.Point{{Lat: 23.0045, Lng: 112.98}, {Lat: 23.0045, Lng: 113.03}}
+
+	// 2026-10-19 为周一
+	mondayMorning := time.Date(2026, 10, 19, 7, 30, 0, 0, time.Local)
+	end := mondayMorning.Add(30 * time.Minute)
+	result, err := svc.CheckRouteConflicts(&RouteCheckRequest{Points: route, Altitude: 100, StartTime: &mondayMorning, EndTime: &end})
+	if err != nil {
+		t.Fatalf("check route: %v", err)
+	}
+	if result.Available {
+		t.Fatal("route crossing the airport zone should not be available")
+	}
+	if len(result.Conflicts) != 2 {
+		t.Fatalf("expected airport and school conflicts, got %#v", result.Conflicts)
+	}
+	if result.Detour == nil || result.Detour.ExtraDistanceM <= 0 {
+		t.Fatalf("expected a detour suggestion, got %#v (reason %q)", result.Detour, result.DetourReason)
+	}
+	if geo.PathIntersects(geo.Circle{Center: geo.Point{Lat: centerLat, Lng: centerLng}, Radius: float64(radius)}, result.Detour.Route) {
+		t.Fatal("detour should avoid the airport zone")
+	}
+
+	// 周日下午围栏不生效，只剩机场
+	sunday := time.Date(2026, 10, 18, 15, 0, 0, 0, time.Local)
+	sundayEnd := sunday.Add(time.Hour)
+	result, err = svc.CheckRouteConflicts(&RouteCheckRequest{Points: route, Altitude: 100, StartTime: &sunday, EndTime: &sundayEnd})
+	if err != nil {
+		t.Fatalf("check route: %v", err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].SourceType != "no_fly_zone" || !result.Conflicts[0].Blocking {
+		t.Fatalf("expected only the airport conflict, got %#v", result.Conflicts)
+	}
+}
+
+func TestCheckRouteConflictsUsesOrderRoute(t *testing.T) {
+	db := newServiceTestDB(t, &model.NoFlyZone{}, &model.Geofence{}, &model.Order{}, &model.SavedRoute{}, &model.MultiPointTask{}, &model.MultiPointTaskStop{})
+
+	destLat, destLng := 23.0045, 113.03
+	start := time.Now().Add(time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-ROUTE-001", Title: "航线检查", ServiceType: "cargo",
+		ServiceLatitude: 23.0045, ServiceLongitude: 112.98,
+		DestLatitude: &destLat, DestLongitude: &destLng,
+		StartTime: start, EndTime: start.Add(2 * time.Hour), Status: "accepted",
+		ClientUserID: 11, RenterID: 11, ProviderUserID: 12,
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	svc := NewAirspaceService(repository.NewAirspaceRepo(db), nil, nil, repository.NewOrderRepo(db), repository.NewFlightRepo(db), zap.NewNop())
+	if _, err := svc.CheckRouteConflicts(&RouteCheckRequest{OrderID: order.ID, UserID: 99}); err == nil {
+		t.Fatal("expected route check on another user's order to be rejected")
+	}
+	result, err := svc.CheckRouteConflicts(&RouteCheckRequest{OrderID: order.ID, UserID: 12})
+	if err != nil {
+		t.Fatalf("check route: %v", err)
+	}
+	if !result.Available || len(result.Route) != 2 || result.Altitude != 120 {
+		t.Fatalf("unexpected result %#v", result)
+	}
+	if !result.StartTime.Equal(order.StartTime) {
+		t.Fatalf("expected order start time as window start, got %v", result.StartTime)
+	}
+}
+
+func TestSubmitToUOMAppliesSimulatorCallback(t *testing.T) {
+	db := newServiceTestDB(t, &model.AirspaceApplication{}, &model.Pilot{}, &model.Drone{}, &model.Order{}, &model.OrderTimeline{})
+
+	start := time.Now().Add(time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-UOM-001", Title: "空域申请", ServiceType: "cargo",
+		ServiceLatitude: 23.0045, ServiceLongitude: 112.98,
+		StartTime: start, EndTime: start.Add(time.Hour), Status: "accepted", AirspaceStatus: "required",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	pilot := &model.Pilot{UserID: 501}
+	if err := db.Create(pilot).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+	newApp := func(maxAltitude int) *model.AirspaceApplication {
+		app := &model.AirspaceApplication{
+			OrderID: order.ID, PilotID: pilot.ID, DroneID: 1,
+			FlightPlanName: "测试航线", FlightPurpose: "cargo_delivery",
+			DepartureLatitude: 23.0045, DepartureLongitude: 112.98, ArrivalLatitude: 23.0045, ArrivalLongitude: 113.03,
+			PlannedAltitude: 100, MaxAltitude: maxAltitude,
+			PlannedStartTime: start, PlannedEndTime: start.Add(time.Hour), Status: "approved",
+		}
+		if err := db.Create(app).Error; err != nil {
+			t.Fatalf("create application: %v", err)
+		}
+		return app
+	}
+
+	svc := NewAirspaceService(repository.NewAirspaceRepo(db), repository.NewPilotRepo(db), nil, repository.NewOrderRepo(db), repository.NewFlightRepo(db), zap.NewNop())
+	simulator := uom.NewSimulator(uom.SimulatorConfig{DecisionDelay: 10 * time.Millisecond, Decision: uom.DecisionAuto, MaxAltitude: 120, Secret: "test-secret"}, zap.NewNop())
+	simulator.SetCallbackSink(svc.HandleUOMCallback)
+	svc.SetUOMGateway(simulator)
+
+	waitStatus := func(id int64) *model.AirspaceApplication {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			var app model.AirspaceApplication
+			if err := db.First(&app, id).Error; err != nil {
+				t.Fatalf("load application: %v", err)
+			}
+			if app.Status != "submitted_to_uom" || time.Now().After(deadline) {
+				return &app
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	approved := newApp(100)
+	if err := svc.SubmitToUOM(approved.ID); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	got := waitStatus(approved.ID)
+	if got.Status != "approved" || got.UOMApprovalCode == "" || got.UOMApplicationNo == "" {
+		t.Fatalf("expected approved application with permit, got %#v", got)
+	}
+	var reloaded model.Order
+	db.First(&reloaded, order.ID)
+	if reloaded.AirspaceStatus != "approved" {
+		t.Fatalf("expected order airspace status approved, got %q", reloaded.AirspaceStatus)
+	}
+
+	// 重复回调保持幂等
+	status, err := simulator.Query(got.UOMApplicationNo)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if status.Status != uom.StatusApproved {
+		t.Fatalf("simulator status %q", status.Status)
+	}
+	if _, err := svc.SyncUOMStatus(approved.ID, pilot.UserID); err != nil {
+		t.Fatalf("sync after callback should be a no-op, got %v", err)
+	}
+	if _, err := svc.SyncUOMStatus(approved.ID, pilot.UserID+1); err == nil {
+		t.Fatal("sync by a user who does not own the application should be rejected")
+	}
+
+	// 超过限高被驳回
+	rejected := newApp(300)
+	if err := svc.SubmitToUOM(rejected.ID); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if got := waitStatus(rejected.ID); got.Status != "rejected" {
+		t.Fatalf("expected rejected application, got %q", got.Status)
+	}
+
+	// 签名错误的回调不改变状态
+	body := []byte(`{"application_no":"` + got.UOMApplicationNo + `","status":"cancelled"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := svc.HandleUOMCallback(body, ts, uom.Sign("wrong-secret", ts, body)); !IsUOMSignatureError(err) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
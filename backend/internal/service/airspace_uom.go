@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+	"wurenji-backend/internal/pkg/uom"
+)
+
+// uomStatusMapping UOM 终态到空域申请状态的映射
+var uomStatusMapping = map[string]string{
+	uom.StatusApproved:  "approved",
+	uom.StatusRejected:  "rejected",
+	uom.StatusCancelled: "cancelled",
+	uom.StatusExpired:   "expired",
+}
+
+func (s *AirspaceService) SetUOMGateway(gateway uom.UOMGateway) {
+	s.uomGateway = gateway
+}
+
+// SubmitToUOM 提交空域申请到UOM平台
+func (s *AirspaceService) SubmitToUOM(id int64) error {
+	if s.uomGateway == nil {
+		return fmt.Errorf("UOM平台未配置")
+	}
+	app, err := s.airspaceRepo.GetApplicationByID(id)
+	if err != nil {
+		return fmt.Errorf("申请不存在")
+	}
+	if app.Status != "approved" && app.Status != "pending_review" {
+		return fmt.Errorf("当前状态不允许提交UOM")
+	}
+	if app.UOMApplicationNo != "" && app.Status == "approved" && app.UOMApprovalCode != "" {
+		return fmt.Errorf("申请已获UOM批准")
+	}
+
+	result, err := s.uomGateway.Submit(s.buildUOMSubmitRequest(app))
+	if err != nil {
+		s.logger.Error("提交UOM平台失败", zap.Int64("app_id", id), zap.Error(err))
+		return fmt.Errorf("提交UOM平台失败: %w", err)
+	}
+	s.logger.Info("已提交UOM平台", zap.String("uom_no", result.ApplicationNo), zap.Int64("app_id", id))
+
+	if err := s.airspaceRepo.UpdateUOMInfo(id, result.ApplicationNo); err != nil {
+		return err
+	}
+	s.syncOrderAirspaceStatus(app.OrderID, "pending", fmt.Sprintf("空域申请已提交UOM平台，申请编号 %s", result.ApplicationNo))
+	return nil
+}
+
+// HandleUOMCallback 处理UOM平台审批结果回调，校验签名后推进申请状态
+func (s *AirspaceService) HandleUOMCallback(body []byte, timestamp, signature string) error {
+	if s.uomGateway == nil {
+		return fmt.Errorf("UOM平台未配置")
+	}
+	payload, err := s.uomGateway.VerifyCallback(body, timestamp, signature)
+	if err != nil {
+		s.logger.Warn("UOM回调校验失败", zap.Error(err))
+		return err
+	}
+	s.logger.Info("收到UOM回调", zap.String("uom_no", payload.ApplicationNo), zap.String("status", payload.Status))
+
+	app, err := s.airspaceRepo.GetApplicationByUOMNo(payload.ApplicationNo)
+	if err != nil {
+		return fmt.Errorf("UOM申请编号 %s 不存在", payload.ApplicationNo)
+	}
+	return s.applyUOMResult(app, payload.Status, payload.ApprovalCode, payload.Reason)
+}
+
+// SyncUOMStatus 主动查询UOM平台并同步申请状态，用于回调丢失时兜底；仅申请所属飞手可触发
+func (s *AirspaceService) SyncUOMStatus(id, userID int64) (*model.AirspaceApplication, error) {
+	if s.uomGateway == nil {
+		return nil, fmt.Errorf("UOM平台未配置")
+	}
+	app, err := s.airspaceRepo.GetApplicationByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("申请不存在")
+	}
+	if s.pilotRepo == nil {
+		return nil, fmt.Errorf("无权操作此申请")
+	}
+	pilot, err := s.pilotRepo.GetByUserID(userID)
+	if err != nil || pilot.ID != app.PilotID {
+		return nil, fmt.Errorf("无权操作此申请")
+	}
+	if app.UOMApplicationNo == "" {
+		return nil, fmt.Errorf("申请尚未提交UOM平台")
+	}
+	status, err := s.uomGateway.Query(app.UOMApplicationNo)
+	if err != nil {
+		return nil, fmt.Errorf("查询UOM申请状态失败: %w", err)
+	}
+	if uom.IsFinal(status.Status) {
+		if err := s.applyUOMResult(app, status.Status, status.ApprovalCode, status.Reason); err != nil {
+			return nil, err
+		}
+	}
+	return s.airspaceRepo.GetApplicationByID(id)
+}
+
+// SyncPendingUOMApplications 批量同步提交超过 minAge 仍未收到回调的申请
+func (s *AirspaceService) SyncPendingUOMApplications(minAge time.Duration, limit int) (int, error) {
+	if s.uomGateway == nil {
+		return 0, nil
+	}
+	apps, err := s.airspaceRepo.ListSubmittedToUOM(time.Now().Add(-minAge), limit)
+	if err != nil {
+		return 0, err
+	}
+	synced := 0
+	for i := range apps {
+		app := &apps[i]
+		status, err := s.uomGateway.Query(app.UOMApplicationNo)
+		if err != nil {
+			s.logger.Warn("查询UOM申请状态失败", zap.String("uom_no", app.UOMApplicationNo), zap.Error(err))
+			continue
+		}
+		if !uom.IsFinal(status.Status) {
+			continue
+		}
+		if err := s.applyUOMResult(app, status.Status, status.ApprovalCode, status.Reason); err != nil {
+			s.logger.Warn("同步UOM申请状态失败", zap.String("uom_no", app.UOMApplicationNo), zap.Error(err))
+			continue
+		}
+		synced++
+	}
+	return synced, nil
+}
+
+// applyUOMResult 按状态机推进申请: submitted_to_uom -> approved/rejected/cancelled/expired
+// 重复回调(已处于相同终态)视为成功
+func (s *AirspaceService) applyUOMResult(app *model.AirspaceApplication, uomStatus, approvalCode, reason string) error {
+	target, ok := uomStatusMapping[uomStatus]
+	if !ok {
+		return fmt.Errorf("不支持的UOM状态: %s", uomStatus)
+	}
+	if app.Status == target {
+		return nil
+	}
+	if app.Status != "submitted_to_uom" {
+		return fmt.Errorf("申请当前状态 %s 不接受UOM结果 %s", app.Status, uomStatus)
+	}
+
+	notes := reason
+	if target == "approved" {
+		notes = fmt.Sprintf("UOM批准，许可号 %s", approvalCode)
+	}
+	updated, err := s.airspaceRepo.ApplyUOMResult(app.ID, target, approvalCode, notes)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		// 并发的回调/轮询已处理
+		return nil
+	}
+
+	note := "UOM空域申请已批准"
+	switch target {
+	case "rejected":
+		note = "UOM空域申请被驳回: " + reason
+	case "cancelled":
+		note = "UOM空域申请已撤销"
+	case "expired":
+		note = "UOM空域申请已过期"
+	}
+	s.syncOrderAirspaceStatus(app.OrderID, target, note)
+	return nil
+}
+
+// syncOrderAirspaceStatus 同步订单空域状态并记录时间线
+func (s *AirspaceService) syncOrderAirspaceStatus(orderID int64, status, note string) {
+	if orderID == 0 || s.orderRepo == nil {
+		return
+	}
+	if err := s.orderRepo.UpdateFields(orderID, map[string]interface{}{"airspace_status": status}); err != nil {
+		s.logger.Warn("更新订单空域状态失败", zap.Int64("order_id", orderID), zap.Error(err))
+		return
+	}
+	if err := s.orderRepo.AddTimeline(&model.OrderTimeline{
+		OrderID:      orderID,
+		Status:       "airspace_" + status,
+		Note:         note,
+		OperatorType: "system",
+	}); err != nil {
+		s.logger.Warn("记录订单空域时间线失败", zap.Int64("order_id", orderID), zap.Error(err))
+	}
+}
+
+func (s *AirspaceService) buildUOMSubmitRequest(app *model.AirspaceApplication) *uom.SubmitRequest {
+	req := &uom.SubmitRequest{
+		ExternalID:     strconv.FormatInt(app.ID, 10),
+		FlightPlanName: app.FlightPlanName,
+		FlightPurpose:  app.FlightPurpose,
+		FlightType:     app.FlightType,
+		Departure:      uom.Waypoint{Lat: app.DepartureLatitude, Lng: app.DepartureLongitude, Alt: app.PlannedAltitude},
+		Arrival:        uom.Waypoint{Lat: app.ArrivalLatitude, Lng: app.ArrivalLongitude, Alt: app.PlannedAltitude},
+		MaxAltitude:    app.MaxAltitude,
+		StartTime:      app.PlannedStartTime,
+		EndTime:        app.PlannedEndTime,
+	}
+	if len(app.Waypoints) > 0 {
+		if path, err := geo.ParsePath(app.Waypoints); err == nil {
+			for _, p := range path {
+				req.Waypoints = append(req.Waypoints, uom.Waypoint{Lat: p.Lat, Lng: p.Lng})
+			}
+		}
+	}
+	if app.Drone != nil {
+		req.DroneSerialNo = app.Drone.SerialNumber
+		req.UOMDroneRegNo = app.Drone.UOMRegistrationNo
+	}
+	if app.Pilot != nil {
+		req.PilotLicenseNo = app.Pilot.CAACLicenseNo
+		if app.Pilot.User != nil {
+			req.PilotName = app.Pilot.User.Nickname
+		}
+	}
+	return req
+}
+
+// IsUOMSignatureError 判断是否为回调签名校验失败
+func IsUOMSignatureError(err error) bool {
+	return errors.Is(err, uom.ErrInvalidSignature) || errors.Is(err, uom.ErrStaleCallback)
+}
@@ -26,6 +26,7 @@ type AuthService struct {
 	smsService      *sms.SMSService
 	cfg             *config.Config
 	logger          *zap.Logger
+	couponService   *CouponService
 }
 
 func NewAuthService(userRepo *repository.UserRepo, clientRepo *repository.ClientRepo, roleProfileRepo *repository.RoleProfileRepo, rds *redis.Client, smsService *sms.SMSService, cfg *config.Config, logger *zap.Logger) *AuthService {
@@ -40,6 +41,10 @@ func NewAuthService(userRepo *repository.UserRepo, clientRepo *repository.Client
 	}
 }
 
+func (s *AuthService) SetCouponService(couponService *CouponService) {
+	s.couponService = couponService
+}
+
 // ensureDefaultClientProfile 默认创建个人客户档案，避免新用户再走一次初始化流程。
 func (s *AuthService) ensureDefaultClientProfile(user *model.User) error {
 	if user == nil || user.ID == 0 {
@@ -123,7 +128,8 @@ func (s *AuthService) VerifyCode(phone, code string) (bool, error) {
 	return true, nil
 }
 
-func (s *AuthService) Register(phone, password, nickname string) (*model.User, *jwtpkg.TokenPair, error) {
+// Register 手机号注册；referrerID 为邀请人，邀请人不存在时忽略
+func (s *AuthService) Register(phone, password, nickname string, referrerID int64) (*model.User, *jwtpkg.TokenPair, error) {
 	exists, err := s.userRepo.ExistsByPhone(phone)
 	if err != nil {
 		return nil, nil, err
@@ -144,6 +150,11 @@ func (s *AuthService) Register(phone, password, nickname string) (*model.User, *
 		UserType:     "renter",
 		Status:       "active",
 	}
+	if referrerID > 0 {
+		if _, err := s.userRepo.GetByID(referrerID); err == nil {
+			user.ReferrerID = referrerID
+		}
+	}
 	if err := s.createUserWithDefaultProfiles(user); err != nil {
 		return nil, nil, err
 	}
@@ -334,7 +345,7 @@ func (s *AuthService) createUserWithDefaultProfiles(user *model.User) error {
 		return errors.New("用户仓储未初始化")
 	}
 
-	return db.Transaction(func(tx *gorm.DB) error {
+	if err := db.Transaction(func(tx *gorm.DB) error {
 		userRepo := repository.NewUserRepo(tx)
 		clientRepo := repository.NewClientRepo(tx)
 		roleProfileRepo := repository.NewRoleProfileRepo(tx)
@@ -353,5 +364,14 @@ func (s *AuthService) createUserWithDefaultProfiles(user *model.User) error {
 			logger:          s.logger,
 		}
 		return tempService.ensureDefaultClientProfile(user)
-	})
+	}); err != nil {
+		return err
+	}
+
+	if s.couponService != nil {
+		if _, err := s.couponService.IssueForNewUser(user.ID); err != nil && s.logger != nil {
+			s.logger.Warn("发放新人优惠券失败", zap.Int64("user_id", user.ID), zap.Error(err))
+		}
+	}
+	return nil
 }
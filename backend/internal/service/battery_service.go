@@ -0,0 +1,561 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// batteryUsageBatchSize 每轮回填的飞行记录数
+const batteryUsageBatchSize = 200
+
+// batteryRecentLogs 电池包详情展示的最近使用记录数
+const batteryRecentLogs = 20
+
+var batteryChemistries = map[string]bool{
+	"lipo":        true,
+	"lihv":        true,
+	"li_ion":      true,
+	"solid_state": true,
+}
+
+// BatteryService 电池包登记与健康管理：按飞行记录累计充放电循环，由放电曲线估算健康度，
+// 起飞前拒绝健康度不足的电池包，低于退役阈值或超过设计循环寿命时自动退役
+type BatteryService struct {
+	batteryRepo *repository.BatteryRepo
+	droneRepo   *repository.DroneRepo
+	orderRepo   *repository.OrderRepo
+	cfg         config.BatteryConfig
+	events      *EventService
+	logger      *zap.Logger
+}
+
+func NewBatteryService(
+	batteryRepo *repository.BatteryRepo,
+	droneRepo *repository.DroneRepo,
+	orderRepo *repository.OrderRepo,
+	cfg config.BatteryConfig,
+	logger *zap.Logger,
+) *BatteryService {
+	return &BatteryService{batteryRepo: batteryRepo, droneRepo: droneRepo, orderRepo: orderRepo, cfg: cfg, logger: logger}
+}
+
+func (s *BatteryService) SetEventService(eventService *EventService) {
+	s.events = eventService
+}
+
+// RegisterBatteryReq 登记电池包请求
+type RegisterBatteryReq struct {
+	SerialNumber     string  `json:"serial_number" binding:"required"`
+	Brand            string  `json:"brand"`
+	Model            string  `json:"model"`
+	Chemistry        string  `json:"chemistry" binding:"required"` // lipo, lihv, li_ion, solid_state
+	RatedCapacityMAH int     `json:"rated_capacity_mah" binding:"required"`
+	RatedVoltage     float64 `json:"rated_voltage"`
+	CellCount        int     `json:"cell_count"`
+	RatedCycles      int     `json:"rated_cycles"`
+	CycleCount       float64 `json:"cycle_count"` // 登记前已有的循环次数
+	DroneID          int64   `json:"drone_id"`
+}
+
+// RegisterPack 机主登记电池包，可同时绑定到自己的无人机
+func (s *BatteryService) RegisterPack(ownerID int64, req *RegisterBatteryReq) (*model.BatteryPack, error) {
+	serial := strings.TrimSpace(req.SerialNumber)
+	if serial == "" {
+		return nil, errors.New("电池序列号不能为空")
+	}
+	if !batteryChemistries[req.Chemistry] {
+		return nil, fmt.Errorf("不支持的电池类型 %s", req.Chemistry)
+	}
+	if req.RatedCapacityMAH <= 0 || req.RatedCycles < 0 || req.CycleCount < 0 {
+		return nil, errors.New("电池额定容量、循环寿命参数无效")
+	}
+	if req.DroneID > 0 {
+		if err := s.ensureDroneOwner(ownerID, req.DroneID); err != nil {
+			return nil, err
+		}
+	}
+	pack := &model.BatteryPack{
+		OwnerID:          ownerID,
+		DroneID:          req.DroneID,
+		SerialNumber:     serial,
+		Brand:            req.Brand,
+		Model:            req.Model,
+		Chemistry:        req.Chemistry,
+		RatedCapacityMAH: req.RatedCapacityMAH,
+		RatedVoltage:     req.RatedVoltage,
+		CellCount:        req.CellCount,
+		RatedCycles:      req.RatedCycles,
+		CycleCount:       req.CycleCount,
+		HealthPercent:    100,
+		Status:           "active",
+	}
+	if err := s.batteryRepo.CreatePack(pack); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// ListOwnerPacks 机主的电池包列表
+func (s *BatteryService) ListOwnerPacks(ownerID, droneID int64, status string, page, pageSize int) ([]model.BatteryPack, int64, error) {
+	filters := map[string]interface{}{"owner_id": ownerID}
+	if droneID > 0 {
+		filters["drone_id"] = droneID
+	}
+	if status != "" {
+		filters["status"] = status
+	}
+	return s.batteryRepo.ListPacks(page, pageSize, filters)
+}
+
+// BatteryPackDetail 电池包详情与最近使用记录
+type BatteryPackDetail struct {
+	Pack *model.BatteryPack       `json:"pack"`
+	Logs []model.BatteryFlightLog `json:"logs"`
+}
+
+// GetPackDetail 机主查看电池包详情
+func (s *BatteryService) GetPackDetail(ownerID, packID int64) (*BatteryPackDetail, error) {
+	pack, err := s.ownedPack(ownerID, packID)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.batteryRepo.ListLogsByPack(packID, batteryRecentLogs)
+	if err != nil {
+		return nil, err
+	}
+	return &BatteryPackDetail{Pack: pack, Logs: logs}, nil
+}
+
+// AssignDrone 将电池包绑定到机主的无人机，droneID 为 0 时解绑
+func (s *BatteryService) AssignDrone(ownerID, packID, droneID int64) error {
+	pack, err := s.ownedPack(ownerID, packID)
+	if err != nil {
+		return err
+	}
+	if pack.Status == "retired" && droneID > 0 {
+		return errors.New("电池包已退役，不能绑定无人机")
+	}
+	if droneID > 0 {
+		if err := s.ensureDroneOwner(ownerID, droneID); err != nil {
+			return err
+		}
+	}
+	return s.batteryRepo.UpdatePackFields(packID, map[string]interface{}{"drone_id": droneID})
+}
+
+// RetirePack 机主手动退役电池包
+func (s *BatteryService) RetirePack(ownerID, packID int64, reason string) error {
+	pack, err := s.ownedPack(ownerID, packID)
+	if err != nil {
+		return err
+	}
+	if pack.Status == "retired" {
+		return nil
+	}
+	if strings.TrimSpace(reason) == "" {
+		reason = "机主手动退役"
+	}
+	return s.batteryRepo.UpdatePackFields(packID, map[string]interface{}{
+		"status":        "retired",
+		"retire_reason": reason,
+		"retired_at":    time.Now(),
+	})
+}
+
+func (s *BatteryService) ownedPack(ownerID, packID int64) (*model.BatteryPack, error) {
+	pack, err := s.batteryRepo.GetPackByID(packID)
+	if err != nil {
+		return nil, err
+	}
+	if pack.OwnerID != ownerID {
+		return nil, errors.New("无权操作此电池包")
+	}
+	return pack, nil
+}
+
+func (s *BatteryService) ensureDroneOwner(ownerID, droneID int64) error {
+	drone, err := s.droneRepo.GetByID(droneID)
+	if err != nil {
+		return err
+	}
+	if drone.OwnerID != ownerID {
+		return errors.New("无权操作此无人机")
+	}
+	return nil
+}
+
+// ==================== 飞前检查 ====================
+
+// BatteryAssignment 本次飞行使用的电池包，Sequence 为第几组电池(中途换电后递增)，同组可有多块并联电池
+type BatteryAssignment struct {
+	BatteryPackID int64 `json:"battery_pack_id" binding:"required"`
+	Sequence      int   `json:"sequence"`
+}
+
+// BatteryPreflightReq 电池飞前检查请求
+type BatteryPreflightReq struct {
+	OrderID int64               `json:"order_id" binding:"required"`
+	Packs   []BatteryAssignment `json:"packs" binding:"required"`
+}
+
+// BatteryPackCheck 单块电池包的检查结果
+type BatteryPackCheck struct {
+	BatteryPackID int64   `json:"battery_pack_id"`
+	SerialNumber  string  `json:"serial_number"`
+	Sequence      int     `json:"sequence"`
+	HealthPercent float64 `json:"health_percent"`
+	CycleCount    float64 `json:"cycle_count"`
+	Passed        bool    `json:"passed"`
+	Reason        string  `json:"reason,omitempty"`
+}
+
+// BatteryPreflightResult 电池飞前检查结果，全部通过时记录到订单
+type BatteryPreflightResult struct {
+	OrderID          int64              `json:"order_id"`
+	Passed           bool               `json:"passed"`
+	MinHealthPercent float64            `json:"min_health_percent"`
+	Packs            []BatteryPackCheck `json:"packs"`
+}
+
+// PreflightCheck 执行飞手或机主为订单登记本次飞行的电池包，逐块检查归属、在役状态、健康度与循环寿命
+func (s *BatteryService) PreflightCheck(userID int64, req *BatteryPreflightReq) (*BatteryPreflightResult, error) {
+	order, err := s.orderRepo.GetByID(req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != order.ExecutorPilotUserID && userID != orderProviderUserID(order) {
+		return nil, errors.New("无权操作此订单")
+	}
+	if order.DroneID <= 0 {
+		return nil, errors.New("订单尚未指定无人机")
+	}
+	if len(req.Packs) == 0 {
+		return nil, errors.New("请选择本次飞行使用的电池")
+	}
+
+	ids := make([]int64, 0, len(req.Packs))
+	seen := make(map[int64]bool, len(req.Packs))
+	for _, assignment := range req.Packs {
+		if seen[assignment.BatteryPackID] {
+			return nil, errors.New("同一电池包不能重复选择")
+		}
+		seen[assignment.BatteryPackID] = true
+		ids = append(ids, assignment.BatteryPackID)
+	}
+	packs, err := s.batteryRepo.GetPacksByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	packByID := make(map[int64]*model.BatteryPack, len(packs))
+	for i := range packs {
+		packByID[packs[i].ID] = &packs[i]
+	}
+
+	result := &BatteryPreflightResult{OrderID: order.ID, Passed: true, MinHealthPercent: s.cfg.MinHealthPercent}
+	logs := make([]model.BatteryFlightLog, 0, len(req.Packs))
+	now := time.Now()
+	for _, assignment := range req.Packs {
+		sequence := assignment.Sequence
+		if sequence <= 0 {
+			sequence = 1
+		}
+		check := BatteryPackCheck{BatteryPackID: assignment.BatteryPackID, Sequence: sequence}
+		pack := packByID[assignment.BatteryPackID]
+		if pack == nil {
+			check.Reason = "电池包不存在"
+		} else {
+			check.SerialNumber = pack.SerialNumber
+			check.HealthPercent = pack.HealthPercent
+			check.CycleCount = pack.CycleCount
+			check.Reason = s.packRefusal(pack, order.DroneID)
+		}
+		check.Passed = check.Reason == ""
+		if !check.Passed {
+			result.Passed = false
+		}
+		result.Packs = append(result.Packs, check)
+		if pack != nil {
+			logs = append(logs, model.BatteryFlightLog{
+				BatteryPackID: pack.ID,
+				OrderID:       order.ID,
+				DroneID:       order.DroneID,
+				Sequence:      sequence,
+				CheckedBy:     userID,
+				CheckedAt:     now,
+				HealthAtCheck: pack.HealthPercent,
+				Status:        "checked",
+			})
+		}
+	}
+	if !result.Passed {
+		return result, nil
+	}
+	if err := s.batteryRepo.ReplaceCheckedLogs(order.ID, logs); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// packRefusal 电池包不能用于该无人机飞行的原因，可用时返回空
+func (s *BatteryService) packRefusal(pack *model.BatteryPack, droneID int64) string {
+	switch {
+	case pack.Status != "active":
+		return "电池包已退役"
+	case pack.DroneID != droneID:
+		return "电池包未绑定到本次执行的无人机"
+	case pack.HealthPercent < s.cfg.MinHealthPercent:
+		return fmt.Sprintf("健康度%.1f%%低于起飞要求%.1f%%", pack.HealthPercent, s.cfg.MinHealthPercent)
+	case pack.RatedCycles > 0 && pack.CycleCount >= float64(pack.RatedCycles):
+		return fmt.Sprintf("循环次数%.1f已达设计寿命%d", pack.CycleCount, pack.RatedCycles)
+	}
+	return ""
+}
+
+// StartFlightRefusals 起飞前复核订单登记的电池包；无人机未登记电池包时不做要求
+func (s *BatteryService) StartFlightRefusals(order *model.Order) ([]BatteryPackCheck, error) {
+	if order.DroneID <= 0 {
+		return nil, nil
+	}
+	registered, err := s.batteryRepo.CountActivePacksByDrone(order.DroneID)
+	if err != nil || registered == 0 {
+		return nil, err
+	}
+	logs, err := s.batteryRepo.ListLogsByOrder(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(logs))
+	for _, log := range logs {
+		if log.Status == "checked" {
+			ids = append(ids, log.BatteryPackID)
+		}
+	}
+	if len(ids) == 0 {
+		return []BatteryPackCheck{{Reason: "尚未完成电池飞前检查"}}, nil
+	}
+	packs, err := s.batteryRepo.GetPacksByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	var refusals []BatteryPackCheck
+	for i := range packs {
+		if reason := s.packRefusal(&packs[i], order.DroneID); reason != "" {
+			refusals = append(refusals, BatteryPackCheck{
+				BatteryPackID: packs[i].ID, SerialNumber: packs[i].SerialNumber,
+				HealthPercent: packs[i].HealthPercent, CycleCount: packs[i].CycleCount, Reason: reason,
+			})
+		}
+	}
+	return refusals, nil
+}
+
+// ==================== 飞行数据回填 ====================
+
+// BatteryUsageResult 一次电池数据回填的汇总
+type BatteryUsageResult struct {
+	Flights int `json:"flights"`
+	Packs   int `json:"packs"`
+	Retired int `json:"retired"`
+}
+
+// RecordFlightUsage 回填已结束飞行的电池放电数据，累计循环、更新健康度并按阈值退役
+func (s *BatteryService) RecordFlightUsage(now time.Time) (*BatteryUsageResult, error) {
+	result := &BatteryUsageResult{}
+	flights, err := s.batteryRepo.ListPendingFlights(batteryUsageBatchSize)
+	if err != nil {
+		return result, err
+	}
+	for i := range flights {
+		packs, retired, err := s.recordFlight(&flights[i], now)
+		if err != nil {
+			s.logger.Warn("电池飞行数据回填失败", zap.Int64("order_id", flights[i].OrderID),
+				zap.Int64("flight_record_id", flights[i].FlightRecordID), zap.Error(err))
+			continue
+		}
+		result.Flights++
+		result.Packs += packs
+		result.Retired += retired
+	}
+	return result, nil
+}
+
+// dischargeSegment 一组电池的放电曲线
+type dischargeSegment struct {
+	startLevel int
+	endLevel   int
+	startAt    time.Time
+	endAt      time.Time
+	rate       float64 // 放电速率(%/分钟)
+}
+
+func (s *BatteryService) recordFlight(flight *repository.BatteryPendingFlight, now time.Time) (int, int, error) {
+	logs, err := s.batteryRepo.ListLogsByOrder(flight.OrderID)
+	if err != nil {
+		return 0, 0, err
+	}
+	samples, err := s.batteryRepo.ListBatteryLevels(flight.FlightRecordID)
+	if err != nil {
+		return 0, 0, err
+	}
+	drone, err := s.droneRepo.GetByID(flight.DroneID)
+	if err != nil {
+		return 0, 0, err
+	}
+	segments := splitDischargeSegments(samples, s.cfg.SwapRisePercent)
+	expectedRate := s.expectedDischargeRate(drone, flight.CargoWeightKG)
+
+	var pending []model.BatteryFlightLog
+	ids := make([]int64, 0, len(logs))
+	for _, log := range logs {
+		if log.Status == "checked" {
+			pending = append(pending, log)
+			ids = append(ids, log.BatteryPackID)
+		}
+	}
+	packs, err := s.batteryRepo.GetPacksByIDs(ids)
+	if err != nil {
+		return 0, 0, err
+	}
+	packByID := make(map[int64]*model.BatteryPack, len(packs))
+	for i := range packs {
+		packByID[packs[i].ID] = &packs[i]
+	}
+
+	packFields := make(map[int64]map[string]interface{}, len(pending))
+	var retiredPacks []*model.BatteryPack
+	for i := range pending {
+		log := &pending[i]
+		log.FlightRecordID = flight.FlightRecordID
+		log.Status = "recorded"
+		log.RecordedAt = &now
+		pack := packByID[log.BatteryPackID]
+		if pack == nil {
+			continue
+		}
+		log.HealthAfter = pack.HealthPercent
+		if log.Sequence < 1 || log.Sequence > len(segments) {
+			continue
+		}
+
+		segment := segments[log.Sequence-1]
+		log.StartLevel = segment.startLevel
+		log.EndLevel = segment.endLevel
+		log.DurationSeconds = int(segment.endAt.Sub(segment.startAt).Seconds())
+		log.DischargeRate = math.Round(segment.rate*1000) / 1000
+		log.CycleIncrement = math.Round(float64(maxInt(segment.startLevel-segment.endLevel, 0))/100*1000) / 1000
+		if expectedRate > 0 && segment.rate > 0 && segment.endAt.Sub(segment.startAt).Minutes() >= s.cfg.MinSampleMinutes {
+			log.HealthSample = roundUsage(math.Min(expectedRate/segment.rate*100, 100))
+			log.HealthAfter = roundUsage(pack.HealthPercent*(1-s.cfg.HealthSmoothing) + log.HealthSample*s.cfg.HealthSmoothing)
+		}
+
+		pack.CycleCount = roundUsage(pack.CycleCount + log.CycleIncrement)
+		pack.HealthPercent = log.HealthAfter
+		fields := map[string]interface{}{
+			"cycle_count":    pack.CycleCount,
+			"flight_count":   pack.FlightCount + 1,
+			"health_percent": pack.HealthPercent,
+			"last_flight_at": segment.endAt,
+		}
+		if reason := s.retireReason(pack); reason != "" && pack.Status == "active" {
+			pack.Status = "retired"
+			pack.RetireReason = reason
+			pack.RetiredAt = &now
+			fields["status"] = pack.Status
+			fields["retire_reason"] = reason
+			fields["retired_at"] = now
+			retiredPacks = append(retiredPacks, pack)
+		}
+		packFields[pack.ID] = fields
+	}
+	if err := s.batteryRepo.RecordFlightUsage(pending, packFields); err != nil {
+		return 0, 0, err
+	}
+	for _, pack := range retiredPacks {
+		s.events.NotifyBatteryRetired(pack)
+	}
+	return len(packFields), len(retiredPacks), nil
+}
+
+// retireReason 电池包达到自动退役条件的原因
+func (s *BatteryService) retireReason(pack *model.BatteryPack) string {
+	if pack.HealthPercent < s.cfg.RetireHealthPercent {
+		return fmt.Sprintf("健康度%.1f%%低于退役阈值%.1f%%", pack.HealthPercent, s.cfg.RetireHealthPercent)
+	}
+	if pack.RatedCycles > 0 && pack.CycleCount >= float64(pack.RatedCycles) {
+		return fmt.Sprintf("循环次数%.1f已达设计寿命%d", pack.CycleCount, pack.RatedCycles)
+	}
+	return ""
+}
+
+// expectedDischargeRate 健康电池的期望放电速率(%/分钟)：按无人机额定续航，并按载重比例在额定与满载续航之间线性修正
+func (s *BatteryService) expectedDischargeRate(drone *model.Drone, cargoWeightKG float64) float64 {
+	if drone.MaxFlightTime <= 0 {
+		return 0
+	}
+	endurance := float64(drone.MaxFlightTime)
+	if drone.MaxPayloadKG > 0 && cargoWeightKG > 0 {
+		loadRatio := math.Min(cargoWeightKG/drone.MaxPayloadKG, 1)
+		endurance *= 1 - (1-s.cfg.PayloadEnduranceRatio)*loadRatio
+	}
+	return 100 / endurance
+}
+
+// splitDischargeSegments 按电量回升切分换电前后的放电曲线，并以最小二乘斜率估算每段的放电速率
+func splitDischargeSegments(samples []repository.BatteryLevelSample, swapRise int) []dischargeSegment {
+	if swapRise <= 0 {
+		swapRise = 15
+	}
+	var groups [][]repository.BatteryLevelSample
+	for i, sample := range samples {
+		if i == 0 || sample.BatteryLevel-samples[i-1].BatteryLevel >= swapRise {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], sample)
+	}
+
+	segments := make([]dischargeSegment, 0, len(groups))
+	for _, group := range groups {
+		first, last := group[0], group[len(group)-1]
+		segments = append(segments, dischargeSegment{
+			startLevel: first.BatteryLevel,
+			endLevel:   last.BatteryLevel,
+			startAt:    first.RecordedAt,
+			endAt:      last.RecordedAt,
+			rate:       dischargeSlope(group),
+		})
+	}
+	return segments
+}
+
+// dischargeSlope 电量随时间下降的最小二乘斜率(%/分钟)，样本不足或电量未下降时为 0
+func dischargeSlope(samples []repository.BatteryLevelSample) float64 {
+	if len(samples) < 3 {
+		return 0
+	}
+	origin := samples[0].RecordedAt
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.RecordedAt.Sub(origin).Minutes()
+		y := float64(sample.BatteryLevel)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator <= 0 {
+		return 0
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	return math.Max(-slope, 0)
+}
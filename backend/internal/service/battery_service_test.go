@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestBatteryPreflightRefusesUnfitPacksAndGatesStartFlight(t *testing.T) {
+	db := newServiceTestDB(t, &model.Drone{}, &model.Order{}, &model.Demand{}, &model.FlightRecord{}, &model.FlightPosition{},
+		&model.BatteryPack{}, &model.BatteryFlightLog{})
+	batteries := NewBatteryService(repository.NewBatteryRepo(db), repository.NewDroneRepo(db), repository.NewOrderRepo(db), config.BatteryConfig{
+		MinHealthPercent: 72, RetireHealthPercent: 70, HealthSmoothing: 0.3, SwapRisePercent: 15, MinSampleMinutes: 3, PayloadEnduranceRatio: 0.6,
+	}, zap.NewNop())
+	batteries.SetEventService(NewEventService(nil, &recordingPushService{}, zap.NewNop()))
+	drone := &model.Drone{OwnerID: 31, SerialNumber: "SN-BAT-001", MaxFlightTime: 30}
+	if err := db.Create(drone).Error; err != nil {
+		t.Fatalf("create drone: %v", err)
+	}
+	healthy, err := batteries.RegisterPack(31, &RegisterBatteryReq{SerialNumber: "BP-001", Chemistry: "lihv", RatedCapacityMAH: 30000, RatedCycles: 1500, DroneID: drone.ID})
+	if err != nil {
+		t.Fatalf("register pack: %v", err)
+	}
+	worn, _ := batteries.RegisterPack(31, &RegisterBatteryReq{SerialNumber: "BP-002", Chemistry: "lihv", RatedCapacityMAH: 30000, RatedCycles: 300, CycleCount: 300, DroneID: drone.ID})
+	loose, _ := batteries.RegisterPack(31, &RegisterBatteryReq{SerialNumber: "BP-003", Chemistry: "lihv", RatedCapacityMAH: 30000})
+	orderStart := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	order := &model.Order{OrderNo: "WRJ-BAT-001", DroneID: drone.ID, ClientUserID: 11, ProviderUserID: 31, ExecutorPilotUserID: 66,
+		Title: "吊运", ServiceType: "cargo", StartTime: orderStart, EndTime: orderStart.Add(time.Hour), Status: "confirmed"}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	gate := NewOrderGateService(config.OrderGateConfig{Enabled: true, Transitions: map[string][]string{
+		config.OrderTransitionStartFlight: {config.OrderGateCheckBattery},
+	}}, nil, nil, nil, nil, zap.NewNop())
+	gate.SetBatteryService(batteries)
+	var gateErr *OrderGateError
+	if err := gate.Evaluate(config.OrderTransitionStartFlight, order); !errors.As(err, &gateErr) || gateErr.Reasons[0].Code != "battery_check_missing" {
+		t.Fatalf("expected start flight blocked until battery check, got %v", err)
+	}
+
+	if _, err := batteries.PreflightCheck(11, &BatteryPreflightReq{OrderID: order.ID, Packs: []BatteryAssignment{{BatteryPackID: healthy.ID}}}); err == nil {
+		t.Fatal("expected client refused to run battery check")
+	}
+	result, err := batteries.PreflightCheck(66, &BatteryPreflightReq{OrderID: order.ID, Packs: []BatteryAssignment{
+		{BatteryPackID: healthy.ID}, {BatteryPackID: worn.ID}, {BatteryPackID: loose.ID, Sequence: 2},
+	}})
+	if err != nil {
+		t.Fatalf("preflight check: %v", err)
+	}
+	var refused []string
+	for _, check := range result.Packs {
+		if !check.Passed {
+			refused = append(refused, check.SerialNumber)
+		}
+	}
+	if result.Passed || !reflect.DeepEqual(refused, []string{"BP-002", "BP-003"}) {
+		t.Fatalf("expected worn-out and unbound packs refused, got %+v", result)
+	}
+	if logs, _ := repository.NewBatteryRepo(db).ListLogsByOrder(order.ID); len(logs) != 0 {
+		t.Fatalf("expected failed check not recorded, got %d logs", len(logs))
+	}
+
+	result, err = batteries.PreflightCheck(66, &BatteryPreflightReq{OrderID: order.ID, Packs: []BatteryAssignment{{BatteryPackID: healthy.ID}}})
+	if err != nil || !result.Passed {
+		t.Fatalf("expected healthy pack to pass, got %+v err %v", result, err)
+	}
+	if err := gate.Evaluate(config.OrderTransitionStartFlight, order); err != nil {
+		t.Fatalf("expected start flight allowed after battery check, got %v", err)
+	}
+
+	// 检查后电池健康度下降，起飞前复核拒绝
+	db.Model(&model.BatteryPack{}).Where("id = ?", healthy.ID).Update("health_percent", 71)
+	if err := gate.Evaluate(config.OrderTransitionStartFlight, order); !errors.As(err, &gateErr) || gateErr.Reasons[0].SubjectID != healthy.ID {
+		t.Fatalf("expected degraded pack blocked at takeoff, got %v", err)
+	}
+}
+
+func TestBatteryUsageSplitsSwapsCountsCyclesAndRetires(t *testing.T) {
+	db := newServiceTestDB(t, &model.Drone{}, &model.Order{}, &model.Demand{}, &model.FlightRecord{}, &model.FlightPosition{},
+		&model.BatteryPack{}, &model.BatteryFlightLog{})
+	pusher := &recordingPushService{}
+	batteries := NewBatteryService(repository.NewBatteryRepo(db), repository.NewDroneRepo(db), repository.NewOrderRepo(db), config.BatteryConfig{
+		MinHealthPercent: 72, RetireHealthPercent: 70, HealthSmoothing: 0.3, SwapRisePercent: 15, MinSampleMinutes: 3, PayloadEnduranceRatio: 0.6,
+	}, zap.NewNop())
+	batteries.SetEventService(NewEventService(nil, pusher, zap.NewNop()))
+	drone := &model.Drone{OwnerID: 31, SerialNumber: "SN-BAT-002", MaxFlightTime: 30}
+	if err := db.Create(drone).Error; err != nil {
+		t.Fatalf("create drone: %v", err)
+	}
+	first, _ := batteries.RegisterPack(31, &RegisterBatteryReq{SerialNumber: "BP-101", Chemistry: "lipo", RatedCapacityMAH: 22000, DroneID: drone.ID})
+	second, _ := batteries.RegisterPack(31, &RegisterBatteryReq{SerialNumber: "BP-102", Chemistry: "lipo", RatedCapacityMAH: 22000, DroneID: drone.ID})
+	db.Model(&model.BatteryPack{}).Where("id = ?", second.ID).Update("health_percent", 75)
+	orderStart := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	order := &model.Order{OrderNo: "WRJ-BAT-002", DroneID: drone.ID, ClientUserID: 11, ProviderUserID: 31, ExecutorPilotUserID: 66,
+		Title: "吊运", ServiceType: "cargo", StartTime: orderStart, EndTime: orderStart.Add(time.Hour), Status: "confirmed"}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if result, err := batteries.PreflightCheck(31, &BatteryPreflightReq{OrderID: order.ID, Packs: []BatteryAssignment{
+		{BatteryPackID: first.ID, Sequence: 1}, {BatteryPackID: second.ID, Sequence: 2},
+	}}); err != nil || !result.Passed {
+		t.Fatalf("preflight check: %+v %v", result, err)
+	}
+
+	record := &model.FlightRecord{FlightNo: "FL-BAT-002", OrderID: order.ID, DroneID: drone.ID, Status: "in_progress"}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create flight record: %v", err)
+	}
+	start := order.StartTime
+	var positions []model.FlightPosition
+	// 第一组电池 20 分钟放电 100% → 40%，速率 3%/分钟，优于额定 30 分钟续航
+	for minute := 0; minute <= 20; minute += 5 {
+		positions = append(positions, model.FlightPosition{FlightRecordID: &record.ID, OrderID: order.ID, DroneID: drone.ID,
+			BatteryLevel: 100 - 3*minute, RecordedAt: start.Add(time.Duration(minute) * time.Minute)})
+	}
+	// 换电后第二组电池 8 分钟放电 98% → 50%，速率 6%/分钟
+	for minute := 0; minute <= 8; minute += 2 {
+		positions = append(positions, model.FlightPosition{FlightRecordID: &record.ID, OrderID: order.ID, DroneID: drone.ID,
+			BatteryLevel: 98 - 6*minute, RecordedAt: start.Add(time.Duration(25+minute) * time.Minute)})
+	}
+	if err := db.Create(&positions).Error; err != nil {
+		t.Fatalf("create positions: %v", err)
+	}
+
+	now := time.Now()
+	if result, _ := batteries.RecordFlightUsage(now); result.Flights != 0 {
+		t.Fatalf("expected in-progress flight skipped, got %+v", result)
+	}
+	db.Model(record).Update("status", "completed")
+	result, err := batteries.RecordFlightUsage(now)
+	if err != nil {
+		t.Fatalf("record flight usage: %v", err)
+	}
+	if result.Flights != 1 || result.Packs != 2 || result.Retired != 1 {
+		t.Fatalf("expected both packs recorded and degraded pack retired, got %+v", result)
+	}
+
+	var storedFirst, storedSecond model.BatteryPack
+	db.First(&storedFirst, first.ID)
+	db.First(&storedSecond, second.ID)
+	if storedFirst.CycleCount != 0.6 || storedFirst.HealthPercent != 100 || storedFirst.FlightCount != 1 || storedFirst.Status != "active" {
+		t.Fatalf("expected first pack 0.6 cycles at full health, got %+v", storedFirst)
+	}
+	if storedSecond.CycleCount != 0.48 || storedSecond.HealthPercent >= 70 || storedSecond.Status != "retired" {
+		t.Fatalf("expected second pack degraded below retirement threshold, got %+v", storedSecond)
+	}
+	if got := pusher.usersFor("battery_retired"); !reflect.DeepEqual(got, []int64{31}) {
+		t.Fatalf("expected owner notified of retirement, got %v", got)
+	}
+	if result, _ := batteries.RecordFlightUsage(now.Add(time.Minute)); result.Flights != 0 {
+		t.Fatalf("expected flight recorded once, got %+v", result)
+	}
+}
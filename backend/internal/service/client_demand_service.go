@@ -470,6 +470,17 @@ func (s *ClientService) SelectProvider(userID, demandID, quoteID int64) (*Select
 	return result, nil
 }
 
+// QuoteDirectSupplyOrder 直达下单前预览分项报价与当前供需溢价
+func (s *ClientService) QuoteDirectSupplyOrder(userID, supplyID int64, input *DirectOrderInput) (*PricingResult, error) {
+	if s.orderService == nil {
+		return nil, errors.New("直达下单服务未初始化")
+	}
+	if userID <= 0 {
+		return nil, errors.New("用户不存在")
+	}
+	return s.orderService.QuoteDirectSupplyOrder(supplyID, input)
+}
+
 func (s *ClientService) CreateDirectSupplyOrder(userID, supplyID int64, input *DirectOrderInput) (*DirectOrderResult, error) {
 	if s.orderService == nil {
 		return nil, errors.New("直达下单服务未初始化")
@@ -0,0 +1,650 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+const (
+	CouponDiscountFixed      = "fixed"
+	CouponDiscountPercentage = "percentage"
+
+	CouponTriggerManual   = "manual"
+	CouponTriggerNewUser  = "new_user"
+	CouponTriggerReferral = "referral"
+
+	CouponFundedByPlatform = "platform"
+	CouponFundedByProvider = "provider"
+
+	// couponLockTimeout 券锁定在订单上后未完成支付的超时时间，超时后退回券包
+	couponLockTimeout = 30 * time.Minute
+)
+
+// CouponTemplateInput 创建优惠券模板参数
+type CouponTemplateInput struct {
+	Code           string     `json:"code" binding:"required"`
+	Name           string     `json:"name" binding:"required"`
+	Description    string     `json:"description"`
+	DiscountType   string     `json:"discount_type" binding:"required"`
+	DiscountAmount int64      `json:"discount_amount"`
+	DiscountRate   float64    `json:"discount_rate"`
+	MaxDiscount    int64      `json:"max_discount"`
+	MinOrderAmount int64      `json:"min_order_amount"`
+	FirstOrderOnly bool       `json:"first_order_only"`
+	ServiceTypes   []string   `json:"service_types"`
+	Cities         []string   `json:"cities"`
+	FundedBy       string     `json:"funded_by"`
+	IssueTrigger   string     `json:"issue_trigger"`
+	TotalQuantity  int        `json:"total_quantity"`
+	PerUserLimit   int        `json:"per_user_limit"`
+	ValidDays      int        `json:"valid_days"`
+	ValidFrom      *time.Time `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+}
+
+// CouponIssueResult 批量发放结果
+type CouponIssueResult struct {
+	Issued  int     `json:"issued"`
+	Skipped []int64 `json:"skipped"` // 超出限领或库存不足而未发放的用户
+}
+
+// OrderCouponOption 订单可选优惠券及抵扣试算
+type OrderCouponOption struct {
+	Coupon   *model.UserCoupon `json:"coupon"`
+	Discount int64             `json:"discount"`
+	Usable   bool              `json:"usable"`
+	Reason   string            `json:"reason,omitempty"`
+	Applied  bool              `json:"applied"`
+}
+
+type CouponService struct {
+	couponRepo  *repository.CouponRepo
+	orderRepo   *repository.OrderRepo
+	paymentRepo *repository.PaymentRepo
+	userRepo    *repository.UserRepo
+	logger      *zap.Logger
+}
+
+func NewCouponService(couponRepo *repository.CouponRepo, orderRepo *repository.OrderRepo, paymentRepo *repository.PaymentRepo, userRepo *repository.UserRepo, logger *zap.Logger) *CouponService {
+	return &CouponService{couponRepo: couponRepo, orderRepo: orderRepo, paymentRepo: paymentRepo, userRepo: userRepo, logger: logger}
+}
+
+// ========== 模板管理 ==========
+
+func (s *CouponService) CreateTemplate(input *CouponTemplateInput, adminID int64) (*model.CouponTemplate, error) {
+	if input == nil {
+		return nil, errors.New("参数不能为空")
+	}
+	template := &model.CouponTemplate{
+		Code:           strings.TrimSpace(input.Code),
+		Name:           strings.TrimSpace(input.Name),
+		Description:    input.Description,
+		DiscountType:   input.DiscountType,
+		DiscountAmount: input.DiscountAmount,
+		DiscountRate:   input.DiscountRate,
+		MaxDiscount:    input.MaxDiscount,
+		MinOrderAmount: input.MinOrderAmount,
+		FirstOrderOnly: input.FirstOrderOnly,
+		FundedBy:       firstNonEmpty(input.FundedBy, CouponFundedByPlatform),
+		IssueTrigger:   firstNonEmpty(input.IssueTrigger, CouponTriggerManual),
+		TotalQuantity:  input.TotalQuantity,
+		PerUserLimit:   input.PerUserLimit,
+		ValidDays:      input.ValidDays,
+		ValidFrom:      input.ValidFrom,
+		ValidUntil:     input.ValidUntil,
+		Status:         "active",
+		CreatedBy:      adminID,
+	}
+	if template.PerUserLimit <= 0 {
+		template.PerUserLimit = 1
+	}
+	if err := validateCouponTemplate(template); err != nil {
+		return nil, err
+	}
+	if len(input.ServiceTypes) > 0 {
+		data, _ := json.Marshal(input.ServiceTypes)
+		template.ServiceTypes = model.JSON(data)
+	}
+	if len(input.Cities) > 0 {
+		data, _ := json.Marshal(input.Cities)
+		template.Cities = model.JSON(data)
+	}
+	if err := s.couponRepo.CreateTemplate(template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func validateCouponTemplate(t *model.CouponTemplate) error {
+	if t.Code == "" || t.Name == "" {
+		return errors.New("请填写模板编码与名称")
+	}
+	switch t.DiscountType {
+	case CouponDiscountFixed:
+		if t.DiscountAmount <= 0 {
+			return errors.New("满减金额须大于0")
+		}
+	case CouponDiscountPercentage:
+		if t.DiscountRate <= 0 || t.DiscountRate >= 1 {
+			return errors.New("折扣比例须在0到1之间")
+		}
+		if t.MaxDiscount < 0 {
+			return errors.New("折扣封顶金额不能为负数")
+		}
+	default:
+		return fmt.Errorf("未知的优惠类型: %s", t.DiscountType)
+	}
+	if !containsString([]string{CouponTriggerManual, CouponTriggerNewUser, CouponTriggerReferral}, t.IssueTrigger) {
+		return fmt.Errorf("未知的发放场景: %s", t.IssueTrigger)
+	}
+	if t.FundedBy != CouponFundedByPlatform && t.FundedBy != CouponFundedByProvider {
+		return fmt.Errorf("未知的出资方: %s", t.FundedBy)
+	}
+	if t.MinOrderAmount < 0 || t.TotalQuantity < 0 || t.ValidDays < 0 {
+		return errors.New("门槛、库存与有效天数不能为负数")
+	}
+	if t.ValidFrom != nil && t.ValidUntil != nil && !t.ValidUntil.After(*t.ValidFrom) {
+		return errors.New("有效期结束时间须晚于开始时间")
+	}
+	return nil
+}
+
+func (s *CouponService) UpdateTemplateStatus(id int64, status string) (*model.CouponTemplate, error) {
+	if status != "active" && status != "disabled" {
+		return nil, fmt.Errorf("未知的模板状态: %s", status)
+	}
+	if _, err := s.couponRepo.GetTemplate(id); err != nil {
+		return nil, errors.New("优惠券模板不存在")
+	}
+	if err := s.couponRepo.UpdateTemplateStatus(id, status); err != nil {
+		return nil, err
+	}
+	return s.couponRepo.GetTemplate(id)
+}
+
+func (s *CouponService) ListTemplates(status, trigger string, page, pageSize int) ([]model.CouponTemplate, int64, error) {
+	return s.couponRepo.ListTemplates(status, trigger, page, pageSize)
+}
+
+// ========== 发放 ==========
+
+// IssueBatch 管理员向指定用户批量发券，超出每人限领或库存不足的用户跳过
+func (s *CouponService) IssueBatch(templateID int64, userIDs []int64, adminID int64) (*CouponIssueResult, error) {
+	template, err := s.couponRepo.GetTemplate(templateID)
+	if err != nil {
+		return nil, errors.New("优惠券模板不存在")
+	}
+	if len(userIDs) == 0 {
+		return nil, errors.New("请选择发放用户")
+	}
+
+	result := &CouponIssueResult{Skipped: []int64{}}
+	for _, userID := range userIDs {
+		count, err := s.couponRepo.CountUserCoupons(template.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		issueKey := fmt.Sprintf("%s:%d:%d:%d", CouponTriggerManual, template.ID, userID, count+1)
+		coupon, err := s.issue(template, userID, "admin_batch", adminID, issueKey, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if coupon == nil {
+			result.Skipped = append(result.Skipped, userID)
+			continue
+		}
+		result.Issued++
+	}
+	return result, nil
+}
+
+// IssueForNewUser 注册后发放新人券，返回发放张数
+func (s *CouponService) IssueForNewUser(userID int64) (int, error) {
+	return s.issueByTrigger(CouponTriggerNewUser, userID, userID)
+}
+
+// OnOrderPaid 被邀请人首单支付后向邀请人发放邀请奖励券
+func (s *CouponService) OnOrderPaid(order *model.Order) {
+	if order == nil || s.userRepo == nil {
+		return
+	}
+	clientUserID := orderClientUserID(order)
+	if clientUserID <= 0 {
+		return
+	}
+	if paid, err := s.orderRepo.CountPaidOrdersByClient(clientUserID, order.ID); err != nil || paid > 0 {
+		return
+	}
+	user, err := s.userRepo.GetByID(clientUserID)
+	if err != nil || user.ReferrerID <= 0 {
+		return
+	}
+	if _, err := s.issueByTrigger(CouponTriggerReferral, user.ReferrerID, clientUserID); err != nil && s.logger != nil {
+		s.logger.Warn("issue referral coupons failed", zap.Int64("referrer_id", user.ReferrerID), zap.Int64("user_id", clientUserID), zap.Error(err))
+	}
+}
+
+// issueByTrigger 按场景发放全部生效模板，幂等键保证同一来源只发一次
+func (s *CouponService) issueByTrigger(trigger string, userID, sourceID int64) (int, error) {
+	templates, err := s.couponRepo.ListActiveTemplatesByTrigger(trigger)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	issued := 0
+	for i := range templates {
+		if templates[i].ValidUntil != nil && !templates[i].ValidUntil.After(now) {
+			continue
+		}
+		issueKey := fmt.Sprintf("%s:%d:%d", trigger, templates[i].ID, sourceID)
+		coupon, err := s.issue(&templates[i], userID, trigger, sourceID, issueKey, now)
+		if err != nil {
+			return issued, err
+		}
+		if coupon != nil {
+			issued++
+		}
+	}
+	return issued, nil
+}
+
+// issue 发放一张券；已发放过、超出限领或库存不足时返回 nil
+func (s *CouponService) issue(template *model.CouponTemplate, userID int64, source string, sourceID int64, issueKey string, now time.Time) (*model.UserCoupon, error) {
+	if template.Status != "active" {
+		return nil, errors.New("优惠券模板已停用")
+	}
+	if template.ValidUntil != nil && !template.ValidUntil.After(now) {
+		return nil, errors.New("优惠券活动已结束")
+	}
+	if exists, err := s.couponRepo.ExistsIssueKey(issueKey); err != nil || exists {
+		return nil, err
+	}
+
+	validFrom, expiresAt := couponValidity(template, now)
+	coupon := &model.UserCoupon{
+		TemplateID:  template.ID,
+		UserID:      userID,
+		IssueKey:    issueKey,
+		IssueSource: source,
+		SourceID:    sourceID,
+		Status:      "available",
+		ValidFrom:   validFrom,
+		ExpiresAt:   expiresAt,
+	}
+	issued := false
+	err := s.couponRepo.DB().Transaction(func(tx *gorm.DB) error {
+		couponRepo := repository.NewCouponRepo(tx)
+		count, err := couponRepo.CountUserCoupons(template.ID, userID)
+		if err != nil || count >= int64(template.PerUserLimit) {
+			return err
+		}
+		reserved, err := couponRepo.ReserveQuantity(template.ID, 1)
+		if err != nil || !reserved {
+			return err
+		}
+		if err := couponRepo.CreateUserCoupon(coupon); err != nil {
+			return err
+		}
+		issued = true
+		return nil
+	})
+	if err != nil || !issued {
+		return nil, err
+	}
+	coupon.Template = template
+	return coupon, nil
+}
+
+func couponValidity(template *model.CouponTemplate, now time.Time) (*time.Time, *time.Time) {
+	validFrom := now
+	if template.ValidFrom != nil && template.ValidFrom.After(now) {
+		validFrom = *template.ValidFrom
+	}
+	var expiresAt *time.Time
+	if template.ValidDays > 0 {
+		expires := validFrom.AddDate(0, 0, template.ValidDays)
+		expiresAt = &expires
+	}
+	if template.ValidUntil != nil && (expiresAt == nil || template.ValidUntil.Before(*expiresAt)) {
+		expires := *template.ValidUntil
+		expiresAt = &expires
+	}
+	return &validFrom, expiresAt
+}
+
+// ========== 券包与下单使用 ==========
+
+func (s *CouponService) ListMyCoupons(userID int64, status string, page, pageSize int) ([]model.UserCoupon, int64, error) {
+	return s.couponRepo.ListByUser(userID, status, page, pageSize)
+}
+
+// ListOrderCoupons 订单支付前可选的优惠券，逐张试算抵扣金额并说明不可用原因
+func (s *CouponService) ListOrderCoupons(orderID, userID int64) ([]OrderCouponOption, error) {
+	order, err := s.payableOrder(orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	coupons, err := s.couponRepo.ListUsable(userID, order.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]OrderCouponOption, 0, len(coupons))
+	for i := range coupons {
+		option := OrderCouponOption{Coupon: &coupons[i], Applied: coupons[i].ID == order.UserCouponID}
+		discount, err := s.evaluate(&coupons[i], order, now)
+		if err != nil {
+			option.Reason = err.Error()
+		} else {
+			option.Usable = true
+			option.Discount = discount
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// ApplyOrderCoupon 支付前为订单选用优惠券：锁定券并按出资方重算平台佣金与机主应得
+func (s *CouponService) ApplyOrderCoupon(orderID, userID, couponID int64) (*model.Order, error) {
+	order, err := s.payableOrder(orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	coupon, err := s.couponRepo.GetUserCoupon(couponID)
+	if err != nil {
+		return nil, errors.New("优惠券不存在")
+	}
+	if coupon.UserID != userID {
+		return nil, errors.New("无权使用该优惠券")
+	}
+	now := time.Now()
+	discount, err := s.evaluate(coupon, order, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.couponRepo.DB().Transaction(func(tx *gorm.DB) error {
+		couponRepo := repository.NewCouponRepo(tx)
+		if order.UserCouponID > 0 && order.UserCouponID != coupon.ID {
+			if _, err := couponRepo.Release(order.UserCouponID, order.ID, "available", now); err != nil {
+				return err
+			}
+		}
+		locked, err := couponRepo.Lock(coupon.ID, order.ID, discount, now)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			return errors.New("优惠券已被其他订单占用")
+		}
+		return repository.NewOrderRepo(tx).UpdateFields(order.ID, couponOrderFields(order, coupon.ID, discount, coupon.Template.FundedBy))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.orderRepo.GetByID(order.ID)
+}
+
+// RemoveOrderCoupon 支付前取消使用优惠券，券退回券包
+func (s *CouponService) RemoveOrderCoupon(orderID, userID int64) (*model.Order, error) {
+	order, err := s.payableOrder(orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserCouponID == 0 {
+		return order, nil
+	}
+	err = s.couponRepo.DB().Transaction(func(tx *gorm.DB) error {
+		if _, err := repository.NewCouponRepo(tx).Release(order.UserCouponID, order.ID, "available", time.Now()); err != nil {
+			return err
+		}
+		return repository.NewOrderRepo(tx).UpdateFields(order.ID, couponOrderFields(order, 0, 0, ""))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.orderRepo.GetByID(order.ID)
+}
+
+// payableOrder 校验订单属于客户且处于待支付阶段；已有处理中的支付单时金额已锁定，不允许再换券
+func (s *CouponService) payableOrder(orderID, userID int64) (*model.Order, error) {
+	order, err := s.orderRepo.GetByID(orderID)
+	if err != nil {
+		return nil, errors.New("订单不存在")
+	}
+	if order.ClientUserID != userID && order.RenterID != userID {
+		return nil, errors.New("无权操作此订单")
+	}
+	if order.PaidAt != nil || (order.Status != "pending_payment" && order.Status != "accepted") {
+		return nil, errors.New("订单当前状态不可使用优惠券")
+	}
+	pending, err := s.hasPendingPayment(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, errors.New("订单已有处理中的支付单，无法更换优惠券")
+	}
+	return order, nil
+}
+
+// evaluate 校验优惠券是否适用于订单并返回抵扣金额
+func (s *CouponService) evaluate(coupon *model.UserCoupon, order *model.Order, now time.Time) (int64, error) {
+	template := coupon.Template
+	if template == nil {
+		return 0, errors.New("优惠券模板不存在")
+	}
+	if template.Status != "active" {
+		return 0, errors.New("优惠券活动已停用")
+	}
+	if coupon.Status != "available" && !(coupon.Status == "locked" && coupon.OrderID == order.ID) {
+		return 0, errors.New("优惠券不可用")
+	}
+	if coupon.ValidFrom != nil && coupon.ValidFrom.After(now) {
+		return 0, errors.New("优惠券尚未生效")
+	}
+	if coupon.ExpiresAt != nil && !coupon.ExpiresAt.After(now) {
+		return 0, errors.New("优惠券已过期")
+	}
+	if order.TotalAmount < template.MinOrderAmount {
+		return 0, fmt.Errorf("订单满%.2f元可用", float64(template.MinOrderAmount)/100)
+	}
+	if serviceTypes := couponScope(template.ServiceTypes); len(serviceTypes) > 0 && !containsString(serviceTypes, order.ServiceType) {
+		return 0, errors.New("该优惠券不适用于当前服务类型")
+	}
+	if cities := couponScope(template.Cities); len(cities) > 0 && !containsString(cities, s.orderRepo.ResolveCity(order)) {
+		return 0, errors.New("该优惠券不适用于当前城市")
+	}
+	if template.FirstOrderOnly {
+		paid, err := s.orderRepo.CountPaidOrdersByClient(orderClientUserID(order), order.ID)
+		if err != nil {
+			return 0, err
+		}
+		if paid > 0 {
+			return 0, errors.New("该优惠券仅限首单使用")
+		}
+	}
+	discount := couponDiscount(template, order.TotalAmount)
+	if discount <= 0 {
+		return 0, errors.New("优惠券无可抵扣金额")
+	}
+	return discount, nil
+}
+
+func couponScope(raw model.JSON) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var values []string
+	_ = json.Unmarshal(raw, &values)
+	return values
+}
+
+// couponDiscount 按模板计算抵扣金额，订单至少保留1分实付
+func couponDiscount(template *model.CouponTemplate, amount int64) int64 {
+	var discount int64
+	switch template.DiscountType {
+	case CouponDiscountFixed:
+		discount = template.DiscountAmount
+	case CouponDiscountPercentage:
+		discount = rateAmount(amount, template.DiscountRate)
+		if template.MaxDiscount > 0 && discount > template.MaxDiscount {
+			discount = template.MaxDiscount
+		}
+	}
+	if discount > amount-1 {
+		discount = amount - 1
+	}
+	if discount < 0 {
+		return 0
+	}
+	return discount
+}
+
+// couponOrderFields 用券后订单金额字段：平台补贴的券从平台佣金中扣减(最低为零，超出部分由平台补贴)，机主应得不变；
+// 服务方让利的券按抵扣后金额重新计算佣金与机主应得
+func couponOrderFields(order *model.Order, couponID, discount int64, fundedBy string) map[string]interface{} {
+	commission := int64(float64(order.TotalAmount) * order.PlatformCommissionRate / 100)
+	ownerAmount := order.TotalAmount - commission
+	if fundedBy == CouponFundedByProvider {
+		commission = int64(float64(order.TotalAmount-discount) * order.PlatformCommissionRate / 100)
+		ownerAmount = order.TotalAmount - discount - commission
+	} else {
+		commission -= discount
+		if commission < 0 {
+			commission = 0
+		}
+	}
+	return map[string]interface{}{
+		"user_coupon_id":      couponID,
+		"coupon_discount":     discount,
+		"coupon_funded_by":    fundedBy,
+		"platform_commission": commission,
+		"owner_amount":        ownerAmount,
+	}
+}
+
+// redeemForOrder 在支付事务内核销订单锁定的优惠券
+func (s *CouponService) redeemForOrder(db *gorm.DB, order *model.Order, paidAt time.Time) error {
+	if order == nil || order.UserCouponID == 0 {
+		return nil
+	}
+	used, err := s.couponRepoFor(db).MarkUsed(order.UserCouponID, order.ID, paidAt)
+	if err != nil {
+		return err
+	}
+	if !used && s.logger != nil {
+		s.logger.Warn("order coupon not locked at payment", zap.Int64("order_id", order.ID), zap.Int64("user_coupon_id", order.UserCouponID))
+	}
+	return nil
+}
+
+// releaseForOrder 在取消事务内释放订单占用的优惠券；已过期的券不再退回可用
+func (s *CouponService) releaseForOrder(db *gorm.DB, order *model.Order, now time.Time) error {
+	if order == nil || order.UserCouponID == 0 {
+		return nil
+	}
+	couponRepo := s.couponRepoFor(db)
+	coupon, err := couponRepo.GetUserCoupon(order.UserCouponID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	status := "available"
+	if coupon.ExpiresAt != nil && !coupon.ExpiresAt.After(now) {
+		status = "expired"
+	}
+	_, err = couponRepo.Release(coupon.ID, order.ID, status, now)
+	return err
+}
+
+func (s *CouponService) couponRepoFor(db *gorm.DB) *repository.CouponRepo {
+	if db == nil {
+		return s.couponRepo
+	}
+	return repository.NewCouponRepo(db)
+}
+
+// ExpireCoupons 定时释放支付超时订单锁定的券，并将过期未使用的券置为已过期
+func (s *CouponService) ExpireCoupons(now time.Time, limit int) (int, error) {
+	released, err := s.releaseStaleLocks(now, limit)
+	if err != nil {
+		return released, err
+	}
+	expired, err := s.couponRepo.ExpireOverdue(now, limit)
+	return released + int(expired), err
+}
+
+// releaseStaleLocks 释放锁定超时或已过期、订单仍未支付的券，订单金额恢复为券前金额；有处理中支付单的订单跳过
+func (s *CouponService) releaseStaleLocks(now time.Time, limit int) (int, error) {
+	coupons, err := s.couponRepo.ListStaleLocks(now.Add(-couponLockTimeout), now, limit)
+	if err != nil {
+		return 0, err
+	}
+	released := 0
+	for i := range coupons {
+		coupon := &coupons[i]
+		order, err := s.orderRepo.GetByID(coupon.OrderID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return released, err
+		}
+		if order != nil && order.ID > 0 {
+			if order.PaidAt != nil {
+				continue
+			}
+			pending, err := s.hasPendingPayment(order.ID)
+			if err != nil {
+				return released, err
+			}
+			if pending {
+				continue
+			}
+		}
+		status := "available"
+		if coupon.ExpiresAt != nil && !coupon.ExpiresAt.After(now) {
+			status = "expired"
+		}
+		err = s.couponRepo.DB().Transaction(func(tx *gorm.DB) error {
+			ok, err := repository.NewCouponRepo(tx).Release(coupon.ID, coupon.OrderID, status, now)
+			if err != nil || !ok {
+				return err
+			}
+			released++
+			if order == nil || order.UserCouponID != coupon.ID {
+				return nil
+			}
+			return repository.NewOrderRepo(tx).UpdateFields(order.ID, couponOrderFields(order, 0, 0, ""))
+		})
+		if err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
+func (s *CouponService) hasPendingPayment(orderID int64) (bool, error) {
+	if s.paymentRepo == nil {
+		return false, nil
+	}
+	payments, err := s.paymentRepo.GetByOrderID(orderID)
+	if err != nil {
+		return false, err
+	}
+	for _, payment := range payments {
+		if payment.Status == "pending" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
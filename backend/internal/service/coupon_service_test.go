@@ -0,0 +1,295 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestCouponRedemptionFlowsIntoCommissionAndSettlement(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.User{}, &model.Order{}, &model.Payment{}, &model.CouponTemplate{}, &model.UserCoupon{},
+		&model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{}, &model.PricingConfig{},
+		&model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	coupons := NewCouponService(repository.NewCouponRepo(db), repository.NewOrderRepo(db), repository.NewPaymentRepo(db), repository.NewUserRepo(db), zap.NewNop())
+	template, err := coupons.CreateTemplate(&CouponTemplateInput{
+		Code: "SUMMER20", Name: "夏季八折券", DiscountType: CouponDiscountPercentage,
+		DiscountRate: 0.2, MaxDiscount: 5000, ServiceTypes: []string{"cargo"}, ValidDays: 7,
+	}, 1)
+	if err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	result, err := coupons.IssueBatch(template.ID, []int64{31}, 1)
+	if err != nil || result.Issued != 1 {
+		t.Fatalf("issue batch: %+v %v", result, err)
+	}
+	if again, _ := coupons.IssueBatch(template.ID, []int64{31}, 1); again.Issued != 0 || len(again.Skipped) != 1 {
+		t.Fatalf("expected per-user limit to skip second issue, got %+v", again)
+	}
+	wallet, _, _ := coupons.ListMyCoupons(31, "available", 1, 10)
+	if len(wallet) != 1 {
+		t.Fatalf("expected one coupon in wallet, got %d", len(wallet))
+	}
+
+	order := &model.Order{
+		OrderNo: "ORD_CPN_001", OrderType: "cargo", ServiceType: "cargo", ClientUserID: 31, RenterID: 31, OwnerID: 21, ExecutorPilotUserID: 11,
+		TotalAmount: 100000, PlatformCommissionRate: 10, PlatformCommission: 10000, OwnerAmount: 90000, Status: "pending_payment",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	order, err = coupons.ApplyOrderCoupon(order.ID, 31, wallet[0].ID)
+	if err != nil {
+		t.Fatalf("apply coupon: %v", err)
+	}
+	// 20% 折扣封顶 50 元，由平台补贴：佣金减少，机主应得不变
+	if order.CouponDiscount != 5000 || order.PayableAmount() != 95000 {
+		t.Fatalf("unexpected discount %d payable %d", order.CouponDiscount, order.PayableAmount())
+	}
+	if order.PlatformCommission != 5000 || order.OwnerAmount != 90000 {
+		t.Fatalf("unexpected commission %d owner %d", order.PlatformCommission, order.OwnerAmount)
+	}
+	other := &model.Order{
+		OrderNo: "ORD_CPN_002", OrderType: "cargo", ServiceType: "cargo", ClientUserID: 31, RenterID: 31, OwnerID: 21, ExecutorPilotUserID: 11,
+		TotalAmount: 100000, PlatformCommissionRate: 10, PlatformCommission: 10000, OwnerAmount: 90000, Status: "pending_payment",
+	}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := coupons.ApplyOrderCoupon(other.ID, 31, wallet[0].ID); err == nil {
+		t.Fatal("expected locked coupon to be rejected on another order")
+	}
+
+	paidAt := time.Now().Add(-100 * time.Hour)
+	if err := coupons.redeemForOrder(db, order, paidAt); err != nil {
+		t.Fatalf("redeem coupon: %v", err)
+	}
+	coupon, _ := repository.NewCouponRepo(db).GetUserCoupon(wallet[0].ID)
+	if coupon.Status != "used" || coupon.OrderID != order.ID {
+		t.Fatalf("expected coupon used by order, got %s/%d", coupon.Status, coupon.OrderID)
+	}
+
+	completedAt := time.Now().Add(-96 * time.Hour)
+	db.Model(&model.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{"status": "completed", "paid_at": &paidAt, "completed_at": &completedAt})
+	settlements := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	if _, err := settlements.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	settlement, err := settlements.GetSettlementByOrder(order.ID)
+	if err != nil {
+		t.Fatalf("get settlement: %v", err)
+	}
+	// 平台按券前金额分账并承担抵扣，飞手与机主分成与无券时一致
+	if settlement.FinalAmount != 95000 || settlement.CouponDiscount != 5000 || settlement.PlatformFee != 5000 {
+		t.Fatalf("unexpected settlement final=%d discount=%d platform=%d", settlement.FinalAmount, settlement.CouponDiscount, settlement.PlatformFee)
+	}
+	if settlement.PilotFee+settlement.OwnerFee != 85000 {
+		t.Fatalf("expected participants to share 85000, got %d", settlement.PilotFee+settlement.OwnerFee)
+	}
+}
+
+func TestCouponReleaseAndReferralIssuance(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.User{}, &model.Order{}, &model.Payment{}, &model.CouponTemplate{}, &model.UserCoupon{},
+		&model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{}, &model.PricingConfig{},
+		&model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	coupons := NewCouponService(repository.NewCouponRepo(db), repository.NewOrderRepo(db), repository.NewPaymentRepo(db), repository.NewUserRepo(db), zap.NewNop())
+	if _, err := coupons.CreateTemplate(&CouponTemplateInput{
+		Code: "FIRST30", Name: "首单立减", DiscountType: CouponDiscountFixed, DiscountAmount: 3000,
+		FirstOrderOnly: true, IssueTrigger: CouponTriggerNewUser, FundedBy: CouponFundedByProvider,
+	}, 1); err != nil {
+		t.Fatalf("create new-user template: %v", err)
+	}
+	if _, err := coupons.CreateTemplate(&CouponTemplateInput{
+		Code: "INVITE10", Name: "邀请奖励", DiscountType: CouponDiscountFixed, DiscountAmount: 1000, IssueTrigger: CouponTriggerReferral,
+	}, 1); err != nil {
+		t.Fatalf("create referral template: %v", err)
+	}
+	referrer := &model.User{Phone: "13800000001"}
+	invitee := &model.User{Phone: "13800000002"}
+	db.Create(referrer)
+	invitee.ReferrerID = referrer.ID
+	db.Create(invitee)
+
+	if issued, err := coupons.IssueForNewUser(invitee.ID); err != nil || issued != 1 {
+		t.Fatalf("issue new-user coupon: %d %v", issued, err)
+	}
+	if issued, _ := coupons.IssueForNewUser(invitee.ID); issued != 0 {
+		t.Fatal("expected new-user coupon to be issued once")
+	}
+	wallet, _, _ := coupons.ListMyCoupons(invitee.ID, "", 1, 10)
+	order := &model.Order{
+		OrderNo: "ORD_CPN_101", OrderType: "cargo", ServiceType: "cargo", ClientUserID: invitee.ID, RenterID: invitee.ID, OwnerID: 21, ExecutorPilotUserID: 11,
+		TotalAmount: 100000, PlatformCommissionRate: 10, PlatformCommission: 10000, OwnerAmount: 90000, Status: "pending_payment",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	order, err := coupons.ApplyOrderCoupon(order.ID, invitee.ID, wallet[0].ID)
+	if err != nil {
+		t.Fatalf("apply coupon: %v", err)
+	}
+	// 服务方让利：按抵扣后金额计佣
+	if order.PlatformCommission != 9700 || order.OwnerAmount != 87300 {
+		t.Fatalf("unexpected commission %d owner %d", order.PlatformCommission, order.OwnerAmount)
+	}
+
+	if err := coupons.releaseForOrder(db, order, time.Now()); err != nil {
+		t.Fatalf("release coupon: %v", err)
+	}
+	coupon, _ := repository.NewCouponRepo(db).GetUserCoupon(wallet[0].ID)
+	if coupon.Status != "available" || coupon.OrderID != 0 {
+		t.Fatalf("expected coupon back in wallet, got %s/%d", coupon.Status, coupon.OrderID)
+	}
+
+	paidAt := time.Now()
+	db.Model(&model.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{"status": "paid", "paid_at": &paidAt})
+	coupons.OnOrderPaid(order)
+	coupons.OnOrderPaid(order)
+	referrerCoupons, total, _ := coupons.ListMyCoupons(referrer.ID, "", 1, 10)
+	if total != 1 || referrerCoupons[0].IssueSource != CouponTriggerReferral {
+		t.Fatalf("expected one referral coupon for referrer, got %d", total)
+	}
+
+	// 首单已支付后，首单券不再适用
+	next := &model.Order{
+		OrderNo: "ORD_CPN_102", OrderType: "cargo", ServiceType: "cargo", ClientUserID: invitee.ID, RenterID: invitee.ID, OwnerID: 21, ExecutorPilotUserID: 11,
+		TotalAmount: 100000, PlatformCommissionRate: 10, PlatformCommission: 10000, OwnerAmount: 90000, Status: "pending_payment",
+	}
+	if err := db.Create(next).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := coupons.ApplyOrderCoupon(next.ID, invitee.ID, wallet[0].ID); err == nil {
+		t.Fatal("expected first-order coupon to be rejected after first paid order")
+	}
+}
+
+func TestPlatformCouponBeyondPlatformFeeIsBookedAsSubsidy(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.User{}, &model.Order{}, &model.Payment{}, &model.CouponTemplate{}, &model.UserCoupon{},
+		&model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{}, &model.PricingConfig{},
+		&model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	coupons := NewCouponService(repository.NewCouponRepo(db), repository.NewOrderRepo(db), repository.NewPaymentRepo(db), repository.NewUserRepo(db), zap.NewNop())
+	template, err := coupons.CreateTemplate(&CouponTemplateInput{
+		Code: "BIG150", Name: "立减150元", DiscountType: CouponDiscountFixed, DiscountAmount: 15000,
+	}, 1)
+	if err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	if result, err := coupons.IssueBatch(template.ID, []int64{31}, 1); err != nil || result.Issued != 1 {
+		t.Fatalf("issue batch: %+v %v", result, err)
+	}
+	wallet, _, _ := coupons.ListMyCoupons(31, "available", 1, 10)
+	order := &model.Order{
+		OrderNo: "ORD_CPN_201", OrderType: "cargo", ServiceType: "cargo", ClientUserID: 31, RenterID: 31, OwnerID: 21, ExecutorPilotUserID: 11,
+		TotalAmount: 100000, PlatformCommissionRate: 10, PlatformCommission: 10000, OwnerAmount: 90000, Status: "pending_payment",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	order, err = coupons.ApplyOrderCoupon(order.ID, 31, wallet[0].ID)
+	if err != nil {
+		t.Fatalf("apply coupon: %v", err)
+	}
+	// 券额超过佣金：佣金记为零，机主应得不变
+	if order.PlatformCommission != 0 || order.OwnerAmount != 90000 {
+		t.Fatalf("unexpected commission %d owner %d", order.PlatformCommission, order.OwnerAmount)
+	}
+
+	paidAt := time.Now().Add(-100 * time.Hour)
+	if err := coupons.redeemForOrder(db, order, paidAt); err != nil {
+		t.Fatalf("redeem coupon: %v", err)
+	}
+	completedAt := time.Now().Add(-96 * time.Hour)
+	db.Model(&model.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{"status": "completed", "paid_at": &paidAt, "completed_at": &completedAt})
+	settlements := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	if _, err := settlements.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	settlement, err := settlements.GetSettlementByOrder(order.ID)
+	if err != nil {
+		t.Fatalf("get settlement: %v", err)
+	}
+	if settlement.PlatformFee != 0 || settlement.PlatformSubsidy != 5000 || settlement.PilotFee+settlement.OwnerFee != 85000 {
+		t.Fatalf("unexpected settlement platform=%d subsidy=%d participants=%d", settlement.PlatformFee, settlement.PlatformSubsidy, settlement.PilotFee+settlement.OwnerFee)
+	}
+	if settlement.Status != "settled" {
+		t.Fatalf("expected settled settlement, got %s", settlement.Status)
+	}
+	ledger := repository.NewLedgerRepo(db)
+	if balance, _ := ledger.GetAccountBalance(model.LedgerAccountPlatform, 0, model.LedgerBucketAvailable); balance != 0 {
+		t.Fatalf("expected no platform income, got %d", balance)
+	}
+	if balance, _ := ledger.GetAccountBalance(model.LedgerAccountSubsidy, 0, model.LedgerBucketAvailable); balance != -5000 {
+		t.Fatalf("expected subsidy expense -5000, got %d", balance)
+	}
+}
+
+func TestStaleCouponLockIsReleasedFromUnpaidOrder(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.User{}, &model.Order{}, &model.Payment{}, &model.CouponTemplate{}, &model.UserCoupon{},
+		&model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{}, &model.PricingConfig{},
+		&model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	coupons := NewCouponService(repository.NewCouponRepo(db), repository.NewOrderRepo(db), repository.NewPaymentRepo(db), repository.NewUserRepo(db), zap.NewNop())
+	template, err := coupons.CreateTemplate(&CouponTemplateInput{
+		Code: "LOCK20", Name: "立减20元", DiscountType: CouponDiscountFixed, DiscountAmount: 2000,
+	}, 1)
+	if err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	if result, err := coupons.IssueBatch(template.ID, []int64{31, 32}, 1); err != nil || result.Issued != 2 {
+		t.Fatalf("issue batch: %+v %v", result, err)
+	}
+	apply := func(userID int64, orderNo string) (*model.Order, int64) {
+		wallet, _, _ := coupons.ListMyCoupons(userID, "available", 1, 10)
+		order := &model.Order{
+			OrderNo: orderNo, OrderType: "cargo", ServiceType: "cargo", ClientUserID: userID, RenterID: userID, OwnerID: 21, ExecutorPilotUserID: 11,
+			TotalAmount: 100000, PlatformCommissionRate: 10, PlatformCommission: 10000, OwnerAmount: 90000, Status: "pending_payment",
+		}
+		if err := db.Create(order).Error; err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+		order, err := coupons.ApplyOrderCoupon(order.ID, userID, wallet[0].ID)
+		if err != nil {
+			t.Fatalf("apply coupon: %v", err)
+		}
+		return order, wallet[0].ID
+	}
+	unpaid, unpaidCoupon := apply(31, "ORD_CPN_301")
+	paying, payingCoupon := apply(32, "ORD_CPN_302")
+	if err := db.Create(&model.Payment{PaymentNo: "PAY_CPN_302", OrderID: paying.ID, UserID: 32, Amount: paying.PayableAmount(), PaymentMethod: "wechat", Status: "pending"}).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	if released, err := coupons.ExpireCoupons(time.Now(), 10); err != nil || released != 0 {
+		t.Fatalf("fresh locks should be kept, released %d %v", released, err)
+	}
+	// 超过支付超时：未付款订单的券退回券包，有处理中支付单的订单保持锁定
+	if released, err := coupons.ExpireCoupons(time.Now().Add(couponLockTimeout+time.Minute), 10); err != nil || released != 1 {
+		t.Fatalf("expected one stale lock released, got %d %v", released, err)
+	}
+	couponRepo := repository.NewCouponRepo(db)
+	if coupon, _ := couponRepo.GetUserCoupon(unpaidCoupon); coupon.Status != "available" || coupon.OrderID != 0 {
+		t.Fatalf("expected coupon back in wallet, got %s/%d", coupon.Status, coupon.OrderID)
+	}
+	if coupon, _ := couponRepo.GetUserCoupon(payingCoupon); coupon.Status != "locked" {
+		t.Fatalf("expected coupon on paying order to stay locked, got %s", coupon.Status)
+	}
+	var reloaded model.Order
+	db.First(&reloaded, unpaid.ID)
+	if reloaded.UserCouponID != 0 || reloaded.CouponDiscount != 0 || reloaded.PlatformCommission != 10000 || reloaded.OwnerAmount != 90000 {
+		t.Fatalf("expected order amounts restored, got %#v", reloaded)
+	}
+}
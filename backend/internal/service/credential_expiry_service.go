@@ -0,0 +1,383 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// 证照主体与证照类型
+const (
+	CredentialSubjectPilot = "pilot"
+	CredentialSubjectDrone = "drone"
+
+	CredentialCAACLicense   = "caac_license"
+	CredentialCriminalCheck = "criminal_check"
+	CredentialHealthCheck   = "health_check"
+	CredentialCertification = "certification"
+	CredentialInsurance     = "insurance"
+	CredentialAirworthiness = "airworthiness"
+	CredentialMaintenance   = "maintenance"
+)
+
+// credentialReminderDays 到期前的提醒档位(天)，由远及近
+var credentialReminderDays = []int{30, 7, 1}
+
+var credentialLabels = map[string]string{
+	CredentialCAACLicense:   "CAAC执照",
+	CredentialCriminalCheck: "无犯罪记录证明",
+	CredentialHealthCheck:   "健康证明",
+	CredentialCertification: "资质证书",
+	CredentialInsurance:     "保险",
+	CredentialAirworthiness: "适航证书",
+	CredentialMaintenance:   "定期维护",
+}
+
+// CredentialExpiryService 飞手与无人机证照到期监控。
+// 到期前按 30/7/1 天分档提醒，到期后将证照置为 expired，并下线飞手接单、暂停无人机供给
+type CredentialExpiryService struct {
+	expiryRepo *repository.CredentialExpiryRepo
+	events     *EventService
+	logger     *zap.Logger
+}
+
+func NewCredentialExpiryService(expiryRepo *repository.CredentialExpiryRepo, logger *zap.Logger) *CredentialExpiryService {
+	return &CredentialExpiryService{expiryRepo: expiryRepo, logger: logger}
+}
+
+func (s *CredentialExpiryService) SetEventService(eventService *EventService) {
+	s.events = eventService
+}
+
+// CredentialExpiryItem 一项即将到期或已到期的证照
+type CredentialExpiryItem struct {
+	SubjectType    string    `json:"subject_type"`
+	SubjectID      int64     `json:"subject_id"`
+	SubjectName    string    `json:"subject_name"`
+	UserID         int64     `json:"user_id"`
+	CredentialType string    `json:"credential_type"`
+	CredentialID   int64     `json:"credential_id,omitempty"`
+	CredentialName string    `json:"credential_name"`
+	ExpireDate     time.Time `json:"expire_date"`
+	DaysLeft       int       `json:"days_left"`
+	Status         string    `json:"status"`
+
+	pilot *model.Pilot
+	drone *model.Drone
+	cert  *model.PilotCertification
+}
+
+// Expired 证照是否已到期
+func (i *CredentialExpiryItem) Expired(now time.Time) bool {
+	return !i.ExpireDate.After(now)
+}
+
+// CredentialExpiryReport 管理端到期报表
+type CredentialExpiryReport struct {
+	GeneratedAt time.Time              `json:"generated_at"`
+	Days        int                    `json:"days"`
+	Expired     int                    `json:"expired"`
+	Expiring    int                    `json:"expiring"`
+	Items       []CredentialExpiryItem `json:"items"`
+}
+
+// CredentialExpiryResult 一次到期检查的汇总
+type CredentialExpiryResult struct {
+	Checked  int `json:"checked"`
+	Reminded int `json:"reminded"`
+	Expired  int `json:"expired"`
+}
+
+// CheckExpiries 发送分档到期提醒，并处理已到期的证照；每个档位和到期处理对同一到期日只执行一次
+func (s *CredentialExpiryService) CheckExpiries(now time.Time) (*CredentialExpiryResult, error) {
+	items, err := s.collect(now, credentialReminderDays[0])
+	if err != nil {
+		return nil, err
+	}
+	result := &CredentialExpiryResult{Checked: len(items)}
+	for i := range items {
+		item := &items[i]
+		if item.Expired(now) {
+			expired, err := s.expire(item)
+			if err != nil {
+				s.logger.Warn("证照到期处理失败", zap.String("subject_type", item.SubjectType), zap.Int64("subject_id", item.SubjectID),
+					zap.String("credential_type", item.CredentialType), zap.Error(err))
+				continue
+			}
+			if expired {
+				result.Expired++
+			}
+			continue
+		}
+		if item.Status == "expired" {
+			continue
+		}
+		stage := credentialReminderStage(item.DaysLeft)
+		if stage == 0 {
+			continue
+		}
+		created, err := s.expiryRepo.CreateNoticeOnce(item.notice(stage))
+		if err != nil {
+			return result, err
+		}
+		if created {
+			s.events.NotifyCredentialExpiry(item, false)
+			result.Reminded++
+		}
+	}
+	return result, nil
+}
+
+// Report 列出 days 天内到期及已到期的证照，按到期日排序
+func (s *CredentialExpiryService) Report(now time.Time, days int, subjectType string) (*CredentialExpiryReport, error) {
+	if days <= 0 {
+		days = credentialReminderDays[0]
+	}
+	items, err := s.collect(now, days)
+	if err != nil {
+		return nil, err
+	}
+	report := &CredentialExpiryReport{GeneratedAt: now, Days: days, Items: make([]CredentialExpiryItem, 0, len(items))}
+	for _, item := range items {
+		if subjectType != "" && item.SubjectType != subjectType {
+			continue
+		}
+		if item.Expired(now) {
+			report.Expired++
+		} else {
+			report.Expiring++
+		}
+		report.Items = append(report.Items, item)
+	}
+	return report, nil
+}
+
+// expire 到期处理：飞手证照置为过期并下线接单，无人机证照置为过期或转入维护并暂停供给。
+// 飞手执行中或无人机出租中时暂缓处理，返回 false 待下次检查
+func (s *CredentialExpiryService) expire(item *CredentialExpiryItem) (bool, error) {
+	notice := item.notice(0)
+	done, err := s.expiryRepo.HasNotice(notice)
+	if err != nil || done {
+		return false, err
+	}
+
+	switch item.SubjectType {
+	case CredentialSubjectPilot:
+		pilot := item.pilot
+		if pilot.AvailabilityStatus == "busy" {
+			return false, nil
+		}
+		fields := map[string]interface{}{}
+		switch item.CredentialType {
+		case CredentialCriminalCheck:
+			fields["criminal_check_status"] = "expired"
+		case CredentialHealthCheck:
+			fields["health_check_status"] = "expired"
+		case CredentialCertification:
+			if err := s.expiryRepo.UpdateCertificationStatus(item.CredentialID, "expired"); err != nil {
+				return false, err
+			}
+			// 仅执照类证书到期时停止接单，培训等证书只标记过期
+			if item.cert.CertType != CredentialCAACLicense {
+				fields = nil
+			}
+		}
+		if fields != nil {
+			if err := s.expiryRepo.PausePilot(pilot, fields); err != nil {
+				return false, err
+			}
+			pilot.AvailabilityStatus = "offline"
+		}
+	case CredentialSubjectDrone:
+		drone := item.drone
+		fields := map[string]interface{}{}
+		switch item.CredentialType {
+		case CredentialInsurance:
+			fields["insurance_verified"] = "expired"
+			drone.InsuranceVerified = "expired"
+		case CredentialAirworthiness:
+			fields["airworthiness_verified"] = "expired"
+			drone.AirworthinessVerified = "expired"
+		case CredentialMaintenance:
+			switch drone.AvailabilityStatus {
+			case "rented":
+				return false, nil
+			case "available":
+				fields["availability_status"] = "maintenance"
+				drone.AvailabilityStatus = "maintenance"
+			}
+		}
+		if len(fields) > 0 {
+			if err := s.expiryRepo.ExpireDrone(drone, fields); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	created, err := s.expiryRepo.CreateNoticeOnce(notice)
+	if err != nil || !created {
+		return false, err
+	}
+	s.events.NotifyCredentialExpiry(item, true)
+	return true, nil
+}
+
+// collect 汇总 now+days 之前到期的全部证照
+func (s *CredentialExpiryService) collect(now time.Time, days int) ([]CredentialExpiryItem, error) {
+	until := now.AddDate(0, 0, days)
+	var items []CredentialExpiryItem
+	add := func(item CredentialExpiryItem, expireAt *time.Time) {
+		if expireAt == nil || expireAt.After(until) {
+			return
+		}
+		item.ExpireDate = *expireAt
+		item.DaysLeft = int(math.Ceil(expireAt.Sub(now).Hours() / 24))
+		if item.CredentialName == "" {
+			item.CredentialName = credentialLabels[item.CredentialType]
+		}
+		items = append(items, item)
+	}
+
+	pilots, err := s.expiryRepo.ListPilotsExpiringBefore(until)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pilots {
+		pilot := &pilots[i]
+		base := CredentialExpiryItem{SubjectType: CredentialSubjectPilot, SubjectID: pilot.ID, SubjectName: pilotDisplayName(pilot), UserID: pilot.UserID, pilot: pilot}
+
+		license := base
+		license.CredentialType, license.Status = CredentialCAACLicense, pilot.VerificationStatus
+		add(license, pilot.CAACLicenseExpireDate)
+		if pilot.CriminalCheckStatus == "approved" || pilot.CriminalCheckStatus == "expired" {
+			criminal := base
+			criminal.CredentialType, criminal.Status = CredentialCriminalCheck, pilot.CriminalCheckStatus
+			add(criminal, pilot.CriminalCheckExpire)
+		}
+		if pilot.HealthCheckStatus == "approved" || pilot.HealthCheckStatus == "expired" {
+			health := base
+			health.CredentialType, health.Status = CredentialHealthCheck, pilot.HealthCheckStatus
+			add(health, pilot.HealthCheckExpire)
+		}
+	}
+
+	certs, err := s.expiryRepo.ListCertificationsExpiringBefore(until)
+	if err != nil {
+		return nil, err
+	}
+	for i := range certs {
+		cert := &certs[i]
+		if cert.Pilot == nil {
+			continue
+		}
+		add(CredentialExpiryItem{
+			SubjectType: CredentialSubjectPilot, SubjectID: cert.PilotID, SubjectName: pilotDisplayName(cert.Pilot), UserID: cert.Pilot.UserID,
+			CredentialType: CredentialCertification, CredentialID: cert.ID, CredentialName: cert.CertName, Status: cert.Status,
+			pilot: cert.Pilot, cert: cert,
+		}, cert.ExpireDate)
+	}
+
+	drones, err := s.expiryRepo.ListDronesExpiringBefore(until)
+	if err != nil {
+		return nil, err
+	}
+	for i := range drones {
+		drone := &drones[i]
+		base := CredentialExpiryItem{SubjectType: CredentialSubjectDrone, SubjectID: drone.ID, SubjectName: droneDisplayName(drone), UserID: drone.OwnerID, drone: drone}
+		if drone.InsuranceVerified == "verified" || drone.InsuranceVerified == "expired" {
+			insurance := base
+			insurance.CredentialType, insurance.Status = CredentialInsurance, drone.InsuranceVerified
+			add(insurance, drone.InsuranceExpireDate)
+		}
+		if drone.AirworthinessVerified == "verified" || drone.AirworthinessVerified == "expired" {
+			airworthiness := base
+			airworthiness.CredentialType, airworthiness.Status = CredentialAirworthiness, drone.AirworthinessVerified
+			add(airworthiness, drone.AirworthinessCertExpire)
+		}
+		maintenance := base
+		maintenance.CredentialType, maintenance.Status = CredentialMaintenance, drone.AvailabilityStatus
+		add(maintenance, drone.NextMaintenanceDate)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].ExpireDate.Before(items[j].ExpireDate) })
+	return items, nil
+}
+
+func (i *CredentialExpiryItem) notice(stage int) *model.CredentialExpiryNotice {
+	return &model.CredentialExpiryNotice{
+		SubjectType:    i.SubjectType,
+		SubjectID:      i.SubjectID,
+		CredentialType: i.CredentialType,
+		CredentialID:   i.CredentialID,
+		ExpireDate:     i.ExpireDate,
+		Stage:          stage,
+		UserID:         i.UserID,
+	}
+}
+
+// credentialReminderStage 剩余天数落入的最近提醒档位，超出最远档位时返回 0
+func credentialReminderStage(daysLeft int) int {
+	stage := 0
+	for _, days := range credentialReminderDays {
+		if daysLeft <= days {
+			stage = days
+		}
+	}
+	return stage
+}
+
+// pilotExpiredCredential 返回飞手已过期的证照名称，为空表示可以上线接单
+// CAAC执照同时检查飞手资料中的到期日与 caac_license 类型的资质证书
+func pilotExpiredCredential(pilot *model.Pilot, certs []model.PilotCertification, now time.Time) string {
+	if pilot == nil {
+		return ""
+	}
+	if pilot.CAACLicenseExpireDate != nil && !pilot.CAACLicenseExpireDate.After(now) {
+		return credentialLabels[CredentialCAACLicense]
+	}
+	// 已换发有效执照时忽略旧的过期证书
+	licenseExpired, licenseValid := false, false
+	for _, cert := range certs {
+		if cert.CertType != CredentialCAACLicense {
+			continue
+		}
+		switch {
+		case cert.Status == "expired" || (cert.Status == "approved" && cert.ExpireDate != nil && !cert.ExpireDate.After(now)):
+			licenseExpired = true
+		case cert.Status == "approved":
+			licenseValid = true
+		}
+	}
+	if licenseExpired && !licenseValid {
+		return credentialLabels[CredentialCAACLicense]
+	}
+	if pilot.CriminalCheckStatus == "expired" {
+		return credentialLabels[CredentialCriminalCheck]
+	}
+	if pilot.HealthCheckStatus == "expired" {
+		return credentialLabels[CredentialHealthCheck]
+	}
+	return ""
+}
+
+func pilotDisplayName(pilot *model.Pilot) string {
+	if pilot.User != nil && pilot.User.Nickname != "" {
+		return pilot.User.Nickname
+	}
+	return fmt.Sprintf("飞手#%d", pilot.ID)
+}
+
+func droneDisplayName(drone *model.Drone) string {
+	name := strings.TrimSpace(fmt.Sprintf("%s %s", drone.Brand, drone.Model))
+	if drone.SerialNumber != "" {
+		name = fmt.Sprintf("%s(%s)", name, drone.SerialNumber)
+	}
+	return name
+}
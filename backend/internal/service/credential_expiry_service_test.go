@@ -0,0 +1,154 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestCredentialExpirySendsGradedRemindersOnce(t *testing.T) {
+	db := newServiceTestDB(t, &model.User{}, &model.Pilot{}, &model.PilotProfile{}, &model.PilotCertification{},
+		&model.Drone{}, &model.OwnerSupply{}, &model.CredentialExpiryNotice{})
+	pusher := &recordingPushService{}
+	expiry := NewCredentialExpiryService(repository.NewCredentialExpiryRepo(db), zap.NewNop())
+	expiry.SetEventService(NewEventService(nil, pusher, zap.NewNop()))
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)
+	licenseExpire := now.AddDate(0, 0, 20)
+	pilot := &model.Pilot{UserID: 11, VerificationStatus: "verified", AvailabilityStatus: "online", CAACLicenseExpireDate: &licenseExpire}
+	if err := db.Create(pilot).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+	insuranceExpire := now.Add(12 * time.Hour)
+	drone := &model.Drone{OwnerID: 31, SerialNumber: "SN-EXP-001", InsuranceVerified: "verified", InsuranceExpireDate: &insuranceExpire}
+	if err := db.Create(drone).Error; err != nil {
+		t.Fatalf("create drone: %v", err)
+	}
+
+	result, err := expiry.CheckExpiries(now)
+	if err != nil {
+		t.Fatalf("check expiries: %v", err)
+	}
+	if result.Reminded != 2 || result.Expired != 0 {
+		t.Fatalf("expected 30-day and 1-day reminders, got %+v", result)
+	}
+	if result, _ := expiry.CheckExpiries(now.Add(time.Hour)); result.Reminded != 0 {
+		t.Fatalf("expected reminders not to repeat within the same stage, got %+v", result)
+	}
+
+	// 剩余 5 天进入 7 天档位
+	if result, _ := expiry.CheckExpiries(now.AddDate(0, 0, 15)); result.Reminded != 1 {
+		t.Fatalf("expected 7-day reminder, got %+v", result)
+	}
+	if got := pusher.usersFor("credential_expiring"); !reflect.DeepEqual(got, []int64{31, 11, 11}) {
+		t.Fatalf("unexpected reminder recipients %v", got)
+	}
+
+	report, err := expiry.Report(now, 30, "")
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if report.Expiring != 2 || report.Items[0].CredentialType != CredentialInsurance || report.Items[1].DaysLeft != 20 {
+		t.Fatalf("expected upcoming expiries ordered by date, got %+v", report)
+	}
+}
+
+func TestCredentialExpiryExpiresAndPausesSupply(t *testing.T) {
+	db := newServiceTestDB(t, &model.User{}, &model.Pilot{}, &model.PilotProfile{}, &model.PilotCertification{},
+		&model.Drone{}, &model.OwnerSupply{}, &model.CredentialExpiryNotice{})
+	pusher := &recordingPushService{}
+	expiry := NewCredentialExpiryService(repository.NewCredentialExpiryRepo(db), zap.NewNop())
+	expiry.SetEventService(NewEventService(nil, pusher, zap.NewNop()))
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	nextYear := now.AddDate(1, 0, 0)
+	pilot := &model.Pilot{UserID: 11, VerificationStatus: "verified", AvailabilityStatus: "online",
+		HealthCheckStatus: "approved", HealthCheckExpire: &yesterday, CAACLicenseExpireDate: &nextYear}
+	if err := db.Create(pilot).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+	if err := db.Create(&model.PilotProfile{UserID: 11, AvailabilityStatus: "online"}).Error; err != nil {
+		t.Fatalf("create pilot profile: %v", err)
+	}
+	drone := &model.Drone{
+		OwnerID: 31, SerialNumber: "SN-EXP-002", MTOWKG: 180, MaxPayloadKG: 60, AvailabilityStatus: "available",
+		CertificationStatus: "approved", UOMVerified: "verified", InsuranceVerified: "verified", AirworthinessVerified: "verified",
+		InsuranceExpireDate: &yesterday, AirworthinessCertExpire: &nextYear,
+	}
+	if err := db.Create(drone).Error; err != nil {
+		t.Fatalf("create drone: %v", err)
+	}
+	supply := &model.OwnerSupply{SupplyNo: "SP-EXP-002", OwnerUserID: 31, DroneID: drone.ID, Title: "重载吊运", Status: "active"}
+	if err := db.Create(supply).Error; err != nil {
+		t.Fatalf("create supply: %v", err)
+	}
+
+	result, err := expiry.CheckExpiries(now)
+	if err != nil {
+		t.Fatalf("check expiries: %v", err)
+	}
+	if result.Expired != 2 {
+		t.Fatalf("expected health check and insurance expired, got %+v", result)
+	}
+
+	var storedPilot model.Pilot
+	db.First(&storedPilot, pilot.ID)
+	if storedPilot.HealthCheckStatus != "expired" || storedPilot.AvailabilityStatus != "offline" {
+		t.Fatalf("expected pilot taken offline with expired health check, got %+v", storedPilot)
+	}
+	if blocked := pilotExpiredCredential(&storedPilot, nil, now); blocked != "健康证明" {
+		t.Fatalf("expected pilot blocked from going online, got %q", blocked)
+	}
+	var storedDrone model.Drone
+	db.First(&storedDrone, drone.ID)
+	var storedSupply model.OwnerSupply
+	db.First(&storedSupply, supply.ID)
+	if storedDrone.InsuranceVerified != "expired" || storedDrone.EligibleForMarketplace() || storedSupply.Status != "paused" {
+		t.Fatalf("expected insurance expired and supply paused, got drone %q supply %q", storedDrone.InsuranceVerified, storedSupply.Status)
+	}
+
+	if result, _ := expiry.CheckExpiries(now.Add(time.Hour)); result.Expired != 0 {
+		t.Fatalf("expected expiry handled once, got %+v", result)
+	}
+	if got := pusher.usersFor("credential_expired"); !reflect.DeepEqual(got, []int64{11, 31}) {
+		t.Fatalf("expected pilot and owner notified once, got %v", got)
+	}
+}
+
+func TestExpiredCAACCertificationBlocksGoingOnline(t *testing.T) {
+	db := newServiceTestDB(t, &model.User{}, &model.Pilot{}, &model.PilotProfile{}, &model.PilotCertification{},
+		&model.Drone{}, &model.OwnerSupply{}, &model.CredentialExpiryNotice{})
+	expiry := NewCredentialExpiryService(repository.NewCredentialExpiryRepo(db), zap.NewNop())
+	expiry.SetEventService(NewEventService(nil, &recordingPushService{}, zap.NewNop()))
+	now := time.Now()
+	pilot := &model.Pilot{UserID: 12, VerificationStatus: "verified", AvailabilityStatus: "online"}
+	if err := db.Create(pilot).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+	expired := now.Add(-time.Hour)
+	cert := &model.PilotCertification{PilotID: pilot.ID, CertType: CredentialCAACLicense, CertName: "CAAC执照", Status: "approved", ExpireDate: &expired}
+	if err := db.Create(cert).Error; err != nil {
+		t.Fatalf("create certification: %v", err)
+	}
+	if _, err := expiry.CheckExpiries(now); err != nil {
+		t.Fatalf("check expiries: %v", err)
+	}
+
+	pilotService := NewPilotService(repository.NewPilotRepo(db), nil, repository.NewRoleProfileRepo(db), nil, nil, nil, nil, nil, zap.NewNop())
+	if err := pilotService.UpdateAvailability(pilot.ID, "online"); err == nil {
+		t.Fatal("expected pilot with expired CAAC certification to be kept offline")
+	}
+
+	// 换发新执照后可以重新上线
+	renewed := now.AddDate(1, 0, 0)
+	if err := db.Create(&model.PilotCertification{PilotID: pilot.ID, CertType: CredentialCAACLicense, CertName: "CAAC执照", Status: "approved", ExpireDate: &renewed}).Error; err != nil {
+		t.Fatalf("create renewed certification: %v", err)
+	}
+	if err := pilotService.UpdateAvailability(pilot.ID, "online"); err != nil {
+		t.Fatalf("expected renewed pilot to go online, got %v", err)
+	}
+}
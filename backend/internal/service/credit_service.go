@@ -1,20 +1,30 @@
 package service
 
 import (
+	"wurenji-backend/internal/config"
 	"wurenji-backend/internal/model"
 	"wurenji-backend/internal/repository"
 	"errors"
+	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type CreditService struct {
 	creditRepo *repository.CreditRepository
+	ledgerRepo *repository.LedgerRepo
+	creditCfg  config.CreditConfig
 }
 
 func NewCreditService(creditRepo *repository.CreditRepository) *CreditService {
 	return &CreditService{creditRepo: creditRepo}
 }
 
+func (s *CreditService) SetLedgerRepo(ledgerRepo *repository.LedgerRepo) {
+	s.ledgerRepo = ledgerRepo
+}
+
 // ============================================================
 // 信用分计算逻辑
 // ============================================================
@@ -283,28 +293,14 @@ func (s *CreditService) ConfirmViolation(violationID int64, confirmedBy int64) e
 		return err
 	}
 
-	// 扣除信用分
-	score, err := s.creditRepo.GetCreditScoreByUserID(violation.UserID)
+	score, err := s.ensureCreditScore(s.creditRepo, violation.UserID, firstNonEmpty(violation.UserType, "pilot"))
 	if err != nil {
 		return err
 	}
 
-	scoreBefore := score.TotalScore
 	score.ViolationCount++
 	score.LastViolationAt = &now
 
-	// 根据违规类型扣除相应维度分数
-	switch score.UserType {
-	case "pilot":
-		score.PilotSafety = max(0, score.PilotSafety-violation.ScoreDeduction)
-	case "owner":
-		score.OwnerFulfillment = max(0, score.OwnerFulfillment-violation.ScoreDeduction)
-	case "client":
-		score.ClientAttitude = max(0, score.ClientAttitude-violation.ScoreDeduction)
-	}
-
-	s.recalculateTotalScore(score)
-
 	// 根据处罚类型执行操作
 	switch violation.Penalty {
 	case "freeze_temp":
@@ -330,18 +326,8 @@ func (s *CreditService) ConfirmViolation(violationID int64, confirmedBy int64) e
 		return err
 	}
 
-	// 记录信用分变动日志
-	return s.creditRepo.CreateCreditScoreLog(&model.CreditScoreLog{
-		UserID:       violation.UserID,
-		ChangeType:   "violation",
-		ChangeReason: "违规处罚: " + violation.ViolationType,
-		Dimension:    "safety",
-		ScoreBefore:  scoreBefore,
-		ScoreAfter:   score.TotalScore,
-		ScoreChange:  -violation.ScoreDeduction,
-		OperatorID:   confirmedBy,
-		OperatorType: "admin",
-	})
+	// 扣分作为信用事件计入，申诉成功时撤销
+	return s.OnViolationConfirmed(violation)
 }
 
 // SubmitAppeal 提交申诉
@@ -397,6 +383,12 @@ func (s *CreditService) restoreCreditAfterAppeal(violation *model.Violation, ope
 		return err
 	}
 
+	// 违规扣分已作为信用事件计入的，撤销事件退回影响分
+	revoked, err := s.revokeCreditEvent(violationCreditEventKey(violation.ID), operatorID, "申诉成功，恢复信用分")
+	if err != nil {
+		return err
+	}
+
 	score, err := s.creditRepo.GetCreditScoreByUserID(violation.UserID)
 	if err != nil {
 		return err
@@ -404,14 +396,16 @@ func (s *CreditService) restoreCreditAfterAppeal(violation *model.Violation, ope
 
 	scoreBefore := score.TotalScore
 
-	// 恢复扣除的分数
-	switch score.UserType {
-	case "pilot":
-		score.PilotSafety = min(300, score.PilotSafety+violation.ScoreDeduction)
-	case "owner":
-		score.OwnerFulfillment = min(250, score.OwnerFulfillment+violation.ScoreDeduction)
-	case "client":
-		score.ClientAttitude = min(300, score.ClientAttitude+violation.ScoreDeduction)
+	// 恢复扣除的分数(早于信用事件的违规记录直接恢复)
+	if !revoked {
+		switch score.UserType {
+		case "pilot":
+			score.PilotSafety = min(300, score.PilotSafety+violation.ScoreDeduction)
+		case "owner":
+			score.OwnerFulfillment = min(250, score.OwnerFulfillment+violation.ScoreDeduction)
+		case "client":
+			score.ClientAttitude = min(300, score.ClientAttitude+violation.ScoreDeduction)
+		}
 	}
 
 	score.ViolationCount = max(0, score.ViolationCount-1)
@@ -433,6 +427,9 @@ func (s *CreditService) restoreCreditAfterAppeal(violation *model.Violation, ope
 	if err := s.creditRepo.UpdateCreditScore(score); err != nil {
 		return err
 	}
+	if revoked {
+		return nil
+	}
 
 	return s.creditRepo.CreateCreditScoreLog(&model.CreditScoreLog{
 		UserID:       violation.UserID,
@@ -450,15 +447,27 @@ func (s *CreditService) restoreCreditAfterAppeal(violation *model.Violation, ope
 // 风控检测
 // ============================================================
 
-// PreOrderRiskCheck 订单前风控检查
+// PreOrderRiskCheck 订单前风控检查，命中风险时记录风控单
 func (s *CreditService) PreOrderRiskCheck(userID int64, orderID int64) (*model.RiskControl, error) {
+	risk, err := s.EvaluatePreOrderRisk(userID, orderID)
+	if err != nil || risk == nil {
+		return risk, err
+	}
+	if err := s.creditRepo.CreateRiskControl(risk); err != nil {
+		return nil, err
+	}
+	return risk, nil
+}
+
+// EvaluatePreOrderRisk 订单前风控评估，只返回命中的风险与建议处置，不记录风控单
+func (s *CreditService) EvaluatePreOrderRisk(userID int64, orderID int64) (*model.RiskControl, error) {
 	// 检查是否黑名单
 	isBlacklisted, err := s.creditRepo.IsUserBlacklisted(userID)
 	if err != nil {
 		return nil, err
 	}
 	if isBlacklisted {
-		return s.createRiskRecord(userID, orderID, "pre", "blacklist", "critical", 100, "用户在黑名单中")
+		return newRiskRecord(userID, orderID, "pre", "blacklist", "critical", 100, "用户在黑名单中")
 	}
 
 	// 检查信用分
@@ -469,24 +478,24 @@ func (s *CreditService) PreOrderRiskCheck(userID int64, orderID int64) (*model.R
 
 	// 信用分过低
 	if score.TotalScore < 400 {
-		return s.createRiskRecord(userID, orderID, "pre", "behavior_abnormal", "high", 70, "信用分过低")
+		return newRiskRecord(userID, orderID, "pre", "behavior_abnormal", "high", 70, "信用分过低")
 	}
 
 	// 频繁取消
 	if score.CancelledOrders > 5 && float64(score.CancelledOrders)/float64(score.TotalOrders) > 0.3 {
-		return s.createRiskRecord(userID, orderID, "pre", "behavior_abnormal", "medium", 50, "取消率过高")
+		return newRiskRecord(userID, orderID, "pre", "behavior_abnormal", "medium", 50, "取消率过高")
 	}
 
 	// 频繁违规
 	if score.ViolationCount >= 3 {
-		return s.createRiskRecord(userID, orderID, "pre", "violation", "high", 60, "违规记录过多")
+		return newRiskRecord(userID, orderID, "pre", "violation", "high", 60, "违规记录过多")
 	}
 
 	return nil, nil
 }
 
-// 创建风控记录
-func (s *CreditService) createRiskRecord(userID, orderID int64, phase, riskType, level string, score int, desc string) (*model.RiskControl, error) {
+// 构造风控记录
+func newRiskRecord(userID, orderID int64, phase, riskType, level string, score int, desc string) (*model.RiskControl, error) {
 	risk := &model.RiskControl{
 		UserID:      userID,
 		OrderID:     orderID,
@@ -510,9 +519,6 @@ func (s *CreditService) createRiskRecord(userID, orderID int64, phase, riskType,
 		risk.Action = "none"
 	}
 
-	if err := s.creditRepo.CreateRiskControl(risk); err != nil {
-		return nil, err
-	}
 	return risk, nil
 }
 
@@ -580,7 +586,11 @@ func (s *CreditService) PayDeposit(depositID int64, paymentID int64, amount int6
 		deposit.Status = "partial"
 	}
 
-	return s.creditRepo.UpdateDeposit(deposit)
+	return s.saveDepositWithLedger(deposit, &model.LedgerEntry{
+		EntryType:      "deposit_pay",
+		IdempotencyKey: fmt.Sprintf("deposit:%d:paid:%d", deposit.ID, deposit.PaidAmount),
+		Description:    fmt.Sprintf("缴纳保证金%s", deposit.DepositNo),
+	}, amount)
 }
 
 // RefundDeposit 退还保证金
@@ -596,7 +606,37 @@ func (s *CreditService) RefundDeposit(depositID int64, reason string) error {
 	deposit.RefundedAt = &now
 	deposit.RefundReason = reason
 
-	return s.creditRepo.UpdateDeposit(deposit)
+	return s.saveDepositWithLedger(deposit, &model.LedgerEntry{
+		EntryType:      "deposit_refund",
+		IdempotencyKey: fmt.Sprintf("deposit:%d:refund", deposit.ID),
+		Description:    fmt.Sprintf("退还保证金%s", deposit.DepositNo),
+	}, -deposit.RefundedAmount)
+}
+
+// saveDepositWithLedger 保存保证金，账本启用时在同一事务内记账: amount 为正表示缴入、为负表示退还
+func (s *CreditService) saveDepositWithLedger(deposit *model.Deposit, entry *model.LedgerEntry, amount int64) error {
+	if s.ledgerRepo == nil || amount == 0 {
+		return s.creditRepo.UpdateDeposit(deposit)
+	}
+
+	accountType := model.LedgerAccountClient
+	switch deposit.UserType {
+	case model.LedgerAccountPilot, model.LedgerAccountOwner:
+		accountType = deposit.UserType
+	}
+	entry.ReferenceType = "deposit"
+	entry.ReferenceID = deposit.ID
+
+	return s.ledgerRepo.DB().Transaction(func(tx *gorm.DB) error {
+		if err := repository.NewCreditRepository(tx).UpdateDeposit(deposit); err != nil {
+			return err
+		}
+		_, err := repository.NewLedgerRepo(tx).Post(entry, []repository.LedgerLine{
+			{AccountType: accountType, UserID: deposit.UserID, Bucket: model.LedgerBucketDeposit, Amount: amount},
+			{AccountType: model.LedgerAccountExternal, Amount: -amount},
+		})
+		return err
+	})
 }
 
 // ============================================================
@@ -639,6 +679,18 @@ func (s *CreditService) GetDepositByUserID(userID int64) (*model.Deposit, error)
 	return s.creditRepo.GetDepositByUserID(userID)
 }
 
+// HasPaidDeposit 用户最近一笔保证金是否已足额缴纳
+func (s *CreditService) HasPaidDeposit(userID int64) (bool, error) {
+	deposit, err := s.creditRepo.GetDepositByUserID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return deposit.Status == "paid", nil
+}
+
 func (s *CreditService) GetCreditStatistics() (map[string]interface{}, error) {
 	return s.creditRepo.GetCreditStatistics()
 }
@@ -0,0 +1,834 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// 信用事件: 订单完成/取消、评价、纠纷判责、违规确认、闯入围栏等业务事件先以幂等键登记为 CreditEvent，
+// 再按规则计入信用维度并写入 CreditScoreLog。事件影响按半衰期衰减，衰减任务逐日回收已计入的影响分；
+// 登记后立即尝试计入，计入失败的事件由定时任务重试
+
+// 信用事件类型
+const (
+	CreditEventOrderCompleted = "order_completed"
+	CreditEventOrderCancelled = "order_cancelled"
+	CreditEventReviewReceived = "review_received"
+	CreditEventDisputeLost    = "dispute_lost"
+	CreditEventViolation      = "violation_confirmed"
+	CreditEventGeofence       = "geofence_violation"
+)
+
+// 事件影响类别，按用户类型映射到具体信用维度
+const (
+	creditCategoryActivity    = "activity"
+	creditCategoryFulfillment = "fulfillment"
+	creditCategoryService     = "service"
+	creditCategorySafety      = "safety"
+)
+
+const (
+	creditEventMaxAttempts = 10
+	creditEventBatchSize   = 200
+)
+
+func (s *CreditService) SetCreditConfig(cfg config.CreditConfig) {
+	s.creditCfg = cfg
+}
+
+// ============================================================
+// 业务事件入口
+// ============================================================
+
+// OnOrderCompleted 订单完成，计入下单方、服务方与执行飞手
+func (s *CreditService) OnOrderCompleted(order *model.Order) error {
+	return s.recordCreditEvents(orderCompletedCreditEvents(order)...)
+}
+
+// OnOrderCancelled 订单被取消，只计入取消方；管理员或系统取消不影响信用
+func (s *CreditService) OnOrderCancelled(order *model.Order, role string) error {
+	return s.recordCreditEvents(orderCancelledCreditEvent(order, role))
+}
+
+// OnReviewCreated 收到评价，计入被评价方
+func (s *CreditService) OnReviewCreated(review *model.Review) error {
+	return s.recordCreditEvents(reviewCreditEvent(review))
+}
+
+// OnDisputeResolved 纠纷判定结果，计入责任方
+func (s *CreditService) OnDisputeResolved(dispute *model.DisputeRecord, liableUserID int64, liableRole string) error {
+	userType := normalizeOrderRole(liableRole)
+	if dispute == nil || liableUserID <= 0 || userType == "" {
+		return nil
+	}
+	event := newCreditEvent(
+		fmt.Sprintf("dispute:%d:%d", dispute.ID, liableUserID), CreditEventDisputeLost,
+		liableUserID, userType, dispute.OrderID, "纠纷判定为责任方: "+dispute.DisputeType, dispute.UpdatedAt,
+	)
+	event.RelatedID = dispute.ID
+	return s.recordCreditEvents(event)
+}
+
+// OnViolationConfirmed 违规确认，按违规记录的扣分计入
+func (s *CreditService) OnViolationConfirmed(violation *model.Violation) error {
+	return s.recordCreditEvents(violationCreditEvent(violation))
+}
+
+// OnGeofenceViolation 执行飞行闯入禁飞/限飞区，同一订单同一围栏只计一次
+func (s *CreditService) OnGeofenceViolation(order *model.Order, fence *model.Geofence, occurredAt time.Time) error {
+	return s.recordCreditEvents(geofenceCreditEvent(order, fence, occurredAt))
+}
+
+// recordCreditEvents 登记事件并立即尝试计入；计入失败不影响登记，由定时任务重试
+func (s *CreditService) recordCreditEvents(events ...*model.CreditEvent) error {
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+		created, err := s.creditRepo.CreateCreditEvent(event)
+		if err != nil {
+			return err
+		}
+		if created {
+			s.applyOrRetry(event, time.Now())
+		}
+	}
+	return nil
+}
+
+func orderCompletedCreditEvents(order *model.Order) []*model.CreditEvent {
+	if order == nil {
+		return nil
+	}
+	occurredAt := order.UpdatedAt
+	if order.CompletedAt != nil {
+		occurredAt = *order.CompletedAt
+	}
+	participants := []struct {
+		userID   int64
+		userType string
+	}{
+		{orderClientUserID(order), "client"},
+		{orderProviderUserID(order), "owner"},
+		{order.ExecutorPilotUserID, "pilot"},
+	}
+	var events []*model.CreditEvent
+	seen := map[int64]bool{}
+	for _, p := range participants {
+		if p.userID <= 0 || seen[p.userID] {
+			continue
+		}
+		seen[p.userID] = true
+		events = append(events, newCreditEvent(
+			fmt.Sprintf("order_completed:%d:%d", order.ID, p.userID), CreditEventOrderCompleted,
+			p.userID, p.userType, order.ID, "订单完成: "+order.OrderNo, occurredAt,
+		))
+	}
+	return events
+}
+
+func orderCancelledCreditEvent(order *model.Order, role string) *model.CreditEvent {
+	if order == nil {
+		return nil
+	}
+	userType := normalizeOrderRole(role)
+	var userID int64
+	switch userType {
+	case "client":
+		userID = orderClientUserID(order)
+	case "owner":
+		userID = orderProviderUserID(order)
+	case "pilot":
+		userID = order.ExecutorPilotUserID
+	}
+	if userID <= 0 {
+		return nil
+	}
+	return newCreditEvent(
+		fmt.Sprintf("order_cancelled:%d", order.ID), CreditEventOrderCancelled,
+		userID, userType, order.ID, "取消订单: "+order.OrderNo, order.UpdatedAt,
+	)
+}
+
+func reviewCreditEvent(review *model.Review) *model.CreditEvent {
+	if review == nil || review.RevieweeID <= 0 {
+		return nil
+	}
+	userType := reviewTargetUserType(review.ReviewType)
+	if userType == "" {
+		return nil
+	}
+	event := newCreditEvent(
+		fmt.Sprintf("review:%d", review.ID), CreditEventReviewReceived,
+		review.RevieweeID, userType, review.OrderID, fmt.Sprintf("收到%d星评价", review.Rating), review.CreatedAt,
+	)
+	event.ReviewID = review.ID
+	event.Rating = review.Rating
+	return event
+}
+
+func violationCreditEvent(violation *model.Violation) *model.CreditEvent {
+	if violation == nil || violation.UserID <= 0 {
+		return nil
+	}
+	occurredAt := violation.CreatedAt
+	if violation.ConfirmedAt != nil {
+		occurredAt = *violation.ConfirmedAt
+	}
+	event := newCreditEvent(
+		violationCreditEventKey(violation.ID), CreditEventViolation,
+		violation.UserID, firstNonEmpty(violation.UserType, "pilot"), violation.OrderID,
+		"违规处罚: "+violation.ViolationType, occurredAt,
+	)
+	event.RelatedID = violation.ID
+	event.Severity = violation.ViolationLevel
+	return event
+}
+
+func geofenceCreditEvent(order *model.Order, fence *model.Geofence, occurredAt time.Time) *model.CreditEvent {
+	if order == nil || fence == nil || order.ExecutorPilotUserID <= 0 {
+		return nil
+	}
+	event := newCreditEvent(
+		fmt.Sprintf("geofence:%d:%d", order.ID, fence.ID), CreditEventGeofence,
+		order.ExecutorPilotUserID, "pilot", order.ID, "飞行闯入"+fence.Name, occurredAt,
+	)
+	event.RelatedID = fence.ID
+	event.Severity = fence.FenceType
+	return event
+}
+
+func newCreditEvent(key, eventType string, userID int64, userType string, orderID int64, detail string, occurredAt time.Time) *model.CreditEvent {
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	return &model.CreditEvent{
+		EventKey:   key,
+		EventType:  eventType,
+		UserID:     userID,
+		UserType:   userType,
+		OrderID:    orderID,
+		Detail:     truncateRunes(detail, 255),
+		Status:     "pending",
+		OccurredAt: occurredAt,
+	}
+}
+
+func violationCreditEventKey(violationID int64) string {
+	return fmt.Sprintf("violation:%d", violationID)
+}
+
+func orderClientUserID(order *model.Order) int64 {
+	if order.ClientUserID > 0 {
+		return order.ClientUserID
+	}
+	return order.RenterID
+}
+
+// reviewTargetUserType 由评价类型(如 renter_to_owner)得到被评价方的用户类型，评价无人机计入机主
+func reviewTargetUserType(reviewType string) string {
+	idx := strings.LastIndex(reviewType, "_to_")
+	if idx < 0 {
+		return ""
+	}
+	target := reviewType[idx+len("_to_"):]
+	if target == "drone" {
+		return "owner"
+	}
+	return normalizeOrderRole(target)
+}
+
+// ============================================================
+// 计入、衰减与撤销
+// ============================================================
+
+// ApplyCreditEvents 计入待处理的信用事件(定时任务调用)，返回计入条数
+func (s *CreditService) ApplyCreditEvents(limit int) (int, error) {
+	if limit <= 0 {
+		limit = creditEventBatchSize
+	}
+	events, err := s.creditRepo.ListPendingCreditEvents(creditEventMaxAttempts, limit)
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	now := time.Now()
+	for i := range events {
+		if s.applyOrRetry(&events[i], now) {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+func (s *CreditService) applyOrRetry(event *model.CreditEvent, now time.Time) bool {
+	err := s.creditRepo.DB().Transaction(func(tx *gorm.DB) error {
+		repo := repository.NewCreditRepository(tx)
+		score, err := s.ensureCreditScore(repo, event.UserID, event.UserType)
+		if err != nil {
+			return err
+		}
+		before := score.TotalScore
+		if err := s.replayCreditEvent(repo, score, event, now); err != nil {
+			return err
+		}
+		s.recalculateTotalScore(score)
+		score.LastCalculatedAt = &now
+		if err := repo.UpdateCreditScore(score); err != nil {
+			return err
+		}
+		if err := repo.SyncPilotCreditScore(score.UserID, score.TotalScore); err != nil {
+			return err
+		}
+		if err := repo.UpdateCreditEvent(event); err != nil {
+			return err
+		}
+		if event.AppliedPoints == 0 {
+			return nil
+		}
+		return repo.CreateCreditScoreLog(&model.CreditScoreLog{
+			UserID:          event.UserID,
+			ChangeType:      creditLogChangeType(event.EventType),
+			ChangeReason:    event.Detail,
+			Dimension:       event.Dimension,
+			ScoreBefore:     before,
+			ScoreAfter:      score.TotalScore,
+			ScoreChange:     score.TotalScore - before,
+			RelatedOrderID:  event.OrderID,
+			RelatedReviewID: event.ReviewID,
+			RelatedEventID:  event.ID,
+			OperatorType:    "system",
+			Notes:           fmt.Sprintf("规则影响分%d，按发生时间衰减后计入%d", event.Points, event.AppliedPoints),
+		})
+	})
+	if err == nil {
+		return true
+	}
+	event.Status = "pending"
+	event.Attempts++
+	event.LastError = truncateRunes(err.Error(), 255)
+	_ = s.creditRepo.UpdateCreditEvent(event)
+	return false
+}
+
+// replayCreditEvent 将事件计入信用分(不落库): 更新统计，按衰减后的影响分调整对应维度
+func (s *CreditService) replayCreditEvent(repo *repository.CreditRepository, score *model.CreditScore, event *model.CreditEvent, now time.Time) error {
+	points, category, err := s.creditEventPoints(repo, event)
+	if err != nil {
+		return err
+	}
+	applyCreditEventStats(score, event)
+
+	event.Dimension = creditEventDimension(score.UserType, category)
+	event.Points = points
+	event.AppliedPoints = adjustCreditDimension(score, event.Dimension, s.decayedPoints(points, event.OccurredAt, now))
+	event.Status = "applied"
+	event.AppliedAt = &now
+	event.LastError = ""
+	return nil
+}
+
+// creditEventPoints 按规则计算事件的原始影响分与影响类别
+func (s *CreditService) creditEventPoints(repo *repository.CreditRepository, event *model.CreditEvent) (int, string, error) {
+	switch event.EventType {
+	case CreditEventOrderCompleted:
+		return s.creditCfg.Rule(config.CreditRuleOrderCompleted), creditCategoryActivity, nil
+	case CreditEventOrderCancelled:
+		return s.creditCfg.Rule(config.CreditRuleOrderCancelled), creditCategoryFulfillment, nil
+	case CreditEventReviewReceived:
+		switch {
+		case event.Rating >= 5:
+			return s.creditCfg.Rule(config.CreditRuleReviewPositive), creditCategoryService, nil
+		case event.Rating > 0 && event.Rating <= 2:
+			return s.creditCfg.Rule(config.CreditRuleReviewNegative), creditCategoryService, nil
+		}
+		return 0, creditCategoryService, nil
+	case CreditEventDisputeLost:
+		return s.creditCfg.Rule(config.CreditRuleDisputeLost), creditCategoryFulfillment, nil
+	case CreditEventViolation:
+		violation, err := repo.GetViolationByID(event.RelatedID)
+		if err != nil {
+			return 0, "", err
+		}
+		return -violation.ScoreDeduction * s.creditCfg.Rule(config.CreditRuleViolationMultiplier) / 100, creditCategorySafety, nil
+	case CreditEventGeofence:
+		switch event.Severity {
+		case "no_fly":
+			return s.creditCfg.Rule(config.CreditRuleGeofenceNoFly), creditCategorySafety, nil
+		case "restricted":
+			return s.creditCfg.Rule(config.CreditRuleGeofenceRestricted), creditCategorySafety, nil
+		}
+		return 0, creditCategorySafety, nil
+	}
+	return 0, "", fmt.Errorf("未知的信用事件类型 %s", event.EventType)
+}
+
+// applyCreditEventStats 更新订单、评价与纠纷统计
+func applyCreditEventStats(score *model.CreditScore, event *model.CreditEvent) {
+	switch event.EventType {
+	case CreditEventOrderCompleted:
+		score.TotalOrders++
+		score.CompletedOrders++
+	case CreditEventOrderCancelled:
+		score.TotalOrders++
+		score.CancelledOrders++
+	case CreditEventReviewReceived:
+		if event.Rating <= 0 {
+			return
+		}
+		score.AverageRating = (score.AverageRating*float64(score.TotalReviews) + float64(event.Rating)) / float64(score.TotalReviews+1)
+		score.TotalReviews++
+		if event.Rating >= 4 {
+			score.PositiveReviews++
+		} else if event.Rating <= 2 {
+			score.NegativeReviews++
+		}
+	case CreditEventDisputeLost:
+		score.DisputeOrders++
+	}
+}
+
+// DecayCreditEvents 按半衰期回收已计入事件的影响分(定时任务调用)，返回调整的事件数
+func (s *CreditService) DecayCreditEvents(now time.Time) (int, error) {
+	if s.creditCfg.HalfLifeDays <= 0 {
+		return 0, nil
+	}
+	adjusted := 0
+	var afterID int64
+	for {
+		events, err := s.creditRepo.ListDecayingCreditEvents(afterID, creditEventBatchSize)
+		if err != nil {
+			return adjusted, err
+		}
+		if len(events) == 0 {
+			return adjusted, nil
+		}
+		for i := range events {
+			event := &events[i]
+			afterID = event.ID
+			target := s.decayedPoints(event.Points, event.OccurredAt, now)
+			if target == event.AppliedPoints {
+				continue
+			}
+			changed, err := s.adjustCreditEvent(event, target, "decay", "信用事件影响衰减: "+event.Detail, 0, "system", now)
+			if err != nil {
+				return adjusted, err
+			}
+			if changed {
+				adjusted++
+			}
+		}
+	}
+}
+
+// revokeCreditEvent 撤销事件(如违规申诉成功)并退回已计入的影响分，返回事件是否存在
+func (s *CreditService) revokeCreditEvent(eventKey string, operatorID int64, reason string) (bool, error) {
+	event, err := s.creditRepo.GetCreditEventByKey(eventKey)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch event.Status {
+	case "revoked":
+		return true, nil
+	case "applied":
+		event.Status = "revoked"
+		_, err := s.adjustCreditEvent(event, 0, "bonus", reason, operatorID, "admin", time.Now())
+		return true, err
+	}
+	event.Status = "revoked"
+	return true, s.creditRepo.UpdateCreditEvent(event)
+}
+
+// adjustCreditEvent 将事件已计入的影响分调整为 target 并记录变动日志，返回信用分是否变化
+func (s *CreditService) adjustCreditEvent(event *model.CreditEvent, target int, changeType, reason string, operatorID int64, operatorType string, now time.Time) (bool, error) {
+	changed := false
+	err := s.creditRepo.DB().Transaction(func(tx *gorm.DB) error {
+		repo := repository.NewCreditRepository(tx)
+		score, err := s.ensureCreditScore(repo, event.UserID, event.UserType)
+		if err != nil {
+			return err
+		}
+		before := score.TotalScore
+		previous := event.AppliedPoints
+		event.AppliedPoints += adjustCreditDimension(score, event.Dimension, target-previous)
+		if event.AppliedPoints == previous && event.Status != "revoked" {
+			// 维度已触及上下限，本次无可调整的分数
+			return nil
+		}
+		s.recalculateTotalScore(score)
+		score.LastCalculatedAt = &now
+		if err := repo.UpdateCreditScore(score); err != nil {
+			return err
+		}
+		if err := repo.SyncPilotCreditScore(score.UserID, score.TotalScore); err != nil {
+			return err
+		}
+		if err := repo.UpdateCreditEvent(event); err != nil {
+			return err
+		}
+		changed = event.AppliedPoints != previous
+		if !changed {
+			return nil
+		}
+		return repo.CreateCreditScoreLog(&model.CreditScoreLog{
+			UserID:          event.UserID,
+			ChangeType:      changeType,
+			ChangeReason:    truncateRunes(reason, 255),
+			Dimension:       event.Dimension,
+			ScoreBefore:     before,
+			ScoreAfter:      score.TotalScore,
+			ScoreChange:     score.TotalScore - before,
+			RelatedOrderID:  event.OrderID,
+			RelatedReviewID: event.ReviewID,
+			RelatedEventID:  event.ID,
+			OperatorID:      operatorID,
+			OperatorType:    operatorType,
+			Notes:           fmt.Sprintf("事件影响分由%d调整为%d", previous, event.AppliedPoints),
+		})
+	})
+	return changed, err
+}
+
+// decayedPoints 按半衰期计算事件在 now 时刻的剩余影响分
+func (s *CreditService) decayedPoints(points int, occurredAt, now time.Time) int {
+	if s.creditCfg.HalfLifeDays <= 0 || points == 0 {
+		return points
+	}
+	ageDays := now.Sub(occurredAt).Hours() / 24
+	if ageDays <= 0 {
+		return points
+	}
+	return int(math.Round(float64(points) * math.Pow(0.5, ageDays/float64(s.creditCfg.HalfLifeDays))))
+}
+
+func creditLogChangeType(eventType string) string {
+	switch eventType {
+	case CreditEventOrderCompleted:
+		return "order_complete"
+	case CreditEventReviewReceived:
+		return "review_received"
+	case CreditEventViolation, CreditEventGeofence:
+		return "violation"
+	}
+	return "penalty"
+}
+
+// ============================================================
+// 信用维度
+// ============================================================
+
+// 各用户类型由事件驱动的维度及其初始分，资质类维度(资质/合规/身份)由认证流程维护
+var creditEventDimensionSeeds = map[string]map[string]int{
+	"pilot":  {"service": 150, "safety": 200, "activity": 50},
+	"owner":  {"service": 150, "fulfillment": 150, "attitude": 100},
+	"client": {"payment": 150, "attitude": 150, "order_quality": 100},
+}
+
+// creditEventDimension 事件影响类别对应的信用维度
+func creditEventDimension(userType, category string) string {
+	switch userType {
+	case "pilot":
+		if category == creditCategoryFulfillment {
+			return "service"
+		}
+		return category
+	case "owner":
+		if category == creditCategoryService {
+			return "service"
+		}
+		return "fulfillment"
+	case "client":
+		if category == creditCategoryService || category == creditCategorySafety {
+			return "attitude"
+		}
+		return "order_quality"
+	}
+	return ""
+}
+
+// creditDimensionField 信用维度对应的字段及上限
+func creditDimensionField(score *model.CreditScore, dimension string) (*int, int) {
+	switch score.UserType + "." + dimension {
+	case "pilot.qualification":
+		return &score.PilotQualification, 200
+	case "pilot.service":
+		return &score.PilotService, 300
+	case "pilot.safety":
+		return &score.PilotSafety, 300
+	case "pilot.activity":
+		return &score.PilotActivity, 200
+	case "owner.compliance":
+		return &score.OwnerCompliance, 250
+	case "owner.service":
+		return &score.OwnerService, 300
+	case "owner.fulfillment":
+		return &score.OwnerFulfillment, 250
+	case "owner.attitude":
+		return &score.OwnerAttitude, 200
+	case "client.identity":
+		return &score.ClientIdentity, 200
+	case "client.payment":
+		return &score.ClientPayment, 300
+	case "client.attitude":
+		return &score.ClientAttitude, 300
+	case "client.order_quality":
+		return &score.ClientOrderQuality, 200
+	}
+	return nil, 0
+}
+
+// creditStaticDimension 不由事件驱动的资质类维度
+func creditStaticDimension(userType string) string {
+	switch userType {
+	case "pilot":
+		return "qualification"
+	case "owner":
+		return "compliance"
+	case "client":
+		return "identity"
+	}
+	return ""
+}
+
+// adjustCreditDimension 在维度上下限内调整分数，返回实际调整量
+func adjustCreditDimension(score *model.CreditScore, dimension string, delta int) int {
+	field, maxScore := creditDimensionField(score, dimension)
+	if field == nil || delta == 0 {
+		return 0
+	}
+	next := clampInt(*field+delta, 0, maxScore)
+	actual := next - *field
+	*field = next
+	return actual
+}
+
+// ensureCreditScore 获取信用分，各维度尚未初始化时以当前总分为准补齐维度分
+func (s *CreditService) ensureCreditScore(repo *repository.CreditRepository, userID int64, userType string) (*model.CreditScore, error) {
+	score, err := repo.GetOrCreateCreditScore(userID, userType)
+	if err != nil {
+		return nil, err
+	}
+	if score.UserType == "" {
+		score.UserType = userType
+	}
+	seeds := creditEventDimensionSeeds[score.UserType]
+	static, staticMax := creditDimensionField(score, creditStaticDimension(score.UserType))
+	if static == nil || *static != 0 {
+		return score, nil
+	}
+	sum := 0
+	for dimension := range seeds {
+		field, _ := creditDimensionField(score, dimension)
+		sum += *field
+	}
+	if sum != 0 {
+		return score, nil
+	}
+	for dimension, seed := range seeds {
+		field, _ := creditDimensionField(score, dimension)
+		*field = seed
+		sum += seed
+	}
+	*static = clampInt(score.TotalScore-sum, 0, staticMax)
+	s.recalculateTotalScore(score)
+	return score, nil
+}
+
+// ============================================================
+// 历史回算
+// ============================================================
+
+// BackfillCreditEvents 从订单、评价、违规与围栏记录补登历史信用事件(只登记不计入)，返回新登记条数
+func (s *CreditService) BackfillCreditEvents() (int, error) {
+	created := 0
+	record := func(events ...*model.CreditEvent) error {
+		for _, event := range events {
+			if event == nil {
+				continue
+			}
+			ok, err := s.creditRepo.CreateCreditEvent(event)
+			if err != nil {
+				return err
+			}
+			if ok {
+				created++
+			}
+		}
+		return nil
+	}
+
+	var afterID int64
+	for {
+		orders, err := s.creditRepo.ListFinishedOrders(afterID, creditEventBatchSize)
+		if err != nil || len(orders) == 0 {
+			if err != nil {
+				return created, err
+			}
+			break
+		}
+		for i := range orders {
+			order := &orders[i]
+			afterID = order.ID
+			if order.Status == "completed" {
+				err = record(orderCompletedCreditEvents(order)...)
+			} else {
+				err = record(orderCancelledCreditEvent(order, order.CancelBy))
+			}
+			if err != nil {
+				return created, err
+			}
+		}
+	}
+
+	afterID = 0
+	for {
+		reviews, err := s.creditRepo.ListReviews(afterID, creditEventBatchSize)
+		if err != nil || len(reviews) == 0 {
+			if err != nil {
+				return created, err
+			}
+			break
+		}
+		for i := range reviews {
+			afterID = reviews[i].ID
+			if err := record(reviewCreditEvent(&reviews[i])); err != nil {
+				return created, err
+			}
+		}
+	}
+
+	afterID = 0
+	for {
+		violations, err := s.creditRepo.ListConfirmedViolations(afterID, creditEventBatchSize)
+		if err != nil || len(violations) == 0 {
+			if err != nil {
+				return created, err
+			}
+			break
+		}
+		for i := range violations {
+			afterID = violations[i].ID
+			if err := record(violationCreditEvent(&violations[i])); err != nil {
+				return created, err
+			}
+		}
+	}
+
+	afterID = 0
+	orders := map[int64]*model.Order{}
+	fences := map[int64]*model.Geofence{}
+	for {
+		entries, err := s.creditRepo.ListGeofenceEntries(afterID, creditEventBatchSize)
+		if err != nil || len(entries) == 0 {
+			if err != nil {
+				return created, err
+			}
+			break
+		}
+		for _, entry := range entries {
+			afterID = entry.ID
+			order, ok := orders[entry.OrderID]
+			if !ok {
+				if order, err = s.creditRepo.GetOrder(entry.OrderID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return created, err
+				}
+				orders[entry.OrderID] = order
+			}
+			fence, ok := fences[entry.GeofenceID]
+			if !ok {
+				if fence, err = s.creditRepo.GetGeofence(entry.GeofenceID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return created, err
+				}
+				fences[entry.GeofenceID] = fence
+			}
+			if err := record(geofenceCreditEvent(order, fence, entry.ViolatedAt)); err != nil {
+				return created, err
+			}
+		}
+	}
+	return created, nil
+}
+
+// RecomputeCreditScores 按全部有效信用事件重算信用分: 事件驱动维度与统计重置为初始值后依发生顺序重放，
+// 资质类维度保持不变，每个用户记录一条 recalculate 日志；返回重算的用户数
+func (s *CreditService) RecomputeCreditScores(now time.Time) (int, error) {
+	userIDs, err := s.creditRepo.ListCreditEventUserIDs()
+	if err != nil {
+		return 0, err
+	}
+	recomputed := 0
+	for _, userID := range userIDs {
+		if err := s.recomputeUserCredit(userID, now); err != nil {
+			return recomputed, fmt.Errorf("重算用户%d信用分失败: %w", userID, err)
+		}
+		recomputed++
+	}
+	return recomputed, nil
+}
+
+func (s *CreditService) recomputeUserCredit(userID int64, now time.Time) error {
+	return s.creditRepo.DB().Transaction(func(tx *gorm.DB) error {
+		repo := repository.NewCreditRepository(tx)
+		events, err := repo.ListUserCreditEvents(userID)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		score, err := s.ensureCreditScore(repo, userID, events[0].UserType)
+		if err != nil {
+			return err
+		}
+		before := score.TotalScore
+
+		for dimension, seed := range creditEventDimensionSeeds[score.UserType] {
+			field, _ := creditDimensionField(score, dimension)
+			*field = seed
+		}
+		score.TotalOrders, score.CompletedOrders, score.CancelledOrders, score.DisputeOrders = 0, 0, 0, 0
+		score.TotalReviews, score.PositiveReviews, score.NegativeReviews = 0, 0, 0
+		score.AverageRating = 5
+		score.ViolationCount = 0
+
+		for i := range events {
+			event := &events[i]
+			if err := s.replayCreditEvent(repo, score, event, now); err != nil {
+				return err
+			}
+			if event.EventType == CreditEventViolation {
+				score.ViolationCount++
+			}
+			if err := repo.UpdateCreditEvent(event); err != nil {
+				return err
+			}
+		}
+		s.recalculateTotalScore(score)
+		score.LastCalculatedAt = &now
+		if err := repo.UpdateCreditScore(score); err != nil {
+			return err
+		}
+		if err := repo.SyncPilotCreditScore(score.UserID, score.TotalScore); err != nil {
+			return err
+		}
+		return repo.CreateCreditScoreLog(&model.CreditScoreLog{
+			UserID:       userID,
+			ChangeType:   "recalculate",
+			ChangeReason: "按历史信用事件重算信用分",
+			ScoreBefore:  before,
+			ScoreAfter:   score.TotalScore,
+			ScoreChange:  score.TotalScore - before,
+			OperatorType: "system",
+			Notes:        fmt.Sprintf("重放信用事件%d条", len(events)),
+		})
+	})
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func loadCreditScore(t *testing.T, db *gorm.DB, userID int64) model.CreditScore {
+	t.Helper()
+	var score model.CreditScore
+	if err := db.Where("user_id = ?", userID).First(&score).Error; err != nil {
+		t.Fatalf("load credit score %d: %v", userID, err)
+	}
+	return score
+}
+
+func TestCreditEventsFromOrderLifecycleAndReviews(t *testing.T) {
+	db := newServiceTestDB(t, &model.CreditScore{}, &model.CreditScoreLog{}, &model.CreditEvent{}, &model.Pilot{})
+	service := NewCreditService(repository.NewCreditRepository(db))
+	service.SetCreditConfig(config.CreditConfig{HalfLifeDays: 0})
+
+	now := time.Now()
+	completed := &model.Order{ID: 1, OrderNo: "WRJ-CREDIT-1", RenterID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31, Status: "completed", CompletedAt: &now}
+	if err := service.OnOrderCompleted(completed); err != nil {
+		t.Fatalf("order completed: %v", err)
+	}
+	// 重复投递同一订单完成事件不重复计分
+	if err := service.OnOrderCompleted(completed); err != nil {
+		t.Fatalf("order completed again: %v", err)
+	}
+
+	pilot := loadCreditScore(t, db, 31)
+	if pilot.PilotQualification != 200 || pilot.PilotActivity != 53 || pilot.TotalScore != 603 {
+		t.Fatalf("unexpected pilot score: qualification=%d activity=%d total=%d", pilot.PilotQualification, pilot.PilotActivity, pilot.TotalScore)
+	}
+	if pilot.CompletedOrders != 1 || pilot.TotalOrders != 1 {
+		t.Fatalf("expected one completed order, got %+v", pilot)
+	}
+
+	cancelled := &model.Order{ID: 2, OrderNo: "WRJ-CREDIT-2", RenterID: 11, ProviderUserID: 21, Status: "cancelled", UpdatedAt: now}
+	if err := service.OnOrderCancelled(cancelled, "provider"); err != nil {
+		t.Fatalf("order cancelled: %v", err)
+	}
+	if err := service.OnReviewCreated(&model.Review{ID: 5, OrderID: 1, RevieweeID: 21, ReviewType: "renter_to_owner", Rating: 5, CreatedAt: now}); err != nil {
+		t.Fatalf("review created: %v", err)
+	}
+
+	owner := loadCreditScore(t, db, 21)
+	// 完成订单 +3(履约)，取消订单 -15(履约)，5星好评 +5(服务)
+	if owner.OwnerFulfillment != 138 || owner.OwnerService != 155 || owner.TotalScore != 593 {
+		t.Fatalf("unexpected owner score: fulfillment=%d service=%d total=%d", owner.OwnerFulfillment, owner.OwnerService, owner.TotalScore)
+	}
+	if owner.CancelledOrders != 1 || owner.PositiveReviews != 1 || owner.TotalReviews != 1 {
+		t.Fatalf("unexpected owner stats: %+v", owner)
+	}
+
+	var logs []model.CreditScoreLog
+	if err := db.Where("user_id = ?", 21).Order("id ASC").Find(&logs).Error; err != nil {
+		t.Fatalf("load logs: %v", err)
+	}
+	if len(logs) != 3 || logs[1].ChangeType != "penalty" || logs[1].ScoreChange != -15 || logs[1].RelatedEventID == 0 || logs[1].RelatedOrderID != 2 {
+		t.Fatalf("unexpected owner credit logs: %+v", logs)
+	}
+}
+
+func loadPilotCreditScore(t *testing.T, db *gorm.DB, userID int64) int {
+	t.Helper()
+	var pilot model.Pilot
+	if err := db.Where("user_id = ?", userID).First(&pilot).Error; err != nil {
+		t.Fatalf("load pilot %d: %v", userID, err)
+	}
+	return pilot.CreditScore
+}
+
+func TestCreditEventsSyncPilotDispatchScore(t *testing.T) {
+	db := newServiceTestDB(t, &model.CreditScore{}, &model.CreditScoreLog{}, &model.CreditEvent{}, &model.Pilot{})
+	service := NewCreditService(repository.NewCreditRepository(db))
+	service.SetCreditConfig(config.CreditConfig{HalfLifeDays: 0})
+	if err := db.Create(&model.Pilot{UserID: 31, CreditScore: 500}).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+
+	now := time.Now()
+	completed := &model.Order{ID: 1, OrderNo: "WRJ-PILOT-1", RenterID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31, Status: "completed", CompletedAt: &now}
+	if err := service.OnOrderCompleted(completed); err != nil {
+		t.Fatalf("order completed: %v", err)
+	}
+	afterCompleted := loadPilotCreditScore(t, db, 31)
+	if afterCompleted != 603 || afterCompleted != loadCreditScore(t, db, 31).TotalScore {
+		t.Fatalf("expected pilot dispatch score synced to 603 after completion, got %d", afterCompleted)
+	}
+
+	cancelled := &model.Order{ID: 2, OrderNo: "WRJ-PILOT-2", RenterID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31, Status: "cancelled", UpdatedAt: now}
+	if err := service.OnOrderCancelled(cancelled, "pilot"); err != nil {
+		t.Fatalf("order cancelled: %v", err)
+	}
+	afterCancelled := loadPilotCreditScore(t, db, 31)
+	if afterCancelled >= afterCompleted || afterCancelled != loadCreditScore(t, db, 31).TotalScore {
+		t.Fatalf("expected pilot dispatch score lowered by cancellation, got %d (was %d)", afterCancelled, afterCompleted)
+	}
+}
+
+func TestCreditEventDecayAndViolationAppeal(t *testing.T) {
+	db := newServiceTestDB(t, &model.Violation{}, &model.Blacklist{}, &model.CreditScore{}, &model.CreditScoreLog{}, &model.CreditEvent{}, &model.Pilot{})
+	service := NewCreditService(repository.NewCreditRepository(db))
+	service.SetCreditConfig(config.CreditConfig{HalfLifeDays: 30})
+
+	now := time.Now()
+	order := &model.Order{ID: 7, ExecutorPilotUserID: 31}
+	fence := &model.Geofence{ID: 3, Name: "机场净空区", FenceType: "no_fly"}
+	if err := service.OnGeofenceViolation(order, fence, now.AddDate(0, 0, -30)); err != nil {
+		t.Fatalf("geofence violation: %v", err)
+	}
+	event, err := service.creditRepo.GetCreditEventByKey("geofence:7:3")
+	if err != nil {
+		t.Fatalf("load geofence event: %v", err)
+	}
+	if event.Points != -50 || event.AppliedPoints != -25 || event.Dimension != "safety" {
+		t.Fatalf("expected half-decayed geofence penalty, got %+v", event)
+	}
+
+	adjusted, err := service.DecayCreditEvents(now.AddDate(0, 0, 30))
+	if err != nil || adjusted != 1 {
+		t.Fatalf("expected one decayed event, got %d, %v", adjusted, err)
+	}
+	pilot := loadCreditScore(t, db, 31)
+	if pilot.PilotSafety != 200-13 {
+		t.Fatalf("expected safety 187 after decay, got %d", pilot.PilotSafety)
+	}
+
+	violation := &model.Violation{UserID: 31, UserType: "pilot", ViolationType: "unsafe_flight", ViolationLevel: "moderate", Description: "超高飞行"}
+	if err := service.CreateViolation(violation); err != nil {
+		t.Fatalf("create violation: %v", err)
+	}
+	if err := service.ConfirmViolation(violation.ID, 1); err != nil {
+		t.Fatalf("confirm violation: %v", err)
+	}
+	pilot = loadCreditScore(t, db, 31)
+	if pilot.PilotSafety != 187-30 || pilot.ViolationCount != 1 {
+		t.Fatalf("expected violation deduction, got safety=%d violations=%d", pilot.PilotSafety, pilot.ViolationCount)
+	}
+
+	if err := service.SubmitAppeal(violation.ID, "高度数据异常"); err != nil {
+		t.Fatalf("submit appeal: %v", err)
+	}
+	if err := service.ReviewAppeal(violation.ID, true, 1, "遥测故障"); err != nil {
+		t.Fatalf("review appeal: %v", err)
+	}
+	pilot = loadCreditScore(t, db, 31)
+	if pilot.PilotSafety != 187 || pilot.ViolationCount != 0 {
+		t.Fatalf("expected appeal to restore score, got safety=%d violations=%d", pilot.PilotSafety, pilot.ViolationCount)
+	}
+	revoked, err := service.creditRepo.GetCreditEventByKey(violationCreditEventKey(violation.ID))
+	if err != nil || revoked.Status != "revoked" || revoked.AppliedPoints != 0 {
+		t.Fatalf("expected revoked violation event, got %+v, %v", revoked, err)
+	}
+}
+
+func TestBackfillAndRecomputeCreditScoresIsRepeatable(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.Review{}, &model.Violation{}, &model.GeofenceViolation{}, &model.Geofence{},
+		&model.CreditScore{}, &model.CreditScoreLog{}, &model.CreditEvent{}, &model.Pilot{},
+	)
+	service := NewCreditService(repository.NewCreditRepository(db))
+	service.SetCreditConfig(config.CreditConfig{HalfLifeDays: 0})
+
+	now := time.Now()
+	orders := []model.Order{
+		{OrderNo: "WRJ-HIST-1", Title: "历史订单1", ClientUserID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31, Status: "completed", CompletedAt: &now},
+		{OrderNo: "WRJ-HIST-2", Title: "历史订单2", ClientUserID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31, Status: "cancelled", CancelBy: "client"},
+		{OrderNo: "WRJ-HIST-3", Title: "进行中订单", ClientUserID: 11, ProviderUserID: 21, Status: "in_transit"},
+	}
+	if err := db.Create(&orders).Error; err != nil {
+		t.Fatalf("create orders: %v", err)
+	}
+	if err := db.Create(&model.Review{OrderID: orders[0].ID, ReviewerID: 21, RevieweeID: 11, ReviewType: "owner_to_renter", Rating: 1}).Error; err != nil {
+		t.Fatalf("create review: %v", err)
+	}
+	if err := db.Create(&model.Pilot{UserID: 31, CreditScore: 820}).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+	// 信用分已被旧逻辑改动过，重算后以事件为准
+	if err := db.Create(&model.CreditScore{UserID: 11, UserType: "client", TotalScore: 650, ClientIdentity: 180, ClientPayment: 170, ClientAttitude: 200, ClientOrderQuality: 100}).Error; err != nil {
+		t.Fatalf("create client score: %v", err)
+	}
+
+	created, err := service.BackfillCreditEvents()
+	if err != nil || created != 5 {
+		t.Fatalf("expected 5 backfilled events, got %d, %v", created, err)
+	}
+	users, err := service.RecomputeCreditScores(now)
+	if err != nil || users != 3 {
+		t.Fatalf("expected 3 recomputed users, got %d, %v", users, err)
+	}
+	client := loadCreditScore(t, db, 11)
+	// 身份分保持 180；付款 150；态度 150-10(差评)；下单质量 100+3-15
+	if client.ClientIdentity != 180 || client.ClientAttitude != 140 || client.ClientOrderQuality != 88 || client.TotalScore != 558 {
+		t.Fatalf("unexpected recomputed client score: %+v", client)
+	}
+	if client.TotalOrders != 2 || client.CancelledOrders != 1 || client.NegativeReviews != 1 || client.AverageRating != 1 {
+		t.Fatalf("unexpected recomputed client stats: %+v", client)
+	}
+
+	if got := loadPilotCreditScore(t, db, 31); got != loadCreditScore(t, db, 31).TotalScore {
+		t.Fatalf("expected recomputed pilot score written back to pilot profile, got %d", got)
+	}
+
+	again, err := service.BackfillCreditEvents()
+	if err != nil || again != 0 {
+		t.Fatalf("expected backfill to be idempotent, got %d, %v", again, err)
+	}
+	if _, err := service.RecomputeCreditScores(now); err != nil {
+		t.Fatalf("recompute again: %v", err)
+	}
+	if rerun := loadCreditScore(t, db, 11); rerun.TotalScore != client.TotalScore || rerun.TotalOrders != client.TotalOrders {
+		t.Fatalf("expected recompute to be repeatable, got %+v", rerun)
+	}
+}
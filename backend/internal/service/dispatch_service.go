@@ -24,6 +24,7 @@ type DispatchService struct {
 	demandDomainRepo  *repository.DemandDomainRepo
 	orderArtifactRepo *repository.OrderArtifactRepo
 	eventService      *EventService
+	pricingEngine     *PricingEngine
 	logger            *zap.Logger
 	config            *DispatchServiceConfig
 }
@@ -86,6 +87,7 @@ func NewDispatchService(
 		ownerDomainRepo:   ownerDomainRepo,
 		demandDomainRepo:  demandDomainRepo,
 		orderArtifactRepo: orderArtifactRepo,
+		pricingEngine:     NewPricingEngine(nil, ownerDomainRepo),
 		logger:            logger,
 		config:            config,
 	}
@@ -95,6 +97,10 @@ func (s *DispatchService) SetEventService(eventService *EventService) {
 	s.eventService = eventService
 }
 
+func (s *DispatchService) SetPricingEngine(pricingEngine *PricingEngine) {
+	s.pricingEngine = pricingEngine
+}
+
 func (s *DispatchService) AdminListFormalTasks(page, pageSize int, filters map[string]interface{}) ([]model.FormalDispatchTask, int64, error) {
 	if s.dispatchRepo == nil {
 		return nil, 0, errors.New("正式派单仓储未初始化")
@@ -496,21 +502,39 @@ func (s *DispatchService) scorePair(task *model.DispatchTask, pair *repository.P
 	return candidate
 }
 
-// estimatePrice 估算价格
+// estimatePrice 按统一定价引擎估价：候选无人机有挂牌供给时按供给计价，否则按平台阶梯价
 func (s *DispatchService) estimatePrice(task *model.DispatchTask, pair *repository.PilotDronePair) int64 {
-	// 基础价格公式: 起步费 + 里程费 + 重量费
-	baseFee := int64(5000)                           // 起步费50元
-	distanceFee := int64(task.FlightDistance * 1000) // 10元/公里
-	weightFee := int64(task.CargoWeight * 500)       // 5元/公斤
-
-	// 难度系数
-	difficultyMultiplier := 1.0
-	if task.IsHazardous {
-		difficultyMultiplier = 1.5
+	input := dispatchPricingInput(task)
+	if s.ownerDomainRepo != nil && pair != nil {
+		if supply, err := s.ownerDomainRepo.GetPreferredSupplyByOwnerDrone(pair.OwnerID, pair.DroneID); err == nil && supply != nil && supply.Status == "active" {
+			if quote, err := s.pricingEngine.Quote(input, supply); err == nil {
+				return quote.TotalAmount
+			}
+		}
 	}
+	quote, err := s.pricingEngine.Quote(input, nil)
+	if err != nil {
+		s.logger.Warn("estimate dispatch price failed", zap.Int64("task_id", task.ID), zap.Error(err))
+		return 0
+	}
+	return quote.TotalAmount
+}
 
-	totalFee := int64(float64(baseFee+distanceFee+weightFee) * difficultyMultiplier)
-	return totalFee
+func dispatchPricingInput(task *model.DispatchTask) PricingInput {
+	scheduledAt := task.RequiredPickupTime
+	if scheduledAt == nil {
+		scheduledAt = task.TimeWindowStart
+	}
+	return PricingInput{
+		FlightDistance: task.FlightDistance,
+		CargoWeight:    task.CargoWeight,
+		TaskType:       "cargo_delivery",
+		CargoScene:     task.CargoCategory,
+		ScheduledAt:    scheduledAt,
+		IsHazardous:    task.IsHazardous,
+		Latitude:       task.PickupLatitude,
+		Longitude:      task.PickupLongitude,
+	}
 }
 
 // ==================== 派单流程 ====================
@@ -802,6 +826,7 @@ func (s *DispatchService) completeFormalTaskAndReassign(dispatchID, operatorUser
 	var manualFallback bool
 	var affectedOrderID int64
 	var terminalReason string
+	var closedTask *model.FormalDispatchTask
 	err := db.Transaction(func(tx *gorm.DB) error {
 		dispatchRepo := repository.NewDispatchRepo(tx)
 		orderRepo := repository.NewOrderRepo(tx)
@@ -849,6 +874,9 @@ func (s *DispatchService) completeFormalTaskAndReassign(dispatchID, operatorUser
 		if err := dispatchRepo.UpdateFormalTaskFields(task.ID, fields); err != nil {
 			return err
 		}
+		closed := *task
+		closed.Status = terminalStatus
+		closedTask = &closed
 		if err := dispatchRepo.CreateFormalLog(&model.FormalDispatchLog{
 			DispatchTaskID: task.ID,
 			ActionType:     terminalStatus,
@@ -907,6 +935,7 @@ func (s *DispatchService) completeFormalTaskAndReassign(dispatchID, operatorUser
 		return nil, err
 	}
 	if stateChanged && s.eventService != nil && affectedOrderID > 0 {
+		s.eventService.NotifyDispatchClosed(closedTask)
 		if order, err := s.orderRepo.GetByID(affectedOrderID); err == nil && order != nil {
 			if reassignedTask != nil && reassignedTask.ID != dispatchID {
 				s.eventService.NotifyDispatchCreated(reassignedTask, order)
@@ -1107,6 +1136,7 @@ func (s *DispatchService) ReassignFormalTask(dispatchID, providerUserID int64, d
 	var result *model.FormalDispatchTask
 	var affectedOrderID int64
 	var manualReason string
+	var closedTask *model.FormalDispatchTask
 	err := db.Transaction(func(tx *gorm.DB) error {
 		dispatchRepo := repository.NewDispatchRepo(tx)
 		orderRepo := repository.NewOrderRepo(tx)
@@ -1144,6 +1174,9 @@ func (s *DispatchService) ReassignFormalTask(dispatchID, providerUserID int64, d
 			}); err != nil {
 				return err
 			}
+			closed := *task
+			closed.Status = "exception"
+			closedTask = &closed
 		}
 		if err := dispatchRepo.CreateFormalLog(&model.FormalDispatchLog{
 			DispatchTaskID: task.ID,
@@ -1191,6 +1224,7 @@ func (s *DispatchService) ReassignFormalTask(dispatchID, providerUserID int64, d
 	}
 
 	if s.eventService != nil && affectedOrderID > 0 {
+		s.eventService.NotifyDispatchClosed(closedTask)
 		if order, err := s.orderRepo.GetByID(affectedOrderID); err == nil && order != nil {
 			if result != nil {
 				s.eventService.NotifyDispatchCreated(result, order)
@@ -0,0 +1,602 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// 纠纷处理: 发起后自动附加飞行轨迹与告警，被申诉方在答辩期内提交答辩(逾期直接进入仲裁)，
+// 管理员分配仲裁员并裁决；裁决退款生成退款记录、退款与罚金调整待结算的订单结算，责任方计入信用事件
+
+const (
+	DisputeResolutionFullRefund    = "full_refund"
+	DisputeResolutionPartialRefund = "partial_refund"
+	DisputeResolutionPenalty       = "penalty"
+	DisputeResolutionDismiss       = "dismiss"
+
+	disputeTrackMaxPoints = 200
+)
+
+// DisputeResolutionInput 纠纷裁决
+type DisputeResolutionInput struct {
+	Resolution    string `json:"resolution" binding:"required"` // full_refund, partial_refund, penalty, dismiss
+	RefundAmount  int64  `json:"refund_amount"`                 // partial_refund 时必填(分)
+	PenaltyAmount int64  `json:"penalty_amount"`                // 责任方罚金(分)，从其结算分成中扣除
+	LiableRole    string `json:"liable_role"`                   // client, owner, pilot；退款类裁决默认 owner
+	Note          string `json:"note"`
+}
+
+// DisputeDetail 纠纷详情与证据
+type DisputeDetail struct {
+	Dispute   *model.DisputeRecord    `json:"dispute"`
+	Evidences []model.DisputeEvidence `json:"evidences"`
+}
+
+type DisputeService struct {
+	disputeRepo    *repository.DisputeRepo
+	orderService   *OrderService
+	settlementRepo *repository.SettlementRepo
+	flightRepo     *repository.FlightRepo
+	creditService  *CreditService
+	eventService   *EventService
+	cfg            config.DisputeConfig
+	logger         *zap.Logger
+}
+
+func NewDisputeService(
+	disputeRepo *repository.DisputeRepo,
+	orderService *OrderService,
+	settlementRepo *repository.SettlementRepo,
+	cfg config.DisputeConfig,
+	logger *zap.Logger,
+) *DisputeService {
+	return &DisputeService{
+		disputeRepo:    disputeRepo,
+		orderService:   orderService,
+		settlementRepo: settlementRepo,
+		cfg:            cfg,
+		logger:         logger,
+	}
+}
+
+func (s *DisputeService) SetFlightRepo(flightRepo *repository.FlightRepo) {
+	s.flightRepo = flightRepo
+}
+
+func (s *DisputeService) SetCreditService(creditService *CreditService) {
+	s.creditService = creditService
+}
+
+func (s *DisputeService) SetEventService(eventService *EventService) {
+	s.eventService = eventService
+}
+
+// prepareDispute 补齐发起方角色、被申诉方与处理时限
+func (s *DisputeService) prepareDispute(order *model.Order, record *model.DisputeRecord, now time.Time) {
+	record.InitiatorRole = disputeParticipantRole(order, record.InitiatorUserID)
+	if record.InitiatorRole == "client" {
+		record.RespondentUserID = orderProviderUserID(order)
+	} else {
+		record.RespondentUserID = orderClientUserID(order)
+	}
+	responseDueAt := now.Add(s.cfg.ResponseWindow())
+	resolutionDueAt := now.Add(s.cfg.ResolutionWindow())
+	record.ResponseDueAt = &responseDueAt
+	record.ResolutionDueAt = &resolutionDueAt
+}
+
+// onDisputeOpened 附加飞行证据并通知被申诉方，失败只记录日志
+func (s *DisputeService) onDisputeOpened(order *model.Order, record *model.DisputeRecord) {
+	if err := s.attachFlightEvidence(order, record); err != nil {
+		s.logger.Warn("attach dispute flight evidence failed", zap.Int64("dispute_id", record.ID), zap.Error(err))
+	}
+	if s.eventService != nil {
+		s.eventService.NotifyDisputeUpdated(record, order, "dispute_opened", "订单纠纷待答辩",
+			fmt.Sprintf("订单%s收到纠纷申诉，请在%s前提交答辩与证据。", order.OrderNo, formatDisputeDue(record.ResponseDueAt)),
+			[]int64{record.RespondentUserID})
+	}
+}
+
+// attachFlightEvidence 附加订单飞行记录的轨迹(抽稀)与告警
+func (s *DisputeService) attachFlightEvidence(order *model.Order, record *model.DisputeRecord) error {
+	if s.flightRepo == nil {
+		return nil
+	}
+	flights, err := s.flightRepo.ListFlightRecordsByOrder(order.ID)
+	if err != nil {
+		return err
+	}
+	for _, flight := range flights {
+		positions, err := s.flightRepo.GetPositionsByFlightRecord(flight.ID)
+		if err != nil {
+			return err
+		}
+		points := make([][]interface{}, 0, disputeTrackMaxPoints)
+		step := len(positions)/disputeTrackMaxPoints + 1
+		for i := 0; i < len(positions); i += step {
+			p := positions[i]
+			points = append(points, []interface{}{p.Latitude, p.Longitude, p.Altitude, p.RecordedAt.Unix()})
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"flight_record_id": flight.ID,
+			"flight_no":        flight.FlightNo,
+			"takeoff_at":       flight.TakeoffAt,
+			"landing_at":       flight.LandingAt,
+			"distance_m":       flight.TotalDistanceM,
+			"duration_seconds": flight.TotalDurationSeconds,
+			"max_altitude_m":   flight.MaxAltitudeM,
+			"position_count":   len(positions),
+			"points":           points, // [纬度, 经度, 高度, 时间戳]
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.disputeRepo.CreateEvidence(&model.DisputeEvidence{
+			DisputeID:     record.ID,
+			OrderID:       order.ID,
+			SubmitterRole: "system",
+			EvidenceType:  "flight_track",
+			Content:       fmt.Sprintf("飞行%s轨迹，共%d个位置点", flight.FlightNo, len(positions)),
+			Data:          model.JSON(data),
+		}); err != nil {
+			return err
+		}
+	}
+
+	alerts, err := s.flightRepo.GetAlertsByOrder(order.ID)
+	if err != nil || len(alerts) == 0 {
+		return err
+	}
+	items := make([]map[string]interface{}, 0, len(alerts))
+	for _, alert := range alerts {
+		items = append(items, map[string]interface{}{
+			"alert_id":     alert.ID,
+			"alert_type":   alert.AlertType,
+			"alert_level":  alert.AlertLevel,
+			"title":        alert.Title,
+			"description":  alert.Description,
+			"status":       alert.Status,
+			"triggered_at": alert.TriggeredAt,
+			"latitude":     alert.Latitude,
+			"longitude":    alert.Longitude,
+		})
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return s.disputeRepo.CreateEvidence(&model.DisputeEvidence{
+		DisputeID:     record.ID,
+		OrderID:       order.ID,
+		SubmitterRole: "system",
+		EvidenceType:  "flight_alert",
+		Content:       fmt.Sprintf("订单飞行告警%d条", len(alerts)),
+		Data:          model.JSON(data),
+	})
+}
+
+// GetDispute 订单参与方查看纠纷详情
+func (s *DisputeService) GetDispute(orderID, disputeID, userID int64) (*DisputeDetail, error) {
+	record, _, err := s.loadParticipantDispute(orderID, disputeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildDetail(record)
+}
+
+// AdminGetDispute 管理员查看纠纷详情
+func (s *DisputeService) AdminGetDispute(disputeID int64) (*DisputeDetail, error) {
+	record, err := s.disputeRepo.GetByID(disputeID)
+	if err != nil {
+		return nil, errors.New("纠纷不存在")
+	}
+	return s.buildDetail(record)
+}
+
+func (s *DisputeService) buildDetail(record *model.DisputeRecord) (*DisputeDetail, error) {
+	evidences, err := s.disputeRepo.ListEvidence(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &DisputeDetail{Dispute: record, Evidences: evidences}, nil
+}
+
+// AddEvidence 订单参与方在结案前补充证据(上传文件或文字说明)
+func (s *DisputeService) AddEvidence(orderID, disputeID, userID int64, content, fileURL string) (*model.DisputeEvidence, error) {
+	record, order, err := s.loadParticipantDispute(orderID, disputeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isDisputeOpen(record.Status) {
+		return nil, errors.New("纠纷已结案，不能再提交证据")
+	}
+	if content == "" && fileURL == "" {
+		return nil, errors.New("证据内容不能为空")
+	}
+	evidenceType := "statement"
+	if fileURL != "" {
+		evidenceType = "file"
+	}
+	evidence := &model.DisputeEvidence{
+		DisputeID:       record.ID,
+		OrderID:         order.ID,
+		SubmitterUserID: userID,
+		SubmitterRole:   disputeParticipantRole(order, userID),
+		EvidenceType:    evidenceType,
+		Content:         content,
+		FileURL:         fileURL,
+	}
+	if err := s.disputeRepo.CreateEvidence(evidence); err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+// SubmitResponse 被申诉方提交答辩，纠纷进入待仲裁
+func (s *DisputeService) SubmitResponse(orderID, disputeID, userID int64, content string) (*model.DisputeEvidence, error) {
+	record, order, err := s.loadParticipantDispute(orderID, disputeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == record.InitiatorUserID {
+		return nil, errors.New("发起方不能提交答辩")
+	}
+	if !isDisputeOpen(record.Status) {
+		return nil, errors.New("纠纷已结案，不能再提交答辩")
+	}
+	if content == "" {
+		return nil, errors.New("答辩内容不能为空")
+	}
+
+	evidence := &model.DisputeEvidence{
+		DisputeID:       record.ID,
+		OrderID:         order.ID,
+		SubmitterUserID: userID,
+		SubmitterRole:   disputeParticipantRole(order, userID),
+		EvidenceType:    "counter_statement",
+		Content:         content,
+	}
+	err = s.disputeRepo.DB().Transaction(func(tx *gorm.DB) error {
+		repo := repository.NewDisputeRepo(tx)
+		if err := repo.CreateEvidence(evidence); err != nil {
+			return err
+		}
+		now := time.Now()
+		_, err := repo.Transition(record.ID, []string{"open"}, map[string]interface{}{
+			"status":       "responded",
+			"responded_at": &now,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.eventService != nil {
+		s.eventService.NotifyDisputeUpdated(record, order, "dispute_responded", "纠纷已收到答辩",
+			fmt.Sprintf("订单%s的纠纷对方已提交答辩，平台将尽快处理。", order.OrderNo), []int64{record.InitiatorUserID})
+	}
+	return evidence, nil
+}
+
+// AssignArbitrator 分配仲裁员，未结案的纠纷可重新分配
+func (s *DisputeService) AssignArbitrator(disputeID, arbitratorID int64) (*model.DisputeRecord, error) {
+	if arbitratorID <= 0 {
+		return nil, errors.New("请指定仲裁员")
+	}
+	now := time.Now()
+	updated, err := s.disputeRepo.Transition(disputeID, repository.OpenDisputeStatuses, map[string]interface{}{
+		"status":        "arbitrating",
+		"arbitrator_id": arbitratorID,
+		"assigned_at":   &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, errors.New("纠纷不存在或已结案")
+	}
+	return s.disputeRepo.GetByID(disputeID)
+}
+
+// ResolveDispute 裁决纠纷: 退款生成退款记录，退款与罚金在订单结算计算时扣减，已计算的结算退回重算
+func (s *DisputeService) ResolveDispute(disputeID, adminID int64, input *DisputeResolutionInput) (*model.DisputeRecord, error) {
+	record, err := s.disputeRepo.GetByID(disputeID)
+	if err != nil {
+		return nil, errors.New("纠纷不存在")
+	}
+	if !isDisputeOpen(record.Status) {
+		return nil, errors.New("纠纷已结案")
+	}
+	order, err := s.orderService.orderRepo.GetByID(record.OrderID)
+	if err != nil {
+		return nil, errors.New("订单不存在")
+	}
+
+	refundAmount, liableRole, err := validateDisputeResolution(order, input)
+	if err != nil {
+		return nil, err
+	}
+	liableUserID := disputeLiableUserID(order, liableRole)
+
+	var settlement *model.OrderSettlement
+	if existing, err := s.settlementRepo.GetSettlementByOrder(order.ID); err == nil {
+		settlement = existing
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if settlement != nil && (refundAmount > 0 || input.PenaltyAmount > 0) &&
+		(settlement.Status == "confirmed" || settlement.Status == "settled") {
+		return nil, errors.New("订单结算已确认，无法按裁决调整，请线下处理")
+	}
+
+	now := time.Now()
+	err = s.disputeRepo.DB().Transaction(func(tx *gorm.DB) error {
+		updated, err := repository.NewDisputeRepo(tx).Transition(record.ID, repository.OpenDisputeStatuses, map[string]interface{}{
+			"status":          "resolved",
+			"resolution":      input.Resolution,
+			"refund_amount":   refundAmount,
+			"penalty_amount":  input.PenaltyAmount,
+			"liable_user_id":  liableUserID,
+			"liable_role":     liableRole,
+			"resolution_note": input.Note,
+			"resolved_by":     adminID,
+			"resolved_at":     &now,
+		})
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return errors.New("纠纷已结案")
+		}
+
+		if refundAmount > 0 {
+			if err := s.createDisputeRefunds(tx, order, refundAmount, input.Note); err != nil {
+				return err
+			}
+		}
+		if settlement != nil && settlement.Status == "calculated" && (refundAmount > 0 || input.PenaltyAmount > 0) {
+			if _, err := repository.NewSettlementRepo(tx).TransitionSettlement(settlement.ID, "calculated", map[string]interface{}{
+				"status":        "pending",
+				"attempts":      0,
+				"last_error":    "",
+				"next_retry_at": nil,
+			}); err != nil {
+				return err
+			}
+		}
+
+		note := fmt.Sprintf("纠纷裁决: %s", disputeResolutionLabel(input.Resolution))
+		if refundAmount > 0 {
+			note = fmt.Sprintf("%s；退款 %d 分", note, refundAmount)
+		}
+		if input.PenaltyAmount > 0 {
+			note = fmt.Sprintf("%s；责任方罚金 %d 分", note, input.PenaltyAmount)
+		}
+		return repository.NewOrderRepo(tx).AddTimeline(&model.OrderTimeline{
+			OrderID: order.ID, Status: order.Status, Note: note,
+			OperatorID: adminID, OperatorType: "admin",
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := s.disputeRepo.GetByID(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if s.creditService != nil && liableUserID > 0 && input.Resolution != DisputeResolutionDismiss {
+		if err := s.creditService.OnDisputeResolved(resolved, liableUserID, liableRole); err != nil {
+			s.logger.Warn("record dispute credit event failed", zap.Int64("dispute_id", resolved.ID), zap.Error(err))
+		}
+	}
+	if s.eventService != nil {
+		s.eventService.NotifyDisputeUpdated(resolved, order, "dispute_resolved", "订单纠纷已裁决",
+			fmt.Sprintf("订单%s的纠纷已裁决：%s。", order.OrderNo, disputeResolutionLabel(input.Resolution)),
+			[]int64{resolved.InitiatorUserID, resolved.RespondentUserID})
+	}
+	return resolved, nil
+}
+
+// createDisputeRefunds 按支付记录生成裁决退款，订单已有退款记录时不能重复退款
+func (s *DisputeService) createDisputeRefunds(tx *gorm.DB, order *model.Order, amount int64, note string) error {
+	artifactRepo := repository.NewOrderArtifactRepo(tx)
+	existing, err := artifactRepo.ListRefundsByOrder(order.ID)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return errors.New("订单已有退款记录，不能重复退款")
+	}
+	payments, err := repository.NewPaymentRepo(tx).GetByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+	refunds, err := s.orderService.buildRefundPlans(order.ID, amount, note, "纠纷裁决退款", payments)
+	if err != nil {
+		return err
+	}
+	for _, refund := range refunds {
+		if err := artifactRepo.CreateRefund(refund); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessDisputeSLA 答辩逾期的纠纷直接进入仲裁；超过处理时限的纠纷标记超时并提醒仲裁员或管理员
+func (s *DisputeService) ProcessDisputeSLA(now time.Time, limit int) (int, error) {
+	processed := 0
+	overdue, err := s.disputeRepo.ListResponseOverdue(now, limit)
+	if err != nil {
+		return 0, err
+	}
+	for i := range overdue {
+		record := &overdue[i]
+		updated, err := s.disputeRepo.Transition(record.ID, []string{"open"}, map[string]interface{}{"status": "arbitrating"})
+		if err != nil {
+			return processed, err
+		}
+		if !updated {
+			continue
+		}
+		if err := s.disputeRepo.CreateEvidence(&model.DisputeEvidence{
+			DisputeID:     record.ID,
+			OrderID:       record.OrderID,
+			SubmitterRole: "system",
+			EvidenceType:  "statement",
+			Content:       "被申诉方未在答辩期内答辩，纠纷进入仲裁",
+		}); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+
+	breached, err := s.disputeRepo.ListResolutionOverdue(now, limit)
+	if err != nil {
+		return processed, err
+	}
+	for i := range breached {
+		record := &breached[i]
+		updated, err := s.disputeRepo.Transition(record.ID, repository.OpenDisputeStatuses, map[string]interface{}{"sla_breached": true})
+		if err != nil {
+			return processed, err
+		}
+		if !updated {
+			continue
+		}
+		recipients := []int64{record.ArbitratorID}
+		if record.ArbitratorID <= 0 && s.flightRepo != nil {
+			if recipients, err = s.flightRepo.ListActiveAdminUserIDs(); err != nil {
+				s.logger.Warn("list admins for dispute sla failed", zap.Error(err))
+			}
+		}
+		if s.eventService != nil {
+			s.eventService.NotifyDisputeUpdated(record, nil, "dispute_sla_breached", "纠纷处理超时",
+				fmt.Sprintf("纠纷#%d已超过处理时限(%s)，请尽快裁决。", record.ID, formatDisputeDue(record.ResolutionDueAt)), recipients)
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func (s *DisputeService) AdminListDisputes(page, pageSize int, filters map[string]interface{}) ([]model.DisputeRecord, int64, error) {
+	return s.disputeRepo.List(page, pageSize, filters)
+}
+
+func (s *DisputeService) loadParticipantDispute(orderID, disputeID, userID int64) (*model.DisputeRecord, *model.Order, error) {
+	record, err := s.disputeRepo.GetByID(disputeID)
+	if err != nil || record.OrderID != orderID {
+		return nil, nil, errors.New("纠纷不存在")
+	}
+	order, err := s.orderService.orderRepo.GetByID(orderID)
+	if err != nil {
+		return nil, nil, errors.New("订单不存在")
+	}
+	if !s.orderService.CanAccessOrder(order, userID, "") {
+		return nil, nil, errors.New("无权查看该纠纷")
+	}
+	return record, order, nil
+}
+
+// validateDisputeResolution 校验裁决并返回退款金额与责任方角色
+func validateDisputeResolution(order *model.Order, input *DisputeResolutionInput) (int64, string, error) {
+	liableRole := normalizeOrderRole(input.LiableRole)
+	if input.LiableRole != "" && liableRole == "" {
+		return 0, "", fmt.Errorf("未知的责任方: %s", input.LiableRole)
+	}
+	if input.RefundAmount < 0 || input.PenaltyAmount < 0 {
+		return 0, "", errors.New("金额不能为负数")
+	}
+
+	var refundAmount int64
+	switch input.Resolution {
+	case DisputeResolutionFullRefund:
+		refundAmount = order.PayableAmount()
+		liableRole = firstNonEmpty(liableRole, "owner")
+	case DisputeResolutionPartialRefund:
+		if input.RefundAmount <= 0 || input.RefundAmount >= order.PayableAmount() {
+			return 0, "", errors.New("部分退款金额须大于0且小于订单实付金额")
+		}
+		refundAmount = input.RefundAmount
+		liableRole = firstNonEmpty(liableRole, "owner")
+	case DisputeResolutionPenalty:
+		if input.PenaltyAmount <= 0 {
+			return 0, "", errors.New("请填写罚金金额")
+		}
+	case DisputeResolutionDismiss:
+		if input.RefundAmount > 0 || input.PenaltyAmount > 0 {
+			return 0, "", errors.New("驳回纠纷不能设置退款或罚金")
+		}
+	default:
+		return 0, "", fmt.Errorf("未知的裁决结果: %s", input.Resolution)
+	}
+	if input.PenaltyAmount > 0 && liableRole != "owner" && liableRole != "pilot" {
+		return 0, "", errors.New("罚金仅适用于机主或飞手")
+	}
+	return refundAmount, liableRole, nil
+}
+
+func disputeLiableUserID(order *model.Order, role string) int64 {
+	switch role {
+	case "client":
+		return orderClientUserID(order)
+	case "owner":
+		return orderProviderUserID(order)
+	case "pilot":
+		return order.ExecutorPilotUserID
+	}
+	return 0
+}
+
+// disputeParticipantRole 用户在订单中的角色，同时为机主与执行飞手时按机主
+func disputeParticipantRole(order *model.Order, userID int64) string {
+	switch {
+	case userID == order.ClientUserID || userID == order.RenterID:
+		return "client"
+	case userID == order.ProviderUserID || userID == order.OwnerID || userID == order.DroneOwnerUserID:
+		return "owner"
+	case userID == order.ExecutorPilotUserID:
+		return "pilot"
+	}
+	return ""
+}
+
+func isDisputeOpen(status string) bool {
+	for _, open := range repository.OpenDisputeStatuses {
+		if status == open {
+			return true
+		}
+	}
+	return false
+}
+
+func disputeResolutionLabel(resolution string) string {
+	switch resolution {
+	case DisputeResolutionFullRefund:
+		return "全额退款"
+	case DisputeResolutionPartialRefund:
+		return "部分退款"
+	case DisputeResolutionPenalty:
+		return "责任方罚款"
+	case DisputeResolutionDismiss:
+		return "驳回申诉"
+	}
+	return resolution
+}
+
+func formatDisputeDue(due *time.Time) string {
+	if due == nil {
+		return "-"
+	}
+	return due.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestDisputeLifecycleAdjustsSettlementAndCredit(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderTimeline{}, &model.Payment{}, &model.Refund{}, &model.DisputeRecord{}, &model.DisputeEvidence{},
+		&model.OrderSettlement{}, &model.PricingConfig{}, &model.FlightRecord{}, &model.FlightPosition{}, &model.FlightAlert{},
+		&model.CreditScore{}, &model.CreditScoreLog{}, &model.CreditEvent{},
+	)
+	orderService := &OrderService{orderRepo: repository.NewOrderRepo(db), orderArtifactRepo: repository.NewOrderArtifactRepo(db)}
+	settlementRepo := repository.NewSettlementRepo(db)
+	disputes := NewDisputeService(repository.NewDisputeRepo(db), orderService, settlementRepo, config.DisputeConfig{}, zap.NewNop())
+	disputes.SetFlightRepo(repository.NewFlightRepo(db))
+	disputes.SetCreditService(NewCreditService(repository.NewCreditRepository(db)))
+	orderService.SetDisputeService(disputes)
+	settlements := NewSettlementService(settlementRepo, repository.NewOrderRepo(db), zap.NewNop())
+
+	completedAt := time.Now().Add(-2 * time.Hour)
+	paidAt := completedAt.Add(-24 * time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-DISPUTE-1", Title: "纠纷测试单", ClientUserID: 11, ProviderUserID: 21, OwnerID: 21, ExecutorPilotUserID: 31,
+		TotalAmount: 100000, Status: "completed", PaidAt: &paidAt, CompletedAt: &completedAt,
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if err := db.Create(&model.Payment{
+		PaymentNo: "PAY-WRJ-DISPUTE-1", OrderID: order.ID, UserID: 11, PaymentType: "order",
+		PaymentMethod: "mock", Amount: order.TotalAmount, Status: "paid", PaidAt: &paidAt,
+	}).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	flight := &model.FlightRecord{FlightNo: "FL-DISPUTE-1", OrderID: order.ID, PilotUserID: 31, DroneID: 1, TotalDistanceM: 5000, Status: "completed"}
+	if err := db.Create(flight).Error; err != nil {
+		t.Fatalf("create flight: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Create(&model.FlightPosition{FlightRecordID: &flight.ID, OrderID: order.ID, DroneID: 1, Latitude: 23.1 + float64(i)/100, Longitude: 113.3, RecordedAt: time.Now().Add(time.Duration(i) * time.Minute)}).Error; err != nil {
+			t.Fatalf("create position: %v", err)
+		}
+	}
+	if err := db.Create(&model.FlightAlert{FlightRecordID: &flight.ID, OrderID: order.ID, DroneID: 1, AlertType: "altitude", AlertLevel: "warning", Title: "超高", TriggeredAt: time.Now()}).Error; err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+
+	// 结算已进入争议期
+	if err := settlements.EnqueueSettlement(order.ID); err != nil {
+		t.Fatalf("enqueue settlement: %v", err)
+	}
+	if _, err := settlements.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+
+	record, err := disputes.orderService.CreateDispute(order.ID, 11, "cargo_damage", "货物外箱破损")
+	if err != nil {
+		t.Fatalf("create dispute: %v", err)
+	}
+	if record.RespondentUserID != 21 || record.InitiatorRole != "client" || record.ResponseDueAt == nil {
+		t.Fatalf("expected respondent and due dates, got %+v", record)
+	}
+	if _, err := disputes.SubmitResponse(order.ID, record.ID, 11, "自己答辩"); err == nil {
+		t.Fatal("expected initiator to be rejected as respondent")
+	}
+	if _, err := disputes.SubmitResponse(order.ID, record.ID, 21, "起飞前已拍照确认包装完好"); err != nil {
+		t.Fatalf("submit response: %v", err)
+	}
+	if _, err := disputes.AssignArbitrator(record.ID, 99); err != nil {
+		t.Fatalf("assign arbitrator: %v", err)
+	}
+	detail, err := disputes.GetDispute(order.ID, record.ID, 31)
+	if err != nil {
+		t.Fatalf("get dispute: %v", err)
+	}
+	if detail.Dispute.Status != "arbitrating" || len(detail.Evidences) != 3 {
+		t.Fatalf("expected flight track, alerts and counter statement, got status=%s evidences=%d", detail.Dispute.Status, len(detail.Evidences))
+	}
+
+	resolved, err := disputes.ResolveDispute(record.ID, 99, &DisputeResolutionInput{
+		Resolution: DisputeResolutionPartialRefund, RefundAmount: 20000, PenaltyAmount: 5000, LiableRole: "pilot", Note: "降落过重导致破损",
+	})
+	if err != nil {
+		t.Fatalf("resolve dispute: %v", err)
+	}
+	if resolved.Status != "resolved" || resolved.LiableUserID != 31 {
+		t.Fatalf("unexpected resolved dispute: %+v", resolved)
+	}
+
+	var refunds []model.Refund
+	if err := db.Where("order_id = ?", order.ID).Find(&refunds).Error; err != nil || len(refunds) != 1 || refunds[0].Amount != 20000 {
+		t.Fatalf("expected one 20000 refund, got %+v, %v", refunds, err)
+	}
+	settlement, err := settlements.GetSettlementByOrder(order.ID)
+	if err != nil || settlement.Status != "pending" {
+		t.Fatalf("expected settlement back to pending, got %+v, %v", settlement, err)
+	}
+	if _, err := settlements.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("rerun pipeline: %v", err)
+	}
+	settlement, _ = settlements.GetSettlementByOrder(order.ID)
+	// 80000 扣除平台 10%、保险 5% 后飞手 45/85、机主 40/85 分配，飞手再扣 5000 罚金归平台
+	if settlement.FinalAmount != 80000 || settlement.PilotFee != 36000-5000 || settlement.OwnerFee != 32000 || settlement.PlatformFee != 8000+5000 {
+		t.Fatalf("unexpected adjusted settlement: final=%d pilot=%d owner=%d platform=%d", settlement.FinalAmount, settlement.PilotFee, settlement.OwnerFee, settlement.PlatformFee)
+	}
+
+	var event model.CreditEvent
+	if err := db.Where("event_type = ? AND user_id = ?", CreditEventDisputeLost, 31).First(&event).Error; err != nil || event.RelatedID != record.ID {
+		t.Fatalf("expected dispute credit event for pilot, got %+v, %v", event, err)
+	}
+}
+
+func TestDisputeSLAEscalatesOverdueDisputes(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderTimeline{}, &model.Payment{}, &model.Refund{}, &model.DisputeRecord{}, &model.DisputeEvidence{},
+		&model.OrderSettlement{}, &model.PricingConfig{}, &model.FlightRecord{}, &model.FlightPosition{}, &model.FlightAlert{},
+		&model.CreditScore{}, &model.CreditScoreLog{}, &model.CreditEvent{},
+	)
+	orderService := &OrderService{orderRepo: repository.NewOrderRepo(db), orderArtifactRepo: repository.NewOrderArtifactRepo(db)}
+	settlementRepo := repository.NewSettlementRepo(db)
+	disputes := NewDisputeService(repository.NewDisputeRepo(db), orderService, settlementRepo, config.DisputeConfig{}, zap.NewNop())
+	disputes.SetFlightRepo(repository.NewFlightRepo(db))
+	disputes.SetCreditService(NewCreditService(repository.NewCreditRepository(db)))
+	orderService.SetDisputeService(disputes)
+
+	completedAt := time.Now().Add(-2 * time.Hour)
+	paidAt := completedAt.Add(-24 * time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-DISPUTE-2", Title: "纠纷测试单", ClientUserID: 11, ProviderUserID: 21, OwnerID: 21, ExecutorPilotUserID: 31,
+		TotalAmount: 100000, Status: "completed", PaidAt: &paidAt, CompletedAt: &completedAt,
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if err := db.Create(&model.Payment{
+		PaymentNo: "PAY-WRJ-DISPUTE-2", OrderID: order.ID, UserID: 11, PaymentType: "order",
+		PaymentMethod: "mock", Amount: order.TotalAmount, Status: "paid", PaidAt: &paidAt,
+	}).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	record, err := disputes.orderService.CreateDispute(order.ID, 21, "payment", "客户拒绝确认完成")
+	if err != nil {
+		t.Fatalf("create dispute: %v", err)
+	}
+	if record.RespondentUserID != 11 {
+		t.Fatalf("expected client as respondent, got %d", record.RespondentUserID)
+	}
+
+	processed, err := disputes.ProcessDisputeSLA(time.Now().Add(49*time.Hour), 10)
+	if err != nil || processed != 1 {
+		t.Fatalf("expected response overdue escalation, got %d, %v", processed, err)
+	}
+	escalated, _ := disputes.disputeRepo.GetByID(record.ID)
+	if escalated.Status != "arbitrating" || escalated.SLABreached {
+		t.Fatalf("expected dispute moved to arbitration queue, got %+v", escalated)
+	}
+
+	processed, err = disputes.ProcessDisputeSLA(time.Now().Add(8*24*time.Hour), 10)
+	if err != nil || processed != 1 {
+		t.Fatalf("expected resolution overdue flag, got %d, %v", processed, err)
+	}
+	breached, _ := disputes.disputeRepo.GetByID(record.ID)
+	if !breached.SLABreached {
+		t.Fatalf("expected sla breached flag, got %+v", breached)
+	}
+	if processed, _ := disputes.ProcessDisputeSLA(time.Now().Add(9*24*time.Hour), 10); processed != 0 {
+		t.Fatalf("expected breached dispute to be flagged once, got %d", processed)
+	}
+
+	if _, err := disputes.ResolveDispute(record.ID, 99, &DisputeResolutionInput{Resolution: DisputeResolutionDismiss, LiableRole: "client"}); err != nil {
+		t.Fatalf("dismiss dispute: %v", err)
+	}
+	var count int64
+	db.Model(&model.Refund{}).Where("order_id = ?", order.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected dismissal without refunds, got %d", count)
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,6 +16,7 @@ type DroneService struct {
 	roleProfileRepo *repository.RoleProfileRepo
 	ownerDomainRepo *repository.OwnerDomainRepo
 	eventService    *EventService
+	maintenance     *MaintenancePlannerService
 }
 
 func NewDroneService(
@@ -33,6 +35,10 @@ func (s *DroneService) SetEventService(eventService *EventService) {
 	s.eventService = eventService
 }
 
+func (s *DroneService) SetMaintenancePlanner(planner *MaintenancePlannerService) {
+	s.maintenance = planner
+}
+
 func (s *DroneService) Create(drone *model.Drone) error {
 	if drone == nil {
 		return errors.New("无人机参数不能为空")
@@ -80,6 +86,9 @@ func (s *DroneService) Update(userID int64, drone *model.Drone) error {
 	if existing.OwnerID != userID {
 		return errors.New("无权修改此无人机")
 	}
+	if drone.MavlinkSystemID < 0 || drone.MavlinkSystemID > 255 {
+		return errors.New("MAVLink 系统ID需在1~255之间，0 表示未接入")
+	}
 	s.normalizeCapacityFields(drone)
 
 	// 保留不可变字段，防止前端传零值覆盖
@@ -147,6 +156,18 @@ func (s *DroneService) UpdateAvailability(userID, droneID int64, status string)
 	if existing.OwnerID != userID {
 		return errors.New("无权操作此无人机")
 	}
+	if status == "available" && existing.NextMaintenanceDate != nil && !existing.NextMaintenanceDate.After(time.Now()) {
+		return errors.New("已超过预定维护日期，请先登记维护记录")
+	}
+	if status == "available" && s.maintenance != nil {
+		component, err := s.maintenance.GroundedReason(droneID)
+		if err != nil {
+			return err
+		}
+		if component != "" {
+			return fmt.Errorf("%s已超过强制维护上限，请先登记维护记录", component)
+		}
+	}
 	db := s.droneRepo.DB()
 	if db == nil {
 		return s.droneRepo.UpdateFields(droneID, map[string]interface{}{"availability_status": status})
@@ -388,6 +409,7 @@ type AddMaintenanceReq struct {
 	AfterImages         []string   `json:"after_images"`
 	ReportDoc           string     `json:"report_doc"`
 	NextMaintenanceDate *time.Time `json:"next_maintenance_date"`
+	Components          []string   `json:"components"` // 本次维护的部件，为空时视为处理全部未完成的维护工单
 }
 
 // AddMaintenanceLog 添加维护记录
@@ -422,9 +444,16 @@ func (s *DroneService) AddMaintenanceLog(userID, droneID int64, req *AddMaintena
 	}
 	if req.NextMaintenanceDate != nil {
 		updates["next_maintenance_date"] = req.NextMaintenanceDate
+		existing.NextMaintenanceDate = req.NextMaintenanceDate
 	}
 	s.droneRepo.UpdateFields(droneID, updates)
 
+	if s.maintenance != nil {
+		if err := s.maintenance.RecordService(existing, log, req.Components, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
 	return log, nil
 }
 
@@ -2,16 +2,19 @@ package service
 
 import (
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 
 	"wurenji-backend/internal/model"
 	"wurenji-backend/internal/pkg/push"
+	ws "wurenji-backend/internal/websocket"
 )
 
 type EventService struct {
 	messageService *MessageService
 	pushService    push.PushService
+	realtime       ws.Publisher
 	logger         *zap.Logger
 }
 
@@ -35,6 +38,16 @@ var pushEventAllowlist = map[string]struct{}{
 	"drone_uom_reviewed":           {},
 	"drone_insurance_reviewed":     {},
 	"drone_airworthiness_reviewed": {},
+	"credential_expiring":          {},
+	"credential_expired":           {},
+	"maintenance_due":              {},
+	"maintenance_grounded":         {},
+	"battery_retired":              {},
+	"flight_alert":                 {},
+	"flight_alert_escalated":       {},
+	"multipoint_stop_eta":          {},
+	"dispute_opened":               {},
+	"dispute_resolved":             {},
 }
 
 func NewEventService(messageService *MessageService, pushService push.PushService, logger *zap.Logger) *EventService {
@@ -45,6 +58,10 @@ func NewEventService(messageService *MessageService, pushService push.PushServic
 	}
 }
 
+func (s *EventService) SetRealtimePublisher(publisher ws.Publisher) {
+	s.realtime = publisher
+}
+
 func (s *EventService) NotifyDemandQuoteSubmitted(demand *model.Demand, quote *model.DemandQuote) {
 	if demand == nil || quote == nil {
 		return
@@ -278,6 +295,7 @@ func (s *EventService) NotifyOrderPaid(order *model.Order) {
 	clientUserID := orderPrimaryClientUserID(order)
 	providerUserID := orderProviderUserID(order)
 	recipients := uniqueUserIDs(order.ProviderUserID, order.OwnerID)
+	s.publishOrderEvent(order, "order_paid")
 	s.notifyUsers(recipients, "order_paid", "订单已支付",
 		fmt.Sprintf("订单“%s”已完成支付，请准备执行。", fallbackTitle(order.Title, order.OrderNo, "订单")),
 		map[string]interface{}{
@@ -308,6 +326,7 @@ func (s *EventService) NotifyOrderStatusChanged(order *model.Order, eventType, t
 	if order.ProviderUserID > 0 {
 		recipients = uniqueUserIDs(append(recipients, order.ProviderUserID)...)
 	}
+	s.publishOrderEvent(order, eventType)
 	s.notifyUsers(recipients, eventType, title, content, map[string]interface{}{
 		"order_id":      order.ID,
 		"order_no":      order.OrderNo,
@@ -361,6 +380,7 @@ func (s *EventService) NotifyDispatchCreated(task *model.FormalDispatchTask, ord
 		orderNo = order.OrderNo
 		orderID = order.ID
 	}
+	s.publishDispatchEvent(task, "dispatch_created")
 	s.notifyUsers([]int64{task.TargetPilotUserID}, "dispatch_created", "收到正式派单",
 		fmt.Sprintf("您收到正式派单 %s，请尽快响应。", fallbackTitle(task.DispatchNo, fmt.Sprintf("%d", task.ID), "派单")),
 		map[string]interface{}{
@@ -403,6 +423,8 @@ func (s *EventService) NotifyDispatchAccepted(task *model.FormalDispatchTask, or
 		recipients = append(recipients, order.ProviderUserID)
 		recipients = append(recipients, orderClientReceivers(order)...)
 	}
+	s.publishDispatchEvent(task, "dispatch_accepted")
+	s.publishOrderEvent(order, "dispatch_accepted")
 	s.notifyUsers(recipients, "dispatch_accepted", "正式派单已接受",
 		fmt.Sprintf("正式派单 %s 已被飞手接受。", fallbackTitle(task.DispatchNo, fmt.Sprintf("%d", task.ID), "派单")),
 		map[string]interface{}{
@@ -445,6 +467,7 @@ func (s *EventService) NotifyDispatchReassigned(order *model.Order, newTask *mod
 	if order == nil || newTask == nil {
 		return
 	}
+	s.publishOrderEvent(order, "dispatch_reassigned")
 	s.notifyUsers([]int64{order.ProviderUserID}, "dispatch_reassigned", "派单已自动重派",
 		fmt.Sprintf("订单“%s”触发自动重派，系统已向新的飞手发起正式派单。", fallbackTitle(order.Title, order.OrderNo, "订单")),
 		map[string]interface{}{
@@ -459,6 +482,14 @@ func (s *EventService) NotifyDispatchReassigned(order *model.Order, newTask *mod
 	)
 }
 
+// NotifyDispatchClosed 派单被拒绝/超时/异常回退/重派后通知原飞手撤下派单卡片，仅实时推送
+func (s *EventService) NotifyDispatchClosed(task *model.FormalDispatchTask) {
+	if task == nil {
+		return
+	}
+	s.publishDispatchEvent(task, "dispatch_closed")
+}
+
 func (s *EventService) NotifyDispatchManualRequired(order *model.Order, reason string) {
 	if order == nil {
 		return
@@ -572,6 +603,167 @@ func (s *EventService) NotifyDroneQualification(drone *model.Drone, eventType, t
 	})
 }
 
+// NotifyCredentialExpiry 证照到期前提醒，或到期后告知已停止接单/暂停供给
+func (s *EventService) NotifyCredentialExpiry(item *CredentialExpiryItem, expired bool) {
+	if item == nil {
+		return
+	}
+	owner := "您的"
+	if item.SubjectType == CredentialSubjectDrone {
+		owner = fmt.Sprintf("无人机 %s 的", item.SubjectName)
+	}
+	expireDate := item.ExpireDate.Format("2006-01-02")
+	eventType := "credential_expiring"
+	title := fmt.Sprintf("%s即将到期", item.CredentialName)
+	content := fmt.Sprintf("%s%s将于%s到期（剩余%d天），请及时更新并提交审核。", owner, item.CredentialName, expireDate, item.DaysLeft)
+	if expired {
+		eventType = "credential_expired"
+		title = fmt.Sprintf("%s已到期", item.CredentialName)
+		content = fmt.Sprintf("%s%s已于%s到期，已暂停接单与上架，更新后可恢复。", owner, item.CredentialName, expireDate)
+		if item.CredentialType == CredentialMaintenance {
+			content = fmt.Sprintf("%s定期维护已于%s到期，已转入维护状态并暂停上架，登记维护后可恢复。", owner, expireDate)
+		}
+	}
+	s.notifyUsers([]int64{item.UserID}, eventType, title, content, map[string]interface{}{
+		"subject_type":    item.SubjectType,
+		"subject_id":      item.SubjectID,
+		"credential_type": item.CredentialType,
+		"credential_id":   item.CredentialID,
+		"expire_date":     expireDate,
+		"days_left":       item.DaysLeft,
+		"business_type":   "qualification",
+	})
+}
+
+// NotifyMaintenanceWorkOrder 维护工单生成、升级或因超过强制上限停飞时通知机主
+func (s *EventService) NotifyMaintenanceWorkOrder(order *model.MaintenanceWorkOrder, drone *model.Drone, grounded bool) {
+	if order == nil || drone == nil {
+		return
+	}
+	droneName := droneDisplayName(drone)
+	eventType := "maintenance_due"
+	title := fmt.Sprintf("%s即将需要维护", order.ComponentName)
+	content := fmt.Sprintf("无人机 %s 的%s使用量已达%.2f（维护间隔%.2f），请尽快安排维护。", droneName, order.ComponentName, order.UsageValue, order.IntervalValue)
+	switch {
+	case grounded:
+		eventType = "maintenance_grounded"
+		title = fmt.Sprintf("%s超过维护上限，无人机已停飞", order.ComponentName)
+		content = fmt.Sprintf("无人机 %s 的%s使用量已达%.2f，超过强制维护上限%.2f，已转入维护状态并暂停接单与上架，登记维护后可恢复。",
+			droneName, order.ComponentName, order.UsageValue, order.HardLimit)
+	case order.Level != MaintenanceLevelDueSoon:
+		title = fmt.Sprintf("%s已到维护期", order.ComponentName)
+	}
+	s.notifyUsers([]int64{order.OwnerID}, eventType, title, content, map[string]interface{}{
+		"work_order_id": order.ID,
+		"work_order_no": order.WorkOrderNo,
+		"drone_id":      order.DroneID,
+		"component":     order.Component,
+		"level":         order.Level,
+		"business_type": "maintenance",
+	})
+}
+
+// NotifyBatteryRetired 电池包自动退役时通知机主
+func (s *EventService) NotifyBatteryRetired(pack *model.BatteryPack) {
+	if pack == nil {
+		return
+	}
+	s.notifyUsers([]int64{pack.OwnerID}, "battery_retired", "电池包已退役",
+		fmt.Sprintf("电池包 %s %s，已自动退役，不能再用于起飞，请及时更换。", pack.SerialNumber, pack.RetireReason),
+		map[string]interface{}{
+			"battery_pack_id": pack.ID,
+			"serial_number":   pack.SerialNumber,
+			"drone_id":        pack.DroneID,
+			"health_percent":  pack.HealthPercent,
+			"cycle_count":     pack.CycleCount,
+			"business_type":   "maintenance",
+		})
+}
+
+// NotifyFlightAlert 飞行告警通知，recipient 为 pilot 时为首次通知，其余为未确认告警的升级通知
+func (s *EventService) NotifyFlightAlert(alert *model.FlightAlert, order *model.Order, recipient string, userIDs []int64) {
+	if alert == nil {
+		return
+	}
+	var flightRecordID int64
+	if alert.FlightRecordID != nil {
+		flightRecordID = *alert.FlightRecordID
+	}
+	eventType := "flight_alert"
+	title := fmt.Sprintf("飞行告警：%s", alert.Title)
+	content := fmt.Sprintf("订单%s %s", orderNoOrEmpty(order), alert.Description)
+	if recipient != "pilot" {
+		eventType = "flight_alert_escalated"
+		title = fmt.Sprintf("告警升级：%s", alert.Title)
+		content = fmt.Sprintf("订单%s 的%s告警已持续%s未确认：%s", orderNoOrEmpty(order), alertLevelLabel(alert.AlertLevel), formatAlertAge(alert), alert.Description)
+	}
+	s.notifyUsers(userIDs, eventType, title, content, map[string]interface{}{
+		"alert_id":         alert.ID,
+		"alert_code":       alert.AlertCode,
+		"alert_level":      alert.AlertLevel,
+		"order_id":         alert.OrderID,
+		"order_no":         orderNoOrEmpty(order),
+		"flight_record_id": flightRecordID,
+		"recipient":        recipient,
+		"escalation_level": alert.EscalationLevel,
+		"business_type":    "flight_alert",
+	})
+}
+
+// NotifyStopETA 多点任务离开上一站后通知收货人下一站预计到达时间
+func (s *EventService) NotifyStopETA(task *model.MultiPointTask, stop *model.MultiPointTaskStop, order *model.Order, eta time.Time, userIDs []int64) {
+	if task == nil || stop == nil {
+		return
+	}
+	place := stop.Address
+	if place == "" {
+		place = fmt.Sprintf("第%d站", stop.SequenceNo)
+	}
+	s.notifyUsers(userIDs, "multipoint_stop_eta", "无人机即将到达",
+		fmt.Sprintf("订单%s 的无人机已出发前往%s，预计 %s 到达。", orderNoOrEmpty(order), place, eta.Format("15:04")),
+		map[string]interface{}{
+			"task_id":          task.ID,
+			"stop_id":          stop.ID,
+			"sequence_no":      stop.SequenceNo,
+			"order_id":         task.OrderID,
+			"order_no":         orderNoOrEmpty(order),
+			"expected_arrival": eta.Format(time.RFC3339),
+			"business_type":    "multipoint_task",
+		})
+}
+
+// NotifyDisputeUpdated 通知纠纷当事人或仲裁员纠纷进展
+func (s *EventService) NotifyDisputeUpdated(dispute *model.DisputeRecord, order *model.Order, eventType, title, content string, userIDs []int64) {
+	if dispute == nil {
+		return
+	}
+	s.notifyUsers(userIDs, eventType, title, content, map[string]interface{}{
+		"dispute_id":    dispute.ID,
+		"order_id":      dispute.OrderID,
+		"order_no":      orderNoOrEmpty(order),
+		"status":        dispute.Status,
+		"business_type": "dispute",
+	})
+}
+
+func alertLevelLabel(level string) string {
+	switch level {
+	case "critical":
+		return "紧急"
+	case "warning":
+		return "预警"
+	}
+	return "提示"
+}
+
+func formatAlertAge(alert *model.FlightAlert) string {
+	age := time.Since(alert.TriggeredAt)
+	if age < time.Minute {
+		return fmt.Sprintf("%d秒", int(age.Seconds()))
+	}
+	return fmt.Sprintf("%d分钟", int(age.Minutes()))
+}
+
 func (s *EventService) notifyUsers(userIDs []int64, eventType, title, content string, extras map[string]interface{}) {
 	if s == nil {
 		return
@@ -597,6 +789,35 @@ func (s *EventService) notifyUsers(userIDs []int64, eventType, title, content st
 	}
 }
 
+// publishOrderEvent 发布订单事件到 order:<id> 主题
+func (s *EventService) publishOrderEvent(order *model.Order, eventType string) {
+	if s == nil || s.realtime == nil || order == nil {
+		return
+	}
+	s.realtime.Publish(ws.OrderTopic(order.ID), "order_update", map[string]interface{}{
+		"event_type":       eventType,
+		"order_id":         order.ID,
+		"order_no":         order.OrderNo,
+		"status":           order.Status,
+		"dispatch_task_id": order.DispatchTaskID,
+	})
+}
+
+// publishDispatchEvent 发布派单事件到目标飞手的 dispatch:pilot:<user_id> 主题
+func (s *EventService) publishDispatchEvent(task *model.FormalDispatchTask, eventType string) {
+	if s == nil || s.realtime == nil || task == nil || task.TargetPilotUserID <= 0 {
+		return
+	}
+	s.realtime.Publish(ws.DispatchPilotTopic(task.TargetPilotUserID), "dispatch_update", map[string]interface{}{
+		"event_type":       eventType,
+		"dispatch_task_id": task.ID,
+		"dispatch_no":      task.DispatchNo,
+		"order_id":         task.OrderID,
+		"dispatch_source":  task.DispatchSource,
+		"status":           task.Status,
+	})
+}
+
 func shouldSendPushEvent(eventType string) bool {
 	_, ok := pushEventAllowlist[eventType]
 	return ok
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	ws "wurenji-backend/internal/websocket"
+)
+
+// 告警通知对象
+const (
+	alertRecipientPilot = "pilot"
+	alertRecipientOwner = "owner"
+	alertRecipientAdmin = "admin"
+)
+
+// alertAutoResolveNote 条件恢复后自动解除的处理说明
+const alertAutoResolveNote = "条件已恢复，自动解除"
+
+// autoResolvableAlertCodes 由位置检查产生的告警码，后续位置不再触发时自动解除
+var autoResolvableAlertCodes = map[string]struct{}{
+	"BATT_CRIT":     {},
+	"BATT_WARN":     {},
+	"ALT_WARN":      {},
+	"SPEED_WARN":    {},
+	"SIG_WEAK":      {},
+	"GEO_VIOLATION": {},
+	"GEO_APPROACH":  {},
+}
+
+// alertEscalationSteps 各告警级别的逐级通知对象，未确认时每隔 AlertEscalationInterval 通知下一级
+var alertEscalationSteps = map[string][]string{
+	"critical": {alertRecipientPilot, alertRecipientOwner, alertRecipientAdmin},
+	"warning":  {alertRecipientPilot},
+}
+
+// saveAlerts 按 飞行+告警码 去重保存本次位置产生的告警，并自动解除条件已恢复的告警
+func (s *FlightService) saveAlerts(pos *model.FlightPosition, alerts []model.FlightAlert) []model.FlightAlert {
+	open, err := s.flightRepo.GetOpenAlertsForFlight(pos.FlightRecordID, pos.OrderID)
+	if err != nil {
+		s.logger.Warn("获取未关闭告警失败", zap.Int64("order_id", pos.OrderID), zap.Error(err))
+		open = nil
+	}
+	existing := make(map[string]*model.FlightAlert, len(open))
+	for i := range open {
+		if _, ok := existing[open[i].AlertCode]; !ok {
+			existing[open[i].AlertCode] = &open[i]
+		}
+	}
+
+	now := time.Now()
+	seen := make(map[string]struct{}, len(alerts))
+	created := make([]model.FlightAlert, 0, len(alerts))
+	for i := range alerts {
+		alert := &alerts[i]
+		if _, dup := seen[alert.AlertCode]; dup {
+			continue
+		}
+		seen[alert.AlertCode] = struct{}{}
+
+		if prev := existing[alert.AlertCode]; prev != nil {
+			err := s.flightRepo.UpdateAlertFields(prev.ID, map[string]interface{}{
+				"occurrence_count": prev.OccurrenceCount + 1,
+				"last_seen_at":     now,
+				"description":      alert.Description,
+				"actual_value":     alert.ActualValue,
+				"latitude":         alert.Latitude,
+				"longitude":        alert.Longitude,
+				"altitude":         alert.Altitude,
+			})
+			if err != nil {
+				s.logger.Warn("更新重复告警失败", zap.Int64("alert_id", prev.ID), zap.Error(err))
+			}
+			continue
+		}
+
+		alert.LastSeenAt = &now
+		s.prepareAlertEscalation(alert, now)
+		if err := s.flightRepo.CreateAlert(alert); err != nil {
+			s.logger.Warn("创建告警失败", zap.Int64("order_id", alert.OrderID), zap.String("alert_code", alert.AlertCode), zap.Error(err))
+			continue
+		}
+		s.notifyAlertStep(alert, 0)
+		created = append(created, *alert)
+	}
+
+	for i := range open {
+		alert := &open[i]
+		if _, ok := autoResolvableAlertCodes[alert.AlertCode]; !ok {
+			continue
+		}
+		if _, ok := seen[alert.AlertCode]; ok {
+			continue
+		}
+		if err := s.flightRepo.ResolveAlert(alert.ID, alertAutoResolveNote); err != nil {
+			s.logger.Warn("自动解除告警失败", zap.Int64("alert_id", alert.ID), zap.Error(err))
+			continue
+		}
+		alert.Status = "resolved"
+		alert.ResolvedAt = &now
+		alert.ResolutionNote = alertAutoResolveNote
+		alert.NextEscalationAt = nil
+		s.publishAlertEvent(alert, "flight_alert_resolved")
+	}
+
+	return created
+}
+
+// prepareAlertEscalation 新告警记为已通知第一级，存在后续级别时安排下次升级
+func (s *FlightService) prepareAlertEscalation(alert *model.FlightAlert, now time.Time) {
+	steps := alertEscalationSteps[alert.AlertLevel]
+	if len(steps) == 0 {
+		return
+	}
+	alert.EscalationLevel = 1
+	alert.NextEscalationAt = s.nextEscalationAt(len(steps), 1, now)
+}
+
+func (s *FlightService) nextEscalationAt(totalSteps, level int, now time.Time) *time.Time {
+	if level >= totalSteps {
+		return nil
+	}
+	interval := s.config.AlertEscalationInterval
+	if interval <= 0 {
+		interval = 60
+	}
+	next := now.Add(time.Duration(interval) * time.Second)
+	return &next
+}
+
+// EscalateAlerts 处理到达升级时间的未确认告警，通知下一级对象，返回升级的告警数
+func (s *FlightService) EscalateAlerts(limit int) (int, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	now := time.Now()
+	alerts, err := s.flightRepo.ListAlertsDueForEscalation(now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	escalated := 0
+	for i := range alerts {
+		alert := &alerts[i]
+		steps := alertEscalationSteps[alert.AlertLevel]
+		level := alert.EscalationLevel
+		if level >= len(steps) {
+			if _, err := s.flightRepo.AdvanceAlertEscalation(alert.ID, level, level, nil); err != nil {
+				return escalated, err
+			}
+			continue
+		}
+
+		next := s.nextEscalationAt(len(steps), level+1, now)
+		ok, err := s.flightRepo.AdvanceAlertEscalation(alert.ID, level, level+1, next)
+		if err != nil {
+			return escalated, err
+		}
+		if !ok {
+			continue // 已被确认或已由其他实例处理
+		}
+		alert.EscalationLevel = level + 1
+		alert.NextEscalationAt = next
+		s.notifyAlertStep(alert, level)
+		escalated++
+	}
+	return escalated, nil
+}
+
+// notifyAlertStep 通知告警升级策略中第 step 级的对象
+func (s *FlightService) notifyAlertStep(alert *model.FlightAlert, step int) {
+	steps := alertEscalationSteps[alert.AlertLevel]
+	if s.events == nil || step >= len(steps) {
+		return
+	}
+	order, err := s.orderRepo.GetByID(alert.OrderID)
+	if err != nil {
+		s.logger.Warn("告警通知获取订单失败", zap.Int64("alert_id", alert.ID), zap.Int64("order_id", alert.OrderID), zap.Error(err))
+		return
+	}
+	recipient := steps[step]
+	userIDs, err := s.alertRecipientUserIDs(alert, order, recipient)
+	if err != nil {
+		s.logger.Warn("告警通知对象解析失败", zap.Int64("alert_id", alert.ID), zap.String("recipient", recipient), zap.Error(err))
+		return
+	}
+	if len(userIDs) == 0 {
+		s.logger.Warn("告警升级无可通知对象", zap.Int64("alert_id", alert.ID), zap.String("recipient", recipient))
+		return
+	}
+	s.events.NotifyFlightAlert(alert, order, recipient, userIDs)
+}
+
+func (s *FlightService) alertRecipientUserIDs(alert *model.FlightAlert, order *model.Order, recipient string) ([]int64, error) {
+	switch recipient {
+	case alertRecipientPilot:
+		if alert.FlightRecordID != nil {
+			record, err := s.flightRepo.GetFlightRecordByID(*alert.FlightRecordID)
+			if err == nil && record.PilotUserID > 0 {
+				return []int64{record.PilotUserID}, nil
+			}
+		}
+		return uniqueUserIDs(orderExecutorUserID(order)), nil
+	case alertRecipientOwner:
+		return uniqueUserIDs(orderProviderUserID(order)), nil
+	case alertRecipientAdmin:
+		return s.onCallAdminUserIDs()
+	}
+	return nil, errors.New("未知的告警通知对象")
+}
+
+// onCallAdminUserIDs 值班管理员，未配置 alert_oncall_admin_ids 时通知全部启用的管理员
+func (s *FlightService) onCallAdminUserIDs() ([]int64, error) {
+	if raw, err := s.flightRepo.GetConfig("alert_oncall_admin_ids"); err == nil {
+		var ids []int64
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err == nil && id > 0 {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			return uniqueUserIDs(ids...), nil
+		}
+	}
+	return s.flightRepo.ListActiveAdminUserIDs()
+}
+
+// publishAlertEvent 推送告警状态变化到订单、飞行与管理端告警主题
+func (s *FlightService) publishAlertEvent(alert *model.FlightAlert, eventType string) {
+	if s.realtime == nil {
+		return
+	}
+	s.realtime.Publish(ws.OrderTopic(alert.OrderID), eventType, alert)
+	if alert.FlightRecordID != nil {
+		s.realtime.Publish(ws.FlightTopic(*alert.FlightRecordID), eventType, alert)
+	}
+	s.realtime.Publish(ws.AdminAlertsTopic, eventType, alert)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+type recordedPush struct {
+	userID    int64
+	eventType string
+}
+
+type recordingPushService struct {
+	pushes []recordedPush
+}
+
+func (p *recordingPushService) PushToUser(userID int64, title, content string, extras map[string]string) error {
+	p.pushes = append(p.pushes, recordedPush{userID: userID, eventType: extras["event_type"]})
+	return nil
+}
+
+func (p *recordingPushService) PushToAll(title, content string, extras map[string]string) error {
+	return nil
+}
+
+func (p *recordingPushService) RegisterDevice(userID int64, registrationID, platform string) error {
+	return nil
+}
+
+func (p *recordingPushService) usersFor(eventType string) []int64 {
+	var ids []int64
+	for _, push := range p.pushes {
+		if push.eventType == eventType {
+			ids = append(ids, push.userID)
+		}
+	}
+	return ids
+}
+
+func newAlertTestService(t *testing.T) (*FlightService, *recordingPushService, *model.Order, func(battery int) []model.FlightAlert) {
+	t.Helper()
+	db := newServiceTestDB(t, &model.Order{}, &model.FlightRecord{}, &model.FlightPosition{}, &model.FlightAlert{},
+		&model.Geofence{}, &model.User{}, &model.FlightMonitorConfig{})
+
+	start := time.Now().Add(-time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-ALERT-001", DroneID: 5, ClientUserID: 11, ProviderUserID: 31, ExecutorPilotUserID: 66,
+		Title: "告警升级", ServiceType: "cargo", StartTime: start, EndTime: start.Add(2 * time.Hour), Status: "in_transit",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	admins := []model.User{
+		{Phone: "13800000001", Nickname: "admin-a", UserType: "admin", Status: "active"},
+		{Phone: "13800000002", Nickname: "admin-b", UserType: "admin", Status: "suspended"},
+	}
+	if err := db.Create(&admins).Error; err != nil {
+		t.Fatalf("create admins: %v", err)
+	}
+
+	pusher := &recordingPushService{}
+	service := NewFlightService(repository.NewFlightRepo(db), repository.NewOrderRepo(db), nil, zap.NewNop())
+	service.SetEventService(NewEventService(nil, pusher, zap.NewNop()))
+
+	report := func(battery int) []model.FlightAlert {
+		_, alerts, err := service.ReportPosition(&ReportPositionRequest{
+			OrderID: order.ID, DroneID: 5, Latitude: 23.0, Longitude: 113.0, Altitude: 40,
+			BatteryLevel: battery, SignalStrength: 100,
+		})
+		if err != nil {
+			t.Fatalf("report position: %v", err)
+		}
+		return alerts
+	}
+	return service, pusher, order, report
+}
+
+func TestCheckAndCreateAlertsDeduplicatesAndAutoResolves(t *testing.T) {
+	service, pusher, order, report := newAlertTestService(t)
+
+	if alerts := report(10); len(alerts) != 1 || alerts[0].AlertCode != "BATT_CRIT" {
+		t.Fatalf("expected a new critical battery alert, got %#v", alerts)
+	}
+	if alerts := report(9); len(alerts) != 0 {
+		t.Fatalf("expected repeated condition to be de-duplicated, got %#v", alerts)
+	}
+
+	stored, err := service.GetAlertsByOrder(order.ID)
+	if err != nil {
+		t.Fatalf("get alerts: %v", err)
+	}
+	if len(stored) != 1 || stored[0].OccurrenceCount != 2 || stored[0].ActualValue != "9%" || stored[0].LastSeenAt == nil {
+		t.Fatalf("expected one alert with occurrence count 2, got %#v", stored)
+	}
+	if got := pusher.usersFor("flight_alert"); len(got) != 1 || got[0] != 66 {
+		t.Fatalf("expected pilot to be notified once, got %#v", pusher.pushes)
+	}
+
+	report(80)
+	resolved, _ := service.flightRepo.GetAlertByID(stored[0].ID)
+	if resolved.Status != "resolved" || resolved.ResolutionNote != alertAutoResolveNote || resolved.NextEscalationAt != nil {
+		t.Fatalf("expected alert auto resolved, got %#v", resolved)
+	}
+
+	if alerts := report(10); len(alerts) != 1 || alerts[0].ID == stored[0].ID {
+		t.Fatalf("expected a new alert after the condition recurs, got %#v", alerts)
+	}
+}
+
+func TestEscalateAlertsNotifiesOwnerThenAdminUntilAcknowledged(t *testing.T) {
+	service, pusher, order, report := newAlertTestService(t)
+
+	alert := report(10)[0]
+	if alert.EscalationLevel != 1 || alert.NextEscalationAt == nil {
+		t.Fatalf("expected escalation scheduled after first notification, got %#v", alert)
+	}
+
+	if n, err := service.EscalateAlerts(10); err != nil || n != 0 {
+		t.Fatalf("expected nothing due yet, got %d %v", n, err)
+	}
+
+	due := func() {
+		past := time.Now().Add(-time.Second)
+		if err := service.flightRepo.UpdateAlertFields(alert.ID, map[string]interface{}{"next_escalation_at": past}); err != nil {
+			t.Fatalf("rewind escalation: %v", err)
+		}
+	}
+
+	due()
+	if n, err := service.EscalateAlerts(10); err != nil || n != 1 {
+		t.Fatalf("expected owner escalation, got %d %v", n, err)
+	}
+	if got := pusher.usersFor("flight_alert_escalated"); len(got) != 1 || got[0] != order.ProviderUserID {
+		t.Fatalf("expected owner notified, got %#v", pusher.pushes)
+	}
+
+	due()
+	if n, err := service.EscalateAlerts(10); err != nil || n != 1 {
+		t.Fatalf("expected admin escalation, got %d %v", n, err)
+	}
+	got := pusher.usersFor("flight_alert_escalated")
+	if len(got) != 2 || got[1] != 1 {
+		t.Fatalf("expected active admin notified, got %#v", pusher.pushes)
+	}
+	final, _ := service.flightRepo.GetAlertByID(alert.ID)
+	if final.EscalationLevel != 3 || final.NextEscalationAt != nil {
+		t.Fatalf("expected escalation finished, got %#v", final)
+	}
+
+	second := report(10)
+	if len(second) != 0 {
+		t.Fatalf("expected no new alert while open, got %#v", second)
+	}
+}
+
+func TestAcknowledgeAlertStopsEscalation(t *testing.T) {
+	service, pusher, _, report := newAlertTestService(t)
+
+	alert := report(10)[0]
+	if err := service.AcknowledgeAlert(alert.ID, 66); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	acked, _ := service.flightRepo.GetAlertByID(alert.ID)
+	if acked.NextEscalationAt != nil {
+		t.Fatalf("expected acknowledge to clear next escalation, got %#v", acked)
+	}
+	past := time.Now().Add(-time.Second)
+	service.flightRepo.UpdateAlertFields(alert.ID, map[string]interface{}{"next_escalation_at": past})
+
+	if n, err := service.EscalateAlerts(10); err != nil || n != 0 {
+		t.Fatalf("expected acknowledged alert not escalated, got %d %v", n, err)
+	}
+	if got := pusher.usersFor("flight_alert_escalated"); len(got) != 0 {
+		t.Fatalf("expected no escalation notifications, got %#v", pusher.pushes)
+	}
+	stored, _ := service.flightRepo.GetAlertByID(alert.ID)
+	if stored.Status != "acknowledged" {
+		t.Fatalf("expected acknowledged alert, got %#v", stored)
+	}
+}
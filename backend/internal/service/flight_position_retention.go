@@ -0,0 +1,104 @@
+package service
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+)
+
+// positionDeleteChunk 单条 DELETE 语句删除的最大位置点数
+const positionDeleteChunk = 1000
+
+// PositionRetentionResult 位置点分级存储任务结果
+type PositionRetentionResult struct {
+	Downsampled int   // 本次降采样的飞行记录数
+	Removed     int64 // 降采样删除的位置点数
+	Expired     int64 // 超过最长保留期删除的位置点数
+}
+
+// RunPositionRetention 位置点分级存储：
+// 结束超过全精度保留期的飞行按 Douglas-Peucker 简化轨迹，只保留关键点；
+// 配置了最长保留期时删除更早的位置点
+func (s *FlightService) RunPositionRetention(limit int) (*PositionRetentionResult, error) {
+	result := &PositionRetentionResult{}
+	fullResDays := s.config.PositionFullResDays
+	if fullResDays <= 0 {
+		fullResDays = 7
+	}
+	cutoff := time.Now().AddDate(0, 0, -fullResDays)
+
+	records, err := s.flightRepo.ListFlightRecordsForDownsampling(cutoff, limit)
+	if err != nil {
+		return result, err
+	}
+	for i := range records {
+		removed, err := s.downsampleFlightRecordPositions(&records[i])
+		if err != nil {
+			return result, err
+		}
+		result.Downsampled++
+		result.Removed += removed
+	}
+
+	if s.config.PositionRetentionDays > 0 && s.config.PositionRetentionDays > fullResDays {
+		expired, err := s.flightRepo.DeleteOldPositions(s.config.PositionRetentionDays)
+		if err != nil {
+			return result, err
+		}
+		result.Expired = expired
+	}
+
+	if result.Downsampled > 0 || result.Expired > 0 {
+		s.logger.Info("飞行位置分级存储完成",
+			zap.Int("downsampled_records", result.Downsampled),
+			zap.Int64("removed_positions", result.Removed),
+			zap.Int64("expired_positions", result.Expired))
+	}
+	return result, nil
+}
+
+// downsampleFlightRecordPositions 简化单条飞行记录的位置点，返回删除条数
+func (s *FlightService) downsampleFlightRecordPositions(record *model.FlightRecord) (int64, error) {
+	positions, err := s.flightRepo.GetPositionsByFlightRecord(record.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	if len(positions) > 2 {
+		waypoints := make([]model.FlightWaypoint, len(positions))
+		for i := range positions {
+			waypoints[i] = model.FlightWaypoint{
+				Latitude:  positions[i].Latitude,
+				Longitude: positions[i].Longitude,
+				Altitude:  positions[i].Altitude,
+			}
+		}
+		keep := make(map[int]bool, len(positions))
+		for _, idx := range douglasPeuckerIndices(waypoints, float64(s.config.TrajectorySimpTolerance)) {
+			keep[idx] = true
+		}
+
+		drop := make([]int64, 0, len(positions)-len(keep))
+		for i := range positions {
+			if !keep[i] {
+				drop = append(drop, positions[i].ID)
+			}
+		}
+		for start := 0; start < len(drop); start += positionDeleteChunk {
+			end := min(start+positionDeleteChunk, len(drop))
+			n, err := s.flightRepo.DeletePositionsByIDs(drop[start:end])
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		}
+	}
+
+	if err := s.flightRepo.MarkPositionsDownsampled(record.ID, time.Now()); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestRunPositionRetentionDownsamplesOldFlights(t *testing.T) {
+	db := newServiceTestDB(t, &model.FlightRecord{}, &model.FlightPosition{})
+
+	oldLanding := time.Now().AddDate(0, 0, -10)
+	recentLanding := time.Now().AddDate(0, 0, -1)
+	oldFlight := &model.FlightRecord{FlightNo: "WRJ-RET-F1", OrderID: 1, DroneID: 2, Status: "completed", LandingAt: &oldLanding, TotalDistanceM: 1500, TotalDurationSeconds: 600}
+	recentFlight := &model.FlightRecord{FlightNo: "WRJ-RET-F2", OrderID: 1, DroneID: 2, Status: "completed", LandingAt: &recentLanding}
+	for _, record := range []*model.FlightRecord{oldFlight, recentFlight} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create flight record: %v", err)
+		}
+	}
+
+	// 沿经线直飞 20 个点，中间一个明显偏航点
+	addTrack := func(record *model.FlightRecord, landing time.Time) {
+		for i := 0; i < 20; i++ {
+			lng := 113.0
+			if i == 10 {
+				lng = 113.002
+			}
+			recordID := record.ID
+			pos := &model.FlightPosition{
+				FlightRecordID: &recordID, OrderID: 1, DroneID: 2,
+				Latitude: 23.0 + float64(i)*0.0005, Longitude: lng, Altitude: 60,
+				RecordedAt: landing.Add(time.Duration(i-20) * 10 * time.Second),
+			}
+			if err := db.Create(pos).Error; err != nil {
+				t.Fatalf("create position: %v", err)
+			}
+		}
+	}
+	addTrack(oldFlight, oldLanding)
+	addTrack(recentFlight, recentLanding)
+
+	service := NewFlightService(repository.NewFlightRepo(db), nil, nil, zap.NewNop())
+	result, err := service.RunPositionRetention(10)
+	if err != nil {
+		t.Fatalf("run retention: %v", err)
+	}
+	if result.Downsampled != 1 || result.Removed == 0 {
+		t.Fatalf("expected old flight downsampled, got %#v", result)
+	}
+
+	var kept []model.FlightPosition
+	db.Where("flight_record_id = ?", oldFlight.ID).Order("recorded_at ASC").Find(&kept)
+	if int64(len(kept))+result.Removed != 20 || len(kept) > 5 {
+		t.Fatalf("expected only key points kept, got %d (removed %d)", len(kept), result.Removed)
+	}
+	hasDetour := false
+	for _, pos := range kept {
+		if pos.Longitude == 113.002 {
+			hasDetour = true
+		}
+	}
+	if !hasDetour || kept[0].Latitude != 23.0 {
+		t.Fatalf("expected endpoints and detour point kept, got %#v", kept)
+	}
+
+	var recentCount int64
+	db.Model(&model.FlightPosition{}).Where("flight_record_id = ?", recentFlight.ID).Count(&recentCount)
+	if recentCount != 20 {
+		t.Fatalf("expected recent flight at full resolution, got %d", recentCount)
+	}
+
+	var reloaded model.FlightRecord
+	db.First(&reloaded, oldFlight.ID)
+	if reloaded.PositionsDownsampledAt == nil {
+		t.Fatalf("expected flight record marked as downsampled")
+	}
+
+	again, err := service.RunPositionRetention(10)
+	if err != nil || again.Downsampled != 0 {
+		t.Fatalf("expected second run to be a no-op, got %#v, %v", again, err)
+	}
+}
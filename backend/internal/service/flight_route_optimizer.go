@@ -0,0 +1,400 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"wurenji-backend/internal/pkg/geo"
+)
+
+// 多点航线规划: 在时间窗口、累计载重与电池续航约束下重排站点顺序，
+// 电量不足以飞往下一站并返回基地时插入返航换电航段，全程结束后返回基地。
+// 规划完全离线且结果确定：候选顺序(原顺序、最早截止优先、贪心最早服务)经 2-opt 改进后取总耗时最短的可行方案
+
+const (
+	RouteLegStop         = "stop"
+	RouteLegBatterySwap  = "battery_swap"
+	RouteLegReturnToBase = "return_to_base"
+
+	maxRoutePlanStops = 50
+)
+
+// RoutePlanConstraints 航线规划约束，零值项使用默认值或不校验
+type RoutePlanConstraints struct {
+	MaxPayloadKG     float64 // 最大载重(kg)，0 表示不校验
+	EnduranceMinutes int     // 单块电池续航(分钟)，0 表示不校验
+	BatteryReserve   float64 // 续航保留比例，默认 0.2
+	CruiseSpeed      float64 // 巡航速度(米/秒)，默认 10
+	DwellSeconds     int     // 每站停留(秒)，默认 120
+	SwapSeconds      int     // 返航换电耗时(秒)，默认 300
+}
+
+// RoutePlanInput 航线规划输入，Base 为起降与换电基地
+type RoutePlanInput struct {
+	Base        geo.Point
+	StartAt     time.Time
+	Stops       []MultiPointStopRequest
+	KeepOrder   bool // 保持提交顺序，只校验可行性并计算预计到达时间
+	Constraints RoutePlanConstraints
+}
+
+// PlannedRouteLeg 规划后的一个航段终点
+type PlannedRouteLeg struct {
+	Kind            string    `json:"kind"`       // stop, battery_swap, return_to_base
+	StopIndex       int       `json:"stop_index"` // 提交时的站点下标，换电与返航为 -1
+	Latitude        float64   `json:"latitude"`
+	Longitude       float64   `json:"longitude"`
+	LegDistance     float64   `json:"leg_distance"` // 本航段距离(米)
+	ExpectedArrival time.Time `json:"expected_arrival"`
+	WaitSeconds     int       `json:"wait_seconds"` // 早于时间窗口到达时的等待
+	Departure       time.Time `json:"departure"`
+	LoadKG          float64   `json:"load_kg"`           // 离开时机上货物重量
+	BatteryUsedSecs int       `json:"battery_used_secs"` // 离开时当前电池已用飞行时间
+}
+
+// RoutePlan 航线规划结果
+type RoutePlan struct {
+	Legs          []PlannedRouteLeg `json:"legs"`
+	Order         []int             `json:"order"`          // 站点访问顺序(提交时下标)
+	TotalDistance float64           `json:"total_distance"` // 米
+	TotalDuration int               `json:"total_duration"` // 秒，含停留、等待与换电
+	BatterySwaps  int               `json:"battery_swaps"`
+	Reordered     bool              `json:"reordered"`
+}
+
+// RoutePlanReason 规划不可行的原因
+type RoutePlanReason struct {
+	Code      string `json:"code"`       // invalid_stop, time_window, payload, endurance, cargo_order
+	StopIndex int    `json:"stop_index"` // 相关站点下标，-1 表示整体
+	Message   string `json:"message"`
+}
+
+// RoutePlanError 航线不可行
+type RoutePlanError struct {
+	Reasons []RoutePlanReason `json:"reasons"`
+}
+
+func (e *RoutePlanError) Error() string {
+	messages := make([]string, 0, len(e.Reasons))
+	for _, reason := range e.Reasons {
+		messages = append(messages, reason.Message)
+	}
+	return "航线规划不可行: " + strings.Join(messages, "；")
+}
+
+// PlanMultiPointRoute 规划多点航线
+func PlanMultiPointRoute(input RoutePlanInput) (*RoutePlan, error) {
+	planner := newRoutePlanner(input)
+	if reasons := planner.validate(); len(reasons) > 0 {
+		return nil, &RoutePlanError{Reasons: reasons}
+	}
+
+	submitted := make([]int, len(input.Stops))
+	for i := range submitted {
+		submitted[i] = i
+	}
+	candidates := [][]int{submitted}
+	if !input.KeepOrder {
+		candidates = append(candidates, planner.earliestDeadlineOrder(), planner.greedyOrder())
+	}
+
+	var best *RoutePlan
+	var bestFailure *routeFailure
+	for _, order := range candidates {
+		plan, failure := planner.simulate(order)
+		if failure != nil {
+			if bestFailure == nil || failure.visited > bestFailure.visited {
+				bestFailure = failure
+			}
+			continue
+		}
+		if !input.KeepOrder {
+			plan = planner.improve(plan)
+		}
+		if best == nil || betterRoutePlan(plan, best) {
+			best = plan
+		}
+	}
+	if best == nil {
+		return nil, &RoutePlanError{Reasons: []RoutePlanReason{bestFailure.reason}}
+	}
+	for i, index := range best.Order {
+		if index != i {
+			best.Reordered = true
+			break
+		}
+	}
+	return best, nil
+}
+
+type routePlanner struct {
+	input       RoutePlanInput
+	points      []geo.Point
+	deltas      []float64 // 装货为正、卸货为负
+	initialLoad float64   // 出发时从基地带上的货物
+	usableSecs  float64   // 单块电池可用飞行秒数，0 表示不限
+	speed       float64
+	dwell       time.Duration
+	swap        time.Duration
+}
+
+type routeFailure struct {
+	visited int
+	reason  RoutePlanReason
+}
+
+func newRoutePlanner(input RoutePlanInput) *routePlanner {
+	c := input.Constraints
+	p := &routePlanner{
+		input: input,
+		speed: c.CruiseSpeed,
+		dwell: time.Duration(c.DwellSeconds) * time.Second,
+		swap:  time.Duration(c.SwapSeconds) * time.Second,
+	}
+	if p.speed <= 0 {
+		p.speed = 10
+	}
+	if c.DwellSeconds <= 0 {
+		p.dwell = 2 * time.Minute
+	}
+	if c.SwapSeconds <= 0 {
+		p.swap = 5 * time.Minute
+	}
+	if c.EnduranceMinutes > 0 {
+		reserve := c.BatteryReserve
+		if reserve <= 0 || reserve >= 1 {
+			reserve = 0.2
+		}
+		p.usableSecs = float64(c.EnduranceMinutes) * 60 * (1 - reserve)
+	}
+
+	var loaded, unloaded float64
+	for _, stop := range input.Stops {
+		p.points = append(p.points, geo.Point{Lat: stop.Latitude, Lng: stop.Longitude})
+		weight := float64(stop.CargoWeight)
+		switch routeCargoAction(stop) {
+		case "load":
+			p.deltas = append(p.deltas, weight)
+			loaded += weight
+		case "unload":
+			p.deltas = append(p.deltas, -weight)
+			unloaded += weight
+		default:
+			p.deltas = append(p.deltas, 0)
+		}
+	}
+	p.initialLoad = math.Max(unloaded-loaded, 0)
+	return p
+}
+
+// routeCargoAction 未填写装卸动作时按站点类型推断
+func routeCargoAction(stop MultiPointStopRequest) string {
+	if stop.CargoAction != "" {
+		return stop.CargoAction
+	}
+	switch stop.StopType {
+	case "pickup":
+		return "load"
+	case "delivery":
+		return "unload"
+	}
+	return ""
+}
+
+// validate 与顺序无关的单站点检查
+func (p *routePlanner) validate() []RoutePlanReason {
+	var reasons []RoutePlanReason
+	if len(p.input.Stops) > maxRoutePlanStops {
+		return []RoutePlanReason{{Code: "invalid_stop", StopIndex: -1, Message: fmt.Sprintf("多点任务最多%d个站点", maxRoutePlanStops)}}
+	}
+	maxPayload := p.input.Constraints.MaxPayloadKG
+	if maxPayload > 0 && p.initialLoad > maxPayload {
+		reasons = append(reasons, RoutePlanReason{Code: "payload", StopIndex: -1,
+			Message: fmt.Sprintf("出发时需携带%.1fkg货物，超过最大载重%.1fkg", p.initialLoad, maxPayload)})
+	}
+	for i, stop := range p.input.Stops {
+		if math.Abs(stop.Latitude) > 90 || math.Abs(stop.Longitude) > 180 || (stop.Latitude == 0 && stop.Longitude == 0) {
+			reasons = append(reasons, RoutePlanReason{Code: "invalid_stop", StopIndex: i, Message: fmt.Sprintf("站点%d坐标无效", i+1)})
+			continue
+		}
+		if stop.CargoWeight < 0 {
+			reasons = append(reasons, RoutePlanReason{Code: "invalid_stop", StopIndex: i, Message: fmt.Sprintf("站点%d货物重量不能为负数", i+1)})
+		}
+		if stop.TimeWindowStart != nil && stop.TimeWindowEnd != nil && stop.TimeWindowEnd.Before(*stop.TimeWindowStart) {
+			reasons = append(reasons, RoutePlanReason{Code: "time_window", StopIndex: i, Message: fmt.Sprintf("站点%d时间窗口结束早于开始", i+1)})
+		}
+		if maxPayload > 0 && float64(stop.CargoWeight) > maxPayload {
+			reasons = append(reasons, RoutePlanReason{Code: "payload", StopIndex: i,
+				Message: fmt.Sprintf("站点%d货物%dkg超过最大载重%.1fkg", i+1, stop.CargoWeight, maxPayload)})
+		}
+		if p.usableSecs > 0 && 2*p.flightSecs(p.input.Base, p.points[i]) > p.usableSecs {
+			reasons = append(reasons, RoutePlanReason{Code: "endurance", StopIndex: i,
+				Message: fmt.Sprintf("站点%d距基地%.1fkm，满电往返超出续航", i+1, geo.HaversineMeters(p.input.Base, p.points[i])/1000)})
+		}
+	}
+	return reasons
+}
+
+func (p *routePlanner) flightSecs(a, b geo.Point) float64 {
+	return geo.HaversineMeters(a, b) / p.speed
+}
+
+// simulate 按给定顺序推演航线，必要时插入返航换电，返回首个不可行原因
+func (p *routePlanner) simulate(order []int) (*RoutePlan, *routeFailure) {
+	base := p.input.Base
+	plan := &RoutePlan{Order: append([]int(nil), order...), Legs: make([]PlannedRouteLeg, 0, len(order)+1)}
+	pos, now, load, used := base, p.input.StartAt, p.initialLoad, 0.0
+	maxPayload := p.input.Constraints.MaxPayloadKG
+
+	fly := func(kind string, index int, to geo.Point) *PlannedRouteLeg {
+		distance := geo.HaversineMeters(pos, to)
+		secs := distance / p.speed
+		now = now.Add(time.Duration(secs * float64(time.Second)))
+		used += secs
+		plan.TotalDistance += distance
+		plan.Legs = append(plan.Legs, PlannedRouteLeg{
+			Kind: kind, StopIndex: index, Latitude: to.Lat, Longitude: to.Lng, LegDistance: math.Round(distance), ExpectedArrival: now,
+		})
+		pos = to
+		return &plan.Legs[len(plan.Legs)-1]
+	}
+
+	for visited, index := range order {
+		stop := p.input.Stops[index]
+		point := p.points[index]
+		// 飞往下一站后必须仍能返回基地，否则先返航换电
+		if p.usableSecs > 0 && used+p.flightSecs(pos, point)+p.flightSecs(point, base) > p.usableSecs {
+			if used == 0 {
+				return nil, &routeFailure{visited: visited, reason: RoutePlanReason{Code: "endurance", StopIndex: index,
+					Message: fmt.Sprintf("站点%d满电往返超出续航", index+1)}}
+			}
+			leg := fly(RouteLegBatterySwap, -1, base)
+			now = now.Add(p.swap)
+			used = 0
+			leg.Departure, leg.LoadKG = now, load
+			plan.BatterySwaps++
+		}
+
+		leg := fly(RouteLegStop, index, point)
+		if stop.TimeWindowEnd != nil && now.After(*stop.TimeWindowEnd) {
+			return nil, &routeFailure{visited: visited, reason: RoutePlanReason{Code: "time_window", StopIndex: index,
+				Message: fmt.Sprintf("站点%d预计%s到达，晚于时间窗口%s", index+1, now.Format("15:04"), stop.TimeWindowEnd.Format("15:04"))}}
+		}
+		if stop.TimeWindowStart != nil && now.Before(*stop.TimeWindowStart) {
+			leg.WaitSeconds = int(stop.TimeWindowStart.Sub(now).Seconds())
+			now = *stop.TimeWindowStart // 落地等待，不消耗续航
+		}
+		load += p.deltas[index]
+		if load < -1e-9 {
+			return nil, &routeFailure{visited: visited, reason: RoutePlanReason{Code: "cargo_order", StopIndex: index,
+				Message: fmt.Sprintf("站点%d卸货时机上货物不足，需先完成对应取货", index+1)}}
+		}
+		if maxPayload > 0 && load > maxPayload {
+			return nil, &routeFailure{visited: visited, reason: RoutePlanReason{Code: "payload", StopIndex: index,
+				Message: fmt.Sprintf("站点%d装货后载重%.1fkg超过最大载重%.1fkg", index+1, load, maxPayload)}}
+		}
+		now = now.Add(p.dwell)
+		leg.Departure, leg.LoadKG, leg.BatteryUsedSecs = now, load, int(math.Round(used))
+	}
+
+	leg := fly(RouteLegReturnToBase, -1, base)
+	leg.Departure, leg.LoadKG, leg.BatteryUsedSecs = now, load, int(math.Round(used))
+	plan.TotalDistance = math.Round(plan.TotalDistance)
+	plan.TotalDuration = int(math.Round(now.Sub(p.input.StartAt).Seconds()))
+	return plan, nil
+}
+
+// earliestDeadlineOrder 按时间窗口截止时间排序，无窗口的站点排在最后
+func (p *routePlanner) earliestDeadlineOrder() []int {
+	order := make([]int, len(p.input.Stops))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		endA, endB := p.input.Stops[order[a]].TimeWindowEnd, p.input.Stops[order[b]].TimeWindowEnd
+		if endA == nil || endB == nil {
+			return endA != nil && endB == nil
+		}
+		return endA.Before(*endB)
+	})
+	return order
+}
+
+// greedyOrder 每步选择可行且最早开始服务的站点，同时开始时截止早者优先
+func (p *routePlanner) greedyOrder() []int {
+	visited := make([]bool, len(p.input.Stops))
+	order := make([]int, 0, len(p.input.Stops))
+	for len(order) < len(p.input.Stops) {
+		bestIndex := -1
+		var bestStart time.Time
+		for j := range p.input.Stops {
+			if visited[j] {
+				continue
+			}
+			plan, failure := p.simulate(append(append([]int(nil), order...), j))
+			if failure != nil {
+				continue
+			}
+			leg := plan.Legs[len(plan.Legs)-2]
+			start := leg.ExpectedArrival.Add(time.Duration(leg.WaitSeconds) * time.Second)
+			if bestIndex < 0 || start.Before(bestStart) || (start.Equal(bestStart) && p.deadlineBefore(j, bestIndex)) {
+				bestIndex, bestStart = j, start
+			}
+		}
+		if bestIndex < 0 {
+			// 无可行的下一站时按原顺序补齐，由推演给出不可行原因
+			for j := range p.input.Stops {
+				if !visited[j] {
+					order = append(order, j)
+					visited[j] = true
+				}
+			}
+			break
+		}
+		order = append(order, bestIndex)
+		visited[bestIndex] = true
+	}
+	return order
+}
+
+func (p *routePlanner) deadlineBefore(a, b int) bool {
+	endA, endB := p.input.Stops[a].TimeWindowEnd, p.input.Stops[b].TimeWindowEnd
+	if endA == nil || endB == nil {
+		return endA != nil && endB == nil
+	}
+	return endA.Before(*endB)
+}
+
+// improve 2-opt 反转区间，接受可行且更优的方案直至无改进
+func (p *routePlanner) improve(plan *RoutePlan) *RoutePlan {
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(plan.Order)-1; i++ {
+			for k := i + 1; k < len(plan.Order); k++ {
+				order := append([]int(nil), plan.Order...)
+				for a, b := i, k; a < b; a, b = a+1, b-1 {
+					order[a], order[b] = order[b], order[a]
+				}
+				candidate, failure := p.simulate(order)
+				if failure == nil && betterRoutePlan(candidate, plan) {
+					plan, improved = candidate, true
+				}
+			}
+		}
+	}
+	return plan
+}
+
+// betterRoutePlan 总耗时短者优先，其次总距离短、换电次数少
+func betterRoutePlan(a, b *RoutePlan) bool {
+	if a.TotalDuration != b.TotalDuration {
+		return a.TotalDuration < b.TotalDuration
+	}
+	if a.TotalDistance != b.TotalDistance {
+		return a.TotalDistance < b.TotalDistance
+	}
+	return a.BatterySwaps < b.BatterySwaps
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+	"wurenji-backend/internal/repository"
+)
+
+func TestPlanMultiPointRouteReordersWithinTimeWindows(t *testing.T) {
+	start := time.Date(2026, 3, 17, 9, 0, 0, 0, time.Local)
+	base := geo.Point{Lat: 31.0, Lng: 121.0}
+	stops := []MultiPointStopRequest{
+		{StopType: "delivery", Latitude: 31.0, Longitude: 121.03, CargoWeight: 2},
+		{StopType: "delivery", Latitude: 31.0, Longitude: 121.01, CargoWeight: 2},
+		{StopType: "delivery", Latitude: 31.0, Longitude: 121.02, CargoWeight: 2},
+	}
+
+	// 无时间窗口时重排以缩短总航程，不再先飞最远站点再折返
+	submitted, err := PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: stops, KeepOrder: true})
+	if err != nil {
+		t.Fatalf("plan submitted order: %v", err)
+	}
+	plan, err := PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: stops})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if !plan.Reordered || plan.Order[0] != 1 || plan.TotalDistance >= submitted.TotalDistance || plan.TotalDuration >= submitted.TotalDuration {
+		t.Fatalf("expected shorter reordered route, got %v (%.0fm) vs submitted %.0fm", plan.Order, plan.TotalDistance, submitted.TotalDistance)
+	}
+	if len(plan.Legs) != 4 || plan.Legs[3].Kind != RouteLegReturnToBase {
+		t.Fatalf("expected three stops and return to base, got %+v", plan.Legs)
+	}
+	if eta := plan.Legs[0].ExpectedArrival.Sub(start); eta < 90*time.Second || eta > 100*time.Second {
+		t.Fatalf("expected ~95s to first stop at 10m/s, got %v", eta)
+	}
+	if plan.Legs[0].LoadKG != 4 {
+		t.Fatalf("expected deliveries to start fully loaded, got %.1f after first drop", plan.Legs[0].LoadKG)
+	}
+
+	// 最远站点要求 5 分钟内送达，必须先飞
+	deadline := start.Add(5 * time.Minute)
+	stops[0].TimeWindowEnd = &deadline
+	plan, err = PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: stops})
+	if err != nil {
+		t.Fatalf("plan with window: %v", err)
+	}
+	if !reflect.DeepEqual(plan.Order, []int{0, 2, 1}) {
+		t.Fatalf("expected time-window stop first, got %v", plan.Order)
+	}
+
+	// 保持原顺序时同一约束不可行，返回原因
+	tight := start.Add(time.Minute)
+	stops[0].TimeWindowEnd = &tight
+	_, err = PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: stops, KeepOrder: true})
+	var planErr *RoutePlanError
+	if !errors.As(err, &planErr) || planErr.Reasons[0].Code != "time_window" || planErr.Reasons[0].StopIndex != 0 {
+		t.Fatalf("expected time window rejection, got %v", err)
+	}
+}
+
+func TestPlanMultiPointRouteRespectsPayloadAndEndurance(t *testing.T) {
+	start := time.Date(2026, 3, 17, 9, 0, 0, 0, time.Local)
+	base := geo.Point{Lat: 31.0, Lng: 121.0}
+
+	// 两次取送各 6kg，载重 10kg 时不能连续取两件
+	pickups := []MultiPointStopRequest{
+		{StopType: "pickup", Latitude: 31.0, Longitude: 121.005, CargoWeight: 6},
+		{StopType: "pickup", Latitude: 31.0, Longitude: 121.006, CargoWeight: 6},
+		{StopType: "delivery", Latitude: 31.005, Longitude: 121.0, CargoWeight: 6},
+		{StopType: "delivery", Latitude: 31.006, Longitude: 121.0, CargoWeight: 6},
+	}
+	plan, err := PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: pickups, Constraints: RoutePlanConstraints{MaxPayloadKG: 10}})
+	if err != nil {
+		t.Fatalf("plan pickups: %v", err)
+	}
+	for _, leg := range plan.Legs {
+		if leg.LoadKG > 10 {
+			t.Fatalf("plan exceeds payload: %+v", plan.Legs)
+		}
+	}
+
+	// 续航 10 分钟(可用 8 分钟)：东西两站之间无法直飞，须返航换电
+	spread := []MultiPointStopRequest{
+		{StopType: "delivery", Latitude: 31.0, Longitude: 121.02},
+		{StopType: "delivery", Latitude: 31.0, Longitude: 120.98},
+	}
+	plan, err = PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: spread, Constraints: RoutePlanConstraints{EnduranceMinutes: 10}})
+	if err != nil {
+		t.Fatalf("plan endurance: %v", err)
+	}
+	kinds := make([]string, 0, len(plan.Legs))
+	for _, leg := range plan.Legs {
+		kinds = append(kinds, leg.Kind)
+	}
+	if plan.BatterySwaps != 1 || !reflect.DeepEqual(kinds, []string{RouteLegStop, RouteLegBatterySwap, RouteLegStop, RouteLegReturnToBase}) {
+		t.Fatalf("expected one battery swap between stops, got %v", kinds)
+	}
+
+	far := []MultiPointStopRequest{spread[0], {StopType: "delivery", Latitude: 31.0, Longitude: 121.05, CargoWeight: 15}}
+	_, err = PlanMultiPointRoute(RoutePlanInput{Base: base, StartAt: start, Stops: far, Constraints: RoutePlanConstraints{EnduranceMinutes: 10, MaxPayloadKG: 10}})
+	var planErr *RoutePlanError
+	if !errors.As(err, &planErr) || len(planErr.Reasons) != 3 {
+		t.Fatalf("expected payload and endurance reasons, got %v", err)
+	}
+}
+
+func TestCreateMultiPointTaskPersistsPlannedStops(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.Drone{}, &model.Demand{}, &model.Pilot{}, &model.User{}, &model.Review{},
+		&model.MultiPointTask{}, &model.MultiPointTaskStop{})
+	drone := &model.Drone{OwnerID: 31, SerialNumber: "SN-ROUTE-001", MaxPayloadKG: 20, MaxFlightTime: 10, Latitude: 31.0, Longitude: 121.0}
+	if err := db.Create(drone).Error; err != nil {
+		t.Fatalf("create drone: %v", err)
+	}
+	startAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	order := &model.Order{OrderNo: "WRJ-ROUTE-001", DroneID: drone.ID, Title: "多点配送", ServiceType: "cargo", StartTime: startAt, EndTime: startAt.Add(2 * time.Hour), Status: "confirmed"}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	flights := NewFlightService(repository.NewFlightRepo(db), repository.NewOrderRepo(db), nil, zap.NewNop())
+	task, err := flights.CreateMultiPointTask(&CreateMultiPointTaskRequest{
+		OrderID: order.ID, TaskType: "delivery",
+		Stops: []MultiPointStopRequest{
+			{StopType: "delivery", Latitude: 31.0, Longitude: 120.98, Address: "西站", CargoWeight: 5},
+			{StopType: "delivery", Latitude: 31.0, Longitude: 121.02, Address: "东站", CargoWeight: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	_, stops, err := flights.GetMultiPointTask(task.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if task.TotalPoints != 4 || len(stops) != 4 || stops[1].StopType != RouteLegBatterySwap || stops[3].StopType != RouteLegReturnToBase {
+		t.Fatalf("expected battery swap inserted from drone endurance, got %+v", stops)
+	}
+	if stops[0].Address != "西站" || stops[0].CargoAction != "unload" || stops[0].ExpectedArrival == nil || !stops[0].ExpectedArrival.After(startAt) {
+		t.Fatalf("expected first stop copied with ETA after order start, got %+v", stops[0])
+	}
+}
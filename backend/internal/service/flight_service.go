@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,7 +14,9 @@ import (
 
 	"wurenji-backend/internal/model"
 	"wurenji-backend/internal/pkg/amap"
+	"wurenji-backend/internal/pkg/geo"
 	"wurenji-backend/internal/repository"
+	ws "wurenji-backend/internal/websocket"
 )
 
 // FlightService 飞行监控服务
@@ -22,6 +25,9 @@ type FlightService struct {
 	orderRepo   *repository.OrderRepo
 	pilotRepo   *repository.PilotRepo
 	amapService *amap.AmapService
+	realtime    ws.Publisher
+	events      *EventService
+	credit      *CreditService
 	logger      *zap.Logger
 
 	// 配置
@@ -29,6 +35,13 @@ type FlightService struct {
 
 	simMu       sync.RWMutex
 	simulations map[int64]*developmentFlightSimulation
+
+	telemetryMu       sync.Mutex
+	telemetryBindings map[int]telemetryBinding
+
+	geofenceMu       sync.RWMutex
+	geofenceCache    []*cachedGeofence
+	geofenceLoadedAt time.Time
 }
 
 // FlightServiceConfig 服务配置
@@ -43,6 +56,16 @@ type FlightServiceConfig struct {
 	PositionReportInterval  int // 位置上报间隔(秒)
 	GeofenceAlertDistance   int // 围栏预警距离(米)
 	TrajectorySimpTolerance int // 轨迹简化容差(米)
+	PositionFullResDays     int // 位置点全精度保留天数，之后按轨迹简化容差降采样
+	PositionRetentionDays   int // 位置点最长保留天数，0 表示不删除
+	AlertEscalationInterval int // 未确认告警逐级升级间隔(秒)
+	RouteCruiseSpeed        int // 多点航线巡航速度(米/秒)
+	RouteStopDwell          int // 多点航线每站停留(秒)
+	RouteBatterySwap        int // 返航换电耗时(秒)
+	RouteBatteryReserve     int // 续航保留比例(%)
+	StopArrivalRadius       int // 自动到站判定半径(米)
+	StopArrivalSpeed        int // 自动到站判定地速上限(米/秒)
+	StopDepartureRadius     int // 自动离站判定半径(米)，大于到站半径以避免边界抖动
 }
 
 func NewFlightService(
@@ -67,6 +90,15 @@ func NewFlightService(
 			PositionReportInterval:  3,
 			GeofenceAlertDistance:   100,
 			TrajectorySimpTolerance: 5,
+			PositionFullResDays:     7,
+			AlertEscalationInterval: 60,
+			RouteCruiseSpeed:        10,
+			RouteStopDwell:          120,
+			RouteBatterySwap:        300,
+			RouteBatteryReserve:     20,
+			StopArrivalRadius:       30,
+			StopArrivalSpeed:        1,
+			StopDepartureRadius:     60,
 		},
 		simulations: make(map[int64]*developmentFlightSimulation),
 	}
@@ -79,6 +111,18 @@ func (s *FlightService) SetAmapService(amapService *amap.AmapService) {
 	s.amapService = amapService
 }
 
+func (s *FlightService) SetRealtimePublisher(publisher ws.Publisher) {
+	s.realtime = publisher
+}
+
+func (s *FlightService) SetEventService(eventService *EventService) {
+	s.events = eventService
+}
+
+func (s *FlightService) SetCreditService(creditService *CreditService) {
+	s.credit = creditService
+}
+
 func (s *FlightService) loadConfigFromDB() {
 	s.config.LowBatteryWarning = s.flightRepo.GetConfigInt("low_battery_warning", 30)
 	s.config.LowBatteryCritical = s.flightRepo.GetConfigInt("low_battery_critical", 15)
@@ -90,6 +134,16 @@ func (s *FlightService) loadConfigFromDB() {
 	s.config.PositionReportInterval = s.flightRepo.GetConfigInt("position_report_interval", 3)
 	s.config.GeofenceAlertDistance = s.flightRepo.GetConfigInt("geofence_alert_distance", 100)
 	s.config.TrajectorySimpTolerance = s.flightRepo.GetConfigInt("trajectory_simplify_tolerance", 5)
+	s.config.PositionFullResDays = s.flightRepo.GetConfigInt("position_full_resolution_days", 7)
+	s.config.PositionRetentionDays = s.flightRepo.GetConfigInt("position_retention_days", 0)
+	s.config.AlertEscalationInterval = s.flightRepo.GetConfigInt("alert_escalation_interval", 60)
+	s.config.RouteCruiseSpeed = s.flightRepo.GetConfigInt("route_cruise_speed", 10)
+	s.config.RouteStopDwell = s.flightRepo.GetConfigInt("route_stop_dwell", 120)
+	s.config.RouteBatterySwap = s.flightRepo.GetConfigInt("route_battery_swap", 300)
+	s.config.RouteBatteryReserve = s.flightRepo.GetConfigInt("route_battery_reserve", 20)
+	s.config.StopArrivalRadius = s.flightRepo.GetConfigInt("stop_arrival_radius", 30)
+	s.config.StopArrivalSpeed = s.flightRepo.GetConfigInt("stop_arrival_speed", 1)
+	s.config.StopDepartureRadius = s.flightRepo.GetConfigInt("stop_departure_radius", 60)
 }
 
 func (s *FlightService) AdminListFlightRecords(page, pageSize int, filters map[string]interface{}) ([]model.FlightRecord, int64, error) {
@@ -148,28 +202,122 @@ func (s *FlightService) ReportPosition(req *ReportPositionRequest) (*model.Fligh
 	return s.persistPosition(pos, req.PilotID)
 }
 
+// MaxPositionBatchSize 单次批量上报的最大位置点数
+const MaxPositionBatchSize = 500
+
+// ReportPositions 批量上报同一订单的飞行位置，一次写入后统一刷新飞行统计
+func (s *FlightService) ReportPositions(reqs []ReportPositionRequest) ([]*model.FlightPosition, []model.FlightAlert, error) {
+	if len(reqs) == 0 {
+		return nil, nil, errors.New("位置点不能为空")
+	}
+	if len(reqs) > MaxPositionBatchSize {
+		return nil, nil, fmt.Errorf("单次最多上报%d个位置点", MaxPositionBatchSize)
+	}
+
+	now := time.Now()
+	orderID := reqs[0].OrderID
+	positions := make([]*model.FlightPosition, 0, len(reqs))
+	for i := range reqs {
+		req := &reqs[i]
+		if req.OrderID != orderID {
+			return nil, nil, errors.New("批量上报的位置点必须属于同一订单")
+		}
+		pos := &model.FlightPosition{
+			OrderID:        req.OrderID,
+			DroneID:        req.DroneID,
+			PilotID:        req.PilotID,
+			Latitude:       req.Latitude,
+			Longitude:      req.Longitude,
+			Altitude:       req.Altitude,
+			Speed:          req.Speed,
+			Heading:        req.Heading,
+			VerticalSpeed:  req.VerticalSpeed,
+			BatteryLevel:   req.BatteryLevel,
+			SignalStrength: req.SignalStrength,
+			GPSSatellites:  req.GPSSatellites,
+			Temperature:    req.Temperature,
+			WindSpeed:      req.WindSpeed,
+			WindDirection:  req.WindDirection,
+			RecordedAt:     now,
+		}
+		if req.RecordedAt != nil {
+			pos.RecordedAt = *req.RecordedAt
+		}
+		positions = append(positions, pos)
+	}
+	sort.SliceStable(positions, func(i, j int) bool { return positions[i].RecordedAt.Before(positions[j].RecordedAt) })
+
+	alerts, err := s.persistPositions(orderID, positions, reqs[0].PilotID)
+	if err != nil && positions[0].ID == 0 {
+		return nil, nil, err
+	}
+	return positions, alerts, err
+}
+
 func (s *FlightService) persistPosition(pos *model.FlightPosition, fallbackPilotID int64) (*model.FlightPosition, []model.FlightAlert, error) {
-	order, err := s.orderRepo.GetByID(pos.OrderID)
-	if err != nil {
+	alerts, err := s.persistPositions(pos.OrderID, []*model.FlightPosition{pos}, fallbackPilotID)
+	if err != nil && pos.ID == 0 {
 		return nil, nil, err
 	}
+	return pos, alerts, err
+}
 
-	record, err := s.ensureFlightRecord(order, fallbackPilotID, pos.RecordedAt)
+// persistPositions 批量写入同一订单的位置点：一次插入，逐点检查告警并推送，最后统一刷新飞行记录统计
+// 位置点写入后统计刷新失败时仍返回已产生的告警
+func (s *FlightService) persistPositions(orderID int64, positions []*model.FlightPosition, fallbackPilotID int64) ([]model.FlightAlert, error) {
+	if len(positions) == 0 {
+		return nil, nil
+	}
+	order, err := s.orderRepo.GetByID(orderID)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	pos.FlightRecordID = &record.ID
 
-	if err := s.flightRepo.RecordPosition(pos); err != nil {
-		return nil, nil, err
+	record, err := s.ensureFlightRecord(order, fallbackPilotID, positions[0].RecordedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, pos := range positions {
+		pos.OrderID = order.ID
+		pos.FlightRecordID = &record.ID
+	}
+
+	if err := s.flightRepo.RecordPositions(positions); err != nil {
+		return nil, err
 	}
 
-	alerts := s.checkAndCreateAlerts(pos)
+	var alerts []model.FlightAlert
+	for _, pos := range positions {
+		posAlerts := s.checkAndCreateAlerts(pos)
+		s.publishPosition(pos, posAlerts)
+		alerts = append(alerts, posAlerts...)
+	}
+	s.trackMultiPointStops(order, positions)
 	if _, err := s.refreshFlightRecordMetrics(record, order); err != nil {
-		return pos, alerts, err
+		return alerts, err
 	}
 
-	return pos, alerts, nil
+	return alerts, nil
+}
+
+// publishPosition 推送实时位置及新产生的告警
+func (s *FlightService) publishPosition(pos *model.FlightPosition, alerts []model.FlightAlert) {
+	if s.realtime == nil {
+		return
+	}
+	topics := []string{ws.OrderTopic(pos.OrderID)}
+	if pos.FlightRecordID != nil {
+		topics = append(topics, ws.FlightTopic(*pos.FlightRecordID))
+	}
+	for _, topic := range topics {
+		s.realtime.Publish(topic, "flight_position", pos)
+	}
+	for i := range alerts {
+		for _, topic := range topics {
+			s.realtime.Publish(topic, "flight_alert", &alerts[i])
+		}
+		s.realtime.Publish(ws.AdminAlertsTopic, "flight_alert", &alerts[i])
+	}
 }
 
 func (s *FlightService) SyncOrderFlightRecord(orderID int64) error {
@@ -398,6 +546,10 @@ func (s *FlightService) refreshFlightRecordMetrics(record *model.FlightRecord, o
 	}
 
 	durationSec, distanceMeters, maxAlt := calcFlightMetricsFromPositions(positions)
+	if record.PositionsDownsampledAt != nil {
+		// 简化后的轨迹会低估距离与时长，沿用降采样前的统计
+		durationSec, distanceMeters = int64(record.TotalDurationSeconds), record.TotalDistanceM
+	}
 	if durationSec == 0 && order.ActualFlightDuration > 0 {
 		durationSec = int64(order.ActualFlightDuration)
 	}
@@ -484,6 +636,7 @@ func (s *FlightService) syncOrderFlightSummary(orderID int64) error {
 }
 
 // checkAndCreateAlerts 检查状态并创建告警
+// 同一飞行同一告警码已有未关闭告警时只累计次数，返回本次新建的告警
 func (s *FlightService) checkAndCreateAlerts(pos *model.FlightPosition) []model.FlightAlert {
 	var alerts []model.FlightAlert
 
@@ -539,12 +692,7 @@ func (s *FlightService) checkAndCreateAlerts(pos *model.FlightPosition) []model.
 	fenceAlerts := s.checkGeofences(pos)
 	alerts = append(alerts, fenceAlerts...)
 
-	// 保存告警
-	for i := range alerts {
-		s.flightRepo.CreateAlert(&alerts[i])
-	}
-
-	return alerts
+	return s.saveAlerts(pos, alerts)
 }
 
 func (s *FlightService) createAlert(pos *model.FlightPosition, alertType, level, code, title, desc, threshold, actual string) model.FlightAlert {
@@ -572,41 +720,41 @@ func (s *FlightService) createAlert(pos *model.FlightPosition, alertType, level,
 }
 
 // checkGeofences 检查围栏违规
+// 进入禁飞区/限飞区触发违规告警；在 AlertDistance 范围内接近时提前触发预警
 func (s *FlightService) checkGeofences(pos *model.FlightPosition) []model.FlightAlert {
 	var alerts []model.FlightAlert
 
-	fences, err := s.flightRepo.GetActiveGeofences()
+	fences, err := s.activeGeofences()
 	if err != nil {
 		s.logger.Error("获取围栏列表失败", zap.Error(err))
 		return alerts
 	}
 
-	for _, fence := range fences {
-		isInside := s.isInsideGeofence(pos.Latitude, pos.Longitude, pos.Altitude, &fence)
+	now := time.Now()
+	point := geo.Point{Lat: pos.Latitude, Lng: pos.Longitude}
+	for _, cached := range fences {
+		fence := cached.fence
+		if fence.FenceType != "no_fly" && fence.FenceType != "restricted" {
+			continue
+		}
+		if !cached.effectiveAt(now) || !timeRestrictionsOverlap(fence.TimeRestrictions, now, now) {
+			continue
+		}
+		zone := cached.zone
+		if !zone.Band.Contains(pos.Altitude) {
+			continue
+		}
 
-		// 禁飞区/限飞区内部触发告警
-		if isInside && (fence.FenceType == "no_fly" || fence.FenceType == "restricted") {
+		distance := zone.Distance(point)
+		if distance == 0 {
 			level := "warning"
 			if fence.FenceType == "no_fly" {
 				level = "critical"
 			}
-
-			alert := model.FlightAlert{
-				FlightRecordID: pos.FlightRecordID,
-				OrderID:        pos.OrderID,
-				DroneID:        pos.DroneID,
-				PilotID:        pos.PilotID,
-				AlertType:      "geofence",
-				AlertLevel:     level,
-				AlertCode:      "GEO_VIOLATION",
-				Title:          fmt.Sprintf("进入%s", fence.Name),
-				Description:    fmt.Sprintf("无人机已进入%s(%s)，请立即撤离", fence.Name, fence.FenceType),
-				Latitude:       &pos.Latitude,
-				Longitude:      &pos.Longitude,
-				Altitude:       &pos.Altitude,
-				Status:         "active",
-				TriggeredAt:    time.Now(),
-			}
+			alert := s.createAlert(pos, "geofence", level, "GEO_VIOLATION",
+				fmt.Sprintf("进入%s", fence.Name),
+				fmt.Sprintf("无人机已进入%s(%s)，请立即撤离", fence.Name, fence.FenceType),
+				"", "")
 			alerts = append(alerts, alert)
 
 			// 记录违规
@@ -622,30 +770,103 @@ func (s *FlightService) checkGeofences(pos *model.FlightPosition) []model.Flight
 				ViolatedAt:    time.Now(),
 			}
 			s.flightRepo.CreateViolation(violation)
+			s.recordGeofenceCredit(pos.OrderID, fence, violation.ViolatedAt)
+			continue
+		}
+
+		if fence.AlertDistance > 0 && distance <= float64(fence.AlertDistance) {
+			alert := s.createAlert(pos, "geofence", "warning", "GEO_APPROACH",
+				fmt.Sprintf("接近%s", fence.Name),
+				fmt.Sprintf("无人机距%s(%s)边界约%.0f米，请注意避让", fence.Name, fence.FenceType, distance),
+				fmt.Sprintf("%dm", fence.AlertDistance), fmt.Sprintf("%.0fm", distance))
+			alerts = append(alerts, alert)
 		}
 	}
 
 	return alerts
 }
 
-// isInsideGeofence 判断是否在围栏内
-func (s *FlightService) isInsideGeofence(lat, lng float64, alt int, fence *model.Geofence) bool {
-	// 高度检查
-	if alt < fence.MinAltitude || alt > fence.MaxAltitude {
+// recordGeofenceCredit 闯入围栏计入执行飞手信用，同一订单同一围栏只计一次
+func (s *FlightService) recordGeofenceCredit(orderID int64, fence *model.Geofence, at time.Time) {
+	if s.credit == nil || orderID <= 0 {
+		return
+	}
+	order, err := s.orderRepo.GetByID(orderID)
+	if err == nil {
+		err = s.credit.OnGeofenceViolation(order, fence, at)
+	}
+	if err != nil {
+		s.logger.Warn("记录围栏违规信用事件失败", zap.Int64("order_id", orderID), zap.Int64("geofence_id", fence.ID), zap.Error(err))
+	}
+}
+
+// geofenceCacheTTL 围栏缓存有效期，本实例增改围栏时立即失效，其他实例最多延迟该时间
+const geofenceCacheTTL = time.Minute
+
+// cachedGeofence 已解析几何的启用围栏
+type cachedGeofence struct {
+	fence *model.Geofence
+	zone  geo.Zone
+}
+
+func (c *cachedGeofence) effectiveAt(t time.Time) bool {
+	if c.fence.EffectiveFrom != nil && c.fence.EffectiveFrom.After(t) {
 		return false
 	}
+	if c.fence.EffectiveTo != nil && c.fence.EffectiveTo.Before(t) {
+		return false
+	}
+	return true
+}
 
-	if fence.GeometryType == "circle" {
-		if fence.CenterLatitude == nil || fence.CenterLongitude == nil || fence.Radius == nil {
-			return false
+// activeGeofences 返回缓存的启用围栏，生效时间窗口在使用时判断，避免逐点查询数据库
+func (s *FlightService) activeGeofences() ([]*cachedGeofence, error) {
+	s.geofenceMu.RLock()
+	fences, loadedAt := s.geofenceCache, s.geofenceLoadedAt
+	s.geofenceMu.RUnlock()
+	if !loadedAt.IsZero() && time.Since(loadedAt) < geofenceCacheTTL {
+		return fences, nil
+	}
+
+	s.geofenceMu.Lock()
+	defer s.geofenceMu.Unlock()
+	if !s.geofenceLoadedAt.IsZero() && time.Since(s.geofenceLoadedAt) < geofenceCacheTTL {
+		return s.geofenceCache, nil
+	}
+	rows, err := s.flightRepo.GetEnabledGeofences()
+	if err != nil {
+		return nil, err
+	}
+	fences = make([]*cachedGeofence, 0, len(rows))
+	for i := range rows {
+		fence := &rows[i]
+		zone, err := geofenceZone(fence)
+		if err != nil {
+			s.logger.Warn("围栏几何定义无效，已跳过", zap.Int64("geofence_id", fence.ID), zap.Error(err))
+			continue
 		}
-		dist := haversineDistance(lat, lng, *fence.CenterLatitude, *fence.CenterLongitude)
-		return dist <= float64(*fence.Radius)
+		fences = append(fences, &cachedGeofence{fence: fence, zone: zone})
 	}
+	s.geofenceCache = fences
+	s.geofenceLoadedAt = time.Now()
+	return fences, nil
+}
 
-	// 多边形检查 - 简化实现
-	// TODO: 实现完整的多边形包含判断
-	return false
+// invalidateGeofenceCache 围栏变更后清空缓存
+func (s *FlightService) invalidateGeofenceCache() {
+	s.geofenceMu.Lock()
+	s.geofenceCache = nil
+	s.geofenceLoadedAt = time.Time{}
+	s.geofenceMu.Unlock()
+}
+
+// isInsideGeofence 判断是否在围栏内(含高度区间)
+func (s *FlightService) isInsideGeofence(lat, lng float64, alt int, fence *model.Geofence) bool {
+	zone, err := geofenceZone(fence)
+	if err != nil {
+		return false
+	}
+	return zone.Contains(geo.Point{Lat: lat, Lng: lng}, alt)
 }
 
 // ==================== 告警管理 ====================
@@ -664,7 +885,7 @@ func (s *FlightService) GetActiveAlerts(orderID int64) ([]model.FlightAlert, err
 	return s.flightRepo.GetActiveAlerts(orderID)
 }
 
-// AcknowledgeAlert 确认告警
+// AcknowledgeAlert 确认告警，确认后不再升级通知
 func (s *FlightService) AcknowledgeAlert(alertID, userID int64) error {
 	return s.flightRepo.AcknowledgeAlert(alertID, userID)
 }
@@ -678,7 +899,14 @@ func (s *FlightService) ResolveAlert(alertID int64, note string) error {
 
 // CreateGeofence 创建围栏
 func (s *FlightService) CreateGeofence(fence *model.Geofence) error {
-	return s.flightRepo.CreateGeofence(fence)
+	if err := ValidateGeofenceGeometry(fence); err != nil {
+		return err
+	}
+	if err := s.flightRepo.CreateGeofence(fence); err != nil {
+		return err
+	}
+	s.invalidateGeofenceCache()
+	return nil
 }
 
 // GetGeofenceByID 获取围栏
@@ -688,12 +916,23 @@ func (s *FlightService) GetGeofenceByID(id int64) (*model.Geofence, error) {
 
 // UpdateGeofence 更新围栏
 func (s *FlightService) UpdateGeofence(fence *model.Geofence) error {
-	return s.flightRepo.UpdateGeofence(fence)
+	if err := ValidateGeofenceGeometry(fence); err != nil {
+		return err
+	}
+	if err := s.flightRepo.UpdateGeofence(fence); err != nil {
+		return err
+	}
+	s.invalidateGeofenceCache()
+	return nil
 }
 
 // DeleteGeofence 删除围栏
 func (s *FlightService) DeleteGeofence(id int64) error {
-	return s.flightRepo.DeleteGeofence(id)
+	if err := s.flightRepo.DeleteGeofence(id); err != nil {
+		return err
+	}
+	s.invalidateGeofenceCache()
+	return nil
 }
 
 // ListGeofences 围栏列表
@@ -1001,9 +1240,13 @@ func (s *FlightService) RateRoute(routeID int64, rating float64) error {
 
 // CreateMultiPointTaskRequest 创建多点任务请求
 type CreateMultiPointTaskRequest struct {
-	OrderID  int64                   `json:"order_id"`
-	TaskType string                  `json:"task_type"` // pickup, delivery, mixed
-	Stops    []MultiPointStopRequest `json:"stops"`
+	OrderID       int64                   `json:"order_id"`
+	TaskType      string                  `json:"task_type"` // pickup, delivery, mixed
+	Stops         []MultiPointStopRequest `json:"stops"`
+	BaseLatitude  *float64                `json:"base_latitude"` // 起降与换电基地，缺省为订单无人机位置
+	BaseLongitude *float64                `json:"base_longitude"`
+	StartAt       *time.Time              `json:"start_at"`   // 计划起飞时间，缺省为订单开始时间或当前时间
+	KeepOrder     bool                    `json:"keep_order"` // 保持提交顺序，不重排站点
 }
 
 type MultiPointStopRequest struct {
@@ -1020,30 +1263,62 @@ type MultiPointStopRequest struct {
 	TimeWindowEnd    *time.Time `json:"time_window_end"`
 }
 
-// CreateMultiPointTask 创建多点任务
-func (s *FlightService) CreateMultiPointTask(req *CreateMultiPointTaskRequest) (*model.MultiPointTask, error) {
+// PlanMultiPointTask 按订单无人机的载重与续航规划站点顺序，不落库
+func (s *FlightService) PlanMultiPointTask(req *CreateMultiPointTaskRequest) (*RoutePlan, error) {
 	if len(req.Stops) < 2 {
 		return nil, errors.New("多点任务至少需要2个站点")
 	}
+	input := RoutePlanInput{
+		StartAt:   time.Now(),
+		Stops:     req.Stops,
+		KeepOrder: req.KeepOrder,
+		Constraints: RoutePlanConstraints{
+			CruiseSpeed:    float64(s.config.RouteCruiseSpeed),
+			DwellSeconds:   s.config.RouteStopDwell,
+			SwapSeconds:    s.config.RouteBatterySwap,
+			BatteryReserve: float64(s.config.RouteBatteryReserve) / 100,
+		},
+	}
+	input.Base = geo.Point{Lat: req.Stops[0].Latitude, Lng: req.Stops[0].Longitude}
 
-	// 计算规划距离和时间
-	plannedDist := 0.0
-	for i := 1; i < len(req.Stops); i++ {
-		dist := haversineDistance(
-			req.Stops[i-1].Latitude, req.Stops[i-1].Longitude,
-			req.Stops[i].Latitude, req.Stops[i].Longitude)
-		plannedDist += dist
+	if req.OrderID > 0 && s.orderRepo != nil {
+		order, err := s.orderRepo.GetByID(req.OrderID)
+		if err != nil {
+			return nil, errors.New("订单不存在")
+		}
+		if order.StartTime.After(input.StartAt) {
+			input.StartAt = order.StartTime
+		}
+		if drone := order.Drone; drone != nil {
+			input.Constraints.MaxPayloadKG = drone.EffectivePayloadKG()
+			input.Constraints.EnduranceMinutes = drone.MaxFlightTime
+			if drone.Latitude != 0 || drone.Longitude != 0 {
+				input.Base = geo.Point{Lat: drone.Latitude, Lng: drone.Longitude}
+			}
+		}
+	}
+	if req.BaseLatitude != nil && req.BaseLongitude != nil {
+		input.Base = geo.Point{Lat: *req.BaseLatitude, Lng: *req.BaseLongitude}
 	}
+	if req.StartAt != nil {
+		input.StartAt = *req.StartAt
+	}
+	return PlanMultiPointRoute(input)
+}
 
-	// 估算时间 (假设平均速度10m/s，每站点停留2分钟)
-	plannedDuration := int(plannedDist/10) + len(req.Stops)*120
+// CreateMultiPointTask 创建多点任务，站点按规划顺序落库，返航换电与最终返航作为站点插入
+func (s *FlightService) CreateMultiPointTask(req *CreateMultiPointTaskRequest) (*model.MultiPointTask, error) {
+	plan, err := s.PlanMultiPointTask(req)
+	if err != nil {
+		return nil, err
+	}
 
 	task := &model.MultiPointTask{
 		OrderID:         req.OrderID,
 		TaskType:        req.TaskType,
-		TotalPoints:     len(req.Stops),
-		PlannedDistance: int(plannedDist),
-		PlannedDuration: plannedDuration,
+		TotalPoints:     len(plan.Legs),
+		PlannedDistance: int(plan.TotalDistance),
+		PlannedDuration: plan.TotalDuration,
 		Status:          "pending",
 	}
 
@@ -1052,31 +1327,42 @@ func (s *FlightService) CreateMultiPointTask(req *CreateMultiPointTaskRequest) (
 	}
 
 	// 创建站点
-	stops := make([]*model.MultiPointTaskStop, len(req.Stops))
-	for i, stop := range req.Stops {
-		stops[i] = &model.MultiPointTaskStop{
-			TaskID:           task.ID,
-			SequenceNo:       i,
-			StopType:         stop.StopType,
-			Latitude:         stop.Latitude,
-			Longitude:        stop.Longitude,
-			Address:          stop.Address,
-			ContactName:      stop.ContactName,
-			ContactPhone:     stop.ContactPhone,
-			CargoDescription: stop.CargoDescription,
-			CargoWeight:      stop.CargoWeight,
-			CargoAction:      stop.CargoAction,
-			TimeWindowStart:  stop.TimeWindowStart,
-			TimeWindowEnd:    stop.TimeWindowEnd,
-			Status:           "pending",
+	stops := make([]*model.MultiPointTaskStop, len(plan.Legs))
+	for i, leg := range plan.Legs {
+		expectedArrival := leg.ExpectedArrival
+		stop := &model.MultiPointTaskStop{
+			TaskID:          task.ID,
+			SequenceNo:      i,
+			StopType:        leg.Kind,
+			Latitude:        leg.Latitude,
+			Longitude:       leg.Longitude,
+			ExpectedArrival: &expectedArrival,
+			Status:          "pending",
 		}
+		if leg.Kind == RouteLegBatterySwap {
+			stop.Address, stop.Notes = "基地", "返航换电"
+		} else if leg.Kind == RouteLegReturnToBase {
+			stop.Address, stop.Notes = "基地", "任务结束返航"
+		}
+		if leg.StopIndex >= 0 {
+			source := req.Stops[leg.StopIndex]
+			stop.StopType = source.StopType
+			stop.Address = source.Address
+			stop.ContactName = source.ContactName
+			stop.ContactPhone = source.ContactPhone
+			stop.CargoDescription = source.CargoDescription
+			stop.CargoWeight = source.CargoWeight
+			stop.CargoAction = routeCargoAction(source)
+			stop.TimeWindowStart = source.TimeWindowStart
+			stop.TimeWindowEnd = source.TimeWindowEnd
+		}
+		stops[i] = stop
 	}
 
 	if err := s.flightRepo.CreateTaskStops(stops); err != nil {
 		return nil, err
 	}
 
-	task.TotalPoints = len(stops)
 	return task, nil
 }
 
@@ -1184,25 +1470,27 @@ func (s *FlightService) CompleteMultiPointTask(taskID int64) error {
 		return err
 	}
 
-	// 计算实际距离和时间
 	stops, _ := s.flightRepo.GetTaskStops(taskID)
+	return s.finishMultiPointTask(task, stops, time.Now())
+}
 
+// finishMultiPointTask 按已完成站点计算实际距离(米)，按开始到结束时间计算实际耗时
+func (s *FlightService) finishMultiPointTask(task *model.MultiPointTask, stops []model.MultiPointTaskStop, endAt time.Time) error {
 	actualDist := 0.0
 	for i := 1; i < len(stops); i++ {
 		if stops[i].Status == "completed" && stops[i-1].Status == "completed" {
-			dist := haversineDistance(
-				stops[i-1].Latitude, stops[i-1].Longitude,
-				stops[i].Latitude, stops[i].Longitude)
-			actualDist += dist
+			actualDist += geo.HaversineMeters(
+				geo.Point{Lat: stops[i-1].Latitude, Lng: stops[i-1].Longitude},
+				geo.Point{Lat: stops[i].Latitude, Lng: stops[i].Longitude})
 		}
 	}
 
 	actualDuration := 0
 	if task.StartedAt != nil {
-		actualDuration = int(time.Since(*task.StartedAt).Seconds())
+		actualDuration = int(endAt.Sub(*task.StartedAt).Seconds())
 	}
 
-	return s.flightRepo.CompleteMultiPointTask(taskID, int(actualDist), actualDuration)
+	return s.flightRepo.CompleteMultiPointTask(task.ID, int(actualDist), actualDuration)
 }
 
 // ==================== 飞行统计 ====================
@@ -1296,9 +1584,11 @@ func (s *FlightService) CreateManualAlert(input *CreateFlightAlertInput) (*model
 		Status:         "active",
 		TriggeredAt:    triggeredAt,
 	}
+	s.prepareAlertEscalation(alert, time.Now())
 	if err := s.flightRepo.CreateAlert(alert); err != nil {
 		return nil, err
 	}
+	s.notifyAlertStep(alert, 0)
 	return alert, nil
 }
 
@@ -1395,14 +1685,14 @@ func douglasPeuckerIndices(points []model.FlightWaypoint, tolerance float64) []i
 	return indices
 }
 
-// perpendicularDistance 计算点到线段的垂直距离
+// perpendicularDistance 计算点到线段的垂直距离(米)，与轨迹简化容差单位一致
 func perpendicularDistance(lat, lng, lat1, lng1, lat2, lng2 float64) float64 {
 	// 简化计算：使用平面近似
 	dx := lat2 - lat1
 	dy := lng2 - lng1
 
 	if dx == 0 && dy == 0 {
-		return haversineDistance(lat, lng, lat1, lng1)
+		return haversineDistance(lat, lng, lat1, lng1) * 1000
 	}
 
 	t := ((lat-lat1)*dx + (lng-lng1)*dy) / (dx*dx + dy*dy)
@@ -1411,7 +1701,7 @@ func perpendicularDistance(lat, lng, lat1, lng1, lat2, lng2 float64) float64 {
 	nearLat := lat1 + t*dx
 	nearLng := lng1 + t*dy
 
-	return haversineDistance(lat, lng, nearLat, nearLng)
+	return haversineDistance(lat, lng, nearLat, nearLng) * 1000
 }
 
 // ==================== 开发模拟辅助方法 ====================
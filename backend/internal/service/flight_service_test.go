@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"go.uber.org/zap"
+
 	"wurenji-backend/internal/model"
 	"wurenji-backend/internal/repository"
 )
@@ -178,3 +180,143 @@ func TestCurvedFlightCoordinateCreatesLoopForSamePoint(t *testing.T) {
 		t.Fatalf("expected midpoint to move away from origin, got (%f,%f)", latMid, lngMid)
 	}
 }
+
+func TestCheckGeofencesHandlesPolygonEntryAndApproach(t *testing.T) {
+	db := newServiceTestDB(t, &model.Geofence{}, &model.GeofenceViolation{})
+
+	fence := &model.Geofence{
+		Name:          "港区禁飞区",
+		FenceType:     "no_fly",
+		GeometryType:  "polygon",
+		Coordinates:   model.JSON(`[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009]]`),
+		MinAltitude:   0,
+		MaxAltitude:   300,
+		AlertDistance: 200,
+		Status:        "active",
+	}
+	if err := db.Create(fence).Error; err != nil {
+		t.Fatalf("create geofence: %v", err)
+	}
+
+	service := NewFlightService(repository.NewFlightRepo(db), nil, nil, zap.NewNop())
+
+	inside := &model.FlightPosition{OrderID: 1, DroneID: 2, Latitude: 23.004, Longitude: 113.005, Altitude: 120}
+	alerts := service.checkGeofences(inside)
+	if len(alerts) != 1 || alerts[0].AlertCode != "GEO_VIOLATION" || alerts[0].AlertLevel != "critical" {
+		t.Fatalf("expected one critical GEO_VIOLATION, got %#v", alerts)
+	}
+	var violations int64
+	db.Model(&model.GeofenceViolation{}).Where("geofence_id = ?", fence.ID).Count(&violations)
+	if violations != 1 {
+		t.Fatalf("expected violation to be recorded, got %d", violations)
+	}
+
+	// 北边界外约 111 米，处于 200 米预警距离内
+	near := &model.FlightPosition{OrderID: 1, DroneID: 2, Latitude: 23.010, Longitude: 113.005, Altitude: 120}
+	alerts = service.checkGeofences(near)
+	if len(alerts) != 1 || alerts[0].AlertCode != "GEO_APPROACH" || alerts[0].AlertLevel != "warning" {
+		t.Fatalf("expected one GEO_APPROACH warning, got %#v", alerts)
+	}
+
+	far := &model.FlightPosition{OrderID: 1, DroneID: 2, Latitude: 23.020, Longitude: 113.005, Altitude: 120}
+	if alerts = service.checkGeofences(far); len(alerts) != 0 {
+		t.Fatalf("expected no alerts far from fence, got %#v", alerts)
+	}
+
+	above := &model.FlightPosition{OrderID: 1, DroneID: 2, Latitude: 23.004, Longitude: 113.005, Altitude: 400}
+	if alerts = service.checkGeofences(above); len(alerts) != 0 {
+		t.Fatalf("expected no alerts above fence ceiling, got %#v", alerts)
+	}
+}
+
+func TestGeofenceCacheInvalidatesOnWrite(t *testing.T) {
+	db := newServiceTestDB(t, &model.Geofence{}, &model.GeofenceViolation{})
+	service := NewFlightService(repository.NewFlightRepo(db), nil, nil, zap.NewNop())
+	pos := &model.FlightPosition{OrderID: 1, DroneID: 2, Latitude: 23.004, Longitude: 113.005, Altitude: 120}
+
+	if alerts := service.checkGeofences(pos); len(alerts) != 0 {
+		t.Fatalf("expected no alerts without fences, got %#v", alerts)
+	}
+
+	fence := &model.Geofence{
+		Name: "临时禁飞区", FenceType: "no_fly", GeometryType: "polygon",
+		Coordinates: model.JSON(`[[113.0,23.0],[113.01,23.0],[113.01,23.009],[113.0,23.009]]`),
+		MaxAltitude: 300, Status: "active",
+	}
+	// 绕过服务直接写库时命中缓存，不触发告警
+	if err := db.Create(fence).Error; err != nil {
+		t.Fatalf("create geofence: %v", err)
+	}
+	if alerts := service.checkGeofences(pos); len(alerts) != 0 {
+		t.Fatalf("expected cached empty fence list, got %#v", alerts)
+	}
+
+	fence.Name = "港区禁飞区"
+	if err := service.UpdateGeofence(fence); err != nil {
+		t.Fatalf("update geofence: %v", err)
+	}
+	if alerts := service.checkGeofences(pos); len(alerts) != 1 || alerts[0].Title != "进入港区禁飞区" {
+		t.Fatalf("expected violation after update invalidates cache, got %#v", alerts)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	fence.EffectiveTo = &expired
+	if err := service.UpdateGeofence(fence); err != nil {
+		t.Fatalf("update geofence: %v", err)
+	}
+	if alerts := service.checkGeofences(pos); len(alerts) != 0 {
+		t.Fatalf("expected expired fence to be ignored, got %#v", alerts)
+	}
+}
+
+func TestReportPositionsPersistsBatchInTimeOrder(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.FlightRecord{}, &model.FlightPosition{}, &model.FlightAlert{}, &model.Geofence{})
+
+	start := time.Now().Add(-time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-BATCH-001", DroneID: 5, ClientUserID: 11, ProviderUserID: 31, ExecutorPilotUserID: 66,
+		Title: "批量上报", ServiceType: "cargo", StartTime: start, EndTime: start.Add(2 * time.Hour), Status: "in_transit",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	service := NewFlightService(repository.NewFlightRepo(db), repository.NewOrderRepo(db), nil, zap.NewNop())
+	now := time.Now()
+	reqs := make([]ReportPositionRequest, 0, 3)
+	for i, offset := range []int{2, 0, 1} {
+		recordedAt := now.Add(time.Duration(offset) * time.Second)
+		reqs = append(reqs, ReportPositionRequest{
+			OrderID: order.ID, DroneID: 5, Latitude: 23.0 + float64(offset)*0.001, Longitude: 113.0,
+			Altitude: 40 + offset, BatteryLevel: 90 - i, SignalStrength: 100, RecordedAt: &recordedAt,
+		})
+	}
+	reqs[2].BatteryLevel = 10
+
+	positions, alerts, err := service.ReportPositions(reqs)
+	if err != nil {
+		t.Fatalf("report positions: %v", err)
+	}
+	if len(positions) != 3 || positions[0].Altitude != 40 || positions[2].Altitude != 42 {
+		t.Fatalf("expected positions sorted by recorded time, got %#v", positions)
+	}
+	if len(alerts) != 1 || alerts[0].AlertCode != "BATT_CRIT" {
+		t.Fatalf("expected one critical battery alert, got %#v", alerts)
+	}
+
+	var records []model.FlightRecord
+	db.Find(&records)
+	if len(records) != 1 || records[0].MaxAltitudeM != 42 {
+		t.Fatalf("expected a single flight record with refreshed metrics, got %#v", records)
+	}
+	var stored int64
+	db.Model(&model.FlightPosition{}).Where("flight_record_id = ?", records[0].ID).Count(&stored)
+	if stored != 3 {
+		t.Fatalf("expected 3 stored positions, got %d", stored)
+	}
+
+	mixed := []ReportPositionRequest{{OrderID: order.ID}, {OrderID: order.ID + 1}}
+	if _, _, err := service.ReportPositions(mixed); err == nil {
+		t.Fatalf("expected error for positions across orders")
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+	ws "wurenji-backend/internal/websocket"
+)
+
+// 站点自动跟踪事件
+const (
+	stopEventArrived  = "arrived"
+	stopEventDeparted = "departed"
+)
+
+// trackMultiPointStops 根据上报位置推进多点任务：进入当前站点半径且地速低于阈值记为到站，
+// 驶出离站半径记为离站并前进到下一站点，同时通知收货人下一站预计到达时间
+func (s *FlightService) trackMultiPointStops(order *model.Order, positions []*model.FlightPosition) {
+	task, err := s.flightRepo.GetMultiPointTaskByOrderID(order.ID)
+	if err != nil || (task.Status != "pending" && task.Status != "in_progress") {
+		return
+	}
+	stops, err := s.flightRepo.GetTaskStops(task.ID)
+	if err != nil || len(stops) == 0 {
+		return
+	}
+
+	for _, pos := range positions {
+		if err := s.applyStopPosition(order, task, stops, pos); err != nil {
+			s.logger.Warn("多点任务站点跟踪失败", zap.Int64("task_id", task.ID), zap.Error(err))
+			return
+		}
+		if task.Status == "completed" {
+			return
+		}
+	}
+}
+
+// applyStopPosition 用单个位置点驱动当前站点的状态机 pending → arrived → completed
+func (s *FlightService) applyStopPosition(order *model.Order, task *model.MultiPointTask, stops []model.MultiPointTaskStop, pos *model.FlightPosition) error {
+	if task.Status == "pending" {
+		startedAt := pos.RecordedAt
+		task.Status = "in_progress"
+		task.StartedAt = &startedAt
+		task.CurrentPointIndex = 0
+		if err := s.flightRepo.UpdateMultiPointTask(task); err != nil {
+			return err
+		}
+	}
+
+	index := nextOpenStopIndex(stops, task.CurrentPointIndex)
+	if index >= len(stops) {
+		return s.completeTrackedTask(task, stops, pos.RecordedAt)
+	}
+	if index != task.CurrentPointIndex {
+		task.CurrentPointIndex = index
+		if err := s.flightRepo.UpdateTaskProgress(task.ID, countClosedStops(stops), index); err != nil {
+			return err
+		}
+	}
+
+	stop := &stops[index]
+	here := geo.Point{Lat: pos.Latitude, Lng: pos.Longitude}
+	distance := geo.HaversineMeters(here, geo.Point{Lat: stop.Latitude, Lng: stop.Longitude})
+
+	switch stop.Status {
+	case "pending":
+		if distance > float64(s.config.StopArrivalRadius) || pos.Speed > s.config.StopArrivalSpeed*100 {
+			return nil
+		}
+		arrivedAt := pos.RecordedAt
+		stop.Status = "arrived"
+		stop.ActualArrival = &arrivedAt
+		// 返航终点没有离站，到达即完成任务
+		if index == len(stops)-1 && stop.StopType == RouteLegReturnToBase {
+			stop.Status = "completed"
+			stop.ActualDeparture = &arrivedAt
+		}
+		if err := s.flightRepo.UpdateTaskStop(stop); err != nil {
+			return err
+		}
+		s.publishStopEvent(task, stop, stopEventArrived)
+		if stop.Status == "completed" {
+			return s.completeTrackedTask(task, stops, arrivedAt)
+		}
+	case "arrived", "in_progress", "completed":
+		if distance <= float64(s.config.StopDepartureRadius) {
+			return nil
+		}
+		departedAt := pos.RecordedAt
+		stop.Status = "completed"
+		stop.ActualDeparture = &departedAt
+		if stop.ActualArrival != nil {
+			stop.DwellDuration = int(departedAt.Sub(*stop.ActualArrival).Seconds())
+		}
+		if err := s.flightRepo.UpdateTaskStop(stop); err != nil {
+			return err
+		}
+		s.publishStopEvent(task, stop, stopEventDeparted)
+
+		next := nextOpenStopIndex(stops, index+1)
+		if next >= len(stops) {
+			return s.completeTrackedTask(task, stops, departedAt)
+		}
+		task.CurrentPointIndex = next
+		task.CompletedPoints = countClosedStops(stops)
+		if err := s.flightRepo.UpdateTaskProgress(task.ID, task.CompletedPoints, next); err != nil {
+			return err
+		}
+		return s.announceNextStop(order, task, &stops[next], here, departedAt)
+	}
+	return nil
+}
+
+// announceNextStop 按当前位置到下一站点的直线距离和巡航速度更新预计到达时间并通知收货人
+func (s *FlightService) announceNextStop(order *model.Order, task *model.MultiPointTask, next *model.MultiPointTaskStop, from geo.Point, departedAt time.Time) error {
+	speed := s.config.RouteCruiseSpeed
+	if speed <= 0 {
+		speed = 10
+	}
+	distance := geo.HaversineMeters(from, geo.Point{Lat: next.Latitude, Lng: next.Longitude})
+	eta := departedAt.Add(time.Duration(distance/float64(speed)) * time.Second)
+	next.ExpectedArrival = &eta
+	if err := s.flightRepo.UpdateTaskStop(next); err != nil {
+		return err
+	}
+
+	if s.realtime != nil {
+		s.realtime.Publish(ws.OrderTopic(task.OrderID), "multipoint_stop_eta", map[string]interface{}{
+			"task_id":          task.ID,
+			"stop_id":          next.ID,
+			"sequence_no":      next.SequenceNo,
+			"stop_type":        next.StopType,
+			"distance":         int(distance),
+			"expected_arrival": eta,
+		})
+	}
+	// 换电与返航站点只涉及机组，不通知收货人
+	if next.StopType == RouteLegBatterySwap || next.StopType == RouteLegReturnToBase {
+		return nil
+	}
+	recipients := orderClientReceivers(order)
+	if next.ContactPhone != "" {
+		contacts, err := s.flightRepo.ListActiveUserIDsByPhone([]string{next.ContactPhone})
+		if err != nil {
+			s.logger.Warn("查询站点联系人失败", zap.Int64("stop_id", next.ID), zap.Error(err))
+		}
+		recipients = append(recipients, contacts...)
+	}
+	s.events.NotifyStopETA(task, next, order, eta, recipients)
+	return nil
+}
+
+// completeTrackedTask 所有站点完成后以最后一个位置点时间结束任务
+func (s *FlightService) completeTrackedTask(task *model.MultiPointTask, stops []model.MultiPointTaskStop, endAt time.Time) error {
+	task.CompletedPoints = countClosedStops(stops)
+	if err := s.flightRepo.UpdateTaskProgress(task.ID, task.CompletedPoints, task.CurrentPointIndex); err != nil {
+		return err
+	}
+	if err := s.finishMultiPointTask(task, stops, endAt); err != nil {
+		return err
+	}
+	task.Status = "completed"
+	return nil
+}
+
+// publishStopEvent 推送站点到达/离开事件到订单主题
+func (s *FlightService) publishStopEvent(task *model.MultiPointTask, stop *model.MultiPointTaskStop, event string) {
+	if s.realtime == nil {
+		return
+	}
+	s.realtime.Publish(ws.OrderTopic(task.OrderID), "multipoint_stop", map[string]interface{}{
+		"event":            event,
+		"task_id":          task.ID,
+		"stop_id":          stop.ID,
+		"sequence_no":      stop.SequenceNo,
+		"stop_type":        stop.StopType,
+		"status":           stop.Status,
+		"actual_arrival":   stop.ActualArrival,
+		"actual_departure": stop.ActualDeparture,
+		"dwell_duration":   stop.DwellDuration,
+	})
+}
+
+// nextOpenStopIndex 从 from 开始跳过被手动跳过的站点
+func nextOpenStopIndex(stops []model.MultiPointTaskStop, from int) int {
+	index := from
+	for index < len(stops) && stops[index].Status == "skipped" {
+		index++
+	}
+	return index
+}
+
+func countClosedStops(stops []model.MultiPointTaskStop) int {
+	count := 0
+	for _, stop := range stops {
+		if stop.Status == "completed" || stop.Status == "skipped" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestReportPositionTracksStopArrivalAndDeparture(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.FlightRecord{}, &model.FlightPosition{}, &model.FlightAlert{},
+		&model.Geofence{}, &model.User{}, &model.FlightMonitorConfig{}, &model.MultiPointTask{}, &model.MultiPointTaskStop{})
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	order := &model.Order{
+		OrderNo: "WRJ-STOP-001", DroneID: 5, ClientUserID: 11, ProviderUserID: 31, ExecutorPilotUserID: 66,
+		Title: "多点配送", ServiceType: "cargo", StartTime: start, EndTime: start.Add(2 * time.Hour), Status: "in_transit",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	receiver := &model.User{Phone: "13900000001", Nickname: "收货人", UserType: "client", Status: "active"}
+	if err := db.Create(receiver).Error; err != nil {
+		t.Fatalf("create receiver: %v", err)
+	}
+	task := &model.MultiPointTask{OrderID: order.ID, TaskNo: "MPT-STOP-001", TaskType: "delivery", TotalPoints: 3, Status: "pending"}
+	if err := db.Create(task).Error; err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	stops := []model.MultiPointTaskStop{
+		{TaskID: task.ID, SequenceNo: 1, StopType: "delivery", Latitude: 31.0, Longitude: 121.01, Address: "一号楼"},
+		{TaskID: task.ID, SequenceNo: 2, StopType: "delivery", Latitude: 31.0, Longitude: 121.02, Address: "二号楼", ContactPhone: receiver.Phone},
+		{TaskID: task.ID, SequenceNo: 3, StopType: RouteLegReturnToBase, Latitude: 31.0, Longitude: 121.0, Address: "基地"},
+	}
+	if err := db.Create(&stops).Error; err != nil {
+		t.Fatalf("create stops: %v", err)
+	}
+
+	pusher := &recordingPushService{}
+	flights := NewFlightService(repository.NewFlightRepo(db), repository.NewOrderRepo(db), nil, zap.NewNop())
+	flights.SetEventService(NewEventService(nil, pusher, zap.NewNop()))
+	report := func(offset time.Duration, lng float64, speed int) {
+		at := start.Add(offset)
+		if _, _, err := flights.ReportPosition(&ReportPositionRequest{
+			OrderID: order.ID, DroneID: 5, Latitude: 31.0, Longitude: lng, Altitude: 40, Speed: speed,
+			BatteryLevel: 80, SignalStrength: 100, RecordedAt: &at,
+		}); err != nil {
+			t.Fatalf("report position: %v", err)
+		}
+	}
+
+	// 高速掠过站点不算到站
+	report(0, 121.005, 1000)
+	report(30*time.Second, 121.0101, 800)
+	report(40*time.Second, 121.0101, 50)
+	report(2*time.Minute, 121.0102, 0)
+	report(150*time.Second, 121.012, 900)
+
+	_, got, _ := flights.GetMultiPointTask(task.ID)
+	first := got[0]
+	if first.Status != "completed" || first.ActualArrival == nil || !first.ActualArrival.Equal(start.Add(40*time.Second)) || first.DwellDuration != 110 {
+		t.Fatalf("expected first stop arrived at 40s and left after 110s, got %+v", first)
+	}
+	if got[1].ExpectedArrival == nil || got[1].ExpectedArrival.Sub(start.Add(150*time.Second)) < 70*time.Second {
+		t.Fatalf("expected ETA of next stop from remaining distance, got %v", got[1].ExpectedArrival)
+	}
+	if users := pusher.usersFor("multipoint_stop_eta"); !reflect.DeepEqual(users, []int64{11, receiver.ID}) {
+		t.Fatalf("expected client and registered stop contact notified, got %v", users)
+	}
+
+	report(4*time.Minute, 121.02, 0)
+	report(5*time.Minute, 121.018, 900)
+	report(8*time.Minute, 121.0, 0)
+
+	done, got, _ := flights.GetMultiPointTask(task.ID)
+	if done.Status != "completed" || done.CompletedPoints != 3 || done.ActualDuration != 480 || done.ActualDistance < 2800 || done.ActualDistance > 2900 {
+		t.Fatalf("expected task completed on return to base with distance in meters, got %+v", done)
+	}
+	if got[2].Status != "completed" || got[2].ActualArrival == nil {
+		t.Fatalf("expected base stop completed on arrival, got %+v", got[2])
+	}
+	if users := pusher.usersFor("multipoint_stop_eta"); len(users) != 2 {
+		t.Fatalf("expected no recipient notification for return leg, got %v", users)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+)
+
+// telemetryBindingTTL 系统ID与订单映射的缓存时间，起降状态变化后最多延迟该时间生效
+const telemetryBindingTTL = 15 * time.Second
+
+// TelemetrySample 一条飞控遥测采样，单位与 FlightPosition 一致
+type TelemetrySample struct {
+	SystemID       int // 飞控 MAVLink 系统ID
+	Latitude       float64
+	Longitude      float64
+	Altitude       int // 相对起飞点高度(米)
+	Speed          int // 地速 米/秒x100
+	Heading        int // 度
+	VerticalSpeed  int // 米/秒x100，上升为正
+	BatteryLevel   int
+	SignalStrength int
+	Temperature    *int // 摄氏度x10
+	RecordedAt     time.Time
+}
+
+// telemetryBinding 系统ID当前对应的订单，orderID 为 0 表示无飞行中的订单
+type telemetryBinding struct {
+	orderID   int64
+	droneID   int64
+	pilotID   int64
+	expiresAt time.Time
+}
+
+// IngestTelemetry 写入飞控遥测，按系统ID映射到执行中的飞行记录(或飞行中的订单)后按订单批量落库
+// 未绑定无人机或当前无飞行任务的采样直接丢弃，返回实际写入的位置点数
+func (s *FlightService) IngestTelemetry(samples []TelemetrySample) (int, error) {
+	grouped := make(map[int64][]*model.FlightPosition)
+	pilots := make(map[int64]int64)
+	for i := range samples {
+		sample := &samples[i]
+		binding, err := s.resolveTelemetryBinding(sample.SystemID)
+		if err != nil {
+			return 0, err
+		}
+		if binding.orderID == 0 {
+			continue
+		}
+		grouped[binding.orderID] = append(grouped[binding.orderID], &model.FlightPosition{
+			OrderID:        binding.orderID,
+			DroneID:        binding.droneID,
+			PilotID:        binding.pilotID,
+			Latitude:       sample.Latitude,
+			Longitude:      sample.Longitude,
+			Altitude:       sample.Altitude,
+			Speed:          sample.Speed,
+			Heading:        sample.Heading,
+			VerticalSpeed:  sample.VerticalSpeed,
+			BatteryLevel:   sample.BatteryLevel,
+			SignalStrength: sample.SignalStrength,
+			Temperature:    sample.Temperature,
+			RecordedAt:     sample.RecordedAt,
+		})
+		pilots[binding.orderID] = binding.pilotID
+	}
+
+	orderIDs := make([]int64, 0, len(grouped))
+	for orderID := range grouped {
+		orderIDs = append(orderIDs, orderID)
+	}
+	sort.Slice(orderIDs, func(i, j int) bool { return orderIDs[i] < orderIDs[j] })
+
+	stored := 0
+	var firstErr error
+	for _, orderID := range orderIDs {
+		positions := grouped[orderID]
+		sort.SliceStable(positions, func(i, j int) bool { return positions[i].RecordedAt.Before(positions[j].RecordedAt) })
+		_, err := s.persistPositions(orderID, positions, pilots[orderID])
+		if positions[0].ID != 0 {
+			stored += len(positions)
+		}
+		if err != nil {
+			s.logger.Warn("遥测位置写入失败", zap.Int64("order_id", orderID), zap.Int("points", len(positions)), zap.Error(err))
+			s.forgetTelemetryBinding(orderID)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return stored, firstErr
+}
+
+func (s *FlightService) resolveTelemetryBinding(systemID int) (telemetryBinding, error) {
+	if systemID <= 0 {
+		return telemetryBinding{}, nil
+	}
+	now := time.Now()
+
+	s.telemetryMu.Lock()
+	binding, ok := s.telemetryBindings[systemID]
+	s.telemetryMu.Unlock()
+	if ok && now.Before(binding.expiresAt) {
+		return binding, nil
+	}
+
+	binding = telemetryBinding{expiresAt: now.Add(telemetryBindingTTL)}
+	var order *model.Order
+	record, err := s.flightRepo.GetActiveFlightRecordByMavlinkSystemID(systemID)
+	switch {
+	case err == nil:
+		order, err = s.orderRepo.GetByID(record.OrderID)
+		if err != nil {
+			return telemetryBinding{}, err
+		}
+		binding.droneID = record.DroneID
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		order, err = s.orderRepo.GetInTransitOrderByMavlinkSystemID(systemID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return telemetryBinding{}, err
+		}
+	default:
+		return telemetryBinding{}, err
+	}
+	if order != nil {
+		binding.orderID = order.ID
+		binding.pilotID = order.PilotID
+		if binding.droneID == 0 {
+			binding.droneID = order.DroneID
+		}
+	}
+
+	s.telemetryMu.Lock()
+	if s.telemetryBindings == nil {
+		s.telemetryBindings = make(map[int]telemetryBinding)
+	}
+	s.telemetryBindings[systemID] = binding
+	s.telemetryMu.Unlock()
+	return binding, nil
+}
+
+// forgetTelemetryBinding 写入失败时清除该订单的映射缓存，下次重新查询
+func (s *FlightService) forgetTelemetryBinding(orderID int64) {
+	s.telemetryMu.Lock()
+	defer s.telemetryMu.Unlock()
+	for systemID, binding := range s.telemetryBindings {
+		if binding.orderID == orderID {
+			delete(s.telemetryBindings, systemID)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestIngestTelemetryMapsSystemIDToActiveFlight(t *testing.T) {
+	db := newServiceTestDB(t, &model.Drone{}, &model.Order{}, &model.FlightRecord{}, &model.FlightPosition{}, &model.FlightAlert{}, &model.Geofence{})
+
+	drone := &model.Drone{OwnerID: 31, SerialNumber: "SN-MAV-007", MavlinkSystemID: 7}
+	idle := &model.Drone{OwnerID: 31, SerialNumber: "SN-MAV-008", MavlinkSystemID: 8}
+	for _, d := range []*model.Drone{drone, idle} {
+		if err := db.Create(d).Error; err != nil {
+			t.Fatalf("create drone: %v", err)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	order := &model.Order{
+		OrderNo: "WRJ-MAV-001", DroneID: drone.ID, ClientUserID: 11, ProviderUserID: 31, Title: "遥测接入",
+		ServiceType: "cargo", StartTime: start, EndTime: start.Add(2 * time.Hour), Status: "in_transit",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	record := &model.FlightRecord{
+		FlightNo: "WRJ-MAV-001-F1", OrderID: order.ID, DroneID: drone.ID, PilotUserID: 66,
+		TakeoffAt: &start, Status: "executing",
+	}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create flight record: %v", err)
+	}
+
+	service := NewFlightService(repository.NewFlightRepo(db), repository.NewOrderRepo(db), nil, zap.NewNop())
+	now := time.Now()
+	samples := []TelemetrySample{
+		{SystemID: 7, Latitude: 23.0101, Longitude: 113.1201, Altitude: 52, BatteryLevel: 80, SignalStrength: 95, RecordedAt: now.Add(time.Second)},
+		{SystemID: 7, Latitude: 23.0100, Longitude: 113.1200, Altitude: 50, BatteryLevel: 81, SignalStrength: 95, RecordedAt: now},
+		{SystemID: 8, Latitude: 23.2, Longitude: 113.3, BatteryLevel: 90, SignalStrength: 100, RecordedAt: now},  // 无飞行任务
+		{SystemID: 42, Latitude: 23.3, Longitude: 113.4, BatteryLevel: 90, SignalStrength: 100, RecordedAt: now}, // 未绑定
+	}
+	stored, err := service.IngestTelemetry(samples)
+	if err != nil {
+		t.Fatalf("ingest telemetry: %v", err)
+	}
+	if stored != 2 {
+		t.Fatalf("expected 2 stored positions, got %d", stored)
+	}
+
+	var positions []model.FlightPosition
+	if err := db.Order("recorded_at ASC").Find(&positions).Error; err != nil {
+		t.Fatalf("load positions: %v", err)
+	}
+	if len(positions) != 2 {
+		t.Fatalf("expected 2 positions, got %d", len(positions))
+	}
+	for _, pos := range positions {
+		if pos.OrderID != order.ID || pos.DroneID != drone.ID || pos.FlightRecordID == nil || *pos.FlightRecordID != record.ID {
+			t.Fatalf("position not bound to active flight: %#v", pos)
+		}
+	}
+	if positions[0].Altitude != 50 || positions[1].Altitude != 52 {
+		t.Fatalf("expected positions ordered by recorded time, got %d, %d", positions[0].Altitude, positions[1].Altitude)
+	}
+
+	var reloaded model.FlightRecord
+	if err := db.First(&reloaded, record.ID).Error; err != nil {
+		t.Fatalf("reload flight record: %v", err)
+	}
+	if reloaded.MaxAltitudeM != 52 || reloaded.TotalDistanceM <= 0 {
+		t.Fatalf("expected flight metrics refreshed, got max altitude %.1f distance %.1f", reloaded.MaxAltitudeM, reloaded.TotalDistanceM)
+	}
+}
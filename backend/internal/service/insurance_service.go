@@ -197,6 +197,11 @@ func (s *InsuranceService) CheckMandatoryInsurance(userID int64) (map[string]boo
 	return result, nil
 }
 
+// CheckDroneLiability 检查无人机是否有生效中的第三者责任险
+func (s *InsuranceService) CheckDroneLiability(droneID int64) (bool, error) {
+	return s.insuranceRepo.HasActiveInsuredPolicy("drone", droneID, "liability")
+}
+
 // ============================================================
 // 理赔管理
 // ============================================================
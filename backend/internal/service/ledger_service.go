@@ -0,0 +1,77 @@
+package service
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/repository"
+)
+
+const ledgerReconcileLimit = 200
+
+// LedgerService 复式记账对账服务
+type LedgerService struct {
+	ledgerRepo *repository.LedgerRepo
+	logger     *zap.Logger
+}
+
+func NewLedgerService(ledgerRepo *repository.LedgerRepo, logger *zap.Logger) *LedgerService {
+	return &LedgerService{ledgerRepo: ledgerRepo, logger: logger}
+}
+
+// LedgerReconciliationReport 对账报告: 借贷不平衡凭证、账户余额漂移、钱包与账本不一致
+type LedgerReconciliationReport struct {
+	GeneratedAt       time.Time                         `json:"generated_at"`
+	OpenedWallets     int                               `json:"opened_wallets"`
+	UnbalancedEntries []repository.LedgerEntryImbalance `json:"unbalanced_entries"`
+	AccountDrifts     []repository.LedgerAccountDrift   `json:"account_drifts"`
+	WalletDrifts      []repository.WalletLedgerDrift    `json:"wallet_drifts"`
+	SystemBalances    []repository.LedgerAccountBalance `json:"system_balances"`
+	DriftCount        int                               `json:"drift_count"`
+}
+
+// Reconcile 先为存量钱包补记期初余额，再生成对账报告
+func (s *LedgerService) Reconcile() (*LedgerReconciliationReport, error) {
+	opened, err := s.ledgerRepo.OpenLegacyWallets(ledgerReconcileLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LedgerReconciliationReport{GeneratedAt: time.Now(), OpenedWallets: opened}
+	if report.UnbalancedEntries, err = s.ledgerRepo.ListUnbalancedEntries(ledgerReconcileLimit); err != nil {
+		return nil, err
+	}
+	if report.AccountDrifts, err = s.ledgerRepo.ListAccountDrifts(ledgerReconcileLimit); err != nil {
+		return nil, err
+	}
+	if report.WalletDrifts, err = s.ledgerRepo.ListWalletDrifts(ledgerReconcileLimit); err != nil {
+		return nil, err
+	}
+	if report.SystemBalances, err = s.ledgerRepo.ListSystemBalances(); err != nil {
+		return nil, err
+	}
+	report.DriftCount = len(report.UnbalancedEntries) + len(report.AccountDrifts) + len(report.WalletDrifts)
+	return report, nil
+}
+
+// RunReconcileJob 定时对账，发现漂移时记录告警日志，返回漂移条数
+func (s *LedgerService) RunReconcileJob() (int, error) {
+	report, err := s.Reconcile()
+	if err != nil {
+		return 0, err
+	}
+	if report.DriftCount > 0 {
+		s.logger.Warn("Ledger reconciliation found drift",
+			zap.Int("unbalanced_entries", len(report.UnbalancedEntries)),
+			zap.Int("account_drifts", len(report.AccountDrifts)),
+			zap.Int("wallet_drifts", len(report.WalletDrifts)),
+		)
+	}
+	return report.DriftCount, nil
+}
+
+// GetUserBalances 获取用户在账本中的各账户余额
+func (s *LedgerService) GetUserBalances(userID int64) ([]repository.LedgerAccountBalance, error) {
+	return s.ledgerRepo.ListUserBalances(userID)
+}
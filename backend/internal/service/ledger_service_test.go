@@ -0,0 +1,148 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/payment"
+	"wurenji-backend/internal/repository"
+)
+
+func ledgerBalance(t *testing.T, db *gorm.DB, accountType string, userID int64, bucket string) int64 {
+	t.Helper()
+	balance, err := repository.NewLedgerRepo(db).GetAccountBalance(accountType, userID, bucket)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	return balance
+}
+
+func TestLedgerSettlementAndWithdrawalStayBalanced(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{},
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.WithdrawalRecord{}, &model.PricingConfig{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	ledgerService := NewLedgerService(repository.NewLedgerRepo(db), zap.NewNop())
+	settlementService := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	settlementService.SetPayoutProvider("alipay", payment.NewMockPayout(zap.NewNop()))
+	ledgerRepo := repository.NewLedgerRepo(db)
+	if _, err := ledgerRepo.Post(&model.LedgerEntry{EntryType: "payment_capture", IdempotencyKey: "payment:PAY_LEDGER_1:capture"}, []repository.LedgerLine{
+		{AccountType: model.LedgerAccountExternal, Amount: -100000},
+		{AccountType: model.LedgerAccountEscrow, Amount: 100000},
+	}); err != nil {
+		t.Fatalf("post capture: %v", err)
+	}
+
+	completedAt := time.Now().Add(-96 * time.Hour)
+	if err := db.Create(&model.Order{OrderNo: "ORD_LEDGER_001", OrderType: "cargo", OwnerID: 21, RenterID: 31, ExecutorPilotUserID: 11, TotalAmount: 100000, Status: "completed", CompletedAt: &completedAt}).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := settlementService.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	if escrow := ledgerBalance(t, db, model.LedgerAccountEscrow, 0, model.LedgerBucketAvailable); escrow != 0 {
+		t.Fatalf("expected escrow drained by settlement, got %d", escrow)
+	}
+	pilotIncome := ledgerBalance(t, db, model.LedgerAccountPilot, 11, model.LedgerBucketAvailable)
+	if pilotIncome == 0 || walletBalance(t, db, 11) != pilotIncome {
+		t.Fatalf("expected wallet to mirror ledger, wallet=%d ledger=%d", walletBalance(t, db, 11), pilotIncome)
+	}
+
+	rejected, err := settlementService.RequestWithdrawal(11, 10000, "alipay", map[string]string{"alipay_account": "a@b.c"})
+	if err != nil {
+		t.Fatalf("request withdrawal: %v", err)
+	}
+	if frozen := ledgerBalance(t, db, model.LedgerAccountPilot, 11, model.LedgerBucketFrozen); frozen != 10000 {
+		t.Fatalf("expected 10000 frozen, got %d", frozen)
+	}
+	if err := settlementService.RejectWithdrawal(rejected.ID, 1, "账户有误"); err != nil {
+		t.Fatalf("reject withdrawal: %v", err)
+	}
+	approved, err := settlementService.RequestWithdrawal(11, 20000, "alipay", map[string]string{"alipay_account": "a@b.c"})
+	if err != nil {
+		t.Fatalf("request withdrawal: %v", err)
+	}
+	if err := settlementService.ApproveWithdrawal(approved.ID, 1); err != nil {
+		t.Fatalf("approve withdrawal: %v", err)
+	}
+	if _, err := settlementService.RequestWithdrawal(11, pilotIncome, "alipay", nil); err == nil {
+		t.Fatal("expected withdrawal beyond ledger balance to be rejected")
+	}
+
+	var wallet model.UserWallet
+	db.Where("user_id = ?", 11).First(&wallet)
+	if wallet.AvailableBalance != pilotIncome-20000 || wallet.FrozenBalance != 0 || wallet.TotalWithdrawn != 20000 {
+		t.Fatalf("unexpected wallet after withdrawals: %#v", wallet)
+	}
+
+	report, err := ledgerService.Reconcile()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.DriftCount != 0 {
+		t.Fatalf("expected clean reconciliation, got %#v", report)
+	}
+}
+
+func TestLedgerReconcileOpensLegacyWalletsAndFlagsDrift(t *testing.T) {
+	db := newServiceTestDB(t, &model.UserWallet{}, &model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{})
+	ledgerService := NewLedgerService(repository.NewLedgerRepo(db), zap.NewNop())
+	legacy := &model.UserWallet{UserID: 51, WalletType: "general", AvailableBalance: 8800, FrozenBalance: 200, Status: "active"}
+	if err := db.Create(legacy).Error; err != nil {
+		t.Fatalf("create wallet: %v", err)
+	}
+
+	report, err := ledgerService.Reconcile()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.OpenedWallets != 1 || report.DriftCount != 0 {
+		t.Fatalf("expected legacy wallet opened without drift, got %#v", report)
+	}
+	if available := ledgerBalance(t, db, model.LedgerAccountClient, 51, model.LedgerBucketAvailable); available != 8800 {
+		t.Fatalf("expected opening balance 8800, got %d", available)
+	}
+
+	db.Model(legacy).Update("available_balance", 9900)
+	report, err = ledgerService.Reconcile()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(report.WalletDrifts) != 1 || report.WalletDrifts[0].WalletAvailable != 9900 || report.WalletDrifts[0].LedgerAvailable != 8800 {
+		t.Fatalf("expected wallet drift to be flagged, got %#v", report.WalletDrifts)
+	}
+}
+
+func TestCreditServiceDepositPostsToLedgerOnce(t *testing.T) {
+	db := newServiceTestDB(t, &model.Deposit{}, &model.UserWallet{}, &model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{})
+	creditService := NewCreditService(repository.NewCreditRepository(db))
+	creditService.SetLedgerRepo(repository.NewLedgerRepo(db))
+
+	deposit, err := creditService.RequireDeposit(61, "pilot", 50000, "新飞手保证金")
+	if err != nil {
+		t.Fatalf("require deposit: %v", err)
+	}
+	if err := creditService.PayDeposit(deposit.ID, 1, 50000); err != nil {
+		t.Fatalf("pay deposit: %v", err)
+	}
+	if held := ledgerBalance(t, db, model.LedgerAccountPilot, 61, model.LedgerBucketDeposit); held != 50000 {
+		t.Fatalf("expected 50000 held as deposit, got %d", held)
+	}
+	if err := creditService.RefundDeposit(deposit.ID, "退出平台"); err != nil {
+		t.Fatalf("refund deposit: %v", err)
+	}
+	if err := creditService.RefundDeposit(deposit.ID, "重复退还"); err != nil {
+		t.Fatalf("repeat refund: %v", err)
+	}
+	if held := ledgerBalance(t, db, model.LedgerAccountPilot, 61, model.LedgerBucketDeposit); held != 0 {
+		t.Fatalf("expected deposit refunded once, got %d", held)
+	}
+	if external := ledgerBalance(t, db, model.LedgerAccountExternal, 0, model.LedgerBucketAvailable); external != 0 {
+		t.Fatalf("expected external account back to zero, got %d", external)
+	}
+}
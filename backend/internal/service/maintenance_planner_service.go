@@ -0,0 +1,499 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// 维护计划的计量指标
+const (
+	MaintenanceMetricFlightHours    = "flight_hours"
+	MaintenanceMetricCycles         = "cycles"
+	MaintenanceMetricPayloadHours   = "payload_hours"
+	MaintenanceMetricCriticalAlerts = "critical_alerts"
+	MaintenanceMetricDays           = "days"
+)
+
+// 维护工单等级，由低到高
+const (
+	MaintenanceLevelDueSoon   = "due_soon"
+	MaintenanceLevelDue       = "due"
+	MaintenanceLevelHardLimit = "hard_limit"
+)
+
+var maintenanceLevelRank = map[string]int{
+	MaintenanceLevelDueSoon:   1,
+	MaintenanceLevelDue:       2,
+	MaintenanceLevelHardLimit: 3,
+}
+
+// maintenanceUsageBatchSize 每轮累加的飞行记录数
+const maintenanceUsageBatchSize = 500
+
+// maintenanceRateWindowDays 估算日均使用量的回看天数
+const maintenanceRateWindowDays = 30
+
+// MaintenancePlannerService 预测性维护：按已结束的飞行累加无人机使用量(飞行小时、起降次数、载重小时、紧急告警)，
+// 对照机型维护计划生成维护工单，超过强制上限时停飞并暂停供给，直至登记维护
+type MaintenancePlannerService struct {
+	maintenanceRepo *repository.MaintenanceRepo
+	droneRepo       *repository.DroneRepo
+	events          *EventService
+	logger          *zap.Logger
+}
+
+func NewMaintenancePlannerService(maintenanceRepo *repository.MaintenanceRepo, droneRepo *repository.DroneRepo, logger *zap.Logger) *MaintenancePlannerService {
+	return &MaintenancePlannerService{maintenanceRepo: maintenanceRepo, droneRepo: droneRepo, logger: logger}
+}
+
+func (s *MaintenancePlannerService) SetEventService(eventService *EventService) {
+	s.events = eventService
+}
+
+// MaintenancePlanResult 一次维护计划任务的汇总
+type MaintenancePlanResult struct {
+	FlightsCounted int `json:"flights_counted"`
+	DronesChecked  int `json:"drones_checked"`
+	WorkOrders     int `json:"work_orders"`
+	Escalated      int `json:"escalated"`
+	Grounded       int `json:"grounded"`
+}
+
+// ComponentForecast 部件维护预测
+type ComponentForecast struct {
+	ScheduleID       int64      `json:"schedule_id"`
+	Component        string     `json:"component"`
+	ComponentName    string     `json:"component_name"`
+	Metric           string     `json:"metric"`
+	Usage            float64    `json:"usage"`
+	IntervalValue    float64    `json:"interval_value"`
+	HardLimit        float64    `json:"hard_limit"`
+	Remaining        float64    `json:"remaining"`
+	DailyRate        float64    `json:"daily_rate"`
+	PredictedDueDate *time.Time `json:"predicted_due_date"`
+	LastServicedAt   *time.Time `json:"last_serviced_at"`
+	Status           string     `json:"status"` // ok, due_soon, due, hard_limit
+	WorkOrderNo      string     `json:"work_order_no,omitempty"`
+}
+
+// MaintenanceForecast 无人机维护预测
+type MaintenanceForecast struct {
+	DroneID    int64                    `json:"drone_id"`
+	Usage      *model.DroneUsageCounter `json:"usage"`
+	Components []ComponentForecast      `json:"components"`
+}
+
+// componentUsage 部件自上次维护以来的使用量
+type componentUsage struct {
+	schedule *model.MaintenanceSchedule
+	baseline *model.DroneComponentBaseline
+	usage    float64
+	level    string
+}
+
+// RunPlanner 累加新结束飞行的使用量，并重新评估所有有使用量的无人机
+func (s *MaintenancePlannerService) RunPlanner(now time.Time) (*MaintenancePlanResult, error) {
+	result := &MaintenancePlanResult{}
+	counted, err := s.AccumulateUsage(now)
+	result.FlightsCounted = counted
+	if err != nil {
+		return result, err
+	}
+
+	counters, err := s.maintenanceRepo.ListUsageCounters()
+	if err != nil {
+		return result, err
+	}
+	for i := range counters {
+		drone, err := s.droneRepo.GetByID(counters[i].DroneID)
+		if err != nil {
+			s.logger.Warn("维护评估获取无人机失败", zap.Int64("drone_id", counters[i].DroneID), zap.Error(err))
+			continue
+		}
+		created, escalated, grounded, err := s.evaluateDrone(drone, &counters[i], now)
+		if err != nil {
+			s.logger.Warn("无人机维护评估失败", zap.Int64("drone_id", drone.ID), zap.Error(err))
+			continue
+		}
+		result.DronesChecked++
+		result.WorkOrders += created
+		result.Escalated += escalated
+		if grounded {
+			result.Grounded++
+		}
+	}
+	return result, nil
+}
+
+// AccumulateUsage 将已结束且未计入的飞行累加到无人机使用量，每条飞行只计一次
+func (s *MaintenancePlannerService) AccumulateUsage(now time.Time) (int, error) {
+	counted := 0
+	for {
+		usages, err := s.maintenanceRepo.ListUncountedFlights(maintenanceUsageBatchSize)
+		if err != nil {
+			return counted, err
+		}
+		for i := range usages {
+			hours := float64(usages[i].TotalDurationSeconds) / 3600
+			applied, err := s.maintenanceRepo.ApplyFlightUsage(&usages[i], hours, hours*usages[i].CargoWeightKG, now)
+			if err != nil {
+				return counted, err
+			}
+			if applied {
+				counted++
+			}
+		}
+		if len(usages) < maintenanceUsageBatchSize {
+			return counted, nil
+		}
+	}
+}
+
+// evaluateDrone 对照维护计划生成或升级工单，超过强制上限时停飞；出租中的无人机待归还后再停飞
+func (s *MaintenancePlannerService) evaluateDrone(drone *model.Drone, counter *model.DroneUsageCounter, now time.Time) (int, int, bool, error) {
+	usages, err := s.componentUsages(drone, counter, now)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	openOrders, err := s.maintenanceRepo.ListOpenWorkOrders(drone.ID)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	openByComponent := make(map[string]*model.MaintenanceWorkOrder, len(openOrders))
+	for i := range openOrders {
+		openByComponent[openOrders[i].Component] = &openOrders[i]
+	}
+
+	created, escalated := 0, 0
+	var pendingGround []*model.MaintenanceWorkOrder
+	for _, item := range usages {
+		if item.level == "" {
+			continue
+		}
+		order, exists := openByComponent[item.schedule.Component]
+		if !exists {
+			order = &model.MaintenanceWorkOrder{
+				WorkOrderNo:   fmt.Sprintf("MWO%s%d%04d", now.Format("20060102150405"), drone.ID, item.schedule.ID%10000),
+				DroneID:       drone.ID,
+				OwnerID:       drone.OwnerID,
+				ScheduleID:    item.schedule.ID,
+				Component:     item.schedule.Component,
+				ComponentName: item.schedule.ComponentName,
+				Metric:        item.schedule.Metric,
+				UsageValue:    roundUsage(item.usage),
+				IntervalValue: item.schedule.IntervalValue,
+				HardLimit:     item.schedule.HardLimit,
+				Level:         item.level,
+				Status:        "open",
+			}
+			if err := s.maintenanceRepo.CreateWorkOrder(order); err != nil {
+				return created, escalated, false, err
+			}
+			created++
+			s.events.NotifyMaintenanceWorkOrder(order, drone, false)
+		} else if maintenanceLevelRank[item.level] > maintenanceLevelRank[order.Level] {
+			order.Level = item.level
+			order.UsageValue = roundUsage(item.usage)
+			if err := s.maintenanceRepo.UpdateWorkOrder(order.ID, map[string]interface{}{
+				"level":       order.Level,
+				"usage_value": order.UsageValue,
+			}); err != nil {
+				return created, escalated, false, err
+			}
+			escalated++
+			s.events.NotifyMaintenanceWorkOrder(order, drone, false)
+		}
+		if order.Level == MaintenanceLevelHardLimit && !order.Grounded {
+			pendingGround = append(pendingGround, order)
+		}
+	}
+
+	if len(pendingGround) == 0 || drone.AvailabilityStatus == "rented" {
+		return created, escalated, false, nil
+	}
+	ids := make([]int64, 0, len(pendingGround))
+	for _, order := range pendingGround {
+		ids = append(ids, order.ID)
+	}
+	if err := s.maintenanceRepo.GroundDrone(drone, ids); err != nil {
+		return created, escalated, false, err
+	}
+	for _, order := range pendingGround {
+		order.Grounded = true
+		s.events.NotifyMaintenanceWorkOrder(order, drone, true)
+	}
+	return created, escalated, true, nil
+}
+
+// componentUsages 按生效的维护计划计算各部件自上次维护以来的使用量与等级
+func (s *MaintenancePlannerService) componentUsages(drone *model.Drone, counter *model.DroneUsageCounter, now time.Time) ([]componentUsage, error) {
+	schedules, err := s.maintenanceRepo.ListSchedules(drone.Brand, drone.Model)
+	if err != nil {
+		return nil, err
+	}
+	baselines, err := s.maintenanceRepo.ListBaselines(drone.ID)
+	if err != nil {
+		return nil, err
+	}
+	baselineByComponent := make(map[string]*model.DroneComponentBaseline, len(baselines))
+	for i := range baselines {
+		baselineByComponent[baselines[i].Component] = &baselines[i]
+	}
+
+	effective := effectiveMaintenanceSchedules(schedules)
+	usages := make([]componentUsage, 0, len(effective))
+	for _, schedule := range effective {
+		baseline := baselineByComponent[schedule.Component]
+		usage := metricUsage(schedule.Metric, drone, counter, baseline, now)
+		usages = append(usages, componentUsage{
+			schedule: schedule,
+			baseline: baseline,
+			usage:    usage,
+			level:    maintenanceLevel(schedule, usage),
+		})
+	}
+	return usages, nil
+}
+
+// effectiveMaintenanceSchedules 每个部件取最具体的计划：品牌+型号 > 品牌 > 通用
+func effectiveMaintenanceSchedules(schedules []model.MaintenanceSchedule) []*model.MaintenanceSchedule {
+	specificity := func(schedule *model.MaintenanceSchedule) int {
+		switch {
+		case schedule.Brand != "" && schedule.Model != "":
+			return 2
+		case schedule.Brand != "":
+			return 1
+		}
+		return 0
+	}
+	var order []string
+	chosen := make(map[string]*model.MaintenanceSchedule)
+	for i := range schedules {
+		schedule := &schedules[i]
+		current, ok := chosen[schedule.Component]
+		if !ok {
+			order = append(order, schedule.Component)
+		}
+		if !ok || specificity(schedule) > specificity(current) {
+			chosen[schedule.Component] = schedule
+		}
+	}
+	effective := make([]*model.MaintenanceSchedule, 0, len(order))
+	for _, component := range order {
+		effective = append(effective, chosen[component])
+	}
+	return effective
+}
+
+// metricUsage 部件自基线以来的使用量；按天计的计划从上次维护或无人机登记时起算
+func metricUsage(metric string, drone *model.Drone, counter *model.DroneUsageCounter, baseline *model.DroneComponentBaseline, now time.Time) float64 {
+	base := baseline
+	if base == nil {
+		base = &model.DroneComponentBaseline{}
+	}
+	switch metric {
+	case MaintenanceMetricFlightHours:
+		return counter.FlightHours - base.FlightHours
+	case MaintenanceMetricCycles:
+		return float64(counter.Cycles - base.Cycles)
+	case MaintenanceMetricPayloadHours:
+		return counter.PayloadHours - base.PayloadHours
+	case MaintenanceMetricCriticalAlerts:
+		return float64(counter.CriticalAlerts - base.CriticalAlerts)
+	case MaintenanceMetricDays:
+		since := drone.CreatedAt
+		if base.ServicedAt != nil {
+			since = *base.ServicedAt
+		} else if drone.LastMaintenanceDate != nil {
+			since = *drone.LastMaintenanceDate
+		}
+		if since.IsZero() || now.Before(since) {
+			return 0
+		}
+		return math.Floor(now.Sub(since).Hours() / 24)
+	}
+	return 0
+}
+
+// maintenanceLevel 按使用量判断工单等级，未进入提醒范围时返回空
+func maintenanceLevel(schedule *model.MaintenanceSchedule, usage float64) string {
+	switch {
+	case schedule.HardLimit > 0 && usage >= schedule.HardLimit:
+		return MaintenanceLevelHardLimit
+	case schedule.IntervalValue > 0 && usage >= schedule.IntervalValue:
+		return MaintenanceLevelDue
+	case schedule.IntervalValue > 0 && usage >= schedule.IntervalValue-schedule.WarnBefore:
+		return MaintenanceLevelDueSoon
+	}
+	return ""
+}
+
+func roundUsage(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// Forecast 机主查看无人机各部件的维护预测，按近 30 天日均使用量估算到期日
+func (s *MaintenancePlannerService) Forecast(userID, droneID int64, now time.Time) (*MaintenanceForecast, error) {
+	drone, err := s.droneRepo.GetByID(droneID)
+	if err != nil {
+		return nil, err
+	}
+	if drone.OwnerID != userID {
+		return nil, errors.New("无权操作此无人机")
+	}
+	counter, err := s.maintenanceRepo.GetUsageCounter(droneID)
+	if err != nil {
+		return nil, err
+	}
+	usages, err := s.componentUsages(drone, counter, now)
+	if err != nil {
+		return nil, err
+	}
+	openOrders, err := s.maintenanceRepo.ListOpenWorkOrders(droneID)
+	if err != nil {
+		return nil, err
+	}
+	openByComponent := make(map[string]string, len(openOrders))
+	for _, order := range openOrders {
+		openByComponent[order.Component] = order.WorkOrderNo
+	}
+	rates, err := s.dailyRates(droneID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	forecast := &MaintenanceForecast{DroneID: droneID, Usage: counter, Components: make([]ComponentForecast, 0, len(usages))}
+	for _, item := range usages {
+		component := ComponentForecast{
+			ScheduleID:    item.schedule.ID,
+			Component:     item.schedule.Component,
+			ComponentName: item.schedule.ComponentName,
+			Metric:        item.schedule.Metric,
+			Usage:         roundUsage(item.usage),
+			IntervalValue: item.schedule.IntervalValue,
+			HardLimit:     item.schedule.HardLimit,
+			Remaining:     roundUsage(math.Max(item.schedule.IntervalValue-item.usage, 0)),
+			DailyRate:     roundUsage(rates[item.schedule.Metric]),
+			Status:        item.level,
+			WorkOrderNo:   openByComponent[item.schedule.Component],
+		}
+		if component.Status == "" {
+			component.Status = "ok"
+		}
+		if item.baseline != nil {
+			component.LastServicedAt = item.baseline.ServicedAt
+		}
+		if component.Remaining == 0 {
+			dueAt := now
+			component.PredictedDueDate = &dueAt
+		} else if rate := rates[item.schedule.Metric]; rate > 0 {
+			dueAt := now.Add(time.Duration(component.Remaining / rate * float64(24*time.Hour)))
+			component.PredictedDueDate = &dueAt
+		}
+		forecast.Components = append(forecast.Components, component)
+	}
+	return forecast, nil
+}
+
+// dailyRates 近 30 天各指标的日均使用量
+func (s *MaintenancePlannerService) dailyRates(droneID int64, now time.Time) (map[string]float64, error) {
+	flights, err := s.maintenanceRepo.ListCountedFlightsSince(droneID, now.AddDate(0, 0, -maintenanceRateWindowDays))
+	if err != nil {
+		return nil, err
+	}
+	totals := map[string]float64{MaintenanceMetricDays: maintenanceRateWindowDays}
+	for _, flight := range flights {
+		hours := float64(flight.TotalDurationSeconds) / 3600
+		totals[MaintenanceMetricFlightHours] += hours
+		totals[MaintenanceMetricCycles]++
+		totals[MaintenanceMetricPayloadHours] += hours * flight.CargoWeightKG
+		totals[MaintenanceMetricCriticalAlerts] += float64(flight.CriticalAlerts)
+	}
+	rates := make(map[string]float64, len(totals))
+	for metric, total := range totals {
+		rates[metric] = total / maintenanceRateWindowDays
+	}
+	return rates, nil
+}
+
+// RecordService 登记维护后重置所维护部件的使用量基线并完成工单；未指定部件时视为处理全部未完成工单。
+// 因超限停飞的无人机在停飞工单全部完成且未超过预定维护日期时恢复可用
+func (s *MaintenancePlannerService) RecordService(drone *model.Drone, log *model.DroneMaintenanceLog, components []string, now time.Time) error {
+	openOrders, err := s.maintenanceRepo.ListOpenWorkOrders(drone.ID)
+	if err != nil {
+		return err
+	}
+	if len(components) == 0 {
+		for _, order := range openOrders {
+			components = append(components, order.Component)
+		}
+	}
+	if len(components) == 0 {
+		return nil
+	}
+	counter, err := s.maintenanceRepo.GetUsageCounter(drone.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.maintenanceRepo.CompleteService(counter, components, log, now); err != nil {
+		return err
+	}
+
+	serviced := make(map[string]bool, len(components))
+	for _, component := range components {
+		serviced[component] = true
+	}
+	released, stillGrounded := false, false
+	for _, order := range openOrders {
+		if !order.Grounded {
+			continue
+		}
+		if serviced[order.Component] {
+			released = true
+		} else {
+			stillGrounded = true
+		}
+	}
+	if !released || stillGrounded || drone.AvailabilityStatus != "maintenance" {
+		return nil
+	}
+	if drone.NextMaintenanceDate != nil && !drone.NextMaintenanceDate.After(now) {
+		return nil
+	}
+	return s.maintenanceRepo.ReleaseDrone(drone)
+}
+
+// GroundedReason 无人机存在因超过强制上限而未完成的工单时返回部件名称，用于阻止恢复可用
+func (s *MaintenancePlannerService) GroundedReason(droneID int64) (string, error) {
+	openOrders, err := s.maintenanceRepo.ListOpenWorkOrders(droneID)
+	if err != nil {
+		return "", err
+	}
+	for _, order := range openOrders {
+		if order.Level == MaintenanceLevelHardLimit {
+			return order.ComponentName, nil
+		}
+	}
+	return "", nil
+}
+
+// ListOwnerWorkOrders 机主查看自己无人机的维护工单
+func (s *MaintenancePlannerService) ListOwnerWorkOrders(userID int64, status string, page, pageSize int) ([]model.MaintenanceWorkOrder, int64, error) {
+	filters := map[string]interface{}{"owner_id": userID}
+	if status != "" {
+		filters["status"] = status
+	}
+	return s.maintenanceRepo.ListWorkOrders(page, pageSize, filters)
+}
+
+// ListWorkOrders 管理端维护工单列表
+func (s *MaintenancePlannerService) ListWorkOrders(page, pageSize int, filters map[string]interface{}) ([]model.MaintenanceWorkOrder, int64, error) {
+	return s.maintenanceRepo.ListWorkOrders(page, pageSize, filters)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestMaintenancePlannerGroundsDroneUntilServiced(t *testing.T) {
+	db := newServiceTestDB(t, &model.Drone{}, &model.OwnerSupply{}, &model.Order{}, &model.Demand{}, &model.FlightRecord{},
+		&model.FlightAlert{}, &model.DroneMaintenanceLog{}, &model.DroneUsageCounter{}, &model.MaintenanceSchedule{},
+		&model.DroneComponentBaseline{}, &model.MaintenanceWorkOrder{})
+
+	schedules := []model.MaintenanceSchedule{
+		{Component: "propeller", ComponentName: "螺旋桨", Metric: MaintenanceMetricFlightHours, IntervalValue: 50, WarnBefore: 5, HardLimit: 60, Enabled: true},
+		{Brand: "大疆", Model: "FlyCart 30", Component: "propeller", ComponentName: "螺旋桨", Metric: MaintenanceMetricFlightHours, IntervalValue: 40, WarnBefore: 5, HardLimit: 55, Enabled: true},
+		{Component: "payload_mechanism", ComponentName: "挂载机构", Metric: MaintenanceMetricPayloadHours, IntervalValue: 1000, WarnBefore: 100, Enabled: true},
+	}
+	if err := db.Create(&schedules).Error; err != nil {
+		t.Fatalf("create schedules: %v", err)
+	}
+	drone := &model.Drone{
+		OwnerID: 31, Brand: "大疆", Model: "FlyCart 30", SerialNumber: "SN-MNT-001", MTOWKG: 95, MaxPayloadKG: 30, AvailabilityStatus: "available",
+		CertificationStatus: "approved", UOMVerified: "verified", InsuranceVerified: "verified", AirworthinessVerified: "verified",
+	}
+	if err := db.Create(drone).Error; err != nil {
+		t.Fatalf("create drone: %v", err)
+	}
+	supply := &model.OwnerSupply{SupplyNo: "SP-MNT-001", OwnerUserID: 31, DroneID: drone.ID, Title: "山区吊运", Status: "active"}
+	if err := db.Create(supply).Error; err != nil {
+		t.Fatalf("create supply: %v", err)
+	}
+	demand := &model.Demand{DemandNo: "DM-MNT-001", ClientUserID: 11, Title: "物资吊运", ServiceType: "cargo", CargoScene: "mountain", CargoWeightKG: 20}
+	if err := db.Create(demand).Error; err != nil {
+		t.Fatalf("create demand: %v", err)
+	}
+	start := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	order := &model.Order{OrderNo: "WRJ-MNT-001", DemandID: demand.ID, DroneID: drone.ID, ClientUserID: 11, ProviderUserID: 31,
+		Title: "物资吊运", ServiceType: "cargo", StartTime: start, EndTime: start.Add(time.Hour), Status: "completed"}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	addFlight := func(no string, hours float64) *model.FlightRecord {
+		landing := start.Add(time.Duration(hours * float64(time.Hour)))
+		record := &model.FlightRecord{FlightNo: no, OrderID: order.ID, DroneID: drone.ID, TakeoffAt: &start, LandingAt: &landing,
+			TotalDurationSeconds: int(hours * 3600), Status: "completed"}
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create flight record: %v", err)
+		}
+		return record
+	}
+
+	pusher := &recordingPushService{}
+	droneRepo := repository.NewDroneRepo(db)
+	planner := NewMaintenancePlannerService(repository.NewMaintenanceRepo(db), droneRepo, zap.NewNop())
+	planner.SetEventService(NewEventService(nil, pusher, zap.NewNop()))
+	drones := NewDroneService(droneRepo, nil, repository.NewOwnerDomainRepo(db))
+	drones.SetMaintenancePlanner(planner)
+
+	addFlight("FL-MNT-001", 36)
+	now := time.Now()
+	result, err := planner.RunPlanner(now)
+	if err != nil {
+		t.Fatalf("run planner: %v", err)
+	}
+	if result.FlightsCounted != 1 || result.WorkOrders != 1 || result.Grounded != 0 {
+		t.Fatalf("expected model-specific propeller schedule due soon, got %+v", result)
+	}
+	if result, _ := planner.RunPlanner(now.Add(time.Minute)); result.FlightsCounted != 0 || result.WorkOrders != 0 {
+		t.Fatalf("expected flights counted and work orders raised once, got %+v", result)
+	}
+
+	addFlight("FL-MNT-002", 20)
+	result, err = planner.RunPlanner(now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("run planner: %v", err)
+	}
+	if result.Escalated != 1 || result.Grounded != 1 || result.WorkOrders != 1 {
+		t.Fatalf("expected propeller escalated past hard limit and payload work order raised, got %+v", result)
+	}
+	var storedDrone model.Drone
+	db.First(&storedDrone, drone.ID)
+	var storedSupply model.OwnerSupply
+	db.First(&storedSupply, supply.ID)
+	if storedDrone.AvailabilityStatus != "maintenance" || storedSupply.Status != "paused" {
+		t.Fatalf("expected drone grounded and supply paused, got drone %q supply %q", storedDrone.AvailabilityStatus, storedSupply.Status)
+	}
+	if err := drones.UpdateAvailability(31, drone.ID, "available"); err == nil {
+		t.Fatal("expected grounded drone blocked from becoming available")
+	}
+	if got := pusher.usersFor("maintenance_grounded"); !reflect.DeepEqual(got, []int64{31}) {
+		t.Fatalf("expected owner notified of grounding once, got %v", got)
+	}
+
+	forecast, err := planner.Forecast(31, drone.ID, now)
+	if err != nil {
+		t.Fatalf("forecast: %v", err)
+	}
+	if len(forecast.Components) != 2 || forecast.Components[0].Status != MaintenanceLevelHardLimit || forecast.Components[1].Usage != 1120 {
+		t.Fatalf("expected propeller over hard limit and payload-hours from cargo weight, got %+v", forecast.Components)
+	}
+
+	if _, err := drones.AddMaintenanceLog(31, drone.ID, &AddMaintenanceReq{MaintenanceType: "routine", MaintenanceDate: now,
+		Components: []string{"propeller"}}); err != nil {
+		t.Fatalf("add maintenance log: %v", err)
+	}
+	db.First(&storedDrone, drone.ID)
+	if storedDrone.AvailabilityStatus != "available" {
+		t.Fatalf("expected drone released after propeller serviced, got %q", storedDrone.AvailabilityStatus)
+	}
+	forecast, _ = planner.Forecast(31, drone.ID, now)
+	if propeller := forecast.Components[0]; propeller.Usage != 0 || propeller.Status != "ok" || propeller.LastServicedAt == nil {
+		t.Fatalf("expected propeller usage reset after service, got %+v", propeller)
+	}
+	if payload := forecast.Components[1]; payload.Status != MaintenanceLevelDue || payload.WorkOrderNo == "" {
+		t.Fatalf("expected payload work order still open, got %+v", payload)
+	}
+}
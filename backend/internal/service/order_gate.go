@@ -0,0 +1,308 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// 订单前置检查: 订单在下单、机主确认、开始飞行等流转节点按配置依次执行检查项，
+// 任一检查项不通过时流转被拒绝，并以 *OrderGateError 返回逐项原因
+
+// OrderGateReason 单项检查未通过的原因
+type OrderGateReason struct {
+	Check       string `json:"check"`        // 检查项: credit, insurance, airspace, compliance, battery
+	Code        string `json:"code"`         // 原因代码
+	Message     string `json:"message"`      // 原因说明
+	SubjectType string `json:"subject_type"` // 检查对象: user, pilot, drone, order, battery
+	SubjectID   int64  `json:"subject_id"`
+}
+
+// OrderGateError 订单流转未通过前置检查
+type OrderGateError struct {
+	Transition string            `json:"transition"`
+	Reasons    []OrderGateReason `json:"reasons"`
+}
+
+func (e *OrderGateError) Error() string {
+	messages := make([]string, 0, len(e.Reasons))
+	for _, reason := range e.Reasons {
+		messages = append(messages, reason.Message)
+	}
+	return "订单未通过前置检查: " + strings.Join(messages, "；")
+}
+
+// GateReasons 逐项原因代码，供接口层按前置检查错误处理
+func (e *OrderGateError) GateReasons() []string {
+	codes := make([]string, 0, len(e.Reasons))
+	for _, reason := range e.Reasons {
+		codes = append(codes, reason.Code)
+	}
+	return codes
+}
+
+// OrderGateService 订单流转前置检查
+type OrderGateService struct {
+	cfg              config.OrderGateConfig
+	creditService    *CreditService
+	insuranceService *InsuranceService
+	airspaceService  *AirspaceService
+	batteryService   *BatteryService
+	pilotRepo        *repository.PilotRepo
+	logger           *zap.Logger
+}
+
+func NewOrderGateService(
+	cfg config.OrderGateConfig,
+	creditService *CreditService,
+	insuranceService *InsuranceService,
+	airspaceService *AirspaceService,
+	pilotRepo *repository.PilotRepo,
+	logger *zap.Logger,
+) *OrderGateService {
+	return &OrderGateService{
+		cfg:              cfg,
+		creditService:    creditService,
+		insuranceService: insuranceService,
+		airspaceService:  airspaceService,
+		pilotRepo:        pilotRepo,
+		logger:           logger,
+	}
+}
+
+func (s *OrderGateService) SetBatteryService(batteryService *BatteryService) {
+	s.batteryService = batteryService
+}
+
+// Evaluate 执行流转节点配置的全部检查项，未通过时返回 *OrderGateError；
+// order 为流转后的订单快照，下单时尚未落库(ID 为 0)
+func (s *OrderGateService) Evaluate(transition string, order *model.Order) error {
+	checks := s.cfg.Checks(transition)
+	if len(checks) == 0 || order == nil {
+		return nil
+	}
+
+	var reasons []OrderGateReason
+	for _, check := range checks {
+		var (
+			failed []OrderGateReason
+			err    error
+		)
+		switch check {
+		case config.OrderGateCheckCredit:
+			failed, err = s.checkCredit(order)
+		case config.OrderGateCheckInsurance:
+			failed, err = s.checkInsurance(order)
+		case config.OrderGateCheckAirspace:
+			failed, err = s.checkAirspace(order)
+		case config.OrderGateCheckCompliance:
+			failed, err = s.checkCompliance(order)
+		case config.OrderGateCheckBattery:
+			failed, err = s.checkBattery(order)
+		default:
+			err = fmt.Errorf("未知的订单检查项 %s", check)
+		}
+		if err != nil {
+			return err
+		}
+		reasons = append(reasons, failed...)
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	s.logger.Info("Order transition rejected by gate",
+		zap.String("transition", transition),
+		zap.Int64("order_id", order.ID),
+		zap.Int("reasons", len(reasons)),
+	)
+	return &OrderGateError{Transition: transition, Reasons: reasons}
+}
+
+// checkCredit 下单方与服务方均不能在黑名单中，命中高风险时须已缴纳保证金；只评估不记录风控单
+func (s *OrderGateService) checkCredit(order *model.Order) ([]OrderGateReason, error) {
+	if s.creditService == nil {
+		return nil, errors.New("信用服务未初始化")
+	}
+	var reasons []OrderGateReason
+	checked := map[int64]bool{}
+	for _, userID := range []int64{order.RenterID, orderProviderUserID(order), order.ExecutorPilotUserID} {
+		if userID <= 0 || checked[userID] {
+			continue
+		}
+		checked[userID] = true
+
+		risk, err := s.creditService.EvaluatePreOrderRisk(userID, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		if risk == nil {
+			continue
+		}
+		switch risk.Action {
+		case "block_order":
+			reasons = append(reasons, OrderGateReason{
+				Check: config.OrderGateCheckCredit, Code: "blacklisted",
+				Message: fmt.Sprintf("用户%d%s", userID, risk.Description), SubjectType: "user", SubjectID: userID,
+			})
+		case "require_deposit":
+			paid, err := s.creditService.HasPaidDeposit(userID)
+			if err != nil {
+				return nil, err
+			}
+			if !paid {
+				reasons = append(reasons, OrderGateReason{
+					Check: config.OrderGateCheckCredit, Code: "deposit_required",
+					Message: fmt.Sprintf("用户%d信用风险较高(%s)，需缴纳保证金", userID, risk.Description), SubjectType: "user", SubjectID: userID,
+				})
+			}
+		}
+	}
+	return reasons, nil
+}
+
+// checkInsurance 执行飞手与无人机须有生效中的第三者责任险，尚未指派飞手时只检查无人机
+func (s *OrderGateService) checkInsurance(order *model.Order) ([]OrderGateReason, error) {
+	if s.insuranceService == nil {
+		return nil, errors.New("保险服务未初始化")
+	}
+	var reasons []OrderGateReason
+	if pilotUserID := s.pilotUserID(order); pilotUserID > 0 {
+		policies, err := s.insuranceService.CheckMandatoryInsurance(pilotUserID)
+		if err != nil {
+			return nil, err
+		}
+		if !policies["liability"] {
+			reasons = append(reasons, OrderGateReason{
+				Check: config.OrderGateCheckInsurance, Code: "pilot_liability_missing",
+				Message: "执行飞手没有生效中的第三者责任险", SubjectType: "user", SubjectID: pilotUserID,
+			})
+		}
+	}
+	if order.DroneID > 0 {
+		insured, err := s.insuranceService.CheckDroneLiability(order.DroneID)
+		if err != nil {
+			return nil, err
+		}
+		if !insured {
+			reasons = append(reasons, OrderGateReason{
+				Check: config.OrderGateCheckInsurance, Code: "drone_liability_missing",
+				Message: "无人机没有生效中的第三者责任险", SubjectType: "drone", SubjectID: order.DroneID,
+			})
+		}
+	}
+	return reasons, nil
+}
+
+// checkAirspace 订单须有已批准的空域申请
+func (s *OrderGateService) checkAirspace(order *model.Order) ([]OrderGateReason, error) {
+	if s.airspaceService == nil {
+		return nil, errors.New("空域服务未初始化")
+	}
+	app, err := s.airspaceService.GetApplicationByOrder(order.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []OrderGateReason{{
+			Check: config.OrderGateCheckAirspace, Code: "airspace_application_missing",
+			Message: "订单尚未提交空域申请", SubjectType: "order", SubjectID: order.ID,
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if app.Status != "approved" {
+		return []OrderGateReason{{
+			Check: config.OrderGateCheckAirspace, Code: "airspace_not_approved",
+			Message: fmt.Sprintf("空域申请尚未批准(当前状态 %s)", app.Status), SubjectType: "order", SubjectID: order.ID,
+		}}, nil
+	}
+	return nil, nil
+}
+
+// checkCompliance 起飞前重新执行一次飞前合规检查，阻断项失败即拒绝
+func (s *OrderGateService) checkCompliance(order *model.Order) ([]OrderGateReason, error) {
+	if s.airspaceService == nil {
+		return nil, errors.New("空域服务未初始化")
+	}
+	if order.PilotID <= 0 {
+		return []OrderGateReason{{
+			Check: config.OrderGateCheckCompliance, Code: "pilot_unassigned",
+			Message: "订单尚未指派飞手，无法进行合规检查", SubjectType: "order", SubjectID: order.ID,
+		}}, nil
+	}
+
+	var airspaceAppID int64
+	if app, err := s.airspaceService.GetApplicationByOrder(order.ID); err == nil && app != nil {
+		airspaceAppID = app.ID
+	}
+	check, err := s.airspaceService.RunComplianceCheck(order.PilotID, order.DroneID, order.ID, airspaceAppID, "pre_flight")
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []OrderGateReason
+	for _, item := range check.Items {
+		if item.Result != "failed" || !item.IsBlocking {
+			continue
+		}
+		subjectType, subjectID := "order", order.ID
+		switch item.Category {
+		case "pilot":
+			subjectType, subjectID = "pilot", order.PilotID
+		case "drone":
+			subjectType, subjectID = "drone", order.DroneID
+		}
+		reasons = append(reasons, OrderGateReason{
+			Check: config.OrderGateCheckCompliance, Code: item.CheckCode,
+			Message: strings.TrimSuffix(item.CheckName+": "+item.Message, ": "), SubjectType: subjectType, SubjectID: subjectID,
+		})
+	}
+	return reasons, nil
+}
+
+// checkBattery 无人机登记了电池包时，订单须完成电池飞前检查，且所选电池包仍在役、健康度不低于起飞要求
+func (s *OrderGateService) checkBattery(order *model.Order) ([]OrderGateReason, error) {
+	if s.batteryService == nil {
+		return nil, errors.New("电池服务未初始化")
+	}
+	refusals, err := s.batteryService.StartFlightRefusals(order)
+	if err != nil {
+		return nil, err
+	}
+	reasons := make([]OrderGateReason, 0, len(refusals))
+	for _, refusal := range refusals {
+		if refusal.BatteryPackID == 0 {
+			reasons = append(reasons, OrderGateReason{
+				Check: config.OrderGateCheckBattery, Code: "battery_check_missing",
+				Message: refusal.Reason, SubjectType: "order", SubjectID: order.ID,
+			})
+			continue
+		}
+		reasons = append(reasons, OrderGateReason{
+			Check: config.OrderGateCheckBattery, Code: "battery_unfit",
+			Message: fmt.Sprintf("电池包 %s %s", refusal.SerialNumber, refusal.Reason), SubjectType: "battery", SubjectID: refusal.BatteryPackID,
+		})
+	}
+	return reasons, nil
+}
+
+// pilotUserID 执行飞手的用户ID
+func (s *OrderGateService) pilotUserID(order *model.Order) int64 {
+	if order.ExecutorPilotUserID > 0 {
+		return order.ExecutorPilotUserID
+	}
+	if order.PilotID <= 0 || s.pilotRepo == nil {
+		return 0
+	}
+	pilot, err := s.pilotRepo.GetByID(order.PilotID)
+	if err != nil {
+		return 0
+	}
+	return pilot.UserID
+}
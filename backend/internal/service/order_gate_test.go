@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/response"
+	"wurenji-backend/internal/repository"
+)
+
+func TestOrderGateReportsCreditAndInsuranceReasons(t *testing.T) {
+	db := newServiceTestDB(t, &model.Blacklist{}, &model.CreditScore{}, &model.RiskControl{}, &model.Deposit{}, &model.InsurancePolicy{})
+
+	if err := db.Create(&model.Blacklist{UserID: 11, UserType: "client", Reason: "恶意拒付", IsActive: true, AddedAt: time.Now()}).Error; err != nil {
+		t.Fatalf("create blacklist: %v", err)
+	}
+	if err := db.Create(&model.CreditScore{UserID: 21, UserType: "owner", TotalScore: 300}).Error; err != nil {
+		t.Fatalf("create credit score: %v", err)
+	}
+	now := time.Now()
+	if err := db.Create(&model.InsurancePolicy{
+		PolicyNo: "POL-PILOT-31", PolicyType: "liability", HolderID: 31, HolderType: "pilot",
+		Status: "active", EffectiveFrom: now.Add(-time.Hour), EffectiveTo: now.Add(24 * time.Hour),
+	}).Error; err != nil {
+		t.Fatalf("create policy: %v", err)
+	}
+
+	gate := NewOrderGateService(
+		config.OrderGateConfig{Enabled: true, Transitions: map[string][]string{
+			config.OrderTransitionProviderConfirm: {config.OrderGateCheckCredit, config.OrderGateCheckInsurance},
+		}},
+		NewCreditService(repository.NewCreditRepository(db)),
+		NewInsuranceService(repository.NewInsuranceRepository(db), zap.NewNop()),
+		nil,
+		nil,
+		zap.NewNop(),
+	)
+	order := &model.Order{ID: 1, RenterID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31, DroneID: 41}
+
+	err := gate.Evaluate(config.OrderTransitionProviderConfirm, order)
+	var gateErr *OrderGateError
+	if !errors.As(err, &gateErr) {
+		t.Fatalf("expected order gate error, got %v", err)
+	}
+	if gateErr.Transition != config.OrderTransitionProviderConfirm || len(gateErr.Reasons) != 3 {
+		t.Fatalf("unexpected gate error: %+v", gateErr)
+	}
+	if reason := gateErr.Reasons[0]; reason.Code != "blacklisted" || reason.SubjectID != 11 {
+		t.Fatalf("expected renter blacklist reason, got %+v", reason)
+	}
+	if reason := gateErr.Reasons[1]; reason.Code != "deposit_required" || reason.SubjectID != 21 {
+		t.Fatalf("expected low-credit provider to require deposit, got %+v", reason)
+	}
+	if reason := gateErr.Reasons[2]; reason.Code != "drone_liability_missing" || reason.SubjectID != 41 {
+		t.Fatalf("expected drone insurance reason, got %+v", reason)
+	}
+	var risks int64
+	db.Model(&model.RiskControl{}).Count(&risks)
+	if risks != 0 {
+		t.Fatalf("gate evaluation should not record risk controls, got %d", risks)
+	}
+
+	// 已足额缴纳保证金的高风险用户放行
+	if err := db.Create(&model.Deposit{DepositNo: "DEP-GATE-21", UserID: 21, UserType: "owner", RequiredAmount: 50000, PaidAmount: 50000, Status: "paid"}).Error; err != nil {
+		t.Fatalf("create deposit: %v", err)
+	}
+	if err := gate.Evaluate(config.OrderTransitionProviderConfirm, order); !errors.As(err, &gateErr) || len(gateErr.Reasons) != 2 {
+		t.Fatalf("expected deposit to clear the credit risk reason, got %v", err)
+	}
+
+	// 未配置检查项的流转节点直接放行
+	if err := gate.Evaluate(config.OrderTransitionCreate, order); err != nil {
+		t.Fatalf("expected create transition to pass, got %v", err)
+	}
+}
+
+func TestStartFlightRequiresApprovedAirspaceApplication(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.OrderTimeline{}, &model.AirspaceApplication{}, &model.Pilot{}, &model.Drone{})
+
+	order := &model.Order{
+		OrderNo:             "WRJ-GATE-001",
+		DroneID:             41,
+		ProviderUserID:      21,
+		ExecutorPilotUserID: 31,
+		Title:               "起飞检查测试单",
+		Status:              "preparing",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	app := &model.AirspaceApplication{
+		OrderID: order.ID, PilotID: 1, DroneID: 41, FlightPlanName: "测试航线", FlightPurpose: "cargo_delivery",
+		PlannedAltitude: 100, MaxAltitude: 120, PlannedStartTime: time.Now(), PlannedEndTime: time.Now().Add(time.Hour),
+		Status: "pending_review",
+	}
+	if err := db.Create(app).Error; err != nil {
+		t.Fatalf("create airspace application: %v", err)
+	}
+
+	airspaceRepo := repository.NewAirspaceRepo(db)
+	service := &OrderService{}
+	service.SetOrderGate(NewOrderGateService(
+		config.OrderGateConfig{Enabled: true, Transitions: map[string][]string{
+			config.OrderTransitionStartFlight: {config.OrderGateCheckAirspace},
+		}},
+		nil,
+		nil,
+		&AirspaceService{airspaceRepo: airspaceRepo, logger: zap.NewNop()},
+		nil,
+		zap.NewNop(),
+	))
+	orderRepo := repository.NewOrderRepo(db)
+
+	_, err := service.updateExecutionStatusWithRepos(31, order.ID, "in_transit", orderRepo)
+	var gateErr *OrderGateError
+	if !errors.As(err, &gateErr) || gateErr.Reasons[0].Code != "airspace_not_approved" {
+		t.Fatalf("expected airspace gate rejection, got %v", err)
+	}
+	// 接口层按 response.GateError 识别前置检查错误
+	var apiGateErr response.GateError
+	if !errors.As(err, &apiGateErr) || !reflect.DeepEqual(apiGateErr.GateReasons(), []string{"airspace_not_approved"}) {
+		t.Fatalf("expected gate error recognised by response layer, got %v", err)
+	}
+	var unchanged model.Order
+	if err := db.First(&unchanged, order.ID).Error; err != nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	if unchanged.Status != "preparing" {
+		t.Fatalf("expected order to stay preparing, got %s", unchanged.Status)
+	}
+
+	if err := db.Model(app).Update("status", "approved").Error; err != nil {
+		t.Fatalf("approve airspace application: %v", err)
+	}
+	if _, err := service.updateExecutionStatusWithRepos(31, order.ID, "in_transit", orderRepo); err != nil {
+		t.Fatalf("expected start flight to pass after approval, got %v", err)
+	}
+}
@@ -27,6 +27,13 @@ type OrderService struct {
 	orderArtifactRepo *repository.OrderArtifactRepo
 	eventService      *EventService
 	contractService   *ContractService
+	settlementService *SettlementService
+	creditService     *CreditService
+	refundPolicy      *RefundPolicyService
+	disputeService    *DisputeService
+	couponService     *CouponService
+	pricingEngine     *PricingEngine
+	orderGate         *OrderGateService
 	cfg               *config.Config
 	logger            *zap.Logger
 }
@@ -67,6 +74,84 @@ func (s *OrderService) SetContractService(contractService *ContractService) {
 	s.contractService = contractService
 }
 
+func (s *OrderService) SetSettlementService(settlementService *SettlementService) {
+	s.settlementService = settlementService
+}
+
+func (s *OrderService) SetCreditService(creditService *CreditService) {
+	s.creditService = creditService
+}
+
+func (s *OrderService) SetRefundPolicyService(refundPolicy *RefundPolicyService) {
+	s.refundPolicy = refundPolicy
+}
+
+func (s *OrderService) SetDisputeService(disputeService *DisputeService) {
+	s.disputeService = disputeService
+}
+
+func (s *OrderService) SetCouponService(couponService *CouponService) {
+	s.couponService = couponService
+}
+
+func (s *OrderService) SetPricingEngine(pricingEngine *PricingEngine) {
+	s.pricingEngine = pricingEngine
+}
+
+func (s *OrderService) SetOrderGate(orderGate *OrderGateService) {
+	s.orderGate = orderGate
+}
+
+// checkOrderGate 执行流转节点的前置检查，未注入时不做检查
+func (s *OrderService) checkOrderGate(transition string, order *model.Order) error {
+	if s.orderGate == nil {
+		return nil
+	}
+	return s.orderGate.Evaluate(transition, order)
+}
+
+// snapshotRefundPolicy 下单时记录当前适用的退款政策版本，之后政策调整不影响已下单订单
+func (s *OrderService) snapshotRefundPolicy(order *model.Order) error {
+	if s.refundPolicy == nil {
+		return nil
+	}
+	policy, err := s.refundPolicy.ResolveForOrder(order)
+	if err != nil {
+		return err
+	}
+	order.RefundPolicyID = policy.ID
+	order.RefundPolicyVersion = policy.Version
+	return nil
+}
+
+// enqueueSettlement 订单完成后登记结算，失败只记录日志，由结算定时任务补偿
+func (s *OrderService) enqueueSettlement(orderID int64) {
+	if s.settlementService == nil {
+		return
+	}
+	if err := s.settlementService.EnqueueSettlement(orderID); err != nil && s.logger != nil {
+		s.logger.Warn("enqueue settlement failed", zap.Int64("order_id", orderID), zap.Error(err))
+	}
+}
+
+// recordOrderCredit 订单完成或取消后登记信用事件，失败只记录日志，可由信用回算补登
+func (s *OrderService) recordOrderCredit(orderID int64, cancelledBy string) {
+	if s.creditService == nil {
+		return
+	}
+	order, err := s.orderRepo.GetByID(orderID)
+	if err == nil {
+		if cancelledBy != "" {
+			err = s.creditService.OnOrderCancelled(order, cancelledBy)
+		} else {
+			err = s.creditService.OnOrderCompleted(order)
+		}
+	}
+	if err != nil && s.logger != nil {
+		s.logger.Warn("record order credit event failed", zap.Int64("order_id", orderID), zap.Error(err))
+	}
+}
+
 func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*model.Order, error) {
 	db := s.orderRepo.DB()
 	if db == nil {
@@ -199,6 +284,12 @@ func (s *OrderService) createOrderWithRepos(
 		DepositAmount:          drone.Deposit,
 		Status:                 initialStatus,
 	}
+	if err := s.checkOrderGate(config.OrderTransitionCreate, order); err != nil {
+		return nil, err
+	}
+	if err := s.snapshotRefundPolicy(order); err != nil {
+		return nil, err
+	}
 
 	// 货运订单自动接单
 	if req.AutoAccept && orderSource != "supply_direct" {
@@ -319,6 +410,7 @@ func (s *OrderService) createDemandMarketOrderWithRepos(
 		DestLongitude:          destLng,
 		DestAddress:            destAddr,
 		TotalAmount:            quote.PriceAmount,
+		PricingSnapshot:        pricingSnapshot(negotiatedPricing(quote.PriceAmount)),
 		PlatformCommissionRate: commissionRate,
 		PlatformCommission:     commission,
 		OwnerAmount:            ownerAmount,
@@ -326,6 +418,12 @@ func (s *OrderService) createDemandMarketOrderWithRepos(
 		Status:                 "pending_payment",
 		ProviderConfirmedAt:    &now,
 	}
+	if err := s.checkOrderGate(config.OrderTransitionCreate, order); err != nil {
+		return nil, err
+	}
+	if err := s.snapshotRefundPolicy(order); err != nil {
+		return nil, err
+	}
 
 	if err := orderRepo.Create(order); err != nil {
 		return nil, err
@@ -401,6 +499,28 @@ func (s *OrderService) CreateDirectSupplyOrder(renterUserID int64, client *model
 	return created, nil
 }
 
+// QuoteDirectSupplyOrder 直达下单前的报价预览，与下单使用同一套计价与动态溢价
+func (s *OrderService) QuoteDirectSupplyOrder(supplyID int64, input *DirectOrderInput) (*PricingResult, error) {
+	if s.ownerDomainRepo == nil {
+		return nil, errors.New("直达下单依赖未初始化")
+	}
+	supply, err := s.ownerDomainRepo.GetSupplyByID(supplyID)
+	if err != nil {
+		return nil, errors.New("供给不存在")
+	}
+	if supply.Status != "active" {
+		return nil, errors.New("当前供给不可下单")
+	}
+	if !supply.AcceptsDirectOrder {
+		return nil, errors.New("该供给暂不支持直达下单")
+	}
+	pricingEngine := s.pricingEngine
+	if pricingEngine == nil {
+		pricingEngine = NewPricingEngine(nil, s.ownerDomainRepo)
+	}
+	return pricingEngine.QuoteDirectOrder(supply, input)
+}
+
 func (s *OrderService) createDirectSupplyOrderWithRepos(
 	renterUserID int64,
 	client *model.Client,
@@ -456,10 +576,15 @@ func (s *OrderService) createDirectSupplyOrderWithRepos(
 		return nil, errors.New("请填写送达地址")
 	}
 
-	totalAmount, err := calculateDirectOrderAmount(supply, input)
+	pricingEngine := s.pricingEngine
+	if pricingEngine == nil {
+		pricingEngine = NewPricingEngine(nil, ownerDomainRepo)
+	}
+	pricing, err := pricingEngine.QuoteDirectOrder(supply, input)
 	if err != nil {
 		return nil, err
 	}
+	totalAmount := pricing.TotalAmount
 	startAt, endAt := resolveDirectOrderSchedule(input)
 	serviceAddr, serviceLat, serviceLng := resolveDirectOrderPrimaryAddress(input)
 	destAddr, destLat, destLng := resolveDirectOrderDestination(input)
@@ -503,6 +628,7 @@ func (s *OrderService) createDirectSupplyOrderWithRepos(
 		DestLongitude:          destLng,
 		DestAddress:            destAddr,
 		TotalAmount:            totalAmount,
+		PricingSnapshot:        pricingSnapshot(pricing),
 		PlatformCommissionRate: commissionRate,
 		PlatformCommission:     commission,
 		OwnerAmount:            ownerAmount,
@@ -527,6 +653,12 @@ func (s *OrderService) createDirectSupplyOrderWithRepos(
 	if existingOrder != nil {
 		return existingOrder, nil
 	}
+	if err := s.checkOrderGate(config.OrderTransitionCreate, order); err != nil {
+		return nil, err
+	}
+	if err := s.snapshotRefundPolicy(order); err != nil {
+		return nil, err
+	}
 
 	if err := orderRepo.Create(order); err != nil {
 		return nil, err
@@ -630,6 +762,13 @@ func (s *OrderService) providerConfirmOrderWithRepos(
 	}
 
 	executionMode, needsDispatch, pilotID, executorPilotUserID := s.resolveOrderExecutionWithRepo(order.ProviderUserID, pilotRepo)
+	confirmed := *order
+	confirmed.PilotID = pilotID
+	confirmed.ExecutorPilotUserID = executorPilotUserID
+	if err := s.checkOrderGate(config.OrderTransitionProviderConfirm, &confirmed); err != nil {
+		return err
+	}
+
 	now := time.Now()
 	if err := orderRepo.UpdateFields(orderID, map[string]interface{}{
 		"status":                 "pending_payment",
@@ -991,23 +1130,35 @@ func (s *OrderService) syncOrderSnapshots(
 	return repository.UpsertOrderSnapshotBundle(artifactRepo, order, demand, supply)
 }
 
-func (s *OrderService) calculateRefundPlan(order *model.Order) (int64, string, error) {
-	if order == nil || order.PaidAt == nil || order.Status == "refunded" || order.Status == "provider_rejected" {
-		return 0, "", nil
+// quoteCancellation 按订单下单时记录的退款政策测算取消退款
+func (s *OrderService) quoteCancellation(order *model.Order, role string) (*RefundQuote, error) {
+	policy, err := s.refundPolicy.PolicyForOrder(order)
+	if err != nil {
+		return nil, fmt.Errorf("加载退款政策失败: %w", err)
 	}
+	return QuoteRefund(policy, order, role, time.Now())
+}
 
-	now := time.Now()
-	hoursUntilStart := order.StartTime.Sub(now).Hours()
-
-	switch {
-	case hoursUntilStart > 24:
-		return order.TotalAmount + order.DepositAmount, "提前24小时以上取消，全额退款", nil
-	case hoursUntilStart > 0:
-		return int64(float64(order.TotalAmount)*0.7) + order.DepositAmount,
-			fmt.Sprintf("提前%.1f小时取消，退款70%%订单金额和全部压金", hoursUntilStart), nil
-	default:
-		return 0, "", errors.New("服务已过开始时间，无法取消")
+func ensureOrderCancellable(order *model.Order) error {
+	switch order.Status {
+	case "completed", "cancelled", "refunded", "provider_rejected":
+		return errors.New("该订单不能取消")
+	case "in_progress":
+		return errors.New("服务已开始，无法取消。请在服务结束后协商解决")
+	}
+	return nil
+}
+
+// PreviewCancellation 取消前预览退款金额，不改变订单状态
+func (s *OrderService) PreviewCancellation(orderID int64, role string) (*RefundQuote, error) {
+	order, err := s.orderRepo.GetByID(orderID)
+	if err != nil {
+		return nil, errors.New("订单不存在")
 	}
+	if err := ensureOrderCancellable(order); err != nil {
+		return nil, err
+	}
+	return s.quoteCancellation(order, role)
 }
 
 func (s *OrderService) buildRefundPlans(orderID, refundAmount int64, cancelReason, policyReason string, payments []model.Payment) ([]*model.Refund, error) {
@@ -1084,6 +1235,7 @@ func (s *OrderService) CancelOrder(orderID, userID int64, reason, role string) e
 		); err != nil {
 			return err
 		}
+		s.recordOrderCredit(orderID, role)
 		if s.eventService != nil {
 			if order, err := s.orderRepo.GetByID(orderID); err == nil && order != nil {
 				s.eventService.NotifyOrderStatusChanged(order, "order_cancelled", "订单已取消", fmt.Sprintf("订单“%s”已取消。", firstNonEmpty(order.Title, order.OrderNo, "订单")))
@@ -1108,6 +1260,7 @@ func (s *OrderService) CancelOrder(orderID, userID int64, reason, role string) e
 	}); err != nil {
 		return err
 	}
+	s.recordOrderCredit(orderID, role)
 	if s.eventService != nil {
 		if order, err := s.orderRepo.GetByID(orderID); err == nil && order != nil {
 			s.eventService.NotifyOrderStatusChanged(order, "order_cancelled", "订单已取消", fmt.Sprintf("订单“%s”已取消。", firstNonEmpty(order.Title, order.OrderNo, "订单")))
@@ -1131,20 +1284,15 @@ func (s *OrderService) cancelOrderWithRepos(
 		return errors.New("订单不存在")
 	}
 
-	if order.Status == "completed" || order.Status == "cancelled" || order.Status == "refunded" {
-		return errors.New("该订单不能取消")
-	}
-	if order.Status == "provider_rejected" {
-		return errors.New("该订单不能取消")
-	}
-	if order.Status == "in_progress" {
-		return errors.New("服务已开始，无法取消。请在服务结束后协商解决")
+	if err := ensureOrderCancellable(order); err != nil {
+		return err
 	}
 
-	refundAmount, refundReason, err := s.calculateRefundPlan(order)
+	quote, err := s.quoteCancellation(order, role)
 	if err != nil {
 		return err
 	}
+	refundAmount, refundReason := quote.RefundAmount, quote.Reason
 
 	order.Status = "cancelled"
 	order.CancelReason = reason
@@ -1173,12 +1321,47 @@ func (s *OrderService) cancelOrderWithRepos(
 		}
 	}
 
+	if quote.CompensationAmount > 0 || quote.PlatformRetained > 0 {
+		if err := s.creditCancellationCompensation(order, quote, orderRepo); err != nil {
+			return err
+		}
+	}
+	if quote.PenaltyAmount > 0 && quote.PenaltyUserID > 0 {
+		if err := s.chargeCancellationPenalty(order, quote, orderRepo); err != nil {
+			return err
+		}
+	}
+	if artifactRepo != nil && quote.PaidAmount > 0 {
+		data, err := json.Marshal(quote)
+		if err != nil {
+			return err
+		}
+		if err := artifactRepo.UpsertSnapshot(orderID, "cancellation", model.JSON(data)); err != nil {
+			return err
+		}
+	}
+
 	s.restoreDroneStatusIfNoActiveOrdersWithRepos(order.DroneID, orderID, orderRepo, droneRepo)
 
+	if s.couponService != nil {
+		if err := s.couponService.releaseForOrder(orderRepo.DB(), order, time.Now()); err != nil {
+			return err
+		}
+	}
+
 	note := "订单已取消: " + reason
 	if refundAmount > 0 {
 		note = fmt.Sprintf("%s；已生成退款记录，待处理金额 %d 分", note, refundAmount)
 	}
+	if quote.CompensationAmount > 0 {
+		note = fmt.Sprintf("%s；补偿服务方 %d 分", note, quote.CompensationAmount)
+	}
+	if quote.PenaltyAmount > 0 {
+		note = fmt.Sprintf("%s；服务方违约金 %d 分，已扣缴 %d 分", note, quote.PenaltyAmount, quote.PenaltyCharged)
+	}
+	if order.UserCouponID > 0 {
+		note += "；优惠券已退回"
+	}
 	if err := orderRepo.AddTimeline(&model.OrderTimeline{
 		OrderID: orderID, Status: "cancelled", Note: note,
 		OperatorID: userID, OperatorType: role,
@@ -1197,6 +1380,36 @@ func (s *OrderService) cancelOrderWithRepos(
 	return s.syncOrderSnapshots(order, artifactRepo, demandDomainRepo, ownerDomainRepo)
 }
 
+// creditCancellationCompensation 未退还的已付金额从托管转出: 补偿部分入服务方钱包，其余归平台
+func (s *OrderService) creditCancellationCompensation(order *model.Order, quote *RefundQuote, orderRepo *repository.OrderRepo) error {
+	db := orderRepo.DB()
+	if db == nil {
+		return nil
+	}
+	return repository.NewSettlementRepo(db).CreditCancellationCompensation(order, repository.SettlementCredit{
+		AccountType: quote.CompensationAccount,
+		UserID:      quote.CompensationUserID,
+		Amount:      quote.CompensationAmount,
+		Description: fmt.Sprintf("订单%s取消补偿", order.OrderNo),
+	}, quote.PlatformRetained)
+}
+
+// chargeCancellationPenalty 服务方违约取消时从责任方余额扣缴违约金转入平台，余额不足的部分记为应收欠款
+func (s *OrderService) chargeCancellationPenalty(order *model.Order, quote *RefundQuote, orderRepo *repository.OrderRepo) error {
+	db := orderRepo.DB()
+	if db == nil {
+		return nil
+	}
+	charged, err := repository.NewSettlementRepo(db).ChargeCancellationPenalty(
+		order, quote.PenaltyUserID, quote.PenaltyAmount, fmt.Sprintf("订单%s违约取消违约金", order.OrderNo),
+	)
+	if err != nil {
+		return err
+	}
+	quote.PenaltyCharged = charged
+	return nil
+}
+
 func (s *OrderService) StartOrder(orderID, ownerID int64) error {
 	db := s.orderRepo.DB()
 	if db == nil {
@@ -1279,6 +1492,8 @@ func (s *OrderService) CompleteOrder(orderID, userID int64, role string) error {
 		if err := s.completeOrderWithRepos(orderID, userID, role, s.orderRepo, s.droneRepo, s.orderArtifactRepo, s.demandDomainRepo, s.ownerDomainRepo); err != nil {
 			return err
 		}
+		s.enqueueSettlement(orderID)
+		s.recordOrderCredit(orderID, "")
 		if s.eventService != nil {
 			if order, err := s.orderRepo.GetByID(orderID); err == nil && order != nil {
 				s.eventService.NotifyOrderStatusChanged(order, "order_completed", "订单已完成", fmt.Sprintf("订单“%s”已完成。", firstNonEmpty(order.Title, order.OrderNo, "订单")))
@@ -1301,6 +1516,8 @@ func (s *OrderService) CompleteOrder(orderID, userID int64, role string) error {
 	}); err != nil {
 		return err
 	}
+	s.enqueueSettlement(orderID)
+	s.recordOrderCredit(orderID, "")
 	if s.eventService != nil {
 		if order, err := s.orderRepo.GetByID(orderID); err == nil && order != nil {
 			s.eventService.NotifyOrderStatusChanged(order, "order_completed", "订单已完成", fmt.Sprintf("订单“%s”已完成。", firstNonEmpty(order.Title, order.OrderNo, "订单")))
@@ -1457,9 +1674,15 @@ func (s *OrderService) CreateDispute(orderID, userID int64, disputeType, summary
 		Status:          "open",
 		Summary:         summary,
 	}
+	if s.disputeService != nil {
+		s.disputeService.prepareDispute(order, record, time.Now())
+	}
 	if err := s.orderArtifactRepo.CreateDispute(record); err != nil {
 		return nil, err
 	}
+	if s.disputeService != nil {
+		s.disputeService.onDisputeOpened(order, record)
+	}
 	return record, nil
 }
 
@@ -1630,52 +1853,6 @@ func normalizeOrderRole(role string) string {
 	}
 }
 
-func calculateDirectOrderAmount(supply *model.OwnerSupply, input *DirectOrderInput) (int64, error) {
-	if supply == nil {
-		return 0, errors.New("供给不存在")
-	}
-	if supply.BasePriceAmount <= 0 {
-		return 0, errors.New("供给挂牌价无效")
-	}
-
-	trips := 1.0
-	if input != nil && input.EstimatedTripCount != nil && *input.EstimatedTripCount > 0 {
-		trips = float64(*input.EstimatedTripCount)
-	}
-
-	switch supply.PricingUnit {
-	case "", "per_trip":
-		return int64(math.Round(float64(supply.BasePriceAmount) * trips)), nil
-	case "per_kg":
-		if input == nil || input.CargoWeightKG == nil || *input.CargoWeightKG <= 0 {
-			return 0, errors.New("按重量计价时必须填写货物重量")
-		}
-		return int64(math.Round(float64(supply.BasePriceAmount) * *input.CargoWeightKG * trips)), nil
-	case "per_hour":
-		if input == nil || input.ScheduledStartAt == nil || input.ScheduledEndAt == nil {
-			return 0, errors.New("按时长计价时必须填写计划开始和结束时间")
-		}
-		hours := input.ScheduledEndAt.Sub(*input.ScheduledStartAt).Hours()
-		if hours <= 0 {
-			return 0, errors.New("按时长计价时计划结束时间必须晚于开始时间")
-		}
-		return int64(math.Round(float64(supply.BasePriceAmount) * hours * trips)), nil
-	case "per_km":
-		if input == nil || input.DepartureAddress == nil || input.DestinationAddress == nil ||
-			input.DepartureAddress.Latitude == nil || input.DepartureAddress.Longitude == nil ||
-			input.DestinationAddress.Latitude == nil || input.DestinationAddress.Longitude == nil {
-			return 0, errors.New("按里程计价时必须填写带坐标的起运和送达地址")
-		}
-		distanceKM := haversineKM(*input.DepartureAddress.Latitude, *input.DepartureAddress.Longitude, *input.DestinationAddress.Latitude, *input.DestinationAddress.Longitude)
-		if distanceKM <= 0 {
-			return 0, errors.New("无法计算有效运输距离")
-		}
-		return int64(math.Round(float64(supply.BasePriceAmount) * distanceKM * trips)), nil
-	default:
-		return 0, errors.New("暂不支持该供给的计价方式")
-	}
-}
-
 func haversineKM(lat1, lng1, lat2, lng2 float64) float64 {
 	const earthRadiusKM = 6371.0
 	dLat := (lat2 - lat1) * math.Pi / 180
@@ -1846,6 +2023,11 @@ func (s *OrderService) updateExecutionStatusWithRepos(userID int64, orderID int6
 	if err := validateExecutionStatusTransition(currentStatus, targetStatus); err != nil {
 		return "", err
 	}
+	if targetStatus == "in_transit" {
+		if err := s.checkOrderGate(config.OrderTransitionStartFlight, order); err != nil {
+			return "", err
+		}
+	}
 
 	now := time.Now()
 	updates := buildExecutionStatusUpdates(order, userID, targetStatus, rawStatus, now)
@@ -1950,6 +2132,9 @@ func (s *OrderService) ConfirmReceipt(userID int64, orderID int64) error {
 		OperatorType: "client",
 	})
 
+	s.enqueueSettlement(orderID)
+	s.recordOrderCredit(orderID, "")
+
 	if s.eventService != nil {
 		s.eventService.NotifyOrderStatusChanged(order, "order_completed", "订单已完成", fmt.Sprintf("订单\u201c%s\u201d已完成。", firstNonEmpty(order.Title, order.OrderNo, "订单")))
 	}
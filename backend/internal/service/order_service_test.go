@@ -10,33 +10,33 @@ import (
 	"wurenji-backend/internal/repository"
 )
 
-func TestCalculateDirectOrderAmountPerTripAndPerKG(t *testing.T) {
+func TestQuoteDirectOrderPerTripAndPerKG(t *testing.T) {
 	trips := 2
 	weight := 3.5
 	perTripSupply := &model.OwnerSupply{BasePriceAmount: 12000, PricingUnit: "per_trip"}
 	perKGSupply := &model.OwnerSupply{BasePriceAmount: 800, PricingUnit: "per_kg"}
 
-	tripAmount, err := calculateDirectOrderAmount(perTripSupply, &DirectOrderInput{EstimatedTripCount: &trips})
+	tripQuote, err := NewPricingEngine(nil, nil).QuoteDirectOrder(perTripSupply, &DirectOrderInput{EstimatedTripCount: &trips})
 	if err != nil {
 		t.Fatalf("unexpected per_trip error: %v", err)
 	}
-	if tripAmount != 24000 {
-		t.Fatalf("expected per_trip amount 24000, got %d", tripAmount)
+	if tripQuote.TotalAmount != 24000 {
+		t.Fatalf("expected per_trip amount 24000, got %d", tripQuote.TotalAmount)
 	}
 
-	kgAmount, err := calculateDirectOrderAmount(perKGSupply, &DirectOrderInput{
+	kgQuote, err := NewPricingEngine(nil, nil).QuoteDirectOrder(perKGSupply, &DirectOrderInput{
 		EstimatedTripCount: &trips,
 		CargoWeightKG:      &weight,
 	})
 	if err != nil {
 		t.Fatalf("unexpected per_kg error: %v", err)
 	}
-	if kgAmount != 5600 {
-		t.Fatalf("expected per_kg amount 5600, got %d", kgAmount)
+	if kgQuote.TotalAmount != 5600 {
+		t.Fatalf("expected per_kg amount 5600, got %d", kgQuote.TotalAmount)
 	}
 }
 
-func TestCalculateDirectOrderAmountPerHourAndPerKM(t *testing.T) {
+func TestQuoteDirectOrderPerHourAndPerKM(t *testing.T) {
 	start := time.Date(2026, 3, 15, 9, 0, 0, 0, time.Local)
 	end := start.Add(3 * time.Hour)
 	lat1, lng1 := 23.0215, 113.1214
@@ -45,18 +45,18 @@ func TestCalculateDirectOrderAmountPerHourAndPerKM(t *testing.T) {
 	perHourSupply := &model.OwnerSupply{BasePriceAmount: 5000, PricingUnit: "per_hour"}
 	perKMSupply := &model.OwnerSupply{BasePriceAmount: 1200, PricingUnit: "per_km"}
 
-	hourAmount, err := calculateDirectOrderAmount(perHourSupply, &DirectOrderInput{
+	hourQuote, err := NewPricingEngine(nil, nil).QuoteDirectOrder(perHourSupply, &DirectOrderInput{
 		ScheduledStartAt: &start,
 		ScheduledEndAt:   &end,
 	})
 	if err != nil {
 		t.Fatalf("unexpected per_hour error: %v", err)
 	}
-	if hourAmount != 15000 {
-		t.Fatalf("expected per_hour amount 15000, got %d", hourAmount)
+	if hourQuote.TotalAmount != 15000 {
+		t.Fatalf("expected per_hour amount 15000, got %d", hourQuote.TotalAmount)
 	}
 
-	kmAmount, err := calculateDirectOrderAmount(perKMSupply, &DirectOrderInput{
+	kmQuote, err := NewPricingEngine(nil, nil).QuoteDirectOrder(perKMSupply, &DirectOrderInput{
 		DepartureAddress:   &AddressSnapshotInput{Text: "起点", Latitude: &lat1, Longitude: &lng1},
 		DestinationAddress: &AddressSnapshotInput{Text: "终点", Latitude: &lat2, Longitude: &lng2},
 	})
@@ -64,8 +64,8 @@ func TestCalculateDirectOrderAmountPerHourAndPerKM(t *testing.T) {
 		t.Fatalf("unexpected per_km error: %v", err)
 	}
 	expected := int64(math.Round(float64(perKMSupply.BasePriceAmount) * haversineKM(lat1, lng1, lat2, lng2)))
-	if kmAmount != expected {
-		t.Fatalf("expected per_km amount %d, got %d", expected, kmAmount)
+	if kmQuote.TotalAmount != expected {
+		t.Fatalf("expected per_km amount %d, got %d", expected, kmQuote.TotalAmount)
 	}
 }
 
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/pkg/payment"
+)
+
+// HandleProviderNotify 处理支付渠道异步通知：先由渠道实现验签，再按通知结果推进支付单
+// 重复通知直接返回成功，金额或渠道不一致时拒绝
+func (s *PaymentService) HandleProviderNotify(method string, body []byte) error {
+	provider, err := s.providerFor(method)
+	if err != nil {
+		return err
+	}
+	parser, ok := provider.(payment.NotifyParser)
+	if !ok {
+		return errors.New("该支付渠道不支持异步通知")
+	}
+	notification, err := parser.ParseNotify(body)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn("payment notify verification failed", zap.String("method", method), zap.Error(err))
+		}
+		return errors.New("支付通知验签失败")
+	}
+	_, err = s.applyChannelStatus(method, notification.PaymentNo, notification.Status, notification.ThirdPartyNo, notification.Amount)
+	return err
+}
+
+// SyncPendingPayments 主动查询创建超过 olderThan、仍未收到回调的渠道支付单，window 之前创建的不再查询
+// 返回状态发生变化的支付单数
+func (s *PaymentService) SyncPendingPayments(olderThan, window time.Duration, limit int) (int, error) {
+	var methods []string
+	for method, provider := range s.providers {
+		if provider != nil && !isMockProvider(provider) {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return 0, nil
+	}
+	sort.Strings(methods)
+
+	now := time.Now()
+	payments, err := s.paymentRepo.ListPendingForSync(methods, now.Add(-window), now.Add(-olderThan), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, p := range payments {
+		status, err := s.providers[p.PaymentMethod].QueryPayment(p.PaymentNo)
+		if err == nil {
+			var updated bool
+			updated, err = s.applyChannelStatus(p.PaymentMethod, p.PaymentNo, status.Status, status.ThirdPartyNo, status.Amount)
+			if updated {
+				changed++
+				continue
+			}
+		}
+		if err != nil && s.logger != nil {
+			s.logger.Warn("payment status sync failed", zap.String("payment_no", p.PaymentNo), zap.String("method", p.PaymentMethod), zap.Error(err))
+		}
+		_ = s.paymentRepo.Touch(p.ID)
+	}
+	return changed, nil
+}
+
+// applyChannelStatus 将渠道侧交易状态同步到支付单，仅处理仍为 pending 的支付单，返回是否有变化
+func (s *PaymentService) applyChannelStatus(method, paymentNo, status, thirdPartyNo string, amount int64) (bool, error) {
+	p, err := s.paymentRepo.GetByPaymentNo(paymentNo)
+	if err != nil {
+		return false, errors.New("支付记录不存在")
+	}
+	if p.PaymentMethod != method {
+		return false, errors.New("支付渠道不匹配")
+	}
+	if p.Status != "pending" {
+		return false, nil
+	}
+
+	switch status {
+	case payment.StatusPaid:
+		// 渠道未返回金额时同样视为不一致，不能确认到账
+		if amount <= 0 || amount != p.Amount {
+			if s.logger != nil {
+				s.logger.Error("payment amount mismatch",
+					zap.String("payment_no", paymentNo),
+					zap.Int64("expected", p.Amount),
+					zap.Int64("actual", amount),
+				)
+			}
+			return false, errors.New("支付金额不一致")
+		}
+		if err := s.HandlePaymentCallback(paymentNo, thirdPartyNo); err != nil {
+			return false, err
+		}
+		return true, nil
+	case payment.StatusClosed:
+		return s.paymentRepo.UpdateStatusIfPending(p.ID, "failed")
+	}
+	return false, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/payment"
+	"wurenji-backend/internal/repository"
+)
+
+func TestSyncPendingPaymentsCompletesPaidGatewayPayment(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.OrderContract{}, &model.Payment{}, &model.OrderTimeline{}, &model.OrderSnapshot{}, &model.Refund{})
+	sandbox := payment.NewSandbox(payment.SandboxConfig{WeChatAppID: "wx_test", WeChatMchID: "1900000001", WeChatAPIKey: "k", DropNotify: true}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+
+	paymentRepo := repository.NewPaymentRepo(db)
+	orderRepo := repository.NewOrderRepo(db)
+	service := NewPaymentService(paymentRepo, orderRepo, nil, nil, repository.NewOrderArtifactRepo(db), nil, zap.NewNop())
+	service.SetProvider("mock", payment.NewMockPayment(zap.NewNop()))
+	service.SetProvider("wechat", payment.NewWeChatPayment(payment.WeChatPayConfig{
+		AppID: "wx_test", MchID: "1900000001", APIKey: "k", NotifyURL: "http://127.0.0.1:1/notify", GatewayURL: gateway.URL,
+	}, zap.NewNop()))
+	order := &model.Order{OrderNo: "ORD202610170001", OrderSource: "demand_market", ClientUserID: 301, RenterID: 301, Status: "pending_payment", TotalAmount: 66000}
+	if err := orderRepo.Create(order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	p, _, err := service.CreatePayment(order.ID, 301, "wechat")
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	if err := service.MockPaymentComplete(p.PaymentNo); err == nil || !strings.Contains(err.Error(), "支付渠道") {
+		t.Fatalf("expected mock completion to be rejected for gateway payment, got %v", err)
+	}
+
+	if changed, err := service.SyncPendingPayments(0, time.Hour, 10); err != nil || changed != 0 {
+		t.Fatalf("expected no change before payment, got %d %v", changed, err)
+	}
+	if _, err := sandbox.Complete("wechat", p.PaymentNo, "", payment.StatusPaid); err != nil {
+		t.Fatalf("sandbox complete: %v", err)
+	}
+	changed, err := service.SyncPendingPayments(0, time.Hour, 10)
+	if err != nil || changed != 1 {
+		t.Fatalf("expected one synced payment, got %d %v", changed, err)
+	}
+
+	stored, _ := paymentRepo.GetByPaymentNo(p.PaymentNo)
+	if stored.Status != "paid" || stored.ThirdPartyNo == "" {
+		t.Fatalf("expected paid payment with channel trade no, got %#v", stored)
+	}
+	updatedOrder, _ := orderRepo.GetByID(order.ID)
+	if updatedOrder.PaidAt == nil || updatedOrder.Status == "pending_payment" {
+		t.Fatalf("expected order advanced after payment, got %s", updatedOrder.Status)
+	}
+}
+
+func TestHandleProviderNotifyVerifiesSignatureAndAmount(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.OrderContract{}, &model.Payment{}, &model.OrderTimeline{}, &model.OrderSnapshot{}, &model.Refund{})
+	sandbox := payment.NewSandbox(payment.SandboxConfig{WeChatAppID: "wx_test", WeChatMchID: "1900000001", WeChatAPIKey: "k", DropNotify: true}, zap.NewNop())
+	gateway := httptest.NewServer(sandbox.Handler())
+	defer gateway.Close()
+
+	paymentRepo := repository.NewPaymentRepo(db)
+	orderRepo := repository.NewOrderRepo(db)
+	service := NewPaymentService(paymentRepo, orderRepo, nil, nil, repository.NewOrderArtifactRepo(db), nil, zap.NewNop())
+	service.SetProvider("mock", payment.NewMockPayment(zap.NewNop()))
+	service.SetProvider("wechat", payment.NewWeChatPayment(payment.WeChatPayConfig{
+		AppID: "wx_test", MchID: "1900000001", APIKey: "k", NotifyURL: "http://127.0.0.1:1/notify", GatewayURL: gateway.URL,
+	}, zap.NewNop()))
+	order := &model.Order{OrderNo: "ORD202610170002", OrderSource: "demand_market", ClientUserID: 301, RenterID: 301, Status: "pending_payment", TotalAmount: 66000}
+	if err := orderRepo.Create(order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	p, _, err := service.CreatePayment(order.ID, 301, "wechat")
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	notify := func(totalFee, key string) []byte {
+		params := map[string]string{
+			"return_code": "SUCCESS", "result_code": "SUCCESS", "appid": "wx_test", "mch_id": "1900000001",
+			"out_trade_no": p.PaymentNo, "transaction_id": "4200000001", "total_fee": totalFee,
+		}
+		params["sign"] = payment.WeChatSign(params, key)
+		return payment.EncodeWeChatXML(params)
+	}
+
+	if err := service.HandleProviderNotify("wechat", notify("66000", "forged")); err == nil {
+		t.Fatal("expected forged notify to be rejected")
+	}
+	if err := service.HandleProviderNotify("wechat", notify("1", "k")); err == nil || !strings.Contains(err.Error(), "金额") {
+		t.Fatalf("expected amount mismatch, got %v", err)
+	}
+	if err := service.HandleProviderNotify("wechat", notify("0", "k")); err == nil || !strings.Contains(err.Error(), "金额") {
+		t.Fatalf("expected notify without amount to be rejected, got %v", err)
+	}
+	if stored, _ := paymentRepo.GetByPaymentNo(p.PaymentNo); stored.Status != "pending" {
+		t.Fatalf("expected payment to stay pending, got %s", stored.Status)
+	}
+
+	if err := service.HandleProviderNotify("wechat", notify("66000", "k")); err != nil {
+		t.Fatalf("valid notify: %v", err)
+	}
+	if err := service.HandleProviderNotify("wechat", notify("66000", "k")); err != nil {
+		t.Fatalf("duplicate notify should be acknowledged, got %v", err)
+	}
+	stored, _ := paymentRepo.GetByPaymentNo(p.PaymentNo)
+	if stored.Status != "paid" || stored.ThirdPartyNo != "4200000001" {
+		t.Fatalf("expected paid payment, got %#v", stored)
+	}
+}
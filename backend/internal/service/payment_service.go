@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -21,9 +22,12 @@ type PaymentService struct {
 	droneRepo         *repository.DroneRepo
 	pilotRepo         *repository.PilotRepo
 	orderArtifactRepo *repository.OrderArtifactRepo
+	ledgerRepo        *repository.LedgerRepo
 	dispatchService   *DispatchService
 	eventService      *EventService
+	couponService     *CouponService
 	provider          payment.PaymentProvider
+	providers         map[string]payment.PaymentProvider
 	logger            *zap.Logger
 }
 
@@ -59,6 +63,55 @@ func (s *PaymentService) SetContractRepo(contractRepo *repository.ContractRepo)
 	s.contractRepo = contractRepo
 }
 
+func (s *PaymentService) SetCouponService(couponService *CouponService) {
+	s.couponService = couponService
+}
+
+func (s *PaymentService) SetLedgerRepo(ledgerRepo *repository.LedgerRepo) {
+	s.ledgerRepo = ledgerRepo
+}
+
+// ledgerFor 账本启用时返回绑定到 db(可为事务)的账本仓储
+func (s *PaymentService) ledgerFor(db *gorm.DB) *repository.LedgerRepo {
+	if s.ledgerRepo == nil {
+		return nil
+	}
+	if db == nil {
+		return s.ledgerRepo
+	}
+	return repository.NewLedgerRepo(db)
+}
+
+func (s *PaymentService) SetProvider(method string, provider payment.PaymentProvider) {
+	if s.providers == nil {
+		s.providers = make(map[string]payment.PaymentProvider)
+	}
+	s.providers[method] = provider
+}
+
+// providerFor 支付方式对应的渠道实现，未按渠道配置时沿用默认 Provider
+func (s *PaymentService) providerFor(method string) (payment.PaymentProvider, error) {
+	if len(s.providers) == 0 {
+		return s.provider, nil
+	}
+	provider, ok := s.providers[method]
+	if !ok {
+		return nil, errors.New("该支付方式暂未开通")
+	}
+	return provider, nil
+}
+
+// IsGatewayMethod 支付方式是否对接真实(或沙箱)支付渠道，结果以渠道回调或主动查询为准
+func (s *PaymentService) IsGatewayMethod(method string) bool {
+	provider, err := s.providerFor(method)
+	return err == nil && provider != nil && !isMockProvider(provider)
+}
+
+func isMockProvider(provider payment.PaymentProvider) bool {
+	_, ok := provider.(*payment.MockPayment)
+	return ok
+}
+
 func (s *PaymentService) CreatePayment(orderID, userID int64, method string) (*model.Payment, *payment.PaymentResult, error) {
 	method, err := normalizePaymentMethod(method)
 	if err != nil {
@@ -88,13 +141,22 @@ func (s *PaymentService) CreatePayment(orderID, userID int64, method string) (*m
 		}
 	}
 
-	amount := order.TotalAmount + order.DepositAmount
-	paymentNo := payment.GeneratePaymentNo()
-
-	result, err := buildCreatePaymentResult(method, paymentNo)
+	provider, err := s.providerFor(method)
 	if err != nil {
 		return nil, nil, err
 	}
+	gateway := provider != nil && !isMockProvider(provider)
+
+	amount := order.PayableAmount() + order.DepositAmount
+	paymentNo := payment.GeneratePaymentNo()
+
+	var result *payment.PaymentResult
+	if !gateway {
+		result, err = buildCreatePaymentResult(method, paymentNo)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
 	p := &model.Payment{
 		PaymentNo:     paymentNo,
@@ -109,6 +171,23 @@ func (s *PaymentService) CreatePayment(orderID, userID int64, method string) (*m
 		return nil, nil, err
 	}
 
+	if gateway {
+		result, err = provider.CreatePayment(paymentNo, amount, paymentDescription(order))
+		if err != nil {
+			p.Status = "failed"
+			_ = s.paymentRepo.Update(p)
+			if s.logger != nil {
+				s.logger.Error("payment gateway create failed",
+					zap.String("payment_no", paymentNo),
+					zap.String("method", method),
+					zap.Error(err),
+				)
+			}
+			return nil, nil, errors.New("支付渠道下单失败，请稍后重试")
+		}
+		result.PaymentNo = paymentNo
+	}
+
 	if s.logger != nil {
 		s.logger.Info("order payment created",
 			zap.Int64("order_id", orderID),
@@ -121,6 +200,13 @@ func (s *PaymentService) CreatePayment(orderID, userID int64, method string) (*m
 	return p, result, nil
 }
 
+func paymentDescription(order *model.Order) string {
+	if order.Title != "" {
+		return order.Title
+	}
+	return "无人机服务订单" + order.OrderNo
+}
+
 func normalizePaymentMethod(method string) (string, error) {
 	switch strings.ToLower(strings.TrimSpace(method)) {
 	case "mock":
@@ -179,12 +265,8 @@ func (s *PaymentService) HandlePaymentCallback(paymentNo, thirdPartyNo string) e
 		if err := s.triggerAutoDispatchIfNeeded(paymentNo); err != nil {
 			return err
 		}
-		if shouldNotify && s.eventService != nil {
-			if paymentRecord, err := s.paymentRepo.GetByPaymentNo(paymentNo); err == nil && paymentRecord != nil {
-				if order, orderErr := s.orderRepo.GetByID(paymentRecord.OrderID); orderErr == nil && order != nil {
-					s.eventService.NotifyOrderPaid(order)
-				}
-			}
+		if shouldNotify {
+			s.afterOrderPaid(paymentNo)
 		}
 		return nil
 	}
@@ -205,18 +287,43 @@ func (s *PaymentService) HandlePaymentCallback(paymentNo, thirdPartyNo string) e
 	if err := s.triggerAutoDispatchIfNeeded(paymentNo); err != nil {
 		return err
 	}
-	if shouldNotify && s.eventService != nil {
-		if paymentRecord, err := s.paymentRepo.GetByPaymentNo(paymentNo); err == nil && paymentRecord != nil {
-			if order, orderErr := s.orderRepo.GetByID(paymentRecord.OrderID); orderErr == nil && order != nil {
-				s.eventService.NotifyOrderPaid(order)
-			}
-		}
+	if shouldNotify {
+		s.afterOrderPaid(paymentNo)
 	}
 	return nil
 }
 
+// afterOrderPaid 支付首次成功后的通知与邀请奖励
+func (s *PaymentService) afterOrderPaid(paymentNo string) {
+	if s.eventService == nil && s.couponService == nil {
+		return
+	}
+	paymentRecord, err := s.paymentRepo.GetByPaymentNo(paymentNo)
+	if err != nil || paymentRecord == nil {
+		return
+	}
+	order, err := s.orderRepo.GetByID(paymentRecord.OrderID)
+	if err != nil || order == nil {
+		return
+	}
+	if s.eventService != nil {
+		s.eventService.NotifyOrderPaid(order)
+	}
+	if s.couponService != nil {
+		s.couponService.OnOrderPaid(order)
+	}
+}
+
 // MockPaymentComplete simulates successful payment for development
+// 对接真实渠道的支付单只能通过渠道回调或主动查询完成
 func (s *PaymentService) MockPaymentComplete(paymentNo string) error {
+	p, err := s.paymentRepo.GetByPaymentNo(paymentNo)
+	if err != nil {
+		return errors.New("支付记录不存在")
+	}
+	if s.IsGatewayMethod(p.PaymentMethod) {
+		return errors.New("该支付单需通过支付渠道完成支付")
+	}
 	return s.HandlePaymentCallback(paymentNo, "MOCK_"+paymentNo)
 }
 
@@ -282,6 +389,26 @@ func (s *PaymentService) handlePaymentCallbackWithRepos(
 	if err := paymentRepo.Update(p); err != nil {
 		return err
 	}
+	if ledger := s.ledgerFor(paymentRepo.DB()); ledger != nil {
+		if _, err := ledger.Post(&model.LedgerEntry{
+			EntryType:      "payment_capture",
+			ReferenceType:  "payment",
+			ReferenceID:    p.ID,
+			IdempotencyKey: "payment:" + p.PaymentNo + ":capture",
+			Description:    fmt.Sprintf("订单%s支付入托管", order.OrderNo),
+		}, []repository.LedgerLine{
+			{AccountType: model.LedgerAccountExternal, Amount: -p.Amount},
+			{AccountType: model.LedgerAccountEscrow, Amount: p.Amount},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if s.couponService != nil {
+		if err := s.couponService.redeemForOrder(paymentRepo.DB(), order, now); err != nil {
+			return err
+		}
+	}
 
 	return s.advanceOrderAfterPaymentWithRepos(order, p.UserID, &now, orderRepo, droneRepo, pilotRepo, artifactRepo)
 }
@@ -341,7 +468,13 @@ func (s *PaymentService) refundPaymentWithRepos(
 			return err
 		}
 
-		_, refundErr := s.provider.Refund(p.PaymentNo, refundRecord.Amount)
+		provider, refundErr := s.providerFor(p.PaymentMethod)
+		if refundErr == nil && provider == nil {
+			refundErr = errors.New("支付渠道未初始化")
+		}
+		if refundErr == nil {
+			_, refundErr = provider.Refund(p.PaymentNo, refundRecord.Amount)
+		}
 		if refundErr != nil {
 			refundRecord.Status = "failed"
 			_ = artifactRepo.UpdateRefund(refundRecord)
@@ -356,7 +489,7 @@ func (s *PaymentService) refundPaymentWithRepos(
 		}
 
 		refundRecord.Status = "success"
-		if err := artifactRepo.UpdateRefund(refundRecord); err != nil {
+		if err := s.markRefundSucceeded(artifactRepo, refundRecord, order.OrderNo); err != nil {
 			return err
 		}
 
@@ -559,3 +692,27 @@ func (s *PaymentService) triggerAutoDispatchIfNeeded(paymentNo string) error {
 	}
 	return nil
 }
+
+// markRefundSucceeded 保存退款成功状态，账本启用时在同一事务内将退款金额从托管转出
+func (s *PaymentService) markRefundSucceeded(artifactRepo *repository.OrderArtifactRepo, refund *model.Refund, orderNo string) error {
+	db := artifactRepo.DB()
+	if s.ledgerRepo == nil || db == nil {
+		return artifactRepo.UpdateRefund(refund)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := repository.NewOrderArtifactRepo(tx).UpdateRefund(refund); err != nil {
+			return err
+		}
+		_, err := repository.NewLedgerRepo(tx).Post(&model.LedgerEntry{
+			EntryType:      "refund",
+			ReferenceType:  "refund",
+			ReferenceID:    refund.ID,
+			IdempotencyKey: fmt.Sprintf("refund:%d", refund.ID),
+			Description:    fmt.Sprintf("订单%s退款", orderNo),
+		}, []repository.LedgerLine{
+			{AccountType: model.LedgerAccountEscrow, Amount: -refund.Amount},
+			{AccountType: model.LedgerAccountExternal, Amount: refund.Amount},
+		})
+		return err
+	})
+}
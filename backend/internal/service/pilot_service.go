@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"strings"
 	"time"
@@ -381,6 +382,15 @@ func (s *PilotService) UpdateAvailability(pilotID int64, status string) error {
 	if pilot.VerificationStatus != "verified" && status == "online" {
 		return errors.New("飞手资质尚未审核通过，无法上线接单")
 	}
+	if status == "online" {
+		certs, err := s.pilotRepo.GetCertificationsByPilotID(pilotID)
+		if err != nil {
+			return err
+		}
+		if expired := pilotExpiredCredential(pilot, certs, time.Now()); expired != "" {
+			return fmt.Errorf("%s已过期，请更新后再上线接单", expired)
+		}
+	}
 
 	db := s.pilotRepo.DB()
 	if db == nil {
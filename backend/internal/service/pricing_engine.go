@@ -0,0 +1,492 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+const (
+	PricingSourcePlatform    = "platform"
+	PricingSourceSupply      = "supply"
+	PricingSourceDemandQuote = "demand_quote"
+)
+
+// PricingEngine 统一定价引擎：派单估价、直达下单与价格试算共用同一套规则。
+// 平台阶梯价与系数来自 pricing_configs，指定供给时以挂牌价替代平台基础计费，并可由供给计价规则覆盖各项系数
+type PricingEngine struct {
+	settlementRepo  *repository.SettlementRepo
+	ownerDomainRepo *repository.OwnerDomainRepo
+	surgeService    *SurgeService
+}
+
+func NewPricingEngine(settlementRepo *repository.SettlementRepo, ownerDomainRepo *repository.OwnerDomainRepo) *PricingEngine {
+	return &PricingEngine{settlementRepo: settlementRepo, ownerDomainRepo: ownerDomainRepo}
+}
+
+func (e *PricingEngine) SetSurgeService(surgeService *SurgeService) {
+	e.surgeService = surgeService
+}
+
+// PricingInput 定价输入参数
+type PricingInput struct {
+	FlightDistance float64    // km
+	FlightDuration float64    // 分钟
+	CargoWeight    float64    // kg
+	CargoValue     int64      // 货物价值(分)
+	CargoType      string     // normal, fragile, hazardous
+	TaskType       string     // cargo_delivery, agriculture, mapping, inspection, emergency
+	CargoScene     string     // 作业场景，匹配供给计价规则中的场景系数
+	ScheduledAt    *time.Time // 计划作业时间，用于识别夜间与高峰时段
+	ServiceHours   float64    // 计划作业时长(小时)，按时长计价的供给使用
+	TripCount      int        // 预计架次，0 按1次计
+	IsNightFlight  bool
+	IsPeakHour     bool
+	IsHoliday      bool
+	IsHazardous    bool
+	Latitude       float64 // 作业地点，用于查询动态溢价倍率
+	Longitude      float64
+	City           string
+}
+
+// PricingItem 报价明细项
+type PricingItem struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Amount int64  `json:"amount"`
+}
+
+// PricingResult 定价结果，下单时整体快照到订单，结算按快照记录费用明细
+type PricingResult struct {
+	Source            string        `json:"source"`
+	SupplyID          int64         `json:"supply_id,omitempty"`
+	PricingUnit       string        `json:"pricing_unit,omitempty"`
+	BaseFee           int64         `json:"base_fee"`
+	MileageFee        int64         `json:"mileage_fee"`
+	DurationFee       int64         `json:"duration_fee"`
+	WeightFee         int64         `json:"weight_fee"`
+	DifficultyFee     int64         `json:"difficulty_fee"`
+	InsuranceFee      int64         `json:"insurance_fee"`
+	SubTotal          int64         `json:"sub_total"`
+	SurgePricing      int64         `json:"surge_pricing"`
+	SurgeMultiplier   float64       `json:"surge_multiplier"`      // 供需动态倍率，1 表示无溢价
+	SurgeScope        string        `json:"surge_scope,omitempty"` // 倍率所属区域，如 city:深圳市
+	MinimumAdjustment int64         `json:"minimum_adjustment"`
+	TotalAmount       int64         `json:"total_amount"`
+	DifficultyFactor  float64       `json:"difficulty_factor"`
+	InsuranceRate     float64       `json:"insurance_rate"`
+	FlightDistance    float64       `json:"flight_distance"`
+	CargoWeight       float64       `json:"cargo_weight"`
+	CargoValue        int64         `json:"cargo_value"`
+	IsNightFlight     bool          `json:"is_night_flight"`
+	IsPeakHour        bool          `json:"is_peak_hour"`
+	IsHoliday         bool          `json:"is_holiday"`
+	IsHazardous       bool          `json:"is_hazardous"`
+	Items             []PricingItem `json:"items"`
+	QuotedAt          time.Time     `json:"quoted_at"`
+}
+
+// SupplyPricingRule 供给计价规则(owner_supplies.pricing_rule)
+// 夜间、高峰与节假日加价需机主显式配置才生效，其余未配置的项沿用平台配置
+type SupplyPricingRule struct {
+	MinimumAmount   int64              `json:"minimum_amount"`   // 起步价(分)
+	NightFactor     float64            `json:"night_factor"`     // 夜间作业系数，未配置时夜间不加价
+	HazardousFactor float64            `json:"hazardous_factor"` // 危险品系数
+	PeakRate        float64            `json:"peak_rate"`        // 高峰时段倍率，未配置时高峰不加价
+	HolidayRate     float64            `json:"holiday_rate"`     // 节假日倍率，未配置时节假日不加价
+	SceneFactors    map[string]float64 `json:"scene_factors"`    // 按作业场景的难度系数
+}
+
+// Quote 按作业描述计算分项报价，supply 为空时按平台阶梯价计价
+func (e *PricingEngine) Quote(input PricingInput, supply *model.OwnerSupply) (*PricingResult, error) {
+	if input.FlightDistance < 0 || input.CargoWeight < 0 || input.FlightDuration < 0 || input.CargoValue < 0 {
+		return nil, errors.New("定价参数不能为负数")
+	}
+	trips := float64(input.TripCount)
+	if trips <= 0 {
+		trips = 1
+	}
+
+	result := &PricingResult{
+		Source:         PricingSourcePlatform,
+		FlightDistance: input.FlightDistance,
+		CargoWeight:    input.CargoWeight,
+		CargoValue:     input.CargoValue,
+		IsNightFlight:  input.IsNightFlight || isNightPricingTime(input.ScheduledAt),
+		IsPeakHour:     input.IsPeakHour || isPeakPricingTime(input.ScheduledAt),
+		IsHoliday:      input.IsHoliday,
+		IsHazardous:    input.IsHazardous || input.CargoType == "hazardous",
+		QuotedAt:       time.Now(),
+	}
+
+	// 1. 基础计费：供给挂牌价或平台阶梯价
+	rule := parseSupplyPricingRule(supply)
+	if supply != nil {
+		if err := e.applySupplyBaseFee(result, supply, input, trips); err != nil {
+			return nil, err
+		}
+		result.IsNightFlight = result.IsNightFlight && rule.NightFactor > 0
+		result.IsPeakHour = result.IsPeakHour && rule.PeakRate > 0
+		result.IsHoliday = result.IsHoliday && rule.HolidayRate > 0
+	} else {
+		result.BaseFee = int64(math.Round(e.config("base_fee_default", 8000) * trips))
+		result.MileageFee = int64(math.Round(float64(e.mileageFee(input.FlightDistance)) * trips))
+		result.DurationFee = e.durationFee(input.FlightDuration)
+		result.WeightFee = int64(math.Round(float64(e.weightFee(input.CargoWeight)) * trips))
+	}
+	baseCost := result.BaseFee + result.MileageFee + result.DurationFee + result.WeightFee
+
+	// 2. 难度系数：场景、夜间与危险品取最高
+	result.DifficultyFactor = e.difficultyFactor(input, rule, result.IsNightFlight, result.IsHazardous)
+	if result.DifficultyFactor > 1.0 {
+		result.DifficultyFee = int64(math.Round(float64(baseCost) * (result.DifficultyFactor - 1.0)))
+	}
+
+	// 3. 保险费
+	cargoType := input.CargoType
+	if result.IsHazardous {
+		cargoType = "hazardous"
+	}
+	result.InsuranceRate = e.insuranceRate(cargoType)
+	if input.CargoValue > 0 {
+		result.InsuranceFee = int64(math.Round(float64(input.CargoValue) * result.InsuranceRate))
+	}
+	result.SubTotal = baseCost + result.DifficultyFee + result.InsuranceFee
+
+	// 4. 高峰/节假日溢价叠加供需动态倍率
+	surge := e.surgeService.Lookup(input.Latitude, input.Longitude, input.City, result.QuotedAt)
+	result.SurgeMultiplier = surge.Multiplier
+	if surge.ScopeType != "" {
+		result.SurgeScope = surge.ScopeType + ":" + surge.ScopeKey
+	}
+	result.SurgePricing = e.surgePricing(result.SubTotal, result.IsPeakHour, result.IsHoliday, rule, surge.Multiplier)
+	result.TotalAmount = result.SubTotal + result.SurgePricing
+	if result.TotalAmount < 0 {
+		result.TotalAmount = result.SubTotal // 防止折扣导致负数
+	}
+
+	// 5. 供给起步价
+	if rule.MinimumAmount > result.TotalAmount {
+		result.MinimumAdjustment = rule.MinimumAmount - result.TotalAmount
+		result.TotalAmount = rule.MinimumAmount
+	}
+	if result.TotalAmount <= 0 {
+		return nil, errors.New("报价金额无效")
+	}
+	result.Items = buildPricingItems(result)
+	return result, nil
+}
+
+// QuoteForSupply 价格试算，supplyID 大于0时按该供给的挂牌价与计价规则报价
+func (e *PricingEngine) QuoteForSupply(input PricingInput, supplyID int64) (*PricingResult, error) {
+	if supplyID <= 0 {
+		return e.Quote(input, nil)
+	}
+	if e.ownerDomainRepo == nil {
+		return nil, errors.New("供给仓储未初始化")
+	}
+	supply, err := e.ownerDomainRepo.GetSupplyByID(supplyID)
+	if err != nil {
+		return nil, errors.New("供给不存在")
+	}
+	if supply.Status != "active" {
+		return nil, errors.New("当前供给不可下单")
+	}
+	return e.Quote(input, supply)
+}
+
+// QuoteDirectOrder 直达下单报价：由下单参数得到作业描述后按供给计价
+func (e *PricingEngine) QuoteDirectOrder(supply *model.OwnerSupply, input *DirectOrderInput) (*PricingResult, error) {
+	if supply == nil {
+		return nil, errors.New("供给不存在")
+	}
+	if input == nil {
+		input = &DirectOrderInput{}
+	}
+	pricingInput := PricingInput{
+		TaskType:    firstNonEmpty(input.ServiceType, defaultDemandServiceType),
+		CargoScene:  input.CargoScene,
+		CargoWeight: derefFloat64(input.CargoWeightKG),
+		ScheduledAt: input.ScheduledStartAt,
+	}
+	if input.CargoType != nil {
+		pricingInput.CargoType = *input.CargoType
+	}
+	if input.EstimatedTripCount != nil {
+		pricingInput.TripCount = *input.EstimatedTripCount
+	}
+	if input.DepartureAddress != nil && input.DestinationAddress != nil &&
+		input.DepartureAddress.Latitude != nil && input.DepartureAddress.Longitude != nil &&
+		input.DestinationAddress.Latitude != nil && input.DestinationAddress.Longitude != nil {
+		pricingInput.FlightDistance = haversineKM(*input.DepartureAddress.Latitude, *input.DepartureAddress.Longitude, *input.DestinationAddress.Latitude, *input.DestinationAddress.Longitude)
+	}
+	for _, address := range []*AddressSnapshotInput{input.ServiceAddress, input.DepartureAddress} {
+		if address == nil {
+			continue
+		}
+		pricingInput.City = address.City
+		if address.Latitude != nil && address.Longitude != nil {
+			pricingInput.Latitude, pricingInput.Longitude = *address.Latitude, *address.Longitude
+		}
+		break
+	}
+	if supply.PricingUnit == "per_hour" {
+		if input.ScheduledStartAt == nil || input.ScheduledEndAt == nil {
+			return nil, errors.New("按时长计价时必须填写计划开始和结束时间")
+		}
+		pricingInput.ServiceHours = input.ScheduledEndAt.Sub(*input.ScheduledStartAt).Hours()
+		if pricingInput.ServiceHours <= 0 {
+			return nil, errors.New("按时长计价时计划结束时间必须晚于开始时间")
+		}
+	}
+	return e.Quote(pricingInput, supply)
+}
+
+// applySupplyBaseFee 按供给计价单位计算基础费用，并计入对应的分项
+func (e *PricingEngine) applySupplyBaseFee(result *PricingResult, supply *model.OwnerSupply, input PricingInput, trips float64) error {
+	if supply.BasePriceAmount <= 0 {
+		return errors.New("供给挂牌价无效")
+	}
+	price := float64(supply.BasePriceAmount)
+	result.Source = PricingSourceSupply
+	result.SupplyID = supply.ID
+	result.PricingUnit = firstNonEmpty(supply.PricingUnit, "per_trip")
+
+	switch supply.PricingUnit {
+	case "", "per_trip":
+		result.BaseFee = int64(math.Round(price * trips))
+	case "per_kg":
+		if input.CargoWeight <= 0 {
+			return errors.New("按重量计价时必须填写货物重量")
+		}
+		result.WeightFee = int64(math.Round(price * input.CargoWeight * trips))
+	case "per_hour":
+		if input.ServiceHours <= 0 {
+			return errors.New("按时长计价时必须填写计划作业时长")
+		}
+		result.DurationFee = int64(math.Round(price * input.ServiceHours * trips))
+	case "per_km":
+		if input.FlightDistance <= 0 {
+			return errors.New("按里程计价时必须填写带坐标的起运和送达地址")
+		}
+		result.MileageFee = int64(math.Round(price * input.FlightDistance * trips))
+	default:
+		return errors.New("暂不支持该供给的计价方式")
+	}
+	return nil
+}
+
+func parseSupplyPricingRule(supply *model.OwnerSupply) SupplyPricingRule {
+	var rule SupplyPricingRule
+	if supply != nil && len(supply.PricingRule) > 0 {
+		_ = json.Unmarshal(supply.PricingRule, &rule)
+	}
+	return rule
+}
+
+// isNightPricingTime 22:00-06:00 按夜间作业计价
+func isNightPricingTime(at *time.Time) bool {
+	if at == nil {
+		return false
+	}
+	hour := at.Hour()
+	return hour >= 22 || hour < 6
+}
+
+// isPeakPricingTime 工作日 07:00-09:00、17:00-19:00 为高峰时段
+func isPeakPricingTime(at *time.Time) bool {
+	if at == nil || at.Weekday() == time.Saturday || at.Weekday() == time.Sunday {
+		return false
+	}
+	hour := at.Hour()
+	return (hour >= 7 && hour < 9) || (hour >= 17 && hour < 19)
+}
+
+func buildPricingItems(result *PricingResult) []PricingItem {
+	candidates := []PricingItem{
+		{Code: "base_fee", Name: "基础服务费", Amount: result.BaseFee},
+		{Code: "mileage_fee", Name: "里程费", Amount: result.MileageFee},
+		{Code: "duration_fee", Name: "时长费", Amount: result.DurationFee},
+		{Code: "weight_fee", Name: "重量费", Amount: result.WeightFee},
+		{Code: "difficulty_fee", Name: "难度附加费", Amount: result.DifficultyFee},
+		{Code: "insurance_fee", Name: "保险费", Amount: result.InsuranceFee},
+		{Code: "surge_pricing", Name: "时段与供需溢价", Amount: result.SurgePricing},
+		{Code: "minimum_adjustment", Name: "起步价补足", Amount: result.MinimumAdjustment},
+	}
+	items := make([]PricingItem, 0, len(candidates))
+	for _, item := range candidates {
+		if item.Amount != 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// negotiatedPricing 需求报价成交的订单没有引擎报价，按成交价记录快照
+func negotiatedPricing(amount int64) *PricingResult {
+	return &PricingResult{
+		Source:           PricingSourceDemandQuote,
+		BaseFee:          amount,
+		SubTotal:         amount,
+		TotalAmount:      amount,
+		DifficultyFactor: 1.0,
+		SurgeMultiplier:  1.0,
+		Items:            []PricingItem{{Code: "quoted_price", Name: "报价金额", Amount: amount}},
+		QuotedAt:         time.Now(),
+	}
+}
+
+// pricingSnapshot 序列化报价，写入订单 pricing_snapshot
+func pricingSnapshot(result *PricingResult) model.JSON {
+	if result == nil {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil
+	}
+	return model.JSON(data)
+}
+
+// parsePricingSnapshot 读取订单报价快照，无快照时返回 nil
+func parsePricingSnapshot(raw model.JSON) *PricingResult {
+	if len(raw) == 0 {
+		return nil
+	}
+	var result PricingResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil
+	}
+	return &result
+}
+
+// ========== 平台计价规则 ==========
+
+func (e *PricingEngine) config(key string, defaultVal float64) float64 {
+	if e == nil || e.settlementRepo == nil {
+		return defaultVal
+	}
+	val, err := e.settlementRepo.GetPricingConfig(key)
+	if err != nil || val == 0 {
+		return defaultVal
+	}
+	return val
+}
+
+func (e *PricingEngine) mileageFee(distanceKm float64) int64 {
+	if distanceKm <= 0 {
+		return 0
+	}
+	rate0_5 := e.config("mileage_rate_0_5", 1500)
+	rate5_15 := e.config("mileage_rate_5_15", 1000)
+	rate15_50 := e.config("mileage_rate_15_50", 800)
+	rate50plus := e.config("mileage_rate_50_plus", 500)
+
+	var fee float64
+	if distanceKm <= 5 {
+		fee = distanceKm * rate0_5
+	} else if distanceKm <= 15 {
+		fee = 5*rate0_5 + (distanceKm-5)*rate5_15
+	} else if distanceKm <= 50 {
+		fee = 5*rate0_5 + 10*rate5_15 + (distanceKm-15)*rate15_50
+	} else {
+		fee = 5*rate0_5 + 10*rate5_15 + 35*rate15_50 + (distanceKm-50)*rate50plus
+	}
+	return int64(math.Round(fee))
+}
+
+func (e *PricingEngine) durationFee(durationMin float64) int64 {
+	freeMin := e.config("duration_free_minutes", 10)
+	rate := e.config("duration_rate", 300)
+
+	billableMin := durationMin - freeMin
+	if billableMin <= 0 {
+		return 0
+	}
+	return int64(math.Round(billableMin * rate))
+}
+
+func (e *PricingEngine) weightFee(weightKg float64) int64 {
+	if weightKg <= 0 {
+		return 0
+	}
+	rate0_5 := e.config("weight_rate_0_5", 1000)
+	rate5_20 := e.config("weight_rate_5_20", 3000)
+	rate20plus := e.config("weight_rate_20_plus", 5000)
+
+	var fee float64
+	unitWeight := weightKg / 10.0 // 每10kg为计费单位
+	if weightKg <= 5 {
+		fee = unitWeight * rate0_5
+	} else if weightKg <= 20 {
+		fee = 0.5*rate0_5 + (unitWeight-0.5)*rate5_20
+	} else {
+		fee = 0.5*rate0_5 + 1.5*rate5_20 + (unitWeight-2.0)*rate20plus
+	}
+	return int64(math.Round(fee))
+}
+
+// difficultyFactor 场景、夜间与危险品系数取最高值，供给规则中配置的系数优先
+func (e *PricingEngine) difficultyFactor(input PricingInput, rule SupplyPricingRule, isNight, isHazardous bool) float64 {
+	factor := 1.0
+	if f, ok := rule.SceneFactors[input.CargoScene]; ok && f > 0 {
+		factor = f
+	} else {
+		switch input.TaskType {
+		case "emergency":
+			factor = e.config("difficulty_emergency", 1.8)
+		case "inspection":
+			factor = e.config("difficulty_complex", 1.3)
+		}
+	}
+	if isNight {
+		night := rule.NightFactor
+		if night <= 0 {
+			night = e.config("difficulty_night", 2.0)
+		}
+		factor = math.Max(factor, night)
+	}
+	if isHazardous {
+		hazardous := rule.HazardousFactor
+		if hazardous <= 0 {
+			hazardous = e.config("difficulty_hazardous", 1.5)
+		}
+		factor = math.Max(factor, hazardous)
+	}
+	return factor
+}
+
+func (e *PricingEngine) insuranceRate(cargoType string) float64 {
+	switch cargoType {
+	case "hazardous":
+		return e.config("insurance_rate_hazardous", 0.03)
+	case "fragile":
+		return e.config("insurance_rate_fragile", 0.02)
+	default:
+		return e.config("insurance_rate_normal", 0.01)
+	}
+}
+
+func (e *PricingEngine) surgePricing(subtotal int64, isPeak, isHoliday bool, rule SupplyPricingRule, multiplier float64) int64 {
+	rate := 1.0
+	if isHoliday {
+		rate = rule.HolidayRate
+		if rate <= 0 {
+			rate = e.config("surge_holiday_rate", 1.5)
+		}
+	} else if isPeak {
+		rate = rule.PeakRate
+		if rate <= 0 {
+			rate = e.config("surge_peak_rate", 1.3)
+		}
+	}
+	// 空闲折扣 - 暂时不主动触发
+	if multiplier > 0 {
+		rate *= multiplier
+	}
+	return int64(math.Round(float64(subtotal) * (rate - 1.0)))
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestPricingEngineSharesFactorsBetweenPlatformAndSupply(t *testing.T) {
+	db := newServiceTestDB(t, &model.PricingConfig{}, &model.OwnerSupply{})
+	if err := db.Create(&model.PricingConfig{ConfigKey: "base_fee_default", ConfigValue: 10000, Category: "base", IsActive: true}).Error; err != nil {
+		t.Fatalf("seed pricing config: %v", err)
+	}
+	supply := &model.OwnerSupply{
+		SupplyNo: "SUP_PRICE_1", OwnerUserID: 21, DroneID: 1, Title: "重载吊运", BasePriceAmount: 20000, PricingUnit: "per_trip",
+		PricingRule: model.JSON(`{"night_factor":1.2,"minimum_amount":30000}`), Status: "active",
+	}
+	if err := db.Create(supply).Error; err != nil {
+		t.Fatalf("create supply: %v", err)
+	}
+	engine := NewPricingEngine(repository.NewSettlementRepo(db), repository.NewOwnerDomainRepo(db))
+	night := time.Date(2026, 3, 17, 23, 0, 0, 0, time.Local)
+	input := PricingInput{FlightDistance: 10, TaskType: "cargo_delivery", ScheduledAt: &night}
+
+	// 平台阶梯价：基础费100元 + 里程费(5km×15元 + 5km×10元)，夜间系数2.0
+	platform, err := engine.QuoteForSupply(input, 0)
+	if err != nil {
+		t.Fatalf("platform quote: %v", err)
+	}
+	if !platform.IsNightFlight || platform.BaseFee != 10000 || platform.MileageFee != 12500 || platform.DifficultyFee != 22500 || platform.TotalAmount != 45000 {
+		t.Fatalf("unexpected platform quote: %+v", platform)
+	}
+	if len(platform.Items) != 3 || platform.Items[2].Code != "difficulty_fee" {
+		t.Fatalf("expected itemized base, mileage and difficulty fees, got %+v", platform.Items)
+	}
+
+	// 供给挂牌价替代平台基础计费，规则覆盖夜间系数并补足起步价
+	quote, err := engine.QuoteForSupply(input, supply.ID)
+	if err != nil {
+		t.Fatalf("supply quote: %v", err)
+	}
+	if quote.Source != PricingSourceSupply || quote.BaseFee != 20000 || quote.MileageFee != 0 || quote.DifficultyFee != 4000 {
+		t.Fatalf("unexpected supply quote: %+v", quote)
+	}
+	if quote.MinimumAdjustment != 6000 || quote.TotalAmount != 30000 {
+		t.Fatalf("expected minimum amount 30000, got %d (+%d)", quote.TotalAmount, quote.MinimumAdjustment)
+	}
+
+	// 未在计价规则中配置夜间/高峰/节假日加价的供给不套用平台系数
+	plain := &model.OwnerSupply{
+		SupplyNo: "SUP_PRICE_2", OwnerUserID: 21, DroneID: 2, Title: "普通吊运", BasePriceAmount: 20000, PricingUnit: "per_trip", Status: "active",
+	}
+	if err := db.Create(plain).Error; err != nil {
+		t.Fatalf("create supply: %v", err)
+	}
+	peak := time.Date(2026, 3, 17, 8, 0, 0, 0, time.Local)
+	for _, at := range []*time.Time{&night, &peak} {
+		quote, err := engine.QuoteForSupply(PricingInput{FlightDistance: 10, TaskType: "cargo_delivery", ScheduledAt: at, IsHoliday: true}, plain.ID)
+		if err != nil {
+			t.Fatalf("plain supply quote: %v", err)
+		}
+		if quote.IsNightFlight || quote.IsPeakHour || quote.IsHoliday || quote.DifficultyFee != 0 || quote.SurgePricing != 0 || quote.TotalAmount != 20000 {
+			t.Fatalf("expected listed price without platform surcharges at %v, got %+v", at, quote)
+		}
+	}
+
+	// 危险品按平台危险品系数与保险费率计价
+	day := time.Date(2026, 3, 17, 14, 0, 0, 0, time.Local)
+	hazardous, err := engine.Quote(PricingInput{FlightDistance: 2, CargoValue: 100000, ScheduledAt: &day, IsHazardous: true}, nil)
+	if err != nil {
+		t.Fatalf("hazardous quote: %v", err)
+	}
+	if hazardous.DifficultyFactor != 1.5 || hazardous.InsuranceFee != 3000 || hazardous.TotalAmount != 22500 {
+		t.Fatalf("unexpected hazardous quote: %+v", hazardous)
+	}
+}
+
+func TestSettlementRecordsOrderPricingSnapshot(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{},
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.PricingConfig{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	service.SetFlightRepo(repository.NewFlightRepo(db))
+	completedAt := time.Now().Add(-96 * time.Hour)
+	order := &model.Order{OrderNo: "ORD_PRICE_001", OrderType: "cargo", OwnerID: 21, RenterID: 31, ExecutorPilotUserID: 11, TotalAmount: 45000, Status: "completed", CompletedAt: &completedAt}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	night := time.Date(2026, 3, 17, 23, 0, 0, 0, time.Local)
+	quote, err := NewPricingEngine(nil, nil).Quote(PricingInput{FlightDistance: 10, CargoWeight: 3, ScheduledAt: &night}, nil)
+	if err != nil {
+		t.Fatalf("quote: %v", err)
+	}
+	if err := db.Model(&model.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
+		"total_amount": quote.TotalAmount, "pricing_snapshot": pricingSnapshot(quote),
+	}).Error; err != nil {
+		t.Fatalf("snapshot pricing: %v", err)
+	}
+
+	if _, err := service.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	settlement, err := service.GetSettlementByOrder(order.ID)
+	if err != nil {
+		t.Fatalf("get settlement: %v", err)
+	}
+	if settlement.FinalAmount != quote.TotalAmount || settlement.BaseFee != quote.BaseFee || settlement.MileageFee != quote.MileageFee ||
+		settlement.WeightFee != quote.WeightFee || settlement.DifficultyFee != quote.DifficultyFee || settlement.DifficultyFactor != 2.0 {
+		t.Fatalf("settlement does not match pricing snapshot: %+v vs %+v", settlement, quote)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"wurenji-backend/internal/repository"
+	ws "wurenji-backend/internal/websocket"
+)
+
+// RealtimeAuthorizer WebSocket 主题订阅鉴权
+// order/flight 主题按订单可见性校验，dispatch:pilot 仅限飞手本人，admin:alerts 仅限管理员
+type RealtimeAuthorizer struct {
+	orderService *OrderService
+	flightRepo   *repository.FlightRepo
+}
+
+func NewRealtimeAuthorizer(orderService *OrderService, flightRepo *repository.FlightRepo) *RealtimeAuthorizer {
+	return &RealtimeAuthorizer{orderService: orderService, flightRepo: flightRepo}
+}
+
+func (a *RealtimeAuthorizer) AuthorizeTopic(userID int64, userType string, topic ws.Topic) error {
+	if userType == "admin" {
+		return nil
+	}
+
+	switch topic.Kind {
+	case ws.TopicOrder:
+		return a.authorizeOrder(topic.ID, userID)
+	case ws.TopicFlight:
+		record, err := a.flightRepo.GetFlightRecordByID(topic.ID)
+		if err != nil {
+			return errors.New("飞行记录不存在")
+		}
+		return a.authorizeOrder(record.OrderID, userID)
+	case ws.TopicDispatchPilot:
+		if topic.ID != userID {
+			return errors.New("无权订阅其他飞手的派单")
+		}
+		return nil
+	case ws.TopicAdminAlerts:
+		return errors.New("仅管理员可订阅告警主题")
+	}
+	return ws.ErrInvalidTopic
+}
+
+func (a *RealtimeAuthorizer) authorizeOrder(orderID, userID int64) error {
+	order, err := a.orderService.GetOrder(orderID)
+	if err != nil {
+		return errors.New("订单不存在")
+	}
+	if !a.orderService.CanAccessOrder(order, userID, "") {
+		return errors.New("无权查看该订单")
+	}
+	return nil
+}
+
+// realtimeAckFlightAlert ack 帧中确认告警的 ref 前缀，如 flight_alert:7
+const realtimeAckFlightAlert = "flight_alert:"
+
+// RealtimeAckHandler WebSocket 客户端 ack 处理
+// admin:alerts 与 flight:<id> 主题上携带 ref=flight_alert:<告警ID> 的 ack 视为确认告警并停止升级通知，其余 ack 仅确认送达
+type RealtimeAckHandler struct {
+	authorizer    *RealtimeAuthorizer
+	flightService *FlightService
+	flightRepo    *repository.FlightRepo
+}
+
+func NewRealtimeAckHandler(authorizer *RealtimeAuthorizer, flightService *FlightService, flightRepo *repository.FlightRepo) *RealtimeAckHandler {
+	return &RealtimeAckHandler{authorizer: authorizer, flightService: flightService, flightRepo: flightRepo}
+}
+
+func (h *RealtimeAckHandler) HandleAck(ack ws.Ack) error {
+	if !strings.HasPrefix(ack.Ref, realtimeAckFlightAlert) {
+		return nil
+	}
+	topic, err := ws.ParseTopic(ack.Topic)
+	if err != nil {
+		return err
+	}
+	if topic.Kind != ws.TopicAdminAlerts && topic.Kind != ws.TopicFlight {
+		return nil
+	}
+	alertID, err := strconv.ParseInt(strings.TrimPrefix(ack.Ref, realtimeAckFlightAlert), 10, 64)
+	if err != nil || alertID <= 0 {
+		return errors.New("无效的告警ID")
+	}
+	if err := h.authorizer.AuthorizeTopic(ack.UserID, ack.UserType, topic); err != nil {
+		return err
+	}
+
+	alert, err := h.flightRepo.GetAlertByID(alertID)
+	if err != nil {
+		return errors.New("告警不存在")
+	}
+	if topic.Kind == ws.TopicFlight && (alert.FlightRecordID == nil || *alert.FlightRecordID != topic.ID) {
+		return errors.New("告警不属于该飞行")
+	}
+	if alert.Status != "active" {
+		return nil
+	}
+	return h.flightService.AcknowledgeAlert(alert.ID, ack.UserID)
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+	ws "wurenji-backend/internal/websocket"
+)
+
+type recordedPublish struct {
+	topic   string
+	msgType string
+}
+
+type recordingPublisher struct {
+	published []recordedPublish
+}
+
+func (p *recordingPublisher) Publish(topic, msgType string, data interface{}) {
+	p.published = append(p.published, recordedPublish{topic: topic, msgType: msgType})
+}
+
+func TestRealtimeAuthorizerChecksOrderAccess(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.FlightRecord{})
+
+	start := time.Now()
+	order := &model.Order{
+		OrderNo: "WRJ-WS-001", ClientUserID: 11, ProviderUserID: 31, Title: "实时订阅",
+		ServiceType: "cargo", StartTime: start, EndTime: start.Add(time.Hour), Status: "in_transit",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	record := &model.FlightRecord{FlightNo: "WRJ-WS-001-F1", OrderID: order.ID, PilotUserID: 66, Status: "in_progress"}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create flight record: %v", err)
+	}
+
+	orderRepo := repository.NewOrderRepo(db)
+	orderService := NewOrderService(orderRepo, nil, nil, nil, nil, nil, nil, nil, nil, nil, zap.NewNop())
+	authorizer := NewRealtimeAuthorizer(orderService, repository.NewFlightRepo(db))
+
+	cases := []struct {
+		name     string
+		userID   int64
+		userType string
+		topic    ws.Topic
+		allowed  bool
+	}{
+		{"client order", 11, "client", ws.Topic{Kind: ws.TopicOrder, ID: order.ID}, true},
+		{"provider flight", 31, "client", ws.Topic{Kind: ws.TopicFlight, ID: record.ID}, true},
+		{"stranger order", 99, "client", ws.Topic{Kind: ws.TopicOrder, ID: order.ID}, false},
+		{"stranger flight", 99, "client", ws.Topic{Kind: ws.TopicFlight, ID: record.ID}, false},
+		{"missing order", 11, "client", ws.Topic{Kind: ws.TopicOrder, ID: 404}, false},
+		{"own dispatch", 66, "client", ws.Topic{Kind: ws.TopicDispatchPilot, ID: 66}, true},
+		{"other dispatch", 67, "client", ws.Topic{Kind: ws.TopicDispatchPilot, ID: 66}, false},
+		{"alerts for client", 11, "client", ws.Topic{Kind: ws.TopicAdminAlerts}, false},
+		{"alerts for admin", 1, "admin", ws.Topic{Kind: ws.TopicAdminAlerts}, true},
+		{"admin any order", 1, "admin", ws.Topic{Kind: ws.TopicOrder, ID: order.ID}, true},
+	}
+	for _, tc := range cases {
+		err := authorizer.AuthorizeTopic(tc.userID, tc.userType, tc.topic)
+		if (err == nil) != tc.allowed {
+			t.Errorf("%s: allowed=%v, err=%v", tc.name, tc.allowed, err)
+		}
+	}
+}
+
+func TestPublishPositionFansOutToTopics(t *testing.T) {
+	publisher := &recordingPublisher{}
+	service := &FlightService{realtime: publisher}
+
+	recordID := int64(5)
+	service.publishPosition(
+		&model.FlightPosition{OrderID: 8, FlightRecordID: &recordID},
+		[]model.FlightAlert{{OrderID: 8, AlertCode: "BATT_WARN"}},
+	)
+
+	want := []recordedPublish{
+		{"order:8", "flight_position"},
+		{"flight:5", "flight_position"},
+		{"order:8", "flight_alert"},
+		{"flight:5", "flight_alert"},
+		{"admin:alerts", "flight_alert"},
+	}
+	if len(publisher.published) != len(want) {
+		t.Fatalf("expected %d publishes, got %#v", len(want), publisher.published)
+	}
+	for i := range want {
+		if publisher.published[i] != want[i] {
+			t.Fatalf("publish %d: expected %#v, got %#v", i, want[i], publisher.published[i])
+		}
+	}
+}
+
+func TestRealtimeAckAcknowledgesFlightAlert(t *testing.T) {
+	db := newServiceTestDB(t, &model.Order{}, &model.FlightRecord{}, &model.FlightAlert{})
+
+	start := time.Now()
+	order := &model.Order{
+		OrderNo: "WRJ-WS-002", ClientUserID: 11, ProviderUserID: 31, Title: "告警确认",
+		ServiceType: "cargo", StartTime: start, EndTime: start.Add(time.Hour), Status: "in_transit",
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	record := &model.FlightRecord{FlightNo: "WRJ-WS-002-F1", OrderID: order.ID, PilotUserID: 66, Status: "in_progress"}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create flight record: %v", err)
+	}
+	next := start.Add(5 * time.Minute)
+	alerts := []model.FlightAlert{
+		{OrderID: order.ID, FlightRecordID: &record.ID, AlertType: "battery", AlertLevel: "critical", AlertCode: "BATT_CRIT", Status: "active", NextEscalationAt: &next},
+		{OrderID: order.ID, FlightRecordID: &record.ID, AlertType: "geofence", AlertLevel: "critical", AlertCode: "FENCE", Status: "active", NextEscalationAt: &next},
+	}
+	if err := db.Create(&alerts).Error; err != nil {
+		t.Fatalf("create alerts: %v", err)
+	}
+
+	orderRepo := repository.NewOrderRepo(db)
+	flightRepo := repository.NewFlightRepo(db)
+	orderService := NewOrderService(orderRepo, nil, nil, nil, nil, nil, nil, nil, nil, nil, zap.NewNop())
+	handler := NewRealtimeAckHandler(NewRealtimeAuthorizer(orderService, flightRepo), NewFlightService(flightRepo, orderRepo, nil, zap.NewNop()), flightRepo)
+
+	flightTopic := ws.FlightTopic(record.ID)
+	alertRef := "flight_alert:" + strconv.FormatInt(alerts[0].ID, 10)
+	// 仅确认送达的 ack 不改变告警
+	if err := handler.HandleAck(ws.Ack{UserID: 31, Topic: flightTopic, MessageID: "1"}); err != nil {
+		t.Fatalf("delivery ack: %v", err)
+	}
+	if err := handler.HandleAck(ws.Ack{UserID: 99, UserType: "client", Topic: flightTopic, MessageID: "2", Ref: alertRef}); err == nil {
+		t.Fatal("expected stranger ack rejected")
+	}
+	if err := handler.HandleAck(ws.Ack{UserID: 31, UserType: "client", Topic: ws.FlightTopic(404), MessageID: "3", Ref: alertRef}); err == nil {
+		t.Fatal("expected ack on another flight topic rejected")
+	}
+	if err := handler.HandleAck(ws.Ack{UserID: 11, UserType: "client", Topic: ws.AdminAlertsTopic, MessageID: "4", Ref: alertRef}); err == nil {
+		t.Fatal("expected client ack on admin alerts rejected")
+	}
+	if stored, _ := flightRepo.GetAlertByID(alerts[0].ID); stored.Status != "active" || stored.NextEscalationAt == nil {
+		t.Fatalf("expected alert untouched by rejected acks, got %+v", stored)
+	}
+
+	if err := handler.HandleAck(ws.Ack{UserID: 31, UserType: "client", Topic: flightTopic, MessageID: "5", Ref: alertRef}); err != nil {
+		t.Fatalf("provider ack: %v", err)
+	}
+	if err := handler.HandleAck(ws.Ack{UserID: 1, UserType: "admin", Topic: ws.AdminAlertsTopic, MessageID: "6",
+		Ref: "flight_alert:" + strconv.FormatInt(alerts[1].ID, 10)}); err != nil {
+		t.Fatalf("admin ack: %v", err)
+	}
+	for i, acker := range []int64{31, 1} {
+		stored, _ := flightRepo.GetAlertByID(alerts[i].ID)
+		if stored.Status != "acknowledged" || stored.AcknowledgedBy != acker || stored.NextEscalationAt != nil {
+			t.Fatalf("expected alert %d acknowledged by %d with escalation stopped, got %+v", stored.ID, acker, stored)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+// 取消退款政策: 政策按服务类型与订单来源生效并分版本管理，订单创建时记录当时生效的版本；
+// 取消时按取消方、距开始时间、是否已派单匹配规则，得出退款、服务方补偿与违约金
+
+// RefundQuote 取消退款测算结果
+type RefundQuote struct {
+	PolicyID            int64   `json:"policy_id"` // 0 表示内置默认政策
+	PolicyVersion       int     `json:"policy_version"`
+	PolicyName          string  `json:"policy_name"`
+	RuleName            string  `json:"rule_name"`
+	CancelBy            string  `json:"cancel_by"`
+	HoursBeforeStart    float64 `json:"hours_before_start"`
+	Dispatched          bool    `json:"dispatched"`
+	PaidAmount          int64   `json:"paid_amount"`          // 已支付金额(订单金额+押金)
+	OrderRefund         int64   `json:"order_refund"`         // 退还订单金额
+	DepositRefund       int64   `json:"deposit_refund"`       // 退还押金
+	RefundAmount        int64   `json:"refund_amount"`        // 退款合计
+	CompensationAmount  int64   `json:"compensation_amount"`  // 补偿服务方金额
+	CompensationUserID  int64   `json:"compensation_user_id"` // 补偿对象
+	CompensationAccount string  `json:"compensation_account"` // owner, pilot
+	PenaltyAmount       int64   `json:"penalty_amount"`       // 服务方违约金
+	PenaltyUserID       int64   `json:"penalty_user_id"`      // 违约金承担方
+	PenaltyCharged      int64   `json:"penalty_charged"`      // 取消时已从承担方余额扣缴的违约金
+	PlatformRetained    int64   `json:"platform_retained"`    // 平台留存
+	Reason              string  `json:"reason"`
+}
+
+// RefundPolicyInput 新建政策版本
+type RefundPolicyInput struct {
+	PolicyCode  string                   `json:"policy_code" binding:"required"`
+	Name        string                   `json:"name"`
+	ServiceType string                   `json:"service_type"`
+	OrderSource string                   `json:"order_source"`
+	Rules       []model.RefundPolicyRule `json:"rules" binding:"required"`
+	Description string                   `json:"description"`
+}
+
+type RefundPolicyService struct {
+	repo   *repository.RefundPolicyRepo
+	logger *zap.Logger
+}
+
+func NewRefundPolicyService(repo *repository.RefundPolicyRepo, logger *zap.Logger) *RefundPolicyService {
+	return &RefundPolicyService{repo: repo, logger: logger}
+}
+
+// defaultRefundPolicy 内置默认政策，未配置政策的订单及政策上线前的存量订单使用
+func defaultRefundPolicy() *model.RefundPolicy {
+	hours24, zero := 24.0, 0.0
+	dispatched := true
+	rules := []model.RefundPolicyRule{
+		{Name: "admin", CancelBy: []string{"admin"}, RefundRate: 1, RefundDeposit: true, Description: "平台取消，全额退款"},
+		{Name: "after_start", MaxHoursBeforeStart: &zero, Deny: true, Description: "服务已过开始时间，无法取消"},
+		{Name: "provider_early", CancelBy: []string{"owner", "pilot"}, MinHoursBeforeStart: &hours24, RefundRate: 1, RefundDeposit: true, Description: "服务方提前24小时以上取消，全额退款"},
+		{Name: "provider_late", CancelBy: []string{"owner", "pilot"}, RefundRate: 1, RefundDeposit: true, PenaltyRate: 0.1, Description: "服务方临近开始取消，全额退款，服务方承担10%违约金"},
+		{Name: "client_early", MinHoursBeforeStart: &hours24, RefundRate: 1, RefundDeposit: true, Description: "提前24小时以上取消，全额退款"},
+		{Name: "client_late_dispatched", Dispatched: &dispatched, RefundRate: 0.6, RefundDeposit: true, CompensationRate: 0.3, CompensateTo: "executor", Description: "飞手已接单，提前不足24小时取消，退款60%订单金额和全部押金，30%补偿执行飞手"},
+		{Name: "client_late", RefundRate: 0.7, RefundDeposit: true, CompensationRate: 0.2, CompensateTo: "provider", Description: "提前不足24小时取消，退款70%订单金额和全部押金，20%补偿机主"},
+	}
+	data, _ := json.Marshal(rules)
+	return &model.RefundPolicy{PolicyCode: "builtin", Name: "内置默认政策", Status: "active", Rules: model.JSON(data)}
+}
+
+// ResolveForOrder 订单适用的生效政策: 服务类型与订单来源均匹配的优先，其次匹配其一，最后为通用政策
+func (s *RefundPolicyService) ResolveForOrder(order *model.Order) (*model.RefundPolicy, error) {
+	policies, err := s.repo.ListActive()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		best      *model.RefundPolicy
+		bestScore = -1
+	)
+	for i := range policies {
+		policy := &policies[i]
+		if policy.ServiceType != "" && policy.ServiceType != order.ServiceType {
+			continue
+		}
+		if policy.OrderSource != "" && policy.OrderSource != order.OrderSource {
+			continue
+		}
+		score := 0
+		if policy.ServiceType != "" {
+			score += 2
+		}
+		if policy.OrderSource != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = policy, score
+		}
+	}
+	if best == nil {
+		return defaultRefundPolicy(), nil
+	}
+	return best, nil
+}
+
+// PolicyForOrder 订单创建时记录的政策版本，未记录时使用内置默认政策
+func (s *RefundPolicyService) PolicyForOrder(order *model.Order) (*model.RefundPolicy, error) {
+	if s == nil || order.RefundPolicyID <= 0 {
+		return defaultRefundPolicy(), nil
+	}
+	return s.repo.GetByID(order.RefundPolicyID)
+}
+
+// QuoteRefund 按政策测算取消退款；政策不允许取消时返回错误
+func QuoteRefund(policy *model.RefundPolicy, order *model.Order, role string, now time.Time) (*RefundQuote, error) {
+	var rules []model.RefundPolicyRule
+	if err := json.Unmarshal(policy.Rules, &rules); err != nil {
+		return nil, fmt.Errorf("退款政策规则解析失败: %w", err)
+	}
+
+	cancelBy := firstNonEmpty(normalizeOrderRole(role), role)
+	quote := &RefundQuote{
+		PolicyID:         policy.ID,
+		PolicyVersion:    policy.Version,
+		PolicyName:       policy.Name,
+		CancelBy:         cancelBy,
+		HoursBeforeStart: math.Round(order.StartTime.Sub(now).Hours()*10) / 10,
+		Dispatched:       order.DispatchTaskID != nil && order.ExecutorPilotUserID > 0,
+	}
+	// 未支付或已退款的订单不涉及资金，可直接取消
+	if order.PaidAt == nil || order.Status == "refunded" || order.Status == "provider_rejected" {
+		return quote, nil
+	}
+
+	hours := order.StartTime.Sub(now).Hours()
+	rule := matchRefundRule(rules, cancelBy, hours, quote.Dispatched)
+	if rule == nil {
+		return nil, errors.New("退款政策未覆盖该取消场景，请联系平台处理")
+	}
+	if rule.Deny {
+		return nil, errors.New(firstNonEmpty(rule.Description, "当前不允许取消订单"))
+	}
+
+	quote.RuleName = rule.Name
+	quote.Reason = rule.Description
+	// 退款与补偿按扣除优惠券后的实付订单金额计算
+	orderAmount := order.PayableAmount()
+	quote.PaidAmount = orderAmount + order.DepositAmount
+	quote.OrderRefund = rateAmount(orderAmount, rule.RefundRate)
+	if rule.RefundDeposit {
+		quote.DepositRefund = order.DepositAmount
+	}
+	quote.RefundAmount = quote.OrderRefund + quote.DepositRefund
+
+	if rule.CompensationRate > 0 {
+		quote.CompensationAmount = rateAmount(orderAmount, rule.CompensationRate)
+		if remaining := orderAmount - quote.OrderRefund; quote.CompensationAmount > remaining {
+			quote.CompensationAmount = remaining
+		}
+		quote.CompensationUserID, quote.CompensationAccount = refundCompensationTarget(order, rule.CompensateTo)
+		if quote.CompensationUserID <= 0 {
+			quote.CompensationAmount = 0
+		}
+	}
+	if rule.PenaltyRate > 0 {
+		quote.PenaltyAmount = rateAmount(orderAmount, rule.PenaltyRate)
+		if cancelBy == "pilot" && order.ExecutorPilotUserID > 0 {
+			quote.PenaltyUserID = order.ExecutorPilotUserID
+		} else {
+			quote.PenaltyUserID = orderProviderUserID(order)
+		}
+	}
+	quote.PlatformRetained = quote.PaidAmount - quote.RefundAmount - quote.CompensationAmount
+	return quote, nil
+}
+
+func matchRefundRule(rules []model.RefundPolicyRule, cancelBy string, hours float64, dispatched bool) *model.RefundPolicyRule {
+	for i := range rules {
+		rule := &rules[i]
+		if len(rule.CancelBy) > 0 && !containsString(rule.CancelBy, cancelBy) {
+			continue
+		}
+		if rule.Dispatched != nil && *rule.Dispatched != dispatched {
+			continue
+		}
+		if rule.MinHoursBeforeStart != nil && hours < *rule.MinHoursBeforeStart {
+			continue
+		}
+		if rule.MaxHoursBeforeStart != nil && hours >= *rule.MaxHoursBeforeStart {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+// refundCompensationTarget 补偿对象: executor 为执行飞手(与机主为同一人或尚未派单时为机主)
+func refundCompensationTarget(order *model.Order, compensateTo string) (int64, string) {
+	provider := orderProviderUserID(order)
+	if compensateTo == "executor" && order.ExecutorPilotUserID > 0 && order.ExecutorPilotUserID != provider {
+		return order.ExecutorPilotUserID, model.LedgerAccountPilot
+	}
+	return provider, model.LedgerAccountOwner
+}
+
+func rateAmount(amount int64, rate float64) int64 {
+	return int64(math.Round(float64(amount) * rate))
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ========== 政策管理 ==========
+
+// CreatePolicyVersion 新建政策草稿版本，版本号在同一政策编码下递增
+func (s *RefundPolicyService) CreatePolicyVersion(input *RefundPolicyInput, adminID int64) (*model.RefundPolicy, error) {
+	input.PolicyCode = strings.TrimSpace(input.PolicyCode)
+	if input.PolicyCode == "" || input.PolicyCode == "builtin" {
+		return nil, errors.New("政策编码无效")
+	}
+	if err := validateRefundRules(input.Rules); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(input.Rules)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.repo.NextVersion(input.PolicyCode)
+	if err != nil {
+		return nil, err
+	}
+	policy := &model.RefundPolicy{
+		PolicyCode:  input.PolicyCode,
+		Version:     version,
+		Name:        firstNonEmpty(input.Name, input.PolicyCode),
+		ServiceType: input.ServiceType,
+		OrderSource: input.OrderSource,
+		Status:      "draft",
+		Rules:       model.JSON(data),
+		Description: input.Description,
+		CreatedBy:   adminID,
+	}
+	if err := s.repo.Create(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ActivatePolicy 启用政策版本，同编码的旧版本停用；已下单的订单仍按下单时的版本执行
+func (s *RefundPolicyService) ActivatePolicy(id int64) (*model.RefundPolicy, error) {
+	policy, err := s.repo.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("退款政策不存在")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if policy.Status != "draft" {
+		return nil, fmt.Errorf("只能启用草稿版本，当前状态 %s", policy.Status)
+	}
+	if err := s.repo.Activate(policy); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Refund policy activated",
+		zap.String("policy_code", policy.PolicyCode),
+		zap.Int("version", policy.Version),
+	)
+	return policy, nil
+}
+
+func (s *RefundPolicyService) ListPolicies(policyCode, status string, page, pageSize int) ([]model.RefundPolicy, int64, error) {
+	return s.repo.List(policyCode, status, page, pageSize)
+}
+
+func validateRefundRules(rules []model.RefundPolicyRule) error {
+	if len(rules) == 0 {
+		return errors.New("退款政策至少需要一条规则")
+	}
+	for i, rule := range rules {
+		label := firstNonEmpty(rule.Name, fmt.Sprintf("第%d条规则", i+1))
+		for _, role := range rule.CancelBy {
+			if role != "client" && role != "owner" && role != "pilot" && role != "admin" {
+				return fmt.Errorf("%s: 未知的取消方 %s", label, role)
+			}
+		}
+		if rule.MinHoursBeforeStart != nil && rule.MaxHoursBeforeStart != nil && *rule.MinHoursBeforeStart >= *rule.MaxHoursBeforeStart {
+			return fmt.Errorf("%s: 时间区间无效", label)
+		}
+		for _, rate := range []float64{rule.RefundRate, rule.CompensationRate, rule.PenaltyRate} {
+			if rate < 0 || rate > 1 {
+				return fmt.Errorf("%s: 比例须在0~1之间", label)
+			}
+		}
+		if rule.RefundRate+rule.CompensationRate > 1 {
+			return fmt.Errorf("%s: 退款与补偿比例之和不能超过1", label)
+		}
+		if rule.CompensateTo != "" && rule.CompensateTo != "provider" && rule.CompensateTo != "executor" {
+			return fmt.Errorf("%s: 未知的补偿对象 %s", label, rule.CompensateTo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestLateClientCancellationCompensatesDispatchedPilot(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Drone{}, &model.Order{}, &model.Payment{}, &model.Refund{}, &model.OrderTimeline{}, &model.OrderSnapshot{},
+		&model.RefundPolicy{}, &model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	taskID := int64(9)
+	order := &model.Order{
+		OrderNo: "WRJ-REFUND-1", Title: "临时取消", ClientUserID: 11, ProviderUserID: 21, ExecutorPilotUserID: 31,
+		DispatchTaskID: &taskID, StartTime: time.Now().Add(10 * time.Hour), TotalAmount: 10000, DepositAmount: 500, Status: "assigned",
+	}
+	paidAt := time.Now().Add(-time.Hour)
+	order.PaidAt, order.EndTime = &paidAt, order.StartTime.Add(2*time.Hour)
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if err := db.Create(&model.Payment{
+		PaymentNo: "PAY-" + order.OrderNo, OrderID: order.ID, UserID: order.ClientUserID, PaymentType: "order",
+		PaymentMethod: "mock", Amount: order.TotalAmount + order.DepositAmount, Status: "paid", PaidAt: &paidAt,
+	}).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	service := &OrderService{}
+	if err := service.cancelOrderWithRepos(order.ID, 11, "行程取消", "client",
+		repository.NewOrderRepo(db), repository.NewDroneRepo(db), repository.NewPaymentRepo(db), repository.NewOrderArtifactRepo(db), nil, nil,
+	); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+
+	var refunds []model.Refund
+	if err := db.Where("order_id = ?", order.ID).Find(&refunds).Error; err != nil || len(refunds) != 1 {
+		t.Fatalf("expected one refund, got %d, %v", len(refunds), err)
+	}
+	// 已派单且不足24小时: 退 60% 订单金额与押金，30% 补偿执行飞手，其余归平台
+	if refunds[0].Amount != 6500 {
+		t.Fatalf("expected refund 6500, got %d", refunds[0].Amount)
+	}
+	ledger := repository.NewLedgerRepo(db)
+	if balance, err := ledger.GetAccountBalance(model.LedgerAccountPilot, 31, model.LedgerBucketAvailable); err != nil || balance != 3000 {
+		t.Fatalf("expected pilot compensation 3000, got %d, %v", balance, err)
+	}
+	if balance, err := ledger.GetAccountBalance(model.LedgerAccountPlatform, 0, model.LedgerBucketAvailable); err != nil || balance != 1000 {
+		t.Fatalf("expected platform retained 1000, got %d, %v", balance, err)
+	}
+	var statement model.WalletTransaction
+	if err := db.Where("user_id = ? AND type = ?", 31, "income").First(&statement).Error; err != nil || statement.Amount != 3000 || statement.RelatedOrderID != order.ID {
+		t.Fatalf("expected pilot income statement, got %+v, %v", statement, err)
+	}
+	var snapshot model.OrderSnapshot
+	if err := db.Where("order_id = ? AND snapshot_type = ?", order.ID, "cancellation").First(&snapshot).Error; err != nil {
+		t.Fatalf("expected cancellation snapshot: %v", err)
+	}
+}
+
+func TestLateProviderCancellationChargesPenalty(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Drone{}, &model.Order{}, &model.Payment{}, &model.Refund{}, &model.OrderTimeline{}, &model.OrderSnapshot{},
+		&model.RefundPolicy{}, &model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	order := &model.Order{
+		OrderNo: "WRJ-REFUND-3", Title: "机主临时取消", ClientUserID: 11, ProviderUserID: 21, OwnerID: 21,
+		StartTime: time.Now().Add(10 * time.Hour), TotalAmount: 10000, DepositAmount: 500, Status: "paid",
+	}
+	paidAt := time.Now().Add(-time.Hour)
+	order.PaidAt, order.EndTime = &paidAt, order.StartTime.Add(2*time.Hour)
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if err := db.Create(&model.Payment{
+		PaymentNo: "PAY-" + order.OrderNo, OrderID: order.ID, UserID: order.ClientUserID, PaymentType: "order",
+		PaymentMethod: "mock", Amount: order.TotalAmount + order.DepositAmount, Status: "paid", PaidAt: &paidAt,
+	}).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	ledger := repository.NewLedgerRepo(db)
+	// 机主可用余额 800，不足以扣缴 1000 违约金
+	if _, err := ledger.Post(&model.LedgerEntry{EntryType: "settlement", IdempotencyKey: "test:owner-income"}, []repository.LedgerLine{
+		{AccountType: model.LedgerAccountOwner, UserID: 21, Amount: 800},
+		{AccountType: model.LedgerAccountEscrow, Amount: -800},
+	}); err != nil {
+		t.Fatalf("seed owner balance: %v", err)
+	}
+
+	service := &OrderService{}
+	if err := service.cancelOrderWithRepos(order.ID, 21, "设备故障", "owner",
+		repository.NewOrderRepo(db), repository.NewDroneRepo(db), repository.NewPaymentRepo(db), repository.NewOrderArtifactRepo(db), nil, nil,
+	); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+
+	var refunds []model.Refund
+	if err := db.Where("order_id = ?", order.ID).Find(&refunds).Error; err != nil || len(refunds) != 1 || refunds[0].Amount != 10500 {
+		t.Fatalf("expected full refund 10500, got %+v, %v", refunds, err)
+	}
+	if balance, err := ledger.GetAccountBalance(model.LedgerAccountOwner, 21, model.LedgerBucketAvailable); err != nil || balance != 0 {
+		t.Fatalf("expected owner balance charged to 0, got %d, %v", balance, err)
+	}
+	if balance, err := ledger.GetAccountBalance(model.LedgerAccountPlatform, 0, model.LedgerBucketAvailable); err != nil || balance != 1000 {
+		t.Fatalf("expected platform to book penalty 1000, got %d, %v", balance, err)
+	}
+	if balance, err := ledger.GetAccountBalance(model.LedgerAccountReceivable, 21, model.LedgerBucketAvailable); err != nil || balance != -200 {
+		t.Fatalf("expected uncollected penalty 200 recorded as receivable, got %d, %v", balance, err)
+	}
+	var wallet model.UserWallet
+	if err := db.Where("user_id = ?", 21).First(&wallet).Error; err != nil || wallet.AvailableBalance != 0 {
+		t.Fatalf("expected owner wallet emptied, got %+v, %v", wallet, err)
+	}
+	var statement model.WalletTransaction
+	if err := db.Where("user_id = ? AND type = ?", 21, "deduct").First(&statement).Error; err != nil || statement.Amount != -800 || statement.RelatedOrderID != order.ID {
+		t.Fatalf("expected owner penalty statement, got %+v, %v", statement, err)
+	}
+	var timeline model.OrderTimeline
+	if err := db.Where("order_id = ? AND status = ?", order.ID, "cancelled").First(&timeline).Error; err != nil || !strings.Contains(timeline.Note, "服务方违约金 1000 分，已扣缴 800 分") {
+		t.Fatalf("expected penalty noted on timeline, got %q, %v", timeline.Note, err)
+	}
+	// 同一订单的违约金只扣缴一次
+	if _, err := ledger.Post(&model.LedgerEntry{EntryType: "settlement", IdempotencyKey: "test:owner-income-2"}, []repository.LedgerLine{
+		{AccountType: model.LedgerAccountOwner, UserID: 21, Amount: 500},
+		{AccountType: model.LedgerAccountEscrow, Amount: -500},
+	}); err != nil {
+		t.Fatalf("seed owner balance: %v", err)
+	}
+	if charged, err := repository.NewSettlementRepo(db).ChargeCancellationPenalty(order, 21, 1000, "重复扣缴"); err != nil || charged != 0 {
+		t.Fatalf("expected penalty charged once, got %d, %v", charged, err)
+	}
+	if balance, _ := ledger.GetAccountBalance(model.LedgerAccountOwner, 21, model.LedgerBucketAvailable); balance != 500 {
+		t.Fatalf("expected later income untouched, got %d", balance)
+	}
+}
+
+func TestRefundPolicyVersionSnapshotAndPreview(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Drone{}, &model.Order{}, &model.Payment{}, &model.Refund{}, &model.OrderTimeline{}, &model.OrderSnapshot{},
+		&model.RefundPolicy{}, &model.UserWallet{}, &model.WalletTransaction{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	policies := NewRefundPolicyService(repository.NewRefundPolicyRepo(db), zap.NewNop())
+
+	twelve := 12.0
+	v1, err := policies.CreatePolicyVersion(&RefundPolicyInput{
+		PolicyCode:  "cargo",
+		ServiceType: "heavy_cargo_lift_transport",
+		Rules: []model.RefundPolicyRule{
+			{Name: "provider_fault", CancelBy: []string{"owner", "pilot"}, RefundRate: 1, RefundDeposit: true, PenaltyRate: 0.2, Description: "服务方取消，全额退款"},
+			{Name: "client_early", MinHoursBeforeStart: &twelve, RefundRate: 1, RefundDeposit: true, Description: "提前12小时以上取消，全额退款"},
+			{Name: "client_late", RefundRate: 0.5, RefundDeposit: true, Description: "临近开始取消，退款50%"},
+		},
+	}, 1)
+	if err != nil {
+		t.Fatalf("create policy: %v", err)
+	}
+	if _, err := policies.ActivatePolicy(v1.ID); err != nil {
+		t.Fatalf("activate policy: %v", err)
+	}
+
+	orderRepo := repository.NewOrderRepo(db)
+	service := &OrderService{orderRepo: orderRepo}
+	service.SetRefundPolicyService(policies)
+	order := &model.Order{
+		OrderNo: "WRJ-REFUND-2", Title: "政策版本", ClientUserID: 11, ProviderUserID: 21, ServiceType: "heavy_cargo_lift_transport",
+		StartTime: time.Now().Add(6 * time.Hour), TotalAmount: 8000, Status: "paid",
+	}
+	if err := service.snapshotRefundPolicy(order); err != nil {
+		t.Fatalf("snapshot policy: %v", err)
+	}
+	if order.RefundPolicyID != v1.ID || order.RefundPolicyVersion != 1 {
+		t.Fatalf("expected policy v1 snapshot, got id=%d version=%d", order.RefundPolicyID, order.RefundPolicyVersion)
+	}
+	paidAt := time.Now().Add(-time.Hour)
+	order.PaidAt, order.EndTime = &paidAt, order.StartTime.Add(2*time.Hour)
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if err := db.Create(&model.Payment{
+		PaymentNo: "PAY-" + order.OrderNo, OrderID: order.ID, UserID: order.ClientUserID, PaymentType: "order",
+		PaymentMethod: "mock", Amount: order.TotalAmount + order.DepositAmount, Status: "paid", PaidAt: &paidAt,
+	}).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	// 新版本启用后，已下单订单仍按 v1 计算
+	v2, err := policies.CreatePolicyVersion(&RefundPolicyInput{
+		PolicyCode:  "cargo",
+		ServiceType: "heavy_cargo_lift_transport",
+		Rules:       []model.RefundPolicyRule{{Name: "all", RefundRate: 1, RefundDeposit: true}},
+	}, 1)
+	if err != nil || v2.Version != 2 {
+		t.Fatalf("expected policy v2, got %+v, %v", v2, err)
+	}
+	if _, err := policies.ActivatePolicy(v2.ID); err != nil {
+		t.Fatalf("activate v2: %v", err)
+	}
+
+	clientQuote, err := service.PreviewCancellation(order.ID, "renter")
+	if err != nil {
+		t.Fatalf("preview client cancellation: %v", err)
+	}
+	if clientQuote.PolicyVersion != 1 || clientQuote.RuleName != "client_late" || clientQuote.RefundAmount != 4000 || clientQuote.PlatformRetained != 4000 {
+		t.Fatalf("unexpected client quote: %+v", clientQuote)
+	}
+	ownerQuote, err := service.PreviewCancellation(order.ID, "owner")
+	if err != nil {
+		t.Fatalf("preview owner cancellation: %v", err)
+	}
+	if ownerQuote.RefundAmount != 8000 || ownerQuote.PenaltyAmount != 1600 || ownerQuote.PenaltyUserID != 21 {
+		t.Fatalf("unexpected owner quote: %+v", ownerQuote)
+	}
+
+	reloaded, err := orderRepo.GetByID(order.ID)
+	if err != nil || reloaded.Status != "paid" {
+		t.Fatalf("expected preview to leave order untouched, got %+v, %v", reloaded, err)
+	}
+	if _, err := policies.ActivatePolicy(v1.ID); err == nil {
+		t.Fatal("expected retired policy version to stay retired")
+	}
+}
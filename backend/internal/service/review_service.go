@@ -11,12 +11,17 @@ type ReviewService struct {
 	reviewRepo *repository.ReviewRepo
 	droneRepo  *repository.DroneRepo
 	orderRepo  *repository.OrderRepo
+	credit     *CreditService
 }
 
 func NewReviewService(reviewRepo *repository.ReviewRepo, droneRepo *repository.DroneRepo, orderRepo *repository.OrderRepo) *ReviewService {
 	return &ReviewService{reviewRepo: reviewRepo, droneRepo: droneRepo, orderRepo: orderRepo}
 }
 
+func (s *ReviewService) SetCreditService(creditService *CreditService) {
+	s.credit = creditService
+}
+
 func (s *ReviewService) CreateReview(review *model.Review) error {
 	// Check if order is completed
 	order, err := s.orderRepo.GetByID(review.OrderID)
@@ -45,6 +50,11 @@ func (s *ReviewService) CreateReview(review *model.Review) error {
 		s.droneRepo.UpdateRating(review.TargetID)
 	}
 
+	// 评价已保存，信用事件登记失败可由信用回算补登
+	if s.credit != nil {
+		_ = s.credit.OnReviewCreated(review)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/payment"
+	"wurenji-backend/internal/repository"
+)
+
+// 提现出款: 审批通过 → processing(向渠道提交，以提现单号幂等) → completed(转出冻结余额) / failed(解冻退回可用余额)
+// 渠道未给出最终结果时由出款同步任务按退避时间重新提交或查询；银行卡以批量代付文件出款，结果以导入的银行回单为准
+
+const (
+	payoutBatchMethod   = "bank_card"
+	payoutBatchMaxItems = 500
+)
+
+func (s *SettlementService) SetPayoutProvider(method string, provider payment.PayoutProvider) {
+	if s.payoutProviders == nil {
+		s.payoutProviders = make(map[string]payment.PayoutProvider)
+	}
+	s.payoutProviders[method] = provider
+}
+
+// SyncPayouts 提交尚未受理的出款并查询处理中出款的结果(定时任务调用)，返回本轮得到最终结果的提现数
+func (s *SettlementService) SyncPayouts(limit int) (int, error) {
+	records, err := s.settlementRepo.ListPayoutsDue(time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	finished := 0
+	for i := range records {
+		record := &records[i]
+		provider := s.payoutProviders[record.WithdrawMethod]
+		if provider == nil {
+			s.recordPayoutRetry(record, fmt.Errorf("提现方式%s未配置出款渠道", record.WithdrawMethod))
+			continue
+		}
+		if record.PayoutSubmittedAt == nil {
+			if s.submitPayout(record) {
+				finished++
+			}
+			continue
+		}
+
+		result, err := provider.QueryPayout(record.WithdrawalNo)
+		if errors.Is(err, payment.ErrPayoutNotFound) {
+			// 渠道没有收到过该出款，以同一单号重新提交
+			if s.submitPayout(record) {
+				finished++
+			}
+			continue
+		}
+		if err != nil {
+			s.recordPayoutRetry(record, err)
+			continue
+		}
+		if s.applyPayoutResult(record, result) {
+			finished++
+		}
+	}
+	return finished, nil
+}
+
+// submitPayout 向渠道提交出款，返回是否已得到最终结果
+func (s *SettlementService) submitPayout(record *model.WithdrawalRecord) bool {
+	provider := s.payoutProviders[record.WithdrawMethod]
+	if provider == nil {
+		s.recordPayoutRetry(record, fmt.Errorf("提现方式%s未配置出款渠道", record.WithdrawMethod))
+		return false
+	}
+	result, err := provider.Transfer(payoutRequest(record))
+	if err != nil {
+		s.recordPayoutRetry(record, err)
+		return false
+	}
+	return s.applyPayoutResult(record, result)
+}
+
+// applyPayoutResult 按渠道结果完成或退回提现，处理中时记录受理信息并安排下次查询，返回是否已得到最终结果
+func (s *SettlementService) applyPayoutResult(record *model.WithdrawalRecord, result *payment.PayoutResult) bool {
+	now := time.Now()
+	var err error
+	switch result.Status {
+	case payment.PayoutSucceeded:
+		record.Status = "completed"
+		record.CompletedAt = &now
+		record.ThirdPartyNo = result.ThirdPartyNo
+		record.NextPayoutQueryAt = nil
+		if record.PayoutSubmittedAt == nil {
+			record.PayoutSubmittedAt = &now
+		}
+		err = s.settlementRepo.CompleteWithdrawal(record, "processing")
+	case payment.PayoutFailed:
+		record.Status = "failed"
+		record.FailReason = truncateRunes(result.FailReason, 255)
+		record.ThirdPartyNo = result.ThirdPartyNo
+		record.NextPayoutQueryAt = nil
+		err = s.settlementRepo.ReleaseWithdrawal(record, "processing", fmt.Sprintf("提现%s出款失败，退回余额", record.WithdrawalNo))
+	default:
+		submittedAt := record.PayoutSubmittedAt
+		if submittedAt == nil {
+			submittedAt = &now
+		}
+		attempts := record.PayoutAttempts + 1
+		nextQueryAt := now.Add(settlementRetryDelay(attempts))
+		_, err = s.settlementRepo.TransitionWithdrawal(record.ID, "processing", map[string]interface{}{
+			"payout_submitted_at":  submittedAt,
+			"third_party_no":       result.ThirdPartyNo,
+			"payout_attempts":      attempts,
+			"next_payout_query_at": &nextQueryAt,
+		})
+		if err != nil {
+			s.logger.Error("Failed to record payout progress", zap.Int64("withdrawal_id", record.ID), zap.Error(err))
+		}
+		return false
+	}
+
+	if err != nil {
+		if !errors.Is(err, repository.ErrWithdrawalStatusChanged) {
+			s.logger.Error("Failed to apply payout result",
+				zap.Int64("withdrawal_id", record.ID),
+				zap.String("status", result.Status),
+				zap.Error(err),
+			)
+		}
+		return false
+	}
+	s.logger.Info("Withdrawal payout finished",
+		zap.String("withdrawal_no", record.WithdrawalNo),
+		zap.String("status", record.Status),
+		zap.String("fail_reason", record.FailReason),
+	)
+	return true
+}
+
+// recordPayoutRetry 提交或查询失败时按退避时间安排重试
+func (s *SettlementService) recordPayoutRetry(record *model.WithdrawalRecord, cause error) {
+	attempts := record.PayoutAttempts + 1
+	nextQueryAt := time.Now().Add(settlementRetryDelay(attempts))
+	s.logger.Warn("Withdrawal payout pending retry",
+		zap.String("withdrawal_no", record.WithdrawalNo),
+		zap.Int("attempts", attempts),
+		zap.Time("next_query_at", nextQueryAt),
+		zap.Error(cause),
+	)
+	if _, err := s.settlementRepo.TransitionWithdrawal(record.ID, "processing", map[string]interface{}{
+		"payout_attempts":      attempts,
+		"next_payout_query_at": &nextQueryAt,
+	}); err != nil {
+		s.logger.Error("Failed to record payout retry", zap.Int64("withdrawal_id", record.ID), zap.Error(err))
+	}
+}
+
+// payoutRequest 按提现方式取收款账号，出款金额为扣除手续费后的实际到账金额
+func payoutRequest(record *model.WithdrawalRecord) *payment.PayoutRequest {
+	account := record.AccountNo
+	switch record.WithdrawMethod {
+	case "alipay":
+		account = record.AlipayAccount
+	case "wechat":
+		account = record.WechatAccount
+	}
+	return &payment.PayoutRequest{
+		PayoutNo:    record.WithdrawalNo,
+		Amount:      record.ActualAmount,
+		Account:     account,
+		AccountName: record.AccountName,
+		BankName:    record.BankName,
+		BankBranch:  record.BankBranch,
+		Remark:      "提现" + record.WithdrawalNo,
+	}
+}
+
+// ========== 银行卡批量代付 ==========
+
+func (s *SettlementService) payoutBatchExporter() (payment.PayoutBatchExporter, error) {
+	exporter, ok := s.payoutProviders[payoutBatchMethod].(payment.PayoutBatchExporter)
+	if !ok {
+		return nil, errors.New("银行卡出款未启用批量代付")
+	}
+	return exporter, nil
+}
+
+// ExportPayoutBatch 将出款中且未入批的银行卡提现生成代付批次，返回批次与批量文件
+func (s *SettlementService) ExportPayoutBatch(adminID int64, format string) (*model.PayoutBatch, []byte, error) {
+	exporter, err := s.payoutBatchExporter()
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := s.settlementRepo.ListUnbatchedPayouts(payoutBatchMethod, payoutBatchMaxItems)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("没有待导出的银行卡提现")
+	}
+
+	batch := &model.PayoutBatch{
+		BatchNo:    generatePayoutBatchNo(),
+		Status:     "exported",
+		ExportedBy: adminID,
+	}
+	batched, err := s.settlementRepo.CreatePayoutBatch(batch, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := exporter.ExportBatch(batch.BatchNo, format, payoutRequests(batched))
+	if err != nil {
+		return nil, nil, err
+	}
+	s.logger.Info("Payout batch exported",
+		zap.String("batch_no", batch.BatchNo),
+		zap.Int("count", batch.TotalCount),
+		zap.Int64("amount", batch.TotalAmount),
+	)
+	return batch, file, nil
+}
+
+// GetPayoutBatchFile 重新生成批次的批量文件
+func (s *SettlementService) GetPayoutBatchFile(batchNo, format string) ([]byte, error) {
+	exporter, err := s.payoutBatchExporter()
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.settlementRepo.ListWithdrawalsByBatch(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("代付批次不存在")
+	}
+	return exporter.ExportBatch(batchNo, format, payoutRequests(records))
+}
+
+// ImportPayoutBatchResult 导入银行回单，逐笔完成或退回批次内的提现
+func (s *SettlementService) ImportPayoutBatchResult(batchNo string, data []byte) (*model.PayoutBatch, error) {
+	exporter, err := s.payoutBatchExporter()
+	if err != nil {
+		return nil, err
+	}
+	batch, err := s.settlementRepo.GetPayoutBatch(batchNo)
+	if err != nil {
+		return nil, errors.New("代付批次不存在")
+	}
+	results, err := exporter.ParseBatchResult(data)
+	if err != nil {
+		return nil, fmt.Errorf("回单格式错误: %w", err)
+	}
+	records, err := s.settlementRepo.ListWithdrawalsByBatch(batchNo)
+	if err != nil {
+		return nil, err
+	}
+
+	byNo := make(map[string]*model.WithdrawalRecord, len(records))
+	for i := range records {
+		byNo[records[i].WithdrawalNo] = &records[i]
+	}
+	for i := range results {
+		record := byNo[results[i].PayoutNo]
+		if record == nil || record.Status != "processing" || results[i].Status == payment.PayoutProcessing {
+			continue
+		}
+		s.applyPayoutResult(record, &results[i])
+	}
+
+	// 以库中状态重新统计，回单重复导入或部分导入时结果保持一致
+	records, err = s.settlementRepo.ListWithdrawalsByBatch(batchNo)
+	if err != nil {
+		return nil, err
+	}
+	batch.SucceededCount, batch.FailedCount = 0, 0
+	processing := 0
+	for _, record := range records {
+		switch record.Status {
+		case "completed":
+			batch.SucceededCount++
+		case "failed":
+			batch.FailedCount++
+		case "processing":
+			processing++
+		}
+	}
+	now := time.Now()
+	batch.ResultImportedAt = &now
+	if processing == 0 {
+		batch.Status = "completed"
+	}
+	if err := s.settlementRepo.UpdatePayoutBatch(batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// ListPayoutBatches 代付批次列表
+func (s *SettlementService) ListPayoutBatches(page, pageSize int) ([]model.PayoutBatch, int64, error) {
+	return s.settlementRepo.ListPayoutBatches(page, pageSize)
+}
+
+func payoutRequests(records []model.WithdrawalRecord) []payment.PayoutRequest {
+	reqs := make([]payment.PayoutRequest, 0, len(records))
+	for i := range records {
+		reqs = append(reqs, *payoutRequest(&records[i]))
+	}
+	return reqs
+}
+
+func generatePayoutBatchNo() string {
+	return fmt.Sprintf("PB%d%04d", time.Now().UnixNano()/1e6, time.Now().Nanosecond()%10000)
+}
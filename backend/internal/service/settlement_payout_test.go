@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/payment"
+	"wurenji-backend/internal/repository"
+)
+
+// stubPayout 按出款单号返回预设结果，未预设时返回处理中
+type stubPayout struct {
+	transferErr error
+	results     map[string]*payment.PayoutResult
+	transfers   int
+}
+
+func (p *stubPayout) Transfer(req *payment.PayoutRequest) (*payment.PayoutResult, error) {
+	p.transfers++
+	if p.transferErr != nil {
+		return nil, p.transferErr
+	}
+	return p.QueryPayout(req.PayoutNo)
+}
+
+func (p *stubPayout) QueryPayout(payoutNo string) (*payment.PayoutResult, error) {
+	if result := p.results[payoutNo]; result != nil {
+		return result, nil
+	}
+	return &payment.PayoutResult{PayoutNo: payoutNo, Status: payment.PayoutProcessing}, nil
+}
+
+func payoutWallet(t *testing.T, db *gorm.DB, userID int64) model.UserWallet {
+	t.Helper()
+	var wallet model.UserWallet
+	if err := db.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		t.Fatalf("get wallet: %v", err)
+	}
+	return wallet
+}
+
+// dueNow 让出款同步任务立即处理该提现
+func dueNow(t *testing.T, db *gorm.DB, id int64) {
+	t.Helper()
+	if err := db.Model(&model.WithdrawalRecord{}).Where("id = ?", id).Update("next_payout_query_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("reset next query: %v", err)
+	}
+}
+
+func TestWithdrawalPayoutFailureReleasesFreeze(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.WithdrawalRecord{}, &model.PayoutBatch{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	if _, err := repository.NewLedgerRepo(db).Post(&model.LedgerEntry{EntryType: "opening_balance", IdempotencyKey: "test:opening:71"}, []repository.LedgerLine{
+		{AccountType: model.LedgerAccountPilot, UserID: 71, Amount: 100000},
+		{AccountType: model.LedgerAccountExternal, Amount: -100000},
+	}); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	provider := &stubPayout{results: map[string]*payment.PayoutResult{}}
+	service.SetPayoutProvider("wechat", provider)
+
+	if _, err := service.RequestWithdrawal(71, 10000, "bank_card", nil); err == nil {
+		t.Fatal("expected withdrawal method without payout channel to be rejected")
+	}
+	record, err := service.RequestWithdrawal(71, 30000, "wechat", map[string]string{"wechat_account": "openid_71"})
+	if err != nil {
+		t.Fatalf("request withdrawal: %v", err)
+	}
+	if err := service.ApproveWithdrawal(record.ID, 1); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	stored, _ := service.settlementRepo.GetWithdrawal(record.ID)
+	if stored.Status != "processing" || stored.PayoutSubmittedAt == nil || stored.NextPayoutQueryAt == nil {
+		t.Fatalf("expected accepted payout awaiting result, got %#v", stored)
+	}
+	if wallet := payoutWallet(t, db, 71); wallet.FrozenBalance != 30000 {
+		t.Fatalf("expected amount frozen while processing, got %d", wallet.FrozenBalance)
+	}
+
+	if finished, err := service.SyncPayouts(10); err != nil || finished != 0 {
+		t.Fatalf("expected nothing due before backoff, got %d %v", finished, err)
+	}
+	provider.results[record.WithdrawalNo] = &payment.PayoutResult{PayoutNo: record.WithdrawalNo, Status: payment.PayoutFailed, FailReason: "收款账户已注销"}
+	dueNow(t, db, record.ID)
+	if finished, err := service.SyncPayouts(10); err != nil || finished != 1 {
+		t.Fatalf("expected failed payout to finish, got %d %v", finished, err)
+	}
+
+	stored, _ = service.settlementRepo.GetWithdrawal(record.ID)
+	if stored.Status != "failed" || stored.FailReason != "收款账户已注销" {
+		t.Fatalf("expected failed withdrawal, got %#v", stored)
+	}
+	wallet := payoutWallet(t, db, 71)
+	if wallet.AvailableBalance != 100000 || wallet.FrozenBalance != 0 || wallet.TotalWithdrawn != 0 {
+		t.Fatalf("expected freeze reversed, got %#v", wallet)
+	}
+	if err := service.settlementRepo.CompleteWithdrawal(stored, "processing"); !errors.Is(err, repository.ErrWithdrawalStatusChanged) {
+		t.Fatalf("expected failed withdrawal not to complete later, got %v", err)
+	}
+}
+
+func TestWithdrawalPayoutRetriesTransferErrors(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.WithdrawalRecord{}, &model.PayoutBatch{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	if _, err := repository.NewLedgerRepo(db).Post(&model.LedgerEntry{EntryType: "opening_balance", IdempotencyKey: "test:opening:71"}, []repository.LedgerLine{
+		{AccountType: model.LedgerAccountPilot, UserID: 71, Amount: 100000},
+		{AccountType: model.LedgerAccountExternal, Amount: -100000},
+	}); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	provider := &stubPayout{transferErr: errors.New("connection reset"), results: map[string]*payment.PayoutResult{}}
+	service.SetPayoutProvider("alipay", provider)
+
+	record, err := service.RequestWithdrawal(71, 20000, "alipay", map[string]string{"alipay_account": "a@example.com"})
+	if err != nil {
+		t.Fatalf("request withdrawal: %v", err)
+	}
+	if err := service.ApproveWithdrawal(record.ID, 1); err != nil {
+		t.Fatalf("approve should succeed even if the channel is unreachable: %v", err)
+	}
+	stored, _ := service.settlementRepo.GetWithdrawal(record.ID)
+	if stored.Status != "processing" || stored.PayoutSubmittedAt != nil || stored.PayoutAttempts != 1 {
+		t.Fatalf("expected retry scheduled, got %#v", stored)
+	}
+
+	provider.transferErr = nil
+	provider.results[record.WithdrawalNo] = &payment.PayoutResult{PayoutNo: record.WithdrawalNo, Status: payment.PayoutSucceeded, ThirdPartyNo: "ALI_001"}
+	dueNow(t, db, record.ID)
+	if finished, err := service.SyncPayouts(10); err != nil || finished != 1 {
+		t.Fatalf("expected resubmitted payout to finish, got %d %v", finished, err)
+	}
+	stored, _ = service.settlementRepo.GetWithdrawal(record.ID)
+	if stored.Status != "completed" || stored.ThirdPartyNo != "ALI_001" || provider.transfers != 2 {
+		t.Fatalf("expected completed after retry, got %#v (transfers=%d)", stored, provider.transfers)
+	}
+	wallet := payoutWallet(t, db, 71)
+	if wallet.AvailableBalance != 80000 || wallet.FrozenBalance != 0 || wallet.TotalWithdrawn != 20000 {
+		t.Fatalf("unexpected wallet after payout: %#v", wallet)
+	}
+}
+
+func TestBankPayoutBatchExportAndResultImport(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.WithdrawalRecord{}, &model.PayoutBatch{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	if _, err := repository.NewLedgerRepo(db).Post(&model.LedgerEntry{EntryType: "opening_balance", IdempotencyKey: "test:opening:71"}, []repository.LedgerLine{
+		{AccountType: model.LedgerAccountPilot, UserID: 71, Amount: 100000},
+		{AccountType: model.LedgerAccountExternal, Amount: -100000},
+	}); err != nil {
+		t.Fatalf("seed balance: %v", err)
+	}
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	service.SetPayoutProvider("bank_card", payment.NewBankBatchPayout(payment.BankBatchConfig{PayerAccountNo: "6222", PayerAccountName: "平台"}, zap.NewNop()))
+
+	var records []*model.WithdrawalRecord
+	for _, account := range []string{"6217000000000001", "6217000000000002"} {
+		record, err := service.RequestWithdrawal(71, 20000, "bank_card", map[string]string{"account_no": account, "account_name": "王五", "bank_name": "建设银行"})
+		if err != nil {
+			t.Fatalf("request withdrawal: %v", err)
+		}
+		if err := service.ApproveWithdrawal(record.ID, 1); err != nil {
+			t.Fatalf("approve: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	batch, file, err := service.ExportPayoutBatch(1, "csv")
+	if err != nil {
+		t.Fatalf("export batch: %v", err)
+	}
+	if batch.TotalCount != 2 || batch.TotalAmount != records[0].ActualAmount*2 || !strings.Contains(string(file), records[1].WithdrawalNo) {
+		t.Fatalf("unexpected batch %#v\n%s", batch, file)
+	}
+	if _, _, err := service.ExportPayoutBatch(1, "csv"); err == nil {
+		t.Fatal("expected batched withdrawals not to be exported twice")
+	}
+
+	result := "付款单号,处理结果,银行流水号,失败原因\n" +
+		records[0].WithdrawalNo + ",成功,B001,\n" +
+		records[1].WithdrawalNo + ",失败,,户名不符\n"
+	batch, err = service.ImportPayoutBatchResult(batch.BatchNo, []byte(result))
+	if err != nil {
+		t.Fatalf("import result: %v", err)
+	}
+	if batch.Status != "completed" || batch.SucceededCount != 1 || batch.FailedCount != 1 {
+		t.Fatalf("unexpected batch after import: %#v", batch)
+	}
+	if _, err := service.ImportPayoutBatchResult(batch.BatchNo, []byte(result)); err != nil {
+		t.Fatalf("re-import result: %v", err)
+	}
+
+	wallet := payoutWallet(t, db, 71)
+	if wallet.AvailableBalance != 80000 || wallet.FrozenBalance != 0 || wallet.TotalWithdrawn != 20000 {
+		t.Fatalf("expected one payout and one reversal, got %#v", wallet)
+	}
+}
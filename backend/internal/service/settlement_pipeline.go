@@ -0,0 +1,326 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/model"
+)
+
+// 自动结算流水线: 订单完成 → pending(入队) → calculated(按实际飞行数据计算，进入争议期)
+// → confirmed(争议期结束且无未决纠纷) → settled(入账各方钱包)
+// 每个阶段都以状态条件更新推进，失败记录原因并按退避时间由定时任务重试
+
+const (
+	defaultSettlementDisputeWindowHours = 72
+	settlementBackfillWindow            = 7 * 24 * time.Hour
+	settlementRetryBaseDelay            = time.Minute
+	settlementRetryMaxDelay             = 6 * time.Hour
+)
+
+// EnqueueSettlement 为已完成订单登记待计算结算，重复调用不会生成多条结算
+func (s *SettlementService) EnqueueSettlement(orderID int64) error {
+	if existing, err := s.settlementRepo.GetSettlementByOrder(orderID); err == nil && existing.ID > 0 {
+		return nil
+	}
+	order, err := s.orderRepo.GetByID(orderID)
+	if err != nil {
+		return errors.New("订单不存在")
+	}
+	return s.settlementRepo.EnqueueSettlement(&model.OrderSettlement{
+		SettlementNo: generateSettlementNo(),
+		OrderID:      order.ID,
+		OrderNo:      order.OrderNo,
+		Status:       "pending",
+	})
+}
+
+// RunSettlementPipeline 推进自动结算各阶段(定时任务调用)，返回本轮推进的结算数
+func (s *SettlementService) RunSettlementPipeline(limit int) (int, error) {
+	now := time.Now()
+	advanced := 0
+
+	// 补偿订单完成时入队失败的结算
+	orderIDs, err := s.settlementRepo.ListCompletedOrderIDsWithoutSettlement(now.Add(-settlementBackfillWindow), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, orderID := range orderIDs {
+		if err := s.EnqueueSettlement(orderID); err != nil {
+			s.logger.Warn("Failed to enqueue settlement", zap.Int64("order_id", orderID), zap.Error(err))
+		}
+	}
+
+	pending, err := s.settlementRepo.ListSettlementsDue("pending", now, limit)
+	if err != nil {
+		return advanced, err
+	}
+	for i := range pending {
+		if s.runSettlementStep(&pending[i], s.calculateSettlement) {
+			advanced++
+		}
+	}
+
+	dueForConfirm, err := s.settlementRepo.ListSettlementsDueForConfirm(now, limit)
+	if err != nil {
+		return advanced, err
+	}
+	for i := range dueForConfirm {
+		if s.runSettlementStep(&dueForConfirm[i], func(settlement *model.OrderSettlement) error {
+			return s.ConfirmSettlement(settlement.ID)
+		}) {
+			advanced++
+		}
+	}
+
+	confirmed, err := s.settlementRepo.ListSettlementsDue("confirmed", now, limit)
+	if err != nil {
+		return advanced, err
+	}
+	for i := range confirmed {
+		if s.runSettlementStep(&confirmed[i], func(settlement *model.OrderSettlement) error {
+			return s.ExecuteSettlement(settlement.ID)
+		}) {
+			advanced++
+		}
+	}
+
+	return advanced, nil
+}
+
+// runSettlementStep 执行单个阶段，失败时记录原因与下次重试时间
+func (s *SettlementService) runSettlementStep(settlement *model.OrderSettlement, step func(*model.OrderSettlement) error) bool {
+	err := step(settlement)
+	if err == nil {
+		return true
+	}
+
+	attempts := settlement.Attempts + 1
+	nextRetryAt := time.Now().Add(settlementRetryDelay(attempts))
+	s.logger.Warn("Settlement step failed",
+		zap.Int64("settlement_id", settlement.ID),
+		zap.String("status", settlement.Status),
+		zap.Int("attempts", attempts),
+		zap.Time("next_retry_at", nextRetryAt),
+		zap.Error(err),
+	)
+	if recordErr := s.settlementRepo.RecordSettlementFailure(settlement.ID, attempts, settlementErrorText(err), nextRetryAt); recordErr != nil {
+		s.logger.Error("Failed to record settlement failure", zap.Int64("settlement_id", settlement.ID), zap.Error(recordErr))
+	}
+	return false
+}
+
+// settlementErrorText 截断失败原因以适配 last_error 字段长度
+func settlementErrorText(err error) string {
+	return truncateRunes(err.Error(), 500)
+}
+
+// truncateRunes 按字符截断，避免截断多字节字符
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) > max {
+		runes = runes[:max]
+	}
+	return string(runes)
+}
+
+// settlementRetryDelay 按失败次数指数退避，最长 settlementRetryMaxDelay
+func settlementRetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 10 {
+		return settlementRetryMaxDelay
+	}
+	delay := settlementRetryBaseDelay * time.Duration(1<<uint(attempts-1))
+	if delay > settlementRetryMaxDelay {
+		return settlementRetryMaxDelay
+	}
+	return delay
+}
+
+// calculateSettlement 按订单实付金额分账，并记录实际飞行距离与时长，进入争议期
+func (s *SettlementService) calculateSettlement(settlement *model.OrderSettlement) error {
+	order, err := s.orderRepo.GetByID(settlement.OrderID)
+	if err != nil {
+		return errors.New("订单不存在")
+	}
+
+	finalAmount := order.PayableAmount() // 单位: 分, 扣除优惠券后的实付金额
+	if finalAmount <= 0 {
+		return errors.New("订单金额为零")
+	}
+
+	// 已结案纠纷判定的退款从结算总额中扣除，罚金从责任方分成中扣除
+	adjustment, err := s.settlementRepo.SumDisputeAdjustments(order.ID)
+	if err != nil {
+		return err
+	}
+	finalAmount -= adjustment.RefundAmount
+	if finalAmount <= 0 {
+		_, err := s.settlementRepo.TransitionSettlement(settlement.ID, "pending", map[string]interface{}{
+			"order_no":        order.OrderNo,
+			"total_amount":    order.TotalAmount,
+			"coupon_discount": order.CouponDiscount,
+			"final_amount":    0,
+			"status":          "cancelled",
+			"notes":           "纠纷判定全额退款，无需结算",
+			"attempts":        0,
+			"last_error":      "",
+			"next_retry_at":   nil,
+		})
+		return err
+	}
+
+	distanceKm, durationMin, flightPilotUserID, err := s.orderFlightMetrics(order.ID)
+	if err != nil {
+		return err
+	}
+
+	// 获取分账比例
+	platformRate := s.getConfigFloat("split_platform_rate", 0.10)
+	pilotRate := s.getConfigFloat("split_pilot_rate", 0.45)
+	ownerRate := s.getConfigFloat("split_owner_rate", 0.40)
+	insuranceRate := s.getConfigFloat("split_insurance_rate", 0.05)
+
+	// 计算分账金额：平台补贴的优惠券按券前金额分账、由平台服务费承担抵扣；服务方让利的券按实付金额分账
+	splitAmount := finalAmount
+	couponSubsidy := int64(0)
+	if order.CouponDiscount > 0 && order.CouponFundedBy != CouponFundedByProvider {
+		couponSubsidy = order.CouponDiscount
+		splitAmount += couponSubsidy
+	}
+	platformFee := int64(math.Round(float64(splitAmount)*platformRate)) - couponSubsidy
+	insuranceDeduction := int64(math.Round(float64(splitAmount) * insuranceRate))
+	distributable := splitAmount - platformFee - couponSubsidy - insuranceDeduction
+	// 券额超过平台服务费时服务费记为零，超出部分作为平台补贴支出单独入账
+	platformSubsidy := int64(0)
+	if platformFee < 0 {
+		platformSubsidy = -platformFee
+		platformFee = 0
+	}
+	pilotFee := int64(math.Round(float64(distributable) * (pilotRate / (pilotRate + ownerRate))))
+	ownerFee := distributable - pilotFee
+	pilotPenalty := minInt64(adjustment.PilotPenaltyAmount, pilotFee)
+	ownerPenalty := minInt64(adjustment.OwnerPenaltyAmount, ownerFee)
+	pilotFee -= pilotPenalty
+	ownerFee -= ownerPenalty
+	platformFee += pilotPenalty + ownerPenalty
+	notes := ""
+	if adjustment.RefundAmount > 0 || pilotPenalty+ownerPenalty > 0 {
+		notes = fmt.Sprintf("纠纷调整: 退款 %d 分，飞手罚金 %d 分，机主罚金 %d 分", adjustment.RefundAmount, pilotPenalty, ownerPenalty)
+	}
+
+	now := time.Now()
+	completedAt := now
+	if order.CompletedAt != nil {
+		completedAt = *order.CompletedAt
+	}
+	window := time.Duration(s.getConfigFloat("settlement_dispute_window_hours", defaultSettlementDisputeWindowHours) * float64(time.Hour))
+	autoConfirmAt := completedAt.Add(window)
+
+	fields := map[string]interface{}{
+		"order_no":            order.OrderNo,
+		"total_amount":        order.TotalAmount,
+		"coupon_discount":     order.CouponDiscount,
+		"final_amount":        finalAmount,
+		"platform_fee_rate":   platformRate,
+		"platform_fee":        platformFee,
+		"platform_subsidy":    platformSubsidy,
+		"pilot_fee_rate":      pilotRate,
+		"pilot_fee":           pilotFee,
+		"owner_fee_rate":      ownerRate,
+		"owner_fee":           ownerFee,
+		"insurance_deduction": insuranceDeduction,
+		"pilot_user_id":       firstPositiveInt64(order.ExecutorPilotUserID, flightPilotUserID, order.PilotID),
+		"owner_user_id":       firstPositiveInt64(order.OwnerID, order.DroneOwnerUserID),
+		"payer_user_id":       firstPositiveInt64(order.RenterID, order.ClientUserID),
+		"flight_distance":     distanceKm,
+		"flight_duration":     durationMin,
+		"notes":               notes,
+		"status":              "calculated",
+		"calculated_at":       &now,
+		"auto_confirm_at":     &autoConfirmAt,
+		"attempts":            0,
+		"last_error":          "",
+		"next_retry_at":       nil,
+	}
+	// 下单时的分项报价快照记入结算明细
+	if pricing := parsePricingSnapshot(order.PricingSnapshot); pricing != nil {
+		fields["base_fee"] = pricing.BaseFee
+		fields["mileage_fee"] = pricing.MileageFee
+		fields["duration_fee"] = pricing.DurationFee
+		fields["weight_fee"] = pricing.WeightFee
+		fields["difficulty_fee"] = pricing.DifficultyFee
+		fields["insurance_fee"] = pricing.InsuranceFee
+		fields["surge_pricing"] = pricing.SurgePricing + pricing.MinimumAdjustment // 起步价补足计入溢价
+		fields["difficulty_factor"] = pricing.DifficultyFactor
+		fields["insurance_rate"] = pricing.InsuranceRate
+		fields["cargo_weight"] = pricing.CargoWeight
+		fields["cargo_value"] = pricing.CargoValue
+		if pricing.SurgeMultiplier > 0 {
+			fields["surge_multiplier"] = pricing.SurgeMultiplier // 下单时锁定的供需倍率，结算不再重新计算
+		}
+	}
+	updated, err := s.settlementRepo.TransitionSettlement(settlement.ID, "pending", fields)
+	if err != nil || !updated {
+		return err
+	}
+
+	s.logger.Info("Settlement calculated",
+		zap.Int64("order_id", order.ID),
+		zap.String("settlement_no", settlement.SettlementNo),
+		zap.Int64("total", finalAmount),
+		zap.Int64("platform_fee", platformFee),
+		zap.Int64("platform_subsidy", platformSubsidy),
+		zap.Int64("pilot_fee", pilotFee),
+		zap.Int64("owner_fee", ownerFee),
+		zap.Float64("flight_distance_km", distanceKm),
+		zap.Float64("flight_duration_min", durationMin),
+		zap.Time("auto_confirm_at", autoConfirmAt),
+	)
+	return nil
+}
+
+// orderFlightMetrics 汇总订单所有飞行记录的实际距离(km)与时长(分钟)，并返回执飞飞手
+func (s *SettlementService) orderFlightMetrics(orderID int64) (float64, float64, int64, error) {
+	if s.flightRepo == nil {
+		return 0, 0, 0, nil
+	}
+	records, err := s.flightRepo.ListFlightRecordsByOrder(orderID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var distanceM float64
+	var durationSeconds int
+	var pilotUserID int64
+	for _, record := range records {
+		distanceM += record.TotalDistanceM
+		durationSeconds += record.TotalDurationSeconds
+		if record.PilotUserID > 0 {
+			pilotUserID = record.PilotUserID
+		}
+	}
+	return math.Round(distanceM/10) / 100, math.Round(float64(durationSeconds)/60*100) / 100, pilotUserID, nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func firstPositiveInt64(values ...int64) int64 {
+	for _, value := range values {
+		if value > 0 {
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func walletBalance(t *testing.T, db *gorm.DB, userID int64) int64 {
+	t.Helper()
+	var wallet model.UserWallet
+	if err := db.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		return 0
+	}
+	return wallet.AvailableBalance
+}
+
+func TestSettlementPipelineSettlesCompletedOrderOnce(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{},
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.PricingConfig{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	service.SetFlightRepo(repository.NewFlightRepo(db))
+	completedAt := time.Now().Add(-96 * time.Hour)
+	order := &model.Order{OrderNo: "ORD_STL_001", OrderType: "cargo", OwnerID: 21, RenterID: 31, ExecutorPilotUserID: 11, TotalAmount: 100000, Status: "completed", CompletedAt: &completedAt}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	for i, distance := range []float64{3200, 1800} {
+		if err := db.Create(&model.FlightRecord{
+			FlightNo:             fmt.Sprintf("FL_STL_%03d", i+1),
+			OrderID:              order.ID,
+			PilotUserID:          11,
+			DroneID:              1,
+			TotalDistanceM:       distance,
+			TotalDurationSeconds: 300,
+			Status:               "completed",
+		}).Error; err != nil {
+			t.Fatalf("create flight record: %v", err)
+		}
+	}
+
+	advanced, err := service.RunSettlementPipeline(10)
+	if err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	if advanced != 3 {
+		t.Fatalf("expected calculate, confirm and execute in one pass, got %d", advanced)
+	}
+
+	settlement, err := service.GetSettlementByOrder(order.ID)
+	if err != nil {
+		t.Fatalf("get settlement: %v", err)
+	}
+	if settlement.Status != "settled" || settlement.SettledAt == nil {
+		t.Fatalf("expected settled, got %s", settlement.Status)
+	}
+	if settlement.FlightDistance != 5 || settlement.FlightDuration != 10 {
+		t.Fatalf("expected flight metrics 5km/10min, got %.2f/%.2f", settlement.FlightDistance, settlement.FlightDuration)
+	}
+	if settlement.PilotUserID != 11 || settlement.OwnerUserID != 21 {
+		t.Fatalf("unexpected participants: pilot=%d owner=%d", settlement.PilotUserID, settlement.OwnerUserID)
+	}
+	pilotBalance := walletBalance(t, db, 11)
+	ownerBalance := walletBalance(t, db, 21)
+	if pilotBalance != settlement.PilotFee || ownerBalance != settlement.OwnerFee || pilotBalance == 0 {
+		t.Fatalf("unexpected wallet balances: pilot=%d owner=%d", pilotBalance, ownerBalance)
+	}
+
+	if advanced, err := service.RunSettlementPipeline(10); err != nil || advanced != 0 {
+		t.Fatalf("expected idle second pass, got %d %v", advanced, err)
+	}
+	if err := service.ExecuteSettlement(settlement.ID); err != nil {
+		t.Fatalf("re-execute settled settlement: %v", err)
+	}
+	if err := service.EnqueueSettlement(order.ID); err != nil {
+		t.Fatalf("re-enqueue: %v", err)
+	}
+	var count int64
+	db.Model(&model.WalletTransaction{}).Where("related_settlement_id = ?", settlement.ID).Count(&count)
+	if count != 2 || walletBalance(t, db, 11) != pilotBalance {
+		t.Fatalf("expected wallets credited exactly once, got %d transactions", count)
+	}
+}
+
+func TestSettlementPipelineWaitsForDisputeWindowAndOpenDisputes(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{},
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.PricingConfig{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	service.SetFlightRepo(repository.NewFlightRepo(db))
+	recentAt, disputedAt := time.Now().Add(-time.Hour), time.Now().Add(-100*time.Hour)
+	recent := &model.Order{OrderNo: "ORD_STL_002", OrderType: "cargo", OwnerID: 21, RenterID: 31, ExecutorPilotUserID: 11, TotalAmount: 50000, Status: "completed", CompletedAt: &recentAt}
+	disputed := &model.Order{OrderNo: "ORD_STL_003", OrderType: "cargo", OwnerID: 21, RenterID: 31, ExecutorPilotUserID: 11, TotalAmount: 50000, Status: "completed", CompletedAt: &disputedAt}
+	for _, order := range []*model.Order{recent, disputed} {
+		if err := db.Create(order).Error; err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+	}
+	dispute := &model.DisputeRecord{OrderID: disputed.ID, InitiatorUserID: 31, DisputeType: "quality", Status: "open"}
+	if err := db.Create(dispute).Error; err != nil {
+		t.Fatalf("create dispute: %v", err)
+	}
+
+	if _, err := service.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	for _, orderID := range []int64{recent.ID, disputed.ID} {
+		settlement, _ := service.GetSettlementByOrder(orderID)
+		if settlement.Status != "calculated" {
+			t.Fatalf("order %d: expected calculated, got %s", orderID, settlement.Status)
+		}
+	}
+	recentSettlement, _ := service.GetSettlementByOrder(recent.ID)
+	if recentSettlement.AutoConfirmAt == nil || recentSettlement.AutoConfirmAt.Before(time.Now().Add(70*time.Hour)) {
+		t.Fatalf("expected auto confirm after dispute window, got %v", recentSettlement.AutoConfirmAt)
+	}
+
+	if err := db.Model(dispute).Update("status", "resolved").Error; err != nil {
+		t.Fatalf("resolve dispute: %v", err)
+	}
+	if _, err := service.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	settlement, _ := service.GetSettlementByOrder(disputed.ID)
+	if settlement.Status != "settled" {
+		t.Fatalf("expected settled once dispute resolved, got %s", settlement.Status)
+	}
+}
+
+func TestSettlementPipelineBacksOffFailedSteps(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Order{}, &model.OrderSettlement{}, &model.DisputeRecord{}, &model.FlightRecord{},
+		&model.UserWallet{}, &model.WalletTransaction{}, &model.PricingConfig{},
+		&model.LedgerAccount{}, &model.LedgerEntry{}, &model.LedgerPosting{},
+	)
+	service := NewSettlementService(repository.NewSettlementRepo(db), repository.NewOrderRepo(db), zap.NewNop())
+	service.SetFlightRepo(repository.NewFlightRepo(db))
+	completedAt := time.Now().Add(-100 * time.Hour)
+	order := &model.Order{OrderNo: "ORD_STL_004", OrderType: "cargo", OwnerID: 21, RenterID: 31, ExecutorPilotUserID: 11, Status: "completed", CompletedAt: &completedAt}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	if advanced, err := service.RunSettlementPipeline(10); err != nil || advanced != 0 {
+		t.Fatalf("expected no progress, got %d %v", advanced, err)
+	}
+	settlement, _ := service.GetSettlementByOrder(order.ID)
+	if settlement.Status != "pending" || settlement.Attempts != 1 || settlement.LastError == "" || settlement.NextRetryAt == nil {
+		t.Fatalf("expected recorded failure, got %#v", settlement)
+	}
+
+	if _, err := service.RunSettlementPipeline(10); err != nil {
+		t.Fatalf("run pipeline: %v", err)
+	}
+	settlement, _ = service.GetSettlementByOrder(order.ID)
+	if settlement.Attempts != 1 {
+		t.Fatalf("expected retry to wait for backoff, got %d attempts", settlement.Attempts)
+	}
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/pkg/geo"
+	"wurenji-backend/internal/repository"
+)
+
+const (
+	SurgeScopeCity = "city"
+	SurgeScopeCell = "cell"
+
+	SurgeSourceAuto   = "auto"
+	SurgeSourceManual = "manual"
+)
+
+// SurgeService 按城市与网格的实时供需计算动态溢价倍率。
+// 需求侧为进行中的需求与派单池待匹配任务，供给侧为在线飞手与可用无人机；
+// 倍率经上下限约束与指数平滑后落库，每次变动都留有记录，定价时按作业地点查询生效倍率
+type SurgeService struct {
+	surgeRepo *repository.SurgeRepo
+	cfg       config.SurgeConfig
+	logger    *zap.Logger
+}
+
+func NewSurgeService(surgeRepo *repository.SurgeRepo, cfg config.SurgeConfig, logger *zap.Logger) *SurgeService {
+	return &SurgeService{surgeRepo: surgeRepo, cfg: cfg, logger: logger}
+}
+
+// SurgeQuote 某地点当前生效的溢价倍率
+type SurgeQuote struct {
+	Multiplier float64    `json:"multiplier"`
+	ScopeType  string     `json:"scope_type,omitempty"`
+	ScopeKey   string     `json:"scope_key,omitempty"`
+	City       string     `json:"city,omitempty"`
+	Manual     bool       `json:"manual"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// SurgeRefreshResult 一次刷新的汇总
+type SurgeRefreshResult struct {
+	Scopes  int `json:"scopes"`
+	Changed int `json:"changed"`
+	Surging int `json:"surging"`
+}
+
+type surgeStats struct {
+	city    string
+	demands int
+	tasks   int
+	pilots  int
+	drones  int
+}
+
+// RefreshMultipliers 汇总实时信号并刷新全部区域的倍率，已无信号的区域逐步回落到 1.0
+func (s *SurgeService) RefreshMultipliers(now time.Time) (*SurgeRefreshResult, error) {
+	result := &SurgeRefreshResult{}
+	if !s.cfg.Enabled {
+		return result, nil
+	}
+	stats, err := s.collectSignals(now)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.surgeRepo.ListAllMultipliers()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*model.SurgeMultiplier, len(existing))
+	for i := range existing {
+		current[surgeScopeID(existing[i].ScopeType, existing[i].ScopeKey)] = &existing[i]
+		if _, ok := stats[surgeScopeID(existing[i].ScopeType, existing[i].ScopeKey)]; !ok {
+			stats[surgeScopeID(existing[i].ScopeType, existing[i].ScopeKey)] = &surgeStats{city: existing[i].City}
+		}
+	}
+
+	for id, stat := range stats {
+		scopeType, scopeKey := splitSurgeScopeID(id)
+		record := current[id]
+		if record == nil {
+			record = &model.SurgeMultiplier{ScopeType: scopeType, ScopeKey: scopeKey, Multiplier: 1, RawMultiplier: 1}
+		}
+		previous := record.Multiplier
+		if previous <= 0 {
+			previous = 1
+		}
+		raw := s.rawMultiplier(stat)
+		record.City = firstNonEmpty(stat.city, record.City)
+		record.RawMultiplier = raw
+		record.Multiplier = s.smooth(previous, raw)
+		record.DemandCount, record.TaskCount, record.PilotCount, record.DroneCount = stat.demands, stat.tasks, stat.pilots, stat.drones
+		record.ComputedAt = now
+		record.ExpiresAt = now.Add(s.cfg.TTL())
+
+		err := s.surgeRepo.DB().Transaction(func(tx *gorm.DB) error {
+			repo := repository.NewSurgeRepo(tx)
+			if err := repo.SaveMultiplier(record); err != nil {
+				return err
+			}
+			if math.Abs(record.Multiplier-previous) < 0.01 {
+				return nil
+			}
+			return repo.CreateLog(surgeLog(record, previous, SurgeSourceAuto, 0, ""))
+		})
+		if err != nil {
+			s.logger.Warn("save surge multiplier failed", zap.String("scope_type", scopeType), zap.String("scope_key", scopeKey), zap.Error(err))
+			continue
+		}
+		result.Scopes++
+		if math.Abs(record.Multiplier-previous) >= 0.01 {
+			result.Changed++
+		}
+		if record.Multiplier > 1 {
+			result.Surging++
+		}
+	}
+	return result, nil
+}
+
+// collectSignals 按城市与网格聚合需求和供给信号
+func (s *SurgeService) collectSignals(now time.Time) (map[string]*surgeStats, error) {
+	stats := make(map[string]*surgeStats)
+	add := func(signals []repository.SurgeSignal, count func(*surgeStats)) {
+		for _, signal := range signals {
+			if signal.City != "" {
+				id := surgeScopeID(SurgeScopeCity, signal.City)
+				if stats[id] == nil {
+					stats[id] = &surgeStats{city: signal.City}
+				}
+				count(stats[id])
+			}
+			if signal.Latitude != 0 || signal.Longitude != 0 {
+				id := surgeScopeID(SurgeScopeCell, s.cellKey(signal.Latitude, signal.Longitude))
+				if stats[id] == nil {
+					stats[id] = &surgeStats{}
+				}
+				stats[id].city = firstNonEmpty(stats[id].city, signal.City)
+				count(stats[id])
+			}
+		}
+	}
+
+	demands, err := s.surgeRepo.ListOpenDemandSignals(now)
+	if err != nil {
+		return nil, err
+	}
+	add(demands, func(stat *surgeStats) { stat.demands++ })
+	tasks, err := s.surgeRepo.ListPendingTaskSignals()
+	if err != nil {
+		return nil, err
+	}
+	add(tasks, func(stat *surgeStats) { stat.tasks++ })
+	pilots, err := s.surgeRepo.ListOnlinePilotSignals()
+	if err != nil {
+		return nil, err
+	}
+	add(pilots, func(stat *surgeStats) { stat.pilots++ })
+	drones, err := s.surgeRepo.ListAvailableDroneSignals()
+	if err != nil {
+		return nil, err
+	}
+	add(drones, func(stat *surgeStats) { stat.drones++ })
+	return stats, nil
+}
+
+// rawMultiplier 需求/供给比超过基准后按灵敏度线性加价；飞手与无人机需配合作业，供给取两者均值
+func (s *SurgeService) rawMultiplier(stat *surgeStats) float64 {
+	demand := stat.demands + stat.tasks
+	if demand < s.cfg.MinDemand || demand == 0 {
+		return s.clamp(1)
+	}
+	supply := math.Max(float64(stat.pilots+stat.drones)/2, 1)
+	ratio := float64(demand) / supply
+	return roundSurge(s.clamp(1 + s.cfg.Sensitivity*(ratio-s.cfg.BaseRatio)))
+}
+
+// smooth 指数平滑并限制单次变动幅度，避免倍率随瞬时波动跳变
+func (s *SurgeService) smooth(previous, raw float64) float64 {
+	next := previous + s.cfg.SmoothingFactor*(raw-previous)
+	if s.cfg.MaxStep > 0 {
+		next = math.Max(math.Min(next, previous+s.cfg.MaxStep), previous-s.cfg.MaxStep)
+	}
+	next = roundSurge(s.clamp(next))
+	// 平滑逼近时最后一档直接落到目标值，避免长期停在 1.01 之类的尾数
+	if math.Abs(next-raw) < 0.01 {
+		next = raw
+	}
+	return next
+}
+
+func (s *SurgeService) clamp(multiplier float64) float64 {
+	if s.cfg.MinMultiplier > 0 {
+		multiplier = math.Max(multiplier, s.cfg.MinMultiplier)
+	}
+	if s.cfg.MaxMultiplier > 0 {
+		multiplier = math.Min(multiplier, s.cfg.MaxMultiplier)
+	}
+	return multiplier
+}
+
+func (s *SurgeService) cellKey(lat, lng float64) string {
+	return geo.HexCell(geo.Point{Lat: lat, Lng: lng}, s.cfg.CellEdgeMeters)
+}
+
+// Lookup 查询作业地点的生效倍率：人工倍率在有效期内优先，其次网格优先于城市，过期记录按 1.0 计
+func (s *SurgeService) Lookup(lat, lng float64, city string, now time.Time) *SurgeQuote {
+	quote := &SurgeQuote{Multiplier: 1}
+	if s == nil || !s.cfg.Enabled {
+		return quote
+	}
+	city = strings.TrimSpace(city)
+	records := make([]*model.SurgeMultiplier, 0, 2)
+	if lat != 0 || lng != 0 {
+		if record, err := s.surgeRepo.GetMultiplier(SurgeScopeCell, s.cellKey(lat, lng)); err == nil {
+			records = append(records, record)
+		}
+	}
+	if city != "" {
+		if record, err := s.surgeRepo.GetMultiplier(SurgeScopeCity, city); err == nil {
+			records = append(records, record)
+		}
+	}
+	var matched *SurgeQuote
+	for _, record := range records {
+		multiplier, manual, expiresAt := effectiveSurge(record, now)
+		if expiresAt == nil || (matched != nil && (matched.Manual || !manual)) {
+			continue
+		}
+		matched = &SurgeQuote{
+			Multiplier: multiplier, ScopeType: record.ScopeType, ScopeKey: record.ScopeKey,
+			City: record.City, Manual: manual, ExpiresAt: expiresAt,
+		}
+	}
+	if matched == nil {
+		return quote
+	}
+	return matched
+}
+
+// effectiveSurge 返回记录当前生效的倍率，记录已失效时 expiresAt 为 nil
+func effectiveSurge(record *model.SurgeMultiplier, now time.Time) (float64, bool, *time.Time) {
+	if record.ManualMultiplier > 0 && record.ManualUntil != nil && now.Before(*record.ManualUntil) {
+		until := *record.ManualUntil
+		return record.ManualMultiplier, true, &until
+	}
+	if !now.Before(record.ExpiresAt) {
+		return 1, false, nil
+	}
+	expiresAt := record.ExpiresAt
+	return record.Multiplier, false, &expiresAt
+}
+
+// SetManualMultiplier 运营人工设定区域倍率(如大型活动、恶劣天气)，multiplier 为 0 时取消
+func (s *SurgeService) SetManualMultiplier(scopeType, scopeKey string, multiplier float64, until *time.Time, operatorID int64, reason string) (*model.SurgeMultiplier, error) {
+	scopeKey = strings.TrimSpace(scopeKey)
+	if scopeType != SurgeScopeCity && scopeType != SurgeScopeCell {
+		return nil, errors.New("溢价区域类型无效")
+	}
+	if scopeKey == "" {
+		return nil, errors.New("溢价区域不能为空")
+	}
+	if multiplier < 0 || (s.cfg.MaxMultiplier > 0 && multiplier > s.cfg.MaxMultiplier) {
+		return nil, errors.New("人工倍率超出允许范围")
+	}
+	if multiplier > 0 && (until == nil || !until.After(time.Now())) {
+		return nil, errors.New("人工倍率必须设置未来的截止时间")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("请填写调整原因")
+	}
+
+	var record *model.SurgeMultiplier
+	err := s.surgeRepo.DB().Transaction(func(tx *gorm.DB) error {
+		repo := repository.NewSurgeRepo(tx)
+		existing, err := repo.GetMultiplier(scopeType, scopeKey)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			existing = &model.SurgeMultiplier{ScopeType: scopeType, ScopeKey: scopeKey, Multiplier: 1, RawMultiplier: 1}
+			if scopeType == SurgeScopeCity {
+				existing.City = scopeKey
+			}
+		}
+		previous, _, _ := effectiveSurge(existing, time.Now())
+		existing.ManualMultiplier = multiplier
+		existing.ManualUntil = until
+		if multiplier == 0 {
+			existing.ManualUntil = nil
+		}
+		if err := repo.SaveMultiplier(existing); err != nil {
+			return err
+		}
+		record = existing
+		log := surgeLog(existing, previous, SurgeSourceManual, operatorID, reason)
+		log.Multiplier, _, _ = effectiveSurge(existing, time.Now())
+		return repo.CreateLog(log)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *SurgeService) ListMultipliers(scopeType, city string, page, pageSize int) ([]model.SurgeMultiplier, int64, error) {
+	return s.surgeRepo.ListMultipliers(scopeType, city, page, pageSize)
+}
+
+func (s *SurgeService) ListLogs(scopeType, scopeKey string, page, pageSize int) ([]model.SurgeMultiplierLog, int64, error) {
+	return s.surgeRepo.ListLogs(scopeType, scopeKey, page, pageSize)
+}
+
+func surgeLog(record *model.SurgeMultiplier, previous float64, source string, operatorID int64, reason string) *model.SurgeMultiplierLog {
+	return &model.SurgeMultiplierLog{
+		ScopeType:          record.ScopeType,
+		ScopeKey:           record.ScopeKey,
+		City:               record.City,
+		PreviousMultiplier: previous,
+		RawMultiplier:      record.RawMultiplier,
+		Multiplier:         record.Multiplier,
+		DemandCount:        record.DemandCount,
+		TaskCount:          record.TaskCount,
+		PilotCount:         record.PilotCount,
+		DroneCount:         record.DroneCount,
+		Source:             source,
+		OperatorID:         operatorID,
+		Reason:             reason,
+	}
+}
+
+func surgeScopeID(scopeType, scopeKey string) string {
+	return scopeType + "|" + scopeKey
+}
+
+func splitSurgeScopeID(id string) (string, string) {
+	scopeType, scopeKey, _ := strings.Cut(id, "|")
+	return scopeType, scopeKey
+}
+
+func roundSurge(multiplier float64) float64 {
+	return math.Round(multiplier*100) / 100
+}
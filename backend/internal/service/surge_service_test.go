@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	"wurenji-backend/internal/model"
+	"wurenji-backend/internal/repository"
+)
+
+func TestSurgeMultiplierSmoothsCapsAndFeedsPricing(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Demand{}, &model.DispatchTask{}, &model.Pilot{}, &model.Drone{},
+		&model.SurgeMultiplier{}, &model.SurgeMultiplierLog{},
+	)
+	surge := NewSurgeService(repository.NewSurgeRepo(db), config.SurgeConfig{
+		Enabled: true, CellEdgeMeters: 3000, BaseRatio: 1, Sensitivity: 0.25, MinDemand: 3,
+		MinMultiplier: 1, MaxMultiplier: 2, SmoothingFactor: 0.5, MaxStep: 0.3, TTLMinutes: 15,
+	}, zap.NewNop())
+	for i := 0; i < 6; i++ {
+		demand := &model.Demand{
+			DemandNo: fmt.Sprintf("DEM_SURGE_%d", i), ClientUserID: 31, Title: "吊运", ServiceType: "heavy_cargo_lift_transport",
+			CargoScene: "construction", Status: "published",
+			ServiceAddressSnapshot: model.JSON(`{"text":"南山","city":"深圳市","latitude":22.54,"longitude":114.05}`),
+		}
+		if err := db.Create(demand).Error; err != nil {
+			t.Fatalf("create demand: %v", err)
+		}
+	}
+	pilot := &model.Pilot{UserID: 11, AvailabilityStatus: "online", VerificationStatus: "verified", CurrentLatitude: 22.541, CurrentLongitude: 114.051, CurrentCity: "深圳市"}
+	if err := db.Create(pilot).Error; err != nil {
+		t.Fatalf("create pilot: %v", err)
+	}
+
+	// 6 个需求对 1 名飞手，目标倍率 2.25 封顶 2.0；平滑后首轮 1.5 再受单次变动 0.3 限制
+	now := time.Now()
+	result, err := surge.RefreshMultipliers(now)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if result.Scopes != 2 || result.Surging != 2 {
+		t.Fatalf("expected city and cell scopes to surge, got %+v", result)
+	}
+	quote := surge.Lookup(22.54, 114.05, "深圳市", now)
+	if quote.Multiplier != 1.3 || quote.ScopeType != SurgeScopeCell {
+		t.Fatalf("expected cell multiplier 1.3, got %+v", quote)
+	}
+	if _, err := surge.RefreshMultipliers(now.Add(5 * time.Minute)); err != nil {
+		t.Fatalf("refresh again: %v", err)
+	}
+	record, _ := repository.NewSurgeRepo(db).GetMultiplier(SurgeScopeCity, "深圳市")
+	if record.Multiplier != 1.6 || record.RawMultiplier != 2 || record.DemandCount != 6 || record.PilotCount != 1 {
+		t.Fatalf("unexpected city multiplier: %+v", record)
+	}
+	if _, total, _ := surge.ListLogs(SurgeScopeCity, "深圳市", 1, 10); total != 2 {
+		t.Fatalf("expected two audit logs for city, got %d", total)
+	}
+
+	// 报价叠加供需倍率：基础费80元 + 里程费30元，非高峰时段
+	engine := NewPricingEngine(nil, nil)
+	engine.SetSurgeService(surge)
+	day := time.Date(2026, 3, 17, 14, 0, 0, 0, time.Local)
+	priced, err := engine.Quote(PricingInput{FlightDistance: 2, ScheduledAt: &day, Latitude: 22.54, Longitude: 114.05}, nil)
+	if err != nil {
+		t.Fatalf("quote: %v", err)
+	}
+	if priced.SurgeMultiplier != 1.6 || priced.SurgePricing != 6600 || priced.TotalAmount != 17600 {
+		t.Fatalf("unexpected surge quote: %+v", priced)
+	}
+
+	// 有效期内未刷新的倍率过期后按 1.0 计价
+	if expired := surge.Lookup(22.54, 114.05, "深圳市", now.Add(time.Hour)); expired.Multiplier != 1 {
+		t.Fatalf("expected expired multiplier to fall back to 1.0, got %+v", expired)
+	}
+}
+
+func TestSurgeManualOverrideAndDecay(t *testing.T) {
+	db := newServiceTestDB(t,
+		&model.Demand{}, &model.DispatchTask{}, &model.Pilot{}, &model.Drone{},
+		&model.SurgeMultiplier{}, &model.SurgeMultiplierLog{},
+	)
+	surge := NewSurgeService(repository.NewSurgeRepo(db), config.SurgeConfig{
+		Enabled: true, CellEdgeMeters: 3000, BaseRatio: 1, Sensitivity: 0.25, MinDemand: 3,
+		MinMultiplier: 1, MaxMultiplier: 2, SmoothingFactor: 0.5, MaxStep: 0.3, TTLMinutes: 15,
+	}, zap.NewNop())
+	now := time.Now()
+	if err := db.Create(&model.SurgeMultiplier{
+		ScopeType: SurgeScopeCity, ScopeKey: "杭州市", City: "杭州市", Multiplier: 1.8, RawMultiplier: 2,
+		ComputedAt: now, ExpiresAt: now.Add(15 * time.Minute),
+	}).Error; err != nil {
+		t.Fatalf("seed multiplier: %v", err)
+	}
+
+	// 需求消失后倍率逐步回落，而不是直接归 1
+	if _, err := surge.RefreshMultipliers(now); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if quote := surge.Lookup(0, 0, "杭州市", now); quote.Multiplier != 1.5 {
+		t.Fatalf("expected decay to 1.5, got %+v", quote)
+	}
+
+	until := now.Add(2 * time.Hour)
+	if _, err := surge.SetManualMultiplier(SurgeScopeCity, "杭州市", 3, &until, 1, "暴雨"); err == nil {
+		t.Fatal("expected manual multiplier above cap to be rejected")
+	}
+	if _, err := surge.SetManualMultiplier(SurgeScopeCity, "杭州市", 1.2, &until, 1, "亚运会交通管制"); err != nil {
+		t.Fatalf("set manual multiplier: %v", err)
+	}
+	quote := surge.Lookup(30.25, 120.16, "杭州市", now.Add(time.Hour))
+	if !quote.Manual || quote.Multiplier != 1.2 {
+		t.Fatalf("expected manual override to win after auto expiry, got %+v", quote)
+	}
+	logs, _, _ := surge.ListLogs(SurgeScopeCity, "杭州市", 1, 10)
+	if len(logs) != 2 || logs[0].Source != SurgeSourceManual || logs[0].OperatorID != 1 || logs[0].Multiplier != 1.2 {
+		t.Fatalf("expected manual change to be audited, got %+v", logs)
+	}
+}
@@ -0,0 +1,366 @@
+// Package telemetry 接收飞控通过 UDP 推送的 MAVLink 遥测并批量写入飞行监控
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/pkg/mavlink"
+	"wurenji-backend/internal/service"
+)
+
+// maxPendingBatches 待写入采样上限(以批次计)，数据库长时间不可用时丢弃最旧的采样
+const maxPendingBatches = 50
+
+// defaultIdleTimeout 来源与飞控系统无数据超过该时长后回收其解析状态
+const defaultIdleTimeout = 5 * time.Minute
+
+// Ingester 遥测写入方，由 FlightService 实现
+type Ingester interface {
+	IngestTelemetry(samples []service.TelemetrySample) (int, error)
+}
+
+// Config 监听配置
+type Config struct {
+	ListenAddr        string
+	BatchSize         int           // 累积到该数量立即写入
+	FlushInterval     time.Duration // 最长写入间隔
+	MinSampleInterval time.Duration // 同一系统ID的最小采样间隔，飞控常以 5~10Hz 推送位置
+	IdleTimeout       time.Duration // 来源/系统无数据多久后回收解析状态
+	Sources           []SourceBinding
+}
+
+// SourceBinding 飞控系统ID允许的来源网段，未绑定的来源和系统ID一律丢弃
+type SourceBinding struct {
+	SystemID uint8
+	Network  *net.IPNet
+}
+
+// ParseSourceBinding 解析系统ID绑定的来源，source 可以是单个 IP 或 CIDR
+func ParseSourceBinding(systemID int, source string) (SourceBinding, error) {
+	if systemID < 1 || systemID > 255 {
+		return SourceBinding{}, fmt.Errorf("无效的 MAVLink 系统ID %d", systemID)
+	}
+	if _, network, err := net.ParseCIDR(source); err == nil {
+		return SourceBinding{SystemID: uint8(systemID), Network: network}, nil
+	}
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return SourceBinding{}, fmt.Errorf("无效的遥测来源地址 %q", source)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return SourceBinding{SystemID: uint8(systemID), Network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}, nil
+}
+
+// systemState 每个飞控系统ID的最新状态，电量/信号/温度来自非位置消息
+type systemState struct {
+	armed       bool
+	battery     int // -1 未知
+	signal      int // -1 未知
+	temperature *int
+	lastSeen    time.Time
+	lastSample  time.Time
+}
+
+// sourceState 每个来源地址的帧解析状态
+type sourceState struct {
+	parser   mavlink.Parser
+	lastSeen time.Time
+}
+
+// Listener UDP 遥测监听
+// GLOBAL_POSITION_INT 生成位置采样，HEARTBEAT/SYS_STATUS/BATTERY_STATUS 更新系统状态
+// 只接受 Sources 中绑定的来源与系统ID，防止伪造其他无人机的航迹
+type Listener struct {
+	cfg      Config
+	ingester Ingester
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	sources  map[string]*sourceState
+	systems  map[uint8]*systemState
+	pending  []service.TelemetrySample
+	dropped  int
+	rejected int
+
+	kick chan struct{}
+	conn net.PacketConn
+}
+
+func NewListener(cfg Config, ingester Ingester, logger *zap.Logger) *Listener {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	return &Listener{
+		cfg:      cfg,
+		ingester: ingester,
+		logger:   logger,
+		sources:  make(map[string]*sourceState),
+		systems:  make(map[uint8]*systemState),
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// Listen 绑定 UDP 端口，之后调用 Serve 开始接收
+func (l *Listener) Listen() error {
+	conn, err := net.ListenPacket("udp", l.cfg.ListenAddr)
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+	return nil
+}
+
+// Addr 实际监听地址
+func (l *Listener) Addr() net.Addr {
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.LocalAddr()
+}
+
+// Serve 接收遥测直到 ctx 结束，退出前写入剩余采样
+func (l *Listener) Serve(ctx context.Context) error {
+	if l.conn == nil {
+		if err := l.Listen(); err != nil {
+			return err
+		}
+	}
+	l.logger.Info("MAVLink 遥测监听已启动", zap.String("addr", l.conn.LocalAddr().String()))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.flushLoop(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		l.conn.Close()
+	}()
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				<-done
+				return nil
+			}
+			l.logger.Warn("读取遥测数据失败", zap.Error(err))
+			continue
+		}
+		if l.Process(addr.String(), buf[:n], time.Now()) {
+			select {
+			case l.kick <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (l *Listener) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(l.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.Flush()
+			return
+		case now := <-ticker.C:
+			l.Flush()
+			l.EvictIdle(now)
+		case <-l.kick:
+			l.Flush()
+		}
+	}
+}
+
+// Process 处理来自 source(host:port) 的一个数据报，返回待写入采样是否已达到批量大小
+// 来源不在任何绑定网段内时整包丢弃，帧的系统ID未绑定到该来源时丢弃该帧
+func (l *Listener) Process(source string, datagram []byte, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ip := sourceIP(source)
+	if ip == nil || !l.knownSource(ip) {
+		l.rejected++
+		return false
+	}
+	state := l.sources[source]
+	if state == nil {
+		state = &sourceState{}
+		l.sources[source] = state
+	}
+	state.lastSeen = now
+	for _, frame := range state.parser.Feed(datagram) {
+		if !l.boundTo(frame.SystemID, ip) {
+			l.rejected++
+			continue
+		}
+		msg, err := mavlink.Decode(frame)
+		if err != nil {
+			continue
+		}
+		l.handleLocked(frame.SystemID, msg, now)
+	}
+	return len(l.pending) >= l.cfg.BatchSize
+}
+
+// EvictIdle 回收超过 IdleTimeout 未收到数据的来源解析状态与飞控系统状态
+func (l *Listener) EvictIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.cfg.IdleTimeout)
+	for source, state := range l.sources {
+		if state.lastSeen.Before(cutoff) {
+			delete(l.sources, source)
+		}
+	}
+	for systemID, state := range l.systems {
+		if state.lastSeen.Before(cutoff) {
+			delete(l.systems, systemID)
+		}
+	}
+}
+
+func (l *Listener) knownSource(ip net.IP) bool {
+	for _, binding := range l.cfg.Sources {
+		if binding.Network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Listener) boundTo(systemID uint8, ip net.IP) bool {
+	for _, binding := range l.cfg.Sources {
+		if binding.SystemID == systemID && binding.Network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func sourceIP(source string) net.IP {
+	host, _, err := net.SplitHostPort(source)
+	if err != nil {
+		host = source
+	}
+	return net.ParseIP(host)
+}
+
+func (l *Listener) handleLocked(systemID uint8, msg mavlink.Message, now time.Time) {
+	state := l.systems[systemID]
+	if state == nil {
+		state = &systemState{battery: -1, signal: -1}
+		l.systems[systemID] = state
+		l.logger.Info("发现新的飞控系统", zap.Uint8("system_id", systemID))
+	}
+	state.lastSeen = now
+
+	switch m := msg.(type) {
+	case *mavlink.Heartbeat:
+		state.armed = m.Armed()
+	case *mavlink.SysStatus:
+		if m.BatteryRemaining >= 0 {
+			state.battery = int(m.BatteryRemaining)
+		}
+		if m.DropRateComm <= 10000 {
+			state.signal = 100 - int(m.DropRateComm)/100
+		}
+	case *mavlink.BatteryStatus:
+		if m.BatteryRemaining >= 0 {
+			state.battery = int(m.BatteryRemaining)
+		}
+		if m.Temperature != mavlink.TemperatureUnknown {
+			temperature := int(m.Temperature) / 10
+			state.temperature = &temperature
+		}
+	case *mavlink.GlobalPositionInt:
+		if m.Lat == 0 && m.Lon == 0 {
+			return // 未定位
+		}
+		if !state.lastSample.IsZero() && now.Sub(state.lastSample) < l.cfg.MinSampleInterval {
+			return
+		}
+		state.lastSample = now
+		l.appendLocked(newSample(systemID, m, state, now))
+	}
+}
+
+func (l *Listener) appendLocked(sample service.TelemetrySample) {
+	if limit := l.cfg.BatchSize * maxPendingBatches; len(l.pending) >= limit {
+		l.pending = l.pending[1:]
+		l.dropped++
+	}
+	l.pending = append(l.pending, sample)
+}
+
+func newSample(systemID uint8, m *mavlink.GlobalPositionInt, state *systemState, now time.Time) service.TelemetrySample {
+	sample := service.TelemetrySample{
+		SystemID:       int(systemID),
+		Latitude:       m.Latitude(),
+		Longitude:      m.Longitude(),
+		Altitude:       int(m.RelativeAlt / 1000),
+		Speed:          m.GroundSpeed(),
+		VerticalSpeed:  -int(m.Vz),
+		BatteryLevel:   100,
+		SignalStrength: 100,
+		Temperature:    state.temperature,
+		RecordedAt:     now,
+	}
+	if m.Hdg != mavlink.HeadingUnknown {
+		sample.Heading = int(m.Hdg) / 100
+	}
+	if state.battery >= 0 {
+		sample.BatteryLevel = state.battery
+	}
+	if state.signal >= 0 {
+		sample.SignalStrength = state.signal
+	}
+	return sample
+}
+
+// Flush 立即写入待处理的采样，写入失败的采样不重试
+func (l *Listener) Flush() {
+	l.mu.Lock()
+	samples := l.pending
+	dropped := l.dropped
+	rejected := l.rejected
+	l.pending = nil
+	l.dropped = 0
+	l.rejected = 0
+	l.mu.Unlock()
+
+	if dropped > 0 {
+		l.logger.Warn("遥测写入积压，已丢弃最旧采样", zap.Int("dropped", dropped))
+	}
+	if rejected > 0 {
+		l.logger.Warn("已丢弃未绑定来源或系统ID的遥测", zap.Int("rejected", rejected))
+	}
+	if len(samples) == 0 {
+		return
+	}
+	stored, err := l.ingester.IngestTelemetry(samples)
+	if err != nil {
+		l.logger.Warn("遥测批量写入失败", zap.Int("samples", len(samples)), zap.Int("stored", stored), zap.Error(err))
+		return
+	}
+	l.logger.Debug("遥测批量写入", zap.Int("samples", len(samples)), zap.Int("stored", stored))
+}
@@ -0,0 +1,165 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/pkg/mavlink"
+	"wurenji-backend/internal/service"
+)
+
+type recordingIngester struct {
+	mu      sync.Mutex
+	batches [][]service.TelemetrySample
+}
+
+func (r *recordingIngester) IngestTelemetry(samples []service.TelemetrySample) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, samples)
+	return len(samples), nil
+}
+
+func (r *recordingIngester) samples() []service.TelemetrySample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var all []service.TelemetrySample
+	for _, batch := range r.batches {
+		all = append(all, batch...)
+	}
+	return all
+}
+
+func encode(t *testing.T, msg mavlink.Message, systemID uint8) []byte {
+	t.Helper()
+	raw, err := mavlink.Encode(msg, 2, 0, systemID, 1)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return raw
+}
+
+func bind(t *testing.T, systemID int, source string) SourceBinding {
+	t.Helper()
+	binding, err := ParseSourceBinding(systemID, source)
+	if err != nil {
+		t.Fatalf("parse binding: %v", err)
+	}
+	return binding
+}
+
+func TestProcessBuildsSamplesFromSystemState(t *testing.T) {
+	ingester := &recordingIngester{}
+	sources := []SourceBinding{bind(t, 7, "10.0.0.7"), bind(t, 9, "10.0.1.0/24")}
+	listener := NewListener(Config{BatchSize: 2, MinSampleInterval: time.Second, Sources: sources}, ingester, zap.NewNop())
+	now := time.Now()
+	position := &mavlink.GlobalPositionInt{
+		Lat: 230272917, Lon: 1131243033, RelativeAlt: 52400, Vx: 300, Vy: 400, Vz: -150, Hdg: 9050,
+	}
+
+	var datagram []byte
+	datagram = append(datagram, encode(t, &mavlink.Heartbeat{BaseMode: mavlink.ModeFlagSafetyArmed}, 7)...)
+	datagram = append(datagram, encode(t, &mavlink.SysStatus{DropRateComm: 2500, BatteryRemaining: 70}, 7)...)
+	datagram = append(datagram, encode(t, &mavlink.BatteryStatus{Temperature: 3150, BatteryRemaining: 64}, 7)...)
+	datagram = append(datagram, encode(t, position, 7)...)
+	if full := listener.Process("10.0.0.7:14550", datagram, now); full {
+		t.Fatalf("batch should not be full after one sample")
+	}
+
+	// 采样间隔内的位置被丢弃，未定位的位置被忽略
+	listener.Process("10.0.0.7:14550", encode(t, position, 7), now.Add(200*time.Millisecond))
+	listener.Process("10.0.1.9:14550", encode(t, &mavlink.GlobalPositionInt{Hdg: mavlink.HeadingUnknown}, 9), now)
+	if full := listener.Process("10.0.1.9:14550", encode(t, &mavlink.GlobalPositionInt{Lat: 1, Lon: 1, Hdg: mavlink.HeadingUnknown}, 9), now); !full {
+		t.Fatalf("expected batch full after two samples")
+	}
+	listener.Flush()
+
+	samples := ingester.samples()
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+	got := samples[0]
+	if got.SystemID != 7 || got.Altitude != 52 || got.Speed != 500 || got.VerticalSpeed != 150 || got.Heading != 90 {
+		t.Fatalf("unexpected kinematics %#v", got)
+	}
+	if got.BatteryLevel != 64 || got.SignalStrength != 75 || got.Temperature == nil || *got.Temperature != 315 {
+		t.Fatalf("unexpected status fields %#v", got)
+	}
+	if got.Latitude != 23.0272917 || !got.RecordedAt.Equal(now) {
+		t.Fatalf("unexpected position %#v", got)
+	}
+	if other := samples[1]; other.SystemID != 9 || other.BatteryLevel != 100 || other.SignalStrength != 100 || other.Heading != 0 {
+		t.Fatalf("expected defaults for unknown status, got %#v", other)
+	}
+}
+
+func TestProcessDropsUnboundSourcesAndSystems(t *testing.T) {
+	ingester := &recordingIngester{}
+	listener := NewListener(Config{BatchSize: 1, IdleTimeout: time.Minute, Sources: []SourceBinding{bind(t, 7, "10.0.0.7")}}, ingester, zap.NewNop())
+	now := time.Now()
+	position := &mavlink.GlobalPositionInt{Lat: 230000000, Lon: 1130000000, Hdg: mavlink.HeadingUnknown}
+
+	// 未知来源冒充已绑定的系统ID，已知来源发送未绑定的系统ID
+	listener.Process("192.168.1.50:14550", encode(t, position, 7), now)
+	listener.Process("10.0.0.7:14550", encode(t, position, 8), now)
+	listener.Flush()
+	if samples := ingester.samples(); len(samples) != 0 {
+		t.Fatalf("expected spoofed telemetry to be dropped, got %#v", samples)
+	}
+	if len(listener.sources) != 1 {
+		t.Fatalf("expected no parser state for unknown senders, got %d", len(listener.sources))
+	}
+
+	listener.Process("10.0.0.7:14551", encode(t, position, 7), now)
+	listener.Flush()
+	if samples := ingester.samples(); len(samples) != 1 || samples[0].SystemID != 7 {
+		t.Fatalf("expected bound telemetry to be accepted, got %#v", samples)
+	}
+
+	listener.EvictIdle(now.Add(30 * time.Second))
+	if len(listener.sources) != 2 || len(listener.systems) != 1 {
+		t.Fatalf("recent state should be kept, got %d sources %d systems", len(listener.sources), len(listener.systems))
+	}
+	listener.EvictIdle(now.Add(2 * time.Minute))
+	if len(listener.sources) != 0 || len(listener.systems) != 0 {
+		t.Fatalf("idle state should be evicted, got %d sources %d systems", len(listener.sources), len(listener.systems))
+	}
+}
+
+func TestServeReceivesUDPTelemetry(t *testing.T) {
+	ingester := &recordingIngester{}
+	listener := NewListener(Config{ListenAddr: "127.0.0.1:0", BatchSize: 1, FlushInterval: time.Hour, Sources: []SourceBinding{bind(t, 3, "127.0.0.1")}}, ingester, zap.NewNop())
+	if err := listener.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- listener.Serve(ctx) }()
+
+	conn, err := net.Dial("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write(encode(t, &mavlink.GlobalPositionInt{Lat: 230000000, Lon: 1130000000, Hdg: mavlink.HeadingUnknown}, 3))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(ingester.samples()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for telemetry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if s := ingester.samples()[0]; s.SystemID != 3 || s.Latitude != 23 {
+		t.Fatalf("unexpected sample %#v", s)
+	}
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -68,10 +69,68 @@ func (c *Client) WritePump() {
 	}
 }
 
+// handleMessage 处理客户端上行帧: subscribe / unsubscribe / ack / ping
 func (c *Client) handleMessage(message []byte) {
-	// For now, echo the message back - in production, parse and route
-	c.hub.logger.Debug("received message",
-		zap.Int64("user_id", c.userID),
-		zap.String("message", string(message)),
-	)
+	var frame ClientFrame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		c.replyError(&frame, "invalid frame")
+		return
+	}
+
+	switch frame.Action {
+	case ActionSubscribe:
+		topic, err := ParseTopic(frame.Topic)
+		if err != nil {
+			c.replyError(&frame, err.Error())
+			return
+		}
+		if err := c.hub.subscribe(c, topic); err != nil {
+			c.hub.logger.Info("websocket subscribe rejected",
+				zap.Int64("user_id", c.userID),
+				zap.String("topic", frame.Topic),
+				zap.Error(err),
+			)
+			c.replyError(&frame, err.Error())
+			return
+		}
+		c.reply(TypeSubscribed, &frame)
+
+	case ActionUnsubscribe:
+		c.hub.unsubscribe(c, frame.Topic)
+		c.reply(TypeUnsubscribed, &frame)
+
+	case ActionAck:
+		if frame.MessageID == "" {
+			c.replyError(&frame, "missing message_id")
+			return
+		}
+		if c.hub.ackHandler != nil {
+			err := c.hub.ackHandler(Ack{UserID: c.userID, UserType: c.userType, Topic: frame.Topic, MessageID: frame.MessageID, Ref: frame.Ref})
+			if err != nil {
+				c.replyError(&frame, err.Error())
+				return
+			}
+		}
+		c.reply(TypeAcked, &frame)
+
+	case ActionPing:
+		c.reply(TypePong, &frame)
+
+	default:
+		c.replyError(&frame, "unknown action")
+	}
+}
+
+func (c *Client) reply(msgType string, frame *ClientFrame) {
+	c.hub.reply(c, &WSMessage{
+		Type: msgType,
+		Data: ReplyData{RequestID: frame.RequestID, Topic: frame.Topic, MessageID: frame.MessageID},
+	})
+}
+
+func (c *Client) replyError(frame *ClientFrame, reason string) {
+	c.hub.reply(c, &WSMessage{
+		Type: TypeError,
+		Data: ReplyData{RequestID: frame.RequestID, Action: frame.Action, Topic: frame.Topic, Error: reason},
+	})
 }
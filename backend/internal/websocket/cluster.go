@@ -0,0 +1,254 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// presenceTTL 在线状态有效期，实例宕机后其连接在该时间后自动视为离线
+	presenceTTL = 90 * time.Second
+	// presenceHeartbeat 在线状态续期间隔
+	presenceHeartbeat = 30 * time.Second
+	// brokerTimeout 单次 Broker 调用超时
+	brokerTimeout = 2 * time.Second
+)
+
+// Broker 多实例消息分发与在线状态后端
+// 所有出站消息经 Broker 广播到每个实例，由持有连接的实例投递
+type Broker interface {
+	// Publish 广播消息到所有实例(包括自身)
+	Publish(ctx context.Context, payload []byte) error
+	// Subscribe 订阅广播消息，ctx 结束后停止投递
+	Subscribe(ctx context.Context) (<-chan []byte, error)
+	// MarkOnline 标记(或续期)用户在 nodeID 实例上在线
+	MarkOnline(ctx context.Context, nodeID string, userIDs ...int64) error
+	// MarkOffline 移除用户在 nodeID 实例上的在线状态
+	MarkOffline(ctx context.Context, nodeID string, userID int64) error
+	IsOnline(ctx context.Context, userID int64) (bool, error)
+	OnlineCount(ctx context.Context) (int, error)
+}
+
+// DefaultNodeID 实例标识: 主机名-进程号
+func DefaultNodeID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "node"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// ==================== Redis 实现 ====================
+
+// 清理过期实例后移除当前实例，若用户已无任何实例在线则从在线集合删除
+var markOfflineScript = redis.NewScript(`
+redis.call("HDEL", KEYS[1], ARGV[1])
+local fields = redis.call("HGETALL", KEYS[1])
+for i = 1, #fields, 2 do
+	if tonumber(fields[i + 1]) < tonumber(ARGV[3]) then
+		redis.call("HDEL", KEYS[1], fields[i])
+	end
+end
+if redis.call("HLEN", KEYS[1]) == 0 then
+	redis.call("ZREM", KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// RedisBroker 基于 Redis pub/sub 的消息分发，在线状态保存在有序集合中
+//
+//	ws:fanout          pub/sub 频道
+//	ws:presence        ZSET 用户ID -> 在线过期时间
+//	ws:conn:<user_id>  HASH 实例ID -> 在线过期时间，用户可能同时连接多个实例
+type RedisBroker struct {
+	rds         *redis.Client
+	channel     string
+	presenceKey string
+	connPrefix  string
+}
+
+func NewRedisBroker(rds *redis.Client) *RedisBroker {
+	return &RedisBroker{
+		rds:         rds,
+		channel:     "ws:fanout",
+		presenceKey: "ws:presence",
+		connPrefix:  "ws:conn:",
+	}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, payload []byte) error {
+	return b.rds.Publish(ctx, b.channel, payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	pubsub := b.rds.Subscribe(ctx, b.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	out := make(chan []byte, 256)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *RedisBroker) MarkOnline(ctx context.Context, nodeID string, userIDs ...int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	expireAt := now.Add(presenceTTL).Unix()
+	pipe := b.rds.Pipeline()
+	for _, userID := range userIDs {
+		member := strconv.FormatInt(userID, 10)
+		connKey := b.connPrefix + member
+		pipe.HSet(ctx, connKey, nodeID, expireAt)
+		pipe.Expire(ctx, connKey, presenceTTL)
+		pipe.ZAdd(ctx, b.presenceKey, &redis.Z{Score: float64(expireAt), Member: member})
+	}
+	pipe.ZRemRangeByScore(ctx, b.presenceKey, "-inf", strconv.FormatInt(now.Unix(), 10))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisBroker) MarkOffline(ctx context.Context, nodeID string, userID int64) error {
+	member := strconv.FormatInt(userID, 10)
+	return markOfflineScript.Run(ctx, b.rds, []string{b.connPrefix + member, b.presenceKey}, nodeID, member, time.Now().Unix()).Err()
+}
+
+func (b *RedisBroker) IsOnline(ctx context.Context, userID int64) (bool, error) {
+	score, err := b.rds.ZScore(ctx, b.presenceKey, strconv.FormatInt(userID, 10)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return int64(score) > time.Now().Unix(), nil
+}
+
+func (b *RedisBroker) OnlineCount(ctx context.Context) (int, error) {
+	n, err := b.rds.ZCount(ctx, b.presenceKey, "("+strconv.FormatInt(time.Now().Unix(), 10), "+inf").Result()
+	return int(n), err
+}
+
+// ==================== 进程内实现 ====================
+
+// LocalBroker 进程内 Broker，多个 Hub 共享同一实例即可模拟多实例部署，用于测试
+type LocalBroker struct {
+	mu          sync.Mutex
+	subscribers []chan []byte
+	presence    map[int64]map[string]time.Time
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{presence: make(map[int64]map[string]time.Time)}
+}
+
+func (b *LocalBroker) Publish(ctx context.Context, payload []byte) error {
+	b.mu.Lock()
+	subscribers := append([]chan []byte(nil), b.subscribers...)
+	b.mu.Unlock()
+	for _, ch := range subscribers {
+		select {
+		case ch <- payload:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	ch := make(chan []byte, 256)
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, ch)
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subscribers {
+			if sub == ch {
+				b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (b *LocalBroker) MarkOnline(ctx context.Context, nodeID string, userIDs ...int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	expireAt := time.Now().Add(presenceTTL)
+	for _, userID := range userIDs {
+		if b.presence[userID] == nil {
+			b.presence[userID] = make(map[string]time.Time)
+		}
+		b.presence[userID][nodeID] = expireAt
+	}
+	return nil
+}
+
+func (b *LocalBroker) MarkOffline(ctx context.Context, nodeID string, userID int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.presence[userID], nodeID)
+	if len(b.presence[userID]) == 0 {
+		delete(b.presence, userID)
+	}
+	return nil
+}
+
+func (b *LocalBroker) IsOnline(ctx context.Context, userID int64) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.onlineLocked(userID, time.Now()), nil
+}
+
+func (b *LocalBroker) OnlineCount(ctx context.Context) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for userID := range b.presence {
+		if b.onlineLocked(userID, now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (b *LocalBroker) onlineLocked(userID int64, now time.Time) bool {
+	for _, expireAt := range b.presence[userID] {
+		if expireAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -42,10 +42,12 @@ func HandleWebSocket(hub *Hub, cfg *config.Config, logger *zap.Logger) gin.Handl
 		}
 
 		client := &Client{
-			hub:    hub,
-			conn:   conn,
-			userID: claims.UserID,
-			send:   make(chan []byte, 256),
+			hub:      hub,
+			conn:     conn,
+			userID:   claims.UserID,
+			userType: claims.UserType,
+			send:     make(chan []byte, 256),
+			topics:   make(map[string]struct{}),
 		}
 
 		hub.register <- client
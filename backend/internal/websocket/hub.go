@@ -1,131 +1,487 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
+// maxTopicsPerClient 单个连接允许订阅的主题数上限
+const maxTopicsPerClient = 64
+
+var (
+	ErrTooManyTopics   = errors.New("too many subscriptions")
+	ErrClientClosed    = errors.New("client closed")
+	ErrNoAuthorization = errors.New("topic authorization not configured")
+)
+
+// Ack 客户端确认帧
+type Ack struct {
+	UserID    int64
+	UserType  string
+	Topic     string
+	MessageID string
+	Ref       string
+}
+
+// AckHandler 客户端确认消息回调，返回错误时向客户端回执 error
+type AckHandler func(ack Ack) error
+
 type Hub struct {
 	clients    map[int64]*Client
+	topics     map[string]map[*Client]struct{}
 	broadcast  chan *WSMessage
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+	seq        int64
+	authorizer Authorizer
+	ackHandler AckHandler
 	logger     *zap.Logger
+
+	// 多实例部署: 出站消息经 broker 分发到所有实例
+	broker   Broker
+	nodeID   string
+	presence chan presenceEvent
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
-type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
+type presenceEvent struct {
 	userID int64
-	send   chan []byte
+	online bool
+}
+
+// clusterEnvelope 经 Broker 分发的消息
+type clusterEnvelope struct {
+	Origin   string          `json:"origin"`
+	TargetID int64           `json:"target_id,omitempty"`
+	Topic    string          `json:"topic,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+type Client struct {
+	hub      *Hub
+	conn     *websocket.Conn
+	userID   int64
+	userType string
+	send     chan []byte
+
+	// 以下字段受 hub.mu 保护
+	topics map[string]struct{}
+	closed bool
 }
 
 type WSMessage struct {
-	Type      string      `json:"type"` // chat, order_update, system, matching
+	ID        string      `json:"id,omitempty"` // 主题消息ID，客户端 ack 时回传
+	Type      string      `json:"type"`         // chat, order_update, system, matching, flight_position, flight_alert ...
+	Topic     string      `json:"topic,omitempty"`
 	Data      interface{} `json:"data"`
 	Timestamp int64       `json:"timestamp"`
 	TargetID  int64       `json:"-"` // target user ID, 0 for broadcast
+
+	raw []byte // 从 Broker 收到的已编码消息
 }
 
 func NewHub(logger *zap.Logger) *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Hub{
 		clients:    make(map[int64]*Client),
+		topics:     make(map[string]map[*Client]struct{}),
 		broadcast:  make(chan *WSMessage, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		logger:     logger,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
+// EnableCluster 启用多实例模式，需在 Run 之前调用
+// 出站消息发布到 broker 后由每个实例投递给本地连接，在线状态写入 broker 供全局查询
+func (h *Hub) EnableCluster(broker Broker, nodeID string) {
+	h.broker = broker
+	h.nodeID = nodeID
+	h.presence = make(chan presenceEvent, 1024)
+}
+
+// SetAuthorizer 设置主题订阅鉴权
+func (h *Hub) SetAuthorizer(authorizer Authorizer) {
+	h.authorizer = authorizer
+}
+
+// SetAckHandler 设置客户端 ack 回调
+func (h *Hub) SetAckHandler(handler AckHandler) {
+	h.ackHandler = handler
+}
+
 func (h *Hub) Run() {
+	if h.broker != nil {
+		go h.consumeCluster()
+		go h.syncPresence()
+	}
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			// Close existing connection for same user
 			if existing, ok := h.clients[client.userID]; ok {
-				close(existing.send)
+				h.removeClient(existing)
 				existing.conn.Close()
 			}
 			h.clients[client.userID] = client
 			h.mu.Unlock()
+			h.notifyPresence(client.userID, true)
 			h.logger.Info("client connected", zap.Int64("user_id", client.userID))
 
 		case client := <-h.unregister:
 			h.mu.Lock()
+			removed := false
 			if existing, ok := h.clients[client.userID]; ok && existing == client {
-				delete(h.clients, client.userID)
-				close(client.send)
+				h.removeClient(client)
+				removed = true
 			}
 			h.mu.Unlock()
+			if removed {
+				h.notifyPresence(client.userID, false)
+			}
 			h.logger.Info("client disconnected", zap.Int64("user_id", client.userID))
 
 		case msg := <-h.broadcast:
-			data, _ := json.Marshal(msg)
-			if msg.TargetID > 0 {
+			data := msg.raw
+			if data == nil {
+				data, _ = json.Marshal(msg)
+			}
+			h.mu.Lock()
+			switch {
+			case msg.Topic != "":
+				for client := range h.topics[msg.Topic] {
+					h.deliver(client, data)
+				}
+			case msg.TargetID > 0:
 				// Send to specific user
-				h.mu.RLock()
 				if client, ok := h.clients[msg.TargetID]; ok {
-					select {
-					case client.send <- data:
-					default:
-						close(client.send)
-						delete(h.clients, msg.TargetID)
-					}
+					h.deliver(client, data)
 				}
-				h.mu.RUnlock()
-			} else {
+			default:
 				// Broadcast to all
-				h.mu.RLock()
 				for _, client := range h.clients {
-					select {
-					case client.send <- data:
-					default:
-						close(client.send)
-						delete(h.clients, client.userID)
-					}
+					h.deliver(client, data)
 				}
-				h.mu.RUnlock()
 			}
+			h.mu.Unlock()
 		}
 	}
 }
 
+// deliver 投递消息，发送缓冲已满的慢连接直接断开，调用方需持有写锁
+func (h *Hub) deliver(client *Client, data []byte) {
+	if client.closed {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// removeClient 移除连接及其全部订阅，调用方需持有写锁
+func (h *Hub) removeClient(client *Client) {
+	if client.closed {
+		return
+	}
+	client.closed = true
+	for topic := range client.topics {
+		h.dropSubscriber(topic, client)
+	}
+	if existing, ok := h.clients[client.userID]; ok && existing == client {
+		delete(h.clients, client.userID)
+	}
+	close(client.send)
+}
+
+func (h *Hub) dropSubscriber(topic string, client *Client) {
+	subscribers := h.topics[topic]
+	delete(subscribers, client)
+	if len(subscribers) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// subscribe 鉴权后为连接添加主题订阅，重复订阅视为成功
+func (h *Hub) subscribe(client *Client, topic Topic) error {
+	if h.authorizer == nil {
+		return ErrNoAuthorization
+	}
+	if err := h.authorizer.AuthorizeTopic(client.userID, client.userType, topic); err != nil {
+		return err
+	}
+
+	name := topic.String()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client.closed {
+		return ErrClientClosed
+	}
+	if _, ok := client.topics[name]; ok {
+		return nil
+	}
+	if len(client.topics) >= maxTopicsPerClient {
+		return ErrTooManyTopics
+	}
+	client.topics[name] = struct{}{}
+	if h.topics[name] == nil {
+		h.topics[name] = make(map[*Client]struct{})
+	}
+	h.topics[name][client] = struct{}{}
+	return nil
+}
+
+func (h *Hub) unsubscribe(client *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := client.topics[topic]; !ok {
+		return
+	}
+	delete(client.topics, topic)
+	h.dropSubscriber(topic, client)
+}
+
+// reply 直接回复单个连接
+func (h *Hub) reply(client *Client, msg *WSMessage) {
+	msg.Timestamp = time.Now().Unix()
+	data, _ := json.Marshal(msg)
+	h.mu.Lock()
+	h.deliver(client, data)
+	h.mu.Unlock()
+}
+
 // SendToUser sends a message to a specific user
 func (h *Hub) SendToUser(userID int64, msgType string, data interface{}) {
-	h.broadcast <- &WSMessage{
+	h.dispatch(&WSMessage{
 		Type:      msgType,
 		Data:      data,
 		Timestamp: time.Now().Unix(),
 		TargetID:  userID,
-	}
+	}, true)
 }
 
 // Broadcast sends a message to all connected users
 func (h *Hub) Broadcast(msgType string, data interface{}) {
-	h.broadcast <- &WSMessage{
+	h.dispatch(&WSMessage{
 		Type:      msgType,
 		Data:      data,
 		Timestamp: time.Now().Unix(),
+	}, true)
+}
+
+// Publish 向主题的全部订阅者发送消息
+// 位置上报等高频路径调用，队列已满时丢弃而不阻塞业务
+func (h *Hub) Publish(topic, msgType string, data interface{}) {
+	id := strconv.FormatInt(atomic.AddInt64(&h.seq, 1), 10)
+	if h.nodeID != "" {
+		id = h.nodeID + "-" + id
 	}
+	h.dispatch(&WSMessage{
+		ID:        id,
+		Type:      msgType,
+		Topic:     topic,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	}, false)
 }
 
-// IsOnline checks if a user is connected
-func (h *Hub) IsOnline(userID int64) bool {
+// dispatch 多实例模式下经 broker 分发，否则(或 broker 不可用时)直接本地投递
+func (h *Hub) dispatch(msg *WSMessage, blocking bool) {
+	if h.broker != nil {
+		err := h.publishCluster(msg)
+		if err == nil {
+			return
+		}
+		h.logger.Warn("websocket cluster publish failed, delivering locally", zap.String("type", msg.Type), zap.Error(err))
+	}
+	if blocking {
+		h.broadcast <- msg
+		return
+	}
+	select {
+	case h.broadcast <- msg:
+	default:
+		h.logger.Warn("websocket publish dropped", zap.String("topic", msg.Topic), zap.String("type", msg.Type))
+	}
+}
+
+func (h *Hub) publishCluster(msg *WSMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	envelope, err := json.Marshal(clusterEnvelope{
+		Origin:   h.nodeID,
+		TargetID: msg.TargetID,
+		Topic:    msg.Topic,
+		Payload:  payload,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, brokerTimeout)
+	defer cancel()
+	return h.broker.Publish(ctx, envelope)
+}
+
+// consumeCluster 接收 broker 分发的消息并投递给本地连接，订阅断开后自动重连
+func (h *Hub) consumeCluster() {
+	for h.ctx.Err() == nil {
+		ch, err := h.broker.Subscribe(h.ctx)
+		if err != nil {
+			h.logger.Error("websocket cluster subscribe failed", zap.Error(err))
+			select {
+			case <-time.After(time.Second):
+			case <-h.ctx.Done():
+			}
+			continue
+		}
+		h.drainCluster(ch)
+	}
+}
+
+func (h *Hub) drainCluster(ch <-chan []byte) {
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case raw, ok := <-ch:
+			if !ok {
+				return
+			}
+			var envelope clusterEnvelope
+			if err := json.Unmarshal(raw, &envelope); err != nil || len(envelope.Payload) == 0 {
+				h.logger.Warn("invalid websocket cluster message", zap.Error(err))
+				continue
+			}
+			h.broadcast <- &WSMessage{TargetID: envelope.TargetID, Topic: envelope.Topic, raw: envelope.Payload}
+		}
+	}
+}
+
+func (h *Hub) notifyPresence(userID int64, online bool) {
+	if h.broker == nil {
+		return
+	}
+	select {
+	case h.presence <- presenceEvent{userID: userID, online: online}:
+	default:
+		// 心跳会在下一周期修正在线状态
+		h.logger.Warn("websocket presence event dropped", zap.Int64("user_id", userID))
+	}
+}
+
+// syncPresence 顺序写入上下线事件，并定期为本实例全部在线用户续期
+func (h *Hub) syncPresence() {
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case ev := <-h.presence:
+			ctx, cancel := context.WithTimeout(h.ctx, brokerTimeout)
+			var err error
+			if ev.online {
+				err = h.broker.MarkOnline(ctx, h.nodeID, ev.userID)
+			} else {
+				err = h.broker.MarkOffline(ctx, h.nodeID, ev.userID)
+			}
+			cancel()
+			if err != nil {
+				h.logger.Warn("websocket presence update failed", zap.Int64("user_id", ev.userID), zap.Error(err))
+			}
+		case <-ticker.C:
+			userIDs := h.localUserIDs()
+			ctx, cancel := context.WithTimeout(h.ctx, brokerTimeout)
+			if err := h.broker.MarkOnline(ctx, h.nodeID, userIDs...); err != nil {
+				h.logger.Warn("websocket presence heartbeat failed", zap.Int("users", len(userIDs)), zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+func (h *Hub) localUserIDs() []int64 {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	userIDs := make([]int64, 0, len(h.clients))
+	for userID := range h.clients {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+// Close 停止集群消费并清除本实例的在线状态
+func (h *Hub) Close() {
+	h.cancel()
+	if h.broker == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+	for _, userID := range h.localUserIDs() {
+		h.broker.MarkOffline(ctx, h.nodeID, userID)
+	}
+}
+
+// SubscriberCount returns the number of local subscribers of a topic
+func (h *Hub) SubscriberCount(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+// IsOnline checks if a user is connected to any instance
+func (h *Hub) IsOnline(userID int64) bool {
+	h.mu.RLock()
 	_, ok := h.clients[userID]
-	return ok
+	h.mu.RUnlock()
+	if ok || h.broker == nil {
+		return ok
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, brokerTimeout)
+	defer cancel()
+	online, err := h.broker.IsOnline(ctx, userID)
+	if err != nil {
+		h.logger.Warn("websocket presence lookup failed", zap.Int64("user_id", userID), zap.Error(err))
+		return false
+	}
+	return online
 }
 
-// OnlineCount returns the number of connected clients
+// OnlineCount returns the number of connected users across all instances
 func (h *Hub) OnlineCount() int {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
-	return len(h.clients)
+	local := len(h.clients)
+	h.mu.RUnlock()
+	if h.broker == nil {
+		return local
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, brokerTimeout)
+	defer cancel()
+	count, err := h.broker.OnlineCount(ctx)
+	if err != nil {
+		h.logger.Warn("websocket online count failed", zap.Error(err))
+		return local
+	}
+	// 上线事件异步写入，刚连接的用户可能尚未计入
+	if count < local {
+		return local
+	}
+	return count
 }
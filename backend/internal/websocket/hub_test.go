@@ -0,0 +1,199 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"wurenji-backend/internal/config"
+	jwtpkg "wurenji-backend/internal/pkg/jwt"
+)
+
+type orderOwnerAuthorizer struct{}
+
+// 仅允许访问与用户ID相同的订单
+func (orderOwnerAuthorizer) AuthorizeTopic(userID int64, userType string, topic Topic) error {
+	if topic.Kind == TopicOrder && topic.ID == userID {
+		return nil
+	}
+	return errors.New("forbidden")
+}
+
+func TestParseTopic(t *testing.T) {
+	cases := map[string]Topic{
+		"order:12":         {Kind: TopicOrder, ID: 12},
+		"flight:3":         {Kind: TopicFlight, ID: 3},
+		"dispatch:pilot:7": {Kind: TopicDispatchPilot, ID: 7},
+		" admin:alerts ":   {Kind: TopicAdminAlerts},
+	}
+	for raw, want := range cases {
+		got, err := ParseTopic(raw)
+		if err != nil || got != want {
+			t.Fatalf("ParseTopic(%q) = %v, %v", raw, got, err)
+		}
+		if got.String() != strings.TrimSpace(raw) {
+			t.Fatalf("String() = %q, want %q", got.String(), raw)
+		}
+	}
+	for _, raw := range []string{"", "order", "order:", "order:0", "order:abc", "user:1", "dispatch:1", "admin:other"} {
+		if _, err := ParseTopic(raw); !errors.Is(err, ErrInvalidTopic) {
+			t.Fatalf("ParseTopic(%q) expected ErrInvalidTopic, got %v", raw, err)
+		}
+	}
+}
+
+func dialTestClient(t *testing.T, serverURL, secret string, userID int64) *websocket.Conn {
+	t.Helper()
+	tokens, err := jwtpkg.GenerateTokenPair(userID, "client", secret, 3600, 7200)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/ws?token="+tokens.AccessToken, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]interface{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestTopicSubscriptionFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+
+	hub := NewHub(zap.NewNop())
+	hub.SetAuthorizer(orderOwnerAuthorizer{})
+	acked := make(chan string, 1)
+	hub.SetAckHandler(func(ack Ack) error {
+		if ack.Ref == "flight_alert:0" {
+			return errors.New("告警不存在")
+		}
+		acked <- ack.MessageID
+		return nil
+	})
+	go hub.Run()
+
+	r := gin.New()
+	r.GET("/ws", HandleWebSocket(hub, cfg, zap.NewNop()))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn := dialTestClient(t, srv.URL, cfg.JWT.Secret, 12)
+
+	conn.WriteJSON(ClientFrame{Action: ActionPing, RequestID: "p1"})
+	if msg := readMessage(t, conn); msg["type"] != TypePong || msg["data"].(map[string]interface{})["request_id"] != "p1" {
+		t.Fatalf("unexpected ping reply %v", msg)
+	}
+
+	conn.WriteJSON(ClientFrame{Action: ActionSubscribe, Topic: "order:13", RequestID: "s1"})
+	if msg := readMessage(t, conn); msg["type"] != TypeError {
+		t.Fatalf("expected authorization error, got %v", msg)
+	}
+	conn.WriteJSON(ClientFrame{Action: ActionSubscribe, Topic: "order:12", RequestID: "s2"})
+	if msg := readMessage(t, conn); msg["type"] != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %v", msg)
+	}
+
+	hub.Publish(OrderTopic(13), "order_update", map[string]interface{}{"order_id": 13})
+	hub.Publish(OrderTopic(12), "order_update", map[string]interface{}{"order_id": 12})
+	msg := readMessage(t, conn)
+	if msg["topic"] != "order:12" || msg["type"] != "order_update" || msg["id"] == "" {
+		t.Fatalf("expected order:12 update only, got %v", msg)
+	}
+
+	conn.WriteJSON(ClientFrame{Action: ActionAck, Topic: "order:12", MessageID: msg["id"].(string)})
+	if reply := readMessage(t, conn); reply["type"] != TypeAcked {
+		t.Fatalf("expected acked, got %v", reply)
+	}
+	if id := <-acked; id != msg["id"] {
+		t.Fatalf("ack handler got %q", id)
+	}
+	conn.WriteJSON(ClientFrame{Action: ActionAck, Topic: "order:12", MessageID: msg["id"].(string), Ref: "flight_alert:0"})
+	if reply := readMessage(t, conn); reply["type"] != TypeError {
+		t.Fatalf("expected rejected ack reported as error, got %v", reply)
+	}
+
+	conn.WriteJSON(ClientFrame{Action: ActionUnsubscribe, Topic: "order:12"})
+	if reply := readMessage(t, conn); reply["type"] != TypeUnsubscribed {
+		t.Fatalf("expected unsubscribed, got %v", reply)
+	}
+	if n := hub.SubscriberCount("order:12"); n != 0 {
+		t.Fatalf("expected no subscribers after unsubscribe, got %d", n)
+	}
+
+	raw, _ := json.Marshal(map[string]string{"action": "shout"})
+	conn.WriteMessage(websocket.TextMessage, raw)
+	if reply := readMessage(t, conn); reply["type"] != TypeError {
+		t.Fatalf("expected error for unknown action, got %v", reply)
+	}
+}
+
+func TestClusterFanOutAcrossHubs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+
+	broker := NewLocalBroker()
+	nodeA, nodeB := NewHub(zap.NewNop()), NewHub(zap.NewNop())
+	nodeA.EnableCluster(broker, "node-a")
+	nodeB.EnableCluster(broker, "node-b")
+	nodeA.SetAuthorizer(orderOwnerAuthorizer{})
+	for _, h := range []*Hub{nodeA, nodeB} {
+		go h.Run()
+		defer h.Close()
+	}
+
+	r := gin.New()
+	r.GET("/ws", HandleWebSocket(nodeA, cfg, zap.NewNop()))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn := dialTestClient(t, srv.URL, cfg.JWT.Secret, 21)
+	conn.WriteJSON(ClientFrame{Action: ActionSubscribe, Topic: "order:21"})
+	if msg := readMessage(t, conn); msg["type"] != TypeSubscribed {
+		t.Fatalf("expected subscribed, got %v", msg)
+	}
+
+	waitFor := func(cond func() bool, what string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor(func() bool { return nodeB.IsOnline(21) && nodeB.OnlineCount() == 1 }, "presence on node b")
+
+	// 另一实例发出的消息经 broker 送达
+	nodeB.SendToUser(21, "system", map[string]interface{}{"text": "hello"})
+	if msg := readMessage(t, conn); msg["type"] != "system" {
+		t.Fatalf("expected direct message from node b, got %v", msg)
+	}
+	nodeB.Publish(OrderTopic(21), "order_update", map[string]interface{}{"order_id": 21})
+	msg := readMessage(t, conn)
+	if msg["topic"] != "order:21" || !strings.HasPrefix(msg["id"].(string), "node-b-") {
+		t.Fatalf("expected topic message from node b, got %v", msg)
+	}
+
+	conn.Close()
+	waitFor(func() bool { return !nodeB.IsOnline(21) && nodeB.OnlineCount() == 0 }, "offline on node b")
+}
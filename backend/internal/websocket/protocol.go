@@ -0,0 +1,40 @@
+package websocket
+
+// 客户端上行动作
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionAck         = "ack"
+	ActionPing        = "ping"
+)
+
+// 服务端回执类型
+const (
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeAcked        = "acked"
+	TypePong         = "pong"
+	TypeError        = "error"
+)
+
+// ClientFrame 客户端上行帧
+//
+//	{"action":"subscribe","topic":"order:12","request_id":"r1"}
+//	{"action":"ack","topic":"admin:alerts","message_id":"42","ref":"flight_alert:7"}
+//	{"action":"ping"}
+type ClientFrame struct {
+	Action    string `json:"action"`
+	RequestID string `json:"request_id,omitempty"` // 客户端请求ID，回执中原样带回
+	Topic     string `json:"topic,omitempty"`
+	MessageID string `json:"message_id,omitempty"` // ack 确认的主题消息ID
+	Ref       string `json:"ref,omitempty"`        // ack 关联的业务对象，如 flight_alert:7 表示确认该告警
+}
+
+// ReplyData 回执内容
+type ReplyData struct {
+	RequestID string `json:"request_id,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Topic     string `json:"topic,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 主题类型
+const (
+	TopicOrder         = "order"          // order:<订单ID>，订单状态与实时位置
+	TopicFlight        = "flight"         // flight:<飞行记录ID>，单架次实时位置与告警
+	TopicDispatchPilot = "dispatch:pilot" // dispatch:pilot:<飞手用户ID>，飞手派单
+	TopicAdminAlerts   = "admin:alerts"   // 管理后台全局告警
+)
+
+// AdminAlertsTopic 管理后台告警主题
+const AdminAlertsTopic = TopicAdminAlerts
+
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// Topic 解析后的订阅主题
+type Topic struct {
+	Kind string
+	ID   int64
+}
+
+func (t Topic) String() string {
+	if t.Kind == TopicAdminAlerts {
+		return TopicAdminAlerts
+	}
+	return t.Kind + ":" + strconv.FormatInt(t.ID, 10)
+}
+
+// ParseTopic 解析主题字符串，如 order:12、flight:3、dispatch:pilot:7、admin:alerts
+func ParseTopic(raw string) (Topic, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == TopicAdminAlerts {
+		return Topic{Kind: TopicAdminAlerts}, nil
+	}
+	idx := strings.LastIndex(raw, ":")
+	if idx <= 0 {
+		return Topic{}, fmt.Errorf("%w: %q", ErrInvalidTopic, raw)
+	}
+	kind := raw[:idx]
+	switch kind {
+	case TopicOrder, TopicFlight, TopicDispatchPilot:
+	default:
+		return Topic{}, fmt.Errorf("%w: %q", ErrInvalidTopic, raw)
+	}
+	id, err := strconv.ParseInt(raw[idx+1:], 10, 64)
+	if err != nil || id <= 0 {
+		return Topic{}, fmt.Errorf("%w: %q", ErrInvalidTopic, raw)
+	}
+	return Topic{Kind: kind, ID: id}, nil
+}
+
+// OrderTopic 订单主题
+func OrderTopic(orderID int64) string {
+	return Topic{Kind: TopicOrder, ID: orderID}.String()
+}
+
+// FlightTopic 飞行记录主题
+func FlightTopic(flightRecordID int64) string {
+	return Topic{Kind: TopicFlight, ID: flightRecordID}.String()
+}
+
+// DispatchPilotTopic 飞手派单主题
+func DispatchPilotTopic(pilotUserID int64) string {
+	return Topic{Kind: TopicDispatchPilot, ID: pilotUserID}.String()
+}
+
+// Authorizer 校验用户是否有权订阅主题
+type Authorizer interface {
+	AuthorizeTopic(userID int64, userType string, topic Topic) error
+}
+
+// Publisher 按主题发布消息，由业务服务持有
+type Publisher interface {
+	Publish(topic, msgType string, data interface{})
+}
@@ -0,0 +1,22 @@
+-- 111_create_job_runs.sql
+-- 定时任务执行记录表：记录每次调度/手动触发的执行结果
+
+CREATE TABLE IF NOT EXISTS job_runs (
+  id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+  job_name        VARCHAR(64) NOT NULL COMMENT '任务名称',
+  trigger_type    VARCHAR(20) DEFAULT 'schedule' COMMENT 'schedule / manual',
+  triggered_by    BIGINT DEFAULT 0 COMMENT '手动触发的管理员ID',
+  instance        VARCHAR(100) DEFAULT '' COMMENT '执行实例(hostname:pid)',
+  status          VARCHAR(20) DEFAULT 'running' COMMENT 'running / succeeded / failed',
+  started_at      DATETIME NOT NULL COMMENT '开始时间',
+  finished_at     DATETIME NULL COMMENT '结束时间',
+  duration_ms     BIGINT DEFAULT 0 COMMENT '耗时(毫秒)',
+  items_processed INT DEFAULT 0 COMMENT '处理条目数',
+  error_message   TEXT COMMENT '错误信息',
+  created_at      DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at      DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  INDEX idx_job_runs_job_name (job_name),
+  INDEX idx_job_runs_status (status),
+  INDEX idx_job_runs_started_at (started_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='定时任务执行记录表';
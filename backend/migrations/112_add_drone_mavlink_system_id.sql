@@ -0,0 +1,5 @@
+-- 112_add_drone_mavlink_system_id.sql
+-- 无人机绑定飞控 MAVLink 系统ID，UDP 遥测按系统ID映射到无人机及执行中的飞行记录
+
+ALTER TABLE drones ADD COLUMN IF NOT EXISTS mavlink_system_id INT DEFAULT 0 COMMENT '飞控MAVLink系统ID，0表示未接入' AFTER description;
+ALTER TABLE drones ADD INDEX IF NOT EXISTS idx_drones_mavlink_system_id (mavlink_system_id);
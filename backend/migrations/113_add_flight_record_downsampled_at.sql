@@ -0,0 +1,10 @@
+-- 113_add_flight_record_downsampled_at.sql
+-- 飞行位置分级存储：结束超过全精度保留期的飞行记录，其位置点按 Douglas-Peucker 简化后标记降采样时间
+
+ALTER TABLE flight_records ADD COLUMN IF NOT EXISTS positions_downsampled_at DATETIME NULL COMMENT '位置点降采样时间' AFTER status;
+ALTER TABLE flight_records ADD INDEX IF NOT EXISTS idx_flight_records_downsample (status, positions_downsampled_at);
+
+INSERT INTO flight_monitor_configs (config_key, config_value, config_type, description) VALUES
+('position_full_resolution_days', '7', 'int', '位置点全精度保留天数'),
+('position_retention_days', '0', 'int', '位置点最长保留天数(0为不删除)')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
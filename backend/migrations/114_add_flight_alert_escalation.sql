@@ -0,0 +1,14 @@
+-- 114_add_flight_alert_escalation.sql
+-- 飞行告警去重与升级：同一飞行同一告警码合并计数，未确认的告警按 飞手→机主→值班管理员 逐级通知
+
+ALTER TABLE flight_alerts ADD COLUMN IF NOT EXISTS occurrence_count INT NOT NULL DEFAULT 1 COMMENT '重复触发次数' AFTER resolution_note;
+ALTER TABLE flight_alerts ADD COLUMN IF NOT EXISTS last_seen_at DATETIME NULL COMMENT '最近一次触发时间' AFTER occurrence_count;
+ALTER TABLE flight_alerts ADD COLUMN IF NOT EXISTS escalation_level INT NOT NULL DEFAULT 0 COMMENT '已通知的升级步骤数' AFTER last_seen_at;
+ALTER TABLE flight_alerts ADD COLUMN IF NOT EXISTS next_escalation_at DATETIME NULL COMMENT '下次升级时间' AFTER escalation_level;
+ALTER TABLE flight_alerts ADD INDEX IF NOT EXISTS idx_flight_alerts_escalation (status, next_escalation_at);
+ALTER TABLE flight_alerts ADD INDEX IF NOT EXISTS idx_flight_alerts_dedup (flight_record_id, alert_code, status);
+
+INSERT INTO flight_monitor_configs (config_key, config_value, config_type, description) VALUES
+('alert_escalation_interval', '60', 'int', '告警逐级升级间隔(秒)'),
+('alert_oncall_admin_ids', '', 'string', '值班管理员用户ID(逗号分隔，为空时通知全部管理员)')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
@@ -0,0 +1,13 @@
+-- 115_add_settlement_pipeline.sql
+-- 自动结算流水线：订单完成后入队结算，按实际飞行数据计算，争议期结束且无未决纠纷时自动确认并入账
+
+ALTER TABLE order_settlements ADD COLUMN IF NOT EXISTS auto_confirm_at DATETIME NULL COMMENT '争议期结束、自动确认时间' AFTER notes;
+ALTER TABLE order_settlements ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0 COMMENT '当前阶段连续失败次数' AFTER auto_confirm_at;
+ALTER TABLE order_settlements ADD COLUMN IF NOT EXISTS last_error VARCHAR(500) NULL COMMENT '最近一次失败原因' AFTER attempts;
+ALTER TABLE order_settlements ADD COLUMN IF NOT EXISTS next_retry_at DATETIME NULL COMMENT '失败后下次重试时间' AFTER last_error;
+ALTER TABLE order_settlements ADD INDEX IF NOT EXISTS idx_order_settlements_pipeline (status, next_retry_at);
+ALTER TABLE order_settlements ADD INDEX IF NOT EXISTS idx_order_settlements_auto_confirm (status, auto_confirm_at);
+
+INSERT INTO pricing_configs (config_key, config_value, unit, description, category) VALUES
+    ('settlement_dispute_window_hours', 72, '小时', '订单完成后的争议期，期满且无未决纠纷时自动确认结算', 'settlement')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
@@ -0,0 +1,42 @@
+-- 116_create_ledger.sql
+-- 复式记账：平台/托管/保险/外部及各用户账户，每笔资金变动为借贷平衡的凭证，钱包余额由账本汇总
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+  id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+  account_type VARCHAR(20) NOT NULL COMMENT 'platform / escrow / insurance / external / pilot / owner / client',
+  user_id      BIGINT NOT NULL DEFAULT 0 COMMENT '用户账户所属用户，系统账户为0',
+  bucket       VARCHAR(20) NOT NULL DEFAULT 'available' COMMENT 'available / frozen / deposit',
+  balance      BIGINT NOT NULL DEFAULT 0 COMMENT '余额(分)，等于该账户全部分录之和',
+  created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at   DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uk_ledger_accounts_owner (account_type, user_id, bucket),
+  INDEX idx_ledger_accounts_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='账本账户表';
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+  entry_no        VARCHAR(50) NOT NULL COMMENT '凭证号',
+  entry_type      VARCHAR(30) NOT NULL COMMENT 'payment_capture / settlement / withdrawal_freeze / withdrawal_payout / withdrawal_release / refund / deposit_pay / deposit_refund / opening_balance',
+  reference_type  VARCHAR(30) DEFAULT '' COMMENT '关联业务类型',
+  reference_id    BIGINT DEFAULT 0 COMMENT '关联业务ID',
+  idempotency_key VARCHAR(100) NOT NULL COMMENT '幂等键，同一业务动作只记一次账',
+  description     VARCHAR(255) DEFAULT '' COMMENT '摘要',
+  created_at      DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+  UNIQUE KEY idx_ledger_entries_entry_no (entry_no),
+  UNIQUE KEY idx_ledger_entries_idempotency_key (idempotency_key),
+  INDEX idx_ledger_entries_entry_type (entry_type),
+  INDEX idx_ledger_entries_reference (reference_type, reference_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='记账凭证表';
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+  id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+  entry_id   BIGINT NOT NULL COMMENT '凭证ID',
+  account_id BIGINT NOT NULL COMMENT '账户ID',
+  amount     BIGINT NOT NULL COMMENT '金额(分)，正数增加、负数减少',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+  INDEX idx_ledger_postings_entry_id (entry_id),
+  INDEX idx_ledger_postings_account_id (account_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='记账分录表';
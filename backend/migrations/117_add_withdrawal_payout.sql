@@ -0,0 +1,26 @@
+-- 117_add_withdrawal_payout.sql
+-- 提现出款：审批后向微信/支付宝/银行批量代付提交出款，异步同步结果，失败自动解冻退回余额
+
+ALTER TABLE withdrawal_records ADD COLUMN IF NOT EXISTS payout_batch_no VARCHAR(50) NULL COMMENT '银行卡批量代付批次号' AFTER fail_reason;
+ALTER TABLE withdrawal_records ADD COLUMN IF NOT EXISTS payout_submitted_at DATETIME NULL COMMENT '渠道受理时间' AFTER payout_batch_no;
+ALTER TABLE withdrawal_records ADD COLUMN IF NOT EXISTS payout_attempts INT NOT NULL DEFAULT 0 COMMENT '提交/查询未得到最终结果的次数' AFTER payout_submitted_at;
+ALTER TABLE withdrawal_records ADD COLUMN IF NOT EXISTS next_payout_query_at DATETIME NULL COMMENT '下次提交或查询出款结果的时间' AFTER payout_attempts;
+ALTER TABLE withdrawal_records ADD INDEX IF NOT EXISTS idx_withdrawal_records_payout_batch_no (payout_batch_no);
+ALTER TABLE withdrawal_records ADD INDEX IF NOT EXISTS idx_withdrawal_records_next_payout_query_at (next_payout_query_at);
+
+CREATE TABLE IF NOT EXISTS payout_batches (
+  id                 BIGINT AUTO_INCREMENT PRIMARY KEY,
+  batch_no           VARCHAR(50) NOT NULL COMMENT '批次号',
+  status             VARCHAR(20) DEFAULT 'exported' COMMENT 'exported / completed',
+  total_count        INT DEFAULT 0 COMMENT '总笔数',
+  total_amount       BIGINT DEFAULT 0 COMMENT '总金额(分)',
+  succeeded_count    INT DEFAULT 0 COMMENT '成功笔数',
+  failed_count       INT DEFAULT 0 COMMENT '失败笔数',
+  exported_by        BIGINT DEFAULT 0 COMMENT '导出管理员ID',
+  result_imported_at DATETIME NULL COMMENT '最近一次导入回单时间',
+  created_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY idx_payout_batches_batch_no (batch_no),
+  INDEX idx_payout_batches_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='银行卡批量代付批次表';
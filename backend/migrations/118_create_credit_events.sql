@@ -0,0 +1,36 @@
+-- 118_create_credit_events.sql
+-- 信用事件：订单完成/取消、评价、纠纷判责、违规确认与围栏闯入按规则计入信用分，影响随时间衰减
+
+CREATE TABLE IF NOT EXISTS credit_events (
+  id             BIGINT AUTO_INCREMENT PRIMARY KEY,
+  event_key      VARCHAR(100) NOT NULL COMMENT '幂等键，同一业务事件只计一次',
+  event_type     VARCHAR(30) NOT NULL COMMENT 'order_completed / order_cancelled / review_received / dispute_lost / violation_confirmed / geofence_violation',
+  user_id        BIGINT NOT NULL COMMENT '计入信用的用户ID',
+  user_type      VARCHAR(20) NOT NULL COMMENT 'pilot / owner / client',
+  order_id       BIGINT DEFAULT 0 COMMENT '关联订单ID',
+  review_id      BIGINT DEFAULT 0 COMMENT '关联评价ID',
+  related_id     BIGINT DEFAULT 0 COMMENT '关联违规/纠纷/围栏ID',
+  rating         INT DEFAULT 0 COMMENT '评价星级',
+  severity       VARCHAR(30) NULL COMMENT '违规等级 / 围栏类型',
+  detail         VARCHAR(255) NULL COMMENT '事件说明',
+  dimension      VARCHAR(30) NULL COMMENT '影响的信用维度',
+  points         INT DEFAULT 0 COMMENT '初始影响分',
+  applied_points INT DEFAULT 0 COMMENT '当前计入信用分的影响分(衰减后)',
+  status         VARCHAR(20) DEFAULT 'pending' COMMENT 'pending / applied / revoked',
+  attempts       INT DEFAULT 0 COMMENT '计入失败次数',
+  last_error     VARCHAR(255) NULL COMMENT '最近一次计入失败原因',
+  occurred_at    DATETIME NULL COMMENT '事件发生时间',
+  applied_at     DATETIME NULL COMMENT '计入时间',
+  created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at     DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY idx_credit_events_event_key (event_key),
+  INDEX idx_credit_events_event_type (event_type),
+  INDEX idx_credit_events_user_id (user_id),
+  INDEX idx_credit_events_order_id (order_id),
+  INDEX idx_credit_events_status (status),
+  INDEX idx_credit_events_occurred_at (occurred_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='信用事件表';
+
+ALTER TABLE credit_score_logs ADD COLUMN IF NOT EXISTS related_event_id BIGINT DEFAULT 0 COMMENT '关联信用事件ID' AFTER related_review_id;
+ALTER TABLE credit_score_logs ADD INDEX IF NOT EXISTS idx_credit_score_logs_related_event_id (related_event_id);
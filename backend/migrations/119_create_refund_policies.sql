@@ -0,0 +1,27 @@
+-- 119_create_refund_policies.sql
+-- 取消退款政策：按服务类型与订单来源分版本配置取消规则，订单创建时记录所用政策版本
+
+CREATE TABLE IF NOT EXISTS refund_policies (
+  id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+  policy_code  VARCHAR(50) NOT NULL COMMENT '政策编码，同一编码下多个版本',
+  version      INT NOT NULL COMMENT '版本号，同一编码内递增',
+  name         VARCHAR(100) NULL COMMENT '政策名称',
+  service_type VARCHAR(30) NULL COMMENT '适用服务类型，空表示全部',
+  order_source VARCHAR(30) NULL COMMENT '适用订单来源，空表示全部',
+  status       VARCHAR(20) DEFAULT 'draft' COMMENT 'draft / active / retired',
+  rules        JSON NULL COMMENT '取消规则列表，按顺序取第一条命中的规则',
+  description  VARCHAR(255) NULL COMMENT '说明',
+  created_by   BIGINT DEFAULT 0 COMMENT '创建管理员ID',
+  activated_at DATETIME NULL COMMENT '启用时间',
+  created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at   DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uk_refund_policy_version (policy_code, version),
+  INDEX idx_refund_policies_service_type (service_type),
+  INDEX idx_refund_policies_order_source (order_source),
+  INDEX idx_refund_policies_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='取消退款政策表';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refund_policy_id BIGINT DEFAULT 0 COMMENT '下单时适用的退款政策ID，0 表示内置默认政策' AFTER cancel_by;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refund_policy_version INT DEFAULT 0 COMMENT '下单时适用的退款政策版本' AFTER refund_policy_id;
+ALTER TABLE orders ADD INDEX IF NOT EXISTS idx_orders_refund_policy_id (refund_policy_id);
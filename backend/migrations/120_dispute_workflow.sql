@@ -0,0 +1,41 @@
+-- 120_dispute_workflow.sql
+-- 订单纠纷处理：答辩、仲裁分配、裁决与处理时限字段，纠纷证据表
+
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS initiator_role VARCHAR(20) NULL COMMENT '发起方角色 client / owner / pilot' AFTER initiator_user_id;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS respondent_user_id BIGINT DEFAULT 0 COMMENT '被申诉方用户ID' AFTER initiator_role;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS arbitrator_id BIGINT DEFAULT 0 COMMENT '仲裁管理员ID' AFTER summary;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS assigned_at DATETIME NULL COMMENT '分配仲裁时间' AFTER arbitrator_id;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS responded_at DATETIME NULL COMMENT '答辩时间' AFTER assigned_at;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS response_due_at DATETIME NULL COMMENT '答辩截止时间' AFTER responded_at;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS resolution_due_at DATETIME NULL COMMENT '处理时限' AFTER response_due_at;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS sla_breached TINYINT(1) DEFAULT 0 COMMENT '是否超过处理时限' AFTER resolution_due_at;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS resolution VARCHAR(20) NULL COMMENT 'full_refund / partial_refund / penalty / dismiss' AFTER sla_breached;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS refund_amount BIGINT DEFAULT 0 COMMENT '裁决退款金额(分)' AFTER resolution;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS penalty_amount BIGINT DEFAULT 0 COMMENT '责任方罚金(分)，从其结算分成中扣除' AFTER refund_amount;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS liable_user_id BIGINT DEFAULT 0 COMMENT '责任方用户ID' AFTER penalty_amount;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS liable_role VARCHAR(20) NULL COMMENT '责任方角色' AFTER liable_user_id;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS resolution_note TEXT NULL COMMENT '裁决说明' AFTER liable_role;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS resolved_by BIGINT DEFAULT 0 COMMENT '裁决管理员ID' AFTER resolution_note;
+ALTER TABLE dispute_records ADD COLUMN IF NOT EXISTS resolved_at DATETIME NULL COMMENT '裁决时间' AFTER resolved_by;
+ALTER TABLE dispute_records ADD INDEX IF NOT EXISTS idx_dispute_records_respondent_user_id (respondent_user_id);
+ALTER TABLE dispute_records ADD INDEX IF NOT EXISTS idx_dispute_records_arbitrator_id (arbitrator_id);
+ALTER TABLE dispute_records ADD INDEX IF NOT EXISTS idx_dispute_records_response_due_at (response_due_at);
+ALTER TABLE dispute_records ADD INDEX IF NOT EXISTS idx_dispute_records_resolution_due_at (resolution_due_at);
+ALTER TABLE dispute_records ADD INDEX IF NOT EXISTS idx_dispute_records_liable_user_id (liable_user_id);
+
+CREATE TABLE IF NOT EXISTS dispute_evidences (
+  id                BIGINT AUTO_INCREMENT PRIMARY KEY,
+  dispute_id        BIGINT NOT NULL COMMENT '纠纷ID',
+  order_id          BIGINT NOT NULL COMMENT '订单ID',
+  submitter_user_id BIGINT DEFAULT 0 COMMENT '提交人，0 表示系统',
+  submitter_role    VARCHAR(20) NULL COMMENT 'client / owner / pilot / admin / system',
+  evidence_type     VARCHAR(20) NOT NULL COMMENT 'file / statement / counter_statement / flight_track / flight_alert',
+  content           TEXT NULL COMMENT '文字说明',
+  file_url          VARCHAR(500) NULL COMMENT '上传文件地址',
+  data              JSON NULL COMMENT '系统附加的飞行轨迹/告警数据',
+  created_at        DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+  INDEX idx_dispute_evidences_dispute_id (dispute_id),
+  INDEX idx_dispute_evidences_order_id (order_id),
+  INDEX idx_dispute_evidences_submitter_user_id (submitter_user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='纠纷证据表';
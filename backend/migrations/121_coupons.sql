@@ -0,0 +1,68 @@
+-- 121_coupons.sql
+-- 优惠券：模板、用户券包、订单用券字段与邀请人
+
+CREATE TABLE IF NOT EXISTS coupon_templates (
+  id               BIGINT AUTO_INCREMENT PRIMARY KEY,
+  code             VARCHAR(50) NOT NULL COMMENT '模板编码',
+  name             VARCHAR(100) NOT NULL COMMENT '名称',
+  description      VARCHAR(255) NULL,
+  discount_type    VARCHAR(20) NOT NULL COMMENT 'fixed / percentage',
+  discount_amount  BIGINT DEFAULT 0 COMMENT '满减金额(分)',
+  discount_rate    DECIMAL(5,4) DEFAULT 0 COMMENT '折扣比例，0.15 表示减免15%',
+  max_discount     BIGINT DEFAULT 0 COMMENT '折扣封顶(分)，0 表示不封顶',
+  min_order_amount BIGINT DEFAULT 0 COMMENT '使用门槛(分)',
+  first_order_only TINYINT(1) DEFAULT 0 COMMENT '仅限首单',
+  service_types    JSON NULL COMMENT '限定服务类型',
+  cities           JSON NULL COMMENT '限定城市',
+  funded_by        VARCHAR(20) DEFAULT 'platform' COMMENT 'platform 平台补贴 / provider 服务方让利',
+  issue_trigger    VARCHAR(20) DEFAULT 'manual' COMMENT 'manual / new_user / referral',
+  total_quantity   INT DEFAULT 0 COMMENT '发放总量，0 表示不限',
+  issued_count     INT DEFAULT 0 COMMENT '已发放数量',
+  per_user_limit   INT DEFAULT 1 COMMENT '每人限领张数',
+  valid_days       INT DEFAULT 0 COMMENT '领取后有效天数',
+  valid_from       DATETIME NULL,
+  valid_until      DATETIME NULL,
+  status           VARCHAR(20) DEFAULT 'active' COMMENT 'active / disabled',
+  created_by       BIGINT DEFAULT 0,
+  created_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at       DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_coupon_templates_code (code),
+  INDEX idx_coupon_templates_issue_trigger (issue_trigger),
+  INDEX idx_coupon_templates_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='优惠券模板表';
+
+CREATE TABLE IF NOT EXISTS user_coupons (
+  id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+  template_id     BIGINT NOT NULL COMMENT '优惠券模板ID',
+  user_id         BIGINT NOT NULL COMMENT '持有用户',
+  issue_key       VARCHAR(120) NOT NULL COMMENT '发放幂等键',
+  issue_source    VARCHAR(20) NULL COMMENT 'admin_batch / new_user / referral',
+  source_id       BIGINT DEFAULT 0 COMMENT '发放操作人或被邀请人',
+  status          VARCHAR(20) DEFAULT 'available' COMMENT 'available / locked / used / expired',
+  valid_from      DATETIME NULL,
+  expires_at      DATETIME NULL,
+  order_id        BIGINT DEFAULT 0 COMMENT '锁定或已核销的订单',
+  discount_amount BIGINT DEFAULT 0 COMMENT '实际抵扣金额(分)',
+  locked_at       DATETIME NULL,
+  used_at         DATETIME NULL,
+  released_at     DATETIME NULL,
+  created_at      DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at      DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_user_coupons_issue_key (issue_key),
+  INDEX idx_user_coupons_template_id (template_id),
+  INDEX idx_user_coupons_user_id (user_id),
+  INDEX idx_user_coupons_issue_source (issue_source),
+  INDEX idx_user_coupons_status (status),
+  INDEX idx_user_coupons_expires_at (expires_at),
+  INDEX idx_user_coupons_order_id (order_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户优惠券表';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS user_coupon_id BIGINT DEFAULT 0 COMMENT '使用的优惠券' AFTER owner_amount;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS coupon_discount BIGINT DEFAULT 0 COMMENT '优惠券抵扣金额(分)' AFTER user_coupon_id;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS coupon_funded_by VARCHAR(20) NULL COMMENT 'platform / provider' AFTER coupon_discount;
+ALTER TABLE orders ADD INDEX IF NOT EXISTS idx_orders_user_coupon_id (user_coupon_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referrer_id BIGINT DEFAULT 0 COMMENT '邀请注册的用户' AFTER qq_open_id;
+ALTER TABLE users ADD INDEX IF NOT EXISTS idx_users_referrer_id (referrer_id);
@@ -0,0 +1,4 @@
+-- 122_order_pricing_snapshot.sql
+-- 统一定价引擎：订单记录下单时的分项报价快照，结算按快照记录费用明细
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS pricing_snapshot JSON NULL COMMENT '下单时的分项报价' AFTER total_amount;
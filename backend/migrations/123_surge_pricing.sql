@@ -0,0 +1,48 @@
+-- 123_surge_pricing.sql
+-- 动态溢价：按城市与网格的供需倍率、倍率变更记录，结算记录下单时锁定的倍率
+
+CREATE TABLE IF NOT EXISTS surge_multipliers (
+  id                BIGINT AUTO_INCREMENT PRIMARY KEY,
+  scope_type        VARCHAR(10) NOT NULL COMMENT 'city / cell',
+  scope_key         VARCHAR(60) NOT NULL COMMENT '城市名或网格编号',
+  city              VARCHAR(50) NULL,
+  multiplier        DECIMAL(5,2) DEFAULT 1 COMMENT '平滑后的生效倍率',
+  raw_multiplier    DECIMAL(5,2) DEFAULT 1 COMMENT '按当前供需直接算出的倍率',
+  demand_count      INT DEFAULT 0 COMMENT '进行中的需求',
+  task_count        INT DEFAULT 0 COMMENT '待派单任务',
+  pilot_count       INT DEFAULT 0 COMMENT '在线飞手',
+  drone_count       INT DEFAULT 0 COMMENT '可用无人机',
+  manual_multiplier DECIMAL(5,2) DEFAULT 0 COMMENT '人工设定倍率，大于0且未过期时覆盖自动倍率',
+  manual_until      DATETIME NULL COMMENT '人工倍率截止时间',
+  computed_at       DATETIME NULL,
+  expires_at        DATETIME NULL COMMENT '超过有效期未刷新时按 1.0 计价',
+  created_at        DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at        DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_surge_scope (scope_type, scope_key),
+  INDEX idx_surge_multipliers_city (city),
+  INDEX idx_surge_multipliers_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='动态溢价倍率表';
+
+CREATE TABLE IF NOT EXISTS surge_multiplier_logs (
+  id                  BIGINT AUTO_INCREMENT PRIMARY KEY,
+  scope_type          VARCHAR(10) NULL,
+  scope_key           VARCHAR(60) NULL,
+  city                VARCHAR(50) NULL,
+  previous_multiplier DECIMAL(5,2) NULL COMMENT '变更前倍率',
+  raw_multiplier      DECIMAL(5,2) NULL,
+  multiplier          DECIMAL(5,2) NULL COMMENT '变更后倍率',
+  demand_count        INT DEFAULT 0,
+  task_count          INT DEFAULT 0,
+  pilot_count         INT DEFAULT 0,
+  drone_count         INT DEFAULT 0,
+  source              VARCHAR(20) NULL COMMENT 'auto / manual',
+  operator_id         BIGINT DEFAULT 0,
+  reason              VARCHAR(255) NULL,
+  created_at          DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+  INDEX idx_surge_log_scope (scope_type, scope_key),
+  INDEX idx_surge_multiplier_logs_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='动态溢价倍率变更记录';
+
+ALTER TABLE order_settlements ADD COLUMN IF NOT EXISTS surge_multiplier DECIMAL(5,2) DEFAULT 1 COMMENT '下单时锁定的供需倍率' AFTER insurance_rate;
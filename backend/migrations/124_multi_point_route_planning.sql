@@ -0,0 +1,9 @@
+-- 124_multi_point_route_planning.sql
+-- 多点航线规划：按时间窗口、载重与续航重排站点，插入返航换电站点并填写预计到达时间
+
+INSERT INTO flight_monitor_configs (config_key, config_value, config_type, description) VALUES
+('route_cruise_speed', '10', 'int', '多点航线巡航速度(米/秒)'),
+('route_stop_dwell', '120', 'int', '多点航线每站停留(秒)'),
+('route_battery_swap', '300', 'int', '返航换电耗时(秒)'),
+('route_battery_reserve', '20', 'int', '续航保留比例(%)')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
@@ -0,0 +1,8 @@
+-- 125_multi_point_stop_tracking.sql
+-- 多点任务站点自动跟踪：根据上报位置判定到站与离站，并通知收货人下一站预计到达时间
+
+INSERT INTO flight_monitor_configs (config_key, config_value, config_type, description) VALUES
+('stop_arrival_radius', '30', 'int', '自动到站判定半径(米)'),
+('stop_arrival_speed', '1', 'int', '自动到站判定地速上限(米/秒)'),
+('stop_departure_radius', '60', 'int', '自动离站判定半径(米)')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
@@ -0,0 +1,22 @@
+-- 126_credential_expiry_monitor.sql
+-- 证照到期监控：飞手执照、无犯罪记录、健康证明、资质证书及无人机保险、适航、维护到期前分档提醒，到期后置为过期并暂停接单与供给
+
+CREATE TABLE IF NOT EXISTS credential_expiry_notices (
+  id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+  subject_type    VARCHAR(20) NOT NULL COMMENT 'pilot / drone',
+  subject_id      BIGINT NOT NULL,
+  credential_type VARCHAR(30) NOT NULL COMMENT 'caac_license / criminal_check / health_check / certification / insurance / airworthiness / maintenance',
+  credential_id   BIGINT DEFAULT 0 COMMENT '资质证书ID，其余证照为0',
+  expire_date     DATETIME NOT NULL COMMENT '提醒对应的到期日，证照续期后重新提醒',
+  stage           INT DEFAULT 0 COMMENT '提前提醒天数(30/7/1)，0 表示已过期处理',
+  user_id         BIGINT DEFAULT 0 COMMENT '接收提醒的飞手或机主',
+  created_at      DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_credential_notice (subject_type, subject_id, credential_type, credential_id, expire_date, stage),
+  INDEX idx_credential_expiry_notices_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='证照到期提醒记录';
+
+ALTER TABLE pilots MODIFY COLUMN criminal_check_status VARCHAR(20) DEFAULT 'pending' COMMENT 'pending, approved, rejected, expired';
+ALTER TABLE pilots MODIFY COLUMN health_check_status VARCHAR(20) DEFAULT 'pending' COMMENT 'pending, approved, rejected, expired';
+ALTER TABLE drones MODIFY COLUMN insurance_verified VARCHAR(20) DEFAULT 'pending' COMMENT 'pending, verified, rejected, expired';
+ALTER TABLE drones MODIFY COLUMN airworthiness_verified VARCHAR(20) DEFAULT 'pending' COMMENT 'pending, verified, rejected, expired';
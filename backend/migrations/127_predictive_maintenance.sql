@@ -0,0 +1,86 @@
+-- 127_predictive_maintenance.sql
+-- 预测性维护：按已结束的飞行累加无人机飞行小时、起降次数、载重小时与紧急告警，对照机型维护计划生成维护工单，超过强制上限时停飞
+
+ALTER TABLE flight_records ADD COLUMN maintenance_counted_at DATETIME NULL COMMENT '计入无人机维护使用量的时间';
+CREATE INDEX idx_flight_records_maintenance_counted ON flight_records (maintenance_counted_at, status);
+
+CREATE TABLE IF NOT EXISTS drone_usage_counters (
+  id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+  drone_id        BIGINT NOT NULL,
+  flight_hours    DECIMAL(12,2) DEFAULT 0 COMMENT '累计飞行小时',
+  cycles          INT DEFAULT 0 COMMENT '累计起降次数',
+  payload_hours   DECIMAL(14,2) DEFAULT 0 COMMENT '累计载重小时(公斤·小时)',
+  critical_alerts INT DEFAULT 0 COMMENT '累计紧急告警数',
+  last_flight_at  DATETIME NULL,
+  created_at      DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at      DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_drone_usage_counters_drone_id (drone_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='无人机累计使用量';
+
+CREATE TABLE IF NOT EXISTS maintenance_schedules (
+  id             BIGINT AUTO_INCREMENT PRIMARY KEY,
+  brand          VARCHAR(100) DEFAULT '' COMMENT '为空表示通用计划',
+  model          VARCHAR(100) DEFAULT '' COMMENT '为空表示该品牌通用',
+  component      VARCHAR(50) NOT NULL COMMENT 'propeller / motor / airframe / payload_mechanism / flight_controller / general',
+  component_name VARCHAR(100) DEFAULT '',
+  metric         VARCHAR(30) NOT NULL COMMENT 'flight_hours / cycles / payload_hours / critical_alerts / days',
+  interval_value DECIMAL(12,2) DEFAULT 0 COMMENT '维护间隔',
+  warn_before    DECIMAL(12,2) DEFAULT 0 COMMENT '距到期剩余该值时生成工单',
+  hard_limit     DECIMAL(12,2) DEFAULT 0 COMMENT '超过即停飞，0 表示不强制',
+  enabled        TINYINT(1) DEFAULT 1,
+  created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at     DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  INDEX idx_maintenance_schedule_model (brand, model)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='机型部件维护计划';
+
+CREATE TABLE IF NOT EXISTS drone_component_baselines (
+  id                 BIGINT AUTO_INCREMENT PRIMARY KEY,
+  drone_id           BIGINT NOT NULL,
+  component          VARCHAR(50) NOT NULL,
+  serviced_at        DATETIME NULL COMMENT '上次维护时间',
+  flight_hours       DECIMAL(12,2) DEFAULT 0,
+  cycles             INT DEFAULT 0,
+  payload_hours      DECIMAL(14,2) DEFAULT 0,
+  critical_alerts    INT DEFAULT 0,
+  maintenance_log_id BIGINT DEFAULT 0,
+  created_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_drone_component (drone_id, component)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='部件上次维护时的使用量快照';
+
+CREATE TABLE IF NOT EXISTS maintenance_work_orders (
+  id                 BIGINT AUTO_INCREMENT PRIMARY KEY,
+  work_order_no      VARCHAR(30) NOT NULL,
+  drone_id           BIGINT NOT NULL,
+  owner_id           BIGINT NOT NULL,
+  schedule_id        BIGINT DEFAULT 0,
+  component          VARCHAR(50) DEFAULT '',
+  component_name     VARCHAR(100) DEFAULT '',
+  metric             VARCHAR(30) DEFAULT '',
+  usage_value        DECIMAL(12,2) DEFAULT 0 COMMENT '生成或最近升级时的使用量',
+  interval_value     DECIMAL(12,2) DEFAULT 0,
+  hard_limit         DECIMAL(12,2) DEFAULT 0,
+  level              VARCHAR(20) DEFAULT '' COMMENT 'due_soon / due / hard_limit',
+  status             VARCHAR(20) DEFAULT 'open' COMMENT 'open / completed',
+  grounded           TINYINT(1) DEFAULT 0 COMMENT '是否已因超过强制上限停飞',
+  maintenance_log_id BIGINT DEFAULT 0,
+  completed_at       DATETIME NULL,
+  created_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_maintenance_work_orders_work_order_no (work_order_no),
+  INDEX idx_maintenance_work_orders_drone_id (drone_id),
+  INDEX idx_maintenance_work_orders_owner_id (owner_id),
+  INDEX idx_maintenance_work_orders_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='无人机维护工单';
+
+INSERT INTO maintenance_schedules (brand, model, component, component_name, metric, interval_value, warn_before, hard_limit) VALUES
+  ('', '', 'propeller', '螺旋桨', 'flight_hours', 50, 5, 60),
+  ('', '', 'motor', '电机', 'flight_hours', 200, 20, 240),
+  ('', '', 'airframe', '机身结构', 'cycles', 500, 50, 600),
+  ('', '', 'payload_mechanism', '挂载机构', 'payload_hours', 1000, 100, 1200),
+  ('', '', 'flight_controller', '飞控与传感器', 'critical_alerts', 5, 1, 10),
+  ('', '', 'general', '全面检查', 'days', 90, 7, 0);
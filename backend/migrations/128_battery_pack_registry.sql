@@ -0,0 +1,58 @@
+-- 128_battery_pack_registry.sql
+-- 电池包登记：按序列号登记并绑定无人机，按飞行记录累计充放电循环、由放电曲线估算健康度，起飞前拒绝健康度不足的电池包
+
+CREATE TABLE IF NOT EXISTS battery_packs (
+  id                 BIGINT AUTO_INCREMENT PRIMARY KEY,
+  owner_id           BIGINT NOT NULL,
+  drone_id           BIGINT DEFAULT 0 COMMENT '绑定的无人机，0 表示未绑定',
+  serial_number      VARCHAR(100) NOT NULL,
+  brand              VARCHAR(100) DEFAULT '',
+  model              VARCHAR(100) DEFAULT '',
+  chemistry          VARCHAR(20) DEFAULT '' COMMENT 'lipo / lihv / li_ion / solid_state',
+  rated_capacity_mah INT DEFAULT 0 COMMENT '额定容量(mAh)',
+  rated_voltage      DECIMAL(6,2) DEFAULT 0,
+  cell_count         INT DEFAULT 0,
+  rated_cycles       INT DEFAULT 0 COMMENT '设计循环寿命，0 表示不按循环退役',
+  cycle_count        DECIMAL(10,2) DEFAULT 0 COMMENT '等效满充放循环次数',
+  flight_count       INT DEFAULT 0,
+  health_percent     DECIMAL(5,2) DEFAULT 100 COMMENT '按放电曲线估算的健康度',
+  status             VARCHAR(20) DEFAULT 'active' COMMENT 'active / retired',
+  retire_reason      VARCHAR(255) DEFAULT '',
+  retired_at         DATETIME NULL,
+  last_flight_at     DATETIME NULL,
+  created_at         DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at         DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_battery_packs_serial_number (serial_number),
+  INDEX idx_battery_packs_owner_id (owner_id),
+  INDEX idx_battery_packs_drone_id (drone_id),
+  INDEX idx_battery_packs_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='电池包';
+
+CREATE TABLE IF NOT EXISTS battery_flight_logs (
+  id               BIGINT AUTO_INCREMENT PRIMARY KEY,
+  battery_pack_id  BIGINT NOT NULL,
+  order_id         BIGINT NOT NULL,
+  drone_id         BIGINT DEFAULT 0,
+  flight_record_id BIGINT DEFAULT 0,
+  sequence         INT DEFAULT 1 COMMENT '第几组电池，中途换电后递增',
+  checked_by       BIGINT DEFAULT 0 COMMENT '执行飞前检查的用户',
+  checked_at       DATETIME NULL,
+  health_at_check  DECIMAL(5,2) DEFAULT 0,
+  start_level      INT DEFAULT 0 COMMENT '起始电量(%)',
+  end_level        INT DEFAULT 0 COMMENT '结束电量(%)',
+  discharge_rate   DECIMAL(8,3) DEFAULT 0 COMMENT '放电速率(%/分钟)',
+  duration_seconds INT DEFAULT 0,
+  cycle_increment  DECIMAL(6,3) DEFAULT 0 COMMENT '本次计入的等效循环',
+  health_sample    DECIMAL(5,2) DEFAULT 0 COMMENT '本次放电曲线估算的健康度，0 表示数据不足',
+  health_after     DECIMAL(5,2) DEFAULT 0 COMMENT '平滑后的健康度',
+  status           VARCHAR(20) DEFAULT 'checked' COMMENT 'checked / recorded',
+  recorded_at      DATETIME NULL,
+  created_at       DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at       DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE INDEX idx_battery_order (battery_pack_id, order_id),
+  INDEX idx_battery_flight_logs_order_id (order_id),
+  INDEX idx_battery_flight_logs_drone_id (drone_id),
+  INDEX idx_battery_flight_logs_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='电池包飞行使用记录';